@@ -4,6 +4,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -18,8 +19,10 @@ import (
 
 	"chain/core"
 	"chain/core/accesstoken"
+	"chain/core/asset"
 	"chain/core/config"
 	"chain/core/rpc"
+	"chain/core/txdb"
 	"chain/crypto/ed25519"
 	"chain/env"
 	"chain/errors"
@@ -32,6 +35,7 @@ import (
 var (
 	home    = config.HomeDirFromEnvironment()
 	coreURL = env.String("CORE_URL", "http://localhost:1999")
+	dbURL   = env.String("DATABASE_URL", "postgres:///core?sslmode=disable")
 
 	// build vars; initialized by the linker
 	buildTag    = "?"
@@ -54,22 +58,28 @@ type grantReq struct {
 }
 
 var commands = map[string]*command{
-	"config-generator":     {configGenerator},
-	"create-block-keypair": {createBlockKeyPair},
-	"create-token":         {createToken},
-	"config":               {configNongenerator},
-	"reset":                {reset},
-	"grant":                {grant},
-	"revoke":               {revoke},
-	"join":                 {joinCluster},
-	"init":                 {initCluster},
-	"evict":                {evictNode},
-	"allow-address":        {allowRaftMember},
-	"get":                  {get},
-	"add":                  {add},
-	"rm":                   {rm},
-	"set":                  {set},
-	"wait":                 {wait},
+	"config-generator":      {configGenerator},
+	"create-block-keypair":  {createBlockKeyPair},
+	"create-token":          {createToken},
+	"config":                {configNongenerator},
+	"reset":                 {reset},
+	"grant":                 {grant},
+	"revoke":                {revoke},
+	"join":                  {joinCluster},
+	"init":                  {initCluster},
+	"evict":                 {evictNode},
+	"allow-address":         {allowRaftMember},
+	"get":                   {get},
+	"add":                   {add},
+	"rm":                    {rm},
+	"set":                   {set},
+	"wait":                  {wait},
+	"verify-standby":        {verifyStandby},
+	"freeze":                {freezeObject},
+	"unfreeze":              {unfreezeObject},
+	"generate-block":        {generateBlock},
+	"rotate-signing-secret": {rotateSigningSecret},
+	"reconcile-circulation": {reconcileCirculation},
 }
 
 func main() {
@@ -498,6 +508,135 @@ func wait(client *rpc.Client, args []string) {
 	}
 }
 
+// verifyStandby replays the blockchain in the core's database
+// against a standby database, and reports each block at which
+// the standby diverges.
+func verifyStandby(_ *rpc.Client, args []string) {
+	if len(args) != 1 {
+		fatalln("usage: corectl verify-standby [standby database url]")
+	}
+
+	primary, err := sql.Open("hapg", *dbURL)
+	if err != nil {
+		fatalln("error: opening database:", err)
+	}
+	defer primary.Close()
+	standby, err := sql.Open("hapg", args[0])
+	if err != nil {
+		fatalln("error: opening standby database:", err)
+	}
+	defer standby.Close()
+
+	r, err := txdb.VerifyStandby(context.Background(), primary, standby)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	for _, d := range r.Divergences {
+		fmt.Printf("block %d: %s\n", d.Height, d.Reason)
+	}
+	fmt.Printf("primary height %d, standby height %d, %d divergent blocks\n", r.Height, r.StandbyHeight, len(r.Divergences))
+	if len(r.Divergences) > 0 {
+		os.Exit(1)
+	}
+}
+
+// freezeObject freezes an asset or account, so that the core
+// won't build transactions using it until it's unfrozen.
+func freezeObject(client *rpc.Client, args []string) {
+	const usage = "usage: corectl freeze [-alias] [asset|account] [id] [reason]"
+	req, rest := freezeArgs(args, usage)
+	if len(rest) == 0 {
+		fatalln(usage)
+	}
+	req["reason"] = strings.Join(rest, " ")
+	err := client.Call(context.Background(), "/create-freeze", req, nil)
+	dieOnRPCError(err)
+}
+
+// unfreezeObject removes the freeze on an asset or account.
+func unfreezeObject(client *rpc.Client, args []string) {
+	const usage = "usage: corectl unfreeze [-alias] [asset|account] [id]"
+	req, rest := freezeArgs(args, usage)
+	if len(rest) != 0 {
+		fatalln(usage)
+	}
+	err := client.Call(context.Background(), "/delete-freeze", req, nil)
+	dieOnRPCError(err)
+}
+
+// freezeArgs parses the arguments common to freeze and
+// unfreeze into a freeze request, returning the rest.
+func freezeArgs(args []string, usage string) (req map[string]string, rest []string) {
+	var flags flag.FlagSet
+	flagAlias := flags.Bool("alias", false, "identify the object by alias instead of ID")
+	flags.Usage = func() {
+		fmt.Println(usage)
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) < 2 || (args[0] != "asset" && args[0] != "account") {
+		fatalln(usage)
+	}
+	req = map[string]string{"type": args[0]}
+	if *flagAlias {
+		req["alias"] = args[1]
+	} else {
+		req["id"] = args[1]
+	}
+	return req, args[2:]
+}
+
+// generateBlock asks the generator to make a block now rather
+// than at the end of its block period.
+func generateBlock(client *rpc.Client, args []string) {
+	if len(args) != 0 {
+		fatalln("error: generate-block takes no args")
+	}
+	err := client.Call(context.Background(), "/generate-block", nil, nil)
+	dieOnRPCError(err)
+}
+
+// rotateSigningSecret replaces the request signing secret of
+// an access token and prints the new one. Requests signed
+// with the old secret are rejected from then on.
+func rotateSigningSecret(client *rpc.Client, args []string) {
+	if len(args) != 1 {
+		fatalln("usage: corectl rotate-signing-secret [access token id]")
+	}
+	req := map[string]string{"access_token_id": args[0]}
+	var resp struct {
+		Secret string `json:"secret"`
+	}
+	err := client.Call(context.Background(), "/create-request-signing-secret", req, &resp)
+	dieOnRPCError(err)
+	fmt.Println(resp.Secret)
+}
+
+// reconcileCirculation corrects drift between each asset's
+// circulation totals and the blocks they count now, rather
+// than waiting for the leader's daily run, and prints the
+// assets it corrected.
+func reconcileCirculation(_ *rpc.Client, args []string) {
+	if len(args) != 0 {
+		fatalln("error: reconcile-circulation takes no args")
+	}
+	db, err := sql.Open("hapg", *dbURL)
+	if err != nil {
+		fatalln("error: opening database:", err)
+	}
+	defer db.Close()
+
+	repaired, err := asset.RepairCirculation(context.Background(), db)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	for _, assetID := range repaired {
+		fmt.Println(assetID)
+	}
+}
+
 func mustRPCClient() *rpc.Client {
 	// TODO(kr): refactor some of this cert-loading logic into chain/core
 	// and use it from cored as well.
@@ -14,10 +14,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/kr/secureheader"
@@ -29,6 +31,7 @@ import (
 	"chain/core/generator"
 	"chain/core/migrate"
 	"chain/core/rpc"
+	"chain/core/screening"
 	"chain/core/txdb"
 	"chain/crypto/ed25519"
 	"chain/database/pg"
@@ -55,18 +58,27 @@ const (
 
 var (
 	// config vars
-	rootCAs       = env.String("ROOT_CA_CERTS", "") // file path
+	rootCAs       = env.String("ROOT_CA_CERTS", "")   // file path
+	clientCAs     = env.String("CLIENT_CA_CERTS", "") // file path
 	listenAddr    = env.String("LISTEN", ":1999")
 	dbURL         = env.String("DATABASE_URL", "postgres:///core?sslmode=disable")
+	readDBURL     = env.String("READ_DATABASE_URL", "") // optional read replica
 	splunkAddr    = os.Getenv("SPLUNKADDR")
 	logFile       = os.Getenv("LOGFILE")
 	logSize       = env.Int("LOGSIZE", 5e6) // 5MB
 	logCount      = env.Int("LOGCOUNT", 9)
 	logQueries    = env.Bool("LOG_QUERIES", false)
-	maxDBConns    = env.Int("MAXDBCONNS", 10)           // set to 100 in prod
-	rpsToken      = env.Int("RATELIMIT_TOKEN", 0)       // reqs/sec
-	rpsRemoteAddr = env.Int("RATELIMIT_REMOTE_ADDR", 0) // reqs/sec
+	maxDBConns    = env.Int("MAXDBCONNS", 10)               // set to 100 in prod
+	dbConnLife    = env.Duration("DB_CONN_MAX_LIFETIME", 0) // 0 means forever
+	dbStmtTimeout = env.Duration("DB_STATEMENT_TIMEOUT", 0) // API requests only; 0 means no timeout
+	rpsToken      = env.Int("RATELIMIT_TOKEN", 0)           // reqs/sec
+	rpsRemoteAddr = env.Int("RATELIMIT_REMOTE_ADDR", 0)     // reqs/sec
 	indexTxs      = env.Bool("INDEX_TRANSACTIONS", true)
+	instantBlocks = env.Bool("INSTANT_BLOCKS", false) // for development and CI only
+	autoMigrate   = env.Bool("AUTO_MIGRATE", true)    // false to require cored migrate up
+	drainTimeout  = env.Duration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	environment   = env.String("CHAIN_ENVIRONMENT", accesstoken.EnvLive) // live or test; use a separate database for each
+	screeningURL  = env.String("SCREENING_URL", "")                      // optional compliance screening service
 	home          = config.HomeDirFromEnvironment()
 
 	version string // initialized in init()
@@ -112,6 +124,12 @@ func main() {
 	v := flag.Bool("version", false, "print version information")
 	flag.Parse()
 
+	if flag.Arg(0) == "migrate" {
+		env.Parse()
+		runMigrate(flag.Args()[1:])
+		return
+	}
+
 	if !*v {
 		fmt.Printf("Chain Core starting...\n\n")
 	}
@@ -136,6 +154,9 @@ func main() {
 	ctx := context.Background()
 	env.Parse()
 	warnCompat(ctx)
+	if err := accesstoken.ValidEnvironment(*environment); err != nil {
+		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
+	}
 
 	listener, err := net.Listen("tcp", *listenAddr)
 	if err != nil {
@@ -187,19 +208,24 @@ func main() {
 		driver = sqlutil.LogDriver(driver)
 	}
 	sql.Register("coredpg", driver)
-	db, err := sql.Open("coredpg", *dbURL)
-	if err != nil {
-		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
-	}
-	db.SetMaxOpenConns(*maxDBConns)
-	db.SetMaxIdleConns(*maxDBConns)
+	db := openPool(ctx, *dbURL, "db")
 
-	err = migrate.Run(db)
-	if err != nil {
-		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
+	if *autoMigrate {
+		err = migrate.Run(db)
+		if err != nil {
+			chainlog.Fatalkv(ctx, chainlog.KeyError, err)
+		}
+	} else {
+		pending, err := migrate.Pending(db)
+		if err != nil {
+			chainlog.Fatalkv(ctx, chainlog.KeyError, err)
+		}
+		if len(pending) > 0 {
+			chainlog.Fatalkv(ctx, chainlog.KeyError, "database has pending migrations; run cored migrate up", "pending", pending)
+		}
 	}
 
-	accessTokens := &accesstoken.CredentialStore{DB: db}
+	accessTokens := &accesstoken.CredentialStore{DB: db, Environment: *environment}
 
 	// We add handlers to our serve mux in two phases. In the first phase, we start
 	// listening on the raft routes (`/raft`). This allows us to do things like
@@ -221,7 +247,12 @@ func main() {
 
 	var handler http.Handler = mux
 	handler = core.AuthHandler(handler, sdb, accessTokens, tlsConfig, builtinGrants)
+	// Allowed origins are set below, once config options
+	// can be read.
+	corsHandler := &core.CORSHandler{Next: handler}
+	handler = corsHandler
 	handler = core.RedirectHandler(handler)
+	handler = core.EnvironmentHandler(handler, *environment)
 	handler = reqid.Handler(handler)
 
 	secureheader.DefaultConfig.PermitClearLoopback = true
@@ -245,7 +276,9 @@ func main() {
 	// we call it.
 	go func() {
 		err := server.Serve(listener)
-		chainlog.Fatalkv(ctx, chainlog.KeyError, errors.Wrap(err, "Serve"))
+		if err != http.ErrServerClosed {
+			chainlog.Fatalkv(ctx, chainlog.KeyError, errors.Wrap(err, "Serve"))
+		}
 	}()
 
 	// Verify that we're connected to the rest of the cluster, if initialized.
@@ -266,6 +299,8 @@ func main() {
 	if err != nil {
 		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
 	}
+	corsHandler.SetOrigins(confOpts.ListFunc("cors_origin"))
+	corsHandler.SetRoutes(confOpts.ListFunc("cors_route"))
 
 	// Initialize internode rpc clients.
 	hostname, err := os.Hostname()
@@ -289,6 +324,7 @@ func main() {
 	} else {
 		var opts []core.RunOption
 		opts = append(opts, core.UseTLS(tlsConfig))
+		opts = append(opts, core.Environment(*environment))
 		opts = append(opts, enableMockHSM(db)...)
 		chainlog.Printf(ctx, "Launching as unconfigured Core.")
 		h = core.RunUnconfigured(ctx, confOpts, db, sdb, *listenAddr, opts...)
@@ -303,9 +339,30 @@ func main() {
 	coreHandler.Set(h)
 	chainlog.Printf(ctx, "Chain Core online and listening at %s", *listenAddr)
 
-	// block forever without using any resources so this process won't quit while
-	// the goroutine containing ListenAndServe is still working
-	select {}
+	// Serve until asked to stop, then shut down gracefully
+	// so that rolling deploys don't abort requests mid-commit.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	chainlog.Printf(ctx, "Received %s, shutting down", <-sig)
+	shutdown(ctx, server, db)
+}
+
+// shutdown stops server from accepting new connections and
+// waits up to drainTimeout for in-flight requests, and the
+// database transactions they hold open, to finish. Then it
+// closes db.
+func shutdown(ctx context.Context, server *http.Server, db *sql.DB) {
+	drainCtx, cancel := context.WithTimeout(ctx, *drainTimeout)
+	defer cancel()
+	err := server.Shutdown(drainCtx)
+	if err != nil {
+		chainlog.Error(ctx, errors.Wrap(err, "draining requests"))
+	}
+	err = db.Close()
+	if err != nil {
+		chainlog.Error(ctx, errors.Wrap(err, "closing database"))
+	}
+	chainlog.Printf(ctx, "Chain Core stopped")
 }
 
 // maybeUseTLS loads the TLS cert and key (if so configured)
@@ -319,10 +376,19 @@ func maybeUseTLS(ln net.Listener) (net.Listener, *tls.Config, error) {
 		*rootCAs,
 	)
 	if err == core.ErrNoTLS && config.BuildConfig.HTTPOk {
+		if *clientCAs != "" {
+			return nil, nil, errors.New("CLIENT_CA_CERTS requires TLS")
+		}
 		return ln, nil, nil // files & env vars don't exist; don't want TLS
 	} else if err != nil {
 		return nil, nil, err
 	}
+	if *clientCAs != "" {
+		err = core.AddClientCAs(c, *clientCAs)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	ln = tls.NewListener(ln, c)
 	return ln, c, nil
 }
@@ -342,6 +408,17 @@ func launchConfiguredCore(ctx context.Context, confOpts *config.Options, sdb *si
 	var localSigner *blocksigner.BlockSigner
 
 	opts = append(opts, core.IndexTransactions(*indexTxs))
+	opts = append(opts, core.Environment(*environment))
+	if *screeningURL != "" {
+		opts = append(opts, core.Screener(&screening.HTTP{
+			URL:    *screeningURL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}))
+	}
+	if *readDBURL != "" {
+		replica := openPool(ctx, *readDBURL, "db.replica")
+		opts = append(opts, core.ReadReplica(boundedDB(ctx, replica, *readDBURL, "db.replica")))
+	}
 	opts = append(opts, enableMockHSM(db)...)
 	// Add any configured API request rate limits.
 	if *rpsToken > 0 {
@@ -374,6 +451,7 @@ func launchConfiguredCore(ctx context.Context, confOpts *config.Options, sdb *si
 		c.MaxIssuanceWindow = bc.MillisDuration(conf.MaxIssuanceWindowMs)
 
 		gen := generator.New(c, signers, db)
+		gen.SetInstant(*instantBlocks)
 		opts = append(opts, core.GeneratorLocal(gen))
 	} else {
 		opts = append(opts, core.GeneratorRemote(&rpc.Client{
@@ -389,13 +467,62 @@ func launchConfiguredCore(ctx context.Context, confOpts *config.Options, sdb *si
 
 	// Start up the Core. This will start up the various Core subsystems,
 	// and begin leader election.
-	api, err := core.Run(ctx, confOpts, conf, db, *dbURL, sdb, c, store, *listenAddr, opts...)
+	// Hot queries run as prepared statements; see pg.NewNamedContext.
+	api, err := core.Run(ctx, confOpts, conf, boundedDB(ctx, db, *dbURL, "db"), *dbURL, sdb, c, store, *listenAddr, opts...)
 	if err != nil {
 		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
 	}
 	return api
 }
 
+// openPool opens a database connection pool for url, with
+// the configured pool settings, and publishes its stats as
+// name.stats.
+func openPool(ctx context.Context, url, name string) *sql.DB {
+	db, err := sql.Open("coredpg", url)
+	if err != nil {
+		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
+	}
+	setMaxConns(db, *maxDBConns)
+	db.SetConnMaxLifetime(*dbConnLife)
+	expvar.Publish(name+".stats", expvar.Func(func() interface{} {
+		return db.Stats()
+	}))
+	return db
+}
+
+func setMaxConns(db *sql.DB, n int) {
+	db.SetMaxOpenConns(n)
+	db.SetMaxIdleConns(n)
+}
+
+// boundedDB returns db, at url, for use by the Core. If
+// DB_STATEMENT_TIMEOUT is set, API requests instead run their
+// queries on a second pool, name.api, whose statements time
+// out; migrations and block processing still run on db with
+// no timeout. The two pools split MAXDBCONNS between them, so
+// the Core still opens no more than that many connections to
+// the database.
+func boundedDB(ctx context.Context, db *sql.DB, url, name string) pg.DB {
+	if *dbStmtTimeout <= 0 {
+		return pg.NewPreparedDB(db)
+	}
+	if *maxDBConns < 2 {
+		chainlog.Fatalkv(ctx, chainlog.KeyError, "DB_STATEMENT_TIMEOUT requires MAXDBCONNS of at least 2")
+	}
+	url, err := pg.WithStatementTimeout(url, *dbStmtTimeout)
+	if err != nil {
+		chainlog.Fatalkv(ctx, chainlog.KeyError, err)
+	}
+	api := openPool(ctx, url, name+".api")
+	setMaxConns(api, *maxDBConns/2)
+	setMaxConns(db, *maxDBConns-*maxDBConns/2)
+	return &pg.BoundedDB{
+		Unbounded: pg.NewPreparedDB(db),
+		Bounded:   pg.NewPreparedDB(api),
+	}
+}
+
 func initializeLocalSigner(ctx context.Context, confOpts *config.Options, conf *config.Config, db pg.DB, c *protocol.Chain, processID string, httpClient *http.Client) *blocksigner.BlockSigner {
 	var hsm blocksigner.Signer
 	hsm = mockHSM(db)
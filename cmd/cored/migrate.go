@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"chain/core/migrate"
+	"chain/database/pg"
+)
+
+const migrateUsage = `usage: cored migrate [status|up]
+
+Status lists each built-in migration and when it was applied
+to the database at DATABASE_URL. Up applies the pending ones.
+Neither starts the server.
+`
+
+// runMigrate implements the migrate subcommand, for deploys
+// that apply schema changes as a separate step.
+func runMigrate(args []string) {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	sql.Register("migratepg", pg.NewDriver())
+	db, err := sql.Open("migratepg", *dbURL)
+	if err != nil {
+		fatalMigrate(err)
+	}
+
+	switch args[0] {
+	case "status":
+		err = migrate.PrintStatus(db)
+	case "up":
+		err = migrate.Run(db)
+	}
+	// Close explicitly: fatalMigrate exits without running
+	// deferred calls.
+	db.Close()
+	if err != nil {
+		fatalMigrate(err)
+	}
+}
+
+func fatalMigrate(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
@@ -22,6 +22,15 @@ const (
 	defaultLimit = 100
 )
 
+// Environments. A Chain Core runs in exactly one of them, and
+// accepts only the access tokens issued in that environment,
+// so test credentials can't be used against live data, or
+// live credentials against test data.
+const (
+	EnvLive = "live"
+	EnvTest = "test"
+)
+
 var (
 	// ErrBadID is returned when Create is called on an invalid id string.
 	ErrBadID = errors.New("invalid id")
@@ -29,6 +38,9 @@ var (
 	ErrDuplicateID = errors.New("duplicate access token ID")
 	// ErrBadType is returned when Create is called with a bad type.
 	ErrBadType = errors.New("type must be client or network")
+	// ErrBadEnvironment is returned for an environment other
+	// than EnvLive or EnvTest.
+	ErrBadEnvironment = errors.New("environment must be live or test")
 
 	// validIDRegexp checks that all characters are alphumeric, _ or -.
 	// It also must have a length of at least 1.
@@ -36,19 +48,51 @@ var (
 )
 
 type Token struct {
-	ID      string    `json:"id"`
-	Token   string    `json:"token,omitempty"`
-	Type    string    `json:"type,omitempty"` // deprecated in 1.2
+	ID          string `json:"id"`
+	Token       string `json:"token,omitempty"`
+	Type        string `json:"type,omitempty"` // deprecated in 1.2
+	Environment string `json:"environment"`
+
+	// ServiceAccountID is the service account the token is a
+	// credential of. It is empty for tokens held by people.
+	ServiceAccountID string `json:"service_account_id,omitempty"`
+
 	Created time.Time `json:"created_at"`
 	sortID  string
 }
 
 type CredentialStore struct {
 	DB pg.DB
+
+	// Environment is the environment tokens are issued in
+	// and checked against. If empty, it is EnvLive.
+	Environment string
+}
+
+// ValidEnvironment returns an error if env is
+// neither EnvLive nor EnvTest.
+func ValidEnvironment(env string) error {
+	if env != EnvLive && env != EnvTest {
+		return errors.WithDetailf(ErrBadEnvironment, "unknown environment %q", env)
+	}
+	return nil
+}
+
+// Env returns the environment the store issues
+// and checks tokens in.
+func (cs *CredentialStore) Env() string {
+	if cs.Environment == "" {
+		return EnvLive
+	}
+	return cs.Environment
 }
 
 // Create generates a new access token with the given ID.
 func (cs *CredentialStore) Create(ctx context.Context, id, typ string) (*Token, error) {
+	return cs.create(ctx, id, typ, "")
+}
+
+func (cs *CredentialStore) create(ctx context.Context, id, typ, serviceAccountID string) (*Token, error) {
 	if !validIDRegexp.MatchString(id) {
 		return nil, errors.WithDetailf(ErrBadID, "invalid id %q", id)
 	}
@@ -62,16 +106,17 @@ func (cs *CredentialStore) Create(ctx context.Context, id, typ string) (*Token,
 	sha3pool.Sum256(hashedSecret[:], secret[:])
 
 	const q = `
-		INSERT INTO access_tokens (id, type, hashed_secret)
-		VALUES($1, $2, $3)
+		INSERT INTO access_tokens (id, type, hashed_secret, environment, service_account_id)
+		VALUES($1, $2, $3, $4, $5)
 		RETURNING created, sort_id
 	`
 	var (
 		created   time.Time
 		sortID    string
 		maybeType = sql.NullString{String: typ, Valid: typ != ""}
+		maybeSvc  = sql.NullString{String: serviceAccountID, Valid: serviceAccountID != ""}
 	)
-	err = cs.DB.QueryRowContext(ctx, q, id, maybeType, hashedSecret[:]).Scan(&created, &sortID)
+	err = cs.DB.QueryRowContext(ctx, q, id, maybeType, hashedSecret[:], cs.Env(), maybeSvc).Scan(&created, &sortID)
 	if pg.IsUniqueViolation(err) {
 		return nil, errors.WithDetailf(ErrDuplicateID, "id %q already in use", id)
 	}
@@ -80,16 +125,27 @@ func (cs *CredentialStore) Create(ctx context.Context, id, typ string) (*Token,
 	}
 
 	return &Token{
-		ID:      id,
-		Token:   fmt.Sprintf("%s:%x", id, secret),
-		Type:    typ,
-		Created: created,
-		sortID:  sortID,
+		ID:               id,
+		Token:            fmt.Sprintf("%s:%x", id, secret),
+		Type:             typ,
+		Environment:      cs.Env(),
+		ServiceAccountID: serviceAccountID,
+		Created:          created,
+		sortID:           sortID,
 	}, nil
 }
 
-// Check returns whether or not an id-secret pair is a valid access token.
+// Check returns whether or not an id-secret pair is a valid access token
+// issued in the store's environment.
 func (cs *CredentialStore) Check(ctx context.Context, id string, secret []byte) (bool, error) {
+	valid, _, err := cs.Identify(ctx, id, secret)
+	return valid, err
+}
+
+// Identify is like Check, and also returns the service
+// account a valid token is a credential of, or "" if it is
+// held by a person.
+func (cs *CredentialStore) Identify(ctx context.Context, id string, secret []byte) (valid bool, serviceAccountID string, err error) {
 	var (
 		toHash [tokenSize]byte
 		hashed [32]byte
@@ -97,14 +153,17 @@ func (cs *CredentialStore) Check(ctx context.Context, id string, secret []byte)
 	copy(toHash[:], secret)
 	sha3pool.Sum256(hashed[:], toHash[:])
 
-	const q = `SELECT EXISTS(SELECT 1 FROM access_tokens WHERE id=$1 AND hashed_secret=$2)`
-	var valid bool
-	err := cs.DB.QueryRowContext(ctx, q, id, hashed[:]).Scan(&valid)
+	const q = `SELECT service_account_id FROM access_tokens WHERE id=$1 AND hashed_secret=$2 AND environment=$3`
+	var svc sql.NullString
+	err = cs.DB.QueryRowContext(ctx, q, id, hashed[:], cs.Env()).Scan(&svc)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
-	return valid, nil
+	return true, svc.String, nil
 }
 
 // Exists returns whether an id is part of a valid access token. It does not validate a secret.
@@ -118,24 +177,27 @@ func (cs *CredentialStore) Exists(ctx context.Context, id string) bool {
 	return valid
 }
 
-// List lists all access tokens.
+// List lists all access tokens, including those issued in
+// other environments.
 func (cs *CredentialStore) List(ctx context.Context, typ, after string, limit int) ([]*Token, string, error) {
 	if limit == 0 {
 		limit = defaultLimit
 	}
 	const q = `
-		SELECT id, type, sort_id, created FROM access_tokens
+		SELECT id, type, environment, service_account_id, sort_id, created FROM access_tokens
 		WHERE ($1='' OR type=$1::access_token_type) AND ($2='' OR sort_id<$2)
 		ORDER BY sort_id DESC
 		LIMIT $3
 	`
 	var tokens []*Token
-	err := pg.ForQueryRows(ctx, cs.DB, q, typ, after, limit, func(id string, maybeType sql.NullString, sortID string, created time.Time) {
+	err := pg.ForQueryRows(ctx, cs.DB, q, typ, after, limit, func(id string, maybeType sql.NullString, env string, maybeSvc sql.NullString, sortID string, created time.Time) {
 		t := Token{
-			ID:      id,
-			Created: created,
-			Type:    maybeType.String,
-			sortID:  sortID,
+			ID:               id,
+			Created:          created,
+			Type:             maybeType.String,
+			Environment:      env,
+			ServiceAccountID: maybeSvc.String,
+			sortID:           sortID,
 		}
 		tokens = append(tokens, &t)
 	})
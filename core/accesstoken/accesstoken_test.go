@@ -129,6 +129,15 @@ func TestCheck(t *testing.T) {
 	if valid {
 		t.Fatal("expected bad secret to not be valid")
 	}
+
+	testCS := &CredentialStore{DB: cs.DB, Environment: EnvTest}
+	valid, err = testCS.Check(ctx, tokenID, tokenSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid {
+		t.Fatal("expected live token to not be valid in the test environment")
+	}
 }
 
 func TestDelete(t *testing.T) {
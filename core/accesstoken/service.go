@@ -0,0 +1,165 @@
+package accesstoken
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+)
+
+var (
+	// ErrBadAlias is returned when creating a service account
+	// with an invalid alias.
+	ErrBadAlias = errors.New("invalid service account alias")
+	// ErrDuplicateAlias is returned when creating a service
+	// account with an alias that is already in use.
+	ErrDuplicateAlias = errors.New("duplicate service account alias")
+)
+
+// ServiceAccount is an identity for software, such as a CI
+// system or a backend service, rather than a person. Its
+// credentials are access tokens, and its role bindings are
+// the policies granted to each of them. Its tokens are
+// refused for requests from web browsers, so they can't be
+// used to sign in to the dashboard.
+type ServiceAccount struct {
+	ID          string    `json:"id"`
+	Alias       string    `json:"alias"`
+	Description string    `json:"description"`
+	Policies    []string  `json:"policies"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateServiceAccount creates a service account bound to
+// the given policies. The caller must check that the
+// policies may be bound to a service account.
+func (cs *CredentialStore) CreateServiceAccount(ctx context.Context, alias, description string, policies []string) (*ServiceAccount, error) {
+	if !validIDRegexp.MatchString(alias) {
+		return nil, errors.WithDetailf(ErrBadAlias, "invalid alias %q", alias)
+	}
+	if policies == nil {
+		policies = []string{}
+	}
+	const q = `
+		INSERT INTO service_accounts (alias, description, policies)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	sa := &ServiceAccount{Alias: alias, Description: description, Policies: policies}
+	err := cs.DB.QueryRowContext(ctx, q, alias, description, pq.StringArray(policies)).Scan(&sa.ID, &sa.CreatedAt)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetailf(ErrDuplicateAlias, "alias %q already in use", alias)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting service account")
+	}
+	return sa, nil
+}
+
+// FindServiceAccount returns the service account with the
+// given ID.
+func (cs *CredentialStore) FindServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	const q = `SELECT id, alias, description, policies, created_at FROM service_accounts WHERE id = $1`
+	var (
+		sa       ServiceAccount
+		policies pq.StringArray
+	)
+	err := cs.DB.QueryRowContext(ctx, q, id).Scan(&sa.ID, &sa.Alias, &sa.Description, &policies, &sa.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "service account %s", id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "loading service account")
+	}
+	sa.Policies = policies
+	return &sa, nil
+}
+
+// ListServiceAccounts lists all service accounts, oldest first.
+func (cs *CredentialStore) ListServiceAccounts(ctx context.Context) ([]*ServiceAccount, error) {
+	const q = `SELECT id, alias, description, policies, created_at FROM service_accounts ORDER BY id`
+	var list []*ServiceAccount
+	err := pg.ForQueryRows(ctx, cs.DB, q, func(id, alias, description string, policies pq.StringArray, createdAt time.Time) {
+		list = append(list, &ServiceAccount{
+			ID:          id,
+			Alias:       alias,
+			Description: description,
+			Policies:    policies,
+			CreatedAt:   createdAt,
+		})
+	})
+	return list, errors.Wrap(err, "listing service accounts")
+}
+
+// SetServiceAccountPolicies replaces the policies bound to
+// the service account with the given ID. The caller must
+// update the grants of its tokens to match.
+func (cs *CredentialStore) SetServiceAccountPolicies(ctx context.Context, id string, policies []string) (*ServiceAccount, error) {
+	if policies == nil {
+		policies = []string{}
+	}
+	const q = `UPDATE service_accounts SET policies = $2 WHERE id = $1`
+	res, err := cs.DB.ExecContext(ctx, q, id, pq.StringArray(policies))
+	if err != nil {
+		return nil, errors.Wrap(err, "updating service account")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "service account %s", id)
+	}
+	return cs.FindServiceAccount(ctx, id)
+}
+
+// CreateServiceToken generates a new access token with the
+// given ID as a credential of the service account with
+// the given ID.
+func (cs *CredentialStore) CreateServiceToken(ctx context.Context, id, serviceAccountID string) (*Token, error) {
+	_, err := cs.FindServiceAccount(ctx, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	return cs.create(ctx, id, "", serviceAccountID)
+}
+
+// ServiceTokenIDs returns the IDs of the access tokens of
+// the service account with the given ID.
+func (cs *CredentialStore) ServiceTokenIDs(ctx context.Context, serviceAccountID string) ([]string, error) {
+	const q = `SELECT id FROM access_tokens WHERE service_account_id = $1 ORDER BY id`
+	var ids []string
+	err := pg.ForQueryRows(ctx, cs.DB, q, serviceAccountID, func(id string) {
+		ids = append(ids, id)
+	})
+	return ids, errors.Wrap(err, "listing service account tokens")
+}
+
+// DeleteServiceAccount deletes the service account with the
+// given ID and its access tokens, returning the IDs of the
+// deleted tokens so their grants can be revoked.
+func (cs *CredentialStore) DeleteServiceAccount(ctx context.Context, id string) ([]string, error) {
+	const q = `
+		WITH sa AS (DELETE FROM service_accounts WHERE id = $1 RETURNING id)
+		SELECT EXISTS(SELECT 1 FROM sa)
+	`
+	var deleted bool
+	err := cs.DB.QueryRowContext(ctx, q, id).Scan(&deleted)
+	if err != nil {
+		return nil, errors.Wrap(err, "deleting service account")
+	}
+	if !deleted {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "service account %s", id)
+	}
+
+	const tokensQ = `DELETE FROM access_tokens WHERE service_account_id = $1 RETURNING id`
+	var tokenIDs []string
+	err = pg.ForQueryRows(ctx, cs.DB, tokensQ, id, func(tokenID string) {
+		tokenIDs = append(tokenIDs, tokenID)
+	})
+	return tokenIDs, errors.Wrap(err, "deleting service account tokens")
+}
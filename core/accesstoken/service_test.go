@@ -0,0 +1,67 @@
+package accesstoken
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func TestServiceAccount(t *testing.T) {
+	ctx := context.Background()
+	cs := &CredentialStore{DB: pgtest.NewTx(t)}
+
+	sa, err := cs.CreateServiceAccount(ctx, "ci", "Builds and deploys", []string{"client-readonly"})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	tok, err := cs.CreateServiceToken(ctx, "ci-1", sa.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = cs.Create(ctx, "alice", "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	secret, err := hex.DecodeString(strings.Split(tok.Token, ":")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, svc, err := cs.Identify(ctx, "ci-1", secret)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !valid || svc != sa.ID {
+		t.Errorf("Identify(ci-1) = %v, %q, want true, %q", valid, svc, sa.ID)
+	}
+
+	sa, err = cs.SetServiceAccountPolicies(ctx, sa.ID, []string{"client-readwrite", "monitoring"})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := []string{"client-readwrite", "monitoring"}; !reflect.DeepEqual(sa.Policies, want) {
+		t.Errorf("policies = %v, want %v", sa.Policies, want)
+	}
+
+	ids, err := cs.DeleteServiceAccount(ctx, sa.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(ids, []string{"ci-1"}) {
+		t.Errorf("DeleteServiceAccount() = %v, want [ci-1]", ids)
+	}
+	if !cs.Exists(ctx, "alice") || cs.Exists(ctx, "ci-1") {
+		t.Error("DeleteServiceAccount() should delete only the service account's tokens")
+	}
+	_, err = cs.DeleteServiceAccount(ctx, sa.ID)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("deleting twice: error = %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+}
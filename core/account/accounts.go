@@ -11,6 +11,7 @@ import (
 	"github.com/golang/groupcache/lru"
 	"github.com/lib/pq"
 
+	"chain/core/event"
 	"chain/core/pin"
 	"chain/core/signers"
 	"chain/core/txbuilder"
@@ -128,6 +129,11 @@ func (m *Manager) Create(ctx context.Context, xpubs []chainkd.XPub, quorum int,
 		return nil, errors.Wrap(err, "indexing annotated account")
 	}
 
+	err = m.recordEvent(ctx, event.AccountCreated, account)
+	if err != nil {
+		return nil, err
+	}
+
 	return account, nil
 }
 
@@ -184,11 +190,30 @@ func (m *Manager) UpdateTags(ctx context.Context, id, alias *string, tags map[st
 		return errors.Wrap(err, "update entry in accounts table")
 	}
 
-	return errors.Wrap(m.indexAnnotatedAccount(ctx, &Account{
+	account := &Account{
 		Signer: signer,
 		Alias:  aliasStr,
 		Tags:   tags,
-	}), "update account index")
+	}
+	err = m.indexAnnotatedAccount(ctx, account)
+	if err != nil {
+		return errors.Wrap(err, "update account index")
+	}
+	return m.recordEvent(ctx, event.AccountTagsUpdated, account)
+}
+
+// recordEvent records an event of the given type about a,
+// with a's annotated state as its data. Creation events are
+// recorded only once, since Create is idempotent.
+func (m *Manager) recordEvent(ctx context.Context, typ string, a *Account) error {
+	aa, err := Annotated(a)
+	if err != nil {
+		return errors.Wrap(err, "annotating account")
+	}
+	if typ == event.AccountCreated {
+		return event.RecordOnce(ctx, m.db, typ, a.ID, aa)
+	}
+	return event.Record(ctx, m.db, typ, a.ID, aa)
 }
 
 // FindByAlias retrieves an account's Signer record by its alias
@@ -240,6 +265,7 @@ type controlProgram struct {
 	controlProgram []byte
 	change         bool
 	expiresAt      time.Time
+	unlockHeight   uint64
 }
 
 func (m *Manager) createControlProgram(ctx context.Context, accountID string, change bool, expiresAt time.Time) (*controlProgram, error) {
@@ -285,16 +311,17 @@ func (m *Manager) CreateControlProgram(ctx context.Context, accountID string, ch
 
 func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*controlProgram) error {
 	const q = `
-		INSERT INTO account_control_programs (signer_id, key_index, control_program, change, expires_at)
+		INSERT INTO account_control_programs (signer_id, key_index, control_program, change, expires_at, unlock_height)
 		SELECT unnest($1::text[]), unnest($2::bigint[]), unnest($3::bytea[]), unnest($4::boolean[]),
-			unnest($5::timestamp with time zone[])
+			unnest($5::timestamp with time zone[]), NULLIF(unnest($6::bigint[]), 0)
 	`
 	var (
-		accountIDs   pq.StringArray
-		keyIndexes   pq.Int64Array
-		controlProgs pq.ByteaArray
-		change       pq.BoolArray
-		expirations  []stdsql.NullString
+		accountIDs    pq.StringArray
+		keyIndexes    pq.Int64Array
+		controlProgs  pq.ByteaArray
+		change        pq.BoolArray
+		expirations   []stdsql.NullString
+		unlockHeights pq.Int64Array
 	)
 	for _, p := range progs {
 		accountIDs = append(accountIDs, p.accountID)
@@ -305,9 +332,10 @@ func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*con
 			String: p.expiresAt.Format(time.RFC3339),
 			Valid:  !p.expiresAt.IsZero(),
 		})
+		unlockHeights = append(unlockHeights, int64(p.unlockHeight))
 	}
 
-	_, err := m.db.ExecContext(ctx, q, accountIDs, keyIndexes, controlProgs, change, pq.Array(expirations))
+	_, err := m.db.ExecContext(ctx, q, accountIDs, keyIndexes, controlProgs, change, pq.Array(expirations), unlockHeights)
 	return errors.Wrap(err)
 }
 
@@ -45,13 +45,13 @@ func (m *Manager) AnnotateTxs(ctx context.Context, txs []*query.AnnotatedTx) err
 	// Look up all of the spent and created outputs. If any of them are
 	// account UTXOs add the account annotations to the inputs and outputs.
 	const q = `
-		SELECT o.output_id, o.account_id, a.alias, a.tags, o.change
+		SELECT o.output_id, o.account_id, a.alias, a.tags, o.change, COALESCE(o.unlock_height, 0)
 		FROM account_utxos o
 		LEFT JOIN accounts a ON o.account_id = a.account_id
 		WHERE o.output_id = ANY($1::bytea[])
 	`
 	err := pg.ForQueryRows(ctx, m.db, q, pq.ByteaArray(outputIDs),
-		func(outputID bc.Hash, accID string, alias sql.NullString, accountTags []byte, change bool) {
+		func(outputID bc.Hash, accID string, alias sql.NullString, accountTags []byte, change bool, unlockHeight uint64) {
 			spendingInput, ok := inputs[outputID]
 			if ok {
 				spendingInput.AccountID = accID
@@ -81,6 +81,7 @@ func (m *Manager) AnnotateTxs(ctx context.Context, txs []*query.AnnotatedTx) err
 				} else {
 					out.Purpose = "receive"
 				}
+				out.UnlockHeight = unlockHeight
 			}
 		})
 	return errors.Wrap(err, "annotating with account data")
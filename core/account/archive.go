@@ -0,0 +1,112 @@
+package account
+
+import (
+	"context"
+	stdsql "database/sql"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrNonzeroBalance is returned when archiving an account
+	// that still holds funds.
+	ErrNonzeroBalance = errors.New("account has a nonzero balance")
+
+	// ErrArchived is returned when a transaction or receiver
+	// would pay an archived account.
+	ErrArchived = errors.New("account is archived")
+)
+
+// Archive archives the account with the given ID. Archived
+// accounts are marked in the query indexes, and transactions
+// and receivers built by this core can't pay them.
+//
+// Archive fails with ErrNonzeroBalance if the account has any
+// unspent outputs, so views that leave out archived accounts
+// never hide funds. Archiving an archived account does
+// nothing.
+func (m *Manager) Archive(ctx context.Context, accountID string) error {
+	_, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	const q = `
+		UPDATE accounts SET archived_at = COALESCE(archived_at, now())
+		WHERE account_id = $1 AND NOT EXISTS (SELECT 1 FROM account_utxos WHERE account_id = $1)
+	`
+	res, err := m.db.ExecContext(ctx, q, accountID)
+	if err != nil {
+		return errors.Wrap(err, "archiving account")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(ErrNonzeroBalance, "account %s holds funds; sweep them to another account first", accountID)
+	}
+	return m.indexArchived(ctx, accountID, true)
+}
+
+// Unarchive restores the archived account with the given ID.
+// Unarchiving an account that isn't archived does nothing.
+func (m *Manager) Unarchive(ctx context.Context, accountID string) error {
+	_, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	const q = `UPDATE accounts SET archived_at = NULL WHERE account_id = $1`
+	_, err = m.db.ExecContext(ctx, q, accountID)
+	if err != nil {
+		return errors.Wrap(err, "unarchiving account")
+	}
+	return m.indexArchived(ctx, accountID, false)
+}
+
+// Balances returns the total amount of each asset in the
+// account's unspent outputs, including reserved ones.
+func (m *Manager) Balances(ctx context.Context, accountID string) ([]bc.AssetAmount, error) {
+	const q = `
+		SELECT asset_id, sum(amount) FROM account_utxos
+		WHERE account_id = $1
+		GROUP BY asset_id
+		ORDER BY asset_id
+	`
+	var balances []bc.AssetAmount
+	err := pg.ForQueryRows(ctx, m.db, q, accountID, func(assetID bc.AssetID, amount int64) {
+		balances = append(balances, bc.AssetAmount{AssetId: &assetID, Amount: uint64(amount)})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading account balances")
+	}
+	return balances, nil
+}
+
+// checkArchived returns ErrArchived if the account has
+// been archived.
+func (m *Manager) checkArchived(ctx context.Context, accountID string) error {
+	const q = `SELECT archived_at IS NOT NULL FROM accounts WHERE account_id = $1`
+	var archived bool
+	err := m.db.QueryRowContext(ctx, q, accountID).Scan(&archived)
+	if err == stdsql.ErrNoRows {
+		return nil // not an account; findByID reports that
+	}
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if archived {
+		return errors.WithDetailf(ErrArchived, "account %s is archived", accountID)
+	}
+	return nil
+}
+
+func (m *Manager) indexArchived(ctx context.Context, accountID string, archived bool) error {
+	if m.indexer == nil {
+		return nil
+	}
+	return m.indexer.SaveAccountArchived(ctx, accountID, archived)
+}
@@ -0,0 +1,55 @@
+package account
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestArchive(t *testing.T) {
+	db := pgtest.NewTx(t)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+	account := m.createTestAccount(ctx, t, "", nil)
+	outputID := m.createTestUTXO(ctx, t, account.ID)
+
+	err := m.Archive(ctx, account.ID)
+	if errors.Root(err) != ErrNonzeroBalance {
+		t.Fatalf("Archive with funds: error = %v, want %v", err, ErrNonzeroBalance)
+	}
+
+	balances, err := m.Balances(ctx, account.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(balances) != 1 || balances[0].Amount != 100 {
+		t.Fatalf("Balances = %v, want one balance of 100", balances)
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM account_utxos WHERE output_id = $1`, outputID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = m.Archive(ctx, account.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = m.CreateReceiver(ctx, account.ID, "", time.Now().Add(time.Hour))
+	if errors.Root(err) != ErrArchived {
+		t.Fatalf("CreateReceiver for archived account: error = %v, want %v", err, ErrArchived)
+	}
+
+	err = m.Unarchive(ctx, account.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = m.checkArchived(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("checkArchived after Unarchive: %v", err)
+	}
+}
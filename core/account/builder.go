@@ -3,7 +3,9 @@ package account
 import (
 	"context"
 	"encoding/json"
+	"time"
 
+	"chain/core/freeze"
 	"chain/core/signers"
 	"chain/core/txbuilder"
 	chainjson "chain/encoding/json"
@@ -11,6 +13,7 @@ import (
 	"chain/log"
 	"chain/protocol/bc"
 	"chain/protocol/bc/legacy"
+	"chain/protocol/vm/vmutil"
 )
 
 func (m *Manager) NewSpendAction(amt bc.AssetAmount, accountID string, refData chainjson.Map, clientToken *string) txbuilder.Action {
@@ -53,6 +56,10 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 	if err != nil {
 		return errors.Wrap(err, "get account info")
 	}
+	err = a.accounts.checkFrozen(ctx, a.AccountID, *a.AssetId)
+	if err != nil {
+		return err
+	}
 
 	src := source{
 		AssetID:   *a.AssetId,
@@ -75,6 +82,7 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 		if err != nil {
 			return errors.Wrap(err, "adding inputs")
 		}
+		restrictUnlock(b, r)
 	}
 
 	if res.Change > 0 {
@@ -126,6 +134,10 @@ func (a *spendUTXOAction) Build(ctx context.Context, b *txbuilder.TemplateBuilde
 	}
 	b.OnRollback(canceler(ctx, a.accounts, res.ID))
 
+	err = a.accounts.checkFrozen(ctx, res.Source.AccountID, res.Source.AssetID)
+	if err != nil {
+		return err
+	}
 	acct, err := a.accounts.findByID(ctx, res.Source.AccountID)
 	if err != nil {
 		return err
@@ -134,9 +146,38 @@ func (a *spendUTXOAction) Build(ctx context.Context, b *txbuilder.TemplateBuilde
 	if err != nil {
 		return err
 	}
+	restrictUnlock(b, res.UTXOs[0])
 	return b.AddInput(txInput, sigInst)
 }
 
+// FindUTXO returns the account that owns the unspent output
+// outputID and the asset amount it holds.
+func (m *Manager) FindUTXO(ctx context.Context, outputID bc.Hash) (accountID string, amt bc.AssetAmount, err error) {
+	u, err := findSpecificUTXO(ctx, m.db, outputID)
+	if err != nil {
+		return "", bc.AssetAmount{}, err
+	}
+	return u.AccountID, bc.AssetAmount{AssetId: &u.AssetID, Amount: u.Amount}, nil
+}
+
+// restrictUnlock keeps a transaction spending u from being
+// valid before the unlock time of u's control program, if any.
+func restrictUnlock(b *txbuilder.TemplateBuilder, u *utxo) {
+	if u.UnlockTimeMS > 0 {
+		b.RestrictMinTime(time.Unix(int64(u.UnlockTimeMS/1000), int64(u.UnlockTimeMS%1000)*int64(time.Millisecond)))
+	}
+}
+
+// checkFrozen returns freeze.ErrFrozen if either the account
+// or the asset has been frozen.
+func (m *Manager) checkFrozen(ctx context.Context, accountID string, assetID bc.AssetID) error {
+	err := freeze.CheckAccount(ctx, m.db, accountID)
+	if err != nil {
+		return err
+	}
+	return freeze.CheckAsset(ctx, m.db, assetID)
+}
+
 // Best-effort cancellation attempt to put in txbuilder.BuildResult.Rollback.
 func canceler(ctx context.Context, m *Manager, rid uint64) func() {
 	return func() {
@@ -182,6 +223,16 @@ type controlAction struct {
 	bc.AssetAmount
 	AccountID     string        `json:"account_id"`
 	ReferenceData chainjson.Map `json:"reference_data"`
+
+	// UnlockTime locks the output in its control program, so
+	// it can't be spent before then. UnlockHeight only keeps
+	// this core from spending it before the given block height:
+	// the VM has no instruction for the block height, so it
+	// can't be part of the control program, and a transaction
+	// built elsewhere and signed with the account's keys can
+	// spend the output at any height. It's advisory.
+	UnlockTime   *time.Time `json:"unlock_time"`
+	UnlockHeight uint64     `json:"unlock_height"`
 }
 
 func (a *controlAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
@@ -196,11 +247,27 @@ func (a *controlAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder)
 		return txbuilder.MissingFieldsError(missing...)
 	}
 
+	err := a.accounts.checkFrozen(ctx, a.AccountID, *a.AssetId)
+	if err != nil {
+		return err
+	}
+	err = a.accounts.checkArchived(ctx, a.AccountID)
+	if err != nil {
+		return err
+	}
+
 	// Produce a control program, but don't insert it into the database yet.
 	acp, err := a.accounts.createControlProgram(ctx, a.AccountID, false, b.MaxTime())
 	if err != nil {
 		return err
 	}
+	if a.UnlockTime != nil {
+		acp.controlProgram, err = vmutil.TimeLockProgram(bc.Millis(*a.UnlockTime), acp.controlProgram)
+		if err != nil {
+			return errors.WithDetail(err, "invalid unlock_time")
+		}
+	}
+	acp.unlockHeight = a.UnlockHeight
 	a.accounts.insertControlProgramDelayed(ctx, b, acp)
 
 	return b.AddOutput(legacy.NewTxOutput(*a.AssetId, a.Amount, acp.controlProgram, a.ReferenceData))
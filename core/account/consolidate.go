@@ -0,0 +1,90 @@
+package account
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// maxConsolidationInputs limits the number of outputs merged
+// by a single consolidation, keeping its transaction small.
+const maxConsolidationInputs = 100
+
+// Consolidation is a set of an account's unspent outputs of
+// one asset to be merged into a single output of Amount.
+type Consolidation struct {
+	AccountID string
+	AssetID   bc.AssetID
+	OutputIDs []bc.Hash
+	Amount    uint64
+}
+
+// Consolidations returns a Consolidation for each account
+// holding more than threshold unspent outputs of an asset,
+// merging up to maxConsolidationInputs of its smallest
+// outputs of that asset.
+//
+// Accounts with reserved outputs of an asset are skipped,
+// since they are in use; consolidating them would compete
+// with the transactions being built to spend them. Locked
+// outputs are left alone until they unlock.
+func (m *Manager) Consolidations(ctx context.Context, threshold int) ([]*Consolidation, error) {
+	const q = `
+		SELECT account_id, asset_id FROM account_utxos
+		WHERE ` + unlockedQ + `
+		GROUP BY account_id, asset_id
+		HAVING count(*) > $1
+	`
+	nowMS, height := bc.Millis(time.Now()), m.pinStore.Height(PinName)
+	var srcs []source
+	err := pg.ForQueryRows(ctx, m.db, q, threshold, nowMS, height, func(accountID string, assetID bc.AssetID) {
+		srcs = append(srcs, source{AccountID: accountID, AssetID: assetID})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "finding fragmented accounts")
+	}
+
+	var cs []*Consolidation
+	for _, src := range srcs {
+		if m.utxoDB.busy(src) {
+			continue
+		}
+		c, err := m.consolidation(ctx, src, nowMS, height)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.OutputIDs) > 1 {
+			cs = append(cs, c)
+		}
+	}
+	return cs, nil
+}
+
+// unlockedQ matches the account UTXOs that are unlocked at
+// the time and block height given as $2 and $3.
+const unlockedQ = `COALESCE(unlock_time_ms, 0) <= $2 AND COALESCE(unlock_height, 0) <= $3`
+
+func (m *Manager) consolidation(ctx context.Context, src source, nowMS, height uint64) (*Consolidation, error) {
+	const q = `
+		SELECT output_id, amount FROM account_utxos
+		WHERE ` + unlockedQ + ` AND account_id = $1 AND asset_id = $4
+		ORDER BY amount, output_id
+		LIMIT $5
+	`
+	c := &Consolidation{AccountID: src.AccountID, AssetID: src.AssetID}
+	err := pg.ForQueryRows(ctx, m.db, q, src.AccountID, nowMS, height, src.AssetID, maxConsolidationInputs, func(outputID bc.Hash, amount uint64) {
+		if c.Amount > math.MaxInt64-amount {
+			return // the merged output would be too large; leave the rest
+		}
+		c.OutputIDs = append(c.OutputIDs, outputID)
+		c.Amount += amount
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading outputs to consolidate")
+	}
+	return c, nil
+}
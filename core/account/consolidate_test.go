@@ -0,0 +1,60 @@
+package account
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestConsolidations(t *testing.T) {
+	db := pgtest.NewTx(t)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+	account := m.createTestAccount(ctx, t, "", nil)
+	cp := m.createTestControlProgram(ctx, t, account.ID)
+	assetID := bc.AssetID{V0: 1}
+
+	for _, amount := range []uint64{30, 10, 20} {
+		const q = `
+			INSERT INTO account_utxos (asset_id, amount, account_id,
+			control_program_index, control_program, confirmed_in,
+			output_id, source_id, source_pos, ref_data_hash, change)
+			VALUES($1, $2, $3, $4, $5, 10, $6, $7, 0, $8, false)
+		`
+		_, err := db.ExecContext(ctx, q, assetID, amount, account.ID,
+			cp.keyIndex, cp.controlProgram, randHash(), randHash(), randHash())
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	cs, err := m.Consolidations(ctx, 3)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(cs) != 0 {
+		t.Errorf("Consolidations(3) = %+v, want none", cs)
+	}
+
+	cs, err = m.Consolidations(ctx, 2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(cs) != 1 || cs[0].AccountID != account.ID || cs[0].AssetID != assetID || len(cs[0].OutputIDs) != 3 || cs[0].Amount != 60 {
+		t.Fatalf("Consolidations(2) = %+v, want 3 outputs of 60 units", cs)
+	}
+
+	// Outputs that are reserved are in use; leave them be.
+	m.utxoDB.source(source{AssetID: assetID, AccountID: account.ID}).reserved[cs[0].OutputIDs[0]] = 1
+	cs, err = m.Consolidations(ctx, 2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(cs) != 0 {
+		t.Errorf("Consolidations(2) with reserved outputs = %+v, want none", cs)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/bc/legacy"
+	"chain/protocol/vm/vmutil"
 )
 
 const (
@@ -35,6 +36,7 @@ var emptyJSONObject = json.RawMessage(`{}`)
 // SaveAnnotatedAccount can be a no-op.
 type Saver interface {
 	SaveAnnotatedAccount(context.Context, *query.AnnotatedAccount) error
+	SaveAccountArchived(ctx context.Context, accountID string, archived bool) error
 }
 
 func Annotated(a *Account) (*query.AnnotatedAccount, error) {
@@ -93,9 +95,10 @@ type rawOutput struct {
 
 type accountOutput struct {
 	rawOutput
-	AccountID string
-	keyIndex  uint64
-	change    bool
+	AccountID    string
+	keyIndex     uint64
+	change       bool
+	unlockHeight uint64
 }
 
 func (m *Manager) ProcessBlocks(ctx context.Context) {
@@ -163,7 +166,10 @@ func (m *Manager) indexAccountUTXOs(ctx context.Context, b *legacy.Block) error
 	}
 
 	err = m.upsertConfirmedAccountOutputs(ctx, accOuts, blockPositions, b)
-	return errors.Wrap(err, "upserting confirmed account utxos")
+	if err != nil {
+		return errors.Wrap(err, "upserting confirmed account utxos")
+	}
+	return m.recordReceiverPayments(ctx, accOuts, b)
 }
 
 func prevoutDBKeys(txs ...*legacy.Tx) (outputIDs pq.ByteaArray) {
@@ -195,17 +201,18 @@ func (m *Manager) loadAccountInfo(ctx context.Context, outs []*rawOutput) ([]*ac
 	result := make([]*accountOutput, 0, len(outs))
 
 	const q = `
-		SELECT signer_id, key_index, control_program, change
+		SELECT signer_id, key_index, control_program, change, COALESCE(unlock_height, 0)
 		FROM account_control_programs
 		WHERE control_program IN (SELECT unnest($1::bytea[]))
 	`
-	err := pg.ForQueryRows(ctx, m.db, q, scripts, func(accountID string, keyIndex uint64, program []byte, change bool) {
+	err := pg.ForQueryRows(ctx, m.db, q, scripts, func(accountID string, keyIndex uint64, program []byte, change bool, unlockHeight uint64) {
 		for _, out := range outsByScript[string(program)] {
 			newOut := &accountOutput{
-				rawOutput: *out,
-				AccountID: accountID,
-				keyIndex:  keyIndex,
-				change:    change,
+				rawOutput:    *out,
+				AccountID:    accountID,
+				keyIndex:     keyIndex,
+				change:       change,
+				unlockHeight: unlockHeight,
 			}
 			result = append(result, newOut)
 		}
@@ -232,6 +239,8 @@ func (m *Manager) upsertConfirmedAccountOutputs(ctx context.Context, outs []*acc
 		sourcePos pq.Int64Array
 		refData   pq.ByteaArray
 		change    pq.BoolArray
+		unlockMS  pq.Int64Array
+		unlockH   pq.Int64Array
 	)
 	for _, out := range outs {
 		outputID = append(outputID, out.OutputID.Bytes())
@@ -244,14 +253,19 @@ func (m *Manager) upsertConfirmedAccountOutputs(ctx context.Context, outs []*acc
 		sourcePos = append(sourcePos, int64(out.sourcePos))
 		refData = append(refData, out.refData.Bytes())
 		change = append(change, out.change)
+		ms, _, _ := vmutil.ParseTimeLockProgram(out.ControlProgram)
+		unlockMS = append(unlockMS, int64(ms))
+		unlockH = append(unlockH, int64(out.unlockHeight))
 	}
 
 	const q = `
 		INSERT INTO account_utxos (output_id, asset_id, amount, account_id, control_program_index,
-			control_program, confirmed_in, source_id, source_pos, ref_data_hash, change)
+			control_program, confirmed_in, source_id, source_pos, ref_data_hash, change,
+			unlock_time_ms, unlock_height)
 		SELECT unnest($1::bytea[]), unnest($2::bytea[]),  unnest($3::bigint[]),
 			   unnest($4::text[]), unnest($5::bigint[]), unnest($6::bytea[]), $7,
-			   unnest($8::bytea[]), unnest($9::bigint[]), unnest($10::bytea[]), unnest($11::boolean[])
+			   unnest($8::bytea[]), unnest($9::bigint[]), unnest($10::bytea[]), unnest($11::boolean[]),
+			   NULLIF(unnest($12::bigint[]), 0), NULLIF(unnest($13::bigint[]), 0)
 		ON CONFLICT (output_id) DO NOTHING
 	`
 	_, err := m.db.ExecContext(ctx, q,
@@ -266,6 +280,8 @@ func (m *Manager) upsertConfirmedAccountOutputs(ctx context.Context, outs []*acc
 		sourcePos,
 		refData,
 		change,
+		unlockMS,
+		unlockH,
 	)
 	return errors.Wrap(err)
 }
@@ -2,19 +2,61 @@ package account
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
+	"github.com/lib/pq"
+
 	"chain/core/txbuilder"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
 	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
 )
 
 const defaultReceiverExpiry = 30 * 24 * time.Hour // 30 days
 
+// ErrBadExpectation is returned when creating a receiver with
+// an expected amount but no expected asset.
+var ErrBadExpectation = errors.New("expected amount requires an expected asset")
+
+// ReceiverStatus describes a receiver created by
+// CreateReceiver and the payments made to it.
+type ReceiverStatus struct {
+	ID              string             `json:"id"`
+	AccountID       string             `json:"account_id"`
+	ControlProgram  chainjson.HexBytes `json:"control_program"`
+	ExpectedAssetID *bc.AssetID        `json:"expected_asset_id,omitempty"`
+	ExpectedAmount  uint64             `json:"expected_amount,omitempty"`
+	ExpiresAt       time.Time          `json:"expires_at"`
+	CreatedAt       time.Time          `json:"created_at"`
+
+	// Received is true once any output paying the receiver
+	// has been confirmed.
+	Received bool `json:"received"`
+
+	// ReceivedAmount is the total confirmed amount of the
+	// expected asset paid to the receiver. It is zero if the
+	// receiver doesn't expect an asset.
+	ReceivedAmount uint64 `json:"received_amount"`
+}
+
 // CreateReceiver creates a new account receiver for an account
 // with the provided expiry. If a zero time is provided for the
 // expiry, a default expiry of 30 days from the current time is
 // used.
 func (m *Manager) CreateReceiver(ctx context.Context, accID, accAlias string, expiresAt time.Time) (*txbuilder.Receiver, error) {
+	return m.CreateReceiverExpecting(ctx, accID, accAlias, expiresAt, nil)
+}
+
+// CreateReceiverExpecting is like CreateReceiver, but also
+// records the payment the receiver expects, if any, so
+// ListReceivers can report how much of it has arrived.
+func (m *Manager) CreateReceiverExpecting(ctx context.Context, accID, accAlias string, expiresAt time.Time, expected *bc.AssetAmount) (*txbuilder.Receiver, error) {
+	if expected != nil && expected.AssetId == nil {
+		return nil, errors.Wrap(ErrBadExpectation)
+	}
 	if expiresAt.IsZero() {
 		expiresAt = time.Now().Add(defaultReceiverExpiry)
 	}
@@ -26,13 +68,108 @@ func (m *Manager) CreateReceiver(ctx context.Context, accID, accAlias string, ex
 		}
 		accID = s.ID
 	}
+	err := m.checkArchived(ctx, accID)
+	if err != nil {
+		return nil, err
+	}
 
 	cp, err := m.CreateControlProgram(ctx, accID, false, expiresAt)
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
+
+	var (
+		assetID []byte
+		amount  sql.NullInt64
+	)
+	if expected != nil {
+		assetID = expected.AssetId.Bytes()
+		amount = sql.NullInt64{Int64: int64(expected.Amount), Valid: true}
+	}
+	const q = `
+		INSERT INTO account_receivers (control_program, account_id, expected_asset_id, expected_amount, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = m.db.ExecContext(ctx, q, cp, accID, assetID, amount, expiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "recording receiver")
+	}
 	return &txbuilder.Receiver{
 		ControlProgram: cp,
 		ExpiresAt:      expiresAt,
 	}, nil
 }
+
+// ListReceivers returns up to limit receivers of the given
+// account, newest first, along with what they have received.
+// Receivers with IDs greater than or equal to after are
+// skipped; pass the ID of the last receiver returned to get
+// the next page, or "" to get the first.
+func (m *Manager) ListReceivers(ctx context.Context, accountID, after string, limit int) ([]*ReceiverStatus, error) {
+	const q = `
+		SELECT r.id, r.control_program, r.expected_asset_id, r.expected_amount, r.expires_at, r.created_at,
+			count(p.output_id) > 0,
+			COALESCE(sum(p.amount) FILTER (WHERE p.asset_id = r.expected_asset_id), 0)
+		FROM account_receivers r
+		LEFT JOIN account_receiver_payments p ON p.control_program = r.control_program
+		WHERE r.account_id = $1 AND ($2 = '' OR r.id < $2)
+		GROUP BY r.control_program
+		ORDER BY r.id DESC
+		LIMIT $3
+	`
+	var receivers []*ReceiverStatus
+	err := pg.ForQueryRows(ctx, m.db, q, accountID, after, limit, func(
+		id string, prog []byte, expectedAssetID *bc.AssetID, expectedAmount sql.NullInt64,
+		expiresAt, createdAt time.Time, received bool, receivedAmount int64,
+	) {
+		receivers = append(receivers, &ReceiverStatus{
+			ID:              id,
+			AccountID:       accountID,
+			ControlProgram:  prog,
+			ExpectedAssetID: expectedAssetID,
+			ExpectedAmount:  uint64(expectedAmount.Int64),
+			ExpiresAt:       expiresAt,
+			CreatedAt:       createdAt,
+			Received:        received,
+			ReceivedAmount:  uint64(receivedAmount),
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return receivers, nil
+}
+
+// recordReceiverPayments records the outputs in outs that pay
+// receivers created by CreateReceiver.
+func (m *Manager) recordReceiverPayments(ctx context.Context, outs []*accountOutput, b *legacy.Block) error {
+	var (
+		outputID pq.ByteaArray
+		program  pq.ByteaArray
+		assetID  pq.ByteaArray
+		amount   pq.Int64Array
+	)
+	for _, out := range outs {
+		if out.change {
+			continue
+		}
+		outputID = append(outputID, out.OutputID.Bytes())
+		program = append(program, out.ControlProgram)
+		assetID = append(assetID, out.AssetId.Bytes())
+		amount = append(amount, int64(out.Amount))
+	}
+	if len(outputID) == 0 {
+		return nil
+	}
+
+	const q = `
+		INSERT INTO account_receiver_payments (output_id, control_program, asset_id, amount, block_height)
+		SELECT p.output_id, p.control_program, p.asset_id, p.amount, $5
+		FROM (SELECT unnest($1::bytea[]) AS output_id, unnest($2::bytea[]) AS control_program,
+			unnest($3::bytea[]) AS asset_id, unnest($4::bigint[]) AS amount) p
+		JOIN account_receivers r ON r.control_program = p.control_program
+		ON CONFLICT (output_id) DO NOTHING
+	`
+	_, err := m.db.ExecContext(ctx, q, outputID, program, assetID, amount, b.Height)
+	return errors.Wrap(err, "recording receiver payments")
+}
@@ -7,6 +7,8 @@ import (
 
 	"chain/crypto/ed25519/chainkd"
 	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
 	"chain/protocol/prottest"
 	"chain/testutil"
 )
@@ -33,3 +35,59 @@ func TestCreateReceiver(t *testing.T) {
 		testutil.FatalErr(t, err)
 	}
 }
+
+func TestListReceivers(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	assetID := bc.AssetID{V0: 1}
+	exp := time.Now().Add(time.Hour)
+	r1, err := m.CreateReceiverExpecting(ctx, account.ID, "", exp, &bc.AssetAmount{AssetId: &assetID, Amount: 10})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = m.CreateReceiver(ctx, account.ID, "", exp)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	out := &accountOutput{rawOutput: rawOutput{
+		OutputID:       bc.Hash{V0: 2},
+		AssetAmount:    bc.AssetAmount{AssetId: &assetID, Amount: 4},
+		ControlProgram: r1.ControlProgram,
+	}}
+	b := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 1}}
+	for i := 0; i < 2; i++ { // recording a block twice must not double count
+		err = m.recordReceiverPayments(ctx, []*accountOutput{out}, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	got, err := m.ListReceivers(ctx, account.ID, "", 100)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d receivers, want 2", len(got))
+	}
+	if got[0].Received || got[0].ExpectedAssetID != nil {
+		t.Errorf("newest receiver = %+v, want unpaid receiver without expectation", got[0])
+	}
+	if !got[1].Received || got[1].ReceivedAmount != 4 || got[1].ExpectedAmount != 10 || *got[1].ExpectedAssetID != assetID {
+		t.Errorf("oldest receiver = %+v, want 4 of 10 expected units received", got[1])
+	}
+
+	page, err := m.ListReceivers(ctx, account.ID, got[0].ID, 100)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(page) != 1 || page[0].ID != got[1].ID {
+		t.Errorf("ListReceivers(after %s) = %+v, want only %s", got[0].ID, page, got[1].ID)
+	}
+}
@@ -30,6 +30,10 @@ var (
 	// new change outputs will be created
 	// in sufficient amounts to satisfy the request.
 	ErrReserved = errors.New("reservation found outputs already reserved")
+
+	// ErrLocked indicates that an output can't be spent yet,
+	// because it's locked until a later time or block height.
+	ErrLocked = errors.New("output is locked")
 )
 
 // utxo describes an individual account utxo.
@@ -48,6 +52,21 @@ type utxo struct {
 
 	AccountID           string
 	ControlProgramIndex uint64
+
+	// UnlockTimeMS and UnlockHeight are set for an output that
+	// can't be spent before the given time or block height. Only
+	// the unlock time is enforced by the network; the unlock
+	// height is enforced by this core alone.
+	UnlockTimeMS uint64
+	UnlockHeight uint64
+}
+
+// locked reports whether u can't be spent yet, at nowMS with
+// the chain at the given height. A time-locked output is
+// enforced by its control program; a height-locked output
+// only by this core.
+func (u *utxo) locked(nowMS, height uint64) bool {
+	return u.UnlockTimeMS > nowMS || u.UnlockHeight > height
 }
 
 func (u *utxo) source() source {
@@ -169,6 +188,9 @@ func (re *reserver) reserveUTXO(ctx context.Context, out bc.Hash, exp time.Time,
 	if !re.checkUTXO(u) {
 		return nil, pg.ErrUserInputNotFound
 	}
+	if u.locked(bc.Millis(time.Now()), re.pinStore.Height(PinName)) {
+		return nil, errors.WithDetailf(ErrLocked, "output %s", out.String())
+	}
 
 	rid := atomic.AddUint64(&re.nextReservationID, 1)
 	err = re.source(u.source()).reserveUTXO(rid, u)
@@ -264,6 +286,21 @@ func (re *reserver) source(src source) *sourceReserver {
 	return sr
 }
 
+// busy reports whether any of the source's outputs
+// are reserved.
+func (re *reserver) busy(src source) bool {
+	re.sourcesMu.Lock()
+	sr, ok := re.sources[src]
+	re.sourcesMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return len(sr.reserved) > 0
+}
+
 type sourceReserver struct {
 	db       pg.DB
 	src      source
@@ -296,10 +333,16 @@ func (sr *sourceReserver) reserveFromCache(rid uint64, amount uint64) ([]*utxo,
 		reserved, unavailable uint64
 		reservedUTXOs         []*utxo
 	)
+	nowMS, height := bc.Millis(time.Now()), sr.heightFn()
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
 	for o, u := range sr.cached {
+		// Locked UTXOs don't count toward the account's funds
+		// until they unlock.
+		if u.locked(nowMS, height) {
+			continue
+		}
 		// If the UTXO is already reserved, skip it.
 		if _, ok := sr.reserved[u.OutputID]; ok {
 			unavailable += u.Amount
@@ -389,13 +432,14 @@ func (sr *sourceReserver) refillCache(ctx context.Context) error {
 func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64) ([]*utxo, error) {
 	const q = `
 		SELECT output_id, amount, control_program_index, control_program,
-			source_id, source_pos, ref_data_hash
+			source_id, source_pos, ref_data_hash,
+			COALESCE(unlock_time_ms, 0), COALESCE(unlock_height, 0)
 		FROM account_utxos
 		WHERE account_id = $1 AND asset_id = $2 AND confirmed_in > $3
 	`
 	var utxos []*utxo
 	err := pg.ForQueryRows(ctx, db, q, src.AccountID, src.AssetID, height,
-		func(oid bc.Hash, amount uint64, cpIndex uint64, controlProg []byte, sourceID bc.Hash, sourcePos uint64, refData bc.Hash) {
+		func(oid bc.Hash, amount uint64, cpIndex uint64, controlProg []byte, sourceID bc.Hash, sourcePos uint64, refData bc.Hash, unlockMS, unlockHeight uint64) {
 			utxos = append(utxos, &utxo{
 				OutputID:            oid,
 				SourceID:            sourceID,
@@ -406,6 +450,8 @@ func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64)
 				RefDataHash:         refData,
 				AccountID:           src.AccountID,
 				ControlProgramIndex: cpIndex,
+				UnlockTimeMS:        unlockMS,
+				UnlockHeight:        unlockHeight,
 			})
 		})
 	if err != nil {
@@ -417,7 +463,8 @@ func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64)
 func findSpecificUTXO(ctx context.Context, db pg.DB, out bc.Hash) (*utxo, error) {
 	const q = `
 		SELECT account_id, asset_id, amount, control_program_index, control_program,
-			source_id, source_pos, ref_data_hash
+			source_id, source_pos, ref_data_hash,
+			COALESCE(unlock_time_ms, 0), COALESCE(unlock_height, 0)
 		FROM account_utxos
 		WHERE output_id = $1
 	`
@@ -432,6 +479,8 @@ func findSpecificUTXO(ctx context.Context, db pg.DB, out bc.Hash) (*utxo, error)
 		&u.SourceID,
 		&u.SourcePos,
 		&u.RefDataHash,
+		&u.UnlockTimeMS,
+		&u.UnlockHeight,
 	)
 	if err == sql.ErrNoRows {
 		return nil, pg.ErrUserInputNotFound
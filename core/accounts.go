@@ -2,16 +2,24 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"chain/core/account"
+	"chain/core/leader"
+	"chain/core/txbuilder"
 	"chain/crypto/ed25519/chainkd"
+	"chain/errors"
 	"chain/net/http/httpjson"
 	"chain/net/http/reqid"
+	"chain/protocol/bc"
 )
 
-// POST /create-account
-func (a *API) createAccount(ctx context.Context, ins []struct {
+// maxAccountBatch is the most accounts /create-account-batch
+// creates in one call.
+const maxAccountBatch = 1000
+
+type createAccountRequest struct {
 	RootXPubs []chainkd.XPub `json:"root_xpubs"`
 	Quorum    int
 	Alias     string
@@ -22,7 +30,10 @@ func (a *API) createAccount(ctx context.Context, ins []struct {
 	// idempotency of create account requests. Duplicate create account requests
 	// with the same client_token will only create one account.
 	ClientToken string `json:"client_token"`
-}) interface{} {
+}
+
+// POST /create-account
+func (a *API) createAccount(ctx context.Context, ins []createAccountRequest) interface{} {
 	responses := make([]interface{}, len(ins))
 	var wg sync.WaitGroup
 	wg.Add(len(responses))
@@ -51,6 +62,55 @@ func (a *API) createAccount(ctx context.Context, ins []struct {
 	return responses
 }
 
+// POST /create-account-batch
+//
+// Creates up to maxAccountBatch accounts controlled by the same
+// keys, for importing customers in bulk. Each entry in accounts
+// may give an alias and tags; entries without an alias get one
+// generated from alias_prefix and their position in the batch,
+// such as customer-42. If accounts is omitted, count accounts
+// are created. If client_token is given, each account's client
+// token is derived from it, so retrying a batch doesn't create
+// its accounts twice.
+//
+// Like /create-account, the response holds an account or an
+// error for each entry, in order.
+func (a *API) createAccountBatch(ctx context.Context, in struct {
+	RootXPubs   []chainkd.XPub `json:"root_xpubs"`
+	Quorum      int
+	AliasPrefix string `json:"alias_prefix"`
+	Count       int
+	ClientToken string `json:"client_token"`
+	Accounts    []struct {
+		Alias string
+		Tags  map[string]interface{}
+	}
+}) (interface{}, error) {
+	n := len(in.Accounts)
+	if n == 0 {
+		n = in.Count
+	}
+	if n <= 0 || n > maxAccountBatch {
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "a batch must create between 1 and %d accounts", maxAccountBatch)
+	}
+
+	reqs := make([]createAccountRequest, n)
+	for i := range reqs {
+		reqs[i] = createAccountRequest{RootXPubs: in.RootXPubs, Quorum: in.Quorum}
+		if i < len(in.Accounts) {
+			reqs[i].Alias = in.Accounts[i].Alias
+			reqs[i].Tags = in.Accounts[i].Tags
+		}
+		if reqs[i].Alias == "" && in.AliasPrefix != "" {
+			reqs[i].Alias = fmt.Sprintf("%s-%d", in.AliasPrefix, i+1)
+		}
+		if in.ClientToken != "" {
+			reqs[i].ClientToken = fmt.Sprintf("%s-%d", in.ClientToken, i+1)
+		}
+	}
+	return a.createAccount(ctx, reqs), nil
+}
+
 // POST /update-account-tags
 func (a *API) updateAccountTags(ctx context.Context, ins []struct {
 	ID    *string
@@ -79,3 +139,124 @@ func (a *API) updateAccountTags(ctx context.Context, ins []struct {
 	wg.Wait()
 	return responses
 }
+
+type archiveAccountRequest struct {
+	AccountID           string `json:"account_id"`
+	AccountAlias        string `json:"account_alias"`
+	SweepToAccountID    string `json:"sweep_to_account_id"`
+	SweepToAccountAlias string `json:"sweep_to_account_alias"`
+}
+
+// archiveAccountResponse is the response to /archive-account
+// and /unarchive-account.
+type archiveAccountResponse struct {
+	AccountID          string   `json:"account_id"`
+	IsArchived         bool     `json:"is_archived"`
+	SweepTransactionID *bc.Hash `json:"sweep_transaction_id,omitempty"`
+}
+
+// POST /archive-account
+//
+// Archives an account. It fails if the account holds any
+// funds, unless sweep_to_account_id or sweep_to_account_alias
+// names an account to move them to first. The sweep is built,
+// signed with the mock HSM's keys and submitted like a
+// /transfer, and the account is archived once the sweep has
+// been processed.
+func (a *API) archiveAccount(ctx context.Context, req archiveAccountRequest) (*archiveAccountResponse, error) {
+	sweep := req.SweepToAccountID != "" || req.SweepToAccountAlias != ""
+	// Like /build-transaction, reserving the outputs to sweep
+	// must happen on the leader.
+	if sweep && a.leader.State() != leader.Leading {
+		resp := new(archiveAccountResponse)
+		err := a.forwardToLeader(ctx, "/archive-account", req, resp)
+		return resp, err
+	}
+
+	accountID, err := a.accountID(ctx, req.AccountID, req.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	resp := &archiveAccountResponse{AccountID: accountID, IsArchived: true}
+	if sweep {
+		resp.SweepTransactionID, err = a.sweepAccount(ctx, accountID, req.SweepToAccountID, req.SweepToAccountAlias)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = a.accounts.Archive(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// POST /unarchive-account
+func (a *API) unarchiveAccount(ctx context.Context, req struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+}) (*archiveAccountResponse, error) {
+	accountID, err := a.accountID(ctx, req.AccountID, req.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	err = a.accounts.Unarchive(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveAccountResponse{AccountID: accountID}, nil
+}
+
+// sweepAccount moves all of an account's funds to the account
+// with the given ID or alias, and waits until the transaction
+// has been processed. It returns the transaction's ID, or nil
+// if the account holds no funds.
+func (a *API) sweepAccount(ctx context.Context, accountID, destID, destAlias string) (*bc.Hash, error) {
+	if a.signTemplate == nil {
+		return nil, errors.WithDetail(errNoMockHSM, "sweeps are signed with keys held by the mock HSM")
+	}
+	destID, err := a.accountID(ctx, destID, destAlias)
+	if err != nil {
+		return nil, err
+	}
+	if destID == accountID {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "cannot sweep an account to itself")
+	}
+	balances, err := a.accounts.Balances(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if len(balances) == 0 {
+		return nil, nil
+	}
+
+	var actions []map[string]interface{}
+	for _, b := range balances {
+		actions = append(actions, map[string]interface{}{
+			"type":       "spend_account",
+			"account_id": accountID,
+			"asset_id":   b.AssetId.String(),
+			"amount":     b.Amount,
+		}, map[string]interface{}{
+			"type":       "control_account",
+			"account_id": destID,
+			"asset_id":   b.AssetId.String(),
+			"amount":     b.Amount,
+		})
+	}
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: actions})
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing sweep")
+	}
+	// Wait until the account indexer has removed the spent
+	// outputs, so the balance guard in Archive sees them gone.
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.Transaction.ID, nil
+}
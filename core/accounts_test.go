@@ -10,6 +10,7 @@ import (
 	"chain/core/coretest"
 	"chain/core/pin"
 	"chain/core/query"
+	"chain/crypto/ed25519/chainkd"
 	"chain/database/pg/pgtest"
 	"chain/protocol/prottest"
 	"chain/testutil"
@@ -127,3 +128,66 @@ func TestUpdateAccountTags(t *testing.T) {
 		t.Fatalf("id:\ngot:  %v\nwant: %v", items[0].ID, id)
 	}
 }
+
+func TestCreateAccountBatch(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	pinStore := pin.NewStore(db)
+	indexer := query.NewIndexer(db, c, pinStore)
+	accounts := account.NewManager(db, c, pinStore)
+	accounts.IndexAccounts(indexer)
+	api := &API{db: db, chain: c, accounts: accounts, indexer: indexer}
+
+	create := func() []interface{} {
+		resp, err := api.createAccountBatch(ctx, struct {
+			RootXPubs   []chainkd.XPub `json:"root_xpubs"`
+			Quorum      int
+			AliasPrefix string `json:"alias_prefix"`
+			Count       int
+			ClientToken string `json:"client_token"`
+			Accounts    []struct {
+				Alias string
+				Tags  map[string]interface{}
+			}
+		}{
+			RootXPubs:   []chainkd.XPub{testutil.TestXPub},
+			Quorum:      1,
+			AliasPrefix: "customer",
+			ClientToken: "import-1",
+			Accounts: []struct {
+				Alias string
+				Tags  map[string]interface{}
+			}{{}, {Alias: "vip"}, {Tags: map[string]interface{}{"n": 3}}},
+		})
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return resp.([]interface{})
+	}
+
+	var ids []string
+	for _, item := range create() {
+		acc, ok := item.(*query.AnnotatedAccount)
+		if !ok {
+			t.Fatalf("got %v, want an account", item)
+		}
+		ids = append(ids, acc.ID)
+	}
+	for i, want := range []string{"customer-1", "vip", "customer-3"} {
+		acc, err := accounts.FindByAlias(ctx, want)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if acc.ID != ids[i] {
+			t.Errorf("alias %s = account %s, want %s", want, acc.ID, ids[i])
+		}
+	}
+
+	// Retrying with the same client token returns the same accounts.
+	for i, item := range create() {
+		if acc, ok := item.(*query.AnnotatedAccount); !ok || acc.ID != ids[i] {
+			t.Errorf("retry item %d = %v, want account %s", i, item, ids[i])
+		}
+	}
+}
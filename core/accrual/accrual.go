@@ -0,0 +1,442 @@
+// Package accrual periodically credits interest to accounts,
+// or charges them maintenance fees, according to rules.
+//
+// A rule applies to one asset, and to every unarchived
+// account holding it, optionally only those whose tags
+// contain the rule's account tags. At the end of each of the
+// rule's periods, a day or a calendar month in UTC, it accrues
+// an amount to each account: a flat amount plus a rate times
+// the account's balance at the end of the period, rounded
+// down. Interest is issued to the account; a fee is spent
+// from it, to the rule's destination account or, without
+// one, retired. A fee never exceeds the balance.
+//
+// Every accrual is recorded before its transaction is built,
+// with the balance and amount it was computed from, and then
+// with the transaction that applied it or the error that
+// stopped it. The record is the audit trail, and also what
+// stops an accrual from being applied twice: one that was
+// being submitted when the core stopped is left for an
+// operator to check rather than retried.
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Rule types.
+const (
+	TypeInterest = "interest"
+	TypeFee      = "fee"
+)
+
+// Accrual periods.
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Accrual statuses.
+const (
+	StatusPlanned    = "planned"
+	StatusSubmitting = "submitting"
+	StatusApplied    = "applied"
+	StatusFailed     = "failed"
+)
+
+// ErrBadRule is returned for a rule with invalid fields.
+var ErrBadRule = errors.New("invalid accrual rule")
+
+// Rule describes an accrual rule. Rate is a non-negative
+// decimal, such as "0.0001" for a daily rate of one basis
+// point.
+type Rule struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	Type                 string                 `json:"type"`
+	AssetID              bc.AssetID             `json:"asset_id"`
+	Rate                 string                 `json:"rate"`
+	FlatAmount           uint64                 `json:"flat_amount"`
+	Period               string                 `json:"period"`
+	AccountTags          map[string]interface{} `json:"account_tags,omitempty"`
+	DestinationAccountID string                 `json:"destination_account_id,omitempty"`
+	NextAccrualAt        time.Time              `json:"next_accrual_at"`
+	DisabledAt           *time.Time             `json:"disabled_at,omitempty"`
+	CreatedAt            time.Time              `json:"created_at"`
+
+	rate *big.Rat
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.WithDetail(ErrBadRule, "a name is required")
+	}
+	switch r.Type {
+	case TypeInterest:
+		if r.DestinationAccountID != "" {
+			return errors.WithDetailf(ErrBadRule, "a destination account is only allowed with type %s", TypeFee)
+		}
+	case TypeFee:
+	default:
+		return errors.WithDetailf(ErrBadRule, "type must be %s or %s", TypeInterest, TypeFee)
+	}
+	if r.Rate == "" {
+		r.Rate = "0"
+	}
+	rate, ok := new(big.Rat).SetString(r.Rate)
+	if !ok || rate.Sign() < 0 {
+		return errors.WithDetailf(ErrBadRule, "rate must be a non-negative decimal, not %q", r.Rate)
+	}
+	if rate.Sign() == 0 && r.FlatAmount == 0 {
+		return errors.WithDetail(ErrBadRule, "a rule needs a rate or flat_amount")
+	}
+	if r.FlatAmount > math.MaxInt64 {
+		return errors.WithDetailf(ErrBadRule, "flat_amount must be at most %d", int64(math.MaxInt64))
+	}
+	switch r.Period {
+	case PeriodDay, PeriodMonth:
+	default:
+		return errors.WithDetailf(ErrBadRule, "period must be %s or %s", PeriodDay, PeriodMonth)
+	}
+	r.rate = rate
+	return nil
+}
+
+// Amount returns the amount the rule accrues on a balance,
+// and false if it's too large to be a transaction amount.
+func (r *Rule) Amount(balance uint64) (uint64, bool) {
+	if r.rate == nil {
+		r.rate, _ = new(big.Rat).SetString(r.Rate)
+	}
+	n := new(big.Int).SetUint64(balance)
+	n.Mul(n, r.rate.Num())
+	n.Quo(n, r.rate.Denom())
+	n.Add(n, new(big.Int).SetUint64(r.FlatAmount))
+	if r.Type == TypeFee && n.Cmp(new(big.Int).SetUint64(balance)) > 0 {
+		return balance, true
+	}
+	if n.Cmp(big.NewInt(math.MaxInt64)) > 0 {
+		return 0, false
+	}
+	return n.Uint64(), true
+}
+
+// periodEnd returns the end of the period containing t.
+func periodEnd(period string, t time.Time) time.Time {
+	t = t.UTC()
+	if period == PeriodMonth {
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Engine stores accrual rules and the accruals they make.
+type Engine struct {
+	db pg.DB
+}
+
+// NewEngine returns a new Engine using the given database.
+func NewEngine(db pg.DB) *Engine {
+	return &Engine{db: db}
+}
+
+// Create validates and saves a new rule. Its first accrual
+// is at the end of the current period.
+func (e *Engine) Create(ctx context.Context, r *Rule) (*Rule, error) {
+	err := r.validate()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := tagsJSON(r.AccountTags)
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		INSERT INTO accrual_rules (name, type, asset_id, rate, flat_amount, period,
+			account_tags, destination_account_id, next_accrual_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+		RETURNING id
+	`
+	var id string
+	err = e.db.QueryRowContext(ctx, q, r.Name, r.Type, r.AssetID, r.Rate, int64(r.FlatAmount), r.Period,
+		tags, r.DestinationAccountID, periodEnd(r.Period, time.Now())).Scan(&id)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting accrual rule")
+	}
+	return e.Find(ctx, id)
+}
+
+// Disable stops the rule with the given ID from making any
+// more accruals. Its accruals are kept.
+func (e *Engine) Disable(ctx context.Context, id string) (*Rule, error) {
+	const q = `UPDATE accrual_rules SET disabled_at = COALESCE(disabled_at, now()) WHERE id = $1`
+	res, err := e.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "disabling accrual rule")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "accrual rule %s not found", id)
+	}
+	return e.Find(ctx, id)
+}
+
+const selectQ = `
+	SELECT id, name, type, asset_id, rate, flat_amount, period, account_tags,
+		COALESCE(destination_account_id, ''), next_accrual_at, disabled_at, created_at
+	FROM accrual_rules
+`
+
+// Find returns the rule with the given ID.
+func (e *Engine) Find(ctx context.Context, id string) (*Rule, error) {
+	rules, err := e.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "accrual rule %s not found", id)
+	}
+	return rules[0], nil
+}
+
+// List returns all rules, oldest first.
+func (e *Engine) List(ctx context.Context) ([]*Rule, error) {
+	return e.query(ctx, selectQ+`ORDER BY created_at, id`)
+}
+
+// Due returns the enabled rules with a period that ended at
+// or before t, soonest first.
+func (e *Engine) Due(ctx context.Context, t time.Time) ([]*Rule, error) {
+	return e.query(ctx, selectQ+`WHERE disabled_at IS NULL AND next_accrual_at <= $1 ORDER BY next_accrual_at, id`, t)
+}
+
+func (e *Engine) query(ctx context.Context, query string, args ...interface{}) ([]*Rule, error) {
+	var rules []*Rule
+	err := pg.ForQueryRows(ctx, e.db, query, append(args, func(
+		id, name, typ string, assetID bc.AssetID, rate string, flat int64, period string, tags []byte,
+		destID string, next time.Time, disabledAt *time.Time, createdAt time.Time,
+	) error {
+		r := &Rule{
+			ID:                   id,
+			Name:                 name,
+			Type:                 typ,
+			AssetID:              assetID,
+			Rate:                 rate,
+			FlatAmount:           uint64(flat),
+			Period:               period,
+			DestinationAccountID: destID,
+			NextAccrualAt:        next.UTC(),
+			DisabledAt:           disabledAt,
+			CreatedAt:            createdAt,
+		}
+		if tags != nil {
+			err := json.Unmarshal(tags, &r.AccountTags)
+			if err != nil {
+				return errors.Wrap(err, "decoding account tags")
+			}
+		}
+		rules = append(rules, r)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying accrual rules")
+	}
+	return rules, nil
+}
+
+func tagsJSON(tags map[string]interface{}) ([]byte, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(tags)
+	return b, errors.Wrap(err, "encoding account tags")
+}
+
+// Accrual is one rule's accrual to one account for one
+// period. Balance is the account's balance of the rule's
+// asset at the end of the period, and Amount what the rule
+// accrued on it.
+type Accrual struct {
+	ID            string     `json:"id"`
+	RuleID        string     `json:"rule_id"`
+	Type          string     `json:"type"`
+	AccountID     string     `json:"account_id"`
+	AssetID       bc.AssetID `json:"asset_id"`
+	PeriodEnd     time.Time  `json:"period_end"`
+	Balance       uint64     `json:"balance"`
+	Amount        uint64     `json:"amount"`
+	Status        string     `json:"status"`
+	TransactionID *bc.Hash   `json:"transaction_id,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Plan records the accruals the rule makes for the period
+// ending at its NextAccrualAt, computed from the balances the
+// transaction index reports at that time, and returns the
+// ones that haven't been submitted yet. It can be called
+// again for the same period, to pick up where an interrupted
+// run left off.
+func (e *Engine) Plan(ctx context.Context, r *Rule) ([]*Accrual, error) {
+	tags, err := tagsJSON(r.AccountTags)
+	if err != nil {
+		return nil, err
+	}
+	const balancesQ = `
+		SELECT o.account_id, sum(o.amount)
+		FROM annotated_outputs o JOIN annotated_accounts a ON a.id = o.account_id
+		WHERE o.asset_id = $1 AND o.timespan @> $2::int8 AND NOT a.archived
+			AND ($3::jsonb IS NULL OR a.tags @> $3::jsonb)
+		GROUP BY o.account_id
+		HAVING sum(o.amount) > 0
+		ORDER BY o.account_id
+	`
+	type balance struct {
+		accountID string
+		amount    uint64
+	}
+	var balances []balance
+	err = pg.ForQueryRows(ctx, e.db, balancesQ, r.AssetID, bc.Millis(r.NextAccrualAt)-1, tags, func(accountID string, amount int64) {
+		balances = append(balances, balance{accountID, uint64(amount)})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying balances")
+	}
+
+	const insertQ = `
+		INSERT INTO accruals (rule_id, account_id, asset_id, period_end, balance, amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (rule_id, account_id, period_end) DO NOTHING
+	`
+	for _, b := range balances {
+		amount, ok := r.Amount(b.amount)
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadRule, "rule %s accrues too much on a balance of %d", r.ID, b.amount)
+		}
+		if amount == 0 {
+			continue
+		}
+		_, err = e.db.ExecContext(ctx, insertQ, r.ID, b.accountID, r.AssetID, r.NextAccrualAt, int64(b.amount), int64(amount))
+		if err != nil {
+			return nil, errors.Wrap(err, "recording accrual")
+		}
+	}
+	return e.list(ctx, accrualSelectQ+`WHERE a.rule_id = $1 AND a.period_end = $2 AND a.status = $3 ORDER BY a.id`,
+		r.ID, r.NextAccrualAt, StatusPlanned)
+}
+
+// Claim marks a planned accrual as being submitted. It
+// returns false if the accrual wasn't planned, such as when
+// another run has already claimed it.
+func (e *Engine) Claim(ctx context.Context, id string) (bool, error) {
+	const q = `
+		UPDATE accruals SET status = $2, updated_at = now()
+		WHERE id = $1 AND status = $3
+	`
+	res, err := e.db.ExecContext(ctx, q, id, StatusSubmitting, StatusPlanned)
+	if err != nil {
+		return false, errors.Wrap(err, "claiming accrual")
+	}
+	n, err := res.RowsAffected()
+	return n == 1, errors.Wrap(err)
+}
+
+// Finish records the outcome of submitting a claimed
+// accrual: the transaction that applied it, or the error
+// that stopped it.
+func (e *Engine) Finish(ctx context.Context, id string, txID *bc.Hash, failure error) error {
+	status, msg := StatusApplied, ""
+	if failure != nil {
+		status, msg = StatusFailed, failure.Error()
+	}
+	var txHash []byte
+	if txID != nil {
+		txHash = txID.Bytes()
+	}
+	const q = `
+		UPDATE accruals SET status = $2, tx_hash = $3, error = NULLIF($4, ''), updated_at = now()
+		WHERE id = $1
+	`
+	_, err := e.db.ExecContext(ctx, q, id, status, txHash, msg)
+	return errors.Wrap(err, "recording accrual outcome")
+}
+
+// Advance moves the rule on to its next period, once every
+// accrual for the current one has been submitted.
+func (e *Engine) Advance(ctx context.Context, r *Rule) error {
+	next := periodEnd(r.Period, r.NextAccrualAt)
+	const q = `UPDATE accrual_rules SET next_accrual_at = $3 WHERE id = $1 AND next_accrual_at = $2`
+	_, err := e.db.ExecContext(ctx, q, r.ID, r.NextAccrualAt, next)
+	if err != nil {
+		return errors.Wrap(err, "advancing accrual rule")
+	}
+	r.NextAccrualAt = next
+	return nil
+}
+
+const accrualSelectQ = `
+	SELECT a.id, a.rule_id, r.type, a.account_id, a.asset_id, a.period_end, a.balance, a.amount,
+		a.status, a.tx_hash, COALESCE(a.error, ''), a.created_at, a.updated_at
+	FROM accruals a JOIN accrual_rules r ON r.id = a.rule_id
+`
+
+// ListAccruals returns up to limit accruals, oldest first,
+// optionally only those of one rule or one account. Accruals
+// with IDs less than or equal to after are skipped; pass the
+// ID of the last accrual returned to get the next page, or ""
+// to get the first.
+func (e *Engine) ListAccruals(ctx context.Context, ruleID, accountID, after string, limit int) ([]*Accrual, error) {
+	return e.list(ctx, accrualSelectQ+`
+		WHERE ($1 = '' OR a.rule_id = $1) AND ($2 = '' OR a.account_id = $2) AND ($3 = '' OR a.id > $3)
+		ORDER BY a.id
+		LIMIT $4
+	`, ruleID, accountID, after, limit)
+}
+
+func (e *Engine) list(ctx context.Context, query string, args ...interface{}) ([]*Accrual, error) {
+	var accruals []*Accrual
+	err := pg.ForQueryRows(ctx, e.db, query, append(args, func(
+		id, ruleID, typ, accountID string, assetID bc.AssetID, periodEnd time.Time, balance, amount int64,
+		status string, txHash []byte, msg string, createdAt, updatedAt time.Time,
+	) error {
+		a := &Accrual{
+			ID:        id,
+			RuleID:    ruleID,
+			Type:      typ,
+			AccountID: accountID,
+			AssetID:   assetID,
+			PeriodEnd: periodEnd.UTC(),
+			Balance:   uint64(balance),
+			Amount:    uint64(amount),
+			Status:    status,
+			Error:     msg,
+			CreatedAt: createdAt,
+			UpdatedAt: updatedAt,
+		}
+		if txHash != nil {
+			a.TransactionID = new(bc.Hash)
+			err := a.TransactionID.Scan(txHash)
+			if err != nil {
+				return err
+			}
+		}
+		accruals = append(accruals, a)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying accruals")
+	}
+	return accruals, nil
+}
@@ -0,0 +1,76 @@
+package accrual
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"chain/errors"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Name: "savings", Type: TypeInterest, Rate: "0.0001", Period: PeriodDay}, true},
+		{Rule{Name: "upkeep", Type: TypeFee, FlatAmount: 500, Period: PeriodMonth}, true},
+		{Rule{Name: "upkeep", Type: TypeFee, FlatAmount: 500, Period: PeriodMonth, DestinationAccountID: "acc1"}, true},
+		{Rule{Name: "fraction", Type: TypeInterest, Rate: "1/365", Period: PeriodDay}, true},
+		{Rule{Type: TypeInterest, Rate: "0.01", Period: PeriodDay}, false},
+		{Rule{Name: "type", Type: "bonus", Rate: "0.01", Period: PeriodDay}, false},
+		{Rule{Name: "zero", Type: TypeFee, Period: PeriodDay}, false},
+		{Rule{Name: "negative", Type: TypeInterest, Rate: "-0.01", Period: PeriodDay}, false},
+		{Rule{Name: "garbled", Type: TypeInterest, Rate: "1%", Period: PeriodDay}, false},
+		{Rule{Name: "huge", Type: TypeFee, FlatAmount: math.MaxInt64 + 1, Period: PeriodDay}, false},
+		{Rule{Name: "weekly", Type: TypeFee, FlatAmount: 1, Period: "week"}, false},
+		{Rule{Name: "dest", Type: TypeInterest, Rate: "0.01", Period: PeriodDay, DestinationAccountID: "acc1"}, false},
+	}
+	for _, c := range cases {
+		err := c.rule.validate()
+		if c.ok && err != nil {
+			t.Errorf("validate(%+v) = %v, want nil", c.rule, err)
+		}
+		if !c.ok && errors.Root(err) != ErrBadRule {
+			t.Errorf("validate(%+v) = %v, want %v", c.rule, err, ErrBadRule)
+		}
+	}
+}
+
+func TestAmount(t *testing.T) {
+	cases := []struct {
+		rule    Rule
+		balance uint64
+		want    uint64
+		ok      bool
+	}{
+		{Rule{Type: TypeInterest, Rate: "0.0001"}, 1000000, 100, true},
+		{Rule{Type: TypeInterest, Rate: "0.0001"}, 9999, 0, true}, // rounded down
+		{Rule{Type: TypeInterest, Rate: "0.05", FlatAmount: 3}, 100, 8, true},
+		{Rule{Type: TypeFee, Rate: "0", FlatAmount: 500}, 1000, 500, true},
+		{Rule{Type: TypeFee, Rate: "0", FlatAmount: 500}, 200, 200, true}, // capped at the balance
+		{Rule{Type: TypeInterest, Rate: "2"}, math.MaxInt64, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := c.rule.Amount(c.balance)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%+v Amount(%d) = %d, %v, want %d, %v", c.rule, c.balance, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestPeriodEnd(t *testing.T) {
+	at := time.Date(2017, 12, 31, 15, 4, 5, 0, time.UTC)
+	if got, want := periodEnd(PeriodDay, at), time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("day end = %s, want %s", got, want)
+	}
+	if got, want := periodEnd(PeriodMonth, at), time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("month end = %s, want %s", got, want)
+	}
+	// A period ending at a boundary is followed by the next
+	// whole period.
+	boundary := time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+	if got, want := periodEnd(PeriodMonth, boundary), time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("month end after %s = %s, want %s", boundary, got, want)
+	}
+}
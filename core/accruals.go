@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"chain/core/accrual"
+	"chain/core/job"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+type accrualRuleRequest struct {
+	Name                    string                 `json:"name"`
+	Type                    string                 `json:"type"`
+	AssetID                 *bc.AssetID            `json:"asset_id"`
+	AssetAlias              string                 `json:"asset_alias"`
+	Rate                    string                 `json:"rate"`
+	FlatAmount              uint64                 `json:"flat_amount"`
+	Period                  string                 `json:"period"`
+	AccountTags             map[string]interface{} `json:"account_tags"`
+	DestinationAccountID    string                 `json:"destination_account_id"`
+	DestinationAccountAlias string                 `json:"destination_account_alias"`
+}
+
+// POST /create-accrual-rule
+//
+// Creates a rule that credits interest to, or charges a fee
+// to, the accounts holding an asset at the end of every day
+// or month. Accruals are applied by a recurring job, in
+// transactions signed with the mock HSM, once the transaction
+// index has reached the end of the period.
+func (a *API) createAccrualRule(ctx context.Context, x accrualRuleRequest) (*accrual.Rule, error) {
+	if !a.indexTxs {
+		return nil, errors.WithDetail(errNoTxIndex, "accruals are computed from the transaction index")
+	}
+	if a.signTemplate == nil {
+		return nil, errors.WithDetail(errNoMockHSM, "accruals are signed with keys held by the mock HSM")
+	}
+	r := &accrual.Rule{
+		Name:                 x.Name,
+		Type:                 x.Type,
+		Rate:                 x.Rate,
+		FlatAmount:           x.FlatAmount,
+		Period:               x.Period,
+		AccountTags:          x.AccountTags,
+		DestinationAccountID: x.DestinationAccountID,
+	}
+	switch {
+	case x.AssetAlias != "" && x.AssetID != nil:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id and asset_alias can't both be set")
+	case x.AssetAlias != "":
+		ast, err := a.assets.FindByAlias(ctx, x.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		r.AssetID = ast.AssetID
+	case x.AssetID != nil:
+		r.AssetID = *x.AssetID
+	default:
+		return nil, errors.WithDetail(accrual.ErrBadRule, "an asset_id or asset_alias is required")
+	}
+	if x.DestinationAccountAlias != "" {
+		if x.DestinationAccountID != "" {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "destination_account_id and destination_account_alias can't both be set")
+		}
+		acct, err := a.accounts.FindByAlias(ctx, x.DestinationAccountAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find account by alias")
+		}
+		r.DestinationAccountID = acct.ID
+	}
+	return a.accruals.Create(ctx, r)
+}
+
+// POST /disable-accrual-rule
+func (a *API) disableAccrualRule(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*accrual.Rule, error) {
+	return a.accruals.Disable(ctx, x.ID)
+}
+
+// accrualRuleList is the response to /list-accrual-rules.
+type accrualRuleList struct {
+	Items []*accrual.Rule `json:"items"`
+}
+
+// POST /list-accrual-rules
+func (a *API) listAccrualRules(ctx context.Context) (*accrualRuleList, error) {
+	list, err := a.accruals.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*accrual.Rule{} // send [], not null
+	}
+	return &accrualRuleList{Items: list}, nil
+}
+
+// accrualPage is the response to /list-accruals.
+type accrualPage struct {
+	Items    []*accrual.Accrual `json:"items"`
+	Next     accrualQuery       `json:"next"`
+	LastPage bool               `json:"last_page"`
+}
+
+type accrualQuery struct {
+	RuleID    string `json:"rule_id"`
+	AccountID string `json:"account_id"`
+	After     string `json:"after"`
+	PageSize  int    `json:"page_size"`
+}
+
+// POST /list-accruals
+//
+// Lists the accruals made by accrual rules, oldest first,
+// optionally only those of one rule or one account.
+func (a *API) listAccruals(ctx context.Context, in accrualQuery) (*accrualPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.accruals.ListAccruals(ctx, in.RuleID, in.AccountID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*accrual.Accrual{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &accrualPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// runAccruals applies the accruals of every rule with a
+// period that has ended and been indexed. It runs as a
+// recurring job, once per runAccrualsPeriod. A rule that
+// missed several periods, such as while the core was down,
+// catches up one period at a time. Failed accruals are
+// recorded, and don't hold the rule back.
+func (a *API) runAccruals(ctx context.Context, _ *job.Job) error {
+	height := a.pinStore.Height(query.TxPinName)
+	if height == 0 {
+		return nil
+	}
+	b, err := a.chain.GetBlock(ctx, height)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	indexed := b.Time()
+
+	rules, err := a.accruals.Due(ctx, indexed)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		for !r.NextAccrualAt.After(indexed) {
+			err = a.accrue(ctx, r)
+			if err == nil {
+				err = a.accruals.Advance(ctx, r)
+			}
+			if err != nil {
+				log.Error(ctx, err, fmt.Sprintf("accruing rule %s for period ending %s", r.ID, r.NextAccrualAt))
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// accrue applies the rule's accruals for the period ending
+// at its NextAccrualAt.
+func (a *API) accrue(ctx context.Context, r *accrual.Rule) error {
+	list, err := a.accruals.Plan(ctx, r)
+	if err != nil {
+		return err
+	}
+	for _, acc := range list {
+		ok, err := a.accruals.Claim(ctx, acc.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		txID, applyErr := a.applyAccrual(ctx, r, acc)
+		err = a.accruals.Finish(ctx, acc.ID, txID, applyErr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAccrual submits a transaction issuing the interest to,
+// or spending the fee from, the accrual's account, and waits
+// until it has been processed. The transaction records the
+// accrual in its reference data.
+func (a *API) applyAccrual(ctx context.Context, r *accrual.Rule, acc *accrual.Accrual) (*bc.Hash, error) {
+	assetID := acc.AssetID.String()
+	var actions []map[string]interface{}
+	if r.Type == accrual.TypeInterest {
+		actions = append(actions, map[string]interface{}{
+			"type":     "issue",
+			"asset_id": assetID,
+			"amount":   acc.Amount,
+		}, map[string]interface{}{
+			"type":       "control_account",
+			"account_id": acc.AccountID,
+			"asset_id":   assetID,
+			"amount":     acc.Amount,
+		})
+	} else {
+		actions = append(actions, map[string]interface{}{
+			"type":       "spend_account",
+			"account_id": acc.AccountID,
+			"asset_id":   assetID,
+			"amount":     acc.Amount,
+		})
+		if r.DestinationAccountID != "" {
+			actions = append(actions, map[string]interface{}{
+				"type":       "control_account",
+				"account_id": r.DestinationAccountID,
+				"asset_id":   assetID,
+				"amount":     acc.Amount,
+			})
+		} else {
+			actions = append(actions, map[string]interface{}{
+				"type":     "retire",
+				"asset_id": assetID,
+				"amount":   acc.Amount,
+			})
+		}
+	}
+	actions = append(actions, map[string]interface{}{
+		"type": "set_transaction_reference_data",
+		"reference_data": map[string]interface{}{"accrual": map[string]interface{}{
+			"id":         acc.ID,
+			"rule_id":    acc.RuleID,
+			"type":       acc.Type,
+			"period_end": acc.PeriodEnd,
+		}},
+	})
+
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: actions})
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing accrual")
+	}
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.Transaction.ID, nil
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/addressbook"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+type addressBookRequest struct {
+	Alias          string        `json:"alias"`
+	ControlProgram json.HexBytes `json:"control_program"`
+}
+
+// addressBookList is the response to /list-address-book-entries.
+type addressBookList struct {
+	Items []*addressbook.Entry `json:"items"`
+}
+
+// POST /create-address-book-entry
+//
+// Records an external receiver's control program under an
+// alias. The new entry can't be paid until it is verified
+// with /verify-address-book-entry.
+func (a *API) createAddressBookEntry(ctx context.Context, x addressBookRequest) (*addressbook.Entry, error) {
+	if x.Alias == "" || len(x.ControlProgram) == 0 {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "an alias and control_program are required")
+	}
+	return addressbook.Create(ctx, a.db, x.Alias, x.ControlProgram)
+}
+
+// POST /verify-address-book-entry
+//
+// Verifies an address book entry by supplying its control
+// program a second time. Once verified, the entry can be
+// paid with an address_alias on a control_program action.
+func (a *API) verifyAddressBookEntry(ctx context.Context, x addressBookRequest) (*addressbook.Entry, error) {
+	return addressbook.Verify(ctx, a.db, x.Alias, x.ControlProgram)
+}
+
+// POST /delete-address-book-entry
+func (a *API) deleteAddressBookEntry(ctx context.Context, x addressBookRequest) error {
+	return addressbook.Delete(ctx, a.db, x.Alias)
+}
+
+// POST /list-address-book-entries
+func (a *API) listAddressBookEntries(ctx context.Context) (*addressBookList, error) {
+	entries, err := addressbook.List(ctx, a.db)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*addressbook.Entry{} // send [], not null
+	}
+	return &addressBookList{Items: entries}, nil
+}
@@ -0,0 +1,162 @@
+// Package addressbook records named control programs of
+// external receivers, so transactions can pay them by name
+// instead of by a pasted control program.
+//
+// A new entry is unverified and can't be paid. It becomes
+// verified when its control program is confirmed by
+// supplying it a second time, ideally from a separate
+// source such as the receiver's signed invoice. This
+// catches a control program that was mistyped or pasted
+// incorrectly before any assets are sent to it.
+package addressbook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+)
+
+var (
+	// ErrDuplicateAlias is returned when an entry with the
+	// same alias already exists.
+	ErrDuplicateAlias = errors.New("duplicate address book alias")
+
+	// ErrMismatch is returned when verifying an entry with
+	// a control program different from the one recorded.
+	ErrMismatch = errors.New("control program does not match address book entry")
+
+	// ErrUnverified is returned when paying an entry that
+	// hasn't been verified.
+	ErrUnverified = errors.New("address book entry is not verified")
+)
+
+// Entry is a named control program.
+type Entry struct {
+	Alias          string             `json:"alias"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+	Verified       bool               `json:"verified"`
+	VerifiedAt     *time.Time         `json:"verified_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// Create adds an unverified entry to the address book.
+func Create(ctx context.Context, db pg.DB, alias string, prog []byte) (*Entry, error) {
+	const q = `
+		INSERT INTO address_book (alias, control_program) VALUES ($1, $2)
+		RETURNING created_at
+	`
+	e := &Entry{Alias: alias, ControlProgram: prog}
+	err := db.QueryRowContext(ctx, q, alias, prog).Scan(&e.CreatedAt)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetailf(ErrDuplicateAlias, "address book alias %q already exists", alias)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return e, nil
+}
+
+// Verify marks the entry with the given alias as verified,
+// if prog is the control program it records. Otherwise it
+// returns ErrMismatch and leaves the entry unverified.
+func Verify(ctx context.Context, db pg.DB, alias string, prog []byte) (*Entry, error) {
+	e, err := find(ctx, db, alias)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(e.ControlProgram, prog) {
+		return nil, errors.WithDetailf(ErrMismatch, "control program does not match address book entry %q", alias)
+	}
+	if e.Verified {
+		return e, nil
+	}
+	const q = `
+		UPDATE address_book SET verified_at = now()
+		WHERE alias = $1 AND control_program = $2
+		RETURNING verified_at
+	`
+	var t time.Time
+	err = db.QueryRowContext(ctx, q, alias, prog).Scan(&t)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "address book entry %q not found", alias)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	e.Verified, e.VerifiedAt = true, &t
+	return e, nil
+}
+
+// Delete removes the entry with the given alias.
+func Delete(ctx context.Context, db pg.DB, alias string) error {
+	const q = `DELETE FROM address_book WHERE alias = $1`
+	res, err := db.ExecContext(ctx, q, alias)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "address book entry %q not found", alias)
+	}
+	return nil
+}
+
+// List returns all entries, ordered by alias.
+func List(ctx context.Context, db pg.DB) ([]*Entry, error) {
+	const q = `SELECT alias, control_program, verified_at, created_at FROM address_book ORDER BY alias`
+	var entries []*Entry
+	err := pg.ForQueryRows(ctx, db, q, func(alias string, prog []byte, verifiedAt pq.NullTime, createdAt time.Time) {
+		entries = append(entries, newEntry(alias, prog, verifiedAt, createdAt))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return entries, nil
+}
+
+// ControlProgram returns the control program of the verified
+// entry with the given alias. It returns ErrUnverified if the
+// entry hasn't been verified.
+func ControlProgram(ctx context.Context, db pg.DB, alias string) ([]byte, error) {
+	e, err := find(ctx, db, alias)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Verified {
+		return nil, errors.WithDetailf(ErrUnverified, "address book entry %q must be verified before it can be paid", alias)
+	}
+	return e.ControlProgram, nil
+}
+
+func find(ctx context.Context, db pg.DB, alias string) (*Entry, error) {
+	const q = `SELECT control_program, verified_at, created_at FROM address_book WHERE alias = $1`
+	var (
+		prog       []byte
+		verifiedAt pq.NullTime
+		createdAt  time.Time
+	)
+	err := db.QueryRowContext(ctx, q, alias).Scan(&prog, &verifiedAt, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "address book entry %q not found", alias)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return newEntry(alias, prog, verifiedAt, createdAt), nil
+}
+
+func newEntry(alias string, prog []byte, verifiedAt pq.NullTime, createdAt time.Time) *Entry {
+	e := &Entry{Alias: alias, ControlProgram: prog, CreatedAt: createdAt}
+	if verifiedAt.Valid {
+		t := verifiedAt.Time
+		e.Verified, e.VerifiedAt = true, &t
+	}
+	return e
+}
@@ -0,0 +1,70 @@
+package addressbook
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func TestAddressBook(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	prog := []byte{0x51}
+
+	e, err := Create(ctx, db, "bob", prog)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if e.Verified {
+		t.Error("new entry is verified")
+	}
+	_, err = Create(ctx, db, "bob", prog)
+	if errors.Root(err) != ErrDuplicateAlias {
+		t.Errorf("creating duplicate = %v, want %v", err, ErrDuplicateAlias)
+	}
+
+	_, err = ControlProgram(ctx, db, "bob")
+	if errors.Root(err) != ErrUnverified {
+		t.Errorf("ControlProgram(unverified) = %v, want %v", err, ErrUnverified)
+	}
+	_, err = Verify(ctx, db, "bob", []byte{0x52})
+	if errors.Root(err) != ErrMismatch {
+		t.Errorf("Verify(wrong program) = %v, want %v", err, ErrMismatch)
+	}
+	e, err = Verify(ctx, db, "bob", prog)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !e.Verified || e.VerifiedAt == nil {
+		t.Errorf("Verify = %+v, want verified entry", e)
+	}
+	got, err := ControlProgram(ctx, db, "bob")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !bytes.Equal(got, prog) {
+		t.Errorf("ControlProgram = %x, want %x", got, prog)
+	}
+
+	entries, err := List(ctx, db)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(entries) != 1 || !entries[0].Verified {
+		t.Errorf("List = %+v, want one verified entry", entries)
+	}
+
+	err = Delete(ctx, db, "bob")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = ControlProgram(ctx, db, "bob")
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("ControlProgram(deleted) = %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+}
@@ -10,22 +10,42 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/pprof"
+	"strings"
 	"sync"
 	"time"
 
 	"chain/core/accesstoken"
 	"chain/core/account"
+	"chain/core/accrual"
 	"chain/core/asset"
 	"chain/core/config"
+	"chain/core/escrow"
+	"chain/core/export"
+	"chain/core/federation"
 	"chain/core/fetch"
 	"chain/core/generator"
+	"chain/core/htlc"
+	"chain/core/ilp"
+	"chain/core/invite"
+	"chain/core/job"
 	"chain/core/leader"
+	"chain/core/payout"
+	"chain/core/payreq"
 	"chain/core/pin"
 	"chain/core/query"
+	"chain/core/receipt"
+	"chain/core/reqsign"
+	"chain/core/retention"
+	"chain/core/review"
 	"chain/core/rpc"
+	"chain/core/rules"
+	"chain/core/screening"
+	"chain/core/statement"
+	"chain/core/subscription"
 	"chain/core/txbuilder"
 	"chain/core/txdb"
 	"chain/core/txfeed"
+	"chain/core/usage"
 	"chain/database/pg"
 	"chain/database/sinkdb"
 	"chain/encoding/json"
@@ -34,6 +54,7 @@ import (
 	"chain/log"
 	"chain/net/http/authn"
 	"chain/net/http/authz"
+	"chain/net/http/etag"
 	"chain/net/http/gzip"
 	"chain/net/http/httpjson"
 	"chain/net/http/limit"
@@ -46,6 +67,15 @@ const (
 	defGenericPageSize = 100
 )
 
+// HeaderReadPrimary is the request header that, set to "true",
+// makes a query read from the primary database rather than a
+// read replica.
+const HeaderReadPrimary = "Chain-Read-Primary"
+
+// HeaderEnvironment is the response header naming the
+// environment, live or test, the Core runs in.
+const HeaderEnvironment = "Chain-Environment"
+
 // TODO(kr): change this to "crosscore" or something.
 const crosscoreRPCPrefix = "/rpc/"
 
@@ -62,18 +92,40 @@ type API struct {
 	pinStore        *pin.Store
 	assets          *asset.Registry
 	accounts        *account.Manager
+	accruals        *accrual.Engine
+	escrows         *escrow.Manager
+	htlcs           *htlc.Manager
+	counterparties  *federation.Directory
+	interledger     *ilp.Connector
 	indexer         *query.Indexer
 	txFeeds         *txfeed.Tracker
+	paymentRequests *payreq.Tracker
+	payouts         *payout.Manager
+	receipts        *receipt.Signer
+	reviews         *review.Queue
+	statements      *statement.Store
+	subscriptions   *subscription.Manager
+	rules           *rules.Engine
+	usage           *usage.Meter
+	retention       *retention.Pruner
+	jobs            *job.Queue
+	exports         *export.Exporter
+	screener        screening.Screener // nil without compliance screening
 	accessTokens    *accesstoken.CredentialStore
 	grants          *authz.Store
+	invitations     *invite.Store
+	signatures      *reqsign.Verifier
 	config          *config.Config
 	options         *config.Options
 	submitter       txbuilder.Submitter
+	signTemplate    txbuilder.SignFunc // signs with server-held keys; nil without a mock HSM
 	db              pg.DB
+	replica         pg.DB
 	sdb             *sinkdb.DB
 	mux             *http.ServeMux
 	handler         http.Handler
 	leader          leaderProcess
+	singletons      *leader.Singletons
 	addr            string
 	signer          func(context.Context, *legacy.Block) ([]byte, error)
 	requestLimits   []requestLimit
@@ -118,15 +170,194 @@ func maxBytes(h http.Handler) http.Handler {
 	})
 }
 
-func (a *API) needConfig() func(f interface{}) http.Handler {
+// bodyLimit restricts the request bodies a route accepts,
+// beyond the limit maxBytes applies to every route.
+type bodyLimit struct {
+	maxSize int64
+	strict  bool // reject fields the route doesn't take
+}
+
+// bodyLimits are the request body restrictions of the routes
+// that opt in to them. Definitions and tags are stored as
+// given, so these routes take modest bodies, and they report
+// misspelled parameters instead of ignoring them.
+var bodyLimits = map[string]bodyLimit{
+	"/create-asset":         {maxSize: 1 << 20, strict: true},
+	"/update-asset-tags":    {maxSize: 1 << 20, strict: true},
+	"/create-account":       {maxSize: 1 << 20, strict: true},
+	"/create-account-batch": {maxSize: 1 << 20, strict: true},
+	"/update-account-tags":  {maxSize: 1 << 20, strict: true},
+}
+
+// bodyOptions returns the httpjson options enforcing the
+// body limit of the route at path, if it has one.
+func bodyOptions(path string) []httpjson.Option {
+	l, ok := bodyLimits[path]
+	if !ok {
+		return nil
+	}
+	opts := []httpjson.Option{httpjson.MaxBodySize(l.maxSize)}
+	if l.strict {
+		opts = append(opts, httpjson.DisallowUnknownFields())
+	}
+	return opts
+}
+
+func (a *API) needConfig() func(f interface{}, opts ...httpjson.Option) http.Handler {
 	if a.config == nil {
-		return func(f interface{}) http.Handler {
+		return func(f interface{}, opts ...httpjson.Option) http.Handler {
 			return alwaysError(errUnconfigured)
 		}
 	}
 	return jsonHandler
 }
 
+// route is a Chain Core API route and its handler function.
+type route struct {
+	path string
+	f    interface{}
+}
+
+// clientRoutes returns the routes client applications use
+// to work with the blockchain. They are described by the
+// OpenAPI document served at /openapi.json.
+func (a *API) clientRoutes() []route {
+	return []route{
+		{"/create-account", a.createAccount},
+		{"/create-account-batch", a.createAccountBatch},
+		{"/archive-account", a.archiveAccount},
+		{"/unarchive-account", a.unarchiveAccount},
+		{"/create-asset", a.createAsset},
+		{"/update-account-tags", a.updateAccountTags},
+		{"/update-asset-tags", a.updateAssetTags},
+		{"/build-transaction", a.build},
+		{"/submit-transaction", a.submit},
+		{"/build-reversal", a.buildReversal},
+		{"/transfer", a.transfer},
+		{"/create-control-program", a.createControlProgram}, // DEPRECATED
+		{"/create-account-receiver", a.createAccountReceiver},
+		{"/list-account-receivers", a.listAccountReceivers},
+		{"/create-payment-request", a.createPaymentRequest},
+		{"/get-payment-request", a.getPaymentRequest},
+		{"/create-transaction-feed", a.createTxFeed},
+		{"/get-transaction-feed", a.getTxFeed},
+		{"/update-transaction-feed", a.updateTxFeed},
+		{"/delete-transaction-feed", a.deleteTxFeed},
+		{"/create-freeze", a.createFreeze},
+		{"/delete-freeze", a.deleteFreeze},
+		{"/create-address-book-entry", a.createAddressBookEntry},
+		{"/verify-address-book-entry", a.verifyAddressBookEntry},
+		{"/delete-address-book-entry", a.deleteAddressBookEntry},
+		{"/list-accounts", a.listAccounts},
+		{"/list-assets", a.listAssets},
+		{"/list-transaction-feeds", a.listTxFeeds},
+		{"/list-freezes", a.listFreezes},
+		{"/list-address-book-entries", a.listAddressBookEntries},
+		{"/list-payment-requests", a.listPaymentRequests},
+		{"/list-held-transactions", a.listHeldTransactions},
+		{"/approve-held-transaction", a.approveHeldTransaction},
+		{"/reject-held-transaction", a.rejectHeldTransaction},
+		{"/get-review-queue-stats", a.getReviewQueueStats},
+		{"/create-rule", a.createRule},
+		{"/update-rule", a.updateRule},
+		{"/delete-rule", a.deleteRule},
+		{"/list-rules", a.listRules},
+		{"/list-rule-matches", a.listRuleMatches},
+		{"/create-accrual-rule", a.createAccrualRule},
+		{"/disable-accrual-rule", a.disableAccrualRule},
+		{"/list-accrual-rules", a.listAccrualRules},
+		{"/list-accruals", a.listAccruals},
+		{"/create-escrow", a.createEscrow},
+		{"/release-escrow", a.releaseEscrow},
+		{"/refund-escrow", a.refundEscrow},
+		{"/dispute-escrow", a.disputeEscrow},
+		{"/get-escrow", a.getEscrow},
+		{"/list-escrows", a.listEscrows},
+		{"/create-subscription", a.createSubscription},
+		{"/pause-subscription", a.pauseSubscription},
+		{"/resume-subscription", a.resumeSubscription},
+		{"/cancel-subscription", a.cancelSubscription},
+		{"/get-subscription", a.getSubscription},
+		{"/list-subscriptions", a.listSubscriptions},
+		{"/list-subscription-executions", a.listSubscriptionExecutions},
+		{"/create-payout-batch", a.createPayoutBatch},
+		{"/approve-payout-batch", a.approvePayoutBatch},
+		{"/reject-payout-batch", a.rejectPayoutBatch},
+		{"/get-payout-batch", a.getPayoutBatch},
+		{"/get-payout-batch-report", a.getPayoutBatchReport},
+		{"/list-payout-batches", a.listPayoutBatches},
+		{"/list-payout-rows", a.listPayoutRows},
+		{"/create-counterparty", a.createCounterparty},
+		{"/update-counterparty", a.updateCounterparty},
+		{"/delete-counterparty", a.deleteCounterparty},
+		{"/get-counterparty", a.getCounterparty},
+		{"/list-counterparties", a.listCounterparties},
+		{"/verify-counterparty", a.verifyCounterparty},
+		{"/get-node-public-key", a.getNodePublicKey},
+		{"/create-htlc", a.createHTLC},
+		{"/claim-htlc", a.claimHTLC},
+		{"/refund-htlc", a.refundHTLC},
+		{"/get-htlc", a.getHTLC},
+		{"/list-htlcs", a.listHTLCs},
+		{"/create-payment-pointer", a.createPaymentPointer},
+		{"/delete-payment-pointer", a.deletePaymentPointer},
+		{"/list-payment-pointers", a.listPaymentPointers},
+		{"/create-ilp-peer", a.createILPPeer},
+		{"/delete-ilp-peer", a.deleteILPPeer},
+		{"/list-ilp-peers", a.listILPPeers},
+		{"/list-ilp-payments", a.listILPPayments},
+		{"/create-invitation", a.createInvitation},
+		{"/resend-invitation", a.resendInvitation},
+		{"/revoke-invitation", a.revokeInvitation},
+		{"/list-invitations", a.listInvitations},
+		{"/accept-invitation", a.acceptInvitation},
+		{"/create-service-account", a.createServiceAccount},
+		{"/list-service-accounts", a.listServiceAccounts},
+		{"/update-service-account-policies", a.updateServiceAccountPolicies},
+		{"/create-service-account-token", a.createServiceAccountToken},
+		{"/delete-service-account", a.deleteServiceAccount},
+		{"/get-transaction-receipt", a.getTransactionReceipt},
+		{"/get-receipt-public-key", a.getReceiptPublicKey},
+		{"/get-block", a.getBlock},
+		{"/list-block-transactions", a.listBlockTransactions},
+		{"/get-raw-transaction", a.getRawTransaction},
+		{"/list-transactions", a.listTransactions},
+		{"/list-balances", a.listBalances},
+		{"/get-asset-stats", a.getAssetStats},
+		{"/get-balance-sheet", a.getBalanceSheet},
+		{"/verify-ledger", a.verifyLedger},
+		{"/get-usage", a.getUsage},
+		{"/create-ledger-snapshot", a.createLedgerSnapshot},
+		{"/get-ledger-snapshot", a.getLedgerSnapshot},
+		{"/list-ledger-snapshots", a.listLedgerSnapshots},
+		{"/list-dead-jobs", a.listDeadJobs},
+		{"/get-leaders", a.getLeaders},
+		{"/list-events", a.listEvents},
+		{"/get-asset-definition-proof", a.getAssetDefinitionProof},
+		{"/record-issuance-fx-snapshot", a.recordIssuanceFXSnapshot},
+		{"/list-issuance-fx-snapshots", a.listIssuanceFXSnapshots},
+		{"/list-balance-deltas", a.listBalanceDeltas},
+		{"/list-journal-entries", a.listJournalEntries},
+		{"/list-journal-periods", a.listJournalPeriods},
+		{"/close-journal-period", a.closeJournalPeriod},
+		{"/create-journal-export", a.createJournalExport},
+		{"/get-journal-export", a.getJournalExport},
+		{"/list-journal-exports", a.listJournalExports},
+		{"/create-account-statement", a.createAccountStatement},
+		{"/get-account-statement", a.getAccountStatement},
+		{"/list-account-statements", a.listAccountStatements},
+		{"/list-unspent-outputs", a.listUnspentOutputs},
+		{"/generate-block", a.generateBlock},
+	}
+}
+
+// isReadRoute reports whether the route at path only reads
+// data. Read routes honor If-None-Match, so clients that fetch
+// the same data repeatedly can skip downloading it again.
+func isReadRoute(path string) bool {
+	return strings.HasPrefix(path, "/list-") || strings.HasPrefix(path, "/get-")
+}
+
 // buildHandler adds the Core API routes to a preexisting http handler.
 func (a *API) buildHandler() {
 	needConfig := a.needConfig()
@@ -136,29 +367,36 @@ func (a *API) buildHandler() {
 		resetAllowed = func(h http.Handler) http.Handler { return h }
 	}
 
+	signed := func(path string, h http.Handler) http.Handler {
+		if a.signatures != nil && signedRoutes[path] {
+			return a.verifySignature(h)
+		}
+		return h
+	}
+
 	m := a.mux
 	m.Handle("/", alwaysError(errNotFound))
 
-	m.Handle("/create-account", needConfig(a.createAccount))
-	m.Handle("/create-asset", needConfig(a.createAsset))
-	m.Handle("/update-account-tags", needConfig(a.updateAccountTags))
-	m.Handle("/update-asset-tags", needConfig(a.updateAssetTags))
-	m.Handle("/build-transaction", needConfig(a.build))
-	m.Handle("/submit-transaction", needConfig(a.submit))
-	m.Handle("/create-control-program", needConfig(a.createControlProgram)) // DEPRECATED
-	m.Handle("/create-account-receiver", needConfig(a.createAccountReceiver))
-	m.Handle("/create-transaction-feed", needConfig(a.createTxFeed))
-	m.Handle("/get-transaction-feed", needConfig(a.getTxFeed))
-	m.Handle("/update-transaction-feed", needConfig(a.updateTxFeed))
-	m.Handle("/delete-transaction-feed", needConfig(a.deleteTxFeed))
+	for _, r := range a.clientRoutes() {
+		h := needConfig(r.f, bodyOptions(r.path)...)
+		if isReadRoute(r.path) {
+			h = etag.Handler{Handler: h}
+		}
+		h = signed(r.path, h)
+		if a.usage != nil && r.path != "/get-usage" {
+			// Let clients see their usage even when over quota.
+			h = a.meterRequests(h)
+		}
+		m.Handle(r.path, h)
+	}
 	m.Handle("/mockhsm", alwaysError(errNoMockHSM))
-	m.Handle("/list-accounts", needConfig(a.listAccounts))
-	m.Handle("/list-assets", needConfig(a.listAssets))
-	m.Handle("/list-transaction-feeds", needConfig(a.listTxFeeds))
-	m.Handle("/list-transactions", needConfig(a.listTransactions))
-	m.Handle("/list-balances", needConfig(a.listBalances))
-	m.Handle("/list-unspent-outputs", needConfig(a.listUnspentOutputs))
-	m.Handle("/reset", resetAllowed(needConfig(a.reset)))
+	m.Handle("/reset", signed("/reset", resetAllowed(needConfig(a.reset))))
+	m.Handle("/openapi.json", jsonHandler(a.openAPI))
+	m.Handle("/render-account-statement", http.HandlerFunc(a.renderAccountStatement))
+	m.Handle("/upload-payout-batch", http.HandlerFunc(a.uploadPayoutBatch))
+	m.Handle("/render-payout-batch-errors", http.HandlerFunc(a.renderPayoutBatchErrors))
+	m.Handle("/ilp", http.HandlerFunc(a.ilpPacket))
+	m.Handle(spspPrefix, http.HandlerFunc(a.spsp))
 
 	m.Handle(crosscoreRPCPrefix+"submit", needConfig(func(ctx context.Context, tx *legacy.Tx) error {
 		return a.submitter.Submit(ctx, tx)
@@ -166,6 +404,7 @@ func (a *API) buildHandler() {
 	m.Handle(crosscoreRPCPrefix+"get-block", needConfig(a.getBlockRPC))
 	m.Handle(crosscoreRPCPrefix+"get-snapshot-info", needConfig(a.getSnapshotInfoRPC))
 	m.Handle(crosscoreRPCPrefix+"get-snapshot", http.HandlerFunc(a.getSnapshotRPC))
+	m.Handle(crosscoreRPCPrefix+"federation-handshake", needConfig(a.federationHandshake))
 	m.Handle(crosscoreRPCPrefix+"signer/sign-block", needConfig(a.leaderSignHandler(a.signer)))
 	m.Handle(crosscoreRPCPrefix+"block-height", needConfig(func(ctx context.Context) map[string]uint64 {
 		h := a.chain.Height()
@@ -175,11 +414,13 @@ func (a *API) buildHandler() {
 	}))
 
 	m.Handle("/list-authorization-grants", jsonHandler(a.listGrants))
-	m.Handle("/create-authorization-grant", jsonHandler(a.createGrant))
-	m.Handle("/delete-authorization-grant", jsonHandler(a.deleteGrant))
-	m.Handle("/create-access-token", jsonHandler(a.createAccessToken))
+	m.Handle("/create-authorization-grant", signed("/create-authorization-grant", jsonHandler(a.createGrant)))
+	m.Handle("/delete-authorization-grant", signed("/delete-authorization-grant", jsonHandler(a.deleteGrant)))
+	m.Handle("/create-access-token", signed("/create-access-token", jsonHandler(a.createAccessToken)))
 	m.Handle("/list-access-tokens", jsonHandler(a.listAccessTokens))
-	m.Handle("/delete-access-token", jsonHandler(a.deleteAccessToken))
+	m.Handle("/delete-access-token", signed("/delete-access-token", jsonHandler(a.deleteAccessToken)))
+	m.Handle("/create-request-signing-secret", signed("/create-request-signing-secret", jsonHandler(a.createRequestSigningSecret)))
+	m.Handle("/delete-request-signing-secret", signed("/delete-request-signing-secret", jsonHandler(a.deleteRequestSigningSecret)))
 	m.Handle("/add-allowed-member", jsonHandler(a.addAllowedMember))
 	m.Handle("/init-cluster", jsonHandler(a.initCluster))
 	m.Handle("/join-cluster", jsonHandler(a.joinCluster))
@@ -210,6 +451,8 @@ func (a *API) buildHandler() {
 	handler = gzip.Handler{Handler: handler}
 	handler = coreCounter(handler)
 	handler = timeoutContextHandler(handler)
+	handler = readPrimaryHandler(handler)
+	handler = boundedHandler(handler)
 	if a.config != nil && a.config.BlockchainId != nil {
 		handler = blockchainIDHandler(handler, a.config.BlockchainId.String())
 	}
@@ -234,6 +477,12 @@ type requestQuery struct {
 	// should be included. It has no relationship to time.
 	After string `json:"after"`
 
+	// Until is an opaque cursor returned by an earlier query. It is
+	// used by /list-transactions to return only the transactions
+	// after `After` and up to and including the one identified by
+	// `Until`, in ascending order.
+	Until string `json:"until,omitempty"`
+
 	// These two are used for time-range queries like /list-transactions
 	StartTimeMS uint64 `json:"start_time,omitempty"`
 	EndTimeMS   uint64 `json:"end_time,omitempty"`
@@ -242,6 +491,10 @@ type requestQuery struct {
 	// TODO(bobg): Different request structs for endpoints with different needs
 	TimestampMS uint64 `json:"timestamp,omitempty"`
 
+	// These two are used for block-range queries like /list-balance-deltas
+	SinceBlock uint64 `json:"since_block,omitempty"`
+	UntilBlock uint64 `json:"until_block,omitempty"`
+
 	// This is used for filtering results from /list-access-tokens
 	// Value must be "client" or "network"
 	Type string `json:"type"`
@@ -260,20 +513,25 @@ type page struct {
 func AuthHandler(handler http.Handler, sdb *sinkdb.DB, accessTokens *accesstoken.CredentialStore, tlsConfig *tls.Config, extraGrants []*authz.Grant) http.Handler {
 	var subj *pkix.Name
 	rootCAs := x509.NewCertPool()
+	var clientCAs *x509.CertPool
 	if tlsConfig != nil {
 		x509Cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
 		if err != nil {
 			log.Fatalkv(context.Background(), log.KeyError, err)
 		}
 		subj = &x509Cert.Subject
-		rootCAs = tlsConfig.ClientCAs
+		rootCAs = tlsConfig.RootCAs
+		clientCAs = tlsConfig.ClientCAs
 	}
 
 	authorizer := authz.NewAuthorizer(
 		grantStore(sdb, extraGrants, subj),
 		policyByRoute,
 	)
-	authenticator := authn.NewAPI(accessTokens, crosscoreRPCPrefix, rootCAs)
+	// Partner CAs from CLIENT_CA_CERTS can't vouch for
+	// members of the cluster or for other cores.
+	authorizer.SetMemberPolicies("internal", "crosscore", "crosscore-signblock")
+	authenticator := authn.NewAPI(accessTokens, crosscoreRPCPrefix, rootCAs, clientCAs)
 
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		// TODO(tessr): check that this path exists; return early if this path isn't legit
@@ -310,6 +568,27 @@ func timeoutContextHandler(handler http.Handler) http.Handler {
 	})
 }
 
+// readPrimaryHandler makes requests with HeaderReadPrimary set
+// read from the primary database even if a read replica is
+// configured.
+func readPrimaryHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(HeaderReadPrimary) == "true" {
+			req = req.WithContext(pg.NewPrimaryContext(req.Context()))
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// boundedHandler makes the database queries of requests
+// subject to the statement timeout of API requests, if the
+// Core's database has one (see pg.BoundedDB).
+func boundedHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(w, req.WithContext(pg.NewBoundedContext(req.Context())))
+	})
+}
+
 // blockchainIDHandler adds the Blockchain-ID HTTP header to all
 // requests.
 func blockchainIDHandler(handler http.Handler, blockchainID string) http.Handler {
@@ -331,10 +610,25 @@ func loggingHandler(handler http.Handler) http.Handler {
 		if coreID := req.Header.Get("Chain-Core-ID"); coreID != "" {
 			ctx = log.AddPrefixkv(ctx, "coreid", coreID)
 		}
+		if sa := authn.ServiceAccount(ctx); sa != "" {
+			ctx = log.AddPrefixkv(ctx, "service_account", sa)
+		}
+		if certs := authn.X509Certs(ctx); len(certs) > 0 {
+			ctx = log.AddPrefixkv(ctx, "client_cert", certs[0].Subject.String())
+		}
 		handler.ServeHTTP(w, req.WithContext(ctx))
 	})
 }
 
+// EnvironmentHandler marks every response with the environment
+// env the Core runs in, so clients can tell test data from live.
+func EnvironmentHandler(next http.Handler, env string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(HeaderEnvironment, env)
+		next.ServeHTTP(w, req)
+	})
+}
+
 // RedirectHandler redirects / to /dashboard/.
 func RedirectHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -404,8 +698,8 @@ func healthHandler(handler http.Handler) http.Handler {
 	})
 }
 
-func jsonHandler(f interface{}) http.Handler {
-	h, err := httpjson.Handler(f, errorFormatter.Write)
+func jsonHandler(f interface{}, opts ...httpjson.Option) http.Handler {
+	h, err := httpjson.Handler(f, errorFormatter.Write, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -16,7 +16,9 @@ import (
 	"chain/core/leader"
 	"chain/core/pin"
 	"chain/core/query"
+	"chain/core/rules"
 	"chain/core/txbuilder"
+	"chain/core/usage"
 	"chain/database/pg/pgtest"
 	"chain/errors"
 	"chain/protocol/bc"
@@ -211,6 +213,8 @@ func TestTransfer(t *testing.T) {
 		assets:    asset.NewRegistry(db, c, pinStore),
 		accounts:  account.NewManager(db, c, pinStore),
 		indexer:   query.NewIndexer(db, c, pinStore),
+		rules:     rules.NewEngine(db),
+		usage:     usage.NewMeter(db),
 		db:        db,
 	}
 	api.assets.IndexAssets(api.indexer)
@@ -6,7 +6,6 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"sync"
 
 	"golang.org/x/crypto/sha3"
@@ -15,6 +14,7 @@ import (
 	"github.com/golang/groupcache/singleflight"
 	"github.com/lib/pq"
 
+	"chain/core/event"
 	"chain/core/pin"
 	"chain/core/signers"
 	"chain/crypto/ed25519"
@@ -31,6 +31,7 @@ const maxAssetCache = 1000
 var (
 	ErrDuplicateAlias = errors.New("duplicate asset alias")
 	ErrBadIdentifier  = errors.New("either ID or alias must be specified, and not both")
+	ErrBadAssetID     = errors.New("malformed asset ID")
 )
 
 func NewRegistry(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Registry {
@@ -112,6 +113,14 @@ func (reg *Registry) Define(ctx context.Context, xpubs []chainkd.XPub, quorum in
 	if err != nil {
 		return nil, errors.Wrap(err, "serializing asset definition")
 	}
+	_, err = pricingCurrency(definition)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, err = precision(definition)
+	if err != nil {
+		return nil, err
+	}
 
 	path := signers.Path(assetSigner, signers.AssetKeySpace)
 	derivedXPubs := chainkd.DeriveXPubs(assetSigner.XPubs, path)
@@ -151,6 +160,11 @@ func (reg *Registry) Define(ctx context.Context, xpubs []chainkd.XPub, quorum in
 		return nil, errors.Wrap(err, "indexing annotated asset")
 	}
 
+	err = reg.recordEvent(ctx, event.AssetCreated, asset)
+	if err != nil {
+		return nil, err
+	}
+
 	return asset, nil
 }
 
@@ -172,7 +186,7 @@ func (reg *Registry) UpdateTags(ctx context.Context, id, alias *string, tags map
 		var aid bc.AssetID
 		err = aid.UnmarshalText([]byte(*id))
 		if err != nil {
-			return errors.Wrap(err, "deserialize asset ID")
+			return errors.WithDetailf(ErrBadAssetID, "invalid asset ID %q", *id)
 		}
 
 		asset, err = reg.findByID(ctx, aid)
@@ -202,6 +216,11 @@ func (reg *Registry) UpdateTags(ctx context.Context, id, alias *string, tags map
 		return errors.Wrap(err, "update asset index")
 	}
 
+	err = reg.recordEvent(ctx, event.AssetTagsUpdated, asset)
+	if err != nil {
+		return err
+	}
+
 	// Revise cache
 
 	reg.cacheMu.Lock()
@@ -211,6 +230,20 @@ func (reg *Registry) UpdateTags(ctx context.Context, id, alias *string, tags map
 	return nil
 }
 
+// recordEvent records an event of the given type about a,
+// with a's annotated state as its data. Creation events are
+// recorded only once, since Define is idempotent.
+func (reg *Registry) recordEvent(ctx context.Context, typ string, a *Asset) error {
+	aa, err := Annotated(a)
+	if err != nil {
+		return errors.Wrap(err, "annotating asset")
+	}
+	if typ == event.AssetCreated {
+		return event.RecordOnce(ctx, reg.db, typ, a.AssetID.String(), aa)
+	}
+	return event.Record(ctx, reg.db, typ, a.AssetID.String(), aa)
+}
+
 // findByID retrieves an Asset record along with its signer, given an assetID.
 func (reg *Registry) findByID(ctx context.Context, id bc.AssetID) (*Asset, error) {
 	reg.cacheMu.Lock()
@@ -329,19 +362,53 @@ func assetByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Ass
 	return assetQuery(ctx, db, "assets.client_token=$1", clientToken)
 }
 
+const assetQ = `
+	SELECT assets.id, assets.alias, assets.vm_version, assets.issuance_program, assets.definition,
+		assets.initial_block_hash, assets.sort_id,
+		signers.id, COALESCE(signers.type, ''), COALESCE(signers.xpubs, '{}'),
+		COALESCE(signers.quorum, 0), COALESCE(signers.key_index, 0),
+		asset_tags.tags
+	FROM assets
+	LEFT JOIN signers ON signers.id=assets.signer_id
+	LEFT JOIN asset_tags ON asset_tags.asset_id=assets.id
+`
+
 func assetQuery(ctx context.Context, db pg.DB, pred string, args ...interface{}) (*Asset, error) {
-	const baseQ = `
-		SELECT assets.id, assets.alias, assets.vm_version, assets.issuance_program, assets.definition,
-			assets.initial_block_hash, assets.sort_id,
-			signers.id, COALESCE(signers.type, ''), COALESCE(signers.xpubs, '{}'),
-			COALESCE(signers.quorum, 0), COALESCE(signers.key_index, 0),
-			asset_tags.tags
-		FROM assets
-		LEFT JOIN signers ON signers.id=assets.signer_id
-		LEFT JOIN asset_tags ON asset_tags.asset_id=assets.id
-		WHERE %s
-		LIMIT 1
-	`
+	a, err := scanAsset(db.QueryRowContext(ctx, assetQ+"WHERE "+pred+" LIMIT 1", args...))
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetail(pg.ErrUserInputNotFound, "asset not found")
+	}
+	return a, err
+}
+
+// assetsByID loads the assets with the given IDs from the
+// database in one query, in no particular order.
+func assetsByID(ctx context.Context, db pg.DB, ids []bc.AssetID) ([]*Asset, error) {
+	var byteIDs pq.ByteaArray
+	for _, id := range ids {
+		byteIDs = append(byteIDs, id.Bytes())
+	}
+	rows, err := db.QueryContext(ctx, assetQ+"WHERE assets.id = ANY($1)", byteIDs)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer rows.Close()
+	var assets []*Asset
+	for rows.Next() {
+		a, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, errors.Wrap(rows.Err())
+}
+
+// scanAsset scans a row of assetQ. It returns sql.ErrNoRows,
+// unwrapped, if there's no row.
+func scanAsset(row interface {
+	Scan(...interface{}) error
+}) (*Asset, error) {
 	var (
 		a          Asset
 		alias      sql.NullString
@@ -352,7 +419,7 @@ func assetQuery(ctx context.Context, db pg.DB, pred string, args ...interface{})
 		xpubs      [][]byte
 		tags       []byte
 	)
-	err := db.QueryRowContext(ctx, fmt.Sprintf(baseQ, pred), args...).Scan(
+	err := row.Scan(
 		&a.AssetID,
 		&a.Alias,
 		&a.VMVersion,
@@ -368,9 +435,9 @@ func assetQuery(ctx context.Context, db pg.DB, pred string, args ...interface{})
 		&tags,
 	)
 	if err == sql.ErrNoRows {
-		return nil, pg.ErrUserInputNotFound
-	} else if err != nil {
 		return nil, err
+	} else if err != nil {
+		return nil, errors.Wrap(err)
 	}
 
 	if signerID.Valid {
@@ -7,7 +7,9 @@ import (
 	"github.com/davecgh/go-spew/spew"
 
 	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/prottest"
 	"chain/testutil"
@@ -95,3 +97,45 @@ func TestAssetByClientToken(t *testing.T) {
 		t.Fatalf("assetByClientToken(\"test_token\")=%x, want %x", found.AssetID.Bytes(), asset.AssetID.Bytes())
 	}
 }
+
+func TestUpdateTagsErrors(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	badID := "not-an-asset-id"
+	err := r.UpdateTags(ctx, &badID, nil, nil)
+	if errors.Root(err) != ErrBadAssetID {
+		t.Errorf("UpdateTags(%q) error = %v, want %v", badID, err, ErrBadAssetID)
+	}
+
+	b, err := bc.NewAssetID([32]byte{1}).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingID := string(b)
+	err = r.UpdateTags(ctx, &missingID, nil, nil)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("UpdateTags(missing ID) error = %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+
+	missingAlias := "missing"
+	err = r.UpdateTags(ctx, nil, &missingAlias, nil)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("UpdateTags(missing alias) error = %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+}
+
+func BenchmarkDefineAsset(b *testing.B) {
+	r := NewRegistry(pgtest.NewTx(b), prottest.NewChain(b), nil)
+	ctx := context.Background()
+	keys := []chainkd.XPub{testutil.TestXPub}
+	def := map[string]interface{}{"currency": "USD"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := r.Define(ctx, keys, 1, def, "", nil, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
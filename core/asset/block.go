@@ -20,12 +20,13 @@ import (
 // associated with the asset block processor.
 const PinName = "asset"
 
-// A Saver is responsible for saving an annotated asset object
+// A Saver is responsible for saving annotated asset objects
 // for indexing and retrieval.
 // If the Core is configured not to provide search services,
-// SaveAnnotatedAsset can be a no-op.
+// its methods can be no-ops.
 type Saver interface {
 	SaveAnnotatedAsset(context.Context, *query.AnnotatedAsset, string) error
+	SaveAnnotatedAssets(context.Context, []*query.AnnotatedAsset, []string) error
 }
 
 func Annotated(a *Asset) (*query.AnnotatedAsset, error) {
@@ -54,6 +55,7 @@ func Annotated(a *Asset) (*query.AnnotatedAsset, error) {
 	if a.Alias != nil {
 		aa.Alias = *a.Alias
 	}
+	AnnotatePrecision(aa)
 	if a.Signer != nil {
 		path := signers.Path(a.Signer, signers.AssetKeySpace)
 		var jsonPath []chainjson.HexBytes
@@ -167,16 +169,25 @@ func (reg *Registry) indexAssets(ctx context.Context, b *legacy.Block) error {
 
 	// newAssetIDs now contains only the asset IDs of new, non-local
 	// assets. We need to index them as annotated assets too.
-	for _, assetID := range newAssetIDs {
-		// TODO(jackson): Batch the asset lookups.
-		a, err := reg.findByID(ctx, assetID)
-		if err != nil {
-			return errors.Wrap(err, "looking up new asset")
-		}
-		err = reg.indexAnnotatedAsset(ctx, a)
+	if len(newAssetIDs) == 0 {
+		return nil
+	}
+	assets, err := assetsByID(ctx, reg.db, newAssetIDs)
+	if err != nil {
+		return errors.Wrap(err, "looking up new assets")
+	}
+	var (
+		annotated = make([]*query.AnnotatedAsset, 0, len(assets))
+		sortIDs   = make([]string, 0, len(assets))
+	)
+	for _, a := range assets {
+		aa, err := Annotated(a)
 		if err != nil {
-			return errors.Wrap(err, "indexing annotated asset")
+			return errors.Wrap(err, "annotating new asset")
 		}
+		annotated = append(annotated, aa)
+		sortIDs = append(sortIDs, a.sortID)
 	}
-	return nil
+	err = reg.indexer.SaveAnnotatedAssets(ctx, annotated, sortIDs)
+	return errors.Wrap(err, "indexing annotated assets")
 }
@@ -27,6 +27,16 @@ func (f fakeSaver) SaveAnnotatedAsset(ctx context.Context, aa *query.AnnotatedAs
 	return f(ctx, aa, sortID)
 }
 
+func (f fakeSaver) SaveAnnotatedAssets(ctx context.Context, aas []*query.AnnotatedAsset, sortIDs []string) error {
+	for i, aa := range aas {
+		err := f(ctx, aa, sortIDs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func TestIndexNonLocalAssets(t *testing.T) {
 	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
 	ctx := context.Background()
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"chain/core/freeze"
 	"chain/core/signers"
 	"chain/core/txbuilder"
 	"chain/database/pg"
@@ -47,6 +48,10 @@ func (a *issueAction) Build(ctx context.Context, builder *txbuilder.TemplateBuil
 	if err != nil {
 		return err
 	}
+	err = freeze.CheckAsset(ctx, a.assets.db, *a.AssetId)
+	if err != nil {
+		return err
+	}
 
 	var nonce [8]byte
 	_, err = rand.Read(nonce[:])
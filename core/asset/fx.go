@@ -0,0 +1,148 @@
+package asset
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// PricingCurrencyKey is the asset definition field in which an
+// asset declares the ISO 4217 code of the currency it is
+// priced in, such as "USD".
+const PricingCurrencyKey = "pricing_currency"
+
+var (
+	// ErrBadCurrency is returned for a currency that isn't a
+	// three-letter ISO 4217 code, or that doesn't match the
+	// asset's pricing currency.
+	ErrBadCurrency = errors.New("invalid currency")
+
+	// ErrBadRate is returned for an exchange rate that isn't a
+	// positive decimal number.
+	ErrBadRate = errors.New("exchange rate must be a positive decimal number")
+
+	currencyRE = regexp.MustCompile(`^[A-Z]{3}$`)
+	rateRE     = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+	zeroRateRE = regexp.MustCompile(`^[0.]+$`)
+)
+
+// FXSnapshot records the exchange rate at which an issuance
+// of an asset is valued.
+//
+// Rate is the value of one unit of the asset in Currency, and
+// Value is Amount times Rate. Both are decimal strings, so
+// they are exact.
+type FXSnapshot struct {
+	TransactionID bc.Hash    `json:"transaction_id"`
+	AssetID       bc.AssetID `json:"asset_id"`
+	Amount        uint64     `json:"amount"`
+	Currency      string     `json:"currency"`
+	Rate          string     `json:"rate"`
+	Value         string     `json:"value"`
+	AsOf          time.Time  `json:"as_of"`
+}
+
+// PricingCurrency returns the pricing currency declared in the
+// asset's definition, or "" if it doesn't declare one.
+func (asset *Asset) PricingCurrency() (string, error) {
+	def, err := asset.Definition()
+	if err != nil {
+		return "", err
+	}
+	return pricingCurrency(def)
+}
+
+func pricingCurrency(def map[string]interface{}) (string, error) {
+	v, ok := def[PricingCurrencyKey]
+	if !ok {
+		return "", nil
+	}
+	c, ok := v.(string)
+	if !ok || !currencyRE.MatchString(c) {
+		return "", errors.WithDetailf(ErrBadCurrency, "%s must be a three-letter ISO 4217 code", PricingCurrencyKey)
+	}
+	return c, nil
+}
+
+// RecordFXSnapshot records the exchange rate at which amount
+// of the asset issued in transaction txID is valued. If the
+// asset declares a pricing currency, currency may be empty and
+// defaults to it; otherwise it must match. Recording a
+// snapshot again for the same issuance replaces it.
+func (reg *Registry) RecordFXSnapshot(ctx context.Context, txID bc.Hash, assetID bc.AssetID, amount uint64, currency, rate string, asOf time.Time) (*FXSnapshot, error) {
+	asset, err := reg.findByID(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	declared, err := asset.PricingCurrency()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case currency == "" && declared == "":
+		return nil, errors.WithDetail(ErrBadCurrency, "a currency is required for assets without a pricing currency")
+	case currency == "":
+		currency = declared
+	case !currencyRE.MatchString(currency):
+		return nil, errors.WithDetailf(ErrBadCurrency, "currency %q must be a three-letter ISO 4217 code", currency)
+	case declared != "" && currency != declared:
+		return nil, errors.WithDetailf(ErrBadCurrency, "asset is priced in %s, not %s", declared, currency)
+	}
+	if !rateRE.MatchString(rate) || zeroRateRE.MatchString(rate) {
+		return nil, errors.WithDetailf(ErrBadRate, "invalid rate %q", rate)
+	}
+
+	const q = `
+		INSERT INTO issuance_fx_snapshots (tx_hash, asset_id, amount, currency, rate, as_of)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tx_hash, asset_id) DO UPDATE SET
+			amount = excluded.amount,
+			currency = excluded.currency,
+			rate = excluded.rate,
+			as_of = excluded.as_of
+		RETURNING rate::text, (amount * rate)::text
+	`
+	snap := &FXSnapshot{
+		TransactionID: txID,
+		AssetID:       asset.AssetID,
+		Amount:        amount,
+		Currency:      currency,
+		AsOf:          asOf,
+	}
+	err = reg.db.QueryRowContext(ctx, q, txID, asset.AssetID, int64(amount), currency, rate, asOf).Scan(&snap.Rate, &snap.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "recording fx snapshot")
+	}
+	return snap, nil
+}
+
+// FXSnapshots returns the snapshots recorded for issuances of
+// the asset in the time range [start, end), oldest first.
+func (reg *Registry) FXSnapshots(ctx context.Context, assetID bc.AssetID, start, end time.Time) ([]*FXSnapshot, error) {
+	const q = `
+		SELECT tx_hash, amount, currency, rate::text, (amount * rate)::text, as_of
+		FROM issuance_fx_snapshots
+		WHERE asset_id = $1 AND as_of >= $2 AND as_of < $3
+		ORDER BY as_of, tx_hash
+	`
+	var snaps []*FXSnapshot
+	err := pg.ForQueryRows(ctx, reg.db, q, assetID, start, end, func(txID bc.Hash, amount int64, currency, rate, value string, asOf time.Time) {
+		snaps = append(snaps, &FXSnapshot{
+			TransactionID: txID,
+			AssetID:       assetID,
+			Amount:        uint64(amount),
+			Currency:      currency,
+			Rate:          rate,
+			Value:         value,
+			AsOf:          asOf,
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading fx snapshots")
+	}
+	return snaps, nil
+}
@@ -0,0 +1,31 @@
+package asset
+
+import (
+	"testing"
+
+	"chain/errors"
+)
+
+func TestPricingCurrency(t *testing.T) {
+	cases := []struct {
+		def     map[string]interface{}
+		want    string
+		wantErr error
+	}{
+		{def: map[string]interface{}{}, want: ""},
+		{def: map[string]interface{}{"pricing_currency": "USD"}, want: "USD"},
+		{def: map[string]interface{}{"pricing_currency": "usd"}, wantErr: ErrBadCurrency},
+		{def: map[string]interface{}{"pricing_currency": "USDT"}, wantErr: ErrBadCurrency},
+		{def: map[string]interface{}{"pricing_currency": 840}, wantErr: ErrBadCurrency},
+	}
+	for _, c := range cases {
+		got, err := pricingCurrency(c.def)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("pricingCurrency(%v) error = %v, want %v", c.def, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("pricingCurrency(%v) = %q, want %q", c.def, got, c.want)
+		}
+	}
+}
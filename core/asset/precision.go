@@ -0,0 +1,155 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"chain/core/query"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Asset definition fields describing how amounts of an asset
+// are displayed. Amounts on the blockchain are integers of the
+// asset's smallest unit; an asset declaring 2 decimals means
+// an amount of 100 is 1.00 of its unit, such as "USD".
+const (
+	DecimalsKey = "decimals"
+	UnitKey     = "unit"
+)
+
+// maxDecimals is the most decimal places an asset may declare.
+// Larger values can't divide any uint64 amount into units.
+const maxDecimals = 18
+
+var (
+	// ErrBadPrecision is returned for an asset definition
+	// with invalid decimals or unit fields.
+	ErrBadPrecision = errors.New("invalid asset precision")
+
+	// ErrBadDecimalAmount is returned for a decimal amount
+	// that isn't a valid amount of its asset.
+	ErrBadDecimalAmount = errors.New("invalid decimal amount")
+)
+
+// Precision returns the number of decimal places and the unit
+// declared in the asset's definition. If it declares no
+// decimals, ok is false.
+func (asset *Asset) Precision() (decimals int, unit string, ok bool, err error) {
+	def, err := asset.Definition()
+	if err != nil {
+		return 0, "", false, err
+	}
+	return precision(def)
+}
+
+func precision(def map[string]interface{}) (decimals int, unit string, ok bool, err error) {
+	if v, has := def[UnitKey]; has {
+		unit, _ = v.(string)
+		if unit == "" {
+			return 0, "", false, errors.WithDetailf(ErrBadPrecision, "%s must be a non-empty string", UnitKey)
+		}
+	}
+	v, has := def[DecimalsKey]
+	if !has {
+		return 0, unit, false, nil
+	}
+	var f float64
+	switch n := v.(type) {
+	case json.Number:
+		f, err = n.Float64()
+	case float64:
+		f = n
+	default:
+		err = ErrBadPrecision
+	}
+	if err != nil || f != math.Trunc(f) || f < 0 || f > maxDecimals {
+		return 0, "", false, errors.WithDetailf(ErrBadPrecision, "%s must be an integer from 0 to %d", DecimalsKey, maxDecimals)
+	}
+	return int(f), unit, true, nil
+}
+
+// AnnotatePrecision sets the decimals and unit of aa from its
+// definition. Definitions on the blockchain are untrusted, so
+// invalid fields are ignored.
+func AnnotatePrecision(aa *query.AnnotatedAsset) {
+	if aa.Definition == nil {
+		return
+	}
+	var def map[string]interface{}
+	if json.Unmarshal(*aa.Definition, &def) != nil {
+		return
+	}
+	decimals, unit, ok, err := precision(def)
+	if err != nil {
+		return
+	}
+	if ok {
+		aa.Decimals = &decimals
+	}
+	aa.Unit = unit
+}
+
+// ParseAmount converts s, a decimal amount such as "1.25", to
+// an integer amount of an asset with the given number of
+// decimal places. It fails if s has more decimal places than
+// the asset allows.
+func ParseAmount(s string, decimals int) (uint64, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+		if frac == "" {
+			return 0, errors.WithDetailf(ErrBadDecimalAmount, "invalid amount %q", s)
+		}
+	}
+	if whole == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "invalid amount %q", s)
+	}
+	if len(frac) > decimals {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "amount %q has more than %d decimal places", s, decimals)
+	}
+	digits := strings.TrimLeft(whole+frac+strings.Repeat("0", decimals-len(frac)), "0")
+	if digits == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(digits, 10, 63)
+	if err != nil {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "amount %q is too large", s)
+	}
+	return n, nil
+}
+
+// FormatAmount converts n, an integer amount of an asset
+// with the given number of decimal places, to a decimal
+// amount such as "1.25". It is the inverse of ParseAmount.
+func FormatAmount(n uint64, decimals int) string {
+	s := strconv.FormatUint(n, 10)
+	if decimals <= 0 {
+		return s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// DecimalAmount converts s, a decimal amount of the asset with
+// the given ID, to an integer amount using the decimals
+// declared in the asset's definition.
+func (reg *Registry) DecimalAmount(ctx context.Context, assetID bc.AssetID, s string) (uint64, error) {
+	asset, err := reg.findByID(ctx, assetID)
+	if err != nil {
+		return 0, err
+	}
+	decimals, _, ok, err := asset.Precision()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "asset %s declares no %s", assetID.String(), DecimalsKey)
+	}
+	return ParseAmount(s, decimals)
+}
@@ -0,0 +1,89 @@
+package asset
+
+import (
+	"encoding/json"
+	"testing"
+
+	"chain/errors"
+)
+
+func TestPrecision(t *testing.T) {
+	cases := []struct {
+		def      map[string]interface{}
+		decimals int
+		unit     string
+		ok       bool
+		err      error
+	}{
+		{map[string]interface{}{}, 0, "", false, nil},
+		{map[string]interface{}{"decimals": json.Number("2"), "unit": "USD"}, 2, "USD", true, nil},
+		{map[string]interface{}{"decimals": float64(0)}, 0, "", true, nil},
+		{map[string]interface{}{"decimals": json.Number("1.5")}, 0, "", false, ErrBadPrecision},
+		{map[string]interface{}{"decimals": float64(19)}, 0, "", false, ErrBadPrecision},
+		{map[string]interface{}{"decimals": "2"}, 0, "", false, ErrBadPrecision},
+		{map[string]interface{}{"unit": ""}, 0, "", false, ErrBadPrecision},
+	}
+	for _, c := range cases {
+		decimals, unit, ok, err := precision(c.def)
+		if errors.Root(err) != c.err {
+			t.Errorf("precision(%v) error = %v, want %v", c.def, err, c.err)
+			continue
+		}
+		if decimals != c.decimals || unit != c.unit || ok != c.ok {
+			t.Errorf("precision(%v) = %d, %q, %v, want %d, %q, %v", c.def, decimals, unit, ok, c.decimals, c.unit, c.ok)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		s        string
+		decimals int
+		want     uint64
+		err      error
+	}{
+		{"1.25", 2, 125, nil},
+		{"1.2", 2, 120, nil},
+		{"1", 2, 100, nil},
+		{"0.00", 2, 0, nil},
+		{"007", 0, 7, nil},
+		{"1.255", 2, 0, ErrBadDecimalAmount},
+		{"1.", 2, 0, ErrBadDecimalAmount},
+		{".5", 2, 0, ErrBadDecimalAmount},
+		{"-1", 2, 0, ErrBadDecimalAmount},
+		{"1e3", 2, 0, ErrBadDecimalAmount},
+		{"10000000000000000000", 0, 0, ErrBadDecimalAmount},
+	}
+	for _, c := range cases {
+		got, err := ParseAmount(c.s, c.decimals)
+		if errors.Root(err) != c.err {
+			t.Errorf("ParseAmount(%q, %d) error = %v, want %v", c.s, c.decimals, err, c.err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseAmount(%q, %d) = %d, want %d", c.s, c.decimals, got, c.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	cases := []struct {
+		n        uint64
+		decimals int
+		want     string
+	}{
+		{125, 2, "1.25"},
+		{5, 2, "0.05"},
+		{0, 2, "0.00"},
+		{7, 0, "7"},
+	}
+	for _, c := range cases {
+		got := FormatAmount(c.n, c.decimals)
+		if got != c.want {
+			t.Errorf("FormatAmount(%d, %d) = %q, want %q", c.n, c.decimals, got, c.want)
+		}
+		if back, err := ParseAmount(got, c.decimals); err != nil || back != c.n {
+			t.Errorf("ParseAmount(%q, %d) = %d, %v, want %d", got, c.decimals, back, err, c.n)
+		}
+	}
+}
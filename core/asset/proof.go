@@ -0,0 +1,73 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+
+	"golang.org/x/crypto/sha3"
+
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrDefinitionMismatch is returned by DefinitionProof.Verify
+// when a proof's definition isn't the one committed to by its
+// asset ID.
+var ErrDefinitionMismatch = errors.New("asset definition does not match asset ID")
+
+// DefinitionProof shows that an asset definition is the one
+// committed to on the blockchain. An asset ID is the hash of
+// the asset's issuance program, VM version, initial block
+// hash and the SHA3-256 hash of its definition, and every
+// issuance carries the definition, which validation checks
+// against the asset ID. So anyone can check a proof with
+// Verify, without trusting the core that produced it.
+type DefinitionProof struct {
+	AssetID          bc.AssetID         `json:"asset_id"`
+	Definition       *json.RawMessage   `json:"definition"`
+	RawDefinition    chainjson.HexBytes `json:"raw_definition"`
+	DefinitionHash   bc.Hash            `json:"definition_hash"`
+	IssuanceProgram  chainjson.HexBytes `json:"issuance_program"`
+	VMVersion        uint64             `json:"vm_version"`
+	InitialBlockHash bc.Hash            `json:"initial_block_hash"`
+}
+
+// DefinitionProof returns a proof of the definition of the
+// asset with the given ID.
+func (reg *Registry) DefinitionProof(ctx context.Context, id bc.AssetID) (*DefinitionProof, error) {
+	a, err := reg.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	raw := a.RawDefinition()
+	p := &DefinitionProof{
+		AssetID:          a.AssetID,
+		RawDefinition:    raw,
+		DefinitionHash:   bc.NewHash(sha3.Sum256(raw)),
+		IssuanceProgram:  a.IssuanceProgram,
+		VMVersion:        a.VMVersion,
+		InitialBlockHash: a.InitialBlockHash,
+	}
+	// The raw definition is untrusted and may not be valid JSON.
+	if pg.IsValidJSONB(raw) {
+		def := json.RawMessage(raw)
+		p.Definition = &def
+	}
+	return p, nil
+}
+
+// Verify checks that p's raw definition is the one committed
+// to by its asset ID. It returns ErrDefinitionMismatch if not.
+func (p *DefinitionProof) Verify() error {
+	h := bc.NewHash(sha3.Sum256(p.RawDefinition))
+	if h != p.DefinitionHash {
+		return errors.WithDetail(ErrDefinitionMismatch, "definition_hash is not the hash of raw_definition")
+	}
+	id := bc.ComputeAssetID(p.IssuanceProgram, &p.InitialBlockHash, p.VMVersion, &h)
+	if id != p.AssetID {
+		return errors.WithDetail(ErrDefinitionMismatch, "asset_id does not commit to raw_definition")
+	}
+	return nil
+}
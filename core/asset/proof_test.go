@@ -0,0 +1,43 @@
+package asset
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+)
+
+func TestDefinitionProofVerify(t *testing.T) {
+	raw := []byte(`{"currency":"USD"}`)
+	prog := []byte{byte(vm.OP_TRUE)}
+	initial := bc.NewHash([32]byte{1})
+	h := bc.NewHash(sha3.Sum256(raw))
+	p := &DefinitionProof{
+		AssetID:          bc.ComputeAssetID(prog, &initial, 1, &h),
+		RawDefinition:    raw,
+		DefinitionHash:   h,
+		IssuanceProgram:  prog,
+		VMVersion:        1,
+		InitialBlockHash: initial,
+	}
+	err := p.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Altering the definition, even with a matching hash,
+	// must not verify.
+	p.RawDefinition = []byte(`{"currency":"EUR"}`)
+	err = p.Verify()
+	if errors.Root(err) != ErrDefinitionMismatch {
+		t.Errorf("altered definition: got error %v, want %v", err, ErrDefinitionMismatch)
+	}
+	p.DefinitionHash = bc.NewHash(sha3.Sum256(p.RawDefinition))
+	err = p.Verify()
+	if errors.Root(err) != ErrDefinitionMismatch {
+		t.Errorf("altered definition and hash: got error %v, want %v", err, ErrDefinitionMismatch)
+	}
+}
@@ -0,0 +1,433 @@
+package asset
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/protocol/vm/vmutil"
+)
+
+// StatsPinName is used to identify the pin
+// associated with the asset stats block processor.
+const StatsPinName = "asset_stats"
+
+// Stats intervals.
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// ErrBadInterval is returned by Stats for an unknown interval.
+var ErrBadInterval = errors.New("interval must be hour or day")
+
+// Volume describes the activity of an asset during one
+// interval of time.
+//
+// Issued is the total amount issued, Transferred is the total
+// amount spent from existing outputs, and Retired is the total
+// amount retired.
+type Volume struct {
+	Time        time.Time `json:"time"`
+	Issued      uint64    `json:"issued"`
+	Transferred uint64    `json:"transferred"`
+	Retired     uint64    `json:"retired"`
+}
+
+// CreateStatsPin creates the stats pin, if it doesn't already
+// exist, just before the first block the core stores. That's
+// the initial block unless the core was bootstrapped from a
+// snapshot, so the stats cover the whole chain rather than
+// only the blocks that arrive after the pin is created.
+func (reg *Registry) CreateStatsPin(ctx context.Context) error {
+	if reg.pinStore == nil {
+		return nil
+	}
+	var first uint64
+	err := reg.db.QueryRowContext(ctx, `SELECT COALESCE(MIN(height), 1) FROM blocks`).Scan(&first)
+	if err != nil {
+		return errors.Wrap(err, "finding first block")
+	}
+	return reg.pinStore.CreatePin(ctx, StatsPinName, first-1)
+}
+
+// ProcessStats rolls up the activity of every asset in each
+// block into the asset_stats table, which is read by Stats,
+// starting where CreateStatsPin put the stats pin.
+func (reg *Registry) ProcessStats(ctx context.Context) {
+	if reg.pinStore == nil {
+		return
+	}
+	reg.pinStore.ProcessBlocks(ctx, reg.chain, StatsPinName, reg.rollUpStats)
+}
+
+func (reg *Registry) rollUpStats(ctx context.Context, b *legacy.Block) error {
+	vols := blockVolumes(b)
+	if len(vols) == 0 {
+		return nil
+	}
+
+	var (
+		assetIDs    pq.ByteaArray
+		issued      pq.StringArray
+		transferred pq.StringArray
+		retired     pq.StringArray
+	)
+	for _, v := range vols {
+		assetIDs = append(assetIDs, v.assetID.Bytes())
+		issued = append(issued, strconv.FormatUint(v.issued, 10))
+		transferred = append(transferred, strconv.FormatUint(v.transferred, 10))
+		retired = append(retired, strconv.FormatUint(v.retired, 10))
+	}
+
+	// A block may be processed more than once, so each block is
+	// recorded in asset_stats_blocks in the same statement that
+	// adds its volumes, and only added if it wasn't there already.
+	// The same statement adds them to the running totals in
+	// asset_circulation, so the two tables change together.
+	const q = `
+		WITH new_block AS (
+			INSERT INTO asset_stats_blocks (height) VALUES ($1)
+			ON CONFLICT (height) DO NOTHING
+			RETURNING height
+		), vols AS (
+			SELECT * FROM unnest($3::bytea[], $4::numeric[], $5::numeric[], $6::numeric[])
+				AS t(asset_id, issued, transferred, retired)
+			WHERE EXISTS (SELECT 1 FROM new_block)
+		), hourly AS (
+			INSERT INTO asset_stats (asset_id, hour, issued, transferred, retired)
+			SELECT asset_id, $2, issued, transferred, retired FROM vols
+			ON CONFLICT (asset_id, hour) DO UPDATE SET
+				issued = asset_stats.issued + excluded.issued,
+				transferred = asset_stats.transferred + excluded.transferred,
+				retired = asset_stats.retired + excluded.retired
+		)
+		INSERT INTO asset_circulation (asset_id, issued, transferred, retired)
+		SELECT asset_id, issued, transferred, retired FROM vols
+		ON CONFLICT (asset_id) DO UPDATE SET
+			issued = asset_circulation.issued + excluded.issued,
+			transferred = asset_circulation.transferred + excluded.transferred,
+			retired = asset_circulation.retired + excluded.retired
+	`
+	_, err := reg.db.ExecContext(ctx, q, b.Height, b.Time().UTC().Truncate(time.Hour), assetIDs, issued, transferred, retired)
+	return errors.Wrap(err, "rolling up asset stats")
+}
+
+// ReconcileCirculation repairs drift between the running
+// totals in asset_circulation and the ledger, once when it
+// starts and then once per period until ctx is done. It should
+// run only on the leader.
+func (reg *Registry) ReconcileCirculation(ctx context.Context, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		repaired, err := RepairCirculation(ctx, reg.db)
+		if err != nil {
+			log.Error(ctx, err, "reconciling asset circulation")
+		}
+		for _, assetID := range repaired {
+			log.Printkv(ctx, "at", "repaired asset circulation", "asset_id", assetID.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, ReconcileCirculation exiting")
+			return
+		case <-ticks:
+		}
+	}
+}
+
+// maxRepairAttempts bounds how many times RepairCirculation
+// catches up with the blocks being rolled up while it runs.
+const maxRepairAttempts = 3
+
+// reconcileBatchSize is the number of blocks RepairCirculation
+// reads at a time.
+const reconcileBatchSize = 100
+
+// errRepairRaced is returned by RepairCirculation when blocks
+// kept being rolled up while it caught up with them.
+var errRepairRaced = errors.New("blocks were rolled up while reconciling; try again")
+
+// RepairCirculation corrects the running totals of each
+// asset that differ from the amounts issued, spent and
+// retired in the blocks they count, returning the assets it
+// corrected. ReconcileCirculation calls it periodically;
+// operators can also run it on demand.
+//
+// The amounts in the blocks are kept in asset_ledger_totals,
+// separately from asset_circulation. Each run adds only the
+// blocks rolled up since the last one, marking them reconciled
+// in asset_stats_blocks, so it reads each block once. The
+// totals are summed in SQL numeric, so they can't overflow.
+// The drift is applied as an adjustment, rather than
+// overwriting the running totals, so a block rolled up
+// concurrently isn't lost. It's only applied once every rolled
+// up block has been reconciled; otherwise it catches up again.
+func RepairCirculation(ctx context.Context, db pg.DB) ([]bc.AssetID, error) {
+	for i := 0; i < maxRepairAttempts; i++ {
+		err := addLedgerVolumes(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		repaired, applied, err := applyCirculationDrift(ctx, db)
+		if err != nil || applied {
+			return repaired, err
+		}
+	}
+	return nil, errors.Wrap(errRepairRaced)
+}
+
+// addLedgerVolumes adds the volumes of each rolled up block
+// that hasn't been reconciled yet to asset_ledger_totals.
+func addLedgerVolumes(ctx context.Context, db pg.DB) error {
+	const q = `
+		SELECT b.data FROM blocks b
+		JOIN asset_stats_blocks s ON s.height = b.height
+		WHERE NOT s.reconciled
+		ORDER BY b.height LIMIT $1
+	`
+	for {
+		var blocks []legacy.Block
+		err := pg.ForQueryRows(ctx, db, q, reconcileBatchSize, func(b legacy.Block) {
+			blocks = append(blocks, b)
+		})
+		if err != nil {
+			return errors.Wrap(err, "reading unreconciled blocks")
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		err = addBlockVolumes(ctx, db, blocks)
+		if err != nil {
+			return err
+		}
+		if len(blocks) < reconcileBatchSize {
+			return nil
+		}
+	}
+}
+
+// addBlockVolumes marks blocks reconciled and adds their
+// volumes to asset_ledger_totals, in one statement, skipping
+// any block another run reconciled first.
+func addBlockVolumes(ctx context.Context, db pg.DB, blocks []legacy.Block) error {
+	var (
+		heights     pq.Int64Array
+		blockHeight pq.Int64Array
+		assetIDs    pq.ByteaArray
+		issued      pq.StringArray
+		transferred pq.StringArray
+		retired     pq.StringArray
+	)
+	for i := range blocks {
+		b := &blocks[i]
+		heights = append(heights, int64(b.Height))
+		for _, v := range blockVolumes(b) {
+			blockHeight = append(blockHeight, int64(b.Height))
+			assetIDs = append(assetIDs, v.assetID.Bytes())
+			issued = append(issued, strconv.FormatUint(v.issued, 10))
+			transferred = append(transferred, strconv.FormatUint(v.transferred, 10))
+			retired = append(retired, strconv.FormatUint(v.retired, 10))
+		}
+	}
+
+	const q = `
+		WITH counted AS (
+			UPDATE asset_stats_blocks SET reconciled = true
+			WHERE height = ANY($1) AND NOT reconciled
+			RETURNING height
+		), vols AS (
+			SELECT asset_id, sum(issued) AS issued, sum(transferred) AS transferred, sum(retired) AS retired
+			FROM unnest($2::bigint[], $3::bytea[], $4::numeric[], $5::numeric[], $6::numeric[])
+				AS t(height, asset_id, issued, transferred, retired)
+			WHERE height IN (SELECT height FROM counted)
+			GROUP BY asset_id
+		)
+		INSERT INTO asset_ledger_totals (asset_id, issued, transferred, retired)
+		SELECT asset_id, issued, transferred, retired FROM vols
+		ON CONFLICT (asset_id) DO UPDATE SET
+			issued = asset_ledger_totals.issued + excluded.issued,
+			transferred = asset_ledger_totals.transferred + excluded.transferred,
+			retired = asset_ledger_totals.retired + excluded.retired
+	`
+	_, err := db.ExecContext(ctx, q, heights, blockHeight, assetIDs, issued, transferred, retired)
+	return errors.Wrap(err, "adding ledger volumes")
+}
+
+// applyCirculationDrift adjusts asset_circulation to match
+// asset_ledger_totals. It reports whether every rolled up
+// block had been reconciled, and so whether it applied the
+// adjustment.
+func applyCirculationDrift(ctx context.Context, db pg.DB) ([]bc.AssetID, bool, error) {
+	// The drift is computed from one snapshot of
+	// asset_stats_blocks, asset_ledger_totals and
+	// asset_circulation, and only if that snapshot has no
+	// unreconciled blocks.
+	const q = `
+		WITH ready AS (
+			SELECT NOT EXISTS (SELECT 1 FROM asset_stats_blocks WHERE NOT reconciled) AS ok
+		), drift AS (
+			SELECT COALESCE(l.asset_id, c.asset_id) AS asset_id,
+				COALESCE(l.issued, 0) - COALESCE(c.issued, 0) AS issued,
+				COALESCE(l.transferred, 0) - COALESCE(c.transferred, 0) AS transferred,
+				COALESCE(l.retired, 0) - COALESCE(c.retired, 0) AS retired
+			FROM asset_ledger_totals l FULL JOIN asset_circulation c ON c.asset_id = l.asset_id
+			WHERE (SELECT ok FROM ready)
+		), repaired AS (
+			INSERT INTO asset_circulation (asset_id, issued, transferred, retired)
+			SELECT asset_id, issued, transferred, retired FROM drift
+			WHERE (issued, transferred, retired) <> (0, 0, 0)
+			ON CONFLICT (asset_id) DO UPDATE SET
+				issued = asset_circulation.issued + excluded.issued,
+				transferred = asset_circulation.transferred + excluded.transferred,
+				retired = asset_circulation.retired + excluded.retired
+			RETURNING asset_id
+		)
+		SELECT (SELECT ok FROM ready), COALESCE((SELECT array_agg(asset_id) FROM repaired), '{}')
+	`
+	var (
+		applied bool
+		ids     pq.ByteaArray
+	)
+	err := db.QueryRowContext(ctx, q).Scan(&applied, &ids)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "reconciling asset circulation")
+	}
+	var repaired []bc.AssetID
+	for _, id := range ids {
+		var assetID bc.AssetID
+		err = assetID.Scan(id)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "scanning repaired asset")
+		}
+		repaired = append(repaired, assetID)
+	}
+	return repaired, applied, nil
+}
+
+type assetVolume struct {
+	assetID     bc.AssetID
+	issued      uint64
+	transferred uint64
+	retired     uint64
+}
+
+// blockVolumes totals the amounts of each asset issued,
+// spent and retired in b, in order of first appearance.
+func blockVolumes(b *legacy.Block) []*assetVolume {
+	var (
+		vols  []*assetVolume
+		index = make(map[bc.AssetID]*assetVolume)
+	)
+	get := func(assetID bc.AssetID) *assetVolume {
+		v, ok := index[assetID]
+		if !ok {
+			v = &assetVolume{assetID: assetID}
+			index[assetID] = v
+			vols = append(vols, v)
+		}
+		return v
+	}
+	for _, tx := range b.Transactions {
+		for _, in := range tx.Inputs {
+			v := get(in.AssetID())
+			if in.IsIssuance() {
+				v.issued += in.Amount()
+			} else {
+				v.transferred += in.Amount()
+			}
+		}
+		for _, out := range tx.Outputs {
+			if vmutil.IsUnspendable(out.ControlProgram) {
+				get(*out.AssetId).retired += out.Amount
+			}
+		}
+	}
+	return vols
+}
+
+// Stats returns the volumes of the asset for each hour or day
+// in the time range [start, end), oldest first. Intervals with
+// no activity are omitted.
+func (reg *Registry) Stats(ctx context.Context, assetID bc.AssetID, interval string, start, end time.Time) ([]*Volume, error) {
+	if interval != IntervalHour && interval != IntervalDay {
+		return nil, errors.WithDetailf(ErrBadInterval, "unknown interval %q", interval)
+	}
+	const q = `
+		SELECT date_trunc($2, hour AT TIME ZONE 'UTC'),
+			sum(issued), sum(transferred), sum(retired)
+		FROM asset_stats
+		WHERE asset_id = $1 AND hour >= $3 AND hour < $4
+		GROUP BY 1 ORDER BY 1
+	`
+	var vols []*Volume
+	err := pg.ForQueryRows(ctx, reg.db, q, assetID, interval, start, end,
+		func(t time.Time, issued, transferred, retired uint64) {
+			vols = append(vols, &Volume{
+				Time:        time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.UTC),
+				Issued:      issued,
+				Transferred: transferred,
+				Retired:     retired,
+			})
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying asset stats")
+	}
+	return vols, nil
+}
+
+// BalanceSheetEntry summarizes the supply of an asset created
+// by this core. Outstanding is the amount issued and not yet
+// retired, and HeldByIssuer is the part of it held in this
+// core's accounts. Issued and retired amounts are read from
+// the running totals in asset_circulation, which cover the
+// same blocks as Stats.
+type BalanceSheetEntry struct {
+	AssetID      bc.AssetID `json:"asset_id"`
+	AssetAlias   string     `json:"asset_alias,omitempty"`
+	Issued       uint64     `json:"issued"`
+	Retired      uint64     `json:"retired"`
+	Outstanding  uint64     `json:"outstanding"`
+	HeldByIssuer uint64     `json:"held_by_issuer"`
+}
+
+// BalanceSheet returns a balance sheet entry for each asset
+// created by this core, in the order they were created.
+func (reg *Registry) BalanceSheet(ctx context.Context) ([]*BalanceSheetEntry, error) {
+	const q = `
+		SELECT a.id, COALESCE(a.alias, ''), COALESCE(s.issued, 0), COALESCE(s.retired, 0), COALESCE(u.held, 0)
+		FROM assets a
+		LEFT JOIN asset_circulation s ON s.asset_id = a.id
+		LEFT JOIN (
+			SELECT asset_id, sum(amount) AS held
+			FROM account_utxos GROUP BY asset_id
+		) u ON u.asset_id = a.id
+		ORDER BY a.sort_id
+	`
+	var entries []*BalanceSheetEntry
+	err := pg.ForQueryRows(ctx, reg.db, q, func(assetID bc.AssetID, alias string, issued, retired, held uint64) {
+		e := &BalanceSheetEntry{
+			AssetID:      assetID,
+			AssetAlias:   alias,
+			Issued:       issued,
+			Retired:      retired,
+			HeldByIssuer: held,
+		}
+		if issued > retired {
+			e.Outstanding = issued - retired
+		}
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying balance sheet")
+	}
+	return entries, nil
+}
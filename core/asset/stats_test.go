@@ -0,0 +1,218 @@
+package asset
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"chain/core/pin"
+	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/protocol/prottest"
+	"chain/protocol/vm"
+	"chain/testutil"
+)
+
+func TestBlockVolumes(t *testing.T) {
+	issuanceProgram := []byte{byte(vm.OP_TRUE)}
+	issue := legacy.NewIssuanceInput(nil, 100, nil, bc.Hash{}, issuanceProgram, nil, nil)
+	issuedAsset := issue.AssetID()
+	otherAsset := bc.NewAssetID([32]byte{2})
+
+	b := &legacy.Block{
+		Transactions: []*legacy.Tx{
+			legacy.NewTx(legacy.TxData{
+				Version: 1,
+				Inputs:  []*legacy.TxInput{issue},
+				Outputs: []*legacy.TxOutput{
+					legacy.NewTxOutput(issuedAsset, 90, []byte{byte(vm.OP_TRUE)}, nil),
+					legacy.NewTxOutput(issuedAsset, 10, []byte{byte(vm.OP_FAIL)}, nil),
+				},
+			}),
+			legacy.NewTx(legacy.TxData{
+				Version: 1,
+				Inputs: []*legacy.TxInput{
+					legacy.NewSpendInput(nil, bc.Hash{}, otherAsset, 7, 0, nil, bc.Hash{}, nil),
+					legacy.NewSpendInput(nil, bc.Hash{}, issuedAsset, 5, 0, nil, bc.Hash{}, nil),
+				},
+				Outputs: []*legacy.TxOutput{
+					legacy.NewTxOutput(otherAsset, 7, []byte{byte(vm.OP_TRUE)}, nil),
+					legacy.NewTxOutput(issuedAsset, 5, []byte{byte(vm.OP_FAIL)}, nil),
+				},
+			}),
+		},
+	}
+
+	got := blockVolumes(b)
+	want := []*assetVolume{
+		{assetID: issuedAsset, issued: 100, transferred: 5, retired: 15},
+		{assetID: otherAsset, transferred: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blockVolumes = %+v, want %+v", got, want)
+	}
+}
+
+func TestCreateStatsPin(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO blocks (block_hash, height, data, header) VALUES
+			('\x01', 5, '', ''), ('\x02', 6, '', '')
+	`)
+	pinStore := pin.NewStore(db)
+	r := NewRegistry(db, prottest.NewChain(t), pinStore)
+	err := r.CreateStatsPin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pinStore.Height(StatsPinName); got != 4 {
+		t.Errorf("stats pin height = %d, want 4, just before the first stored block", got)
+	}
+}
+
+func TestBalanceSheet(t *testing.T) {
+	db := pgtest.NewTx(t)
+	r := NewRegistry(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	asset, err := r.Define(ctx, []chainkd.XPub{testutil.TestXPub}, 1, nil, "gold", nil, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO asset_circulation (asset_id, issued, transferred, retired)
+		VALUES ($1, 150, 20, 30)
+	`, asset.AssetID)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO account_utxos (asset_id, amount, account_id, control_program_index, control_program,
+			confirmed_in, output_id, source_id, source_pos, ref_data_hash, change)
+		VALUES ($1, 40, 'acc1', 1, '\x51', 1, '\x01', '\x00', 0, '\x00', false)
+	`, asset.AssetID)
+
+	got, err := r.BalanceSheet(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := []*BalanceSheetEntry{{
+		AssetID:      asset.AssetID,
+		AssetAlias:   "gold",
+		Issued:       150,
+		Retired:      30,
+		Outstanding:  120,
+		HeldByIssuer: 40,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BalanceSheet() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReconcileCirculation(t *testing.T) {
+	db := pgtest.NewTx(t)
+	ctx := context.Background()
+
+	issue := func(program byte, amount uint64) *legacy.TxInput {
+		return legacy.NewIssuanceInput(nil, amount, nil, bc.Hash{}, []byte{program}, nil, nil)
+	}
+	drifted := issue(byte(vm.OP_TRUE), 150)
+	missing := issue(byte(vm.OP_2), 7)
+	correct := issue(byte(vm.OP_3), 9)
+	spurious := bc.NewAssetID([32]byte{4})
+
+	blocks := []*legacy.Block{{
+		BlockHeader: legacy.BlockHeader{Version: 1, Height: 1},
+		Transactions: []*legacy.Tx{legacy.NewTx(legacy.TxData{
+			Version: 1,
+			Inputs:  []*legacy.TxInput{drifted, missing, correct},
+		})},
+	}, {
+		BlockHeader: legacy.BlockHeader{Version: 1, Height: 2},
+		Transactions: []*legacy.Tx{legacy.NewTx(legacy.TxData{
+			Version: 1,
+			Inputs: []*legacy.TxInput{
+				legacy.NewSpendInput(nil, bc.Hash{}, drifted.AssetID(), 20, 0, nil, bc.Hash{}, nil),
+				legacy.NewSpendInput(nil, bc.Hash{}, correct.AssetID(), 1, 0, nil, bc.Hash{}, nil),
+			},
+			Outputs: []*legacy.TxOutput{
+				legacy.NewTxOutput(drifted.AssetID(), 30, []byte{byte(vm.OP_FAIL)}, nil),
+			},
+		})},
+	}, {
+		// Stored, but not rolled up yet.
+		BlockHeader: legacy.BlockHeader{Version: 1, Height: 3},
+		Transactions: []*legacy.Tx{legacy.NewTx(legacy.TxData{
+			Version: 1,
+			Inputs:  []*legacy.TxInput{issue(byte(vm.OP_TRUE), 1000)},
+		})},
+	}}
+	for _, b := range blocks {
+		pgtest.Exec(ctx, db, t, `
+			INSERT INTO blocks (block_hash, height, data, header) VALUES ($1, $2, $3, '')
+		`, []byte{byte(b.Height)}, b.Height, b)
+	}
+	pgtest.Exec(ctx, db, t, `INSERT INTO asset_stats_blocks (height) VALUES (1), (2)`)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO asset_circulation (asset_id, issued, transferred, retired)
+		VALUES ($1, 100, 0, 0), ($2, 9, 1, 0), ($3, 5, 0, 0)
+	`, drifted.AssetID(), correct.AssetID(), spurious)
+
+	repaired, err := RepairCirculation(ctx, db)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(repaired) != 3 {
+		t.Errorf("repaired = %v, want the drifted, missing and spurious assets", repaired)
+	}
+
+	checkCirculation(ctx, t, db, []circulation{
+		{drifted.AssetID(), 150, 20, 30},
+		{missing.AssetID(), 7, 0, 0},
+		{correct.AssetID(), 9, 1, 0},
+		{spurious, 0, 0, 0},
+	})
+
+	// Roll up block 3 and corrupt another counter. Only block
+	// 3 should be read, so the earlier blocks aren't counted
+	// twice.
+	pgtest.Exec(ctx, db, t, `INSERT INTO asset_stats_blocks (height) VALUES (3)`)
+	pgtest.Exec(ctx, db, t, `
+		UPDATE asset_circulation SET issued = issued + 1000 WHERE asset_id = $1
+	`, drifted.AssetID())
+	pgtest.Exec(ctx, db, t, `UPDATE asset_circulation SET issued = 8 WHERE asset_id = $1`, correct.AssetID())
+
+	repaired, err = RepairCirculation(ctx, db)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(repaired, []bc.AssetID{correct.AssetID()}) {
+		t.Errorf("repaired = %v, want only the corrupted asset", repaired)
+	}
+	checkCirculation(ctx, t, db, []circulation{
+		{drifted.AssetID(), 1150, 20, 30},
+		{correct.AssetID(), 9, 1, 0},
+	})
+}
+
+type circulation struct {
+	assetID                      bc.AssetID
+	issued, transferred, retired uint64
+}
+
+func checkCirculation(ctx context.Context, t *testing.T, db pg.DB, want []circulation) {
+	for _, c := range want {
+		var issued, transferred, retired uint64
+		err := db.QueryRowContext(ctx, `
+			SELECT issued, transferred, retired FROM asset_circulation WHERE asset_id = $1
+		`, c.assetID).Scan(&issued, &transferred, &retired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issued != c.issued || transferred != c.transferred || retired != c.retired {
+			t.Errorf("circulation of %x = %d, %d, %d, want %d, %d, %d", c.assetID.Bytes(),
+				issued, transferred, retired, c.issued, c.transferred, c.retired)
+		}
+	}
+}
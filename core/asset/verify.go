@@ -0,0 +1,304 @@
+package asset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/event"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+)
+
+// ErrLedgerUnsettled is returned by VerifyLedger when the
+// block processors kept changing the ledger while it was
+// being checked.
+var ErrLedgerUnsettled = errors.New("ledger is still being indexed")
+
+const (
+	verifyAttempts = 5
+	verifyBackoff  = 200 * time.Millisecond
+)
+
+// LedgerCheck is the result of VerifyLedger. Height is the
+// block height the ledger was indexed to when it was checked.
+type LedgerCheck struct {
+	Height     uint64             `json:"height"`
+	Assets     int                `json:"assets_checked"`
+	Violations []*LedgerViolation `json:"violations"`
+}
+
+// LedgerViolation describes an asset whose ledger totals
+// don't add up. Issued, Transferred and Retired are its
+// circulation totals, Created is the total of its outputs,
+// other than retirements, created in the blocks those totals
+// cover, UnspentInAccounts the unspent part of its outputs
+// controlled by this core's accounts, and HeldInAccounts the
+// sum of its balances in those accounts.
+type LedgerViolation struct {
+	AssetID           bc.AssetID `json:"asset_id"`
+	AssetAlias        string     `json:"asset_alias,omitempty"`
+	Issued            uint64     `json:"issued"`
+	Transferred       uint64     `json:"transferred"`
+	Retired           uint64     `json:"retired"`
+	Created           uint64     `json:"created"`
+	UnspentInAccounts uint64     `json:"unspent_in_accounts"`
+	HeldInAccounts    uint64     `json:"held_in_accounts"`
+	Problems          []string   `json:"problems"`
+}
+
+// ledgerTotals is what a settled check leaves for the next
+// one, so it only has to read the outputs created since.
+type ledgerTotals struct {
+	height  uint64
+	created map[bc.AssetID]uint64
+
+	// recheck holds the assets in violation, whose account
+	// balances are read again even if they haven't changed.
+	recheck map[bc.AssetID]bool
+}
+
+// VerifyLedger checks the ledger's invariants for each asset:
+// the outputs created in the blocks its circulation totals
+// cover add up to the amount issued plus the amount
+// transferred less the amount retired, and its account
+// balances add up to the unspent outputs controlled by
+// accounts.
+//
+// Circulation totals start at the first block the asset stats
+// processor rolled up, which is after the initial block if the
+// core was bootstrapped from a snapshot, so only outputs
+// created from that block on are counted.
+//
+// The ledger is read from the tables kept by the block
+// processors, so VerifyLedger only reports a violation seen
+// in two checks made while no block was being processed.
+func VerifyLedger(ctx context.Context, db pg.DB) (*LedgerCheck, error) {
+	c, _, err := verifyLedger(ctx, db, nil)
+	return c, err
+}
+
+// verifyLedger is VerifyLedger, reading only the outputs
+// created since prev, if it isn't nil. It returns the totals
+// for the next check.
+func verifyLedger(ctx context.Context, db pg.DB, prev *ledgerTotals) (*LedgerCheck, *ledgerTotals, error) {
+	var first *LedgerCheck
+	for i := 0; i < verifyAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(verifyBackoff):
+			}
+		}
+		c, next, err := checkLedger(ctx, db, prev)
+		if err != nil {
+			return nil, nil, err
+		}
+		if next == nil {
+			continue // not settled
+		}
+		if len(c.Violations) == 0 {
+			return c, next, nil
+		}
+		if first != nil {
+			c.Violations = confirmed(first.Violations, c.Violations)
+			return c, next, nil
+		}
+		first = c
+	}
+	return nil, nil, errors.WithDetailf(ErrLedgerUnsettled, "block processors still running after %d attempts", verifyAttempts)
+}
+
+// checkLedger reads each asset's totals in one statement,
+// along with the lowest and highest block processor heights.
+// The ledger is settled if they're the same; if it isn't,
+// checkLedger returns nil totals.
+//
+// Given prev, it reads only the outputs created after
+// prev.height, adding them to prev's totals, and the account
+// balances only of assets with outputs created since then or
+// in violation last time. Every asset's circulation totals are
+// checked either way; there's one row per asset.
+func checkLedger(ctx context.Context, db pg.DB, prev *ledgerTotals) (*LedgerCheck, *ledgerTotals, error) {
+	const q = `
+		WITH pins AS (
+			SELECT min(height) AS low, max(height) AS high FROM block_processors
+		), stats AS (
+			SELECT min(height) AS first FROM asset_stats_blocks
+		), created AS (
+			SELECT o.asset_id, COALESCE(sum(o.amount) FILTER (WHERE o.type <> 'retire' AND o.block_height >= s.first), 0) AS created
+			FROM annotated_outputs o CROSS JOIN stats s
+			WHERE o.block_height > $1
+			GROUP BY o.asset_id
+		), touched AS (
+			SELECT asset_id FROM created
+			UNION SELECT unnest($2::bytea[])
+		), unspent AS (
+			SELECT asset_id, sum(amount) AS in_accounts
+			FROM annotated_outputs
+			WHERE account_id IS NOT NULL AND upper_inf(timespan)
+				AND asset_id IN (SELECT asset_id FROM touched)
+			GROUP BY asset_id
+		), held AS (
+			SELECT asset_id, sum(amount) AS held
+			FROM account_utxos
+			WHERE $1 = 0 OR asset_id IN (SELECT asset_id FROM touched)
+			GROUP BY asset_id
+		), ids AS (
+			SELECT asset_id FROM asset_circulation
+			UNION SELECT asset_id FROM touched
+			UNION SELECT asset_id FROM held
+		)
+		SELECT p.low, p.high, i.asset_id, COALESCE(a.alias, ''),
+			COALESCE(c.issued, 0), COALESCE(c.transferred, 0), COALESCE(c.retired, 0),
+			COALESCE(r.created, 0), COALESCE(u.in_accounts, 0), COALESCE(h.held, 0)
+		FROM ids i
+		CROSS JOIN pins p
+		LEFT JOIN asset_circulation c ON c.asset_id = i.asset_id
+		LEFT JOIN created r ON r.asset_id = i.asset_id
+		LEFT JOIN unspent u ON u.asset_id = i.asset_id
+		LEFT JOIN held h ON h.asset_id = i.asset_id
+		LEFT JOIN assets a ON a.id = i.asset_id
+		ORDER BY i.asset_id
+	`
+	var (
+		since   uint64
+		recheck pq.ByteaArray
+	)
+	if prev != nil {
+		since = prev.height
+		for assetID := range prev.recheck {
+			recheck = append(recheck, assetID.Bytes())
+		}
+	}
+	c := &LedgerCheck{Violations: []*LedgerViolation{}}
+	next := &ledgerTotals{
+		created: make(map[bc.AssetID]uint64),
+		recheck: make(map[bc.AssetID]bool),
+	}
+	settled := true
+	err := pg.ForQueryRows(ctx, db, q, since, recheck, func(low, high uint64, assetID bc.AssetID, alias string, issued, transferred, retired, created, inAccounts, held uint64) {
+		c.Height = high
+		settled = settled && low == high
+		c.Assets++
+		if prev != nil {
+			created += prev.created[assetID]
+		}
+		next.created[assetID] = created
+		v := &LedgerViolation{
+			AssetID:           assetID,
+			AssetAlias:        alias,
+			Issued:            issued,
+			Transferred:       transferred,
+			Retired:           retired,
+			Created:           created,
+			UnspentInAccounts: inAccounts,
+			HeldInAccounts:    held,
+		}
+		v.Problems = v.check()
+		if len(v.Problems) > 0 {
+			c.Violations = append(c.Violations, v)
+			next.recheck[assetID] = true
+		}
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "checking ledger")
+	}
+	if !settled {
+		return c, nil, nil
+	}
+	next.height = c.Height
+	return c, next, nil
+}
+
+// check returns a description of each invariant v's totals
+// violate.
+func (v *LedgerViolation) check() []string {
+	var problems []string
+	if v.Created+v.Retired != v.Issued+v.Transferred {
+		problems = append(problems, fmt.Sprintf("outputs created total %d, want issued %d plus transferred %d less retired %d", v.Created, v.Issued, v.Transferred, v.Retired))
+	}
+	if v.HeldInAccounts != v.UnspentInAccounts {
+		problems = append(problems, fmt.Sprintf("account balances total %d, want the %d in account outputs", v.HeldInAccounts, v.UnspentInAccounts))
+	}
+	return problems
+}
+
+// confirmed returns the violations in cur for assets that
+// also had violations in prev.
+func confirmed(prev, cur []*LedgerViolation) []*LedgerViolation {
+	seen := make(map[bc.AssetID]bool)
+	for _, v := range prev {
+		seen[v.AssetID] = true
+	}
+	res := []*LedgerViolation{}
+	for _, v := range cur {
+		if seen[v.AssetID] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// WatchLedger runs VerifyLedger once per period until ctx is
+// done. After its first check, it reads only the outputs
+// created since the last one it completed. The first time an asset is found violating an
+// invariant, or found violating it differently, it logs the
+// violation and records a ledger.invariant_violated event,
+// which is published like any other. health is called with
+// an error while any asset is in violation, and nil once none
+// is. It should run only on the leader.
+func (reg *Registry) WatchLedger(ctx context.Context, period time.Duration, health func(error)) {
+	var (
+		totals   *ledgerTotals
+		reported = make(map[bc.AssetID]string)
+	)
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, WatchLedger exiting")
+			return
+		case <-ticks:
+		}
+
+		c, next, err := verifyLedger(ctx, reg.db, totals)
+		if errors.Root(err) == ErrLedgerUnsettled {
+			continue // try again next period
+		} else if err != nil {
+			log.Error(ctx, err, "verifying ledger")
+			continue
+		}
+		totals = next
+
+		current := make(map[bc.AssetID]string)
+		var assets []string
+		for _, v := range c.Violations {
+			summary := strings.Join(v.Problems, "; ")
+			current[v.AssetID] = summary
+			assets = append(assets, v.AssetID.String())
+			if reported[v.AssetID] == summary {
+				continue
+			}
+			log.Printkv(ctx, "at", "ledger invariant violated", "asset_id", v.AssetID.String(), "height", c.Height, "problems", summary)
+			err := event.Record(ctx, reg.db, event.LedgerInvariantViolated, v.AssetID.String(), v)
+			if err != nil {
+				log.Error(ctx, err)
+				delete(current, v.AssetID) // report it again next time
+			}
+		}
+		reported = current
+
+		if len(assets) > 0 {
+			health(fmt.Errorf("ledger invariants violated for assets %s", strings.Join(assets, ", ")))
+		} else {
+			health(nil)
+		}
+	}
+}
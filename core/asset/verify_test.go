@@ -0,0 +1,127 @@
+package asset
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+)
+
+func TestLedgerViolationCheck(t *testing.T) {
+	cases := []struct {
+		v    LedgerViolation
+		want []string
+	}{{
+		v: LedgerViolation{Issued: 100, Transferred: 40, Retired: 30, Created: 110, UnspentInAccounts: 50, HeldInAccounts: 50},
+	}, {
+		// Retired may exceed Issued on a core bootstrapped from a
+		// snapshot, retiring value issued before its first block.
+		v: LedgerViolation{Issued: 10, Transferred: 40, Retired: 30, Created: 20},
+	}, {
+		v:    LedgerViolation{Issued: 100, Transferred: 40, Retired: 30, Created: 120, UnspentInAccounts: 50, HeldInAccounts: 50},
+		want: []string{"outputs created total 120, want issued 100 plus transferred 40 less retired 30"},
+	}, {
+		v: LedgerViolation{Issued: 10, Retired: 30, HeldInAccounts: 5},
+		want: []string{
+			"outputs created total 0, want issued 10 plus transferred 0 less retired 30",
+			"account balances total 5, want the 0 in account outputs",
+		},
+	}}
+	for _, c := range cases {
+		got := c.v.check()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("check(%+v) = %q, want %q", c.v, got, c.want)
+		}
+	}
+}
+
+func TestConfirmed(t *testing.T) {
+	a1, a2, a3 := bc.NewAssetID([32]byte{1}), bc.NewAssetID([32]byte{2}), bc.NewAssetID([32]byte{3})
+	prev := []*LedgerViolation{{AssetID: a1}, {AssetID: a2}}
+	cur := []*LedgerViolation{{AssetID: a2, Created: 1}, {AssetID: a3}}
+
+	got := confirmed(prev, cur)
+	if len(got) != 1 || got[0] != cur[0] {
+		t.Errorf("confirmed = %+v, want only the current violation for %x", got, a2.Bytes())
+	}
+}
+
+func TestCheckLedger(t *testing.T) {
+	db := pgtest.NewTx(t)
+	ctx := context.Background()
+	asset := bc.NewAssetID([32]byte{0xaa})
+
+	// A core bootstrapped from a snapshot at block 4: the 12
+	// units spent in block 5 were issued before its first
+	// block, so more is retired than issued.
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO block_processors (name, height) VALUES ('asset_stats', 6), ('query', 6);
+		INSERT INTO asset_stats_blocks (height) VALUES (5);
+	`)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO asset_circulation (asset_id, issued, transferred, retired) VALUES ($1, 0, 12, 2)
+	`, asset)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO annotated_outputs (block_height, tx_pos, output_index, tx_hash, timespan,
+			output_id, type, purpose, asset_id, asset_alias, asset_definition, asset_tags,
+			asset_local, amount, account_id, control_program, reference_data, local)
+		VALUES
+			(3, 0, 0, '\x03', int8range(3000, 5000), '\x03', 'control', 'receive', $1, '', '{}', '{}', true, 12, 'acc1', '\x51', '{}', true),
+			(5, 0, 0, '\x05', int8range(5000, NULL), '\x05', 'control', 'receive', $1, '', '{}', '{}', true, 10, 'acc1', '\x51', '{}', true),
+			(5, 0, 1, '\x05', int8range(5000, NULL), '\x06', 'retire', 'receive', $1, '', '{}', '{}', true, 2, NULL, '\x6a', '{}', true)
+	`, asset)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO account_utxos (asset_id, amount, account_id, control_program_index, control_program,
+			confirmed_in, output_id, source_id, source_pos, ref_data_hash, change)
+		VALUES ($1, 10, 'acc1', 0, '\x51', 5, '\x05', '\x05', 0, '\x00', false)
+	`, asset)
+
+	c, totals, err := checkLedger(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals == nil || c.Height != 6 || c.Assets != 1 || len(c.Violations) != 0 {
+		t.Fatalf("full check = %+v, %+v, want height 6, one asset and no violations", c, totals)
+	}
+	if totals.created[asset] != 10 {
+		t.Errorf("created = %d, want 10", totals.created[asset])
+	}
+
+	// Block 7 issues 5 more; the next check reads only its
+	// outputs.
+	pgtest.Exec(ctx, db, t, `
+		UPDATE block_processors SET height = 7;
+		INSERT INTO asset_stats_blocks (height) VALUES (7);
+		UPDATE asset_circulation SET issued = 5;
+	`)
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO annotated_outputs (block_height, tx_pos, output_index, tx_hash, timespan,
+			output_id, type, purpose, asset_id, asset_alias, asset_definition, asset_tags,
+			asset_local, amount, control_program, reference_data, local)
+		VALUES (7, 0, 0, '\x07', int8range(7000, NULL), '\x07', 'control', 'receive', $1, '', '{}', '{}', true, 5, '\x52', '{}', true)
+	`, asset)
+
+	c, totals, err = checkLedger(ctx, db, totals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals == nil || c.Height != 7 || len(c.Violations) != 0 || totals.created[asset] != 15 {
+		t.Fatalf("incremental check = %+v, %+v, want height 7, no violations and 15 created", c, totals)
+	}
+
+	// Then the circulation totals drift.
+	pgtest.Exec(ctx, db, t, `UPDATE asset_circulation SET issued = 6`)
+	c, totals, err = checkLedger(ctx, db, totals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"outputs created total 15, want issued 6 plus transferred 12 less retired 2"}
+	if len(c.Violations) != 1 || !reflect.DeepEqual(c.Violations[0].Problems, want) {
+		t.Fatalf("violations = %+v, want %q", c.Violations, want)
+	}
+	if !totals.recheck[asset] {
+		t.Errorf("recheck = %v, want %x", totals.recheck, asset.Bytes())
+	}
+}
@@ -3,13 +3,36 @@ package core
 import (
 	"context"
 	"sync"
+	"time"
 
 	"chain/core/asset"
+	"chain/core/query"
 	"chain/crypto/ed25519/chainkd"
+	"chain/errors"
 	"chain/net/http/httpjson"
 	"chain/net/http/reqid"
+	"chain/protocol/bc"
 )
 
+const (
+	reconcileCirculationPeriod = 24 * time.Hour
+	verifyLedgerPeriod         = 10 * time.Minute
+)
+
+// assetPage is a page of /list-assets results.
+type assetPage struct {
+	Items    []*query.AnnotatedAsset `json:"items"`
+	Next     requestQuery            `json:"next"`
+	LastPage bool                    `json:"last_page"`
+}
+
+// assetStats is the response to /get-asset-stats.
+type assetStats struct {
+	AssetID  bc.AssetID      `json:"asset_id"`
+	Interval string          `json:"interval"`
+	Items    []*asset.Volume `json:"items"`
+}
+
 // POST /create-asset
 func (a *API) createAsset(ctx context.Context, ins []struct {
 	Alias      string
@@ -88,3 +111,198 @@ func (a *API) updateAssetTags(ctx context.Context, ins []struct {
 	wg.Wait()
 	return responses
 }
+
+// POST /get-asset-stats
+//
+// Returns the issued, transferred and retired volumes of an
+// asset for each hour or day in a time range. The range
+// defaults to the last day for hourly stats and the last 30
+// days for daily stats.
+func (a *API) getAssetStats(ctx context.Context, in struct {
+	ID        *bc.AssetID `json:"id"`
+	Alias     *string     `json:"alias"`
+	Interval  string      `json:"interval"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+}) (*assetStats, error) {
+	if (in.ID == nil) == (in.Alias == nil) {
+		return nil, errors.Wrap(asset.ErrBadIdentifier)
+	}
+	assetID := in.ID
+	if in.Alias != nil {
+		ast, err := a.assets.FindByAlias(ctx, *in.Alias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		assetID = &ast.AssetID
+	}
+
+	if in.Interval == "" {
+		in.Interval = asset.IntervalDay
+	}
+	if in.EndTime.IsZero() {
+		in.EndTime = time.Now()
+	}
+	if in.StartTime.IsZero() {
+		if in.Interval == asset.IntervalHour {
+			in.StartTime = in.EndTime.Add(-24 * time.Hour)
+		} else {
+			in.StartTime = in.EndTime.AddDate(0, 0, -30)
+		}
+	}
+
+	vols, err := a.assets.Stats(ctx, *assetID, in.Interval, in.StartTime, in.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if vols == nil {
+		vols = []*asset.Volume{} // send [], not null
+	}
+	return &assetStats{AssetID: *assetID, Interval: in.Interval, Items: vols}, nil
+}
+
+// POST /get-asset-definition-proof
+//
+// Returns an asset's definition along with the values its
+// asset ID commits to, so a counterparty can check that the
+// definition hasn't been altered. See asset.DefinitionProof.
+func (a *API) getAssetDefinitionProof(ctx context.Context, in struct {
+	ID    *bc.AssetID `json:"id"`
+	Alias *string     `json:"alias"`
+}) (*asset.DefinitionProof, error) {
+	if (in.ID == nil) == (in.Alias == nil) {
+		return nil, errors.Wrap(asset.ErrBadIdentifier)
+	}
+	assetID := in.ID
+	if in.Alias != nil {
+		ast, err := a.assets.FindByAlias(ctx, *in.Alias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		assetID = &ast.AssetID
+	}
+	return a.assets.DefinitionProof(ctx, *assetID)
+}
+
+// fxSnapshots is the response to /list-issuance-fx-snapshots.
+type fxSnapshots struct {
+	AssetID bc.AssetID          `json:"asset_id"`
+	Items   []*asset.FXSnapshot `json:"items"`
+}
+
+// POST /record-issuance-fx-snapshot
+//
+// Records the exchange rate at which an issuance of an asset
+// is valued. The issued amount is read from the indexed
+// transaction, and as_of defaults to the transaction's
+// timestamp.
+func (a *API) recordIssuanceFXSnapshot(ctx context.Context, in struct {
+	TransactionID string      `json:"transaction_id"`
+	AssetID       *bc.AssetID `json:"asset_id"`
+	AssetAlias    *string     `json:"asset_alias"`
+	Currency      string      `json:"currency"`
+	Rate          string      `json:"rate"`
+	AsOf          time.Time   `json:"as_of"`
+}) (*asset.FXSnapshot, error) {
+	assetID, err := a.assetID(ctx, in.AssetID, in.AssetAlias)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := a.annotatedTx(ctx, in.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	var amount uint64
+	for _, in := range tx.Inputs {
+		if in.Type == "issue" && in.AssetID == assetID {
+			amount += in.Amount
+		}
+	}
+	if amount == 0 {
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "transaction %s does not issue the asset", in.TransactionID)
+	}
+	if in.AsOf.IsZero() {
+		in.AsOf = tx.Timestamp
+	}
+	return a.assets.RecordFXSnapshot(ctx, tx.ID, assetID, amount, in.Currency, in.Rate, in.AsOf)
+}
+
+// POST /list-issuance-fx-snapshots
+//
+// Lists the snapshots recorded for issuances of an asset in
+// a time range, oldest first. By default, the range is the
+// last 30 days.
+func (a *API) listIssuanceFXSnapshots(ctx context.Context, in struct {
+	ID        *bc.AssetID `json:"id"`
+	Alias     *string     `json:"alias"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+}) (*fxSnapshots, error) {
+	assetID, err := a.assetID(ctx, in.ID, in.Alias)
+	if err != nil {
+		return nil, err
+	}
+	if in.EndTime.IsZero() {
+		in.EndTime = time.Now()
+	}
+	if in.StartTime.IsZero() {
+		in.StartTime = in.EndTime.AddDate(0, 0, -30)
+	}
+	snaps, err := a.assets.FXSnapshots(ctx, assetID, in.StartTime, in.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if snaps == nil {
+		snaps = []*asset.FXSnapshot{} // send [], not null
+	}
+	return &fxSnapshots{AssetID: assetID, Items: snaps}, nil
+}
+
+// balanceSheet is the response to /get-balance-sheet.
+type balanceSheet struct {
+	Items []*asset.BalanceSheetEntry `json:"items"`
+}
+
+// POST /get-balance-sheet
+//
+// Summarizes the supply of each asset created by this core:
+// the amounts issued, retired and outstanding, and the amount
+// held in this core's accounts.
+func (a *API) getBalanceSheet(ctx context.Context) (*balanceSheet, error) {
+	entries, err := a.assets.BalanceSheet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*asset.BalanceSheetEntry{} // send [], not null
+	}
+	return &balanceSheet{Items: entries}, nil
+}
+
+// POST /verify-ledger
+//
+// Checks the ledger's invariants for each asset now, rather
+// than waiting for the leader's next scheduled check, and
+// reports any asset whose totals don't add up.
+func (a *API) verifyLedger(ctx context.Context) (*asset.LedgerCheck, error) {
+	if !a.indexTxs {
+		return nil, errors.WithDetail(errNoTxIndex, "the ledger is checked against the transaction index")
+	}
+	return asset.VerifyLedger(ctx, a.db)
+}
+
+// assetID returns *id, or the ID of the asset with the given
+// alias. Exactly one of id and alias must be non-nil.
+func (a *API) assetID(ctx context.Context, id *bc.AssetID, alias *string) (bc.AssetID, error) {
+	if (id == nil) == (alias == nil) {
+		return bc.AssetID{}, errors.Wrap(asset.ErrBadIdentifier)
+	}
+	if id != nil {
+		return *id, nil
+	}
+	ast, err := a.assets.FindByAlias(ctx, *alias)
+	if err != nil {
+		return bc.AssetID{}, errors.Wrap(err, "find asset by alias")
+	}
+	return ast.AssetID, nil
+}
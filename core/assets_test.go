@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"reflect"
+	"sort"
 	"testing"
 
 	"chain/core/asset"
@@ -54,7 +55,7 @@ func TestUpdateAssetTags(t *testing.T) {
 		testutil.FatalErr(t, err)
 	}
 
-	items := page.Items.([]*query.AnnotatedAsset)
+	items := page.Items
 	if len(items) < 1 {
 		t.Fatal("result empty")
 	}
@@ -79,7 +80,7 @@ func TestUpdateAssetTags(t *testing.T) {
 		testutil.FatalErr(t, err)
 	}
 
-	items = page.Items.([]*query.AnnotatedAsset)
+	items = page.Items
 	if len(items) < 1 {
 		t.Fatal("result empty")
 	}
@@ -113,7 +114,7 @@ func TestUpdateAssetTags(t *testing.T) {
 		testutil.FatalErr(t, err)
 	}
 
-	items = page.Items.([]*query.AnnotatedAsset)
+	items = page.Items
 	if len(items) < 1 {
 		t.Fatal("result empty")
 	}
@@ -122,3 +123,38 @@ func TestUpdateAssetTags(t *testing.T) {
 		t.Fatalf("id:\ngot:  %v\nwant: %v", items[0].ID.String(), id)
 	}
 }
+
+// TestAssetResponseFields guards the JSON field names of
+// asset responses, which client SDKs depend on.
+func TestAssetResponseFields(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want []string
+	}{
+		{assetPage{}, []string{"items", "last_page", "next"}},
+		{assetStats{}, []string{"asset_id", "interval", "items"}},
+		{asset.Volume{}, []string{"issued", "retired", "time", "transferred"}},
+		{query.AnnotatedAsset{}, []string{"definition", "id", "is_local", "issuance_program", "keys", "quorum", "tags"}},
+		{freezeList{}, []string{"items"}},
+		{asset.DefinitionProof{}, []string{"asset_id", "definition", "definition_hash", "initial_block_hash", "issuance_program", "raw_definition", "vm_version"}},
+	}
+	for _, c := range cases {
+		b, err := json.Marshal(c.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]interface{}
+		err = json.Unmarshal(b, &fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for k := range fields {
+			got = append(got, k)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%T fields = %v, want %v", c.v, got, c.want)
+		}
+	}
+}
@@ -10,61 +10,179 @@ var Policies = []string{
 	"monitoring",
 	"internal",
 	"public",
+	"ilp",
 }
 
 var policyByRoute = map[string][]string{
-	"/create-account":           {"client-readwrite"},
-	"/create-asset":             {"client-readwrite"},
-	"/update-account-tags":      {"client-readwrite"},
-	"/update-asset-tags":        {"client-readwrite"},
-	"/build-transaction":        {"client-readwrite", "internal"},
-	"/submit-transaction":       {"client-readwrite", "internal"},
-	"/create-control-program":   {"client-readwrite"},
-	"/create-account-receiver":  {"client-readwrite"},
-	"/create-transaction-feed":  {"client-readwrite"},
-	"/get-transaction-feed":     {"client-readwrite", "client-readonly"},
-	"/update-transaction-feed":  {"client-readwrite"},
-	"/delete-transaction-feed":  {"client-readwrite"},
-	"/mockhsm":                  {"client-readwrite"},
-	"/mockhsm/create-block-key": {"internal"},
-	"/mockhsm/create-key":       {"client-readwrite"},
-	"/mockhsm/list-keys":        {"client-readwrite", "client-readonly"},
-	"/mockhsm/delkey":           {"client-readwrite"},
-	"/mockhsm/sign-transaction": {"client-readwrite"},
+	"/create-account":            {"client-readwrite"},
+	"/create-account-batch":      {"client-readwrite"},
+	"/archive-account":           {"client-readwrite"},
+	"/unarchive-account":         {"client-readwrite"},
+	"/create-asset":              {"client-readwrite"},
+	"/update-account-tags":       {"client-readwrite"},
+	"/update-asset-tags":         {"client-readwrite"},
+	"/build-transaction":         {"client-readwrite", "internal"},
+	"/submit-transaction":        {"client-readwrite", "internal"},
+	"/build-reversal":            {"client-readwrite", "internal"},
+	"/transfer":                  {"client-readwrite", "internal"},
+	"/create-control-program":    {"client-readwrite"},
+	"/create-account-receiver":   {"client-readwrite"},
+	"/create-payment-request":    {"client-readwrite"},
+	"/create-transaction-feed":   {"client-readwrite"},
+	"/get-transaction-feed":      {"client-readwrite", "client-readonly"},
+	"/update-transaction-feed":   {"client-readwrite"},
+	"/delete-transaction-feed":   {"client-readwrite"},
+	"/create-freeze":             {"client-readwrite"},
+	"/delete-freeze":             {"client-readwrite"},
+	"/create-address-book-entry": {"client-readwrite"},
+	"/verify-address-book-entry": {"client-readwrite"},
+	"/delete-address-book-entry": {"client-readwrite"},
+	"/mockhsm":                   {"client-readwrite"},
+	"/mockhsm/create-block-key":  {"internal"},
+	"/mockhsm/create-key":        {"client-readwrite"},
+	"/mockhsm/list-keys":         {"client-readwrite", "client-readonly"},
+	"/mockhsm/delkey":            {"client-readwrite"},
+	"/mockhsm/sign-transaction":  {"client-readwrite"},
 
-	"/list-accounts":          {"client-readwrite", "client-readonly"},
-	"/list-assets":            {"client-readwrite", "client-readonly"},
-	"/list-transaction-feeds": {"client-readwrite", "client-readonly"},
-	"/list-transactions":      {"client-readwrite", "client-readonly"},
-	"/list-balances":          {"client-readwrite", "client-readonly"},
-	"/list-unspent-outputs":   {"client-readwrite", "client-readonly"},
-	"/reset":                  {"client-readwrite", "internal"},
+	"/list-accounts":                   {"client-readwrite", "client-readonly"},
+	"/list-assets":                     {"client-readwrite", "client-readonly"},
+	"/list-transaction-feeds":          {"client-readwrite", "client-readonly"},
+	"/list-freezes":                    {"client-readwrite", "client-readonly"},
+	"/list-account-receivers":          {"client-readwrite", "client-readonly"},
+	"/get-payment-request":             {"client-readwrite", "client-readonly"},
+	"/list-payment-requests":           {"client-readwrite", "client-readonly"},
+	"/list-held-transactions":          {"client-readwrite", "client-readonly"},
+	"/approve-held-transaction":        {"client-readwrite"},
+	"/reject-held-transaction":         {"client-readwrite"},
+	"/get-review-queue-stats":          {"client-readwrite", "client-readonly"},
+	"/create-rule":                     {"client-readwrite"},
+	"/update-rule":                     {"client-readwrite"},
+	"/delete-rule":                     {"client-readwrite"},
+	"/list-rules":                      {"client-readwrite", "client-readonly"},
+	"/list-rule-matches":               {"client-readwrite", "client-readonly"},
+	"/create-accrual-rule":             {"client-readwrite"},
+	"/disable-accrual-rule":            {"client-readwrite"},
+	"/list-accrual-rules":              {"client-readwrite", "client-readonly"},
+	"/list-accruals":                   {"client-readwrite", "client-readonly"},
+	"/create-escrow":                   {"client-readwrite"},
+	"/release-escrow":                  {"client-readwrite"},
+	"/refund-escrow":                   {"client-readwrite"},
+	"/dispute-escrow":                  {"client-readwrite"},
+	"/get-escrow":                      {"client-readwrite", "client-readonly"},
+	"/list-escrows":                    {"client-readwrite", "client-readonly"},
+	"/create-subscription":             {"client-readwrite"},
+	"/pause-subscription":              {"client-readwrite"},
+	"/resume-subscription":             {"client-readwrite"},
+	"/cancel-subscription":             {"client-readwrite"},
+	"/get-subscription":                {"client-readwrite", "client-readonly"},
+	"/list-subscriptions":              {"client-readwrite", "client-readonly"},
+	"/list-subscription-executions":    {"client-readwrite", "client-readonly"},
+	"/create-payout-batch":             {"client-readwrite"},
+	"/approve-payout-batch":            {"client-readwrite"},
+	"/reject-payout-batch":             {"client-readwrite"},
+	"/get-payout-batch":                {"client-readwrite", "client-readonly"},
+	"/get-payout-batch-report":         {"client-readwrite", "client-readonly"},
+	"/list-payout-batches":             {"client-readwrite", "client-readonly"},
+	"/list-payout-rows":                {"client-readwrite", "client-readonly"},
+	"/upload-payout-batch":             {"client-readwrite"},
+	"/render-payout-batch-errors":      {"client-readwrite", "client-readonly"},
+	"/create-counterparty":             {"client-readwrite"},
+	"/update-counterparty":             {"client-readwrite"},
+	"/delete-counterparty":             {"client-readwrite"},
+	"/get-counterparty":                {"client-readwrite", "client-readonly"},
+	"/list-counterparties":             {"client-readwrite", "client-readonly"},
+	"/verify-counterparty":             {"client-readwrite"},
+	"/get-node-public-key":             {"client-readwrite", "client-readonly"},
+	"/create-htlc":                     {"client-readwrite"},
+	"/claim-htlc":                      {"client-readwrite"},
+	"/refund-htlc":                     {"client-readwrite"},
+	"/get-htlc":                        {"client-readwrite", "client-readonly"},
+	"/list-htlcs":                      {"client-readwrite", "client-readonly"},
+	"/create-payment-pointer":          {"client-readwrite"},
+	"/delete-payment-pointer":          {"client-readwrite"},
+	"/list-payment-pointers":           {"client-readwrite", "client-readonly"},
+	"/create-ilp-peer":                 {"client-readwrite"},
+	"/delete-ilp-peer":                 {"client-readwrite"},
+	"/list-ilp-peers":                  {"client-readwrite", "client-readonly"},
+	"/list-ilp-payments":               {"client-readwrite", "client-readonly"},
+	"/ilp":                             {"ilp"},
+	"/create-invitation":               {"client-readwrite"},
+	"/resend-invitation":               {"client-readwrite"},
+	"/revoke-invitation":               {"client-readwrite"},
+	"/list-invitations":                {"client-readwrite", "client-readonly"},
+	"/accept-invitation":               {"public"},
+	"/create-service-account":          {"client-readwrite"},
+	"/list-service-accounts":           {"client-readwrite", "client-readonly"},
+	"/update-service-account-policies": {"client-readwrite"},
+	"/create-service-account-token":    {"client-readwrite"},
+	"/delete-service-account":          {"client-readwrite"},
+	"/get-transaction-receipt":         {"client-readwrite", "client-readonly"},
+	"/get-receipt-public-key":          {"client-readwrite", "client-readonly"},
+	"/get-block":                       {"client-readwrite", "client-readonly"},
+	"/list-block-transactions":         {"client-readwrite", "client-readonly"},
+	"/get-raw-transaction":             {"client-readwrite", "client-readonly"},
+	"/list-address-book-entries":       {"client-readwrite", "client-readonly"},
+	"/list-transactions":               {"client-readwrite", "client-readonly"},
+	"/list-balances":                   {"client-readwrite", "client-readonly"},
+	"/get-asset-stats":                 {"client-readwrite", "client-readonly"},
+	"/get-balance-sheet":               {"client-readwrite", "client-readonly"},
+	"/verify-ledger":                   {"client-readwrite", "client-readonly", "monitoring"},
+	"/get-usage":                       {"client-readwrite", "client-readonly"},
+	"/create-ledger-snapshot":          {"client-readwrite"},
+	"/get-ledger-snapshot":             {"client-readwrite", "client-readonly"},
+	"/list-ledger-snapshots":           {"client-readwrite", "client-readonly"},
+	"/list-dead-jobs":                  {"client-readwrite", "client-readonly"},
+	"/get-leaders":                     {"client-readwrite", "client-readonly", "monitoring"},
+	"/list-events":                     {"client-readwrite", "client-readonly"},
+	"/get-asset-definition-proof":      {"client-readwrite", "client-readonly"},
+	"/record-issuance-fx-snapshot":     {"client-readwrite"},
+	"/list-issuance-fx-snapshots":      {"client-readwrite", "client-readonly"},
+	"/list-balance-deltas":             {"client-readwrite", "client-readonly"},
+	"/list-journal-entries":            {"client-readwrite", "client-readonly"},
+	"/list-journal-periods":            {"client-readwrite", "client-readonly"},
+	"/close-journal-period":            {"client-readwrite"},
+	"/create-journal-export":           {"client-readwrite"},
+	"/get-journal-export":              {"client-readwrite", "client-readonly"},
+	"/list-journal-exports":            {"client-readwrite", "client-readonly"},
+	"/create-account-statement":        {"client-readwrite"},
+	"/get-account-statement":           {"client-readwrite", "client-readonly"},
+	"/list-account-statements":         {"client-readwrite", "client-readonly"},
+	"/render-account-statement":        {"client-readwrite", "client-readonly"},
+	"/list-unspent-outputs":            {"client-readwrite", "client-readonly"},
+	"/reset":                           {"client-readwrite", "internal"},
+	"/generate-block":                  {"client-readwrite", "internal"},
 
-	crosscoreRPCPrefix + "submit":            {"crosscore", "crosscore-signblock"},
-	crosscoreRPCPrefix + "get-block":         {"crosscore", "crosscore-signblock"},
-	crosscoreRPCPrefix + "get-snapshot-info": {"crosscore", "crosscore-signblock"},
-	crosscoreRPCPrefix + "get-snapshot":      {"crosscore", "crosscore-signblock"},
-	crosscoreRPCPrefix + "signer/sign-block": {"internal", "crosscore-signblock"},
-	crosscoreRPCPrefix + "block-height":      {"crosscore", "crosscore-signblock"},
+	crosscoreRPCPrefix + "submit":               {"crosscore", "crosscore-signblock"},
+	crosscoreRPCPrefix + "get-block":            {"crosscore", "crosscore-signblock"},
+	crosscoreRPCPrefix + "get-snapshot-info":    {"crosscore", "crosscore-signblock"},
+	crosscoreRPCPrefix + "get-snapshot":         {"crosscore", "crosscore-signblock"},
+	crosscoreRPCPrefix + "signer/sign-block":    {"internal", "crosscore-signblock"},
+	crosscoreRPCPrefix + "block-height":         {"crosscore", "crosscore-signblock"},
+	crosscoreRPCPrefix + "federation-handshake": {"crosscore"},
 
-	"/list-authorization-grants":  {"client-readwrite", "client-readonly", "internal"},
-	"/create-authorization-grant": {"client-readwrite", "internal"},
-	"/delete-authorization-grant": {"client-readwrite", "internal"},
-	"/create-access-token":        {"client-readwrite", "internal"},
-	"/list-access-tokens":         {"client-readwrite", "client-readonly"},
-	"/delete-access-token":        {"client-readwrite"},
-	"/add-allowed-member":         {"internal"},
-	"/init-cluster":               {"internal"},
-	"/join-cluster":               {"internal"},
-	"/evict":                      {"internal"},
-	"/configure":                  {"client-readwrite", "internal"},
-	"/config":                     {"client-readwrite", "client-readonly", "monitoring", "internal"},
-	"/info":                       {"client-readwrite", "client-readonly", "crosscore", "crosscore-signblock", "monitoring", "internal"},
+	"/list-authorization-grants":     {"client-readwrite", "client-readonly", "internal"},
+	"/create-authorization-grant":    {"client-readwrite", "internal"},
+	"/delete-authorization-grant":    {"client-readwrite", "internal"},
+	"/create-access-token":           {"client-readwrite", "internal"},
+	"/list-access-tokens":            {"client-readwrite", "client-readonly"},
+	"/delete-access-token":           {"client-readwrite"},
+	"/create-request-signing-secret": {"client-readwrite"},
+	"/delete-request-signing-secret": {"client-readwrite"},
+	"/add-allowed-member":            {"internal"},
+	"/init-cluster":                  {"internal"},
+	"/join-cluster":                  {"internal"},
+	"/evict":                         {"internal"},
+	"/configure":                     {"client-readwrite", "internal"},
+	"/config":                        {"client-readwrite", "client-readonly", "monitoring", "internal"},
+	"/info":                          {"client-readwrite", "client-readonly", "crosscore", "crosscore-signblock", "monitoring", "internal"},
 
 	"/debug/": {"client-readwrite", "client-readonly", "monitoring"},
+	"/pay/":   {"client-readwrite", "client-readonly", "ilp"},
 
 	"/raft/": {"internal"},
 
 	"/dashboard":  {"public"},
 	"/dashboard/": {"public"},
+
+	"/openapi.json": {"public"},
 }
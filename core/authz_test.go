@@ -18,7 +18,7 @@ import (
 func TestAuthz(t *testing.T) {
 	ctx := context.Background()
 	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
-	accessTokens := &accesstoken.CredentialStore{db}
+	accessTokens := &accesstoken.CredentialStore{DB: db}
 	sdb := sinkdbtest.NewDB(t)
 
 	mux := http.NewServeMux()
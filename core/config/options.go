@@ -21,6 +21,7 @@ func New(sdb *sinkdb.DB) *Options {
 	return &Options{
 		sdb:    sdb,
 		schema: make(map[string]option),
+		errs:   make(map[string]error),
 	}
 }
 
@@ -26,3 +26,61 @@ func TestNormalizeURL(t *testing.T) {
 		})
 	}
 }
+
+func TestCleanOrigin(t *testing.T) {
+	cases := map[string]string{
+		"*":                          "*",
+		"https://Wallet.Example.com": "https://wallet.example.com",
+		"https://example.com:443/":   "https://example.com",
+		"http://localhost:8080":      "http://localhost:8080",
+		"https://example.com/app":    "",
+		"ftp://example.com":          "",
+		"example.com":                "",
+	}
+
+	for origin, want := range cases {
+		t.Run(origin, func(t *testing.T) {
+			tup := []string{origin}
+			err := cleanOrigin(tup)
+			if want == "" {
+				if err == nil {
+					t.Errorf("cleanOrigin(%q) = %q, want error", origin, tup[0])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tup[0] != want {
+				t.Errorf("cleanOrigin(%q) = %q, want %q", origin, tup[0], want)
+			}
+		})
+	}
+}
+
+func TestCleanRoute(t *testing.T) {
+	cases := map[string]string{
+		"/list-assets":  "/list-assets",
+		"list-assets":   "/list-assets",
+		"/list-assets/": "/list-assets",
+		"/":             "",
+		"/a?b":          "",
+	}
+
+	for route, want := range cases {
+		tup := []string{route}
+		err := cleanRoute(tup)
+		if want == "" {
+			if err == nil {
+				t.Errorf("cleanRoute(%q) = %q, want error", route, tup[0])
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tup[0] != want {
+			t.Errorf("cleanRoute(%q) = %q, want %q", route, tup[0], want)
+		}
+	}
+}
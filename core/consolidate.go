@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"chain/core/account"
+	"chain/core/job"
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/log"
+)
+
+// consolidateUTXOs merges the unspent outputs of accounts
+// holding more outputs of an asset than the
+// utxo_consolidation_threshold configuration option allows.
+// It runs as a recurring job, once per consolidateUTXOsPeriod.
+// Consolidation transactions are signed with the mock HSM and
+// record "utxo_consolidation": true in their reference data.
+// Accounts whose outputs are reserved are left until a later
+// period, so consolidation doesn't compete with transactions
+// in progress.
+func (a *API) consolidateUTXOs(ctx context.Context, _ *job.Job) error {
+	n := intOption(a.options.GetFunc("utxo_consolidation_threshold"))()
+	if n == 0 {
+		return nil // consolidation is disabled
+	}
+	cs, err := a.accounts.Consolidations(ctx, n)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		err = a.consolidate(ctx, c)
+		if err != nil {
+			log.Error(ctx, err, fmt.Sprintf("consolidating asset %s in account %s", c.AssetID.String(), c.AccountID))
+		}
+	}
+	return nil
+}
+
+// consolidate submits a transaction spending the outputs
+// of c to a single output in the same account.
+func (a *API) consolidate(ctx context.Context, c *account.Consolidation) error {
+	var actions []map[string]interface{}
+	for _, id := range c.OutputIDs {
+		actions = append(actions, map[string]interface{}{
+			"type":      "spend_account_unspent_output",
+			"output_id": id.String(),
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"type":       "control_account",
+		"account_id": c.AccountID,
+		"asset_id":   c.AssetID.String(),
+		"amount":     c.Amount,
+	}, map[string]interface{}{
+		"type":           "set_transaction_reference_data",
+		"reference_data": map[string]interface{}{"utxo_consolidation": true},
+	})
+
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: actions})
+	if err != nil {
+		return err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return errors.Wrap(err, "signing consolidation")
+	}
+	// Wait until the account indexer has removed the spent
+	// outputs, so the next period doesn't select them again.
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	return err
+}
@@ -21,12 +21,14 @@ import (
 )
 
 var (
-	errAlreadyConfigured = errors.New("core is already configured; must reset first")
-	errUnconfigured      = errors.New("core is not configured")
-	errNoMockHSM         = errors.New("core is not configured with a mockhsm")
-	errNoReset           = errors.New("core is not configured with reset capabilities")
-	errBadBlockPub       = errors.New("supplied block pub key is invalid")
-	errNoClientTokens    = errors.New("cannot enable client auth without client access tokens")
+	errAlreadyConfigured   = errors.New("core is already configured; must reset first")
+	errUnconfigured        = errors.New("core is not configured")
+	errNoMockHSM           = errors.New("core is not configured with a mockhsm")
+	errNoReset             = errors.New("core is not configured with reset capabilities")
+	errNotGenerator        = errors.New("core is not a generator")
+	errBadFreezeIdentifier = errors.New("either ID or alias must be specified, and not both")
+	errBadBlockPub         = errors.New("supplied block pub key is invalid")
+	errNoClientTokens      = errors.New("cannot enable client auth without client access tokens")
 )
 
 const (
@@ -46,11 +48,29 @@ func (a *API) reset(ctx context.Context, req struct {
 	panic("unreached")
 }
 
+// POST /generate-block
+//
+// generateBlock asks the generator to make a block from its
+// pending transactions now, instead of at the end of the
+// current block period. It returns without waiting for the
+// block to be committed.
+func (a *API) generateBlock(ctx context.Context) error {
+	if a.generator == nil {
+		return errNotGenerator
+	}
+	if a.leader.State() != leader.Leading {
+		return a.forwardToLeader(ctx, "/generate-block", nil, nil)
+	}
+	a.generator.Trigger()
+	return nil
+}
+
 func (a *API) info(ctx context.Context) (map[string]interface{}, error) {
 	if a.config == nil {
 		// never configured
 		return map[string]interface{}{
 			"is_configured": false,
+			"environment":   a.accessTokens.Env(),
 			"version":       config.Version,
 			"build_commit":  config.BuildCommit,
 			"build_date":    config.BuildDate,
@@ -105,6 +125,7 @@ func (a *API) leaderInfo(ctx context.Context) (map[string]interface{}, error) {
 	m := map[string]interface{}{
 		"state":                             a.leader.State().String(),
 		"is_configured":                     true,
+		"environment":                       a.accessTokens.Env(),
 		"configured_at":                     time.Unix(configuredAtSecs, configuredAtNSecs).UTC(),
 		"is_signer":                         a.config.IsSigner,
 		"is_generator":                      a.config.IsGenerator,
@@ -165,6 +186,11 @@ type configUpdate struct {
 // Eventually if possible, we'd like to replace the monolithic config
 // type with the incremental config options.
 func (a *API) configure(ctx context.Context, req configureRequest) error {
+	err := a.checkFeeAccounts(ctx, req.Updates)
+	if err != nil {
+		return err
+	}
+
 	// First, apply any of the incremental config updates as one
 	// single, atomic sinkdb batch.
 	var ops []sinkdb.Op
@@ -190,7 +216,7 @@ func (a *API) configure(ctx context.Context, req configureRequest) error {
 		ops = append(ops, a.options.Add("enclave", tup))
 	}
 
-	err := a.sdb.Exec(ctx, ops...)
+	err = a.sdb.Exec(ctx, ops...)
 	if err != nil {
 		return err
 	}
@@ -229,6 +255,11 @@ func (a *API) retrieveConfig(ctx context.Context, x struct {
 		if err != nil {
 			return nil, errors.Wrap(err)
 		}
+		if key == "event_publisher" {
+			for i, tup := range tups {
+				tups[i] = redactEventPublisher(tup)
+			}
+		}
 		results[key] = tups
 	}
 	return results, nil
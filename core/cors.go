@@ -0,0 +1,137 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"chain/core/rpc"
+	"chain/net/http/httpjson"
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache
+// the result of a preflight request.
+const corsMaxAge = "600"
+
+var (
+	corsAllowHeaders = strings.Join([]string{
+		"Authorization",
+		"Content-Type",
+		HeaderReadPrimary,
+		httpjson.NumbersHeader,
+		rpc.HeaderTimeout,
+	}, ", ")
+	corsExposeHeaders = rpc.HeaderBlockchainID
+)
+
+// CORSHandler allows browsers to call the Chain Core API from
+// web pages served by other origins. The allowed origins are
+// configured with the cors_origin config option, and the
+// routes they may call with the cors_route config option.
+//
+// It must wrap the authentication handler, since browsers
+// send preflight requests without credentials.
+type CORSHandler struct {
+	Next http.Handler
+
+	origins atomic.Value // func() [][]string
+	routes  atomic.Value // func() [][]string
+}
+
+// SetOrigins makes h call f on each request to find the set
+// of allowed origins. Until SetOrigins is called, no
+// cross-origin requests are allowed.
+func (h *CORSHandler) SetOrigins(f func() [][]string) {
+	h.origins.Store(f)
+}
+
+// SetRoutes makes h call f on each request to find the set
+// of routes allowed origins may call. If SetRoutes is never
+// called, or f returns no routes, every route is allowed.
+func (h *CORSHandler) SetRoutes(f func() [][]string) {
+	h.routes.Store(f)
+}
+
+func (h *CORSHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.exposed(req.URL.Path) {
+		h.Next.ServeHTTP(w, req)
+		return
+	}
+	// The response depends on the origin even when it's denied
+	// or absent, so caches mustn't reuse it for other origins.
+	w.Header().Add("Vary", "Origin")
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		h.Next.ServeHTTP(w, req)
+		return
+	}
+	switch h.allowed(origin) {
+	case originListed:
+		// Only origins listed by name may send credentials.
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	case originWildcard:
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	default:
+		h.Next.ServeHTTP(w, req)
+		return
+	}
+
+	// Answer preflight requests here, without authentication.
+	if req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET")
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+	h.Next.ServeHTTP(w, req)
+}
+
+// How a request's origin is allowed.
+const (
+	originDenied = iota
+	originWildcard
+	originListed
+)
+
+// allowed reports how origin is allowed: listed by name,
+// allowed only by the origin *, or not at all. Scheme and
+// host are case-insensitive; cleanOrigin stores them in
+// lower case.
+func (h *CORSHandler) allowed(origin string) int {
+	f, _ := h.origins.Load().(func() [][]string)
+	if f == nil {
+		return originDenied
+	}
+	origin = strings.ToLower(origin)
+	allow := originDenied
+	for _, tup := range f() {
+		switch tup[0] {
+		case origin:
+			return originListed
+		case "*":
+			allow = originWildcard
+		}
+	}
+	return allow
+}
+
+func (h *CORSHandler) exposed(route string) bool {
+	f, _ := h.routes.Load().(func() [][]string)
+	if f == nil {
+		return true
+	}
+	routes := f()
+	if len(routes) == 0 {
+		return true
+	}
+	for _, tup := range routes {
+		if tup[0] == route {
+			return true
+		}
+	}
+	return false
+}
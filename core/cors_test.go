@@ -0,0 +1,111 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSHandler(t *testing.T) {
+	var called bool
+	h := &CORSHandler{Next: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	})}
+	h.SetOrigins(func() [][]string {
+		return [][]string{{"https://wallet.example.com"}}
+	})
+
+	cases := []struct {
+		method, origin string
+		preflight      bool
+		wantAllow      string
+		wantNext       bool
+	}{
+		{"POST", "", false, "", true},
+		{"POST", "https://evil.example.com", false, "", true},
+		{"POST", "https://wallet.example.com", false, "https://wallet.example.com", true},
+		{"POST", "https://Wallet.Example.com", false, "https://Wallet.Example.com", true},
+		{"OPTIONS", "https://wallet.example.com", true, "https://wallet.example.com", false},
+		{"OPTIONS", "https://evil.example.com", true, "", true},
+	}
+	for _, c := range cases {
+		called = false
+		req := httptest.NewRequest(c.method, "/list-accounts", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != c.wantAllow {
+			t.Errorf("%s from %q: Access-Control-Allow-Origin = %q want %q", c.method, c.origin, got, c.wantAllow)
+		}
+		if called != c.wantNext {
+			t.Errorf("%s from %q: called next = %t want %t", c.method, c.origin, called, c.wantNext)
+		}
+		if got := rec.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s from %q: Vary = %q want Origin", c.method, c.origin, got)
+		}
+	}
+}
+
+func TestCORSHandlerRoutes(t *testing.T) {
+	h := &CORSHandler{Next: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})}
+	h.SetOrigins(func() [][]string {
+		return [][]string{{"*"}}
+	})
+	h.SetRoutes(func() [][]string {
+		return [][]string{{"/list-assets"}}
+	})
+
+	cases := map[string]string{
+		"/list-assets":         "*",
+		"/create-access-token": "",
+	}
+	for route, want := range cases {
+		req := httptest.NewRequest("POST", route, nil)
+		req.Header.Set("Origin", "https://wallet.example.com")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Errorf("POST %s: Access-Control-Allow-Origin = %q want %q", route, got, want)
+		}
+	}
+}
+
+func TestCORSHandlerWildcard(t *testing.T) {
+	h := &CORSHandler{Next: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})}
+	h.SetOrigins(func() [][]string {
+		return [][]string{{"*"}, {"https://wallet.example.com"}}
+	})
+
+	cases := []struct {
+		origin, wantAllow, wantCreds string
+	}{
+		{"https://evil.example.com", "*", ""},
+		{"https://wallet.example.com", "https://wallet.example.com", "true"},
+	}
+	for _, c := range cases {
+		for _, preflight := range []bool{false, true} {
+			req := httptest.NewRequest("POST", "/list-accounts", nil)
+			if preflight {
+				req = httptest.NewRequest("OPTIONS", "/list-accounts", nil)
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			req.Header.Set("Origin", c.origin)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != c.wantAllow {
+				t.Errorf("%s from %q: Access-Control-Allow-Origin = %q want %q", req.Method, c.origin, got, c.wantAllow)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != c.wantCreds {
+				t.Errorf("%s from %q: Access-Control-Allow-Credentials = %q want %q", req.Method, c.origin, got, c.wantCreds)
+			}
+		}
+	}
+}
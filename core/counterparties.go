@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/federation"
+	chainjson "chain/encoding/json"
+	"chain/protocol/bc"
+)
+
+// POST /create-counterparty
+//
+// Adds another organization's core to the counterparty
+// directory, with the URL it's reached at and its node
+// public key, from its /get-node-public-key. The access
+// token, if any, is one the counterparty issued for this
+// core; it's sent with every request to the counterparty,
+// and never returned. The counterparty is unverified until
+// /verify-counterparty succeeds.
+func (a *API) createCounterparty(ctx context.Context, x struct {
+	Alias           string             `json:"alias"`
+	URL             string             `json:"url"`
+	PublicKey       chainjson.HexBytes `json:"public_key"`
+	SupportedAssets []bc.AssetID       `json:"supported_assets"`
+	AccessToken     string             `json:"access_token"`
+}) (*federation.Counterparty, error) {
+	c := &federation.Counterparty{
+		Alias:           x.Alias,
+		URL:             x.URL,
+		PublicKey:       x.PublicKey,
+		SupportedAssets: x.SupportedAssets,
+	}
+	return a.counterparties.Create(ctx, c, x.AccessToken)
+}
+
+// POST /update-counterparty
+//
+// Replaces a counterparty's URL, public key and supported
+// assets, and its access token if one is given. A
+// counterparty whose URL or public key changes must be
+// verified again.
+func (a *API) updateCounterparty(ctx context.Context, x struct {
+	ID              string             `json:"id"`
+	URL             string             `json:"url"`
+	PublicKey       chainjson.HexBytes `json:"public_key"`
+	SupportedAssets []bc.AssetID       `json:"supported_assets"`
+	AccessToken     string             `json:"access_token"`
+}) (*federation.Counterparty, error) {
+	c := &federation.Counterparty{
+		URL:             x.URL,
+		PublicKey:       x.PublicKey,
+		SupportedAssets: x.SupportedAssets,
+	}
+	return a.counterparties.Update(ctx, x.ID, c, x.AccessToken)
+}
+
+// POST /delete-counterparty
+func (a *API) deleteCounterparty(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) error {
+	return a.counterparties.Delete(ctx, x.ID)
+}
+
+// POST /get-counterparty
+func (a *API) getCounterparty(ctx context.Context, x struct {
+	ID    string `json:"id"`
+	Alias string `json:"alias"`
+}) (*federation.Counterparty, error) {
+	return a.counterparties.Find(ctx, x.ID, x.Alias)
+}
+
+// counterpartyPage is the response to /list-counterparties.
+type counterpartyPage struct {
+	Items    []*federation.Counterparty `json:"items"`
+	Next     counterpartyQuery          `json:"next"`
+	LastPage bool                       `json:"last_page"`
+}
+
+type counterpartyQuery struct {
+	Status   string `json:"status"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-counterparties
+//
+// Lists the counterparty directory, oldest first, optionally
+// only those with the given status.
+func (a *API) listCounterparties(ctx context.Context, in counterpartyQuery) (*counterpartyPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.counterparties.List(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*federation.Counterparty{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &counterpartyPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// POST /verify-counterparty
+//
+// Performs the handshake with a counterparty: its core must
+// answer a random challenge, signed with the public key in
+// the directory, from the same blockchain. The counterparty
+// is marked verified, or failed with the reason.
+func (a *API) verifyCounterparty(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*federation.Counterparty, error) {
+	return a.counterparties.Verify(ctx, x.ID)
+}
+
+// POST /get-node-public-key
+//
+// Returns the public key this core identifies itself with in
+// handshakes, for other organizations to add to their
+// counterparty directories.
+func (a *API) getNodePublicKey(ctx context.Context) (map[string]interface{}, error) {
+	pub, err := a.counterparties.PublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"public_key": chainjson.HexBytes(pub)}, nil
+}
+
+// federationHandshake answers a handshake from another
+// organization's core, as part of its /verify-counterparty.
+func (a *API) federationHandshake(ctx context.Context, h *federation.Hello) (*federation.Answer, error) {
+	return a.counterparties.Answer(ctx, h)
+}
@@ -5,16 +5,34 @@ import (
 
 	"chain/core/accesstoken"
 	"chain/core/account"
+	"chain/core/accrual"
+	"chain/core/addressbook"
 	"chain/core/asset"
 	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/escrow"
+	"chain/core/export"
+	"chain/core/federation"
+	"chain/core/freeze"
+	"chain/core/htlc"
+	"chain/core/ilp"
+	"chain/core/invite"
 	"chain/core/leader"
+	"chain/core/payout"
+	"chain/core/payreq"
 	"chain/core/query"
 	"chain/core/query/filter"
+	"chain/core/reqsign"
+	"chain/core/review"
 	"chain/core/rpc"
+	"chain/core/rules"
+	"chain/core/screening"
 	"chain/core/signers"
+	"chain/core/statement"
+	"chain/core/subscription"
 	"chain/core/txbuilder"
 	"chain/core/txfeed"
+	"chain/core/usage"
 	"chain/database/pg"
 	"chain/database/sinkdb"
 	"chain/errors"
@@ -33,6 +51,8 @@ func isTemporary(info httperror.Info, err error) bool {
 		return true
 	case "CH761": // outputs currently reserved
 		return true
+	case "CH015": // ledger still being indexed
+		return true
 	case "CH706": // 1 or more action errors
 		errs := errors.Data(err)["actions"].([]httperror.Response)
 		temp := true
@@ -56,21 +76,34 @@ var errorFormatter = httperror.Formatter{
 	IsTemporary: isTemporary,
 	Errors: map[error]httperror.Info{
 		// General error namespace (0xx)
-		context.DeadlineExceeded:   {408, "CH001", "Request timed out"},
-		pg.ErrUserInputNotFound:    {400, "CH002", "Not found"},
-		httpjson.ErrBadRequest:     {400, "CH003", "Invalid request body"},
-		errNotFound:                {404, "CH006", "Not found"},
-		errRateLimited:             {429, "CH007", "Request limit exceeded"},
-		leader.ErrNoLeader:         {503, "CH008", "Electing a new leader for the core; try again soon"},
-		errNotAuthenticated:        {401, "CH009", "Request could not be authenticated"},
-		txbuilder.ErrMissingFields: {400, "CH010", "One or more fields are missing"},
-		authz.ErrNotAuthorized:     {403, "CH011", "Request is unauthorized"},
-		sinkdb.ErrConflict:         {409, "CH012", "Conflict processing request"},
-		asset.ErrDuplicateAlias:    {400, "CH050", "Alias already exists"},
-		account.ErrDuplicateAlias:  {400, "CH050", "Alias already exists"},
-		txfeed.ErrDuplicateAlias:   {400, "CH050", "Alias already exists"},
-		account.ErrBadIdentifier:   {400, "CH051", "Either an ID or alias must be provided, but not both"},
-		asset.ErrBadIdentifier:     {400, "CH051", "Either an ID or alias must be provided, but not both"},
+		context.DeadlineExceeded:      {408, "CH001", "Request timed out"},
+		pg.ErrUserInputNotFound:       {400, "CH002", "Not found"},
+		httpjson.ErrBadRequest:        {400, "CH003", "Invalid request body"},
+		errNotFound:                   {404, "CH006", "Not found"},
+		errRateLimited:                {429, "CH007", "Request limit exceeded"},
+		leader.ErrNoLeader:            {503, "CH008", "Electing a new leader for the core; try again soon"},
+		errNotAuthenticated:           {401, "CH009", "Request could not be authenticated"},
+		txbuilder.ErrMissingFields:    {400, "CH010", "One or more fields are missing"},
+		authz.ErrNotAuthorized:        {403, "CH011", "Request is unauthorized"},
+		sinkdb.ErrConflict:            {409, "CH012", "Conflict processing request"},
+		pg.ErrConflict:                {409, "CH012", "Conflict processing request"},
+		usage.ErrQuotaExceeded:        {429, "CH013", "Usage quota exceeded"},
+		httpjson.ErrRequestTooLarge:   {413, "CH014", "Request body too large"},
+		asset.ErrLedgerUnsettled:      {503, "CH015", "Ledger is still being indexed; try again soon"},
+		asset.ErrDuplicateAlias:       {400, "CH050", "Alias already exists"},
+		account.ErrDuplicateAlias:     {400, "CH050", "Alias already exists"},
+		txfeed.ErrDuplicateAlias:      {400, "CH050", "Alias already exists"},
+		addressbook.ErrDuplicateAlias: {400, "CH050", "Alias already exists"},
+		account.ErrBadIdentifier:      {400, "CH051", "Either an ID or alias must be provided, but not both"},
+		asset.ErrBadIdentifier:        {400, "CH051", "Either an ID or alias must be provided, but not both"},
+		errBadFreezeIdentifier:        {400, "CH051", "Either an ID or alias must be provided, but not both"},
+		asset.ErrBadAssetID:           {400, "CH052", "Malformed asset ID"},
+		asset.ErrBadCurrency:          {400, "CH054", "Currency must be a three-letter ISO 4217 code matching the asset's pricing currency"},
+		asset.ErrBadRate:              {400, "CH055", "Exchange rate must be a positive decimal number"},
+		account.ErrBadExpectation:     {400, "CH053", "An expected amount requires an expected asset"},
+		account.ErrNonzeroBalance:     {400, "CH056", "Account holds funds and cannot be archived"},
+		asset.ErrBadPrecision:         {400, "CH057", "Asset decimals must be an integer from 0 to 18, and unit a non-empty string"},
+		asset.ErrBadDecimalAmount:     {400, "CH058", "Decimal amount is invalid for its asset's precision"},
 
 		// Core error namespace
 		errUnconfigured:                {400, "CH100", "This core still needs to be configured"},
@@ -85,6 +118,7 @@ var errorFormatter = httperror.Formatter{
 		config.ErrNoBlockPub:           {400, "CH109", "Block Pub cannot be empty when configuring a mockhsm disabled signer"},
 		errNoMockHSM:                   {400, "CH110", "This endpoint is disabled for this server's configuration"},
 		errNoReset:                     {400, "CH110", "This endpoint is disabled for this server's configuration"},
+		errNotGenerator:                {400, "CH110", "This endpoint is disabled for this server's configuration"},
 		config.ErrNoBlockHSMURL:        {400, "CH111", "Block HSM URL cannot be empty when configuring a non mockhsm signer"},
 		errNoClientTokens:              {400, "CH120", "Cannot enable client authentication with no client tokens"},
 		blocksigner.ErrConsensusChange: {400, "CH150", "Refuse to sign block with consensus change"},
@@ -105,42 +139,99 @@ var errorFormatter = httperror.Formatter{
 		signers.ErrDupeXPub:  {400, "CH204", "Root XPubs cannot contain the same key more than once"},
 
 		// Access token and grant error namespace (3xx)
-		accesstoken.ErrBadID:       {400, "CH300", "Malformed or empty access token id"},
-		accesstoken.ErrBadType:     {400, "CH301", "Access tokens must be type client or network"},
-		accesstoken.ErrDuplicateID: {400, "CH302", "Access token id is already in use"},
-		errMissingTokenID:          {400, "CH303", "Access token id does not exist"},
-		errCurrentToken:            {400, "CH310", "The access token used to authenticate this request cannot be deleted"},
-		errProtectedGrant:          {400, "CH320", "Protected grants cannot be manually deleted"},
-		errCreateProtectedGrant:    {400, "CH321", "Protected grants cannot be manually created"},
+		accesstoken.ErrBadID:          {400, "CH300", "Malformed or empty access token id"},
+		accesstoken.ErrBadType:        {400, "CH301", "Access tokens must be type client or network"},
+		accesstoken.ErrDuplicateID:    {400, "CH302", "Access token id is already in use"},
+		errMissingTokenID:             {400, "CH303", "Access token id does not exist"},
+		errCurrentToken:               {400, "CH310", "The access token used to authenticate this request cannot be deleted"},
+		errProtectedGrant:             {400, "CH320", "Protected grants cannot be manually deleted"},
+		errCreateProtectedGrant:       {400, "CH321", "Protected grants cannot be manually created"},
+		invite.ErrBadEmail:            {400, "CH330", "Invalid email address"},
+		invite.ErrBadTTL:              {400, "CH331", "Invitation lifetime must be positive and at most 30 days"},
+		errBadMemberPolicy:            {400, "CH332", "Only the client-readwrite, client-readonly and monitoring policies may be granted to members"},
+		invite.ErrInvalid:             {400, "CH333", "Invitation token is invalid, or its invitation is no longer pending"},
+		invite.ErrNotPending:          {400, "CH334", "Invitation has already been accepted or revoked"},
+		accesstoken.ErrBadAlias:       {400, "CH340", "Malformed or empty service account alias"},
+		accesstoken.ErrDuplicateAlias: {400, "CH341", "Service account alias is already in use"},
+		reqsign.ErrUnsigned:           {401, "CH350", "Request must be signed with the access token's signing secret"},
+		reqsign.ErrBadSignature:       {401, "CH351", "Request signature is invalid"},
+		reqsign.ErrStale:              {401, "CH352", "Request timestamp is missing, malformed or too far from the core's clock"},
+		reqsign.ErrReplay:             {401, "CH353", "Request nonce has already been used"},
+		export.ErrNoDir:               {400, "CH360", "No ledger snapshot directory is configured"},
+		export.ErrBadHeight:           {400, "CH361", "Ledger snapshot height must be a block the blockchain has reached"},
+		errNoTxIndex:                  {400, "CH362", "Transaction indexing is disabled on this core"},
+		export.ErrBadFormat:           {400, "CH363", "Journal export format must be csv or ofx"},
 
 		// Query error namespace (6xx)
 		query.ErrBadAfter:               {400, "CH600", "Malformed pagination parameter `after`"},
 		query.ErrParameterCountMismatch: {400, "CH601", "Incorrect number of parameters to filter"},
 		filter.ErrBadFilter:             {400, "CH602", "Malformed query filter"},
+		asset.ErrBadInterval:            {400, "CH603", "Interval must be hour or day"},
+		payreq.ErrBadStatus:             {400, "CH604", "Status must be pending, paid, expired or overpaid"},
+		review.ErrBadStatus:             {400, "CH605", "Status must be pending, approved or rejected"},
+		query.ErrBadPeriodEnd:           {400, "CH606", "Period must end at an indexed block after the last closed period"},
+		statement.ErrBadPeriod:          {400, "CH607", "Statement period must end after it starts, no later than the most recently indexed block"},
+		statement.ErrTooLarge:           {400, "CH608", "Statement period has too many transactions"},
+		statement.ErrBadFormat:          {400, "CH609", "Statement format is not supported"},
 
 		// Transaction error namespace (7xx)
 		// Build error namespace (70x)
-		txbuilder.ErrBadRefData: {400, "CH700", "Reference data does not match previous transaction's reference data"},
-		errBadActionType:        {400, "CH701", "Invalid action type"},
-		errBadAlias:             {400, "CH702", "Invalid alias on action"},
-		errBadAction:            {400, "CH703", "Invalid action object"},
-		txbuilder.ErrBadAmount:  {400, "CH704", "Invalid asset amount"},
-		txbuilder.ErrBlankCheck: {400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
-		txbuilder.ErrAction:     {400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadRefData:         {400, "CH700", "Reference data does not match previous transaction's reference data"},
+		errBadActionType:                {400, "CH701", "Invalid action type"},
+		errBadAlias:                     {400, "CH702", "Invalid alias on action"},
+		errBadAction:                    {400, "CH703", "Invalid action object"},
+		txbuilder.ErrBadAmount:          {400, "CH704", "Invalid asset amount"},
+		txbuilder.ErrBlankCheck:         {400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
+		txbuilder.ErrAction:             {400, "CH706", "One or more actions had an error: see attached data"},
+		freeze.ErrFrozen:                {400, "CH707", "Asset or account is frozen"},
+		freeze.ErrBadType:               {400, "CH708", "Freeze type must be asset or account"},
+		errNotReversible:                {400, "CH709", "Transaction cannot be reversed"},
+		addressbook.ErrUnverified:       {400, "CH710", "Address book entry must be verified before it can be paid"},
+		addressbook.ErrMismatch:         {400, "CH711", "Control program does not match address book entry"},
+		review.ErrReviewed:              {400, "CH712", "Held transaction has already been reviewed"},
+		review.ErrNoReason:              {400, "CH713", "A reason is required to reject a held transaction"},
+		rules.ErrBadRule:                {400, "CH714", "Invalid rule"},
+		accrual.ErrBadRule:              {400, "CH715", "Invalid accrual rule"},
+		escrow.ErrBadEscrow:             {400, "CH716", "Invalid escrow"},
+		escrow.ErrBadState:              {400, "CH717", "Escrow status does not allow this operation"},
+		escrow.ErrBadStatus:             {400, "CH718", "Invalid escrow status"},
+		subscription.ErrBadSubscription: {400, "CH719", "Invalid subscription"},
+		subscription.ErrBadState:        {400, "CH720", "Subscription status does not allow this operation"},
+		payout.ErrBadBatch:              {400, "CH721", "Invalid payout batch"},
+		payout.ErrBadState:              {400, "CH722", "Payout batch status does not allow this operation"},
+		payout.ErrSelfApproval:          {400, "CH723", "Payout batch must be approved with a different access token"},
+		federation.ErrBadCounterparty:   {400, "CH724", "Invalid counterparty"},
+		federation.ErrDuplicateAlias:    {400, "CH725", "Counterparty alias already exists"},
+		federation.ErrHandshake:         {400, "CH726", "Counterparty handshake failed"},
+		htlc.ErrBadHTLC:                 {400, "CH727", "Invalid HTLC"},
+		htlc.ErrBadState:                {400, "CH728", "HTLC status does not allow this operation"},
+		htlc.ErrBadStatus:               {400, "CH729", "Invalid HTLC status"},
 
 		// Submit error namespace (73x)
 		txbuilder.ErrMissingRawTx:          {400, "CH730", "Missing raw transaction"},
 		txbuilder.ErrBadInstructionCount:   {400, "CH731", "Too many signing instructions in template for transaction"},
 		txbuilder.ErrBadTxInputIdx:         {400, "CH732", "Invalid transaction input index"},
 		txbuilder.ErrBadWitnessComponent:   {400, "CH733", "Invalid witness component"},
+		screening.ErrHeld:                  {400, "CH734", "Transaction held for compliance review"},
 		txbuilder.ErrRejected:              {400, "CH735", "Transaction rejected"},
 		txbuilder.ErrNoTxSighashCommitment: {400, "CH736", "Transaction is not final, additional actions still allowed"},
 		txbuilder.ErrTxSignatureFailure:    {400, "CH737", "Transaction signature missing, client may be missing signature key"},
 		txbuilder.ErrNoTxSighashAttempt:    {400, "CH738", "Transaction signature was not attempted"},
+		screening.ErrDenied:                {400, "CH739", "Transaction denied by compliance screening"},
+
+		// Interledger error namespace (74x)
+		ilp.ErrBadPointer: {400, "CH740", "Invalid payment pointer"},
+		ilp.ErrBadPeer:    {400, "CH741", "Invalid ILP peer"},
+		ilp.ErrDuplicate:  {400, "CH742", "Payment pointer name, or ILP peer alias or access token, already exists"},
+		ilp.ErrBadStatus:  {400, "CH743", "Invalid ILP payment status"},
+		ilp.ErrNotPeer:    {403, "CH744", "Access token does not belong to an ILP peer"},
+		ilp.ErrNoAddress:  {400, "CH745", "No ILP address is configured"},
 
 		// account action error namespace (76x)
 		account.ErrInsufficient: {400, "CH760", "Insufficient funds for tx"},
 		account.ErrReserved:     {400, "CH761", "Some outputs are reserved; try again"},
+		account.ErrArchived:     {400, "CH762", "Account is archived"},
+		account.ErrLocked:       {400, "CH763", "Output is locked until a later time or block height"},
 
 		// Mock HSM error namespace (80x)
 	},
@@ -0,0 +1,474 @@
+// Package escrow tracks escrows: an amount of an asset locked
+// by a payer under a 2-of-3 multisignature control program
+// whose keys belong to the payer, the payee and an arbiter.
+//
+// Any two of the three can spend the escrowed output. When
+// payer and payee agree, they release it to the payee or
+// refund it to the payer between them. When they don't, one
+// of them disputes the escrow, and the arbiter signs the
+// release or the refund with the side it finds for.
+//
+// An escrow is created when its program is derived, and is
+// funded once a block confirms an output of its asset and
+// amount to the program. It is released or refunded once a
+// block confirms a transaction spending that output built by
+// /release-escrow or /refund-escrow, which record the escrow
+// in the transaction's reference data. An output spent any
+// other way, such as by a template built by hand, closes the
+// escrow. Each change of status is recorded as an event.
+package escrow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/event"
+	"chain/core/pin"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/protocol/vm/vmutil"
+)
+
+// PinName is used to identify the pin associated with the
+// escrow block processor.
+const PinName = "escrows"
+
+// Escrow statuses. Released, refunded and closed are final.
+const (
+	StatusCreated  = "created"
+	StatusFunded   = "funded"
+	StatusDisputed = "disputed"
+	StatusReleased = "released"
+	StatusRefunded = "refunded"
+	StatusClosed   = "closed"
+)
+
+// Settlements, as recorded in the reference data of the
+// transaction spending an escrow.
+const (
+	SettleRelease = "release"
+	SettleRefund  = "refund"
+)
+
+// quorum is the number of the three parties' signatures
+// needed to spend an escrow.
+const quorum = 2
+
+var (
+	// ErrBadEscrow is returned by Create for an escrow with
+	// invalid fields.
+	ErrBadEscrow = errors.New("invalid escrow")
+
+	// ErrBadState is returned for an operation the escrow's
+	// status doesn't allow, such as releasing an escrow that
+	// hasn't been funded.
+	ErrBadState = errors.New("escrow status does not allow this")
+
+	// ErrBadStatus is returned by List for an unknown status.
+	ErrBadStatus = errors.New("unknown escrow status")
+)
+
+// Escrow is an amount of an asset locked for a payee until
+// it's released to them or refunded to the payer. The payee
+// is paid to their account on this core or to a control
+// program.
+type Escrow struct {
+	ID                  string             `json:"id"`
+	AssetID             bc.AssetID         `json:"asset_id"`
+	Amount              uint64             `json:"amount"`
+	PayerAccountID      string             `json:"payer_account_id"`
+	PayeeAccountID      string             `json:"payee_account_id,omitempty"`
+	PayeeControlProgram chainjson.HexBytes `json:"payee_control_program,omitempty"`
+	PayerXPub           chainkd.XPub       `json:"payer_xpub"`
+	PayeeXPub           chainkd.XPub       `json:"payee_xpub"`
+	ArbiterXPub         chainkd.XPub       `json:"arbiter_xpub"`
+	ControlProgram      chainjson.HexBytes `json:"control_program"`
+	Status              string             `json:"status"`
+	OutputID            *bc.Hash           `json:"output_id,omitempty"`
+	FundingTxID         *bc.Hash           `json:"funding_transaction_id,omitempty"`
+	SettlementTxID      *bc.Hash           `json:"settlement_transaction_id,omitempty"`
+	DisputeReason       string             `json:"dispute_reason,omitempty"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+
+	keyIndex  uint64
+	sourceID  bc.Hash
+	sourcePos uint64
+	refData   bc.Hash
+}
+
+// xpubs returns the parties' keys, in the order they appear
+// in the escrow's control program.
+func (e *Escrow) xpubs() []chainkd.XPub {
+	return []chainkd.XPub{e.PayerXPub, e.PayeeXPub, e.ArbiterXPub}
+}
+
+// path returns the derivation path of the escrow's keys. Each
+// escrow has its own, so no two share a control program.
+func (e *Escrow) path() [][]byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], e.keyIndex)
+	return [][]byte{[]byte("escrow"), idx[:]}
+}
+
+func (e *Escrow) program() ([]byte, error) {
+	derived := chainkd.DeriveXPubs(e.xpubs(), e.path())
+	return vmutil.P2SPMultiSigProgram(chainkd.XPubKeys(derived), quorum)
+}
+
+// Manager stores escrows and keeps their statuses up to date.
+type Manager struct {
+	db       pg.DB
+	chain    *protocol.Chain
+	pinStore *pin.Store
+}
+
+// NewManager returns a new Manager using the given database,
+// blockchain and block processor pins.
+func NewManager(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Manager {
+	return &Manager{db: db, chain: chain, pinStore: pinStore}
+}
+
+// Create derives a control program for e from the parties'
+// keys and stores e, with status created.
+func (m *Manager) Create(ctx context.Context, e *Escrow) (*Escrow, error) {
+	if e.Amount == 0 || e.Amount > 1<<63-1 {
+		return nil, errors.WithDetail(ErrBadEscrow, "amount must be positive and less than 2^63")
+	}
+	if (e.PayeeAccountID == "") == (len(e.PayeeControlProgram) == 0) {
+		return nil, errors.WithDetail(ErrBadEscrow, "the payee needs either an account or a control program")
+	}
+	var zero chainkd.XPub
+	if e.PayerXPub == zero || e.PayeeXPub == zero || e.ArbiterXPub == zero {
+		return nil, errors.WithDetail(ErrBadEscrow, "payer_xpub, payee_xpub and arbiter_xpub are required")
+	}
+	if e.PayerXPub == e.PayeeXPub || e.PayerXPub == e.ArbiterXPub || e.PayeeXPub == e.ArbiterXPub {
+		return nil, errors.WithDetail(ErrBadEscrow, "payer, payee and arbiter need different keys")
+	}
+
+	err := m.db.QueryRowContext(ctx, `SELECT nextval('escrows_key_index_seq')`).Scan(&e.keyIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "reserving key index")
+	}
+	e.ControlProgram, err = e.program()
+	if err != nil {
+		return nil, errors.Wrap(err, "deriving escrow program")
+	}
+
+	const q = `
+		INSERT INTO escrows (asset_id, amount, payer_account_id, payee_account_id, payee_control_program,
+			payer_xpub, payee_xpub, arbiter_xpub, key_index, control_program)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)
+		RETURNING id, status, created_at, updated_at
+	`
+	err = m.db.QueryRowContext(ctx, q, e.AssetID, int64(e.Amount), e.PayerAccountID, e.PayeeAccountID,
+		[]byte(e.PayeeControlProgram), e.PayerXPub.Bytes(), e.PayeeXPub.Bytes(), e.ArbiterXPub.Bytes(),
+		e.keyIndex, []byte(e.ControlProgram),
+	).Scan(&e.ID, &e.Status, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting escrow")
+	}
+	return e, nil
+}
+
+// Dispute marks a funded escrow as disputed, so that its
+// settlement needs the arbiter.
+func (m *Manager) Dispute(ctx context.Context, id, reason string) (*Escrow, error) {
+	const q = `
+		UPDATE escrows SET status = $2, dispute_reason = $3, updated_at = now()
+		WHERE id = $1 AND status = $4
+	`
+	res, err := m.db.ExecContext(ctx, q, id, StatusDisputed, reason, StatusFunded)
+	if err != nil {
+		return nil, errors.Wrap(err, "disputing escrow")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	e, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrBadState, "escrow %s is %s; only a funded escrow can be disputed", id, e.Status)
+	}
+	return e, m.recordEvent(ctx, e)
+}
+
+const selectQ = `
+	SELECT id, asset_id, amount, payer_account_id, COALESCE(payee_account_id, ''), payee_control_program,
+		payer_xpub, payee_xpub, arbiter_xpub, key_index, control_program, status, output_id,
+		source_id, source_pos, ref_data_hash, funding_tx_hash, settlement_tx_hash,
+		COALESCE(dispute_reason, ''), created_at, updated_at
+	FROM escrows
+`
+
+// Find returns the escrow with the given ID.
+func (m *Manager) Find(ctx context.Context, id string) (*Escrow, error) {
+	list, err := m.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "escrow %s", id)
+	}
+	return list[0], nil
+}
+
+// List returns up to limit escrows, oldest first, optionally
+// only those with the given status. Escrows with IDs less
+// than or equal to after are skipped; pass the ID of the last
+// escrow returned to get the next page, or "" to get the
+// first.
+func (m *Manager) List(ctx context.Context, status, after string, limit int) ([]*Escrow, error) {
+	switch status {
+	case "", StatusCreated, StatusFunded, StatusDisputed, StatusReleased, StatusRefunded, StatusClosed:
+	default:
+		return nil, errors.WithDetailf(ErrBadStatus, "status %q", status)
+	}
+	return m.query(ctx, selectQ+`
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`, status, after, limit)
+}
+
+func (m *Manager) query(ctx context.Context, q string, args ...interface{}) ([]*Escrow, error) {
+	var list []*Escrow
+	err := pg.ForQueryRows(ctx, m.db, q, append(args, func(
+		id string, assetID bc.AssetID, amount int64, payerAccountID, payeeAccountID string, payeeProg []byte,
+		payerXPub, payeeXPub, arbiterXPub []byte, keyIndex int64, prog []byte, status string, outputID []byte,
+		sourceID []byte, sourcePos sql.NullInt64, refData []byte, fundingTx, settlementTx []byte,
+		disputeReason string, createdAt, updatedAt time.Time,
+	) error {
+		e := &Escrow{
+			ID:                  id,
+			AssetID:             assetID,
+			Amount:              uint64(amount),
+			PayerAccountID:      payerAccountID,
+			PayeeAccountID:      payeeAccountID,
+			PayeeControlProgram: payeeProg,
+			ControlProgram:      prog,
+			Status:              status,
+			DisputeReason:       disputeReason,
+			CreatedAt:           createdAt,
+			UpdatedAt:           updatedAt,
+			keyIndex:            uint64(keyIndex),
+			sourcePos:           uint64(sourcePos.Int64),
+		}
+		copy(e.PayerXPub[:], payerXPub)
+		copy(e.PayeeXPub[:], payeeXPub)
+		copy(e.ArbiterXPub[:], arbiterXPub)
+		for _, h := range []struct {
+			dst **bc.Hash
+			src []byte
+		}{{&e.OutputID, outputID}, {&e.FundingTxID, fundingTx}, {&e.SettlementTxID, settlementTx}} {
+			if h.src != nil {
+				*h.dst = new(bc.Hash)
+				if err := (*h.dst).Scan(h.src); err != nil {
+					return err
+				}
+			}
+		}
+		if sourceID != nil {
+			if err := e.sourceID.Scan(sourceID); err != nil {
+				return err
+			}
+			if err := e.refData.Scan(refData); err != nil {
+				return err
+			}
+		}
+		list = append(list, e)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying escrows")
+	}
+	return list, nil
+}
+
+// DecodeSpendAction decodes a spend_escrow action, which
+// spends the output of a funded or disputed escrow, to be
+// signed by two of its parties.
+func (m *Manager) DecodeSpendAction(data []byte) (txbuilder.Action, error) {
+	a := &spendAction{escrows: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+type spendAction struct {
+	escrows  *Manager
+	EscrowID string `json:"escrow_id"`
+}
+
+func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	if a.EscrowID == "" {
+		return txbuilder.MissingFieldsError("escrow_id")
+	}
+	e, err := a.escrows.Find(ctx, a.EscrowID)
+	if err != nil {
+		return err
+	}
+	err = CheckSpendable(e)
+	if err != nil {
+		return err
+	}
+	in := legacy.NewSpendInput(nil, e.sourceID, e.AssetID, e.Amount, e.sourcePos, e.ControlProgram, e.refData, nil)
+	sigInst := new(txbuilder.SigningInstruction)
+	sigInst.AddWitnessKeys(e.xpubs(), e.path(), quorum)
+	return b.AddInput(in, sigInst)
+}
+
+// CheckSpendable returns ErrBadState unless e is funded or
+// disputed.
+func CheckSpendable(e *Escrow) error {
+	if e.Status != StatusFunded && e.Status != StatusDisputed {
+		return errors.WithDetailf(ErrBadState, "escrow %s is %s; only a funded or disputed escrow can be settled", e.ID, e.Status)
+	}
+	return nil
+}
+
+// RefData returns the reference data of a transaction
+// settling escrow id with the given settlement.
+func RefData(id, settlement string) map[string]interface{} {
+	return map[string]interface{}{"escrow": map[string]interface{}{
+		"id":         id,
+		"settlement": settlement,
+	}}
+}
+
+// refData is the part of a transaction's reference data
+// that records an escrow settlement.
+type refData struct {
+	Escrow *escrowRef `json:"escrow"`
+}
+
+type escrowRef struct {
+	ID         string `json:"id"`
+	Settlement string `json:"settlement"`
+}
+
+// ProcessBlocks updates the statuses of escrows funded or
+// spent in each new block.
+func (m *Manager) ProcessBlocks(ctx context.Context) {
+	if m.pinStore == nil {
+		return
+	}
+	m.pinStore.ProcessBlocks(ctx, m.chain, PinName, m.update)
+}
+
+// update marks the escrows paid in b as funded, and those
+// whose outputs are spent in b as released, refunded or
+// closed. Each change happens once, however many times b is
+// processed.
+func (m *Manager) update(ctx context.Context, b *legacy.Block) error {
+	var progs pq.ByteaArray
+	for _, tx := range b.Transactions {
+		for _, out := range tx.Outputs {
+			progs = append(progs, out.ControlProgram)
+		}
+	}
+	var changed []string
+	if len(progs) > 0 {
+		pending := make(map[string]*Escrow)
+		list, err := m.query(ctx, selectQ+`WHERE status = $1 AND control_program = ANY($2)`, StatusCreated, progs)
+		if err != nil {
+			return err
+		}
+		for _, e := range list {
+			pending[string(e.ControlProgram)] = e
+		}
+		for _, tx := range b.Transactions {
+			for i, out := range tx.Outputs {
+				e := pending[string(out.ControlProgram)]
+				if e == nil || *out.AssetId != e.AssetID || out.Amount != e.Amount {
+					continue
+				}
+				resOut, ok := tx.Entries[*tx.ResultIds[i]].(*bc.Output)
+				if !ok {
+					continue
+				}
+				const q = `
+					UPDATE escrows SET status = $2, output_id = $3, source_id = $4, source_pos = $5,
+						ref_data_hash = $6, funding_tx_hash = $7, updated_at = now()
+					WHERE id = $1 AND status = $8
+				`
+				res, err := m.db.ExecContext(ctx, q, e.ID, StatusFunded, tx.OutputID(i), *resOut.Source.Ref,
+					int64(resOut.Source.Position), *resOut.Data, tx.ID, StatusCreated)
+				if err != nil {
+					return errors.Wrap(err, "marking escrow funded")
+				}
+				if n, _ := res.RowsAffected(); n == 1 {
+					changed = append(changed, e.ID)
+				}
+				delete(pending, string(out.ControlProgram))
+			}
+		}
+	}
+
+	for _, tx := range b.Transactions {
+		var spent pq.ByteaArray
+		for _, inpID := range tx.Tx.InputIDs {
+			if sp, err := tx.Spend(inpID); err == nil {
+				spent = append(spent, sp.SpentOutputId.Bytes())
+			}
+		}
+		if len(spent) == 0 {
+			continue
+		}
+		var ref refData
+		_ = json.Unmarshal(tx.ReferenceData, &ref) // reference data needn't be JSON
+		release, refund := "", ""
+		if ref.Escrow != nil {
+			switch ref.Escrow.Settlement {
+			case SettleRelease:
+				release = ref.Escrow.ID
+			case SettleRefund:
+				refund = ref.Escrow.ID
+			}
+		}
+		const q = `
+			UPDATE escrows SET updated_at = now(), settlement_tx_hash = $2, status = CASE
+				WHEN id = $3 THEN $5
+				WHEN id = $4 THEN $6
+				ELSE $7
+			END
+			WHERE output_id = ANY($1) AND status IN ($8, $9)
+			RETURNING id
+		`
+		err := pg.ForQueryRows(ctx, m.db, q, spent, tx.ID, release, refund,
+			StatusReleased, StatusRefunded, StatusClosed, StatusFunded, StatusDisputed,
+			func(id string) { changed = append(changed, id) })
+		if err != nil {
+			return errors.Wrap(err, "marking escrows settled")
+		}
+	}
+
+	for _, id := range changed {
+		e, err := m.Find(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = m.recordEvent(ctx, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) recordEvent(ctx context.Context, e *Escrow) error {
+	return event.Record(ctx, m.db, event.EscrowUpdated, e.ID, e)
+}
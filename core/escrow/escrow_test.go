@@ -0,0 +1,83 @@
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"chain/crypto/ed25519/chainkd"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func newXPub(t *testing.T) chainkd.XPub {
+	_, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return xpub
+}
+
+func TestProgram(t *testing.T) {
+	payer, payee, arbiter := newXPub(t), newXPub(t), newXPub(t)
+	e1 := &Escrow{PayerXPub: payer, PayeeXPub: payee, ArbiterXPub: arbiter, keyIndex: 1}
+	e2 := &Escrow{PayerXPub: payer, PayeeXPub: payee, ArbiterXPub: arbiter, keyIndex: 2}
+
+	p1, err := e1.program()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	again, err := e1.program()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !bytes.Equal(p1, again) {
+		t.Errorf("program not deterministic: %x, then %x", p1, again)
+	}
+	p2, err := e2.program()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if bytes.Equal(p1, p2) {
+		t.Errorf("escrows with key indexes 1 and 2 share program %x", p1)
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	payer, payee, arbiter := newXPub(t), newXPub(t), newXPub(t)
+	cases := []*Escrow{
+		{PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee, ArbiterXPub: arbiter},
+		{Amount: 1 << 63, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee, ArbiterXPub: arbiter},
+		{Amount: 10, PayerXPub: payer, PayeeXPub: payee, ArbiterXPub: arbiter},
+		{Amount: 10, PayeeAccountID: "acc2", PayeeControlProgram: []byte{0x51}, PayerXPub: payer, PayeeXPub: payee, ArbiterXPub: arbiter},
+		{Amount: 10, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee},
+		{Amount: 10, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payer, ArbiterXPub: arbiter},
+	}
+	m := new(Manager)
+	for i, e := range cases {
+		_, err := m.Create(context.Background(), e)
+		if errors.Root(err) != ErrBadEscrow {
+			t.Errorf("case %d: Create = %v, want %v", i, err, ErrBadEscrow)
+		}
+	}
+}
+
+func TestCheckSpendable(t *testing.T) {
+	cases := map[string]bool{
+		StatusCreated:  false,
+		StatusFunded:   true,
+		StatusDisputed: true,
+		StatusReleased: false,
+		StatusRefunded: false,
+		StatusClosed:   false,
+	}
+	for status, want := range cases {
+		err := CheckSpendable(&Escrow{ID: "esc1", Status: status})
+		if got := err == nil; got != want {
+			t.Errorf("CheckSpendable(%s) = %v, want spendable %v", status, err, want)
+		}
+		if err != nil && errors.Root(err) != ErrBadState {
+			t.Errorf("CheckSpendable(%s) = %v, want %v", status, err, ErrBadState)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/escrow"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+type escrowRequest struct {
+	PayerAccountID      string             `json:"payer_account_id"`
+	PayerAccountAlias   string             `json:"payer_account_alias"`
+	PayeeAccountID      string             `json:"payee_account_id"`
+	PayeeAccountAlias   string             `json:"payee_account_alias"`
+	PayeeControlProgram chainjson.HexBytes `json:"payee_control_program"`
+	AssetID             *bc.AssetID        `json:"asset_id"`
+	AssetAlias          string             `json:"asset_alias"`
+	Amount              uint64             `json:"amount"`
+	PayerXPub           chainkd.XPub       `json:"payer_xpub"`
+	PayeeXPub           chainkd.XPub       `json:"payee_xpub"`
+	ArbiterXPub         chainkd.XPub       `json:"arbiter_xpub"`
+}
+
+// escrowResponse is the response to /create-escrow.
+type escrowResponse struct {
+	Escrow   *escrow.Escrow      `json:"escrow"`
+	Template *txbuilder.Template `json:"template"`
+}
+
+// POST /create-escrow
+//
+// Creates an escrow locking an amount of an asset from the
+// payer's account under a 2-of-3 program of the payer's,
+// payee's and arbiter's keys. Returns the escrow and an
+// unsigned template funding it from the payer's account, to
+// be signed and submitted as usual. The escrow is funded once
+// the transaction is in a block.
+func (a *API) createEscrow(ctx context.Context, x escrowRequest) (*escrowResponse, error) {
+	payerID, err := a.accountID(ctx, x.PayerAccountID, x.PayerAccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	e := &escrow.Escrow{
+		Amount:              x.Amount,
+		PayerAccountID:      payerID,
+		PayeeAccountID:      x.PayeeAccountID,
+		PayeeControlProgram: x.PayeeControlProgram,
+		PayerXPub:           x.PayerXPub,
+		PayeeXPub:           x.PayeeXPub,
+		ArbiterXPub:         x.ArbiterXPub,
+	}
+	switch {
+	case x.AssetAlias != "" && x.AssetID != nil:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id and asset_alias can't both be set")
+	case x.AssetAlias != "":
+		ast, err := a.assets.FindByAlias(ctx, x.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		e.AssetID = ast.AssetID
+	case x.AssetID != nil:
+		e.AssetID = *x.AssetID
+	default:
+		return nil, errors.WithDetail(escrow.ErrBadEscrow, "an asset_id or asset_alias is required")
+	}
+	if x.PayeeAccountAlias != "" {
+		if x.PayeeAccountID != "" {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "payee_account_id and payee_account_alias can't both be set")
+		}
+		acct, err := a.accounts.FindByAlias(ctx, x.PayeeAccountAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find account by alias")
+		}
+		e.PayeeAccountID = acct.ID
+	}
+
+	e, err = a.escrows.Create(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":       "spend_account",
+		"account_id": e.PayerAccountID,
+		"asset_id":   e.AssetID.String(),
+		"amount":     e.Amount,
+	}, {
+		"type":            "control_program",
+		"control_program": e.ControlProgram,
+		"asset_id":        e.AssetID.String(),
+		"amount":          e.Amount,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return &escrowResponse{Escrow: e, Template: tpl}, nil
+}
+
+// POST /release-escrow
+//
+// Builds an unsigned template paying a funded or disputed
+// escrow to the payee. It needs the signatures of two of the
+// escrow's parties: the payer and payee, or, in a dispute,
+// either of them and the arbiter.
+func (a *API) releaseEscrow(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*txbuilder.Template, error) {
+	return a.settleEscrow(ctx, x.ID, escrow.SettleRelease)
+}
+
+// POST /refund-escrow
+//
+// Builds an unsigned template paying a funded or disputed
+// escrow back to the payer's account, with the same
+// signatures as /release-escrow.
+func (a *API) refundEscrow(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*txbuilder.Template, error) {
+	return a.settleEscrow(ctx, x.ID, escrow.SettleRefund)
+}
+
+func (a *API) settleEscrow(ctx context.Context, id, settlement string) (*txbuilder.Template, error) {
+	e, err := a.escrows.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = escrow.CheckSpendable(e)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := map[string]interface{}{
+		"type":       "control_account",
+		"account_id": e.PayerAccountID,
+		"asset_id":   e.AssetID.String(),
+		"amount":     e.Amount,
+	}
+	if settlement == escrow.SettleRelease {
+		if e.PayeeAccountID != "" {
+			dest["account_id"] = e.PayeeAccountID
+		} else {
+			delete(dest, "account_id")
+			dest["type"] = "control_program"
+			dest["control_program"] = e.PayeeControlProgram
+		}
+	}
+	return a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":      "spend_escrow",
+		"escrow_id": e.ID,
+	}, dest, {
+		"type":           "set_transaction_reference_data",
+		"reference_data": escrow.RefData(e.ID, settlement),
+	}}})
+}
+
+// POST /dispute-escrow
+//
+// Marks a funded escrow as disputed, with a reason. A
+// disputed escrow is settled with the arbiter's signature.
+func (a *API) disputeEscrow(ctx context.Context, x struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}) (*escrow.Escrow, error) {
+	if x.Reason == "" {
+		return nil, errors.WithDetail(escrow.ErrBadEscrow, "a reason is required to dispute an escrow")
+	}
+	return a.escrows.Dispute(ctx, x.ID, x.Reason)
+}
+
+// POST /get-escrow
+func (a *API) getEscrow(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*escrow.Escrow, error) {
+	return a.escrows.Find(ctx, x.ID)
+}
+
+// escrowPage is the response to /list-escrows.
+type escrowPage struct {
+	Items    []*escrow.Escrow `json:"items"`
+	Next     escrowQuery      `json:"next"`
+	LastPage bool             `json:"last_page"`
+}
+
+type escrowQuery struct {
+	Status   string `json:"status"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-escrows
+//
+// Lists escrows, oldest first, optionally only those with
+// the given status.
+func (a *API) listEscrows(ctx context.Context, in escrowQuery) (*escrowPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.escrows.List(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*escrow.Escrow{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &escrowPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
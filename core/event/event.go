@@ -0,0 +1,104 @@
+// Package event keeps an append-only log of the changes made
+// through the Core, such as assets being created and
+// transactions being submitted.
+//
+// Each event has a sequence number. Events are committed in
+// order of their sequence numbers, so a consumer that reads
+// the log in order, remembering the last number it saw, never
+// misses an event. Events are recorded after the change they
+// describe succeeds; a process that exits in between records
+// the event when the operation is retried. Events recorded
+// with RecordOnce are recorded only once however many times
+// the operation is retried.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+)
+
+// Event types.
+const (
+	AssetCreated         = "asset.created"
+	AssetTagsUpdated     = "asset.tags_updated"
+	AccountCreated       = "account.created"
+	AccountTagsUpdated   = "account.tags_updated"
+	TransactionSubmitted = "transaction.submitted"
+	IssuanceSubmitted    = "issuance.submitted"
+	EscrowUpdated        = "escrow.updated"
+	HTLCUpdated          = "htlc.updated"
+	SubscriptionUpdated  = "subscription.updated"
+
+	LedgerInvariantViolated = "ledger.invariant_violated"
+)
+
+// appendLock is the key of the advisory lock serializing
+// appends, so that events commit in sequence order.
+const appendLock = 0x6576656e74
+
+// Event is an entry in the log. Subject is the ID of the
+// thing the event happened to.
+type Event struct {
+	Seq       uint64          `json:"seq"`
+	Type      string          `json:"type"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Record appends an event to the log, with data encoded as
+// JSON.
+func Record(ctx context.Context, db pg.DB, typ, subject string, data interface{}) error {
+	return record(ctx, db, typ, subject, data, false)
+}
+
+// RecordOnce appends an event to the log unless an event of
+// the same type and subject is already there, for operations
+// that happen once but may be retried, such as creating an
+// asset with a client token.
+func RecordOnce(ctx context.Context, db pg.DB, typ, subject string, data interface{}) error {
+	return record(ctx, db, typ, subject, data, true)
+}
+
+func record(ctx context.Context, db pg.DB, typ, subject string, data interface{}, once bool) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	// The lock is held until the statement's transaction
+	// commits, and taken before the sequence number is.
+	const q = `
+		WITH l AS (SELECT pg_advisory_xact_lock($1))
+		INSERT INTO events (type, subject, data, once)
+		SELECT $2, $3, $4::jsonb, $5 FROM l
+		ON CONFLICT (type, subject) WHERE once DO NOTHING
+	`
+	_, err = db.ExecContext(ctx, q, appendLock, typ, subject, string(b), once)
+	return errors.Wrapf(err, "recording %s event", typ)
+}
+
+// List lists up to limit events with sequence numbers after
+// the given one, in order, optionally only those of one type.
+func List(ctx context.Context, db pg.DB, typ string, after uint64, limit int) ([]*Event, error) {
+	const q = `
+		SELECT seq, type, subject, data, created_at FROM events
+		WHERE seq > $1 AND ($2 = '' OR type = $2)
+		ORDER BY seq
+		LIMIT $3
+	`
+	var events []*Event
+	err := pg.ForQueryRows(ctx, db, q, after, typ, limit, func(seq uint64, typ, subject string, data []byte, createdAt time.Time) {
+		events = append(events, &Event{
+			Seq:       seq,
+			Type:      typ,
+			Subject:   subject,
+			Data:      data,
+			CreatedAt: createdAt,
+		})
+	})
+	return events, errors.Wrap(err, "listing events")
+}
@@ -0,0 +1,57 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/testutil"
+)
+
+func TestRecordAndList(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+
+	records := []struct {
+		typ, subject string
+		once         bool
+	}{
+		{AssetCreated, "a1", true},
+		{AssetCreated, "a1", true}, // retried; not recorded again
+		{AssetTagsUpdated, "a1", false},
+		{AssetTagsUpdated, "a1", false},
+		{AccountCreated, "acc1", true},
+	}
+	for _, r := range records {
+		var err error
+		if r.once {
+			err = RecordOnce(ctx, db, r.typ, r.subject, map[string]string{"id": r.subject})
+		} else {
+			err = Record(ctx, db, r.typ, r.subject, map[string]string{"id": r.subject})
+		}
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	all, err := List(ctx, db, "", 0, 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	var got []string
+	for _, e := range all {
+		got = append(got, e.Type)
+	}
+	want := []string{AssetCreated, AssetTagsUpdated, AssetTagsUpdated, AccountCreated}
+	if !testutil.DeepEqual(got, want) {
+		t.Fatalf("event types = %v, want %v", got, want)
+	}
+
+	after, err := List(ctx, db, AssetTagsUpdated, all[1].Seq, 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(after) != 1 || after[0].Seq != all[2].Seq {
+		t.Errorf("tag updates after %d = %+v, want seq %d", all[1].Seq, after, all[2].Seq)
+	}
+}
@@ -0,0 +1,267 @@
+package event
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"chain/errors"
+)
+
+const (
+	natsDialTimeout = 10 * time.Second
+	natsAckTimeout  = 10 * time.Second
+
+	// natsDefaultMaxPayload is the largest message a server
+	// that doesn't announce max_payload can send.
+	natsDefaultMaxPayload = 1 << 20
+)
+
+// natsPublisher publishes events to NATS JetStream over the
+// NATS client protocol. Each event is published with its
+// sequence number as its Nats-Msg-Id, so JetStream discards
+// events published again after a failure, and Publish waits
+// for JetStream to acknowledge that the event is stored.
+type natsPublisher struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	inbox      string
+	n          int
+	maxPayload int
+}
+
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+	MaxPayload  int  `json:"max_payload"`
+}
+
+type natsConnect struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+	AuthToken    string `json:"auth_token,omitempty"`
+}
+
+// dialNATS connects to the NATS server at u, a URL of the
+// form nats://[user:pass@]host[:port] or
+// nats://token@host[:port]. With the scheme tls instead of
+// nats, the connection must use TLS, whether or not the
+// server asks for it, so TLS can't be stripped in transit.
+func dialNATS(ctx context.Context, u *url.URL) (*natsPublisher, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	d := net.Dialer{Timeout: natsDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to NATS")
+	}
+	p := &natsPublisher{conn: conn, r: bufio.NewReader(conn)}
+	err = p.handshake(u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *natsPublisher) handshake(u *url.URL) error {
+	p.conn.SetDeadline(time.Now().Add(natsDialTimeout))
+	defer p.conn.SetDeadline(time.Time{})
+
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "reading NATS server info")
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("NATS server sent %q, want INFO", strings.TrimSpace(line))
+	}
+	var info natsInfo
+	err = json.Unmarshal([]byte(line[len("INFO "):]), &info)
+	if err != nil {
+		return errors.Wrap(err, "decoding NATS server info")
+	}
+	if !info.Headers {
+		return errors.New("NATS server doesn't support headers; JetStream needs NATS 2.2 or later")
+	}
+	p.maxPayload = info.MaxPayload
+	if p.maxPayload <= 0 {
+		p.maxPayload = natsDefaultMaxPayload
+	}
+	if info.TLSRequired || u.Scheme == "tls" {
+		tlsConn := tls.Client(p.conn, &tls.Config{ServerName: u.Hostname()})
+		err = tlsConn.Handshake()
+		if err != nil {
+			return errors.Wrap(err, "NATS TLS handshake")
+		}
+		p.conn = tlsConn
+		p.r = bufio.NewReader(tlsConn)
+	}
+
+	c := natsConnect{Lang: "go", Version: "chain", Protocol: 1, Headers: true, NoResponders: true}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			c.User, c.Pass = u.User.Username(), pass
+		} else {
+			c.AuthToken = u.User.Username()
+		}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	var nonce [8]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	p.inbox = "_INBOX." + hex.EncodeToString(nonce[:])
+
+	_, err = fmt.Fprintf(p.conn, "CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", b, p.inbox)
+	if err != nil {
+		return errors.Wrap(err, "connecting to NATS")
+	}
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "PONG" {
+			return nil
+		}
+	}
+}
+
+// Publish publishes e to the given subject and waits for
+// JetStream to acknowledge it.
+func (p *natsPublisher) Publish(ctx context.Context, subject string, e *Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	hdr := "NATS/1.0\r\nNats-Msg-Id: " + strconv.FormatUint(e.Seq, 10) + "\r\n\r\n"
+	p.n++
+	reply := p.inbox + "." + strconv.Itoa(p.n)
+
+	deadline := time.Now().Add(natsAckTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	p.conn.SetDeadline(deadline)
+	defer p.conn.SetDeadline(time.Time{})
+
+	_, err = fmt.Fprintf(p.conn, "HPUB %s %s %d %d\r\n%s%s\r\n", subject, reply, len(hdr), len(hdr)+len(body), hdr, body)
+	if err != nil {
+		return errors.Wrap(err, "publishing to NATS")
+	}
+	for {
+		subj, hdrs, payload, err := p.readMsg()
+		if err != nil {
+			return err
+		}
+		if subj != reply {
+			continue // the ack of an earlier, timed-out event
+		}
+		if strings.HasPrefix(hdrs, "NATS/1.0 503") {
+			return fmt.Errorf("no JetStream stream captures subject %s", subject)
+		}
+		var ack struct {
+			Error *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		err = json.Unmarshal(payload, &ack)
+		if err != nil {
+			return errors.Wrap(err, "decoding JetStream ack")
+		}
+		if ack.Error != nil {
+			return fmt.Errorf("JetStream: %s", ack.Error.Description)
+		}
+		return nil
+	}
+}
+
+// readMsg reads the next message delivered to the
+// connection, answering server pings along the way.
+func (p *natsPublisher) readMsg() (subject, headers string, payload []byte, err error) {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return "", "", nil, err
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 || (f[0] != "MSG" && f[0] != "HMSG") {
+			continue
+		}
+		// MSG <subject> <sid> [reply-to] <#bytes>
+		// HMSG <subject> <sid> [reply-to] <#header bytes> <#total bytes>
+		if len(f) < 4 {
+			return "", "", nil, fmt.Errorf("malformed NATS message line %q", line)
+		}
+		var hlen int
+		var hlenErr error
+		if f[0] == "HMSG" {
+			hlen, hlenErr = strconv.Atoi(f[len(f)-2])
+		}
+		total, err := strconv.Atoi(f[len(f)-1])
+		if hlenErr != nil || err != nil || hlen < 0 || hlen > total {
+			return "", "", nil, fmt.Errorf("malformed NATS message line %q", line)
+		}
+		if total > p.maxPayload {
+			return "", "", nil, fmt.Errorf("NATS message of %d bytes is over the server's max_payload of %d", total, p.maxPayload)
+		}
+		buf := make([]byte, total+2) // and the trailing CRLF
+		_, err = io.ReadFull(p.r, buf)
+		if err != nil {
+			return "", "", nil, errors.Wrap(err, "reading NATS message")
+		}
+		return f[1], string(buf[:hlen]), buf[hlen:total], nil
+	}
+}
+
+// readLine reads a protocol line, answering pings and
+// returning server errors.
+func (p *natsPublisher) readLine() (string, error) {
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return "", errors.Wrap(err, "reading from NATS")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PING":
+			_, err = io.WriteString(p.conn, "PONG\r\n")
+			if err != nil {
+				return "", errors.Wrap(err, "writing to NATS")
+			}
+		case line == "+OK":
+		case strings.HasPrefix(line, "-ERR"):
+			return "", fmt.Errorf("NATS: %s", strings.TrimSpace(line[len("-ERR"):]))
+		default:
+			return line, nil
+		}
+	}
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,178 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// publishBatchSize is the number of events read from the log
+// at a time for publishing.
+const publishBatchSize = 100
+
+// cursorName is the name of the publisher's row in
+// event_cursors.
+const cursorName = "publisher"
+
+// ErrUnsupportedURL is returned by Dial for a URL that doesn't
+// name a supported message broker.
+var ErrUnsupportedURL = errors.New("unsupported event publisher URL")
+
+// Publisher publishes events to a message broker. Publish
+// returns only after the broker has accepted the event.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, e *Event) error
+	Close() error
+}
+
+// ValidURL returns an error if rawurl doesn't name a broker
+// Dial can connect to. Only NATS JetStream, with URLs of the
+// form nats://[user:pass@]host[:port], is supported. The
+// scheme tls requires the connection to use TLS.
+func ValidURL(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return errors.Sub(ErrUnsupportedURL, err)
+	}
+	if (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return errors.WithDetailf(ErrUnsupportedURL, "URL must be of the form nats://[user:pass@]host[:port] or tls://[user:pass@]host[:port].")
+	}
+	return nil
+}
+
+// RedactURL returns rawurl with the credentials in it, if
+// any, replaced, so it can be shown to clients that may not
+// connect to the broker themselves.
+func RedactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	} else {
+		u.User = url.User("xxxxx")
+	}
+	return u.String()
+}
+
+// Dial connects to the broker at rawurl.
+func Dial(ctx context.Context, rawurl string) (Publisher, error) {
+	err := ValidURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(rawurl)
+	return dialNATS(ctx, u)
+}
+
+// DefaultTopic is the topic an event of type typ is published
+// to when none is configured.
+func DefaultTopic(typ string) string {
+	return "chain.events." + typ
+}
+
+// Forward publishes the log to the broker at the URL returned
+// by brokerURL, polling for new events every period, until ctx
+// is canceled. It publishes nothing while brokerURL returns "".
+//
+// Delivery is at least once: the position of the last event
+// published is saved only after the broker accepts it, so an
+// event may be published again after a failure, but none is
+// skipped. Consumers can discard repeats by sequence number.
+// It's meant to run in one process at a time.
+func Forward(ctx context.Context, db pg.DB, brokerURL func() string, topic func(typ string) string, period time.Duration) {
+	var (
+		p    Publisher
+		pURL string
+	)
+	defer func() {
+		if p != nil {
+			p.Close()
+		}
+	}()
+
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, event publisher exiting")
+			return
+		case <-ticks:
+		}
+
+		u := brokerURL()
+		if p != nil && u != pURL {
+			p.Close()
+			p = nil
+		}
+		pURL = u
+		if u == "" {
+			continue
+		}
+		if p == nil {
+			var err error
+			p, err = Dial(ctx, u)
+			if err != nil {
+				log.Error(ctx, err, "connecting to event publisher")
+				continue
+			}
+		}
+		err := publishPending(ctx, db, p, topic)
+		if err != nil {
+			log.Error(ctx, err)
+			// Reconnect on the next tick.
+			p.Close()
+			p = nil
+		}
+	}
+}
+
+// publishPending publishes the events after the saved
+// position, saving the new position as it goes.
+func publishPending(ctx context.Context, db pg.DB, p Publisher, topic func(typ string) string) error {
+	const loadQ = `SELECT seq FROM event_cursors WHERE name = $1`
+	var seq uint64
+	err := db.QueryRowContext(ctx, loadQ, cursorName).Scan(&seq)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "loading event cursor")
+	}
+
+	for {
+		events, err := List(ctx, db, "", seq, publishBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		last := seq
+		for _, e := range events {
+			err = p.Publish(ctx, topic(e.Type), e)
+			if err != nil {
+				err = errors.Wrapf(err, "publishing event %d", e.Seq)
+				break
+			}
+			last = e.Seq
+		}
+		if last > seq {
+			const saveQ = `
+				INSERT INTO event_cursors (name, seq) VALUES ($1, $2)
+				ON CONFLICT (name) DO UPDATE SET seq = excluded.seq
+			`
+			_, saveErr := db.ExecContext(ctx, saveQ, cursorName, last)
+			if saveErr != nil {
+				return errors.Wrap(saveErr, "saving event cursor")
+			}
+			seq = last
+		}
+		if err != nil || len(events) < publishBatchSize {
+			return err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/testutil"
+)
+
+type fakePublisher struct {
+	seqs   []uint64
+	failAt uint64
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, topic string, e *Event) error {
+	if e.Seq == p.failAt {
+		return errors.New("broker unavailable")
+	}
+	p.seqs = append(p.seqs, e.Seq)
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func TestPublishPending(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+
+	for _, subject := range []string{"a1", "a2", "a3"} {
+		err := Record(ctx, db, AssetTagsUpdated, subject, nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	all, err := List(ctx, db, "", 0, 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// The broker fails on the third event; the first two
+	// are saved as published.
+	p := &fakePublisher{failAt: all[2].Seq}
+	err = publishPending(ctx, db, p, DefaultTopic)
+	if err == nil {
+		t.Fatal("publishPending succeeded, want error")
+	}
+	want := []uint64{all[0].Seq, all[1].Seq}
+	if !testutil.DeepEqual(p.seqs, want) {
+		t.Fatalf("published %v, want %v", p.seqs, want)
+	}
+
+	// After recovering, only the rest is published.
+	p = new(fakePublisher)
+	err = publishPending(ctx, db, p, DefaultTopic)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want = []uint64{all[2].Seq}
+	if !testutil.DeepEqual(p.seqs, want) {
+		t.Errorf("published %v, want %v", p.seqs, want)
+	}
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"strings"
+
+	"chain/core/event"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+// recordSubmitted records the events for the submission of
+// tx: transaction.submitted, and issuance.submitted if it
+// issues any assets. They're recorded once, however many
+// times tx is submitted.
+func (a *API) recordSubmitted(ctx context.Context, tx *legacy.Tx) error {
+	id := tx.ID.String()
+	err := event.RecordOnce(ctx, a.db, event.TransactionSubmitted, id, map[string]interface{}{"id": tx.ID})
+	if err != nil {
+		return err
+	}
+	var issuances []bc.AssetAmount
+	for _, in := range tx.Inputs {
+		if _, ok := in.TypedInput.(*legacy.IssuanceInput); ok {
+			issuances = append(issuances, in.AssetAmount())
+		}
+	}
+	if len(issuances) == 0 {
+		return nil
+	}
+	return event.RecordOnce(ctx, a.db, event.IssuanceSubmitted, id, map[string]interface{}{
+		"transaction_id": tx.ID,
+		"issuances":      issuances,
+	})
+}
+
+// cleanEventPublisher validates an event_publisher tuple.
+func cleanEventPublisher(tup []string) error {
+	err := event.ValidURL(tup[0])
+	if err != nil {
+		return errors.WithDetailf(errBadConfigValue, "Event publisher URL must be of the form nats://[user:pass@]host[:port], or tls:// to require TLS; only NATS JetStream is supported.")
+	}
+	return nil
+}
+
+// redactEventPublisher returns a copy of an event_publisher
+// tuple without the broker credentials, for /config, which
+// tokens that can't configure the core may read.
+func redactEventPublisher(tup []string) []string {
+	return []string{event.RedactURL(tup[0])}
+}
+
+// cleanEventTopic validates an event_topic tuple.
+func cleanEventTopic(tup []string) error {
+	if tup[0] == "" {
+		return errors.WithDetailf(errBadConfigValue, "Event type must be an event type such as %s, or *.", event.AssetCreated)
+	}
+	if tup[1] == "" || strings.ContainsAny(tup[1], " \t\r\n*>") {
+		return errors.WithDetailf(errBadConfigValue, "Event topic must be a subject without spaces or wildcards.")
+	}
+	return nil
+}
+
+// topicOption converts a closure returned by
+// config.Options.ListFunc for event_topic into a function
+// returning the topic for an event type.
+func topicOption(list func() [][]string) func(typ string) string {
+	return func(typ string) string {
+		var def string
+		for _, tup := range list() {
+			switch tup[0] {
+			case typ:
+				return tup[1]
+			case "*":
+				def = tup[1]
+			}
+		}
+		if def != "" {
+			return def
+		}
+		return event.DefaultTopic(typ)
+	}
+}
+
+// eventPage is the response to /list-events.
+type eventPage struct {
+	Items    []*event.Event `json:"items"`
+	Next     eventQuery     `json:"next"`
+	LastPage bool           `json:"last_page"`
+}
+
+type eventQuery struct {
+	Type     string `json:"type"`
+	After    uint64 `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-events
+//
+// Lists events in order of sequence number, optionally only
+// those of one type. Consumers follow the log by passing the
+// last sequence number they've seen as after.
+func (a *API) listEvents(ctx context.Context, in eventQuery) (*eventPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	events, err := event.List(ctx, a.db, in.Type, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []*event.Event{} // send [], not null
+	}
+
+	out := in
+	if len(events) > 0 {
+		out.After = events[len(events)-1].Seq
+	}
+	return &eventPage{
+		Items:    events,
+		Next:     out,
+		LastPage: len(events) < limit,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+// explorerCacheControl is sent with block explorer responses.
+// Blocks are final once committed, so responses about them
+// never change and may be cached indefinitely.
+const explorerCacheControl = "public, max-age=31536000, immutable"
+
+type blockRequest struct {
+	Height uint64 `json:"height"`
+}
+
+// blockSummary is the response to /get-block.
+type blockSummary struct {
+	ID               bc.Hash            `json:"id"`
+	Height           uint64             `json:"height"`
+	PreviousBlockID  bc.Hash            `json:"previous_block_id"`
+	Timestamp        time.Time          `json:"timestamp"`
+	TransactionCount int                `json:"transaction_count"`
+	TransactionIDs   []bc.Hash          `json:"transaction_ids"`
+	TransactionsRoot bc.Hash            `json:"transactions_merkle_root"`
+	AssetsRoot       bc.Hash            `json:"assets_merkle_root"`
+	ConsensusProgram chainjson.HexBytes `json:"consensus_program"`
+}
+
+// rawTransaction is an element of the response to
+// /list-block-transactions, and the response to
+// /get-raw-transaction.
+type rawTransaction struct {
+	ID             bc.Hash    `json:"id"`
+	BlockHeight    uint64     `json:"block_height"`
+	Position       int        `json:"position"`
+	RawTransaction *legacy.Tx `json:"raw_transaction"`
+}
+
+// POST /get-block
+//
+// Returns a summary of the block at the given height.
+func (a *API) getBlock(ctx context.Context, x blockRequest) (*blockSummary, error) {
+	b, err := a.committedBlock(ctx, x.Height)
+	if err != nil {
+		return nil, err
+	}
+	s := &blockSummary{
+		ID:               b.Hash(),
+		Height:           b.Height,
+		PreviousBlockID:  b.PreviousBlockHash,
+		Timestamp:        b.Time(),
+		TransactionCount: len(b.Transactions),
+		TransactionIDs:   []bc.Hash{}, // send [], not null
+		TransactionsRoot: b.TransactionsMerkleRoot,
+		AssetsRoot:       b.AssetsMerkleRoot,
+		ConsensusProgram: b.ConsensusProgram,
+	}
+	for _, tx := range b.Transactions {
+		s.TransactionIDs = append(s.TransactionIDs, tx.ID)
+	}
+	setExplorerCacheHeaders(ctx)
+	return s, nil
+}
+
+// POST /list-block-transactions
+//
+// Returns the raw transactions in the block at the given
+// height, in block order.
+func (a *API) listBlockTransactions(ctx context.Context, x blockRequest) (map[string]interface{}, error) {
+	b, err := a.committedBlock(ctx, x.Height)
+	if err != nil {
+		return nil, err
+	}
+	items := []*rawTransaction{} // send [], not null
+	for i, tx := range b.Transactions {
+		items = append(items, &rawTransaction{ID: tx.ID, BlockHeight: b.Height, Position: i, RawTransaction: tx})
+	}
+	setExplorerCacheHeaders(ctx)
+	return map[string]interface{}{"items": items}, nil
+}
+
+// POST /get-raw-transaction
+//
+// Returns a confirmed transaction as it appears in its block.
+func (a *API) getRawTransaction(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*rawTransaction, error) {
+	atx, err := a.annotatedTx(ctx, x.ID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := a.chain.GetBlock(ctx, atx.BlockHeight)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting block")
+	}
+	if int(atx.Position) >= len(b.Transactions) {
+		return nil, errors.Wrapf(errors.New("transaction position out of range"), "tx %s in block %d", x.ID, atx.BlockHeight)
+	}
+	tx := b.Transactions[atx.Position]
+	setExplorerCacheHeaders(ctx)
+	return &rawTransaction{ID: tx.ID, BlockHeight: b.Height, Position: int(atx.Position), RawTransaction: tx}, nil
+}
+
+// committedBlock returns the block at the given height, or
+// pg.ErrUserInputNotFound if there is no such block yet.
+func (a *API) committedBlock(ctx context.Context, height uint64) (*legacy.Block, error) {
+	if height == 0 || height > a.chain.Height() {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "block %d not found", height)
+	}
+	b, err := a.chain.GetBlock(ctx, height)
+	return b, errors.Wrapf(err, "getting block %d", height)
+}
+
+func setExplorerCacheHeaders(ctx context.Context) {
+	httpjson.ResponseWriter(ctx).Header().Set("Cache-Control", explorerCacheControl)
+}
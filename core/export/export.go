@@ -0,0 +1,414 @@
+// Package export produces point-in-time snapshots of the
+// ledger, for disaster recovery and external audits.
+//
+// A snapshot is a gzipped JSON Lines file. Every line is an
+// object whose "record" field gives its kind:
+//
+//	header          one, first: format, blockchain_id,
+//	                block_height, block_id, block_timestamp
+//	asset           one per asset seen on the blockchain by
+//	                the snapshot's height, ordered by ID
+//	unspent_output  one per output unspent at the height,
+//	                ordered by block height and position
+//	balance         one per account and asset with a nonzero
+//	                balance at the height
+//	trailer         one, last: counts of the records above
+//
+// Byte strings are hex-encoded. Outputs and balances are
+// exact as of the height; asset tags and aliases are those
+// current when the snapshot is taken, since they aren't
+// recorded on the blockchain. A file without a trailer is
+// incomplete.
+//
+// Snapshots are built from the transaction index, once it
+// has indexed the snapshot's height. The index doesn't
+// change what it reports for a past height, so a snapshot
+// is consistent even while new blocks arrive.
+//
+// The package also exports the general ledger journal of a
+// range of blocks for accounting software; see JournalExport.
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/job"
+	"chain/core/query"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+)
+
+// Format identifies the snapshot file format.
+const Format = "chain-ledger-snapshot/1"
+
+// JobKind is the kind of the jobs that take snapshots.
+const JobKind = "ledger_snapshot"
+
+const (
+	maxAttempts = 3
+
+	// indexWait is how long a snapshot waits for the
+	// transaction index to reach its height before checking
+	// again.
+	indexWait = time.Minute
+)
+
+// Snapshot statuses.
+const (
+	StatusPending  = "pending"
+	StatusComplete = "complete"
+	StatusFailed   = "failed"
+)
+
+var (
+	// ErrNoDir is returned when creating a snapshot without
+	// a snapshot directory configured.
+	ErrNoDir = errors.New("no ledger snapshot directory")
+	// ErrBadHeight is returned when creating a snapshot at a
+	// height the blockchain hasn't reached.
+	ErrBadHeight = errors.New("invalid snapshot height")
+)
+
+// Snapshot is a request for a ledger snapshot, and its
+// result once taken.
+type Snapshot struct {
+	ID             string     `json:"id"`
+	BlockHeight    uint64     `json:"block_height"`
+	BlockID        bc.Hash    `json:"block_id"`
+	BlockTimestamp time.Time  `json:"block_timestamp"`
+	Status         string     `json:"status"`
+	Path           string     `json:"path,omitempty"`
+	SHA256         string     `json:"sha256,omitempty"`
+	Assets         int64      `json:"assets"`
+	UnspentOutputs int64      `json:"unspent_outputs"`
+	Balances       int64      `json:"balances"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// Exporter takes ledger snapshots.
+type Exporter struct {
+	db            pg.DB
+	jobs          *job.Queue
+	blockchainID  bc.Hash
+	dir           func() string
+	indexedHeight func() uint64
+
+	journal      *query.Indexer
+	accountCodes func() [][]string
+	assetCodes   func() [][]string
+}
+
+// NewExporter returns a new Exporter for the blockchain with
+// the given ID, whose transaction index is in db.
+// indexedHeight returns the height the index has reached.
+// Snapshots are taken by jobs in the queue jobs.
+func NewExporter(db pg.DB, jobs *job.Queue, blockchainID bc.Hash, indexedHeight func() uint64) *Exporter {
+	e := &Exporter{
+		db:            db,
+		jobs:          jobs,
+		blockchainID:  blockchainID,
+		dir:           func() string { return "" },
+		indexedHeight: indexedHeight,
+	}
+	jobs.Handle(JobKind, maxAttempts, e.takeJob)
+	jobs.Handle(JournalJobKind, maxAttempts, e.takeJournalJob)
+	return e
+}
+
+// SetDir makes the exporter call f to find the directory
+// snapshots are written to.
+// It must be called before the exporter is used.
+func (e *Exporter) SetDir(f func() string) {
+	e.dir = f
+}
+
+// Create requests a snapshot of the ledger as of the given
+// block, which is taken in the background by a job.
+func (e *Exporter) Create(ctx context.Context, height uint64, blockID bc.Hash, blockTimestamp time.Time) (*Snapshot, error) {
+	if e.dir() == "" {
+		return nil, errors.WithDetail(ErrNoDir, "set the ledger_snapshot_dir configuration option")
+	}
+	const q = `
+		INSERT INTO ledger_snapshots (block_height, block_id, block_timestamp)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	s := &Snapshot{
+		BlockHeight:    height,
+		BlockID:        blockID,
+		BlockTimestamp: blockTimestamp,
+		Status:         StatusPending,
+	}
+	err := e.db.QueryRowContext(ctx, q, height, blockID, blockTimestamp).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting ledger snapshot")
+	}
+	_, err = e.jobs.Enqueue(ctx, JobKind, jobPayload{ID: s.ID})
+	if err != nil {
+		// Don't leave a snapshot that's pending forever.
+		ferr := e.fail(ctx, s.ID, err)
+		if ferr != nil {
+			log.Error(ctx, ferr)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// jobPayload is the payload of a job taking a snapshot.
+type jobPayload struct {
+	ID string `json:"id"`
+}
+
+const selectQ = `
+	SELECT id, block_height, block_id, block_timestamp, status, path,
+		sha256, assets, unspent_outputs, balances, error, created_at, completed_at
+	FROM ledger_snapshots
+`
+
+func scanSnapshot(sc func(...interface{}) error) (*Snapshot, error) {
+	var (
+		s           Snapshot
+		path, sum   sql.NullString
+		errMsg      sql.NullString
+		completedAt pq.NullTime
+	)
+	err := sc(&s.ID, &s.BlockHeight, &s.BlockID, &s.BlockTimestamp, &s.Status, &path,
+		&sum, &s.Assets, &s.UnspentOutputs, &s.Balances, &errMsg, &s.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.Path, s.SHA256, s.Error = path.String, sum.String, errMsg.String
+	if completedAt.Valid {
+		s.CompletedAt = &completedAt.Time
+	}
+	return &s, nil
+}
+
+// Find returns the snapshot with the given ID.
+func (e *Exporter) Find(ctx context.Context, id string) (*Snapshot, error) {
+	s, err := scanSnapshot(e.db.QueryRowContext(ctx, selectQ+`WHERE id = $1`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "ledger snapshot %s", id)
+	}
+	return s, errors.Wrap(err, "loading ledger snapshot")
+}
+
+// List lists the snapshots, newest first.
+func (e *Exporter) List(ctx context.Context) ([]*Snapshot, error) {
+	rows, err := e.db.QueryContext(ctx, selectQ+`ORDER BY id DESC`)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing ledger snapshots")
+	}
+	defer rows.Close()
+	var list []*Snapshot
+	for rows.Next() {
+		s, err := scanSnapshot(rows.Scan)
+		if err != nil {
+			return nil, errors.Wrap(err, "scanning ledger snapshot")
+		}
+		list = append(list, s)
+	}
+	return list, errors.Wrap(rows.Err())
+}
+
+// takeJob takes the snapshot named by j, once the
+// transaction index reaches its height. A snapshot interrupted
+// by a change of leader is taken again by the next one.
+func (e *Exporter) takeJob(ctx context.Context, j *job.Job) error {
+	var p jobPayload
+	err := json.Unmarshal(j.Payload, &p)
+	if err != nil {
+		return errors.Wrap(err, "decoding job payload")
+	}
+	s, err := e.Find(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if s.Status != StatusPending {
+		return nil
+	}
+	if s.BlockHeight > e.indexedHeight() {
+		return job.Postpone(indexWait)
+	}
+	err = e.take(ctx, s)
+	if err != nil && j.LastAttempt() && ctx.Err() == nil {
+		ferr := e.fail(ctx, s.ID, err)
+		if ferr != nil {
+			log.Error(ctx, ferr)
+		}
+	}
+	return errors.Wrapf(err, "taking ledger snapshot %s", s.ID)
+}
+
+// fail records that the snapshot with the given ID failed.
+func (e *Exporter) fail(ctx context.Context, id string, err error) error {
+	const q = `
+		UPDATE ledger_snapshots SET status = 'failed', error = $2, completed_at = now()
+		WHERE id = $1
+	`
+	_, err = e.db.ExecContext(ctx, q, id, err.Error())
+	return errors.Wrap(err, "recording failed ledger snapshot")
+}
+
+// take writes the snapshot s to a file and records it as
+// complete.
+func (e *Exporter) take(ctx context.Context, s *Snapshot) error {
+	dir := e.dir()
+	if dir == "" {
+		return errors.WithDetail(ErrNoDir, "set the ledger_snapshot_dir configuration option")
+	}
+	path := filepath.Join(dir, fmt.Sprintf("ledger-%d-%s.jsonl.gz", s.BlockHeight, s.ID))
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "creating ledger snapshot file")
+	}
+	defer os.Remove(tmp) // no-op once renamed
+
+	h := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(f, h))
+	err = e.write(ctx, zw, s)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing ledger snapshot")
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return errors.Wrap(err, "writing ledger snapshot")
+	}
+
+	const q = `
+		UPDATE ledger_snapshots
+		SET status = 'complete', path = $2, sha256 = $3, assets = $4,
+			unspent_outputs = $5, balances = $6, completed_at = now()
+		WHERE id = $1
+	`
+	_, err = e.db.ExecContext(ctx, q, s.ID, path, hex.EncodeToString(h.Sum(nil)), s.Assets, s.UnspentOutputs, s.Balances)
+	return errors.Wrap(err, "recording ledger snapshot")
+}
+
+// write writes the records of snapshot s to w, counting
+// them in s.
+func (e *Exporter) write(ctx context.Context, w io.Writer, s *Snapshot) error {
+	enc := json.NewEncoder(w)
+	err := enc.Encode(map[string]interface{}{
+		"record":          "header",
+		"format":          Format,
+		"blockchain_id":   e.blockchainID,
+		"block_height":    s.BlockHeight,
+		"block_id":        s.BlockID,
+		"block_timestamp": s.BlockTimestamp.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	line := func(n *int64) func(string) error {
+		return func(record string) error {
+			*n++
+			_, err := io.WriteString(w, record+"\n")
+			return err
+		}
+	}
+	s.Assets, s.UnspentOutputs, s.Balances = 0, 0, 0
+	timestampMS := s.BlockTimestamp.UnixNano() / int64(time.Millisecond)
+
+	const assetsQ = `
+		SELECT json_build_object(
+			'record', 'asset',
+			'id', encode(aa.id, 'hex'),
+			'alias', aa.alias,
+			'issuance_program', encode(aa.issuance_program, 'hex'),
+			'keys', aa.keys,
+			'quorum', aa.quorum,
+			'definition', aa.definition,
+			'tags', aa.tags,
+			'is_local', aa.local
+		)::text
+		FROM annotated_assets aa JOIN assets a ON a.id = aa.id
+		WHERE a.first_block_height <= $1
+		ORDER BY aa.id
+	`
+	err = pg.ForQueryRows(ctx, e.db, assetsQ, s.BlockHeight, line(&s.Assets))
+	if err != nil {
+		return errors.Wrap(err, "exporting assets")
+	}
+
+	const outputsQ = `
+		SELECT json_build_object(
+			'record', 'unspent_output',
+			'id', encode(output_id, 'hex'),
+			'block_height', block_height,
+			'transaction_id', encode(tx_hash, 'hex'),
+			'position', output_index,
+			'type', type,
+			'purpose', purpose,
+			'asset_id', encode(asset_id, 'hex'),
+			'asset_alias', asset_alias,
+			'amount', amount,
+			'account_id', account_id,
+			'account_alias', account_alias,
+			'control_program', encode(control_program, 'hex'),
+			'reference_data', reference_data,
+			'is_local', local
+		)::text
+		FROM annotated_outputs
+		WHERE timespan @> $1::int8
+		ORDER BY block_height, tx_pos, output_index
+	`
+	err = pg.ForQueryRows(ctx, e.db, outputsQ, timestampMS, line(&s.UnspentOutputs))
+	if err != nil {
+		return errors.Wrap(err, "exporting unspent outputs")
+	}
+
+	const balancesQ = `
+		SELECT json_build_object(
+			'record', 'balance',
+			'account_id', account_id,
+			'account_alias', max(account_alias),
+			'asset_id', encode(asset_id, 'hex'),
+			'asset_alias', max(asset_alias),
+			'amount', sum(amount)
+		)::text
+		FROM annotated_outputs
+		WHERE timespan @> $1::int8 AND account_id IS NOT NULL
+		GROUP BY account_id, asset_id
+		ORDER BY account_id, asset_id
+	`
+	err = pg.ForQueryRows(ctx, e.db, balancesQ, timestampMS, line(&s.Balances))
+	if err != nil {
+		return errors.Wrap(err, "exporting balances")
+	}
+
+	return enc.Encode(map[string]interface{}{
+		"record":          "trailer",
+		"assets":          s.Assets,
+		"unspent_outputs": s.UnspentOutputs,
+		"balances":        s.Balances,
+	})
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"chain/core/job"
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := NewExporter(db, job.New(db), bc.Hash{}, func() uint64 { return 2 })
+	e.SetDir(func() string { return dir })
+
+	// Output 1 is spent at 3000ms, after the snapshot's block;
+	// output 2 was spent at 1500ms, before it; output 3 is
+	// created after it.
+	const q = `
+		INSERT INTO annotated_outputs (block_height, tx_pos, output_index, tx_hash, timespan,
+			output_id, type, purpose, asset_id, asset_alias, asset_definition, asset_tags,
+			asset_local, amount, account_id, account_alias, account_tags, control_program,
+			reference_data, local)
+		VALUES
+			(1, 0, 0, '\x01', int8range(1000, 3000), '\x01', 'control', 'receive', '\xaa', '', '{}', '{}', true, 5, 'acc1', 'alice', '{}', '\x51', '{}', true),
+			(1, 0, 1, '\x01', int8range(1000, 1500), '\x02', 'control', 'receive', '\xaa', '', '{}', '{}', true, 7, 'acc1', 'alice', '{}', '\x51', '{}', true),
+			(3, 0, 0, '\x03', int8range(3000, NULL), '\x03', 'control', 'receive', '\xaa', '', '{}', '{}', true, 9, 'acc1', 'alice', '{}', '\x51', '{}', true)
+	`
+	_, err = db.ExecContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := e.Create(ctx, 2, bc.Hash{}, time.Unix(2, 0))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	payload, err := json.Marshal(jobPayload{ID: s.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.takeJob(ctx, &job.Job{Kind: JobKind, Payload: payload, Attempts: 1, MaxAttempts: maxAttempts})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	s, err = e.Find(ctx, s.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if s.Status != StatusComplete || s.UnspentOutputs != 1 || s.Balances != 1 {
+		t.Fatalf("snapshot = %+v, want complete with 1 unspent output and 1 balance", s)
+	}
+
+	b, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != s.SHA256 {
+		t.Errorf("file sha256 = %x, want %s", sum, s.SHA256)
+	}
+
+	f, err := os.Open(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var r map[string]interface{}
+		err := json.Unmarshal(sc.Bytes(), &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	var kinds []interface{}
+	for _, r := range records {
+		kinds = append(kinds, r["record"])
+	}
+	want := []interface{}{"header", "unspent_output", "balance", "trailer"}
+	if !testutil.DeepEqual(kinds, want) {
+		t.Fatalf("records = %v, want %v", kinds, want)
+	}
+	if got := records[2]["amount"]; got != float64(5) {
+		t.Errorf("balance = %v, want 5", got)
+	}
+}
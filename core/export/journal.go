@@ -0,0 +1,617 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/asset"
+	"chain/core/job"
+	"chain/core/query"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+)
+
+// JournalJobKind is the kind of the jobs that write journal
+// exports.
+const JournalJobKind = "journal_export"
+
+// Journal export formats.
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+)
+
+// journalPageSize is the number of journal entries read at a
+// time while writing an export.
+const journalPageSize = 1000
+
+// ErrBadFormat is returned when creating a journal export in
+// an unknown format.
+var ErrBadFormat = errors.New("invalid journal export format")
+
+// JournalExport is a request for the general ledger journal
+// of a range of blocks, in a format accounting software can
+// import, and the resulting file once written.
+//
+// The CSV format has one row per journal line, with columns
+// JournalNo, JournalDate, Currency, AccountCode, Debits,
+// Credits, Memo and Description; lines with the same JournalNo
+// make up one balanced journal entry. The OFX format has a
+// bank statement for each account code and currency that
+// this core's accounts map to, with a transaction for each
+// journal line: a debit is a deposit to the account, and a
+// credit a withdrawal.
+//
+// Account codes and currencies come from the chart of
+// accounts set with SetChart. Amounts are decimal, using the
+// decimals declared in each asset's definition.
+type JournalExport struct {
+	ID             string     `json:"id"`
+	Format         string     `json:"format"`
+	SinceHeight    uint64     `json:"since_block"`
+	UntilHeight    uint64     `json:"until_block"`
+	UntilTimestamp time.Time  `json:"until_timestamp"`
+	Status         string     `json:"status"`
+	Path           string     `json:"path,omitempty"`
+	SHA256         string     `json:"sha256,omitempty"`
+	Lines          int64      `json:"lines"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// SetJournal makes the exporter read journal entries from ind.
+// It must be called before journal exports are created.
+func (e *Exporter) SetJournal(ind *query.Indexer) {
+	e.journal = ind
+}
+
+// SetChart makes the exporter call accounts and assets to
+// find the chart of accounts used by journal exports.
+//
+// Tuples from accounts are (ledger, key, code). For the
+// account ledger, key is an account ID or alias; for the
+// issuance, retirement and external ledgers, it's an asset ID
+// or alias. The key * matches any line posted to the ledger.
+// Tuples from assets are (asset ID or alias, currency code).
+//
+// Lines without a code are exported under the account's
+// alias or ID, or the ledger's name. Assets without a code
+// are exported under the unit declared in their definition,
+// or their alias or ID.
+func (e *Exporter) SetChart(accounts, assets func() [][]string) {
+	e.accountCodes = accounts
+	e.assetCodes = assets
+}
+
+// CreateJournal requests a journal export, in the given
+// format, of the blocks after sinceHeight up to and including
+// untilHeight, whose timestamp is untilTimestamp. The export
+// is written in the background by a job.
+func (e *Exporter) CreateJournal(ctx context.Context, format string, sinceHeight, untilHeight uint64, untilTimestamp time.Time) (*JournalExport, error) {
+	if e.dir() == "" {
+		return nil, errors.WithDetail(ErrNoDir, "set the ledger_snapshot_dir configuration option")
+	}
+	if format != FormatCSV && format != FormatOFX {
+		return nil, errors.WithDetailf(ErrBadFormat, "format must be %s or %s", FormatCSV, FormatOFX)
+	}
+	const q = `
+		INSERT INTO journal_exports (format, since_height, until_height, until_timestamp)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	x := &JournalExport{
+		Format:         format,
+		SinceHeight:    sinceHeight,
+		UntilHeight:    untilHeight,
+		UntilTimestamp: untilTimestamp,
+		Status:         StatusPending,
+	}
+	err := e.db.QueryRowContext(ctx, q, format, sinceHeight, untilHeight, untilTimestamp).Scan(&x.ID, &x.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting journal export")
+	}
+	_, err = e.jobs.Enqueue(ctx, JournalJobKind, jobPayload{ID: x.ID})
+	if err != nil {
+		// Don't leave an export that's pending forever.
+		ferr := e.failJournal(ctx, x.ID, err)
+		if ferr != nil {
+			log.Error(ctx, ferr)
+		}
+		return nil, err
+	}
+	return x, nil
+}
+
+const selectJournalQ = `
+	SELECT id, format, since_height, until_height, until_timestamp, status,
+		path, sha256, lines, error, created_at, completed_at
+	FROM journal_exports
+`
+
+func scanJournalExport(sc func(...interface{}) error) (*JournalExport, error) {
+	var (
+		x           JournalExport
+		path, sum   sql.NullString
+		errMsg      sql.NullString
+		completedAt pq.NullTime
+	)
+	err := sc(&x.ID, &x.Format, &x.SinceHeight, &x.UntilHeight, &x.UntilTimestamp, &x.Status,
+		&path, &sum, &x.Lines, &errMsg, &x.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	x.Path, x.SHA256, x.Error = path.String, sum.String, errMsg.String
+	if completedAt.Valid {
+		x.CompletedAt = &completedAt.Time
+	}
+	return &x, nil
+}
+
+// FindJournal returns the journal export with the given ID.
+func (e *Exporter) FindJournal(ctx context.Context, id string) (*JournalExport, error) {
+	x, err := scanJournalExport(e.db.QueryRowContext(ctx, selectJournalQ+`WHERE id = $1`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "journal export %s", id)
+	}
+	return x, errors.Wrap(err, "loading journal export")
+}
+
+// ListJournals lists the journal exports, newest first.
+func (e *Exporter) ListJournals(ctx context.Context) ([]*JournalExport, error) {
+	rows, err := e.db.QueryContext(ctx, selectJournalQ+`ORDER BY id DESC`)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing journal exports")
+	}
+	defer rows.Close()
+	var list []*JournalExport
+	for rows.Next() {
+		x, err := scanJournalExport(rows.Scan)
+		if err != nil {
+			return nil, errors.Wrap(err, "scanning journal export")
+		}
+		list = append(list, x)
+	}
+	return list, errors.Wrap(rows.Err())
+}
+
+// takeJournalJob writes the journal export named by j, once
+// the transaction index reaches its height.
+func (e *Exporter) takeJournalJob(ctx context.Context, j *job.Job) error {
+	var p jobPayload
+	err := json.Unmarshal(j.Payload, &p)
+	if err != nil {
+		return errors.Wrap(err, "decoding job payload")
+	}
+	x, err := e.FindJournal(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if x.Status != StatusPending {
+		return nil
+	}
+	if x.UntilHeight > e.indexedHeight() {
+		return job.Postpone(indexWait)
+	}
+	err = e.takeJournal(ctx, x)
+	if err != nil && j.LastAttempt() && ctx.Err() == nil {
+		ferr := e.failJournal(ctx, x.ID, err)
+		if ferr != nil {
+			log.Error(ctx, ferr)
+		}
+	}
+	return errors.Wrapf(err, "writing journal export %s", x.ID)
+}
+
+// failJournal records that the journal export with the given
+// ID failed.
+func (e *Exporter) failJournal(ctx context.Context, id string, err error) error {
+	const q = `
+		UPDATE journal_exports SET status = 'failed', error = $2, completed_at = now()
+		WHERE id = $1
+	`
+	_, err = e.db.ExecContext(ctx, q, id, err.Error())
+	return errors.Wrap(err, "recording failed journal export")
+}
+
+// takeJournal writes the journal export x to a file and
+// records it as complete.
+func (e *Exporter) takeJournal(ctx context.Context, x *JournalExport) error {
+	dir := e.dir()
+	if dir == "" {
+		return errors.WithDetail(ErrNoDir, "set the ledger_snapshot_dir configuration option")
+	}
+	if e.journal == nil {
+		return errors.New("journal exports need the transaction index")
+	}
+	path := filepath.Join(dir, fmt.Sprintf("journal-%d-%d-%s.%s", x.SinceHeight, x.UntilHeight, x.ID, x.Format))
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "creating journal export file")
+	}
+	defer os.Remove(tmp) // no-op once renamed
+
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	ch, err := e.loadChart(ctx)
+	if err == nil {
+		if x.Format == FormatOFX {
+			err = e.writeOFX(ctx, w, x, ch)
+		} else {
+			err = e.writeCSV(ctx, w, x, ch)
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing journal export")
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return errors.Wrap(err, "writing journal export")
+	}
+
+	const q = `
+		UPDATE journal_exports
+		SET status = 'complete', path = $2, sha256 = $3, lines = $4, completed_at = now()
+		WHERE id = $1
+	`
+	_, err = e.db.ExecContext(ctx, q, x.ID, path, hex.EncodeToString(h.Sum(nil)), x.Lines)
+	return errors.Wrap(err, "recording journal export")
+}
+
+// forEachEntry calls f with each transaction's journal entry
+// in the export's range, in order.
+func (e *Exporter) forEachEntry(ctx context.Context, x *JournalExport, f func(*query.JournalEntry) error) error {
+	var after *query.JournalAfter
+	for {
+		entries, next, err := e.journal.Journal(ctx, x.SinceHeight, x.UntilHeight, after, journalPageSize)
+		if err != nil {
+			return err
+		}
+		var txs int
+		for _, entry := range entries {
+			if entry.Type != query.EntryTransaction {
+				continue
+			}
+			txs++
+			err = f(entry)
+			if err != nil {
+				return err
+			}
+		}
+		if txs < journalPageSize {
+			return nil
+		}
+		after = next
+	}
+}
+
+// writeCSV writes the journal lines of x to w as CSV,
+// counting them in x.
+func (e *Exporter) writeCSV(ctx context.Context, w io.Writer, x *JournalExport, ch *chart) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"JournalNo", "JournalDate", "Currency", "AccountCode", "Debits", "Credits", "Memo", "Description"})
+	if err != nil {
+		return err
+	}
+	x.Lines = 0
+	var n int
+	err = e.forEachEntry(ctx, x, func(entry *query.JournalEntry) error {
+		n++
+		memo := "Transaction " + entry.TransactionID.String()
+		for _, l := range entry.Lines {
+			var debit, credit string
+			if l.Debit > 0 {
+				debit = ch.amount(l.AssetID, l.Debit)
+			} else {
+				credit = ch.amount(l.AssetID, l.Credit)
+			}
+			err := cw.Write([]string{
+				strconv.Itoa(n),
+				entry.Timestamp.UTC().Format("2006-01-02"),
+				ch.currency(l.AssetID, l.AssetAlias),
+				ch.code(l),
+				debit,
+				credit,
+				memo,
+				lineDescription(l),
+			})
+			if err != nil {
+				return err
+			}
+			x.Lines++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// statement collects the lines of one OFX bank statement.
+type statement struct {
+	code, currency string
+	assetID        bc.AssetID
+	balance        uint64
+	trns           []statementTrn
+}
+
+type statementTrn struct {
+	fitID  string
+	posted time.Time
+	amount string // signed decimal
+	name   string
+	memo   string
+}
+
+// writeOFX writes the journal lines of x posted to this
+// core's accounts to w as OFX bank statements, counting them
+// in x.
+func (e *Exporter) writeOFX(ctx context.Context, w io.Writer, x *JournalExport, ch *chart) error {
+	stmts := make(map[[2]string]*statement)
+	stmt := func(code string, assetID bc.AssetID, assetAlias string) *statement {
+		k := [2]string{code, assetID.String()}
+		s, ok := stmts[k]
+		if !ok {
+			s = &statement{code: code, currency: ch.currency(assetID, assetAlias), assetID: assetID}
+			stmts[k] = s
+		}
+		return s
+	}
+
+	x.Lines = 0
+	err := e.forEachEntry(ctx, x, func(entry *query.JournalEntry) error {
+		for i, l := range entry.Lines {
+			if l.Ledger != query.LedgerAccount {
+				continue
+			}
+			amount := ch.amount(l.AssetID, l.Debit)
+			if l.Credit > 0 {
+				amount = "-" + ch.amount(l.AssetID, l.Credit)
+			}
+			s := stmt(ch.code(l), l.AssetID, l.AssetAlias)
+			s.trns = append(s.trns, statementTrn{
+				fitID:  fmt.Sprintf("%s-%d", entry.TransactionID.String(), i),
+				posted: entry.Timestamp,
+				amount: amount,
+				name:   lineDescription(l),
+				memo:   "Transaction " + entry.TransactionID.String(),
+			})
+			x.Lines++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Each statement ends with the balance of its accounts
+	// at the end of the range.
+	const balancesQ = `
+		SELECT account_id, COALESCE(max(account_alias), ''), asset_id, max(asset_alias), sum(amount)
+		FROM annotated_outputs
+		WHERE timespan @> $1::int8 AND account_id IS NOT NULL
+		GROUP BY account_id, asset_id
+	`
+	timestampMS := x.UntilTimestamp.UnixNano() / int64(time.Millisecond)
+	err = pg.ForQueryRows(ctx, e.db, balancesQ, timestampMS, func(accountID, accountAlias string, assetID bc.AssetID, assetAlias string, amount uint64) {
+		l := &query.JournalLine{Ledger: query.LedgerAccount, AccountID: accountID, AccountAlias: accountAlias}
+		stmt(ch.code(l), assetID, assetAlias).balance += amount
+	})
+	if err != nil {
+		return errors.Wrap(err, "querying balances")
+	}
+
+	var list []*statement
+	for _, s := range stmts {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].code != list[j].code {
+			return list[i].code < list[j].code
+		}
+		return list[i].currency < list[j].currency
+	})
+
+	end := ofxTime(x.UntilTimestamp)
+	b := &ofxWriter{w: w}
+	b.raw("OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:USASCII\r\nCHARSET:1252\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	b.open("OFX")
+	b.open("SIGNONMSGSRSV1")
+	b.open("SONRS")
+	b.status()
+	b.elem("DTSERVER", ofxTime(time.Now()))
+	b.elem("LANGUAGE", "ENG")
+	b.close("SONRS")
+	b.close("SIGNONMSGSRSV1")
+	b.open("BANKMSGSRSV1")
+	for i, s := range list {
+		b.open("STMTTRNRS")
+		b.elem("TRNUID", strconv.Itoa(i+1))
+		b.status()
+		b.open("STMTRS")
+		b.elem("CURDEF", s.currency)
+		b.open("BANKACCTFROM")
+		b.elem("BANKID", "CHAIN")
+		b.elem("ACCTID", s.code)
+		b.elem("ACCTTYPE", "CHECKING")
+		b.close("BANKACCTFROM")
+		b.open("BANKTRANLIST")
+		start := end
+		if len(s.trns) > 0 {
+			start = ofxTime(s.trns[0].posted)
+		}
+		b.elem("DTSTART", start)
+		b.elem("DTEND", end)
+		for _, t := range s.trns {
+			typ := "CREDIT"
+			if strings.HasPrefix(t.amount, "-") {
+				typ = "DEBIT"
+			}
+			b.open("STMTTRN")
+			b.elem("TRNTYPE", typ)
+			b.elem("DTPOSTED", ofxTime(t.posted))
+			b.elem("TRNAMT", t.amount)
+			b.elem("FITID", t.fitID)
+			b.elem("NAME", t.name)
+			b.elem("MEMO", t.memo)
+			b.close("STMTTRN")
+		}
+		b.close("BANKTRANLIST")
+		b.open("LEDGERBAL")
+		b.elem("BALAMT", ch.amount(s.assetID, s.balance))
+		b.elem("DTASOF", end)
+		b.close("LEDGERBAL")
+		b.close("STMTRS")
+		b.close("STMTTRNRS")
+	}
+	b.close("BANKMSGSRSV1")
+	b.close("OFX")
+	return b.err
+}
+
+// ofxWriter writes OFX markup, remembering the first error.
+type ofxWriter struct {
+	w   io.Writer
+	err error
+}
+
+var ofxEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", " ", "\n", " ")
+
+func (b *ofxWriter) raw(s string) {
+	if b.err == nil {
+		_, b.err = io.WriteString(b.w, s)
+	}
+}
+
+func (b *ofxWriter) open(tag string)  { b.raw("<" + tag + ">\r\n") }
+func (b *ofxWriter) close(tag string) { b.raw("</" + tag + ">\r\n") }
+
+func (b *ofxWriter) elem(tag, value string) {
+	b.raw("<" + tag + ">" + ofxEscaper.Replace(value) + "</" + tag + ">\r\n")
+}
+
+func (b *ofxWriter) status() {
+	b.open("STATUS")
+	b.elem("CODE", "0")
+	b.elem("SEVERITY", "INFO")
+	b.close("STATUS")
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+// lineDescription names the account or ledger a journal line
+// is posted to.
+func lineDescription(l *query.JournalLine) string {
+	if l.Ledger != query.LedgerAccount {
+		return l.Ledger
+	}
+	if l.AccountAlias != "" {
+		return l.AccountAlias
+	}
+	return l.AccountID
+}
+
+// chart is the chart of accounts used by a journal export,
+// along with the decimals declared by each asset.
+type chart struct {
+	accounts map[[2]string]string // (ledger, key) -> account code
+	assets   map[string]string    // asset ID or alias -> currency code
+	units    map[bc.AssetID]string
+	decimals map[bc.AssetID]int
+}
+
+func (e *Exporter) loadChart(ctx context.Context) (*chart, error) {
+	ch := &chart{
+		accounts: make(map[[2]string]string),
+		assets:   make(map[string]string),
+		units:    make(map[bc.AssetID]string),
+		decimals: make(map[bc.AssetID]int),
+	}
+	if e.accountCodes != nil {
+		for _, tup := range e.accountCodes() {
+			ch.accounts[[2]string{tup[0], tup[1]}] = tup[2]
+		}
+	}
+	if e.assetCodes != nil {
+		for _, tup := range e.assetCodes() {
+			ch.assets[tup[0]] = tup[1]
+		}
+	}
+
+	const q = `SELECT id, definition::text FROM annotated_assets`
+	err := pg.ForQueryRows(ctx, e.db, q, func(id bc.AssetID, def string) {
+		raw := json.RawMessage(def)
+		aa := &query.AnnotatedAsset{ID: id, Definition: &raw}
+		asset.AnnotatePrecision(aa)
+		if aa.Decimals != nil {
+			ch.decimals[id] = *aa.Decimals
+		}
+		if aa.Unit != "" {
+			ch.units[id] = aa.Unit
+		}
+	})
+	return ch, errors.Wrap(err, "loading asset precision")
+}
+
+// code returns the account code l is posted to.
+func (ch *chart) code(l *query.JournalLine) string {
+	keys := []string{l.AssetID.String(), l.AssetAlias, "*"}
+	if l.Ledger == query.LedgerAccount {
+		keys = []string{l.AccountID, l.AccountAlias, "*"}
+	}
+	for _, k := range keys {
+		if code, ok := ch.accounts[[2]string{l.Ledger, k}]; ok && k != "" {
+			return code
+		}
+	}
+	return lineDescription(l)
+}
+
+// currency returns the currency code of an asset.
+func (ch *chart) currency(assetID bc.AssetID, alias string) string {
+	id := assetID.String()
+	for _, k := range []string{id, alias} {
+		if code, ok := ch.assets[k]; ok && k != "" {
+			return code
+		}
+	}
+	if unit := ch.units[assetID]; unit != "" {
+		return unit
+	}
+	if alias != "" {
+		return alias
+	}
+	return id
+}
+
+// amount formats an amount of an asset as a decimal.
+func (ch *chart) amount(assetID bc.AssetID, n uint64) string {
+	return asset.FormatAmount(n, ch.decimals[assetID])
+}
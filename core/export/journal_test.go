@@ -0,0 +1,55 @@
+package export
+
+import (
+	"testing"
+
+	"chain/core/query"
+	"chain/protocol/bc"
+)
+
+func TestChart(t *testing.T) {
+	usd := bc.NewAssetID([32]byte{1})
+	gold := bc.NewAssetID([32]byte{2})
+	ch := &chart{
+		accounts: map[[2]string]string{
+			{"account", "acc1"}:     "1010",
+			{"account", "treasury"}: "1000",
+			{"issuance", "usd"}:     "3000",
+			{"issuance", "*"}:       "3900",
+		},
+		assets:   map[string]string{"usd": "USD"},
+		units:    map[bc.AssetID]string{gold: "XAU"},
+		decimals: map[bc.AssetID]int{usd: 2},
+	}
+
+	codes := []struct {
+		line query.JournalLine
+		want string
+	}{
+		{query.JournalLine{Ledger: "account", AccountID: "acc1", AccountAlias: "alice"}, "1010"},
+		{query.JournalLine{Ledger: "account", AccountID: "acc2", AccountAlias: "treasury"}, "1000"},
+		{query.JournalLine{Ledger: "account", AccountID: "acc3", AccountAlias: "bob"}, "bob"},
+		{query.JournalLine{Ledger: "account", AccountID: "acc4"}, "acc4"},
+		{query.JournalLine{Ledger: "issuance", AssetID: usd, AssetAlias: "usd"}, "3000"},
+		{query.JournalLine{Ledger: "issuance", AssetID: gold, AssetAlias: "gold"}, "3900"},
+		{query.JournalLine{Ledger: "retirement", AssetID: usd, AssetAlias: "usd"}, "retirement"},
+	}
+	for _, c := range codes {
+		if got := ch.code(&c.line); got != c.want {
+			t.Errorf("code(%+v) = %q, want %q", c.line, got, c.want)
+		}
+	}
+
+	if got := ch.currency(usd, "usd"); got != "USD" {
+		t.Errorf("currency(usd) = %q, want USD", got)
+	}
+	if got := ch.currency(gold, "gold"); got != "XAU" {
+		t.Errorf("currency(gold) = %q, want the unit XAU", got)
+	}
+	if got := ch.amount(usd, 1234); got != "12.34" {
+		t.Errorf("amount(usd, 1234) = %q, want 12.34", got)
+	}
+	if got := ch.amount(gold, 7); got != "7" {
+		t.Errorf("amount(gold, 7) = %q, want 7", got)
+	}
+}
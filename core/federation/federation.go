@@ -0,0 +1,441 @@
+// Package federation keeps a directory of counterparties:
+// the cores of other organizations on the same blockchain,
+// with the endpoint each is reached at, the public key it
+// identifies itself with, and the assets exchanged with it.
+// It is the groundwork for transfers between organizations.
+//
+// A counterparty is verified with a handshake. The core sends
+// the counterparty a random challenge along with its own node
+// public key, and the counterparty answers with the
+// challenge, that key and its blockchain ID, signed with the
+// private key matching the public key in the directory. A
+// counterparty whose answer checks out is verified; one
+// whose endpoint or key changes must be verified again.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/rpc"
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Counterparty statuses.
+const (
+	StatusUnverified = "unverified"
+	StatusVerified   = "verified"
+	StatusFailed     = "failed"
+)
+
+// HandshakePath is the path, on a counterparty's endpoint,
+// of the handshake RPC.
+const HandshakePath = "/rpc/federation-handshake"
+
+// handshakeDomain prefixes the signed handshake answer, so
+// that it can't be mistaken for any other signed message.
+const handshakeDomain = "chain federation handshake v1\n"
+
+var (
+	// ErrBadCounterparty is returned for a counterparty whose
+	// fields are missing or malformed.
+	ErrBadCounterparty = errors.New("invalid counterparty")
+
+	// ErrDuplicateAlias is returned when a counterparty with
+	// the same alias already exists.
+	ErrDuplicateAlias = errors.New("duplicate counterparty alias")
+
+	// ErrHandshake is returned when a counterparty can't be
+	// reached, or its answer to the handshake doesn't check
+	// out.
+	ErrHandshake = errors.New("counterparty handshake failed")
+)
+
+// Counterparty is another organization's core. The access
+// token used to call its endpoint, if any, is never
+// returned.
+type Counterparty struct {
+	ID              string             `json:"id"`
+	Alias           string             `json:"alias,omitempty"`
+	URL             string             `json:"url"`
+	PublicKey       chainjson.HexBytes `json:"public_key"`
+	SupportedAssets []bc.AssetID       `json:"supported_assets"`
+	Status          string             `json:"status"`
+	LastError       string             `json:"last_error,omitempty"`
+	VerifiedAt      *time.Time         `json:"verified_at,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+
+	accessToken string
+}
+
+// Hello opens a handshake. It carries a random challenge and
+// the public key of the core sending it.
+type Hello struct {
+	Challenge chainjson.HexBytes `json:"challenge"`
+	PublicKey chainjson.HexBytes `json:"public_key"`
+}
+
+// Answer is the signed answer to a Hello. Message holds the
+// exact JSON bytes of an answerMessage that were signed.
+type Answer struct {
+	Message   json.RawMessage    `json:"message"`
+	Signature chainjson.HexBytes `json:"signature"`
+}
+
+type answerMessage struct {
+	Challenge    chainjson.HexBytes `json:"challenge"`
+	PeerKey      chainjson.HexBytes `json:"peer_public_key"`
+	PublicKey    chainjson.HexBytes `json:"public_key"`
+	BlockchainID bc.Hash            `json:"blockchain_id"`
+	Timestamp    time.Time          `json:"timestamp"`
+}
+
+// Directory stores counterparties and performs handshakes
+// with them.
+type Directory struct {
+	db           pg.DB
+	blockchainID bc.Hash
+	client       *http.Client
+
+	mu  sync.Mutex
+	key ed25519.PrivateKey // loaded on first use
+}
+
+// NewDirectory returns a new Directory using the given
+// database, for a core on the given blockchain. Handshakes
+// are sent with client.
+func NewDirectory(db pg.DB, blockchainID bc.Hash, client *http.Client) *Directory {
+	return &Directory{db: db, blockchainID: blockchainID, client: client}
+}
+
+func validate(c *Counterparty) error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.WithDetailf(ErrBadCounterparty, "url %q must be an absolute http or https URL", c.URL)
+	}
+	if len(c.PublicKey) != ed25519.PublicKeySize {
+		return errors.WithDetailf(ErrBadCounterparty, "public_key must be %d bytes", ed25519.PublicKeySize)
+	}
+	seen := make(map[bc.AssetID]bool)
+	for _, id := range c.SupportedAssets {
+		if seen[id] {
+			return errors.WithDetailf(ErrBadCounterparty, "asset %s is listed twice", id.String())
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Create adds a counterparty to the directory, unverified.
+// The access token, if any, is sent with the requests made
+// to the counterparty's endpoint.
+func (d *Directory) Create(ctx context.Context, c *Counterparty, accessToken string) (*Counterparty, error) {
+	err := validate(c)
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		INSERT INTO counterparties (alias, url, public_key, supported_assets, access_token)
+		VALUES (NULLIF($1, ''), $2, $3, $4, NULLIF($5, ''))
+		RETURNING id
+	`
+	var id string
+	err = d.db.QueryRowContext(ctx, q, c.Alias, c.URL, []byte(c.PublicKey),
+		assetArray(c.SupportedAssets), accessToken).Scan(&id)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetailf(ErrDuplicateAlias, "counterparty alias %q already exists", c.Alias)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting counterparty")
+	}
+	return d.Find(ctx, id, "")
+}
+
+// Update replaces a counterparty's endpoint, public key and
+// supported assets, and its access token if one is given. If
+// the endpoint or key changes, the counterparty must be
+// verified again.
+func (d *Directory) Update(ctx context.Context, id string, c *Counterparty, accessToken string) (*Counterparty, error) {
+	err := validate(c)
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		UPDATE counterparties SET
+			status = CASE WHEN url = $2 AND public_key = $3 THEN status ELSE $6 END,
+			verified_at = CASE WHEN url = $2 AND public_key = $3 THEN verified_at END,
+			last_error = CASE WHEN url = $2 AND public_key = $3 THEN last_error END,
+			url = $2, public_key = $3, supported_assets = $4,
+			access_token = COALESCE(NULLIF($5, ''), access_token), updated_at = now()
+		WHERE id = $1
+	`
+	res, err := d.db.ExecContext(ctx, q, id, c.URL, []byte(c.PublicKey),
+		assetArray(c.SupportedAssets), accessToken, StatusUnverified)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating counterparty")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "counterparty %s not found", id)
+	}
+	return d.Find(ctx, id, "")
+}
+
+// Delete removes a counterparty from the directory.
+func (d *Directory) Delete(ctx context.Context, id string) error {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM counterparties WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "deleting counterparty")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "counterparty %s not found", id)
+	}
+	return nil
+}
+
+const selectQ = `
+	SELECT id, COALESCE(alias, ''), url, public_key, supported_assets, COALESCE(access_token, ''),
+		status, COALESCE(last_error, ''), verified_at, created_at, updated_at
+	FROM counterparties
+`
+
+// Find returns the counterparty with the given ID or, if id
+// is empty, alias.
+func (d *Directory) Find(ctx context.Context, id, alias string) (*Counterparty, error) {
+	var list []*Counterparty
+	var err error
+	if id != "" {
+		list, err = d.query(ctx, selectQ+`WHERE id = $1`, id)
+	} else {
+		id = alias
+		list, err = d.query(ctx, selectQ+`WHERE alias = $1`, alias)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "counterparty %s not found", id)
+	}
+	return list[0], nil
+}
+
+// List returns up to limit counterparties, in order of
+// creation, starting after the given ID. Pass "" to start
+// with the first.
+func (d *Directory) List(ctx context.Context, status, after string, limit int) ([]*Counterparty, error) {
+	switch status {
+	case "", StatusUnverified, StatusVerified, StatusFailed:
+	default:
+		return nil, errors.WithDetailf(ErrBadCounterparty, "unknown status %q", status)
+	}
+	return d.query(ctx, selectQ+`
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`, status, after, limit)
+}
+
+func (d *Directory) query(ctx context.Context, q string, args ...interface{}) ([]*Counterparty, error) {
+	var list []*Counterparty
+	err := pg.ForQueryRows(ctx, d.db, q, append(args, func(
+		id, alias, endpoint string, pub []byte, assets pq.ByteaArray, accessToken,
+		status, lastError string, verifiedAt *time.Time, createdAt, updatedAt time.Time,
+	) {
+		c := &Counterparty{
+			ID:              id,
+			Alias:           alias,
+			URL:             endpoint,
+			PublicKey:       pub,
+			SupportedAssets: []bc.AssetID{}, // send [], not null
+			Status:          status,
+			LastError:       lastError,
+			VerifiedAt:      verifiedAt,
+			CreatedAt:       createdAt,
+			UpdatedAt:       updatedAt,
+			accessToken:     accessToken,
+		}
+		for _, b := range assets {
+			var b32 [32]byte
+			copy(b32[:], b)
+			c.SupportedAssets = append(c.SupportedAssets, bc.NewAssetID(b32))
+		}
+		list = append(list, c)
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying counterparties")
+	}
+	return list, nil
+}
+
+func assetArray(ids []bc.AssetID) pq.ByteaArray {
+	a := pq.ByteaArray{} // NOT NULL column
+	for _, id := range ids {
+		a = append(a, id.Bytes())
+	}
+	return a
+}
+
+// Verify performs the handshake with a counterparty, and
+// records the outcome: verified, or failed with the reason.
+// It returns the counterparty as recorded, and ErrHandshake
+// if the handshake failed.
+func (d *Directory) Verify(ctx context.Context, id string) (*Counterparty, error) {
+	c, err := d.Find(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	failure := d.handshake(ctx, c)
+	if failure != nil && errors.Root(failure) != ErrHandshake {
+		return nil, failure
+	}
+
+	const q = `
+		UPDATE counterparties SET status = $2, last_error = NULLIF($3, ''),
+			verified_at = CASE WHEN $2 = $4 THEN now() ELSE verified_at END, updated_at = now()
+		WHERE id = $1 AND url = $5 AND public_key = $6
+	`
+	status, msg := StatusVerified, ""
+	if failure != nil {
+		status, msg = StatusFailed, errors.Detail(failure)
+	}
+	_, err = d.db.ExecContext(ctx, q, id, status, msg, StatusVerified, c.URL, []byte(c.PublicKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "recording handshake")
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return d.Find(ctx, id, "")
+}
+
+// handshake sends c a Hello and checks its Answer.
+func (d *Directory) handshake(ctx context.Context, c *Counterparty) error {
+	key, err := d.privateKey(ctx)
+	if err != nil {
+		return err
+	}
+	hello := &Hello{
+		Challenge: make([]byte, 32),
+		PublicKey: chainjson.HexBytes(key.Public().(ed25519.PublicKey)),
+	}
+	_, err = rand.Read(hello.Challenge)
+	if err != nil {
+		return errors.Wrap(err, "generating challenge")
+	}
+
+	client := &rpc.Client{
+		BaseURL:      c.URL,
+		AccessToken:  c.accessToken,
+		BlockchainID: d.blockchainID.String(),
+		Client:       d.client,
+	}
+	var answer Answer
+	err = client.Call(ctx, HandshakePath, hello, &answer)
+	if err != nil {
+		return errors.WithDetailf(ErrHandshake, "calling %s: %s", c.URL, errors.Root(err).Error())
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(c.PublicKey), signedAnswer(answer.Message), answer.Signature) {
+		return errors.WithDetail(ErrHandshake, "the answer isn't signed with the counterparty's public key")
+	}
+	var m answerMessage
+	err = json.Unmarshal(answer.Message, &m)
+	if err != nil {
+		return errors.WithDetail(ErrHandshake, "the answer is malformed")
+	}
+	switch {
+	case !bytes.Equal(m.Challenge, hello.Challenge):
+		return errors.WithDetail(ErrHandshake, "the answer is to a different challenge")
+	case !bytes.Equal(m.PeerKey, hello.PublicKey):
+		return errors.WithDetail(ErrHandshake, "the answer is to a different core")
+	case !bytes.Equal(m.PublicKey, c.PublicKey):
+		return errors.WithDetail(ErrHandshake, "the answer names a different public key")
+	case m.BlockchainID != d.blockchainID:
+		return errors.WithDetailf(ErrHandshake, "the counterparty is on blockchain %s", m.BlockchainID.String())
+	}
+	return nil
+}
+
+// Answer answers a handshake opened by another core.
+func (d *Directory) Answer(ctx context.Context, h *Hello) (*Answer, error) {
+	if len(h.Challenge) == 0 || len(h.PublicKey) != ed25519.PublicKeySize {
+		return nil, errors.WithDetail(ErrBadCounterparty, "a handshake needs a challenge and a public key")
+	}
+	key, err := d.privateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(&answerMessage{
+		Challenge:    h.Challenge,
+		PeerKey:      h.PublicKey,
+		PublicKey:    chainjson.HexBytes(key.Public().(ed25519.PublicKey)),
+		BlockchainID: d.blockchainID,
+		Timestamp:    time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return &Answer{Message: b, Signature: ed25519.Sign(key, signedAnswer(b))}, nil
+}
+
+func signedAnswer(msg []byte) []byte {
+	return append([]byte(handshakeDomain), msg...)
+}
+
+// PublicKey returns the core's node public key, for other
+// organizations to add to their directories.
+func (d *Directory) PublicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	key, err := d.privateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// privateKey returns the node key, generating and storing it
+// if the core doesn't have one yet. If two processes race to
+// generate it, the first one stored wins.
+func (d *Directory) privateKey(ctx context.Context) (ed25519.PrivateKey, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.key != nil {
+		return d.key, nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating node key")
+	}
+	const insertQ = `INSERT INTO federation_key (private_key) VALUES ($1) ON CONFLICT DO NOTHING`
+	_, err = d.db.ExecContext(ctx, insertQ, []byte(priv))
+	if err != nil {
+		return nil, errors.Wrap(err, "storing node key")
+	}
+	var b []byte
+	err = d.db.QueryRowContext(ctx, `SELECT private_key FROM federation_key`).Scan(&b)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading node key")
+	}
+	d.key = ed25519.PrivateKey(b)
+	return d.key, nil
+}
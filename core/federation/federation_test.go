@@ -0,0 +1,170 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func newTestDirectory(t *testing.T, blockchainID bc.Hash) *Directory {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDirectory(nil, blockchainID, http.DefaultClient)
+	d.key = priv
+	return d
+}
+
+// serve returns a server answering handshakes as d.
+func serve(t *testing.T, d *Directory) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != HandshakePath {
+			http.NotFound(w, req)
+			return
+		}
+		var h Hello
+		err := json.NewDecoder(req.Body).Decode(&h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := d.Answer(req.Context(), &h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(a)
+	}))
+}
+
+func TestHandshake(t *testing.T) {
+	ctx := context.Background()
+	blockchainID := bc.NewHash([32]byte{1})
+	us := newTestDirectory(t, blockchainID)
+	them := newTestDirectory(t, blockchainID)
+	srv := serve(t, them)
+	defer srv.Close()
+
+	theirKey, err := them.PublicKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = us.handshake(ctx, &Counterparty{URL: srv.URL, PublicKey: []byte(theirKey)})
+	if err != nil {
+		t.Fatalf("handshake = %v, want nil", err)
+	}
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = us.handshake(ctx, &Counterparty{URL: srv.URL, PublicKey: []byte(otherKey)})
+	if errors.Root(err) != ErrHandshake {
+		t.Errorf("handshake with the wrong key = %v, want %v", err, ErrHandshake)
+	}
+
+	elsewhere := newTestDirectory(t, bc.NewHash([32]byte{2}))
+	elsewhere.key = them.key
+	srv2 := serve(t, elsewhere)
+	defer srv2.Close()
+	err = us.handshake(ctx, &Counterparty{URL: srv2.URL, PublicKey: []byte(theirKey)})
+	if errors.Root(err) != ErrHandshake {
+		t.Errorf("handshake with another blockchain = %v, want %v", err, ErrHandshake)
+	}
+
+	notCore := httptest.NewServer(http.NotFoundHandler())
+	defer notCore.Close()
+	err = us.handshake(ctx, &Counterparty{URL: notCore.URL, PublicKey: []byte(theirKey)})
+	if errors.Root(err) != ErrHandshake {
+		t.Errorf("handshake with a bad endpoint = %v, want %v", err, ErrHandshake)
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	pub := make([]byte, ed25519.PublicKeySize)
+	asset := bc.NewAssetID([32]byte{1})
+	cases := []*Counterparty{
+		{URL: "", PublicKey: pub},
+		{URL: "core.example.com:1999", PublicKey: pub},
+		{URL: "ftp://core.example.com", PublicKey: pub},
+		{URL: "https://core.example.com", PublicKey: pub[:31]},
+		{URL: "https://core.example.com", PublicKey: pub, SupportedAssets: []bc.AssetID{asset, asset}},
+	}
+	d := new(Directory)
+	for i, c := range cases {
+		_, err := d.Create(context.Background(), c, "")
+		if errors.Root(err) != ErrBadCounterparty {
+			t.Errorf("case %d: Create = %v, want %v", i, err, ErrBadCounterparty)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	d := NewDirectory(db, bc.Hash{}, http.DefaultClient)
+
+	pub := make([]byte, ed25519.PublicKeySize)
+	asset := bc.NewAssetID([32]byte{1})
+	var ids []string
+	for i, alias := range []string{"alice", "bob", "carol"} {
+		c, err := d.Create(ctx, &Counterparty{
+			Alias:           alias,
+			URL:             "https://" + alias + ".example.com",
+			PublicKey:       pub,
+			SupportedAssets: []bc.AssetID{asset},
+		}, "token"+alias)
+		if err != nil {
+			t.Fatalf("case %d: Create = %v", i, err)
+		}
+		ids = append(ids, c.ID)
+	}
+	pgtest.Exec(ctx, db, t, `UPDATE counterparties SET status = $1 WHERE id = $2`, StatusFailed, ids[1])
+
+	all, err := d.List(ctx, "", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("List = %d counterparties, want 3", len(all))
+	}
+	for i, c := range all {
+		if c.ID != ids[i] {
+			t.Errorf("List[%d].ID = %s, want %s", i, c.ID, ids[i])
+		}
+		if len(c.SupportedAssets) != 1 || c.SupportedAssets[0] != asset {
+			t.Errorf("List[%d].SupportedAssets = %v, want [%v]", i, c.SupportedAssets, asset)
+		}
+		if want := "token" + c.Alias; c.accessToken != want {
+			t.Errorf("List[%d].accessToken = %q, want %q", i, c.accessToken, want)
+		}
+	}
+
+	page, err := d.List(ctx, "", ids[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != ids[1] {
+		t.Errorf("List after %s, limit 1 = %v, want [%s]", ids[0], page, ids[1])
+	}
+
+	failed, err := d.List(ctx, StatusFailed, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].ID != ids[1] {
+		t.Errorf("List(%s) = %v, want [%s]", StatusFailed, failed, ids[1])
+	}
+
+	_, err = d.List(ctx, "bogus", "", 10)
+	if errors.Root(err) != ErrBadCounterparty {
+		t.Errorf("List(bogus) = %v, want %v", err, ErrBadCounterparty)
+	}
+}
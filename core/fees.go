@@ -0,0 +1,240 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"chain/core/signers"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+// feeRuleAnyAsset is the asset ID of a fee rule that applies
+// to every asset without a rule of its own.
+const feeRuleAnyAsset = "*"
+
+// feeRule is a fee charged on a spend from an account: a flat
+// amount plus a rate, in basis points, of the amount spent.
+// Fees are paid in the asset spent.
+type feeRule struct {
+	flat uint64
+	bps  uint64
+}
+
+// fee returns the fee charged on a spend of amount.
+func (r feeRule) fee(amount uint64) uint64 {
+	// Split amount so amount*bps can't overflow.
+	return r.flat + amount/10000*r.bps + amount%10000*r.bps/10000
+}
+
+// cleanFeeRule validates and canonicalizes a fee_rule tuple of
+// (asset ID, flat amount, basis points).
+func cleanFeeRule(tup []string) error {
+	if tup[0] != feeRuleAnyAsset {
+		var assetID bc.AssetID
+		err := assetID.UnmarshalText([]byte(tup[0]))
+		if err != nil {
+			return errors.WithDetailf(errBadConfigValue, "Fee rule asset must be an asset ID or *.")
+		}
+		tup[0] = assetID.String()
+	}
+	flat, err := strconv.ParseUint(tup[1], 10, 63)
+	if err != nil {
+		return errors.WithDetailf(errBadConfigValue, "Fee rule flat amount must be a non-negative integer.")
+	}
+	bps, err := strconv.ParseUint(tup[2], 10, 64)
+	if err != nil || bps > 10000 {
+		return errors.WithDetailf(errBadConfigValue, "Fee rule rate must be an integer number of basis points from 0 to 10000.")
+	}
+	tup[1] = strconv.FormatUint(flat, 10)
+	tup[2] = strconv.FormatUint(bps, 10)
+	return nil
+}
+
+// cleanFeeAccount validates a fee_account tuple of (account
+// ID).
+func cleanFeeAccount(tup []string) error {
+	if tup[0] == "" {
+		return errors.WithDetailf(errBadConfigValue, "Fee account must be an account ID.")
+	}
+	return nil
+}
+
+// checkFeeAccounts checks that each update that sets
+// fee_account names an existing account. It's done here,
+// with the request's context, rather than in cleanFeeAccount,
+// so that removing the option still works after the account
+// is gone.
+func (a *API) checkFeeAccounts(ctx context.Context, updates []configUpdate) error {
+	for _, update := range updates {
+		if update.Key != "fee_account" || update.Op == "rm" || len(update.Tuple) != 1 {
+			continue
+		}
+		_, err := signers.Find(ctx, a.db, "account", update.Tuple[0])
+		if root := errors.Root(err); root == pg.ErrUserInputNotFound || root == signers.ErrBadType {
+			return errors.WithDetailf(errBadConfigValue, "Fee account %s is not an existing account.", update.Tuple[0])
+		} else if err != nil {
+			return errors.Wrap(err, "finding fee account")
+		}
+	}
+	return nil
+}
+
+// addFees appends actions to req that charge the configured
+// fees on its spend_account and spend_account_unspent_output
+// actions. Each account pays the fee for its spends of an
+// asset in that asset, to the fee_account in a single output
+// with reference data {"fee": true}, so fees are built into
+// the same transaction as the spends they are charged on.
+// Spends from the fee account itself are free. It does
+// nothing unless both fee_account and fee_rule are configured.
+func (a *API) addFees(ctx context.Context, req *buildRequest) error {
+	if a.options == nil {
+		return nil
+	}
+	tuples, err := a.options.List(ctx, "fee_rule")
+	if err != nil {
+		return errors.Wrap(err, "loading fee rules")
+	}
+	if len(tuples) == 0 {
+		return nil
+	}
+	feeAccount, err := a.options.List(ctx, "fee_account")
+	if err != nil {
+		return errors.Wrap(err, "loading fee account")
+	}
+	if len(feeAccount) == 0 {
+		return nil
+	}
+	feeAccountID := feeAccount[0][0]
+
+	rules := make(map[string]feeRule)
+	for _, tup := range tuples {
+		flat, _ := strconv.ParseUint(tup[1], 10, 64) // validated when set
+		bps, _ := strconv.ParseUint(tup[2], 10, 64)
+		rules[tup[0]] = feeRule{flat: flat, bps: bps}
+	}
+
+	err = a.filterAliases(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	type payer struct {
+		accountID string
+		assetID   bc.AssetID
+	}
+	var (
+		payers []payer
+		fees   = make(map[payer]uint64)
+	)
+	for _, act := range req.Actions {
+		spend, err := a.chargedSpend(ctx, act)
+		if err != nil {
+			return err
+		}
+		if spend == nil || spend.AccountID == feeAccountID {
+			continue
+		}
+		rule, ok := rules[spend.AssetID.String()]
+		if !ok {
+			rule, ok = rules[feeRuleAnyAsset]
+		}
+		if !ok {
+			continue
+		}
+		fee := rule.fee(spend.Amount)
+		if fee == 0 {
+			continue
+		}
+		p := payer{spend.AccountID, spend.AssetID}
+		if _, ok := fees[p]; !ok {
+			payers = append(payers, p)
+		}
+		fees[p] += fee
+	}
+
+	for _, p := range payers {
+		req.Actions = append(req.Actions, map[string]interface{}{
+			"type":       "spend_account",
+			"account_id": p.accountID,
+			"asset_id":   p.assetID.String(),
+			"amount":     fees[p],
+		}, map[string]interface{}{
+			"type":           "control_account",
+			"account_id":     feeAccountID,
+			"asset_id":       p.assetID.String(),
+			"amount":         fees[p],
+			"reference_data": map[string]interface{}{"fee": true},
+		})
+	}
+	return nil
+}
+
+// feeSpend is a spend from an account that fees are charged
+// on.
+type feeSpend struct {
+	AccountID string     `json:"account_id"`
+	AssetID   bc.AssetID `json:"asset_id"`
+	Amount    uint64     `json:"amount"`
+}
+
+// chargedSpend returns the spend made by act, or nil if it
+// isn't a spend_account or spend_account_unspent_output
+// action. A UTXO spend is charged to the account that owns
+// the output. Unknown outputs are left for buildSingle to
+// report, but a spend that can't be decoded is an error, so
+// it can't escape its fee.
+func (a *API) chargedSpend(ctx context.Context, act map[string]interface{}) (*feeSpend, error) {
+	typ, _ := act["type"].(string)
+	if typ != "spend_account" && typ != "spend_account_unspent_output" {
+		return nil, nil
+	}
+	b, err := json.Marshal(act)
+	if err != nil {
+		return nil, err
+	}
+	if typ == "spend_account" {
+		spend := new(feeSpend)
+		err = unmarshalAction(b, spend)
+		if err != nil {
+			return nil, err
+		}
+		return spend, nil
+	}
+
+	var x struct {
+		OutputID *bc.Hash `json:"output_id"`
+	}
+	err = unmarshalAction(b, &x)
+	if err != nil {
+		return nil, err
+	}
+	if x.OutputID == nil {
+		return nil, nil
+	}
+	accountID, amt, err := a.accounts.FindUTXO(ctx, *x.OutputID)
+	if errors.Root(err) == pg.ErrUserInputNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "finding spent output")
+	}
+	return &feeSpend{AccountID: accountID, AssetID: *amt.AssetId, Amount: amt.Amount}, nil
+}
+
+// unmarshalAction decodes the JSON action b into v, accepting
+// integers sent as strings like buildSingle does.
+func unmarshalAction(b []byte, v interface{}) error {
+	b, err := httpjson.UnquoteInts(b, reflect.TypeOf(v))
+	if err == nil {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		return errors.WithDetail(errBadAction, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/generator"
+	"chain/core/pin"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+)
+
+func TestFeeRule(t *testing.T) {
+	cases := []struct {
+		rule   feeRule
+		amount uint64
+		want   uint64
+	}{
+		{feeRule{flat: 5}, 1000, 5},
+		{feeRule{bps: 25}, 10000, 25},
+		{feeRule{flat: 1, bps: 100}, 250, 3},
+		{feeRule{bps: 10000}, 1 << 62, 1 << 62},
+	}
+	for _, c := range cases {
+		if got := c.rule.fee(c.amount); got != c.want {
+			t.Errorf("%+v.fee(%d) = %d, want %d", c.rule, c.amount, got, c.want)
+		}
+	}
+}
+
+func TestCleanFeeRule(t *testing.T) {
+	cases := []struct {
+		tup    []string
+		wantOK bool
+	}{
+		{[]string{"*", "10", "25"}, true},
+		{[]string{"0000000000000000000000000000000000000000000000000000000000000001", "0", "10000"}, true},
+		{[]string{"usd", "0", "25"}, false},
+		{[]string{"*", "-1", "25"}, false},
+		{[]string{"*", "0", "10001"}, false},
+	}
+	for _, c := range cases {
+		err := cleanFeeRule(c.tup)
+		if (err == nil) != c.wantOK {
+			t.Errorf("cleanFeeRule(%v) error = %v, want ok %v", c.tup, err, c.wantOK)
+		}
+	}
+}
+
+func TestCleanFeeAccount(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	accounts := account.NewManager(db, c, pin.NewStore(db))
+	acc := coretest.CreateAccount(ctx, t, accounts, "", nil)
+	api := &API{db: db}
+
+	err := cleanFeeAccount([]string{""})
+	if errors.Root(err) != errBadConfigValue {
+		t.Errorf("cleanFeeAccount(\"\") = %v, want %v", err, errBadConfigValue)
+	}
+
+	cases := []struct {
+		update configUpdate
+		want   error
+	}{
+		{configUpdate{Op: "set", Key: "fee_account", Tuple: []string{acc}}, nil},
+		{configUpdate{Op: "set", Key: "fee_account", Tuple: []string{"acc-missing"}}, errBadConfigValue},
+		{configUpdate{Op: "rm", Key: "fee_account", Tuple: []string{"acc-missing"}}, nil},
+	}
+	for _, c := range cases {
+		err = api.checkFeeAccounts(ctx, []configUpdate{c.update})
+		if errors.Root(err) != c.want {
+			t.Errorf("checkFeeAccounts(%+v) = %v, want %v", c.update, err, c.want)
+		}
+	}
+}
+
+func TestChargedSpend(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	g := generator.New(c, nil, db)
+	pinStore := pin.NewStore(db)
+	coretest.CreatePins(ctx, t, pinStore)
+	assets := asset.NewRegistry(db, c, pinStore)
+	accounts := account.NewManager(db, c, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	api := &API{db: db, chain: c, assets: assets, accounts: accounts}
+
+	alice := coretest.CreateAccount(ctx, t, accounts, "", nil)
+	assetID := coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	_, _, outID := coretest.IssueAssets(ctx, t, c, g, assets, accounts, assetID, 100, alice)
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	cases := []struct {
+		act  map[string]interface{}
+		want *feeSpend
+	}{{
+		act:  map[string]interface{}{"type": "spend_account", "account_id": "acc1", "asset_id": assetID.String(), "amount": 7},
+		want: &feeSpend{AccountID: "acc1", AssetID: assetID, Amount: 7},
+	}, {
+		act:  map[string]interface{}{"type": "spend_account", "account_id": "acc1", "asset_id": assetID.String(), "amount": "7"},
+		want: &feeSpend{AccountID: "acc1", AssetID: assetID, Amount: 7},
+	}, {
+		act:  map[string]interface{}{"type": "spend_account_unspent_output", "output_id": outID.String()},
+		want: &feeSpend{AccountID: alice, AssetID: assetID, Amount: 100},
+	}, {
+		act:  map[string]interface{}{"type": "spend_account_unspent_output", "output_id": new(bc.Hash).String()},
+		want: nil,
+	}, {
+		act:  map[string]interface{}{"type": "control_account", "account_id": alice, "asset_id": assetID.String(), "amount": 7},
+		want: nil,
+	}}
+	for i, tc := range cases {
+		got, err := api.chargedSpend(ctx, tc.act)
+		if err != nil {
+			t.Fatalf("case %d: chargedSpend = %v", i, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: chargedSpend = %+v, want %+v", i, got, tc.want)
+		}
+	}
+
+	bad := map[string]interface{}{"type": "spend_account", "account_id": "acc1", "asset_id": assetID.String(), "amount": "seven"}
+	_, err := api.chargedSpend(ctx, bad)
+	if errors.Root(err) != errBadAction {
+		t.Errorf("chargedSpend(%v) = %v, want %v", bad, err, errBadAction)
+	}
+}
@@ -0,0 +1,130 @@
+// Package freeze records assets and accounts that have been
+// administratively frozen, and checks those records when
+// transactions are built.
+//
+// A frozen asset can't be issued, spent or received by
+// transactions built by this core. A frozen account can't
+// spend or receive anything. Freezes are enforced when
+// building transactions; they don't affect the blockchain
+// itself, so transactions built elsewhere are unaffected.
+package freeze
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Object types that may be frozen.
+const (
+	TypeAsset   = "asset"
+	TypeAccount = "account"
+)
+
+var (
+	// ErrFrozen is returned when a transaction would
+	// use a frozen asset or account.
+	ErrFrozen = errors.New("frozen")
+
+	// ErrBadType is returned for an unknown object type.
+	ErrBadType = errors.New("object type must be asset or account")
+)
+
+// Freeze describes a frozen asset or account.
+type Freeze struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Create freezes the object of the given type and ID,
+// recording reason. Freezing an object that is already
+// frozen replaces the reason.
+func Create(ctx context.Context, db pg.DB, typ, id, reason string) (*Freeze, error) {
+	if typ != TypeAsset && typ != TypeAccount {
+		return nil, errors.WithDetailf(ErrBadType, "unknown type %q", typ)
+	}
+	const q = `
+		INSERT INTO freezes (type, id, reason) VALUES ($1, $2, $3)
+		ON CONFLICT (type, id) DO UPDATE SET reason = $3
+		RETURNING created_at
+	`
+	f := &Freeze{Type: typ, ID: id, Reason: reason}
+	err := db.QueryRowContext(ctx, q, typ, id, reason).Scan(&f.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return f, nil
+}
+
+// Delete unfreezes the object of the given type and ID.
+// It returns pg.ErrUserInputNotFound if the object isn't
+// frozen.
+func Delete(ctx context.Context, db pg.DB, typ, id string) error {
+	const q = `DELETE FROM freezes WHERE type = $1 AND id = $2`
+	res, err := db.ExecContext(ctx, q, typ, id)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "%s %s is not frozen", typ, id)
+	}
+	return nil
+}
+
+// List returns all current freezes, oldest first.
+func List(ctx context.Context, db pg.DB) ([]*Freeze, error) {
+	const q = `SELECT type, id, reason, created_at FROM freezes ORDER BY created_at, type, id`
+	var freezes []*Freeze
+	err := pg.ForQueryRows(ctx, db, q, func(typ, id, reason string, createdAt time.Time) {
+		freezes = append(freezes, &Freeze{
+			Type:      typ,
+			ID:        id,
+			Reason:    reason,
+			CreatedAt: createdAt,
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return freezes, nil
+}
+
+// CheckAsset returns ErrFrozen if the asset is frozen.
+//
+// Freezes are read from the database on every call rather
+// than cached, so a freeze takes effect immediately on all
+// processes of a core.
+func CheckAsset(ctx context.Context, db pg.DB, assetID bc.AssetID) error {
+	id, err := assetID.MarshalText()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	return check(ctx, db, TypeAsset, string(id))
+}
+
+// CheckAccount returns ErrFrozen if the account is frozen.
+func CheckAccount(ctx context.Context, db pg.DB, accountID string) error {
+	return check(ctx, db, TypeAccount, accountID)
+}
+
+func check(ctx context.Context, db pg.DB, typ, id string) error {
+	const q = `SELECT reason FROM freezes WHERE type = $1 AND id = $2`
+	var reason string
+	err := db.QueryRowContext(ctx, q, typ, id).Scan(&reason)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err)
+	}
+	return errors.WithDetailf(ErrFrozen, "%s %s is frozen: %s", typ, id, reason)
+}
@@ -0,0 +1,80 @@
+package freeze
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+func TestFreezeAccount(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+
+	err := CheckAccount(ctx, db, "acc1")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	_, err = Create(ctx, db, TypeAccount, "acc1", "fraud")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = CheckAccount(ctx, db, "acc1")
+	if errors.Root(err) != ErrFrozen {
+		t.Errorf("CheckAccount(acc1) = %v, want %v", err, ErrFrozen)
+	}
+	err = CheckAccount(ctx, db, "acc2")
+	if err != nil {
+		t.Errorf("CheckAccount(acc2) = %v, want nil", err)
+	}
+
+	err = Delete(ctx, db, TypeAccount, "acc1")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = CheckAccount(ctx, db, "acc1")
+	if err != nil {
+		t.Errorf("after unfreezing, CheckAccount(acc1) = %v, want nil", err)
+	}
+	err = Delete(ctx, db, TypeAccount, "acc1")
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("deleting missing freeze = %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+}
+
+func TestFreezeAsset(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+
+	assetID := bc.NewAssetID([32]byte{1})
+	id, err := assetID.MarshalText()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = Create(ctx, db, TypeAsset, string(id), "compromised issuer")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = CheckAsset(ctx, db, assetID)
+	if errors.Root(err) != ErrFrozen {
+		t.Errorf("CheckAsset = %v, want %v", err, ErrFrozen)
+	}
+
+	freezes, err := List(ctx, db)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(freezes) != 1 || freezes[0].ID != string(id) || freezes[0].Reason != "compromised issuer" {
+		t.Errorf("List = %+v, want one freeze of %s", freezes, id)
+	}
+
+	_, err = Create(ctx, db, "block", "x", "nope")
+	if errors.Root(err) != ErrBadType {
+		t.Errorf("Create with bad type = %v, want %v", err, ErrBadType)
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/asset"
+	"chain/core/freeze"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+type freezeRequest struct {
+	Type   string  `json:"type"`
+	ID     *string `json:"id"`
+	Alias  *string `json:"alias"`
+	Reason string  `json:"reason"`
+}
+
+// freezeList is the response to /list-freezes.
+type freezeList struct {
+	Items []*freeze.Freeze `json:"items"`
+}
+
+// POST /create-freeze
+func (a *API) createFreeze(ctx context.Context, x freezeRequest) (*freeze.Freeze, error) {
+	if x.Reason == "" {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "a reason is required")
+	}
+	id, err := a.freezeObjectID(ctx, x)
+	if err != nil {
+		return nil, err
+	}
+	return freeze.Create(ctx, a.db, x.Type, id, x.Reason)
+}
+
+// POST /delete-freeze
+func (a *API) deleteFreeze(ctx context.Context, x freezeRequest) error {
+	id, err := a.freezeObjectID(ctx, x)
+	if err != nil {
+		return err
+	}
+	return freeze.Delete(ctx, a.db, x.Type, id)
+}
+
+// POST /list-freezes
+func (a *API) listFreezes(ctx context.Context) (*freezeList, error) {
+	freezes, err := freeze.List(ctx, a.db)
+	if err != nil {
+		return nil, err
+	}
+	if freezes == nil {
+		freezes = []*freeze.Freeze{} // send [], not null
+	}
+	return &freezeList{Items: freezes}, nil
+}
+
+// freezeObjectID returns the canonical ID of the asset or
+// account named in x, looking it up by alias if necessary.
+func (a *API) freezeObjectID(ctx context.Context, x freezeRequest) (string, error) {
+	if (x.ID == nil) == (x.Alias == nil) {
+		return "", errors.Wrap(errBadFreezeIdentifier)
+	}
+
+	switch x.Type {
+	case freeze.TypeAsset:
+		if x.ID != nil {
+			var assetID bc.AssetID
+			err := assetID.UnmarshalText([]byte(*x.ID))
+			if err != nil {
+				return "", errors.WithDetailf(asset.ErrBadAssetID, "invalid asset ID %q", *x.ID)
+			}
+			b, err := assetID.MarshalText()
+			return string(b), err
+		}
+		ast, err := a.assets.FindByAlias(ctx, *x.Alias)
+		if err != nil {
+			return "", errors.Wrap(err, "find asset by alias")
+		}
+		b, err := ast.AssetID.MarshalText()
+		return string(b), err
+	case freeze.TypeAccount:
+		if x.ID != nil {
+			return *x.ID, nil
+		}
+		acct, err := a.accounts.FindByAlias(ctx, *x.Alias)
+		if err != nil {
+			return "", errors.Wrap(err, "find account by alias")
+		}
+		return acct.ID, nil
+	default:
+		return "", errors.WithDetailf(freeze.ErrBadType, "unknown type %q", x.Type)
+	}
+}
@@ -67,7 +67,20 @@ func (g *Generator) makeBlock(ctx context.Context) (err error) {
 		g.mu.Lock()
 		txs := g.pool
 		g.pool = nil
+		if g.maxTxs != nil {
+			if n := g.maxTxs(); n > 0 && n < len(txs) {
+				// The pool is in topological order, so
+				// the remainder can wait for a later block.
+				txs, g.pool = txs[:n:n], txs[n:]
+			}
+		}
 		g.poolHashes = make(map[bc.Hash]bool)
+		for _, tx := range g.pool {
+			g.poolHashes[tx.ID] = true
+		}
+		if len(g.pool) > 0 && g.instant {
+			g.Trigger()
+		}
 		g.mu.Unlock()
 
 		b, s, err = g.chain.GenerateBlock(ctx, latestBlock, latestSnapshot, time.Now(), txs)
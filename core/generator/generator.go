@@ -32,6 +32,20 @@ type Generator struct {
 	chain   *protocol.Chain
 	signers []BlockSigner
 
+	// instant, when set, makes Generate produce a block as
+	// soon as a transaction is submitted instead of waiting
+	// for the next block period.
+	instant bool
+
+	// period and maxTxs, if set, are consulted before each
+	// block, so their values can change while Generate runs.
+	period func() time.Duration
+	maxTxs func() int
+
+	// trigger wakes Generate to make a block before the
+	// block period has elapsed.
+	trigger chan struct{}
+
 	mu         sync.Mutex
 	pool       []*legacy.Tx // in topological order
 	poolHashes map[bc.Hash]bool
@@ -47,10 +61,53 @@ func New(
 		db:         db,
 		chain:      c,
 		signers:    s,
+		trigger:    make(chan struct{}, 1),
 		poolHashes: make(map[bc.Hash]bool),
 	}
 }
 
+// SetInstant puts g in instant mode: every submitted
+// transaction is confirmed in a new block right away,
+// without waiting for the block period to elapse.
+// Transactions submitted while a block is being made
+// are batched into the following block, so block heights
+// advance once per confirmation for serial submitters.
+//
+// Instant mode is meant for development and testing.
+// It must be called before Generate.
+func (g *Generator) SetInstant(instant bool) {
+	g.instant = instant
+}
+
+// SetBlockPeriod makes Generate call f to find the time
+// to wait between blocks. If f returns zero, the period
+// passed to Generate is used.
+// It must be called before Generate.
+func (g *Generator) SetBlockPeriod(f func() time.Duration) {
+	g.period = f
+}
+
+// SetMaxBlockTxs makes the generator call f to find the
+// maximum number of pending transactions to include in
+// each block. Any remaining transactions stay in the pool
+// for the next block. If f returns zero, blocks are
+// unlimited.
+// It must be called before Generate.
+func (g *Generator) SetMaxBlockTxs(f func() int) {
+	g.maxTxs = f
+}
+
+// Trigger asks Generate to make a block now instead
+// of waiting for the rest of the block period.
+// As always, no block is made if there are no
+// pending transactions.
+func (g *Generator) Trigger() {
+	select {
+	case g.trigger <- struct{}{}:
+	default: // a block is already due
+	}
+}
+
 // PendingTxs returns all of the pendings txs that will be
 // included in the generator's next block.
 func (g *Generator) PendingTxs() []*legacy.Tx {
@@ -73,12 +130,16 @@ func (g *Generator) Submit(ctx context.Context, tx *legacy.Tx) error {
 
 	g.poolHashes[tx.ID] = true
 	g.pool = append(g.pool, tx)
+	if g.instant {
+		g.Trigger()
+	}
 	return nil
 }
 
 // Generate runs in a loop, making one new block
-// every block period. It returns when its context
-// is canceled.
+// every block period (or, in instant mode, whenever
+// a transaction is submitted). It returns when its
+// context is canceled.
 // After each attempt to make a block, it calls health
 // to report either an error or nil to indicate success.
 func (g *Generator) Generate(
@@ -86,18 +147,38 @@ func (g *Generator) Generate(
 	period time.Duration,
 	health func(error),
 ) {
-	ticks := time.Tick(period)
+	next := time.Now()
 	for {
+		next = next.Add(g.blockPeriod(period))
+		if now := time.Now(); next.Before(now) {
+			// Like time.Tick, drop any periods missed
+			// while making the last block.
+			next = now
+		}
+		timer := time.NewTimer(next.Sub(time.Now()))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			log.Printf(ctx, "Deposed, Generate exiting")
 			return
-		case <-ticks:
-			err := g.makeBlock(ctx)
-			health(err)
-			if err != nil {
-				log.Error(ctx, err)
-			}
+		case <-timer.C:
+		case <-g.trigger:
+			timer.Stop()
+			next = time.Now()
+		}
+		err := g.makeBlock(ctx)
+		health(err)
+		if err != nil {
+			log.Error(ctx, err)
+		}
+	}
+}
+
+func (g *Generator) blockPeriod(def time.Duration) time.Duration {
+	if g.period != nil {
+		if d := g.period(); d > 0 {
+			return d
 		}
 	}
+	return def
 }
@@ -88,6 +88,76 @@ func TestGeneratorSignatureFailures(t *testing.T) {
 	}
 }
 
+func TestGeneratorInstant(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	g := New(c, nil, pgtest.NewTx(t))
+	g.SetInstant(true)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Use a block period long enough that only a
+	// submitted transaction can trigger a block.
+	go g.Generate(ctx, time.Hour, func(err error) {
+		if err != nil {
+			t.Log(err)
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		height := c.Height()
+		tx := bctest.NewIssuanceTx(t, prottest.Initial(t, c).Hash())
+		err := g.Submit(ctx, tx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+
+		select {
+		case <-c.BlockWaiter(height + 1):
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", height+1)
+		}
+		block, err := c.GetBlock(ctx, height+1)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(block.Transactions) != 1 || block.Transactions[0].ID != tx.ID {
+			t.Errorf("block %d: got %d txs, want only the submitted tx", height+1, len(block.Transactions))
+		}
+	}
+}
+
+func TestGeneratorMaxBlockTxs(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	g := New(c, nil, pgtest.NewTx(t))
+	g.SetMaxBlockTxs(func() int { return 2 })
+
+	for i := 0; i < 3; i++ {
+		g.pool = append(g.pool, bctest.NewIssuanceTx(t, prottest.Initial(t, c).Hash()))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	height := c.Height()
+	go g.Generate(ctx, time.Hour, func(error) {})
+	g.Trigger()
+	<-c.BlockWaiter(height + 1)
+	g.Trigger()
+	<-c.BlockWaiter(height + 2)
+
+	for h, want := range map[uint64]int{height + 1: 2, height + 2: 1} {
+		block, err := c.GetBlock(ctx, h)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(block.Transactions) != want {
+			t.Errorf("block %d: got %d txs, want %d", h, len(block.Transactions), want)
+		}
+	}
+}
+
 func TestGetAndAddBlockSignatures(t *testing.T) {
 	c := prottest.NewChain(t, prottest.WithBlockSigners(1, 1))
 	pubkeys, privkeys := prottest.BlockKeyPairs(c)
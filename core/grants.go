@@ -104,8 +104,9 @@ func (a *API) createGrant(ctx context.Context, x apiGrant) (*apiGrant, error) {
 			return nil, errors.WithDetail(httpjson.ErrBadRequest, `guard data should contain exactly one field, "id"`)
 		}
 	} else if x.GuardType == "x509" {
-		if len(x.GuardData) != 1 {
-			return nil, errors.WithDetail(httpjson.ErrBadRequest, `guard data should contain exactly one field, "subject"`)
+		_, hasCA := x.GuardData["ca_fingerprint"]
+		if len(x.GuardData) != 1 && (len(x.GuardData) != 2 || !hasCA) {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, `guard data should contain the field "subject" and optionally "ca_fingerprint"`)
 		} else if subj, ok := x.GuardData["subject"].(map[string]interface{}); ok {
 			for k := range subj {
 				if !authz.ValidX509SubjectField(k) {
@@ -115,6 +116,16 @@ func (a *API) createGrant(ctx context.Context, x apiGrant) (*apiGrant, error) {
 		} else {
 			return nil, errors.WithDetail(httpjson.ErrBadRequest, "map of subject attributes required")
 		}
+		if hasCA {
+			// Grants for partners' certificates name the key of
+			// the CA that issued them, so a partner can't claim a
+			// subject issued by another CA, even with an
+			// intermediate named like it.
+			ca, _ := x.GuardData["ca_fingerprint"].(string)
+			if !authz.ValidCAFingerprint(ca) {
+				return nil, errors.WithDetail(httpjson.ErrBadRequest, "ca_fingerprint must be the lowercase hex SHA-256 hash of the CA's SubjectPublicKeyInfo")
+			}
+		}
 	} else {
 		return nil, errors.WithDetail(httpjson.ErrBadRequest, "invalid guard type: "+x.GuardType)
 	}
@@ -15,7 +15,7 @@ func TestCreatGrantValidation(t *testing.T) {
 	ctx := context.Background()
 	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
 
-	accessTokens := &accesstoken.CredentialStore{db}
+	accessTokens := &accesstoken.CredentialStore{DB: db}
 	_, err := accessTokens.Create(ctx, "test-token", "")
 	if err != nil {
 		t.Fatal(err)
@@ -46,6 +46,16 @@ func TestCreatGrantValidation(t *testing.T) {
 			},
 			Policy: "client-readwrite",
 		},
+		{
+			GuardType: "x509",
+			GuardData: map[string]interface{}{
+				"subject": map[string]interface{}{
+					"CN": "partner-client",
+				},
+				"ca_fingerprint": "abababababababababababababababababababababababababababababababab",
+			},
+			Policy: "client-readonly",
+		},
 	}
 
 	for i, c := range validCases {
@@ -115,6 +125,32 @@ func TestCreatGrantValidation(t *testing.T) {
 			},
 			Policy: "client-readwrite",
 		},
+
+		// x509 issuer named instead of fingerprinted
+		{
+			GuardType: "x509",
+			GuardData: map[string]interface{}{
+				"subject": map[string]interface{}{
+					"CN": "valid-cn",
+				},
+				"issuer": map[string]interface{}{
+					"CN": "partner-ca",
+				},
+			},
+			Policy: "client-readwrite",
+		},
+
+		// invalid x509 CA fingerprint
+		{
+			GuardType: "x509",
+			GuardData: map[string]interface{}{
+				"subject": map[string]interface{}{
+					"CN": "valid-cn",
+				},
+				"ca_fingerprint": "partner-ca",
+			},
+			Policy: "client-readwrite",
+		},
 	}
 
 	for i, c := range errCases {
@@ -129,7 +165,7 @@ func TestDeleteGrants(t *testing.T) {
 	ctx := context.Background()
 	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
 
-	accessTokens := &accesstoken.CredentialStore{db}
+	accessTokens := &accesstoken.CredentialStore{DB: db}
 	_, err := accessTokens.Create(ctx, "test-token", "")
 	if err != nil {
 		t.Fatal(err)
@@ -226,7 +262,7 @@ func TestDeleteGrantsByAccessToken(t *testing.T) {
 	ctx := context.Background()
 	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
 
-	accessTokens := &accesstoken.CredentialStore{db}
+	accessTokens := &accesstoken.CredentialStore{DB: db}
 	_, err := accessTokens.Create(ctx, "test-token-0", "")
 	if err != nil {
 		t.Fatal(err)
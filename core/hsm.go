@@ -23,6 +23,7 @@ func init() {
 func MockHSM(hsm *mockhsm.HSM) RunOption {
 	return func(a *API) {
 		h := &mockHSMHandler{MockHSM: hsm}
+		a.signTemplate = h.mockhsmSignTemplate
 
 		needConfig := a.needConfig()
 		a.mux.Handle("/mockhsm/create-block-key", jsonHandler(h.mockhsmCreateBlockKey))
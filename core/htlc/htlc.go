@@ -0,0 +1,500 @@
+// Package htlc tracks hash time-locked contracts: an amount of
+// an asset locked by a payer for a payee, who can claim it by
+// revealing the preimage of a SHA-256 hash before the contract
+// expires. After it expires, only the payer can spend it, to
+// refund it.
+//
+// HTLCs settle a transfer against another ledger without a
+// trusted intermediary. The payer locks an amount on one
+// ledger and the payee locks the counter-amount under the same
+// hash on the other. Whoever made the preimage claims the
+// payee's HTLC, revealing it in that ledger, and the other
+// party uses it to claim the payer's. The second HTLC must
+// expire before the first, so that the preimage comes out in
+// time to use it.
+//
+// An HTLC is created when its program is derived, and is
+// funded once a block confirms an output of its asset and
+// amount to the program. It's expired once its expiry passes
+// while it's funded, and claimed or refunded once a block
+// confirms a transaction spending its output, as told by the
+// spending input's arguments. A claimed HTLC records the
+// preimage. Each change of status is recorded as an event.
+package htlc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/event"
+	"chain/core/pin"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/protocol/vm"
+	"chain/protocol/vm/vmutil"
+)
+
+// PinName is used to identify the pin associated with the
+// HTLC block processor.
+const PinName = "htlcs"
+
+// HTLC statuses. Claimed and refunded are final.
+const (
+	StatusCreated  = "created"
+	StatusFunded   = "funded"
+	StatusExpired  = "expired"
+	StatusClaimed  = "claimed"
+	StatusRefunded = "refunded"
+)
+
+var (
+	// ErrBadHTLC is returned by Create for an HTLC with
+	// invalid fields, and by the spend action for a preimage
+	// that doesn't match the HTLC's hash.
+	ErrBadHTLC = errors.New("invalid HTLC")
+
+	// ErrBadState is returned for an operation the HTLC's
+	// status or expiry doesn't allow, such as claiming an
+	// HTLC that has expired.
+	ErrBadState = errors.New("HTLC status does not allow this")
+
+	// ErrBadStatus is returned by List for an unknown status.
+	ErrBadStatus = errors.New("unknown HTLC status")
+)
+
+// HTLC is an amount of an asset locked for a payee until the
+// hash's preimage is revealed or the HTLC expires. The payee
+// is paid to their account on this core or to a control
+// program; a refund goes to the payer's account.
+type HTLC struct {
+	ID                  string             `json:"id"`
+	AssetID             bc.AssetID         `json:"asset_id"`
+	Amount              uint64             `json:"amount"`
+	PayerAccountID      string             `json:"payer_account_id"`
+	PayeeAccountID      string             `json:"payee_account_id,omitempty"`
+	PayeeControlProgram chainjson.HexBytes `json:"payee_control_program,omitempty"`
+	PayerXPub           chainkd.XPub       `json:"payer_xpub"`
+	PayeeXPub           chainkd.XPub       `json:"payee_xpub"`
+	Hash                chainjson.HexBytes `json:"hash"`
+	ExpiresAt           time.Time          `json:"expires_at"`
+	CounterpartyID      string             `json:"counterparty_id,omitempty"`
+	AutoRefund          bool               `json:"auto_refund"`
+	ControlProgram      chainjson.HexBytes `json:"control_program"`
+	Status              string             `json:"status"`
+	Preimage            chainjson.HexBytes `json:"preimage,omitempty"`
+	OutputID            *bc.Hash           `json:"output_id,omitempty"`
+	FundingTxID         *bc.Hash           `json:"funding_transaction_id,omitempty"`
+	SettlementTxID      *bc.Hash           `json:"settlement_transaction_id,omitempty"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+
+	keyIndex  uint64
+	sourceID  bc.Hash
+	sourcePos uint64
+	refData   bc.Hash
+}
+
+// path returns the derivation path of the HTLC's keys. Each
+// HTLC has its own, so no two share a control program.
+func (h *HTLC) path() [][]byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], h.keyIndex)
+	return [][]byte{[]byte("htlc"), idx[:]}
+}
+
+func (h *HTLC) program() ([]byte, error) {
+	derived := chainkd.DeriveXPubs([]chainkd.XPub{h.PayeeXPub, h.PayerXPub}, h.path())
+	return vmutil.HTLCProgram(h.Hash, bc.Millis(h.ExpiresAt), derived[0].PublicKey(), derived[1].PublicKey())
+}
+
+// Manager stores HTLCs and keeps their statuses up to date.
+type Manager struct {
+	db       pg.DB
+	chain    *protocol.Chain
+	pinStore *pin.Store
+}
+
+// NewManager returns a new Manager using the given database,
+// blockchain and block processor pins.
+func NewManager(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Manager {
+	return &Manager{db: db, chain: chain, pinStore: pinStore}
+}
+
+// Create derives a control program for h from the parties'
+// keys, hash and expiry, and stores h, with status created.
+func (m *Manager) Create(ctx context.Context, h *HTLC) (*HTLC, error) {
+	if h.Amount == 0 || h.Amount > 1<<63-1 {
+		return nil, errors.WithDetail(ErrBadHTLC, "amount must be positive and less than 2^63")
+	}
+	if (h.PayeeAccountID == "") == (len(h.PayeeControlProgram) == 0) {
+		return nil, errors.WithDetail(ErrBadHTLC, "the payee needs either an account or a control program")
+	}
+	var zero chainkd.XPub
+	if h.PayerXPub == zero || h.PayeeXPub == zero {
+		return nil, errors.WithDetail(ErrBadHTLC, "payer_xpub and payee_xpub are required")
+	}
+	if h.PayerXPub == h.PayeeXPub {
+		return nil, errors.WithDetail(ErrBadHTLC, "payer and payee need different keys")
+	}
+	if len(h.Hash) != sha256.Size {
+		return nil, errors.WithDetail(ErrBadHTLC, "hash must be a 32-byte SHA-256 hash")
+	}
+	if !h.ExpiresAt.After(time.Now()) {
+		return nil, errors.WithDetail(ErrBadHTLC, "expires_at must be in the future")
+	}
+	h.ExpiresAt = h.ExpiresAt.Truncate(time.Millisecond) // as precise as the program
+
+	err := m.db.QueryRowContext(ctx, `SELECT nextval('htlcs_key_index_seq')`).Scan(&h.keyIndex)
+	if err != nil {
+		return nil, errors.Wrap(err, "reserving key index")
+	}
+	h.ControlProgram, err = h.program()
+	if err != nil {
+		return nil, errors.Wrap(err, "deriving HTLC program")
+	}
+
+	const q = `
+		INSERT INTO htlcs (asset_id, amount, payer_account_id, payee_account_id, payee_control_program,
+			payer_xpub, payee_xpub, hash, expires_at, counterparty_id, auto_refund, key_index, control_program)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13)
+		RETURNING id, status, created_at, updated_at
+	`
+	err = m.db.QueryRowContext(ctx, q, h.AssetID, int64(h.Amount), h.PayerAccountID, h.PayeeAccountID,
+		[]byte(h.PayeeControlProgram), h.PayerXPub.Bytes(), h.PayeeXPub.Bytes(), []byte(h.Hash),
+		h.ExpiresAt, h.CounterpartyID, h.AutoRefund, h.keyIndex, []byte(h.ControlProgram),
+	).Scan(&h.ID, &h.Status, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting HTLC")
+	}
+	return h, nil
+}
+
+const selectQ = `
+	SELECT id, asset_id, amount, payer_account_id, COALESCE(payee_account_id, ''), payee_control_program,
+		payer_xpub, payee_xpub, hash, expires_at, COALESCE(counterparty_id, ''), auto_refund, key_index,
+		control_program, status, preimage, output_id, source_id, source_pos, ref_data_hash,
+		funding_tx_hash, settlement_tx_hash, created_at, updated_at
+	FROM htlcs
+`
+
+// Find returns the HTLC with the given ID.
+func (m *Manager) Find(ctx context.Context, id string) (*HTLC, error) {
+	list, err := m.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "HTLC %s", id)
+	}
+	return list[0], nil
+}
+
+// List returns up to limit HTLCs, oldest first, optionally
+// only those with the given status. HTLCs with IDs less than
+// or equal to after are skipped; pass the ID of the last HTLC
+// returned to get the next page, or "" to get the first.
+func (m *Manager) List(ctx context.Context, status, after string, limit int) ([]*HTLC, error) {
+	switch status {
+	case "", StatusCreated, StatusFunded, StatusExpired, StatusClaimed, StatusRefunded:
+	default:
+		return nil, errors.WithDetailf(ErrBadStatus, "status %q", status)
+	}
+	return m.query(ctx, selectQ+`
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`, status, after, limit)
+}
+
+// Refundable returns the expired HTLCs to be refunded
+// automatically.
+func (m *Manager) Refundable(ctx context.Context) ([]*HTLC, error) {
+	return m.query(ctx, selectQ+`WHERE status = $1 AND auto_refund ORDER BY id`, StatusExpired)
+}
+
+func (m *Manager) query(ctx context.Context, q string, args ...interface{}) ([]*HTLC, error) {
+	var list []*HTLC
+	err := pg.ForQueryRows(ctx, m.db, q, append(args, func(
+		id string, assetID bc.AssetID, amount int64, payerAccountID, payeeAccountID string, payeeProg []byte,
+		payerXPub, payeeXPub, hash []byte, expiresAt time.Time, counterpartyID string, autoRefund bool,
+		keyIndex int64, prog []byte, status string, preimage, outputID []byte, sourceID []byte,
+		sourcePos sql.NullInt64, refData []byte, fundingTx, settlementTx []byte, createdAt, updatedAt time.Time,
+	) error {
+		h := &HTLC{
+			ID:                  id,
+			AssetID:             assetID,
+			Amount:              uint64(amount),
+			PayerAccountID:      payerAccountID,
+			PayeeAccountID:      payeeAccountID,
+			PayeeControlProgram: payeeProg,
+			Hash:                hash,
+			ExpiresAt:           expiresAt,
+			CounterpartyID:      counterpartyID,
+			AutoRefund:          autoRefund,
+			ControlProgram:      prog,
+			Status:              status,
+			Preimage:            preimage,
+			CreatedAt:           createdAt,
+			UpdatedAt:           updatedAt,
+			keyIndex:            uint64(keyIndex),
+			sourcePos:           uint64(sourcePos.Int64),
+		}
+		copy(h.PayerXPub[:], payerXPub)
+		copy(h.PayeeXPub[:], payeeXPub)
+		for _, x := range []struct {
+			dst **bc.Hash
+			src []byte
+		}{{&h.OutputID, outputID}, {&h.FundingTxID, fundingTx}, {&h.SettlementTxID, settlementTx}} {
+			if x.src != nil {
+				*x.dst = new(bc.Hash)
+				if err := (*x.dst).Scan(x.src); err != nil {
+					return err
+				}
+			}
+		}
+		if sourceID != nil {
+			if err := h.sourceID.Scan(sourceID); err != nil {
+				return err
+			}
+			if err := h.refData.Scan(refData); err != nil {
+				return err
+			}
+		}
+		list = append(list, h)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying HTLCs")
+	}
+	return list, nil
+}
+
+// Expire marks the funded HTLCs whose expiry has passed as
+// expired, so that they can only be refunded.
+func (m *Manager) Expire(ctx context.Context) error {
+	const q = `
+		UPDATE htlcs SET status = $1, updated_at = now()
+		WHERE status = $2 AND expires_at <= now()
+		RETURNING id
+	`
+	var expired []string
+	err := pg.ForQueryRows(ctx, m.db, q, StatusExpired, StatusFunded, func(id string) {
+		expired = append(expired, id)
+	})
+	if err != nil {
+		return errors.Wrap(err, "expiring HTLCs")
+	}
+	return m.recordEvents(ctx, expired)
+}
+
+// DecodeSpendAction decodes a spend_htlc action, which spends
+// the output of an HTLC: to claim it, with the preimage,
+// signed by the payee, or, without one, to refund it, signed
+// by the payer.
+func (m *Manager) DecodeSpendAction(data []byte) (txbuilder.Action, error) {
+	a := &spendAction{htlcs: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+type spendAction struct {
+	htlcs    *Manager
+	HTLCID   string             `json:"htlc_id"`
+	Preimage chainjson.HexBytes `json:"preimage"`
+}
+
+func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	if a.HTLCID == "" {
+		return txbuilder.MissingFieldsError("htlc_id")
+	}
+	h, err := a.htlcs.Find(ctx, a.HTLCID)
+	if err != nil {
+		return err
+	}
+
+	sigInst := new(txbuilder.SigningInstruction)
+	var signer chainkd.XPub
+	if len(a.Preimage) > 0 {
+		err = CheckClaimable(h, a.Preimage)
+		if err != nil {
+			return err
+		}
+		// The transaction must be in a block before the HTLC
+		// expires.
+		b.RestrictMaxTime(h.ExpiresAt.Add(-time.Millisecond))
+		sigInst.Arguments = []chainjson.HexBytes{vm.Int64Bytes(1), a.Preimage}
+		signer = h.PayeeXPub
+	} else {
+		err = CheckRefundable(h)
+		if err != nil {
+			return err
+		}
+		b.RestrictMinTime(h.ExpiresAt)
+		sigInst.Arguments = []chainjson.HexBytes{vm.Int64Bytes(0)}
+		signer = h.PayerXPub
+	}
+	in := legacy.NewSpendInput(nil, h.sourceID, h.AssetID, h.Amount, h.sourcePos, h.ControlProgram, h.refData, nil)
+	sigInst.AddWitnessKeys([]chainkd.XPub{signer}, h.path(), 1)
+	return b.AddInput(in, sigInst)
+}
+
+// CheckClaimable returns ErrBadState unless h is funded and
+// hasn't expired, and ErrBadHTLC unless preimage is the
+// preimage of its hash.
+func CheckClaimable(h *HTLC, preimage []byte) error {
+	if h.Status != StatusFunded || !time.Now().Before(h.ExpiresAt) {
+		return errors.WithDetailf(ErrBadState, "HTLC %s is %s and expires at %s; only a funded HTLC can be claimed, before it expires",
+			h.ID, h.Status, h.ExpiresAt.Format(time.RFC3339))
+	}
+	sum := sha256.Sum256(preimage)
+	if !bytes.Equal(sum[:], h.Hash) {
+		return errors.WithDetail(ErrBadHTLC, "the preimage doesn't match the HTLC's hash")
+	}
+	return nil
+}
+
+// CheckRefundable returns ErrBadState unless h is funded or
+// expired, and its expiry has passed.
+func CheckRefundable(h *HTLC) error {
+	if (h.Status != StatusFunded && h.Status != StatusExpired) || time.Now().Before(h.ExpiresAt) {
+		return errors.WithDetailf(ErrBadState, "HTLC %s is %s and expires at %s; only a funded HTLC can be refunded, once it expires",
+			h.ID, h.Status, h.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ProcessBlocks updates the statuses of HTLCs funded or spent
+// in each new block.
+func (m *Manager) ProcessBlocks(ctx context.Context) {
+	if m.pinStore == nil {
+		return
+	}
+	m.pinStore.ProcessBlocks(ctx, m.chain, PinName, m.update)
+}
+
+// update marks the HTLCs paid in b as funded, and those whose
+// outputs are spent in b as claimed, with the preimage, or
+// refunded. Each change happens once, however many times b is
+// processed.
+func (m *Manager) update(ctx context.Context, b *legacy.Block) error {
+	var progs pq.ByteaArray
+	for _, tx := range b.Transactions {
+		for _, out := range tx.Outputs {
+			progs = append(progs, out.ControlProgram)
+		}
+	}
+	var changed []string
+	if len(progs) > 0 {
+		pending := make(map[string]*HTLC)
+		list, err := m.query(ctx, selectQ+`WHERE status = $1 AND control_program = ANY($2)`, StatusCreated, progs)
+		if err != nil {
+			return err
+		}
+		for _, h := range list {
+			pending[string(h.ControlProgram)] = h
+		}
+		for _, tx := range b.Transactions {
+			for i, out := range tx.Outputs {
+				h := pending[string(out.ControlProgram)]
+				if h == nil || *out.AssetId != h.AssetID || out.Amount != h.Amount {
+					continue
+				}
+				resOut, ok := tx.Entries[*tx.ResultIds[i]].(*bc.Output)
+				if !ok {
+					continue
+				}
+				const q = `
+					UPDATE htlcs SET status = $2, output_id = $3, source_id = $4, source_pos = $5,
+						ref_data_hash = $6, funding_tx_hash = $7, updated_at = now()
+					WHERE id = $1 AND status = $8
+				`
+				res, err := m.db.ExecContext(ctx, q, h.ID, StatusFunded, tx.OutputID(i), *resOut.Source.Ref,
+					int64(resOut.Source.Position), *resOut.Data, tx.ID, StatusCreated)
+				if err != nil {
+					return errors.Wrap(err, "marking HTLC funded")
+				}
+				if n, _ := res.RowsAffected(); n == 1 {
+					changed = append(changed, h.ID)
+				}
+				delete(pending, string(out.ControlProgram))
+			}
+		}
+	}
+
+	type settlement struct {
+		status   string
+		preimage []byte
+		txID     bc.Hash
+	}
+	var spent pq.ByteaArray
+	settlements := make(map[bc.Hash]settlement)
+	for _, tx := range b.Transactions {
+		for i, inpID := range tx.Tx.InputIDs {
+			sp, err := tx.Spend(inpID)
+			if err != nil {
+				continue
+			}
+			// The selector is the first argument; a claim's
+			// preimage is the second. The block is valid, so
+			// the program has checked them.
+			s := settlement{status: StatusRefunded, txID: tx.ID}
+			args := tx.Inputs[i].Arguments()
+			if len(args) > 1 && vm.AsBool(args[0]) {
+				s.status, s.preimage = StatusClaimed, args[1]
+			}
+			spent = append(spent, sp.SpentOutputId.Bytes())
+			settlements[*sp.SpentOutputId] = s
+		}
+	}
+	if len(spent) > 0 {
+		var settled []bc.Hash
+		const q = `SELECT output_id FROM htlcs WHERE output_id = ANY($1) AND status IN ($2, $3)`
+		err := pg.ForQueryRows(ctx, m.db, q, spent, StatusFunded, StatusExpired, func(outputID bc.Hash) {
+			settled = append(settled, outputID)
+		})
+		if err != nil {
+			return errors.Wrap(err, "finding settled HTLCs")
+		}
+		for _, outputID := range settled {
+			s := settlements[outputID]
+			const q = `
+				UPDATE htlcs SET status = $2, preimage = $3, settlement_tx_hash = $4, updated_at = now()
+				WHERE output_id = $1 AND status IN ($5, $6)
+				RETURNING id
+			`
+			err = pg.ForQueryRows(ctx, m.db, q, outputID, s.status, s.preimage, s.txID,
+				StatusFunded, StatusExpired, func(id string) { changed = append(changed, id) })
+			if err != nil {
+				return errors.Wrap(err, "marking HTLC settled")
+			}
+		}
+	}
+	return m.recordEvents(ctx, changed)
+}
+
+func (m *Manager) recordEvents(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		h, err := m.Find(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = event.Record(ctx, m.db, event.HTLCUpdated, h.ID, h)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package htlc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"chain/crypto/ed25519/chainkd"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func newXPub(t *testing.T) chainkd.XPub {
+	_, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return xpub
+}
+
+func TestProgram(t *testing.T) {
+	payer, payee := newXPub(t), newXPub(t)
+	hash := sha256.Sum256([]byte("secret"))
+	expiresAt := time.Now().Add(time.Hour)
+	h1 := &HTLC{PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: expiresAt, keyIndex: 1}
+	h2 := &HTLC{PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: expiresAt, keyIndex: 2}
+
+	p1, err := h1.program()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	again, err := h1.program()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !bytes.Equal(p1, again) {
+		t.Errorf("program not deterministic: %x, then %x", p1, again)
+	}
+	p2, err := h2.program()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if bytes.Equal(p1, p2) {
+		t.Errorf("HTLCs with key indexes 1 and 2 share program %x", p1)
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	payer, payee := newXPub(t), newXPub(t)
+	hash := sha256.Sum256([]byte("secret"))
+	later := time.Now().Add(time.Hour)
+	cases := []*HTLC{
+		{PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: later},
+		{Amount: 1 << 63, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: later},
+		{Amount: 10, PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: later},
+		{Amount: 10, PayeeAccountID: "acc2", PayeeControlProgram: []byte{0x51}, PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: later},
+		{Amount: 10, PayeeAccountID: "acc2", PayerXPub: payer, Hash: hash[:], ExpiresAt: later},
+		{Amount: 10, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payer, Hash: hash[:], ExpiresAt: later},
+		{Amount: 10, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee, Hash: hash[:31], ExpiresAt: later},
+		{Amount: 10, PayeeAccountID: "acc2", PayerXPub: payer, PayeeXPub: payee, Hash: hash[:], ExpiresAt: time.Now().Add(-time.Minute)},
+	}
+	m := new(Manager)
+	for i, h := range cases {
+		_, err := m.Create(context.Background(), h)
+		if errors.Root(err) != ErrBadHTLC {
+			t.Errorf("case %d: Create = %v, want %v", i, err, ErrBadHTLC)
+		}
+	}
+}
+
+func TestCheckClaimable(t *testing.T) {
+	preimage := []byte("secret")
+	hash := sha256.Sum256(preimage)
+	later, earlier := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	cases := []struct {
+		status    string
+		expiresAt time.Time
+		preimage  []byte
+		want      error
+	}{
+		{StatusFunded, later, preimage, nil},
+		{StatusFunded, later, []byte("guess"), ErrBadHTLC},
+		{StatusFunded, earlier, preimage, ErrBadState},
+		{StatusCreated, later, preimage, ErrBadState},
+		{StatusExpired, earlier, preimage, ErrBadState},
+		{StatusClaimed, later, preimage, ErrBadState},
+	}
+	for _, c := range cases {
+		h := &HTLC{ID: "htlc1", Status: c.status, Hash: hash[:], ExpiresAt: c.expiresAt}
+		err := CheckClaimable(h, c.preimage)
+		if errors.Root(err) != c.want {
+			t.Errorf("CheckClaimable(%s, expires %s, %q) = %v, want %v", c.status, c.expiresAt, c.preimage, err, c.want)
+		}
+	}
+}
+
+func TestCheckRefundable(t *testing.T) {
+	later, earlier := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	cases := []struct {
+		status    string
+		expiresAt time.Time
+		want      bool
+	}{
+		{StatusFunded, earlier, true},
+		{StatusExpired, earlier, true},
+		{StatusFunded, later, false},
+		{StatusCreated, earlier, false},
+		{StatusClaimed, earlier, false},
+		{StatusRefunded, earlier, false},
+	}
+	for _, c := range cases {
+		err := CheckRefundable(&HTLC{ID: "htlc1", Status: c.status, ExpiresAt: c.expiresAt})
+		if got := err == nil; got != c.want {
+			t.Errorf("CheckRefundable(%s, expires %s) = %v, want refundable %v", c.status, c.expiresAt, err, c.want)
+		}
+		if err != nil && errors.Root(err) != ErrBadState {
+			t.Errorf("CheckRefundable(%s, expires %s) = %v, want %v", c.status, c.expiresAt, err, ErrBadState)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chain/core/htlc"
+	"chain/core/job"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+type htlcRequest struct {
+	PayerAccountID      string             `json:"payer_account_id"`
+	PayerAccountAlias   string             `json:"payer_account_alias"`
+	PayeeAccountID      string             `json:"payee_account_id"`
+	PayeeAccountAlias   string             `json:"payee_account_alias"`
+	PayeeControlProgram chainjson.HexBytes `json:"payee_control_program"`
+	AssetID             *bc.AssetID        `json:"asset_id"`
+	AssetAlias          string             `json:"asset_alias"`
+	Amount              uint64             `json:"amount"`
+	PayerXPub           chainkd.XPub       `json:"payer_xpub"`
+	PayeeXPub           chainkd.XPub       `json:"payee_xpub"`
+	Hash                chainjson.HexBytes `json:"hash"`
+	ExpiresAt           time.Time          `json:"expires_at"`
+	CounterpartyID      string             `json:"counterparty_id"`
+	AutoRefund          bool               `json:"auto_refund"`
+}
+
+// htlcResponse is the response to /create-htlc.
+type htlcResponse struct {
+	HTLC     *htlc.HTLC          `json:"htlc"`
+	Template *txbuilder.Template `json:"template"`
+}
+
+// POST /create-htlc
+//
+// Creates a hash time-locked contract locking an amount of an
+// asset from the payer's account for the payee, until the
+// SHA-256 hash's preimage is revealed or the HTLC expires.
+// Returns the HTLC and an unsigned template funding it from
+// the payer's account, to be signed and submitted as usual.
+// The counterparty, if any, is the one in the directory on
+// whose ledger the other side of the transfer settles. With
+// auto_refund, the core refunds the HTLC itself once it
+// expires, signing with the payer's key in the mock HSM.
+func (a *API) createHTLC(ctx context.Context, x htlcRequest) (*htlcResponse, error) {
+	if x.AutoRefund && a.signTemplate == nil {
+		return nil, errors.WithDetail(errNoMockHSM, "automatic refunds are signed with keys held by the mock HSM")
+	}
+	payerID, err := a.accountID(ctx, x.PayerAccountID, x.PayerAccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	h := &htlc.HTLC{
+		Amount:              x.Amount,
+		PayerAccountID:      payerID,
+		PayeeAccountID:      x.PayeeAccountID,
+		PayeeControlProgram: x.PayeeControlProgram,
+		PayerXPub:           x.PayerXPub,
+		PayeeXPub:           x.PayeeXPub,
+		Hash:                x.Hash,
+		ExpiresAt:           x.ExpiresAt,
+		CounterpartyID:      x.CounterpartyID,
+		AutoRefund:          x.AutoRefund,
+	}
+	switch {
+	case x.AssetAlias != "" && x.AssetID != nil:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id and asset_alias can't both be set")
+	case x.AssetAlias != "":
+		ast, err := a.assets.FindByAlias(ctx, x.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		h.AssetID = ast.AssetID
+	case x.AssetID != nil:
+		h.AssetID = *x.AssetID
+	default:
+		return nil, errors.WithDetail(htlc.ErrBadHTLC, "an asset_id or asset_alias is required")
+	}
+	if x.PayeeAccountAlias != "" {
+		if x.PayeeAccountID != "" {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "payee_account_id and payee_account_alias can't both be set")
+		}
+		acct, err := a.accounts.FindByAlias(ctx, x.PayeeAccountAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find account by alias")
+		}
+		h.PayeeAccountID = acct.ID
+	}
+	if x.CounterpartyID != "" {
+		_, err = a.counterparties.Find(ctx, x.CounterpartyID, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h, err = a.htlcs.Create(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":       "spend_account",
+		"account_id": h.PayerAccountID,
+		"asset_id":   h.AssetID.String(),
+		"amount":     h.Amount,
+	}, {
+		"type":            "control_program",
+		"control_program": h.ControlProgram,
+		"asset_id":        h.AssetID.String(),
+		"amount":          h.Amount,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return &htlcResponse{HTLC: h, Template: tpl}, nil
+}
+
+// POST /claim-htlc
+//
+// Builds an unsigned template paying a funded HTLC to the
+// payee, revealing the preimage of its hash. It needs the
+// payee's signature, and must be submitted before the HTLC
+// expires.
+func (a *API) claimHTLC(ctx context.Context, x struct {
+	ID       string             `json:"id"`
+	Preimage chainjson.HexBytes `json:"preimage"`
+}) (*txbuilder.Template, error) {
+	if len(x.Preimage) == 0 {
+		return nil, errors.WithDetail(htlc.ErrBadHTLC, "a preimage is required to claim an HTLC")
+	}
+	h, err := a.htlcs.Find(ctx, x.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = htlc.CheckClaimable(h, x.Preimage)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := map[string]interface{}{
+		"type":       "control_account",
+		"account_id": h.PayeeAccountID,
+		"asset_id":   h.AssetID.String(),
+		"amount":     h.Amount,
+	}
+	if h.PayeeAccountID == "" {
+		delete(dest, "account_id")
+		dest["type"] = "control_program"
+		dest["control_program"] = h.PayeeControlProgram
+	}
+	return a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":     "spend_htlc",
+		"htlc_id":  h.ID,
+		"preimage": x.Preimage,
+	}, dest}})
+}
+
+// POST /refund-htlc
+//
+// Builds an unsigned template paying an HTLC back to the
+// payer's account, once it has expired. It needs the payer's
+// signature.
+func (a *API) refundHTLC(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*txbuilder.Template, error) {
+	h, err := a.htlcs.Find(ctx, x.ID)
+	if err != nil {
+		return nil, err
+	}
+	return a.buildHTLCRefund(ctx, h)
+}
+
+func (a *API) buildHTLCRefund(ctx context.Context, h *htlc.HTLC) (*txbuilder.Template, error) {
+	err := htlc.CheckRefundable(h)
+	if err != nil {
+		return nil, err
+	}
+	return a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":    "spend_htlc",
+		"htlc_id": h.ID,
+	}, {
+		"type":       "control_account",
+		"account_id": h.PayerAccountID,
+		"asset_id":   h.AssetID.String(),
+		"amount":     h.Amount,
+	}}})
+}
+
+// POST /get-htlc
+func (a *API) getHTLC(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*htlc.HTLC, error) {
+	return a.htlcs.Find(ctx, x.ID)
+}
+
+// htlcPage is the response to /list-htlcs.
+type htlcPage struct {
+	Items    []*htlc.HTLC `json:"items"`
+	Next     htlcQuery    `json:"next"`
+	LastPage bool         `json:"last_page"`
+}
+
+type htlcQuery struct {
+	Status   string `json:"status"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-htlcs
+//
+// Lists HTLCs, oldest first, optionally only those with the
+// given status.
+func (a *API) listHTLCs(ctx context.Context, in htlcQuery) (*htlcPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.htlcs.List(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*htlc.HTLC{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &htlcPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// expireHTLCs marks funded HTLCs whose expiry has passed as
+// expired, as a recurring job, once per expireHTLCsPeriod.
+// With a mock HSM, it then refunds the expired HTLCs created
+// with auto_refund. A failed refund is tried again next time.
+func (a *API) expireHTLCs(ctx context.Context, _ *job.Job) error {
+	err := a.htlcs.Expire(ctx)
+	if err != nil {
+		return err
+	}
+	if a.signTemplate == nil {
+		return nil
+	}
+	list, err := a.htlcs.Refundable(ctx)
+	if err != nil {
+		return err
+	}
+	for _, h := range list {
+		err = a.submitHTLCRefund(ctx, h)
+		if err != nil {
+			log.Error(ctx, err, fmt.Sprintf("refunding HTLC %s", h.ID))
+		}
+	}
+	return nil
+}
+
+func (a *API) submitHTLCRefund(ctx context.Context, h *htlc.HTLC) error {
+	tpl, err := a.buildHTLCRefund(ctx, h)
+	if err != nil {
+		return err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return errors.Wrap(err, "signing refund")
+	}
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	return err
+}
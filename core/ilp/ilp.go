@@ -0,0 +1,580 @@
+// Package ilp lets accounts receive Interledger payments, so
+// that partners such as mobile-money operators that speak the
+// Interledger Protocol (ILPv4) can pay into the ledger.
+//
+// An account receives payments at a payment pointer: a name
+// under the core's ILP address, configured with the
+// ilp_address option. A sender resolves the pointer with
+// SPSP, which answers with a destination address unique to
+// that request and a secret shared with the sender. Packets
+// to that address are fulfilled the way a STREAM receiver
+// fulfills them, with an HMAC of the packet's data keyed
+// from the shared secret; the STREAM frames in the data
+// aren't otherwise interpreted.
+//
+// Packets arrive from peers: the partners' connectors, each
+// authenticated by an access token and holding an account on
+// this core that is prefunded in one asset. An accepted
+// packet becomes a transfer of its amount, in that asset,
+// from the peer's account to the pointer's account, and is
+// fulfilled once the transfer has been processed. Each
+// packet is recorded as a payment, keyed by its peer and
+// execution condition, so that a retried packet is paid at
+// most once.
+package ilp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"time"
+
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Payment statuses. A payment whose transfer failed before
+// it was submitted is rejected, and may be paid by a retry
+// of its packet; one whose submission failed is unknown, for
+// an operator to reconcile, and is never paid again.
+const (
+	StatusPending   = "pending"
+	StatusFulfilled = "fulfilled"
+	StatusRejected  = "rejected"
+	StatusUnknown   = "unknown"
+)
+
+// MinExpiryWindow is the least time a packet must have
+// before it expires for its transfer to be attempted.
+const MinExpiryWindow = 2 * time.Second
+
+// fulfillmentKey is the message that STREAM derives the
+// key fulfillments are computed with from.
+const fulfillmentKey = "ilp_stream_fulfillment"
+
+var (
+	// ErrBadPointer is returned for a payment pointer whose
+	// fields are missing or malformed.
+	ErrBadPointer = errors.New("invalid payment pointer")
+
+	// ErrBadPeer is returned for an ILP peer whose fields are
+	// missing or malformed.
+	ErrBadPeer = errors.New("invalid ILP peer")
+
+	// ErrDuplicate is returned when a payment pointer with the
+	// same name, or a peer with the same alias or access
+	// token, already exists.
+	ErrDuplicate = errors.New("duplicate ILP pointer or peer")
+
+	// ErrBadStatus is returned when payments are listed with
+	// an unknown status.
+	ErrBadStatus = errors.New("invalid ILP payment status")
+
+	// ErrNotPeer is returned when ILP packets are sent with an
+	// access token that doesn't belong to a peer.
+	ErrNotPeer = errors.New("access token does not belong to an ILP peer")
+
+	// ErrNoAddress is returned when the core has no ILP
+	// address configured.
+	ErrNoAddress = errors.New("ILP address not configured")
+)
+
+var (
+	addressRE = regexp.MustCompile(`^(g|private|example|peer|self|test|test1|test2|test3|local)(\.[A-Za-z0-9_~-]+)+$`)
+	nameRE    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// ValidAddress reports whether s is an ILP address the core
+// can receive packets at.
+func ValidAddress(s string) bool {
+	return len(s) <= 1023 && addressRE.MatchString(s)
+}
+
+// Pointer is a payment pointer: a name under the core's ILP
+// address that payments to an account are addressed by.
+type Pointer struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	AccountID string    `json:"account_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	secret []byte
+}
+
+// Peer is a partner's connector that sends packets to the
+// core, paying them from its account in its asset.
+type Peer struct {
+	ID              string     `json:"id"`
+	Alias           string     `json:"alias,omitempty"`
+	AccessTokenID   string     `json:"access_token_id"`
+	AccountID       string     `json:"account_id"`
+	AssetID         bc.AssetID `json:"asset_id"`
+	MaxPacketAmount uint64     `json:"max_packet_amount,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Payment is a packet received from a peer, and the
+// transfer paying it.
+type Payment struct {
+	ID                 string             `json:"id"`
+	PeerID             string             `json:"peer_id"`
+	PointerID          string             `json:"pointer_id"`
+	AccountID          string             `json:"account_id"`
+	AssetID            bc.AssetID         `json:"asset_id"`
+	Amount             uint64             `json:"amount"`
+	ExecutionCondition chainjson.HexBytes `json:"execution_condition"`
+	Status             string             `json:"status"`
+	Error              string             `json:"error,omitempty"`
+	TransactionID      *bc.Hash           `json:"transaction_id,omitempty"`
+	ExpiresAt          time.Time          `json:"expires_at"`
+	CreatedAt          time.Time          `json:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at"`
+}
+
+// SPSPResponse is the answer to an SPSP query for a payment
+// pointer.
+type SPSPResponse struct {
+	DestinationAccount string `json:"destination_account"`
+	SharedSecret       []byte `json:"shared_secret"`
+}
+
+// Connector stores payment pointers, peers and payments, and
+// decides how each packet is answered.
+type Connector struct {
+	db      pg.DB
+	address func() string
+}
+
+// NewConnector returns a new Connector using the given
+// database.
+func NewConnector(db pg.DB) *Connector {
+	return &Connector{db: db, address: func() string { return "" }}
+}
+
+// SetAddress makes the connector call f to find the core's
+// ILP address. If f returns "", the core can't receive ILP
+// payments.
+// It must be called before the connector is used.
+func (c *Connector) SetAddress(f func() string) {
+	c.address = f
+}
+
+// Address returns the core's ILP address, or "" if it has
+// none.
+func (c *Connector) Address() string {
+	return c.address()
+}
+
+// CreatePointer adds a payment pointer for the account, with
+// a new random secret.
+func (c *Connector) CreatePointer(ctx context.Context, name, accountID string) (*Pointer, error) {
+	if !nameRE.MatchString(name) {
+		return nil, errors.WithDetail(ErrBadPointer, "name must be 1 to 64 lowercase letters, digits, - or _, starting with a letter or digit")
+	}
+	if accountID == "" {
+		return nil, errors.WithDetail(ErrBadPointer, "an account is required")
+	}
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating pointer secret")
+	}
+	const q = `
+		INSERT INTO ilp_pointers (name, account_id, secret) VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	p := &Pointer{Name: name, AccountID: accountID, secret: secret}
+	err = c.db.QueryRowContext(ctx, q, name, accountID, secret).Scan(&p.ID, &p.CreatedAt)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetailf(ErrDuplicate, "payment pointer %q already exists", name)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting payment pointer")
+	}
+	return p, nil
+}
+
+// DeletePointer removes a payment pointer. Payments already
+// received at it are kept.
+func (c *Connector) DeletePointer(ctx context.Context, id string) error {
+	return c.delete(ctx, `DELETE FROM ilp_pointers WHERE id = $1`, id, "payment pointer")
+}
+
+// ListPointers returns up to limit payment pointers, in
+// order of creation, starting after the given ID. Pass "" to
+// start with the first.
+func (c *Connector) ListPointers(ctx context.Context, after string, limit int) ([]*Pointer, error) {
+	return c.pointers(ctx, `
+		SELECT id, name, account_id, secret, created_at FROM ilp_pointers
+		WHERE ($1 = '' OR id > $1)
+		ORDER BY id
+		LIMIT $2
+	`, after, limit)
+}
+
+func (c *Connector) pointerByName(ctx context.Context, name string) (*Pointer, error) {
+	list, err := c.pointers(ctx, `
+		SELECT id, name, account_id, secret, created_at FROM ilp_pointers WHERE name = $1
+	`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "payment pointer %q not found", name)
+	}
+	return list[0], nil
+}
+
+func (c *Connector) pointers(ctx context.Context, q string, args ...interface{}) ([]*Pointer, error) {
+	var list []*Pointer
+	err := pg.ForQueryRows(ctx, c.db, q, append(args, func(id, name, accountID string, secret []byte, createdAt time.Time) {
+		list = append(list, &Pointer{ID: id, Name: name, AccountID: accountID, CreatedAt: createdAt, secret: secret})
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying payment pointers")
+	}
+	return list, nil
+}
+
+// CreatePeer adds a peer, which sends packets with the
+// access token p.AccessTokenID and pays them from its
+// account in its asset. A MaxPacketAmount of 0 is no limit.
+func (c *Connector) CreatePeer(ctx context.Context, p *Peer) (*Peer, error) {
+	switch {
+	case p.AccessTokenID == "":
+		return nil, errors.WithDetail(ErrBadPeer, "an access_token_id is required")
+	case p.AccountID == "":
+		return nil, errors.WithDetail(ErrBadPeer, "an account is required")
+	case p.AssetID == (bc.AssetID{}):
+		return nil, errors.WithDetail(ErrBadPeer, "an asset is required")
+	case p.MaxPacketAmount > 1<<63-1:
+		return nil, errors.WithDetail(ErrBadPeer, "max_packet_amount is too large")
+	}
+	const q = `
+		INSERT INTO ilp_peers (alias, access_token_id, account_id, asset_id, max_packet_amount)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	peer := *p
+	err := c.db.QueryRowContext(ctx, q, p.Alias, p.AccessTokenID, p.AccountID, p.AssetID,
+		int64(p.MaxPacketAmount)).Scan(&peer.ID, &peer.CreatedAt)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetail(ErrDuplicate, "another ILP peer has that alias or access token")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting ILP peer")
+	}
+	return &peer, nil
+}
+
+// DeletePeer removes a peer. Payments already received from
+// it are kept.
+func (c *Connector) DeletePeer(ctx context.Context, id string) error {
+	return c.delete(ctx, `DELETE FROM ilp_peers WHERE id = $1`, id, "ILP peer")
+}
+
+const selectPeersQ = `
+	SELECT id, COALESCE(alias, ''), access_token_id, account_id, asset_id, max_packet_amount, created_at
+	FROM ilp_peers
+`
+
+// ListPeers returns up to limit peers, in order of creation,
+// starting after the given ID. Pass "" to start with the
+// first.
+func (c *Connector) ListPeers(ctx context.Context, after string, limit int) ([]*Peer, error) {
+	return c.peers(ctx, selectPeersQ+`
+		WHERE ($1 = '' OR id > $1)
+		ORDER BY id
+		LIMIT $2
+	`, after, limit)
+}
+
+// PeerByToken returns the peer that sends packets with the
+// given access token, or ErrNotPeer.
+func (c *Connector) PeerByToken(ctx context.Context, tokenID string) (*Peer, error) {
+	if tokenID == "" {
+		return nil, errors.WithDetail(ErrNotPeer, "ILP packets must be sent with a peer's access token")
+	}
+	list, err := c.peers(ctx, selectPeersQ+`WHERE access_token_id = $1`, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(ErrNotPeer, "access token %s is not a peer's", tokenID)
+	}
+	return list[0], nil
+}
+
+func (c *Connector) peers(ctx context.Context, q string, args ...interface{}) ([]*Peer, error) {
+	var list []*Peer
+	err := pg.ForQueryRows(ctx, c.db, q, append(args, func(
+		id, alias, tokenID, accountID string, assetID bc.AssetID, maxAmount int64, createdAt time.Time,
+	) {
+		list = append(list, &Peer{
+			ID:              id,
+			Alias:           alias,
+			AccessTokenID:   tokenID,
+			AccountID:       accountID,
+			AssetID:         assetID,
+			MaxPacketAmount: uint64(maxAmount),
+			CreatedAt:       createdAt,
+		})
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying ILP peers")
+	}
+	return list, nil
+}
+
+func (c *Connector) delete(ctx context.Context, q, id, what string) error {
+	res, err := c.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return errors.Wrap(err, "deleting "+what)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "%s %s not found", what, id)
+	}
+	return nil
+}
+
+// SPSP answers an SPSP query for the named payment pointer
+// with a new destination address and the secret shared with
+// the sender for it.
+func (c *Connector) SPSP(ctx context.Context, name string) (*SPSPResponse, error) {
+	addr := c.address()
+	if addr == "" {
+		return nil, ErrNoAddress
+	}
+	p, err := c.pointerByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 18)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating SPSP token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return &SPSPResponse{
+		DestinationAccount: addr + "." + p.Name + "." + token,
+		SharedSecret:       sharedSecret(p.secret, token),
+	}, nil
+}
+
+// sharedSecret derives the secret shared with a sender from
+// the pointer's secret and the token in the destination
+// address given to that sender.
+func sharedSecret(pointerSecret []byte, token string) []byte {
+	return hmacSHA256(pointerSecret, []byte(token))
+}
+
+// fulfillment computes the fulfillment of a packet sent with
+// the shared secret, as STREAM does.
+func fulfillment(shared, data []byte) [32]byte {
+	var f [32]byte
+	copy(f[:], hmacSHA256(hmacSHA256(shared, []byte(fulfillmentKey)), data))
+	return f
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// Accept decides how a Prepare from peer is answered. It
+// returns a *Reject as the error when the packet is refused.
+// Otherwise it returns the Fulfill and, if the packet must
+// still be paid, its payment, reserved as pending; the
+// caller transfers the payment's amount and reports the
+// outcome with Finish before sending the Fulfill. A packet
+// with a zero amount, or one already paid, needs no
+// transfer.
+func (c *Connector) Accept(ctx context.Context, peer *Peer, p *Prepare) (*Payment, *Fulfill, error) {
+	addr := c.address()
+	if addr == "" {
+		return nil, nil, c.reject(CodeUnreachable, "this core has no ILP address")
+	}
+	now := time.Now()
+	if !p.ExpiresAt.After(now) {
+		return nil, nil, c.reject(CodeTransferTimedOut, "packet expired")
+	}
+	if p.ExpiresAt.Sub(now) < MinExpiryWindow {
+		return nil, nil, c.reject(CodeInsufficientTimeout, "packet expires too soon to be paid")
+	}
+	if !strings.HasPrefix(p.Destination, addr+".") {
+		return nil, nil, c.reject(CodeUnreachable, "destination is not under this core's address")
+	}
+	segs := strings.Split(strings.TrimPrefix(p.Destination, addr+"."), ".")
+	if len(segs) < 2 {
+		return nil, nil, c.reject(CodeUnreachable, "destination was not given by SPSP")
+	}
+	if peer.MaxPacketAmount > 0 && p.Amount > peer.MaxPacketAmount {
+		return nil, nil, c.reject(CodeAmountTooLarge, "amount exceeds the peer's maximum packet amount")
+	}
+	if p.Amount > 1<<63-1 {
+		return nil, nil, c.reject(CodeInvalidAmount, "amount is too large")
+	}
+
+	ptr, err := c.pointerByName(ctx, segs[0])
+	if errors.Root(err) == pg.ErrUserInputNotFound {
+		return nil, nil, c.reject(CodeUnreachable, "no such payment pointer")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	f := &Fulfill{Fulfillment: fulfillment(sharedSecret(ptr.secret, segs[1]), p.Data)}
+	if sha256.Sum256(f.Fulfillment[:]) != p.ExecutionCondition {
+		return nil, nil, c.reject(CodeWrongCondition, "condition does not match the data")
+	}
+	if p.Amount == 0 {
+		return nil, f, nil
+	}
+
+	// Reserve the payment, or take over one whose transfer
+	// failed before it was submitted.
+	const q = `
+		INSERT INTO ilp_payments (peer_id, pointer_id, account_id, asset_id, amount,
+			execution_condition, fulfillment, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (peer_id, execution_condition) DO UPDATE
+			SET status = $8, error = NULL, expires_at = $9, updated_at = now()
+			WHERE ilp_payments.status = $10
+		RETURNING id
+	`
+	pay := &Payment{
+		PeerID:             peer.ID,
+		PointerID:          ptr.ID,
+		AccountID:          ptr.AccountID,
+		AssetID:            peer.AssetID,
+		Amount:             p.Amount,
+		ExecutionCondition: p.ExecutionCondition[:],
+		Status:             StatusPending,
+		ExpiresAt:          p.ExpiresAt,
+	}
+	err = c.db.QueryRowContext(ctx, q, peer.ID, ptr.ID, ptr.AccountID, peer.AssetID, int64(p.Amount),
+		p.ExecutionCondition[:], f.Fulfillment[:], StatusPending, p.ExpiresAt, StatusRejected).Scan(&pay.ID)
+	if err == nil {
+		return pay, f, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, nil, errors.Wrap(err, "reserving ILP payment")
+	}
+
+	var status string
+	err = c.db.QueryRowContext(ctx, `
+		SELECT status FROM ilp_payments WHERE peer_id = $1 AND execution_condition = $2
+	`, peer.ID, p.ExecutionCondition[:]).Scan(&status)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "finding ILP payment")
+	}
+	if status == StatusFulfilled {
+		return nil, f, nil
+	}
+	return nil, nil, c.reject(CodeInternalError, "an earlier packet with this condition is "+status)
+}
+
+// Finish records the outcome of a payment's transfer: the
+// transaction that paid it, or the error that stopped it.
+// If submitted is false, the transfer failed before it was
+// submitted, so the payment may be paid by a retry.
+func (c *Connector) Finish(ctx context.Context, pay *Payment, txID *bc.Hash, failure error, submitted bool) error {
+	status, msg := StatusFulfilled, ""
+	switch {
+	case failure != nil && submitted:
+		status, msg = StatusUnknown, failure.Error()
+	case failure != nil:
+		status, msg = StatusRejected, failure.Error()
+	}
+	var txHash []byte
+	if txID != nil {
+		txHash = txID.Bytes()
+	}
+	const q = `
+		UPDATE ilp_payments SET status = $2, error = NULLIF($3, ''), tx_hash = $4, updated_at = now()
+		WHERE id = $1
+	`
+	_, err := c.db.ExecContext(ctx, q, pay.ID, status, msg, txHash)
+	if err != nil {
+		return errors.Wrap(err, "recording ILP payment outcome")
+	}
+	pay.Status, pay.Error, pay.TransactionID = status, msg, txID
+	return nil
+}
+
+// ListPayments returns up to limit payments, in order of
+// receipt, starting after the given ID, optionally only
+// those with the given status. Pass "" to start with the
+// first.
+func (c *Connector) ListPayments(ctx context.Context, status, after string, limit int) ([]*Payment, error) {
+	switch status {
+	case "", StatusPending, StatusFulfilled, StatusRejected, StatusUnknown:
+	default:
+		return nil, errors.WithDetailf(ErrBadStatus, "unknown payment status %q", status)
+	}
+	const q = `
+		SELECT id, peer_id, pointer_id, account_id, asset_id, amount, execution_condition,
+			status, COALESCE(error, ''), tx_hash, expires_at, created_at, updated_at
+		FROM ilp_payments
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`
+	var list []*Payment
+	err := pg.ForQueryRows(ctx, c.db, q, status, after, limit, func(
+		id, peerID, pointerID, accountID string, assetID bc.AssetID, amount int64, cond []byte,
+		status, msg string, txHash []byte, expiresAt, createdAt, updatedAt time.Time,
+	) error {
+		pay := &Payment{
+			ID:                 id,
+			PeerID:             peerID,
+			PointerID:          pointerID,
+			AccountID:          accountID,
+			AssetID:            assetID,
+			Amount:             uint64(amount),
+			ExecutionCondition: cond,
+			Status:             status,
+			Error:              msg,
+			ExpiresAt:          expiresAt,
+			CreatedAt:          createdAt,
+			UpdatedAt:          updatedAt,
+		}
+		if txHash != nil {
+			pay.TransactionID = new(bc.Hash)
+			err := pay.TransactionID.Scan(txHash)
+			if err != nil {
+				return err
+			}
+		}
+		list = append(list, pay)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying ILP payments")
+	}
+	return list, nil
+}
+
+// RefData returns the reference data recorded in the output
+// paying a payment.
+func RefData(pay *Payment) map[string]interface{} {
+	return map[string]interface{}{"ilp": map[string]interface{}{
+		"payment_id": pay.ID,
+		"peer_id":    pay.PeerID,
+		"pointer_id": pay.PointerID,
+	}}
+}
+
+func (c *Connector) reject(code, msg string) *Reject {
+	return &Reject{Code: code, TriggeredBy: c.address(), Message: msg}
+}
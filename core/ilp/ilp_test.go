@@ -0,0 +1,82 @@
+package ilp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestValidAddress(t *testing.T) {
+	cases := []struct {
+		addr string
+		want bool
+	}{
+		{"g.tulwe", true},
+		{"test.core-1.pay~x", true},
+		{"private.a.b.c", true},
+		{"g", false},
+		{"g.", false},
+		{"x.tulwe", false},
+		{"g.tulwe pay", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := ValidAddress(c.addr); got != c.want {
+			t.Errorf("ValidAddress(%q) = %v, want %v", c.addr, got, c.want)
+		}
+	}
+}
+
+func TestFulfillment(t *testing.T) {
+	ptrSecret := []byte("pointer secret")
+	shared := sharedSecret(ptrSecret, "tok1")
+	if string(shared) == string(sharedSecret(ptrSecret, "tok2")) {
+		t.Error("destinations with different tokens share a secret")
+	}
+
+	// The sender, knowing only the shared secret, must compute
+	// the same condition as the receiver.
+	data := []byte("stream frames")
+	f := fulfillment(shared, data)
+	if f == fulfillment(shared, []byte("other frames")) {
+		t.Error("fulfillment does not depend on the data")
+	}
+	if f == fulfillment(sharedSecret(ptrSecret, "tok2"), data) {
+		t.Error("fulfillment does not depend on the shared secret")
+	}
+}
+
+func TestAcceptReject(t *testing.T) {
+	c := NewConnector(nil)
+	c.SetAddress(func() string { return "example.core" })
+	peer := &Peer{ID: "ilpp1", MaxPacketAmount: 100}
+	later := time.Now().Add(time.Minute)
+	cases := []struct {
+		p    *Prepare
+		code string
+	}{
+		{&Prepare{Amount: 10, ExpiresAt: time.Now().Add(-time.Second), Destination: "example.core.alice.tok"}, CodeTransferTimedOut},
+		{&Prepare{Amount: 10, ExpiresAt: time.Now().Add(MinExpiryWindow / 2), Destination: "example.core.alice.tok"}, CodeInsufficientTimeout},
+		{&Prepare{Amount: 10, ExpiresAt: later, Destination: "example.other.alice.tok"}, CodeUnreachable},
+		{&Prepare{Amount: 10, ExpiresAt: later, Destination: "example.corex.alice.tok"}, CodeUnreachable},
+		{&Prepare{Amount: 10, ExpiresAt: later, Destination: "example.core.alice"}, CodeUnreachable},
+		{&Prepare{Amount: 101, ExpiresAt: later, Destination: "example.core.alice.tok"}, CodeAmountTooLarge},
+	}
+	for i, tc := range cases {
+		_, _, err := c.Accept(context.Background(), peer, tc.p)
+		rej, ok := err.(*Reject)
+		if !ok || rej.Code != tc.code {
+			t.Errorf("case %d: Accept = %v, want reject %s", i, err, tc.code)
+			continue
+		}
+		if rej.TriggeredBy != "example.core" {
+			t.Errorf("case %d: triggered by %q, want example.core", i, rej.TriggeredBy)
+		}
+	}
+
+	unconfigured := NewConnector(nil)
+	_, _, err := unconfigured.Accept(context.Background(), peer, &Prepare{ExpiresAt: later})
+	if rej, ok := err.(*Reject); !ok || rej.Code != CodeUnreachable {
+		t.Errorf("Accept without an address = %v, want reject %s", err, CodeUnreachable)
+	}
+}
@@ -0,0 +1,287 @@
+package ilp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"chain/errors"
+)
+
+// Packet types, as in ILPv4.
+const (
+	TypePrepare = 12
+	TypeFulfill = 13
+	TypeReject  = 14
+)
+
+// Reject codes. F codes are final, T codes temporary and R
+// codes relative to the packet's timing.
+const (
+	CodeBadRequest          = "F00"
+	CodeInvalidPacket       = "F01"
+	CodeUnreachable         = "F02"
+	CodeInvalidAmount       = "F03"
+	CodeWrongCondition      = "F05"
+	CodeUnexpectedPayment   = "F06"
+	CodeAmountTooLarge      = "F08"
+	CodeApplicationError    = "F99"
+	CodeInternalError       = "T00"
+	CodeInsufficientLiquid  = "T04"
+	CodeTransferTimedOut    = "R00"
+	CodeInsufficientTimeout = "R02"
+)
+
+const (
+	// MaxDataSize is the largest data field a packet may
+	// carry.
+	MaxDataSize = 32767
+
+	// MaxPacketSize bounds the size of an encoded packet.
+	MaxPacketSize = 1 << 16
+
+	timestampFormat = "20060102150405.000"
+)
+
+// ErrBadPacket is returned when a packet can't be decoded.
+var ErrBadPacket = errors.New("invalid ILP packet")
+
+// Prepare asks the receiver to pay Amount to Destination,
+// in return for the preimage of ExecutionCondition, before
+// ExpiresAt.
+type Prepare struct {
+	Amount             uint64
+	ExpiresAt          time.Time
+	ExecutionCondition [32]byte
+	Destination        string
+	Data               []byte
+}
+
+// Fulfill accepts a Prepare, revealing the preimage of its
+// condition.
+type Fulfill struct {
+	Fulfillment [32]byte
+	Data        []byte
+}
+
+// Reject refuses a Prepare. It implements error, so that
+// the reason a packet is refused can be returned like any
+// other.
+type Reject struct {
+	Code        string
+	TriggeredBy string
+	Message     string
+	Data        []byte
+}
+
+func (r *Reject) Error() string {
+	return fmt.Sprintf("ILP reject %s: %s", r.Code, r.Message)
+}
+
+// Encode returns p in the ILPv4 wire format.
+func (p *Prepare) Encode() []byte {
+	var b bytes.Buffer
+	var amount [8]byte
+	binary.BigEndian.PutUint64(amount[:], p.Amount)
+	b.Write(amount[:])
+	b.WriteString(formatTimestamp(p.ExpiresAt))
+	b.Write(p.ExecutionCondition[:])
+	writeVar(&b, []byte(p.Destination))
+	writeVar(&b, p.Data)
+	return envelope(TypePrepare, b.Bytes())
+}
+
+// Encode returns f in the ILPv4 wire format.
+func (f *Fulfill) Encode() []byte {
+	var b bytes.Buffer
+	b.Write(f.Fulfillment[:])
+	writeVar(&b, f.Data)
+	return envelope(TypeFulfill, b.Bytes())
+}
+
+// Encode returns r in the ILPv4 wire format.
+func (r *Reject) Encode() []byte {
+	var b bytes.Buffer
+	code := []byte(r.Code + "   ")
+	b.Write(code[:3])
+	writeVar(&b, []byte(r.TriggeredBy))
+	writeVar(&b, []byte(r.Message))
+	writeVar(&b, r.Data)
+	return envelope(TypeReject, b.Bytes())
+}
+
+// DecodePrepare decodes a Prepare packet.
+func DecodePrepare(packet []byte) (*Prepare, error) {
+	r, err := open(packet, TypePrepare)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Prepare)
+	var fixed [8 + len(timestampFormat) - 1 + 32]byte
+	_, err = io.ReadFull(r, fixed[:])
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadPacket, "prepare packet is truncated")
+	}
+	p.Amount = binary.BigEndian.Uint64(fixed[:8])
+	p.ExpiresAt, err = parseTimestamp(string(fixed[8 : len(fixed)-32]))
+	if err != nil {
+		return nil, err
+	}
+	copy(p.ExecutionCondition[:], fixed[len(fixed)-32:])
+	dest, err := readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Destination = string(dest)
+	p.Data, err = readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Data) > MaxDataSize {
+		return nil, errors.WithDetailf(ErrBadPacket, "data must be at most %d bytes", MaxDataSize)
+	}
+	return p, nil
+}
+
+// DecodeFulfill decodes a Fulfill packet.
+func DecodeFulfill(packet []byte) (*Fulfill, error) {
+	r, err := open(packet, TypeFulfill)
+	if err != nil {
+		return nil, err
+	}
+	f := new(Fulfill)
+	_, err = io.ReadFull(r, f.Fulfillment[:])
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadPacket, "fulfill packet is truncated")
+	}
+	f.Data, err = readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// DecodeReject decodes a Reject packet.
+func DecodeReject(packet []byte) (*Reject, error) {
+	r, err := open(packet, TypeReject)
+	if err != nil {
+		return nil, err
+	}
+	var code [3]byte
+	_, err = io.ReadFull(r, code[:])
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadPacket, "reject packet is truncated")
+	}
+	rej := &Reject{Code: string(code[:])}
+	triggeredBy, err := readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	rej.TriggeredBy, rej.Message = string(triggeredBy), string(msg)
+	rej.Data, err = readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	return rej, nil
+}
+
+// envelope prefixes contents with the packet type and its
+// length.
+func envelope(typ byte, contents []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(typ)
+	writeVar(&b, contents)
+	return b.Bytes()
+}
+
+// open checks the packet's type and returns a reader over
+// its contents.
+func open(packet []byte, typ byte) (*bytes.Reader, error) {
+	r := bytes.NewReader(packet)
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadPacket, "packet is empty")
+	}
+	if t != typ {
+		return nil, errors.WithDetailf(ErrBadPacket, "packet type is %d, want %d", t, typ)
+	}
+	contents, err := readVar(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.WithDetail(ErrBadPacket, "packet has trailing bytes")
+	}
+	return bytes.NewReader(contents), nil
+}
+
+// writeVar writes b as an OER variable-length octet string:
+// its length, in one byte if it's under 128 and otherwise in
+// as few big-endian bytes as needed, preceded by a byte
+// holding 0x80 plus their count, then its bytes.
+func writeVar(w *bytes.Buffer, b []byte) {
+	n := len(b)
+	if n < 128 {
+		w.WriteByte(byte(n))
+	} else {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(n))
+		i := 0
+		for buf[i] == 0 {
+			i++
+		}
+		w.WriteByte(0x80 | byte(8-i))
+		w.Write(buf[i:])
+	}
+	w.Write(b)
+}
+
+// readVar reads an OER variable-length octet string.
+func readVar(r *bytes.Reader) ([]byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadPacket, "length is missing")
+	}
+	n := int(first)
+	if first&0x80 != 0 {
+		size := int(first &^ 0x80)
+		if size == 0 || size > 3 {
+			return nil, errors.WithDetailf(ErrBadPacket, "length of length %d is out of range", size)
+		}
+		n = 0
+		for i := 0; i < size; i++ {
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, errors.WithDetail(ErrBadPacket, "length is truncated")
+			}
+			n = n<<8 | int(c)
+		}
+	}
+	if n > r.Len() {
+		return nil, errors.WithDetailf(ErrBadPacket, "length %d exceeds the %d bytes left", n, r.Len())
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
+
+// formatTimestamp formats t as the 17 characters
+// YYYYMMDDHHmmssfff, in UTC.
+func formatTimestamp(t time.Time) string {
+	s := t.UTC().Format(timestampFormat)
+	return s[:14] + s[15:]
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	t, err := time.Parse(timestampFormat, s[:14]+"."+s[14:])
+	if err != nil {
+		return time.Time{}, errors.WithDetailf(ErrBadPacket, "expiry %q is not a timestamp", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,93 @@
+package ilp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"chain/errors"
+)
+
+func TestPrepareRoundTrip(t *testing.T) {
+	cases := []*Prepare{
+		{
+			Amount:      107,
+			ExpiresAt:   time.Date(2017, 8, 12, 10, 30, 0, 123000000, time.UTC),
+			Destination: "example.core.alice.abc",
+			Data:        []byte("hello"),
+		},
+		{
+			Amount:      1<<64 - 1,
+			ExpiresAt:   time.Date(2017, 12, 31, 23, 59, 59, 999000000, time.UTC),
+			Destination: "g.mobile.bob",
+			Data:        bytes.Repeat([]byte{7}, 300), // long-form length
+		},
+	}
+	for i, p := range cases {
+		p.ExecutionCondition[0] = byte(i + 1)
+		got, err := DecodePrepare(p.Encode())
+		if err != nil {
+			t.Fatalf("case %d: DecodePrepare = %v", i, err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("case %d: round trip = %+v, want %+v", i, got, p)
+		}
+	}
+}
+
+func TestPrepareEncoding(t *testing.T) {
+	p := &Prepare{
+		Amount:      1,
+		ExpiresAt:   time.Date(2017, 8, 12, 10, 30, 0, 5000000, time.UTC),
+		Destination: "g.a",
+	}
+	got := p.Encode()
+	want := []byte{TypePrepare, 8 + 17 + 32 + 1 + 3 + 1, 0, 0, 0, 0, 0, 0, 0, 1}
+	want = append(want, "20170812103000005"...)
+	want = append(want, make([]byte, 32)...)
+	want = append(want, 3, 'g', '.', 'a', 0)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Encode = %x, want %x", got, want)
+	}
+}
+
+func TestFulfillRejectRoundTrip(t *testing.T) {
+	f := &Fulfill{Data: []byte{1, 2, 3}}
+	f.Fulfillment[31] = 9
+	gotF, err := DecodeFulfill(f.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotF, f) {
+		t.Errorf("fulfill round trip = %+v, want %+v", gotF, f)
+	}
+
+	r := &Reject{Code: CodeUnreachable, TriggeredBy: "g.core", Message: "no such payment pointer", Data: []byte{}}
+	gotR, err := DecodeReject(r.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotR, r) {
+		t.Errorf("reject round trip = %+v, want %+v", gotR, r)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	good := (&Prepare{Amount: 1, ExpiresAt: time.Now(), Destination: "g.a"}).Encode()
+	cases := [][]byte{
+		nil,
+		{TypeFulfill},
+		append([]byte{TypeReject}, good[1:]...),
+		good[:len(good)-1],
+		append(append([]byte{}, good...), 0),
+		{TypePrepare, 0x84, 1, 2, 3, 4},
+		{TypePrepare, 3, 1, 2, 3},
+	}
+	for i, b := range cases {
+		_, err := DecodePrepare(b)
+		if errors.Root(err) != ErrBadPacket {
+			t.Errorf("case %d: DecodePrepare(%x) = %v, want %v", i, b, err, ErrBadPacket)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"chain/core/account"
+	"chain/core/ilp"
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/authn"
+	"chain/net/http/httperror"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+// spspPrefix is the path payment pointers resolve under: the
+// pointer $core.example.com/pay/alice is queried at
+// https://core.example.com/pay/alice.
+const spspPrefix = "/pay/"
+
+// cleanILPAddress validates the ilp_address option.
+func cleanILPAddress(tup []string) error {
+	if !ilp.ValidAddress(tup[0]) {
+		return errors.WithDetailf(errBadConfigValue, "ILP address must be an address such as g.example, with an allocation scheme and one or more segments of letters, digits, _, ~ or -.")
+	}
+	return nil
+}
+
+// POST /create-payment-pointer
+//
+// Creates a payment pointer that the account receives ILP
+// payments at, resolved with SPSP at /pay/<name>.
+func (a *API) createPaymentPointer(ctx context.Context, x struct {
+	Name         string `json:"name"`
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+}) (*ilp.Pointer, error) {
+	accountID, err := a.accountID(ctx, x.AccountID, x.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	return a.interledger.CreatePointer(ctx, x.Name, accountID)
+}
+
+// POST /delete-payment-pointer
+func (a *API) deletePaymentPointer(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) error {
+	return a.interledger.DeletePointer(ctx, x.ID)
+}
+
+// paymentPointerPage is the response to
+// /list-payment-pointers.
+type paymentPointerPage struct {
+	Items    []*ilp.Pointer `json:"items"`
+	Next     ilpQuery       `json:"next"`
+	LastPage bool           `json:"last_page"`
+}
+
+type ilpQuery struct {
+	Status   string `json:"status,omitempty"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-payment-pointers
+//
+// Lists payment pointers, oldest first.
+func (a *API) listPaymentPointers(ctx context.Context, in ilpQuery) (*paymentPointerPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.interledger.ListPointers(ctx, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*ilp.Pointer{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &paymentPointerPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// POST /create-ilp-peer
+//
+// Adds a partner's connector as a peer. The peer sends ILP
+// packets to /ilp with the access token access_token_id,
+// which needs the ilp policy, and each packet is paid from
+// the peer's account in the peer's asset. Packets for more
+// than max_packet_amount, unless it's 0, are refused.
+// Paying packets requires the mock HSM, which must hold the
+// keys of the peer's account.
+func (a *API) createILPPeer(ctx context.Context, x struct {
+	Alias           string      `json:"alias"`
+	AccessTokenID   string      `json:"access_token_id"`
+	AccountID       string      `json:"account_id"`
+	AccountAlias    string      `json:"account_alias"`
+	AssetID         *bc.AssetID `json:"asset_id"`
+	AssetAlias      string      `json:"asset_alias"`
+	MaxPacketAmount uint64      `json:"max_packet_amount"`
+}) (*ilp.Peer, error) {
+	accountID, err := a.accountID(ctx, x.AccountID, x.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	p := &ilp.Peer{
+		Alias:           x.Alias,
+		AccessTokenID:   x.AccessTokenID,
+		AccountID:       accountID,
+		MaxPacketAmount: x.MaxPacketAmount,
+	}
+	switch {
+	case x.AssetAlias != "" && x.AssetID != nil:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id and asset_alias can't both be set")
+	case x.AssetAlias != "":
+		ast, err := a.assets.FindByAlias(ctx, x.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		p.AssetID = ast.AssetID
+	case x.AssetID != nil:
+		p.AssetID = *x.AssetID
+	}
+	return a.interledger.CreatePeer(ctx, p)
+}
+
+// POST /delete-ilp-peer
+func (a *API) deleteILPPeer(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) error {
+	return a.interledger.DeletePeer(ctx, x.ID)
+}
+
+// ilpPeerPage is the response to /list-ilp-peers.
+type ilpPeerPage struct {
+	Items    []*ilp.Peer `json:"items"`
+	Next     ilpQuery    `json:"next"`
+	LastPage bool        `json:"last_page"`
+}
+
+// POST /list-ilp-peers
+//
+// Lists ILP peers, oldest first.
+func (a *API) listILPPeers(ctx context.Context, in ilpQuery) (*ilpPeerPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.interledger.ListPeers(ctx, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*ilp.Peer{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &ilpPeerPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// ilpPaymentPage is the response to /list-ilp-payments.
+type ilpPaymentPage struct {
+	Items    []*ilp.Payment `json:"items"`
+	Next     ilpQuery       `json:"next"`
+	LastPage bool           `json:"last_page"`
+}
+
+// POST /list-ilp-payments
+//
+// Lists the payments received from ILP peers, oldest first,
+// optionally only those with the given status.
+func (a *API) listILPPayments(ctx context.Context, in ilpQuery) (*ilpPaymentPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.interledger.ListPayments(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*ilp.Payment{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &ilpPaymentPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// GET /pay/<name>
+//
+// Answers an SPSP query for a payment pointer, with a new
+// destination address for the sender's packets and the
+// secret shared with it, as application/spsp4+json.
+func (a *API) spsp(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if a.config == nil {
+		alwaysError(errUnconfigured).ServeHTTP(rw, req)
+		return
+	}
+	resp, err := a.interledger.SPSP(ctx, strings.TrimPrefix(req.URL.Path, spspPrefix))
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/spsp4+json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(resp)
+}
+
+// POST /ilp
+//
+// Receives an ILP Prepare packet from a peer, over HTTP: the
+// request body is the packet, and the response body is the
+// Fulfill or Reject answering it. Packets must be sent with
+// the peer's access token.
+func (a *API) ilpPacket(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if a.config == nil {
+		alwaysError(errUnconfigured).ServeHTTP(rw, req)
+		return
+	}
+	peer, err := a.interledger.PeerByToken(ctx, authn.Token(ctx))
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, ilp.MaxPacketSize))
+	if err != nil {
+		errorFormatter.Write(ctx, rw, errors.Wrap(err, "reading ILP packet"))
+		return
+	}
+
+	var resp []byte
+	p, err := ilp.DecodePrepare(body)
+	if err != nil {
+		resp = a.ilpReject(ilp.CodeInvalidPacket, errors.Detail(err))
+	} else {
+		resp = a.handlePrepare(ctx, peer, p)
+	}
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(resp)
+}
+
+// handlePrepare pays a Prepare from peer, if it's accepted,
+// and returns the encoded Fulfill or Reject answering it.
+func (a *API) handlePrepare(ctx context.Context, peer *ilp.Peer, p *ilp.Prepare) []byte {
+	pay, f, err := a.interledger.Accept(ctx, peer, p)
+	if rej, ok := err.(*ilp.Reject); ok {
+		return rej.Encode()
+	} else if err != nil {
+		log.Error(ctx, err, fmt.Sprintf("accepting ILP packet from peer %s", peer.ID))
+		return a.ilpReject(ilp.CodeInternalError, "internal error")
+	}
+	if pay == nil {
+		return f.Encode()
+	}
+
+	txID, submitted, payErr := a.payILP(ctx, peer, pay)
+	err = a.interledger.Finish(ctx, pay, txID, payErr, submitted)
+	if err != nil {
+		log.Error(ctx, err, fmt.Sprintf("recording ILP payment %s", pay.ID))
+	}
+	switch {
+	case payErr == nil:
+		return f.Encode()
+	case insufficientFunds(payErr):
+		return a.ilpReject(ilp.CodeInsufficientLiquid, "peer's account has insufficient funds")
+	default:
+		log.Error(ctx, payErr, fmt.Sprintf("paying ILP payment %s", pay.ID))
+		return a.ilpReject(ilp.CodeInternalError, "transfer failed")
+	}
+}
+
+// payILP transfers a payment's amount from the peer's
+// account to the pointer's account, and waits until the
+// transaction has been processed. It reports whether the
+// transaction was submitted, even if it failed after that.
+func (a *API) payILP(ctx context.Context, peer *ilp.Peer, pay *ilp.Payment) (*bc.Hash, bool, error) {
+	if a.signTemplate == nil {
+		return nil, false, errors.WithDetail(errNoMockHSM, "ILP payments are signed with keys held by the mock HSM")
+	}
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":       "spend_account",
+		"account_id": peer.AccountID,
+		"asset_id":   pay.AssetID.String(),
+		"amount":     pay.Amount,
+	}, {
+		"type":           "control_account",
+		"account_id":     pay.AccountID,
+		"asset_id":       pay.AssetID.String(),
+		"amount":         pay.Amount,
+		"reference_data": ilp.RefData(pay),
+	}}})
+	if err != nil {
+		return nil, false, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "signing ILP payment")
+	}
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	if err != nil {
+		return nil, true, err
+	}
+	return &tpl.Transaction.ID, true, nil
+}
+
+// insufficientFunds reports whether err, from building a
+// transaction, means an account couldn't cover its spend.
+func insufficientFunds(err error) bool {
+	if errors.Root(err) == account.ErrInsufficient {
+		return true
+	}
+	if errors.Root(err) != txbuilder.ErrAction {
+		return false
+	}
+	code := errorFormatter.Format(account.ErrInsufficient).ChainCode
+	resps, _ := errors.Data(err)["actions"].([]httperror.Response)
+	for _, r := range resps {
+		if r.ChainCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *API) ilpReject(code, msg string) []byte {
+	return (&ilp.Reject{Code: code, TriggeredBy: a.interledger.Address(), Message: msg}).Encode()
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/invite"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+)
+
+// errBadMemberPolicy is returned when inviting someone, or
+// binding a service account, to a policy that can't be
+// granted that way.
+var errBadMemberPolicy = errors.New("policy can't be granted to members")
+
+// memberPolicies are the policies invitations and service
+// accounts may grant. Policies for other cores and cluster
+// members are granted by configuring those cores.
+var memberPolicies = map[string]bool{
+	"client-readwrite": true,
+	"client-readonly":  true,
+	"monitoring":       true,
+}
+
+// POST /create-invitation
+//
+// Creates an invitation for email to use the core under
+// policy. The response includes the invitation's token,
+// which the caller must pass on to the invitee; it can't be
+// retrieved again.
+func (a *API) createInvitation(ctx context.Context, x struct {
+	Email  string             `json:"email"`
+	Policy string             `json:"policy"`
+	TTL    chainjson.Duration `json:"ttl"`
+}) (*invite.Invitation, error) {
+	if !memberPolicies[x.Policy] {
+		return nil, errors.WithDetailf(errBadMemberPolicy, "policy %q can't be granted by invitation", x.Policy)
+	}
+	return a.invitations.Create(ctx, x.Email, x.Policy, x.TTL.Duration)
+}
+
+// POST /resend-invitation
+//
+// Issues a new token for an invitation that hasn't been
+// accepted or revoked, invalidating the old one, and renews
+// its expiration.
+func (a *API) resendInvitation(ctx context.Context, x struct {
+	ID  string             `json:"id"`
+	TTL chainjson.Duration `json:"ttl"`
+}) (*invite.Invitation, error) {
+	return a.invitations.Resend(ctx, x.ID, x.TTL.Duration)
+}
+
+// POST /revoke-invitation
+func (a *API) revokeInvitation(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) error {
+	return a.invitations.Revoke(ctx, x.ID)
+}
+
+// invitationPage is the response to /list-invitations.
+type invitationPage struct {
+	Items    []*invite.Invitation `json:"items"`
+	Next     invitationQuery      `json:"next"`
+	LastPage bool                 `json:"last_page"`
+}
+
+type invitationQuery struct {
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-invitations
+//
+// Lists the pending invitations, oldest first.
+func (a *API) listInvitations(ctx context.Context, in invitationQuery) (*invitationPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	invs, err := a.invitations.ListPending(ctx, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if invs == nil {
+		invs = []*invite.Invitation{} // send [], not null
+	}
+
+	out := in
+	if len(invs) > 0 {
+		out.After = invs[len(invs)-1].ID
+	}
+	return &invitationPage{
+		Items:    invs,
+		Next:     out,
+		LastPage: len(invs) < limit,
+	}, nil
+}
+
+// acceptedInvitation is the response to /accept-invitation.
+type acceptedInvitation struct {
+	Invitation  *invite.Invitation `json:"invitation"`
+	AccessToken string             `json:"access_token"`
+}
+
+// POST /accept-invitation
+//
+// Accepts a pending invitation, creating an access token
+// with the given ID and a grant of the invitation's policy
+// to it. The invitation's token authorizes the request, so
+// the invitee needs no credentials of their own.
+func (a *API) acceptInvitation(ctx context.Context, x struct {
+	Token         string `json:"token"`
+	AccessTokenID string `json:"access_token_id"`
+}) (*acceptedInvitation, error) {
+	inv, err := a.invitations.Check(ctx, x.Token)
+	if err != nil {
+		return nil, err
+	}
+	token, err := a.accessTokens.Create(ctx, x.AccessTokenID, "")
+	if err != nil {
+		return nil, err
+	}
+	err = a.sdb.Exec(ctx, a.grants.Save(ctx, tokenGrant(token.ID, inv.Policy)))
+	if err != nil {
+		a.discardAccessToken(ctx, token.ID)
+		return nil, errors.Wrap(err)
+	}
+
+	inv, err = a.invitations.Accept(ctx, x.Token, token.ID)
+	if err != nil {
+		// The invitation was accepted, revoked or renewed
+		// since it was checked.
+		a.discardAccessToken(ctx, token.ID)
+		return nil, err
+	}
+	return &acceptedInvitation{Invitation: inv, AccessToken: token.Token}, nil
+}
+
+// discardAccessToken deletes an access token created for an
+// invitation that couldn't be accepted, along with its
+// grants. Failures are only logged.
+func (a *API) discardAccessToken(ctx context.Context, id string) {
+	err := a.accessTokens.Delete(ctx, id)
+	if err != nil {
+		log.Error(ctx, err, "discarding access token "+id)
+	}
+	err = a.sdb.Exec(ctx, a.deleteGrantsByAccessToken(id))
+	if err != nil {
+		log.Error(ctx, err, "discarding grants for access token "+id)
+	}
+}
@@ -0,0 +1,345 @@
+// Package invite stores invitations to use a Chain Core.
+//
+// An invitation is addressed to an email address and carries
+// a secret token. Whoever holds the token may accept the
+// invitation once, before it expires, in exchange for an
+// access token with the invitation's policy. The core doesn't
+// send email itself: the token is returned to the member who
+// created or resent the invitation, who forwards it to the
+// invitee.
+package invite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/crypto/sha3pool"
+	"chain/database/pg"
+	"chain/errors"
+)
+
+const (
+	secretSize = 32
+
+	// DefaultTTL is how long an invitation is valid for
+	// if no other duration is given.
+	DefaultTTL = 7 * 24 * time.Hour
+
+	// MaxTTL is the longest an invitation may be valid for.
+	MaxTTL = 30 * 24 * time.Hour
+)
+
+// Statuses.
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+	StatusExpired  = "expired"
+)
+
+var (
+	// ErrBadEmail is returned for a malformed email address.
+	ErrBadEmail = errors.New("invalid email address")
+
+	// ErrBadTTL is returned for an invitation lifetime that
+	// isn't positive or is longer than MaxTTL.
+	ErrBadTTL = errors.New("invalid invitation lifetime")
+
+	// ErrInvalid is returned when accepting an invitation
+	// with a token that doesn't match a pending invitation.
+	ErrInvalid = errors.New("invalid invitation token")
+
+	// ErrNotPending is returned when resending or revoking
+	// an invitation that has been accepted or revoked.
+	ErrNotPending = errors.New("invitation is not pending")
+)
+
+// Invitation is an invitation to use the core under a policy.
+type Invitation struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	Policy        string     `json:"policy"`
+	Status        string     `json:"status"`
+	Token         string     `json:"token,omitempty"` // only when created or resent
+	AccessTokenID string     `json:"access_token_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	AcceptedAt    *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Store stores invitations.
+type Store struct {
+	db pg.DB
+}
+
+// NewStore returns a new Store using the given database.
+func NewStore(db pg.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create creates an invitation for email to use the core
+// under policy, valid for ttl, or DefaultTTL if ttl is zero.
+// The caller must check that the policy may be granted by
+// invitation.
+func (s *Store) Create(ctx context.Context, email, policy string, ttl time.Duration) (*Invitation, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return nil, errors.WithDetailf(ErrBadEmail, "invalid email address %q", email)
+	}
+	ttl, err = validTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	secret, hashed, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+		INSERT INTO invitations (email, policy, hashed_secret, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 microsecond')
+		RETURNING id, created_at, expires_at
+	`
+	inv := &Invitation{Email: email, Policy: policy, Status: StatusPending}
+	err = s.db.QueryRowContext(ctx, q, email, policy, hashed, int64(ttl/time.Microsecond)).
+		Scan(&inv.ID, &inv.CreatedAt, &inv.ExpiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting invitation")
+	}
+	inv.Token = token(inv.ID, secret)
+	return inv, nil
+}
+
+// Resend replaces the token of the pending or expired
+// invitation with the given ID, invalidating the old one,
+// and renews it for ttl, or DefaultTTL if ttl is zero.
+func (s *Store) Resend(ctx context.Context, id string, ttl time.Duration) (*Invitation, error) {
+	ttl, err := validTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	secret, hashed, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		UPDATE invitations
+		SET hashed_secret = $2, expires_at = now() + $3 * interval '1 microsecond'
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+	res, err := s.db.ExecContext(ctx, q, id, hashed, int64(ttl/time.Microsecond))
+	if err != nil {
+		return nil, errors.Wrap(err, "renewing invitation")
+	}
+	err = s.checkUpdated(ctx, res, id)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	inv.Token = token(id, secret)
+	return inv, nil
+}
+
+// Revoke revokes the pending or expired invitation with the
+// given ID.
+func (s *Store) Revoke(ctx context.Context, id string) error {
+	const q = `
+		UPDATE invitations SET revoked_at = now()
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+	res, err := s.db.ExecContext(ctx, q, id)
+	if err != nil {
+		return errors.Wrap(err, "revoking invitation")
+	}
+	return s.checkUpdated(ctx, res, id)
+}
+
+// checkUpdated returns nil if res updated a row, and
+// otherwise an error saying why the invitation with the
+// given ID wasn't updated.
+func (s *Store) checkUpdated(ctx context.Context, res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n > 0 {
+		return nil
+	}
+	inv, err := s.Find(ctx, id)
+	if err != nil {
+		return err
+	}
+	return errors.WithDetailf(ErrNotPending, "invitation %s is %s", id, inv.Status)
+}
+
+// Check returns the pending invitation tok is a token for.
+func (s *Store) Check(ctx context.Context, tok string) (*Invitation, error) {
+	id, hashed, err := parseToken(tok)
+	if err != nil {
+		return nil, err
+	}
+	const q = `SELECT ` + columns + ` FROM invitations WHERE id = $1 AND hashed_secret = $2`
+	inv, err := scan(s.db.QueryRowContext(ctx, q, id, hashed))
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrap(ErrInvalid)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "loading invitation")
+	}
+	if inv.Status != StatusPending {
+		return nil, errors.WithDetailf(ErrInvalid, "invitation is %s", inv.Status)
+	}
+	return inv, nil
+}
+
+// Accept marks the invitation tok is a token for as
+// accepted, in exchange for the access token with the given
+// ID. If the invitation is no longer pending, for instance
+// because it was accepted concurrently, it returns
+// ErrInvalid.
+func (s *Store) Accept(ctx context.Context, tok, accessTokenID string) (*Invitation, error) {
+	id, hashed, err := parseToken(tok)
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		UPDATE invitations SET accepted_at = now(), access_token_id = $3
+		WHERE id = $1 AND hashed_secret = $2
+			AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+	`
+	res, err := s.db.ExecContext(ctx, q, id, hashed, accessTokenID)
+	if err != nil {
+		return nil, errors.Wrap(err, "accepting invitation")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.Wrap(ErrInvalid)
+	}
+	return s.Find(ctx, id)
+}
+
+// Find returns the invitation with the given ID.
+func (s *Store) Find(ctx context.Context, id string) (*Invitation, error) {
+	const q = `SELECT ` + columns + ` FROM invitations WHERE id = $1`
+	inv, err := scan(s.db.QueryRowContext(ctx, q, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "invitation %s", id)
+	}
+	return inv, errors.Wrap(err, "loading invitation")
+}
+
+// ListPending lists the pending invitations, oldest first,
+// starting after the invitation with ID after.
+func (s *Store) ListPending(ctx context.Context, after string, limit int) ([]*Invitation, error) {
+	const q = `
+		SELECT ` + columns + ` FROM invitations
+		WHERE accepted_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+			AND ($1 = '' OR id > $1)
+		ORDER BY id
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, q, after, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing invitations")
+	}
+	defer rows.Close()
+	var invs []*Invitation
+	for rows.Next() {
+		inv, err := scan(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scanning invitation")
+		}
+		invs = append(invs, inv)
+	}
+	return invs, errors.Wrap(rows.Err())
+}
+
+const columns = `id, email, policy, access_token_id, created_at, expires_at, accepted_at, revoked_at, now()`
+
+func scan(row interface {
+	Scan(...interface{}) error
+}) (*Invitation, error) {
+	var (
+		inv                   Invitation
+		accessTokenID         sql.NullString
+		acceptedAt, revokedAt pq.NullTime
+		now                   time.Time
+	)
+	err := row.Scan(&inv.ID, &inv.Email, &inv.Policy, &accessTokenID, &inv.CreatedAt, &inv.ExpiresAt, &acceptedAt, &revokedAt, &now)
+	if err != nil {
+		return nil, err
+	}
+	inv.AccessTokenID = accessTokenID.String
+	switch {
+	case acceptedAt.Valid:
+		inv.Status = StatusAccepted
+		inv.AcceptedAt = &acceptedAt.Time
+	case revokedAt.Valid:
+		inv.Status = StatusRevoked
+		inv.RevokedAt = &revokedAt.Time
+	case !now.Before(inv.ExpiresAt):
+		inv.Status = StatusExpired
+	default:
+		inv.Status = StatusPending
+	}
+	return &inv, nil
+}
+
+func validTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 {
+		return DefaultTTL, nil
+	}
+	if ttl < 0 || ttl > MaxTTL {
+		return 0, errors.WithDetailf(ErrBadTTL, "ttl must be positive and at most %s", MaxTTL)
+	}
+	return ttl, nil
+}
+
+func newSecret() (secret, hashed []byte, err error) {
+	secret = make([]byte, secretSize)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "generating invitation secret")
+	}
+	return secret, hash(secret), nil
+}
+
+func hash(secret []byte) []byte {
+	var h [32]byte
+	sha3pool.Sum256(h[:], secret)
+	return h[:]
+}
+
+// token returns the invitation token for the invitation
+// with the given ID and secret, of the form <id>:<secret>.
+func token(id string, secret []byte) string {
+	return fmt.Sprintf("%s:%x", id, secret)
+}
+
+// parseToken returns the invitation ID and hashed secret
+// from tok.
+func parseToken(tok string) (id string, hashed []byte, err error) {
+	i := strings.IndexByte(tok, ':')
+	if i < 0 {
+		return "", nil, errors.WithDetail(ErrInvalid, "token must be of the form <id>:<secret>")
+	}
+	secret, err := hex.DecodeString(tok[i+1:])
+	if err != nil || len(secret) != secretSize {
+		return "", nil, errors.WithDetail(ErrInvalid, "token must be of the form <id>:<secret>")
+	}
+	return tok[:i], hash(secret), nil
+}
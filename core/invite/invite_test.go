@@ -0,0 +1,79 @@
+package invite
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func TestParseToken(t *testing.T) {
+	secret := bytes.Repeat([]byte{0xab}, secretSize)
+	id, hashed, err := parseToken(token("inv1", secret))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if id != "inv1" || !bytes.Equal(hashed, hash(secret)) {
+		t.Errorf("parseToken(token(inv1, secret)) = %q, %x, want inv1, %x", id, hashed, hash(secret))
+	}
+
+	for _, tok := range []string{"", "inv1", "inv1:zz", "inv1:abab"} {
+		_, _, err := parseToken(tok)
+		if errors.Root(err) != ErrInvalid {
+			t.Errorf("parseToken(%q) error = %v, want %v", tok, err, ErrInvalid)
+		}
+	}
+}
+
+func TestAccept(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(pgtest.NewTx(t))
+
+	_, err := s.Create(ctx, "Ops <ops@example.com>", "client-readonly", 0)
+	if errors.Root(err) != ErrBadEmail {
+		t.Errorf("Create(named address) error = %v, want %v", err, ErrBadEmail)
+	}
+
+	inv, err := s.Create(ctx, "ops@example.com", "client-readonly", time.Hour)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	resent, err := s.Resend(ctx, inv.ID, 0)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Resending invalidates the old token.
+	_, err = s.Check(ctx, inv.Token)
+	if errors.Root(err) != ErrInvalid {
+		t.Errorf("Check(old token) error = %v, want %v", err, ErrInvalid)
+	}
+
+	accepted, err := s.Accept(ctx, resent.Token, "ops")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if accepted.Status != StatusAccepted || accepted.AccessTokenID != "ops" {
+		t.Errorf("Accept() = %+v, want accepted for access token ops", accepted)
+	}
+
+	_, err = s.Accept(ctx, resent.Token, "ops2")
+	if errors.Root(err) != ErrInvalid {
+		t.Errorf("accepting twice: error = %v, want %v", err, ErrInvalid)
+	}
+	err = s.Revoke(ctx, inv.ID)
+	if errors.Root(err) != ErrNotPending {
+		t.Errorf("Revoke(accepted) error = %v, want %v", err, ErrNotPending)
+	}
+	pending, err := s.ListPending(ctx, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("ListPending() = %+v, want none", pending)
+	}
+}
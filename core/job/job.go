@@ -0,0 +1,357 @@
+// Package job runs background work on the leader from a queue
+// persisted in Postgres, so work that's interrupted by a
+// change of leader, or that fails, is picked up again.
+//
+// A job has a kind, naming the handler that runs it, and a
+// JSON payload. A job that fails is retried after a delay
+// that doubles with each attempt. One that fails on its last
+// attempt is dead: it stays in the queue, where it can be
+// listed, but isn't run again.
+//
+// Recurring jobs (see Queue.Every) replace periodic loops.
+// Each kind has one recurring job, which runs once per period
+// whether or not it succeeds.
+package job
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// Statuses.
+const (
+	StatusPending = "pending"
+	StatusDead    = "dead"
+)
+
+const maxRetryDelay = time.Hour
+
+// ErrUnknownKind is returned when enqueuing a job of a kind
+// with no handler.
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// Job is a unit of background work.
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// LastAttempt reports whether the current attempt to run j
+// is its last, so a handler can record a permanent failure.
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Handler runs a job. A job is done when its handler returns
+// nil. Handlers must tolerate being run more than once for a
+// job, since a change of leader can interrupt a run after
+// its work is done but before it's recorded.
+type Handler func(context.Context, *Job) error
+
+// Postpone returns an error telling the queue to run the job
+// again after d without counting the attempt. A handler
+// returns it when a job can't run yet, such as when it waits
+// on some other process.
+func Postpone(d time.Duration) error {
+	return postponeError(d)
+}
+
+type postponeError time.Duration
+
+func (e postponeError) Error() string {
+	return fmt.Sprintf("postponed for %s", time.Duration(e))
+}
+
+type handler struct {
+	run         Handler
+	maxAttempts int
+	period      time.Duration // recurring jobs only
+}
+
+// Queue is a queue of jobs persisted in a database.
+type Queue struct {
+	db pg.DB
+
+	mu       sync.Mutex
+	handlers map[string]*handler
+}
+
+// New returns a new Queue with jobs stored in db.
+func New(db pg.DB) *Queue {
+	return &Queue{db: db, handlers: make(map[string]*handler)}
+}
+
+// Handle registers h to run jobs of the given kind, trying
+// each up to maxAttempts times.
+func (q *Queue) Handle(kind string, maxAttempts int, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = &handler{run: h, maxAttempts: maxAttempts}
+}
+
+// Every registers h to run as a recurring job of the given
+// kind once per period, starting when Run starts. A run that
+// fails isn't retried until the next period.
+func (q *Queue) Every(kind string, period time.Duration, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = &handler{run: h, maxAttempts: 1, period: period}
+}
+
+func (q *Queue) handler(kind string) *handler {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.handlers[kind]
+}
+
+// Enqueue adds a job of the given kind to the queue, with
+// payload encoded as JSON. It returns the job's ID.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}) (string, error) {
+	h := q.handler(kind)
+	if h == nil || h.period > 0 {
+		return "", errors.WithDetailf(ErrUnknownKind, "no handler for job kind %q", kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	const insertQ = `
+		INSERT INTO jobs (kind, payload, max_attempts) VALUES ($1, $2, $3)
+		RETURNING id
+	`
+	var id string
+	err = q.db.QueryRowContext(ctx, insertQ, kind, string(data), h.maxAttempts).Scan(&id)
+	return id, errors.Wrap(err, "enqueuing job")
+}
+
+// Run runs due jobs with the given number of workers until
+// ctx is done. Each idle worker checks for due jobs once per
+// period. Run should run only on the leader. Jobs the previous
+// leader was running when it was deposed are run again.
+func (q *Queue) Run(ctx context.Context, workers int, period time.Duration) {
+	err := q.start(ctx)
+	if err != nil {
+		log.Error(ctx, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, period)
+		}()
+	}
+	wg.Wait()
+	log.Printf(ctx, "Deposed, job queue exiting")
+}
+
+// start releases the jobs claimed by a previous leader, and
+// adds the recurring jobs that aren't in the queue yet.
+func (q *Queue) start(ctx context.Context) error {
+	const releaseQ = `
+		UPDATE jobs SET claimed_at = NULL, run_at = now()
+		WHERE claimed_at IS NOT NULL
+	`
+	_, err := q.db.ExecContext(ctx, releaseQ)
+	if err != nil {
+		return errors.Wrap(err, "releasing claimed jobs")
+	}
+
+	q.mu.Lock()
+	var recurring []string
+	for kind, h := range q.handlers {
+		if h.period > 0 {
+			recurring = append(recurring, kind)
+		}
+	}
+	q.mu.Unlock()
+
+	const insertQ = `
+		INSERT INTO jobs (kind, max_attempts, recurring) VALUES ($1, 1, true)
+		ON CONFLICT (kind) WHERE recurring DO NOTHING
+	`
+	for _, kind := range recurring {
+		_, err = q.db.ExecContext(ctx, insertQ, kind)
+		if err != nil {
+			return errors.Wrapf(err, "adding recurring job %s", kind)
+		}
+	}
+	return nil
+}
+
+func (q *Queue) work(ctx context.Context, period time.Duration) {
+	for {
+		j, err := q.claim(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error(ctx, err)
+		}
+		if j != nil {
+			q.runJob(ctx, j)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(period):
+		}
+	}
+}
+
+// claim claims the due job that's waited longest, counting
+// an attempt to run it. It returns nil if no job is due.
+func (q *Queue) claim(ctx context.Context) (*Job, error) {
+	const q0 = `
+		UPDATE jobs SET claimed_at = now(), attempts = attempts + 1, updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND claimed_at IS NULL AND run_at <= now()
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, status, attempts, max_attempts, COALESCE(last_error, ''), created_at, updated_at
+	`
+	j, err := scanJob(q.db.QueryRowContext(ctx, q0).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return j, errors.Wrap(err, "claiming job")
+}
+
+// runJob runs j and records the result.
+func (q *Queue) runJob(ctx context.Context, j *Job) {
+	h := q.handler(j.Kind)
+	if h == nil {
+		// Left by a newer or older version of Core. Put it
+		// back without counting the attempt.
+		err := q.finish(ctx, j, nil, Postpone(maxRetryDelay))
+		if err != nil {
+			log.Error(ctx, err)
+		}
+		return
+	}
+
+	runErr := h.run(ctx, j)
+	if ctx.Err() != nil {
+		return // deposed; the next leader runs it again
+	}
+	if _, ok := errors.Root(runErr).(postponeError); !ok && runErr != nil {
+		log.Error(ctx, runErr, "running job "+j.ID)
+	}
+	err := q.finish(ctx, j, h, runErr)
+	if err != nil {
+		log.Error(ctx, err)
+	}
+}
+
+// finish records the outcome of an attempt to run j. A job
+// that's done is deleted, unless it's recurring.
+func (q *Queue) finish(ctx context.Context, j *Job, h *handler, runErr error) error {
+	var (
+		query string
+		args  = []interface{}{j.ID}
+	)
+	postpone, postponed := errors.Root(runErr).(postponeError)
+	switch {
+	case postponed:
+		query = `
+			UPDATE jobs SET claimed_at = NULL, attempts = attempts - 1,
+				run_at = now() + $2 * interval '1 second', updated_at = now()
+			WHERE id = $1
+		`
+		args = append(args, time.Duration(postpone).Seconds())
+	case h.period > 0:
+		query = `
+			UPDATE jobs SET claimed_at = NULL, attempts = 0, last_error = $2,
+				run_at = now() + $3 * interval '1 second', updated_at = now()
+			WHERE id = $1
+		`
+		args = append(args, errString(runErr), h.period.Seconds())
+	case runErr == nil:
+		query = `DELETE FROM jobs WHERE id = $1`
+	case j.LastAttempt():
+		query = `
+			UPDATE jobs SET claimed_at = NULL, status = 'dead', last_error = $2, updated_at = now()
+			WHERE id = $1
+		`
+		args = append(args, runErr.Error())
+	default:
+		query = `
+			UPDATE jobs SET claimed_at = NULL, last_error = $2,
+				run_at = now() + least(interval '1 second' * power(2, attempts), $3 * interval '1 second'),
+				updated_at = now()
+			WHERE id = $1
+		`
+		args = append(args, runErr.Error(), maxRetryDelay.Seconds())
+	}
+	_, err := q.db.ExecContext(ctx, query, args...)
+	return errors.Wrapf(err, "recording run of job %s", j.ID)
+}
+
+func errString(err error) sql.NullString {
+	if err == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: err.Error(), Valid: true}
+}
+
+const selectQ = `
+	SELECT id, kind, payload, status, attempts, max_attempts, COALESCE(last_error, ''), created_at, updated_at
+	FROM jobs
+`
+
+func scanJob(sc func(...interface{}) error) (*Job, error) {
+	var (
+		j       Job
+		payload []byte
+	)
+	err := sc(&j.ID, &j.Kind, &payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.LastError, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	j.Payload = payload
+	return &j, nil
+}
+
+// ListDead lists up to limit dead jobs with IDs after the
+// given one, in order of ID.
+func (q *Queue) ListDead(ctx context.Context, after string, limit int) ([]*Job, error) {
+	const where = `
+		WHERE status = 'dead' AND ($1 = '' OR id > $1)
+		ORDER BY id
+		LIMIT $2
+	`
+	rows, err := q.db.QueryContext(ctx, selectQ+where, after, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing dead jobs")
+	}
+	defer rows.Close()
+	var jobs []*Job
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			return nil, errors.Wrap(err, "scanning dead job")
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, errors.Wrap(rows.Err())
+}
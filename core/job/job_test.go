@@ -0,0 +1,127 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"chain/database/pg/pgtest"
+	"chain/testutil"
+)
+
+func TestRetryUntilDead(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	q := New(db)
+
+	var runs int
+	q.Handle("fail", 2, func(context.Context, *Job) error {
+		runs++
+		return errors.New("boom")
+	})
+	id, err := q.Enqueue(ctx, "fail", map[string]int{"n": 1})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		j, err := q.claim(ctx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if j == nil || j.ID != id {
+			t.Fatalf("attempt %d: claimed %+v, want job %s", i+1, j, id)
+		}
+		q.runJob(ctx, j)
+
+		// Make the retry due now.
+		_, err = db.ExecContext(ctx, `UPDATE jobs SET run_at = now() - interval '1 second'`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	j, err := q.claim(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if j != nil {
+		t.Errorf("claimed %+v after last attempt, want nothing", j)
+	}
+	if runs != 2 {
+		t.Errorf("runs = %d, want 2", runs)
+	}
+
+	dead, err := q.ListDead(ctx, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(dead) != 1 || dead[0].ID != id || dead[0].LastError != "boom" || string(dead[0].Payload) != `{"n": 1}` {
+		t.Errorf("dead jobs = %+v, want job %s failed with boom", dead, id)
+	}
+}
+
+func TestPostpone(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	q := New(db)
+	q.Handle("wait", 1, func(context.Context, *Job) error {
+		return Postpone(time.Minute)
+	})
+	_, err := q.Enqueue(ctx, "wait", nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	j, err := q.claim(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	q.runJob(ctx, j)
+
+	var (
+		attempts int
+		status   string
+		waiting  bool
+	)
+	err = db.QueryRowContext(ctx, `SELECT attempts, status, run_at > now() FROM jobs`).Scan(&attempts, &status, &waiting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 0 || status != StatusPending || !waiting {
+		t.Errorf("got attempts %d, status %s, waiting %t; want 0, pending, true", attempts, status, waiting)
+	}
+}
+
+func TestRecurring(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	q := New(db)
+	q.Every("tick", time.Minute, func(context.Context, *Job) error {
+		return errors.New("boom")
+	})
+	for i := 0; i < 2; i++ {
+		err := q.start(ctx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	j, err := q.claim(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if j == nil || j.Kind != "tick" {
+		t.Fatalf("claimed %+v, want the tick job", j)
+	}
+	q.runJob(ctx, j)
+
+	// A failed recurring job waits for the next period
+	// instead of dying.
+	var n int
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM jobs WHERE status = 'pending' AND attempts = 0 AND run_at > now()`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d rescheduled tick jobs, want 1", n)
+	}
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/job"
+)
+
+const (
+	jobWorkers     = 4
+	pollJobsPeriod = time.Second
+
+	consolidateUTXOsJob = "utxo_consolidation"
+	runAccrualsJob      = "accruals"
+	runSubscriptionsJob = "subscriptions"
+	runPayoutsJob       = "payouts"
+	expireHTLCsJob      = "htlc_expiry"
+)
+
+// jobPage is the response to /list-dead-jobs.
+type jobPage struct {
+	Items    []*job.Job `json:"items"`
+	Next     jobQuery   `json:"next"`
+	LastPage bool       `json:"last_page"`
+}
+
+type jobQuery struct {
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-dead-jobs
+//
+// Lists the background jobs that failed on every attempt,
+// with the error from the last, oldest first.
+func (a *API) listDeadJobs(ctx context.Context, in jobQuery) (*jobPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	jobs, err := a.jobs.ListDead(ctx, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if jobs == nil {
+		jobs = []*job.Job{} // send [], not null
+	}
+
+	out := in
+	if len(jobs) > 0 {
+		out.After = jobs[len(jobs)-1].ID
+	}
+	return &jobPage{
+		Items:    jobs,
+		Next:     out,
+		LastPage: len(jobs) < limit,
+	}, nil
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"chain/core/export"
+	"chain/core/query"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+// listJournalEntries is an http handler for listing
+// transactions as double-entry journal entries, over a range
+// of blocks, with a marker closing each accounting period in
+// the range. If no until_block is provided, or it hasn't been
+// indexed yet, the range ends at the most recently indexed
+// block; the resolved height is returned in `next` so that
+// every page covers the same range.
+// To list one closed period, set since_block to the previous
+// period's end and until_block to its own.
+//
+// POST /list-journal-entries
+func (a *API) listJournalEntries(ctx context.Context, in requestQuery) (result page, err error) {
+	if !a.indexTxs {
+		return result, errors.WithDetail(errNoTxIndex, "the journal is built from the transaction index")
+	}
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+
+	until, err := a.indexedUntil(ctx, in.UntilBlock)
+	if err != nil {
+		return result, err
+	}
+	if until > math.MaxInt64 {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "until_block is too large")
+	}
+	if in.SinceBlock > until {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "since_block cannot be after until_block")
+	}
+
+	var after *query.JournalAfter
+	if in.After != "" {
+		after, err = query.DecodeJournalAfter(in.After)
+		if err != nil {
+			return result, errors.Wrap(err, "decoding `after`")
+		}
+	}
+
+	entries, nextAfter, err := a.indexer.Journal(ctx, in.SinceBlock, until, after, limit)
+	if err != nil {
+		return result, errors.Wrap(err, "querying journal")
+	}
+
+	// Period close markers don't count toward the page size.
+	var txs int
+	for _, e := range entries {
+		if e.Type == query.EntryTransaction {
+			txs++
+		}
+	}
+
+	out := in
+	out.UntilBlock = until
+	out.After = nextAfter.String()
+	return page{
+		Items:    httpjson.Array(entries),
+		LastPage: txs < limit,
+		Next:     out,
+	}, nil
+}
+
+// POST /close-journal-period
+//
+// Closes the accounting period ending with the given block.
+// A period close marker appears in the journal after the
+// block's last transaction. Periods close in order, and a
+// closed period can't be reopened.
+func (a *API) closeJournalPeriod(ctx context.Context, x struct {
+	Name        string `json:"name"`
+	BlockHeight uint64 `json:"block_height"`
+}) (*query.Period, error) {
+	if !a.indexTxs {
+		return nil, errors.WithDetail(errNoTxIndex, "the journal is built from the transaction index")
+	}
+	if x.BlockHeight == 0 || x.BlockHeight > a.chain.Height() {
+		return nil, errors.WithDetailf(query.ErrBadPeriodEnd, "block height must be from 1 to %d", a.chain.Height())
+	}
+	b, err := a.chain.GetBlock(ctx, x.BlockHeight)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return a.indexer.ClosePeriod(ctx, x.Name, b.Height, b.Time())
+}
+
+// journalPeriodList is the response to /list-journal-periods.
+type journalPeriodList struct {
+	Items []*query.Period `json:"items"`
+}
+
+// POST /list-journal-periods
+func (a *API) listJournalPeriods(ctx context.Context) (*journalPeriodList, error) {
+	periods, err := a.indexer.Periods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if periods == nil {
+		periods = []*query.Period{} // send [], not null
+	}
+	return &journalPeriodList{Items: periods}, nil
+}
+
+// POST /create-journal-export
+//
+// Requests an export of the journal for a range of blocks, in
+// CSV or OFX format for accounting software, which the leader
+// writes to ledger_snapshot_dir in the background. The range
+// is either a closed period, named by period_id, or the blocks
+// after since_block up to and including until_block, which
+// defaults to the most recently indexed block. Poll
+// /get-journal-export for its progress.
+func (a *API) createJournalExport(ctx context.Context, x struct {
+	Format     string `json:"format"`
+	PeriodID   string `json:"period_id"`
+	SinceBlock uint64 `json:"since_block"`
+	UntilBlock uint64 `json:"until_block"`
+}) (*export.JournalExport, error) {
+	if !a.indexTxs {
+		return nil, errors.WithDetail(errNoTxIndex, "the journal is built from the transaction index")
+	}
+	since, until := x.SinceBlock, x.UntilBlock
+	if x.PeriodID != "" {
+		if since != 0 || until != 0 {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "period_id cannot be combined with since_block or until_block")
+		}
+		periods, err := a.indexer.Periods(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var found bool
+		for _, p := range periods {
+			if p.ID == x.PeriodID {
+				until, found = p.EndHeight, true
+				break
+			}
+			since = p.EndHeight
+		}
+		if !found {
+			return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "journal period %s", x.PeriodID)
+		}
+	}
+	if until == 0 {
+		until = a.pinStore.Height(query.TxPinName)
+	}
+	if until == 0 || until > a.chain.Height() {
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "until_block must be from 1 to %d", a.chain.Height())
+	}
+	if since >= until {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "since_block must be before until_block")
+	}
+	b, err := a.chain.GetBlock(ctx, until)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return a.exports.CreateJournal(ctx, strings.ToLower(x.Format), since, until, b.Time())
+}
+
+// POST /get-journal-export
+func (a *API) getJournalExport(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*export.JournalExport, error) {
+	return a.exports.FindJournal(ctx, x.ID)
+}
+
+// journalExportList is the response to /list-journal-exports.
+type journalExportList struct {
+	Items []*export.JournalExport `json:"items"`
+}
+
+// POST /list-journal-exports
+func (a *API) listJournalExports(ctx context.Context) (*journalExportList, error) {
+	list, err := a.exports.ListJournals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*export.JournalExport{} // send [], not null
+	}
+	return &journalExportList{Items: list}, nil
+}
+
+// cleanGLAccountCode validates a gl_account_code tuple.
+func cleanGLAccountCode(tup []string) error {
+	switch tup[0] {
+	case query.LedgerAccount, query.LedgerIssuance, query.LedgerRetirement, query.LedgerExternal:
+	default:
+		return errors.WithDetailf(errBadConfigValue, "Ledger must be %s, %s, %s or %s.",
+			query.LedgerAccount, query.LedgerIssuance, query.LedgerRetirement, query.LedgerExternal)
+	}
+	if tup[1] == "" {
+		return errors.WithDetailf(errBadConfigValue, "Key must be an ID, an alias or *.")
+	}
+	if strings.TrimSpace(tup[2]) == "" {
+		return errors.WithDetailf(errBadConfigValue, "Account code must not be empty.")
+	}
+	tup[2] = strings.TrimSpace(tup[2])
+	return nil
+}
+
+// cleanGLCurrencyCode validates a gl_currency_code tuple.
+func cleanGLCurrencyCode(tup []string) error {
+	if tup[0] == "" {
+		return errors.WithDetailf(errBadConfigValue, "Asset must be an asset ID or alias.")
+	}
+	if strings.TrimSpace(tup[1]) == "" {
+		return errors.WithDetailf(errBadConfigValue, "Currency code must not be empty.")
+	}
+	tup[1] = strings.TrimSpace(tup[1])
+	return nil
+}
@@ -0,0 +1,160 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// lockClass is the first key of the Postgres advisory locks
+// held by singleton workers. The second is a hash of the
+// worker's name.
+const lockClass = 0x43686e
+
+const (
+	lockRetryPeriod = 500 * time.Millisecond
+	lockCheckPeriod = time.Second
+)
+
+// A TxBeginner is a DB that can begin transactions, such as
+// an *sql.DB.
+type TxBeginner interface {
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Singletons runs background workers that must never run in
+// two processes at once, such as the block generator.
+//
+// Leader election alone doesn't guarantee that: a leader that
+// stalls for longer than its lease is replaced, but keeps
+// working until it notices. So each singleton worker also
+// holds a Postgres advisory lock while it runs. A new
+// leader's worker waits for the lock until the old leader's
+// worker has stopped, or its process has exited.
+type Singletons struct {
+	db      pg.DB
+	address string
+}
+
+// NewSingletons returns a new Singletons running workers in
+// the process with the given address. Workers are locked
+// using transactions on db, which must be a TxBeginner
+// outside of tests.
+func NewSingletons(db pg.DB, address string) *Singletons {
+	return &Singletons{db: db, address: address}
+}
+
+// Go starts a goroutine running f once this process holds the
+// advisory lock for the given name. The context passed to f is
+// canceled when ctx is done, or if the lock is lost because
+// the connection holding it fails, in which case Go tries to
+// take it again. The lock is released once f returns.
+func (s *Singletons) Go(ctx context.Context, name string, f func(context.Context)) {
+	b, ok := s.db.(TxBeginner)
+	if !ok {
+		log.Printf(ctx, "Running %s without a singleton lock", name)
+		go f(ctx)
+		return
+	}
+	go func() {
+		for {
+			ran, err := s.runLocked(ctx, b, name, f)
+			if err != nil {
+				log.Error(ctx, err, "singleton "+name)
+			}
+			if ran && err == nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(lockRetryPeriod):
+			}
+		}
+	}()
+}
+
+// runLocked runs f if it can take the lock for name, until f
+// returns or the lock is lost. It reports whether it took the
+// lock.
+func (s *Singletons) runLocked(ctx context.Context, b TxBeginner, name string, f func(context.Context)) (bool, error) {
+	// The transaction isn't bound to ctx: it must outlive f,
+	// so that the lock isn't released while f is still running.
+	bg := context.Background()
+	tx, err := b.BeginTx(bg, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "beginning lock transaction")
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1, hashtext($2))`, lockClass, name).Scan(&locked)
+	if err != nil || !locked {
+		return false, errors.Wrap(err, "taking singleton lock")
+	}
+
+	const recordQ = `
+		INSERT INTO singleton_workers (name, address) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET address = $2, acquired_at = now()
+	`
+	_, err = s.db.ExecContext(ctx, recordQ, name, s.address)
+	if err != nil {
+		return true, errors.Wrap(err, "recording singleton holder")
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(workCtx)
+	}()
+
+	ticks := time.NewTicker(lockCheckPeriod)
+	defer ticks.Stop()
+	for {
+		select {
+		case <-done:
+			return true, nil
+		case <-ticks.C:
+			// The lock lasts as long as the connection. Check
+			// it's still there.
+			_, err = tx.ExecContext(bg, `SELECT 1`)
+			if err != nil {
+				cancel()
+				<-done
+				return true, errors.Wrap(err, "checking singleton lock")
+			}
+		}
+	}
+}
+
+// Holder is a process running a singleton worker.
+type Holder struct {
+	Name       string    `json:"name"`
+	Address    string    `json:"address"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// Holders lists the singleton workers running now, and the
+// processes running them, in order of name.
+func Holders(ctx context.Context, db pg.DB) ([]*Holder, error) {
+	const q = `
+		SELECT w.name, w.address, w.acquired_at FROM singleton_workers w
+		WHERE EXISTS (
+			SELECT 1 FROM pg_locks l
+			WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 2
+				AND l.classid = $1::oid AND l.objid = hashtext(w.name)::oid
+		)
+		ORDER BY w.name
+	`
+	var holders []*Holder
+	err := pg.ForQueryRows(ctx, db, q, lockClass, func(name, address string, acquiredAt time.Time) {
+		holders = append(holders, &Holder{Name: name, Address: address, AcquiredAt: acquiredAt})
+	})
+	return holders, errors.Wrap(err, "listing singleton holders")
+}
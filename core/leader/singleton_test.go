@@ -0,0 +1,61 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/database/pg/pgtest"
+	"chain/testutil"
+)
+
+func TestSingletons(t *testing.T) {
+	ctx := context.Background()
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	s1, s2 := NewSingletons(db, ":1999"), NewSingletons(db, ":2000")
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	ctx2, cancel2 := context.WithCancel(ctx)
+	defer cancel1()
+	defer cancel2()
+
+	running := make(chan string)
+	stopped := make(chan string)
+	worker := func(addr string) func(context.Context) {
+		return func(ctx context.Context) {
+			running <- addr
+			<-ctx.Done()
+			stopped <- addr
+		}
+	}
+	s1.Go(ctx1, "generator", worker(":1999"))
+	if got := <-running; got != ":1999" {
+		t.Fatalf("running %s, want :1999", got)
+	}
+	s2.Go(ctx2, "generator", worker(":2000"))
+	select {
+	case got := <-running:
+		t.Fatalf("%s running while :1999 holds the lock", got)
+	case <-time.After(2 * lockRetryPeriod):
+	}
+
+	holders, err := Holders(ctx, db)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(holders) != 1 || holders[0].Name != "generator" || holders[0].Address != ":1999" {
+		t.Errorf("holders = %+v, want generator held by :1999", holders)
+	}
+
+	// The second process takes over only after the first
+	// process's worker stops.
+	cancel1()
+	if got := <-stopped; got != ":1999" {
+		t.Fatalf("stopped %s, want :1999", got)
+	}
+	if got := <-running; got != ":2000" {
+		t.Fatalf("running %s, want :2000", got)
+	}
+	cancel2()
+	<-stopped
+}
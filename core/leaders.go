@@ -0,0 +1,36 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/leader"
+)
+
+// leaders is the response to /get-leaders.
+type leaders struct {
+	// Core is the address of the Core's leader process, or
+	// empty while a leader is being elected.
+	Core    string           `json:"core"`
+	Workers []*leader.Holder `json:"workers"`
+}
+
+// POST /get-leaders
+//
+// Returns the leader process and the processes running each
+// singleton worker, such as the block generator. Normally
+// these are all the leader; a worker held by another process
+// is still stopping after a change of leader.
+func (a *API) getLeaders(ctx context.Context) (*leaders, error) {
+	addr, err := a.leader.Address(ctx)
+	if err != nil && err != leader.ErrNoLeader {
+		return nil, err
+	}
+	workers, err := leader.Holders(ctx, a.db)
+	if err != nil {
+		return nil, err
+	}
+	if workers == nil {
+		workers = []*leader.Holder{} // send [], not null
+	}
+	return &leaders{Core: addr, Workers: workers}, nil
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"path/filepath"
+
+	"chain/core/export"
+	"chain/errors"
+)
+
+// errNoTxIndex is returned by routes that need the
+// transaction index when it's disabled.
+var errNoTxIndex = errors.New("transaction indexing is disabled")
+
+// cleanLedgerSnapshotDir validates a ledger_snapshot_dir
+// tuple.
+func cleanLedgerSnapshotDir(tup []string) error {
+	if !filepath.IsAbs(tup[0]) {
+		return errors.WithDetailf(errBadConfigValue, "Ledger snapshot directory must be an absolute path.")
+	}
+	tup[0] = filepath.Clean(tup[0])
+	return nil
+}
+
+// POST /create-ledger-snapshot
+//
+// Requests a snapshot of the ledger as of a block, which the
+// leader writes to ledger_snapshot_dir in the background.
+// Poll /get-ledger-snapshot for its progress.
+func (a *API) createLedgerSnapshot(ctx context.Context, x struct {
+	BlockHeight uint64 `json:"block_height"`
+}) (*export.Snapshot, error) {
+	if !a.indexTxs {
+		return nil, errors.WithDetail(errNoTxIndex, "ledger snapshots are built from the transaction index")
+	}
+	if x.BlockHeight == 0 || x.BlockHeight > a.chain.Height() {
+		return nil, errors.WithDetailf(export.ErrBadHeight, "block height must be from 1 to %d", a.chain.Height())
+	}
+	b, err := a.chain.GetBlock(ctx, x.BlockHeight)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return a.exports.Create(ctx, b.Height, b.Hash(), b.Time())
+}
+
+// POST /get-ledger-snapshot
+func (a *API) getLedgerSnapshot(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*export.Snapshot, error) {
+	return a.exports.Find(ctx, x.ID)
+}
+
+// ledgerSnapshotList is the response to /list-ledger-snapshots.
+type ledgerSnapshotList struct {
+	Items []*export.Snapshot `json:"items"`
+}
+
+// POST /list-ledger-snapshots
+func (a *API) listLedgerSnapshots(ctx context.Context) (*ledgerSnapshotList, error) {
+	list, err := a.exports.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*export.Snapshot{} // send [], not null
+	}
+	return &ledgerSnapshotList{Items: list}, nil
+}
@@ -81,4 +81,633 @@ var migrations = []migration{
 		ALTER TABLE ONLY core_id
 			ADD CONSTRAINT core_id_pkey PRIMARY KEY (singleton);
 	`},
+	{Name: `2017-07-05.0.core.freezes.sql`, SQL: `
+		CREATE TABLE freezes (
+			type text NOT NULL,
+			id text NOT NULL,
+			reason text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (type, id)
+		);
+	`},
+	{Name: `2017-07-06.0.core.asset-stats.sql`, SQL: `
+		CREATE TABLE asset_stats (
+			asset_id bytea NOT NULL,
+			hour timestamp with time zone NOT NULL,
+			issued numeric NOT NULL,
+			transferred numeric NOT NULL,
+			retired numeric NOT NULL,
+			PRIMARY KEY (asset_id, hour)
+		);
+		CREATE TABLE asset_stats_blocks (
+			height bigint PRIMARY KEY
+		);
+	`},
+	{Name: `2017-07-07.0.core.address-book.sql`, SQL: `
+		CREATE TABLE address_book (
+			alias text NOT NULL,
+			control_program bytea NOT NULL,
+			verified_at timestamp with time zone,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (alias)
+		);
+	`},
+	{Name: `2017-07-10.0.account.receivers.sql`, SQL: `
+		CREATE TABLE account_receivers (
+			id text DEFAULT next_chain_id('rcv'::text) NOT NULL,
+			control_program bytea NOT NULL,
+			account_id text NOT NULL,
+			expected_asset_id bytea,
+			expected_amount bigint,
+			expires_at timestamp with time zone NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (control_program)
+		);
+		CREATE INDEX account_receivers_account_id_id_idx ON account_receivers (account_id, id);
+		CREATE TABLE account_receiver_payments (
+			output_id bytea NOT NULL,
+			control_program bytea NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			block_height bigint NOT NULL,
+			PRIMARY KEY (output_id)
+		);
+		CREATE INDEX account_receiver_payments_control_program_idx ON account_receiver_payments (control_program);
+	`},
+	{Name: `2017-07-11.0.core.payment-requests.sql`, SQL: `
+		CREATE TABLE payment_requests (
+			id text DEFAULT next_chain_id('pr'::text) NOT NULL,
+			account_id text NOT NULL,
+			control_program bytea NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			received_amount bigint DEFAULT 0 NOT NULL,
+			payer_hints jsonb NOT NULL,
+			status text DEFAULT 'pending' NOT NULL,
+			expires_at timestamp with time zone NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id)
+		);
+		CREATE INDEX payment_requests_control_program_idx ON payment_requests (control_program);
+		CREATE INDEX payment_requests_status_expires_at_idx ON payment_requests (status, expires_at);
+	`},
+	{Name: `2017-07-12.0.core.payment-request-events.sql`, SQL: `
+		ALTER TABLE payment_requests ADD COLUMN callback_url text;
+		CREATE TABLE payment_request_events (
+			id text DEFAULT next_chain_id('pre'::text) NOT NULL,
+			payment_request_id text NOT NULL,
+			type text NOT NULL,
+			received_amount bigint NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			attempts integer DEFAULT 0 NOT NULL,
+			next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+			delivered_at timestamp with time zone,
+			PRIMARY KEY (id)
+		);
+		CREATE INDEX payment_request_events_undelivered_idx ON payment_request_events (id) WHERE delivered_at IS NULL;
+	`},
+	{Name: `2017-07-13.0.core.issuance-fx-snapshots.sql`, SQL: `
+		CREATE TABLE issuance_fx_snapshots (
+			tx_hash bytea NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			currency text NOT NULL,
+			rate numeric NOT NULL,
+			as_of timestamp with time zone NOT NULL,
+			PRIMARY KEY (tx_hash, asset_id)
+		);
+		CREATE INDEX issuance_fx_snapshots_asset_id_as_of_idx ON issuance_fx_snapshots (asset_id, as_of);
+	`},
+	{Name: `2017-07-14.0.core.access-token-environment.sql`, SQL: `
+		ALTER TABLE access_tokens ADD COLUMN environment text DEFAULT 'live' NOT NULL;
+	`},
+	{Name: `2017-07-17.0.account.archive.sql`, SQL: `
+		ALTER TABLE accounts ADD COLUMN archived_at timestamp with time zone;
+		ALTER TABLE annotated_accounts ADD COLUMN archived boolean DEFAULT false NOT NULL;
+	`},
+	{Name: `2017-07-18.0.core.held-transactions.sql`, SQL: `
+		CREATE TABLE held_transactions (
+			id text DEFAULT next_chain_id('htx'::text) NOT NULL,
+			tx_hash bytea NOT NULL,
+			raw_transaction text NOT NULL,
+			reason text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (tx_hash)
+		);
+	`},
+	{Name: `2017-07-19.0.core.held-transaction-reviews.sql`, SQL: `
+		ALTER TABLE held_transactions ADD COLUMN source text DEFAULT 'screening' NOT NULL;
+		ALTER TABLE held_transactions ADD COLUMN status text DEFAULT 'pending' NOT NULL;
+		ALTER TABLE held_transactions ADD COLUMN review_reason text;
+		ALTER TABLE held_transactions ADD COLUMN reviewed_at timestamp with time zone;
+		CREATE INDEX held_transactions_status_idx ON held_transactions (status, id);
+	`},
+	{Name: `2017-07-20.0.core.rules.sql`, SQL: `
+		CREATE TABLE rules (
+			id text DEFAULT next_chain_id('rule'::text) NOT NULL,
+			name text NOT NULL,
+			account_id text,
+			asset_id bytea,
+			window_ms bigint DEFAULT 0 NOT NULL,
+			max_amount bigint DEFAULT 0 NOT NULL,
+			new_counterparty boolean DEFAULT false NOT NULL,
+			action text NOT NULL,
+			webhook_url text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id)
+		);
+		CREATE TABLE rule_activity (
+			tx_hash bytea NOT NULL,
+			account_id text NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (tx_hash, account_id, asset_id)
+		);
+		CREATE INDEX rule_activity_account_id_asset_id_created_at_idx ON rule_activity (account_id, asset_id, created_at);
+		CREATE TABLE rule_counterparties (
+			account_id text NOT NULL,
+			control_program bytea NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (account_id, control_program)
+		);
+		CREATE TABLE rule_matches (
+			id text DEFAULT next_chain_id('rm'::text) NOT NULL,
+			rule_id text NOT NULL,
+			tx_hash bytea NOT NULL,
+			account_id text NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			action text NOT NULL,
+			reason text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			attempts integer DEFAULT 0 NOT NULL,
+			next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+			delivered_at timestamp with time zone,
+			PRIMARY KEY (id),
+			UNIQUE (rule_id, tx_hash, account_id, asset_id)
+		);
+		CREATE INDEX rule_matches_undelivered_idx ON rule_matches (id) WHERE action = 'webhook' AND delivered_at IS NULL;
+	`},
+	{Name: `2017-07-21.0.core.receipt-key.sql`, SQL: `
+		CREATE TABLE receipt_key (
+			singleton boolean DEFAULT true NOT NULL,
+			private_key bytea NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			CONSTRAINT receipt_key_singleton CHECK (singleton),
+			PRIMARY KEY (singleton)
+		);
+	`},
+	{Name: `2017-07-22.0.core.usage.sql`, SQL: `
+		CREATE TABLE usage_daily (
+			day date NOT NULL,
+			metric text NOT NULL,
+			value bigint DEFAULT 0 NOT NULL,
+			PRIMARY KEY (day, metric)
+		);
+		CREATE TABLE usage_warnings (
+			day date NOT NULL,
+			metric text NOT NULL,
+			level text NOT NULL,
+			value bigint NOT NULL,
+			quota bigint NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			attempts integer DEFAULT 0 NOT NULL,
+			next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+			delivered_at timestamp with time zone,
+			PRIMARY KEY (day, metric, level)
+		);
+	`},
+	{Name: `2017-07-23.0.core.invitations.sql`, SQL: `
+		CREATE TABLE invitations (
+			id text DEFAULT next_chain_id('inv'::text) NOT NULL,
+			email text NOT NULL,
+			policy text NOT NULL,
+			hashed_secret bytea NOT NULL,
+			access_token_id text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			expires_at timestamp with time zone NOT NULL,
+			accepted_at timestamp with time zone,
+			revoked_at timestamp with time zone,
+			PRIMARY KEY (id)
+		);
+	`},
+	{Name: `2017-07-24.0.core.service-accounts.sql`, SQL: `
+		CREATE TABLE service_accounts (
+			id text DEFAULT next_chain_id('sa'::text) NOT NULL,
+			alias text NOT NULL,
+			description text DEFAULT ''::text NOT NULL,
+			policies text[] DEFAULT '{}'::text[] NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (alias)
+		);
+		ALTER TABLE access_tokens ADD COLUMN service_account_id text;
+		CREATE INDEX access_tokens_service_account_id_idx ON access_tokens (service_account_id) WHERE service_account_id IS NOT NULL;
+	`},
+	{Name: `2017-07-25.0.core.request-signing.sql`, SQL: `
+		CREATE TABLE request_signing_secrets (
+			access_token_id text NOT NULL,
+			secret bytea NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (access_token_id)
+		);
+		CREATE TABLE request_nonces (
+			access_token_id text NOT NULL,
+			nonce text NOT NULL,
+			expires_at timestamp with time zone NOT NULL,
+			PRIMARY KEY (access_token_id, nonce)
+		);
+		CREATE INDEX request_nonces_expires_at_idx ON request_nonces (expires_at);
+	`},
+	{Name: `2017-07-26.0.core.retention.sql`, SQL: `
+		CREATE INDEX held_transactions_created_at_idx ON held_transactions (created_at);
+		CREATE INDEX payment_request_events_created_at_idx ON payment_request_events (created_at);
+		CREATE INDEX rule_matches_created_at_idx ON rule_matches (created_at);
+	`},
+	{Name: `2017-07-27.0.core.ledger-snapshots.sql`, SQL: `
+		CREATE TABLE ledger_snapshots (
+			id text DEFAULT next_chain_id('lsnap'::text) NOT NULL,
+			block_height bigint NOT NULL,
+			block_id bytea NOT NULL,
+			block_timestamp timestamp with time zone NOT NULL,
+			status text DEFAULT 'pending'::text NOT NULL,
+			path text,
+			sha256 text,
+			assets bigint DEFAULT 0 NOT NULL,
+			unspent_outputs bigint DEFAULT 0 NOT NULL,
+			balances bigint DEFAULT 0 NOT NULL,
+			error text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			completed_at timestamp with time zone,
+			PRIMARY KEY (id)
+		);
+	`},
+	{Name: `2017-07-28.0.core.asset-circulation.sql`, SQL: `
+		CREATE TABLE asset_circulation (
+			asset_id bytea NOT NULL,
+			issued numeric NOT NULL,
+			transferred numeric NOT NULL,
+			retired numeric NOT NULL,
+			PRIMARY KEY (asset_id)
+		);
+		INSERT INTO asset_circulation (asset_id, issued, transferred, retired)
+			SELECT asset_id, sum(issued), sum(transferred), sum(retired)
+			FROM asset_stats GROUP BY asset_id;
+	`},
+	{Name: `2017-07-29.0.core.jobs.sql`, SQL: `
+		CREATE TABLE jobs (
+			id text DEFAULT next_chain_id('job'::text) NOT NULL,
+			kind text NOT NULL,
+			payload jsonb DEFAULT '{}'::jsonb NOT NULL,
+			status text DEFAULT 'pending'::text NOT NULL,
+			recurring boolean DEFAULT false NOT NULL,
+			attempts integer DEFAULT 0 NOT NULL,
+			max_attempts integer NOT NULL,
+			run_at timestamp with time zone DEFAULT now() NOT NULL,
+			claimed_at timestamp with time zone,
+			last_error text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id)
+		);
+		CREATE INDEX jobs_status_run_at_idx ON jobs (status, run_at);
+		CREATE UNIQUE INDEX jobs_recurring_kind_idx ON jobs (kind) WHERE recurring;
+		INSERT INTO jobs (kind, payload, max_attempts)
+			SELECT 'ledger_snapshot', jsonb_build_object('id', id), 3
+			FROM ledger_snapshots WHERE status = 'pending' ORDER BY id;
+	`},
+	{Name: `2017-07-30.0.core.singleton-workers.sql`, SQL: `
+		CREATE TABLE singleton_workers (
+			name text NOT NULL,
+			address text NOT NULL,
+			acquired_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (name)
+		);
+	`},
+	{Name: `2017-07-31.0.core.events.sql`, SQL: `
+		CREATE SEQUENCE events_seq_seq
+			START WITH 1
+			INCREMENT BY 1
+			NO MINVALUE
+			NO MAXVALUE
+			CACHE 1;
+		CREATE TABLE events (
+			seq bigint DEFAULT nextval('events_seq_seq'::regclass) NOT NULL,
+			type text NOT NULL,
+			subject text NOT NULL,
+			data jsonb DEFAULT '{}'::jsonb NOT NULL,
+			once boolean DEFAULT false NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (seq)
+		);
+		ALTER SEQUENCE events_seq_seq OWNED BY events.seq;
+		CREATE INDEX events_type_seq_idx ON events (type, seq);
+		CREATE UNIQUE INDEX events_type_subject_idx ON events (type, subject) WHERE once;
+	`},
+	{Name: `2017-08-01.0.core.event-publisher.sql`, SQL: `
+		CREATE TABLE event_cursors (
+			name text NOT NULL,
+			seq bigint NOT NULL,
+			PRIMARY KEY (name)
+		);
+	`},
+	{Name: `2017-08-02.0.core.journal-periods.sql`, SQL: `
+		CREATE TABLE journal_periods (
+			id text DEFAULT next_chain_id('jp'::text) NOT NULL,
+			name text DEFAULT ''::text NOT NULL,
+			end_height bigint NOT NULL,
+			end_time timestamp with time zone NOT NULL,
+			closed_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (end_height)
+		);
+	`},
+	{Name: `2017-08-03.0.core.journal-exports.sql`, SQL: `
+		CREATE TABLE journal_exports (
+			id text DEFAULT next_chain_id('jx'::text) NOT NULL,
+			format text NOT NULL,
+			since_height bigint NOT NULL,
+			until_height bigint NOT NULL,
+			until_timestamp timestamp with time zone NOT NULL,
+			status text DEFAULT 'pending'::text NOT NULL,
+			path text,
+			sha256 text,
+			lines bigint DEFAULT 0 NOT NULL,
+			error text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			completed_at timestamp with time zone,
+			PRIMARY KEY (id)
+		);
+	`},
+	{Name: `2017-08-04.0.core.account-statements.sql`, SQL: `
+		CREATE TABLE account_statements (
+			id text DEFAULT next_chain_id('stmt'::text) NOT NULL,
+			account_id text NOT NULL,
+			start_time timestamp with time zone NOT NULL,
+			end_time timestamp with time zone NOT NULL,
+			balances jsonb NOT NULL,
+			transactions jsonb NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id)
+		);
+		CREATE INDEX account_statements_account_id_created_at_idx ON account_statements (account_id, created_at);
+	`},
+	{Name: `2017-08-05.0.core.accruals.sql`, SQL: `
+		CREATE TABLE accrual_rules (
+			id text DEFAULT next_chain_id('acr'::text) NOT NULL,
+			name text NOT NULL,
+			type text NOT NULL,
+			asset_id bytea NOT NULL,
+			rate text NOT NULL,
+			flat_amount bigint NOT NULL,
+			period text NOT NULL,
+			account_tags jsonb,
+			destination_account_id text,
+			next_accrual_at timestamp with time zone NOT NULL,
+			disabled_at timestamp with time zone,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id)
+		);
+		CREATE TABLE accruals (
+			id text DEFAULT next_chain_id('acl'::text) NOT NULL,
+			rule_id text NOT NULL,
+			account_id text NOT NULL,
+			asset_id bytea NOT NULL,
+			period_end timestamp with time zone NOT NULL,
+			balance bigint NOT NULL,
+			amount bigint NOT NULL,
+			status text DEFAULT 'planned'::text NOT NULL,
+			tx_hash bytea,
+			error text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (rule_id, account_id, period_end)
+		);
+		CREATE INDEX accruals_account_id_id_idx ON accruals (account_id, id);
+	`},
+	{Name: `2017-08-06.0.core.escrows.sql`, SQL: `
+		CREATE SEQUENCE escrows_key_index_seq;
+		CREATE TABLE escrows (
+			id text DEFAULT next_chain_id('esc'::text) NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			payer_account_id text NOT NULL,
+			payee_account_id text,
+			payee_control_program bytea,
+			payer_xpub bytea NOT NULL,
+			payee_xpub bytea NOT NULL,
+			arbiter_xpub bytea NOT NULL,
+			key_index bigint NOT NULL,
+			control_program bytea NOT NULL,
+			status text DEFAULT 'created'::text NOT NULL,
+			output_id bytea,
+			source_id bytea,
+			source_pos bigint,
+			ref_data_hash bytea,
+			funding_tx_hash bytea,
+			settlement_tx_hash bytea,
+			dispute_reason text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (control_program),
+			UNIQUE (output_id)
+		);
+		CREATE INDEX escrows_status_id_idx ON escrows (status, id);
+	`},
+	{Name: `2017-08-07.0.core.output-locks.sql`, SQL: `
+		ALTER TABLE account_control_programs ADD COLUMN unlock_height bigint;
+		ALTER TABLE account_utxos ADD COLUMN unlock_time_ms bigint;
+		ALTER TABLE account_utxos ADD COLUMN unlock_height bigint;
+		ALTER TABLE annotated_outputs ADD COLUMN unlock_time_ms bigint;
+		ALTER TABLE annotated_outputs ADD COLUMN unlock_height bigint;
+	`},
+	{Name: `2017-08-08.0.core.subscriptions.sql`, SQL: `
+		CREATE TABLE subscriptions (
+			id text DEFAULT next_chain_id('sub'::text) NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			source_account_id text NOT NULL,
+			destination_account_id text,
+			destination_control_program bytea,
+			interval_unit text NOT NULL,
+			interval_count integer NOT NULL,
+			start_at timestamp with time zone NOT NULL,
+			end_at timestamp with time zone,
+			max_failures integer NOT NULL,
+			status text DEFAULT 'active'::text NOT NULL,
+			period bigint DEFAULT 0 NOT NULL,
+			next_payment_at timestamp with time zone,
+			failures integer DEFAULT 0 NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id)
+		);
+		CREATE INDEX subscriptions_status_next_payment_at_idx ON subscriptions (status, next_payment_at);
+		CREATE TABLE subscription_executions (
+			id text DEFAULT next_chain_id('subx'::text) NOT NULL,
+			subscription_id text NOT NULL,
+			scheduled_at timestamp with time zone NOT NULL,
+			amount bigint NOT NULL,
+			status text DEFAULT 'submitting'::text NOT NULL,
+			tx_hash bytea,
+			error text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (subscription_id, scheduled_at)
+		);
+	`},
+	{Name: `2017-08-09.0.core.payout-batches.sql`, SQL: `
+		CREATE TABLE payout_batches (
+			id text DEFAULT next_chain_id('pob'::text) NOT NULL,
+			source_account_id text NOT NULL,
+			status text NOT NULL,
+			row_count integer NOT NULL,
+			created_by text,
+			approved_by text,
+			review_note text,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			reviewed_at timestamp with time zone,
+			completed_at timestamp with time zone,
+			PRIMARY KEY (id)
+		);
+		CREATE INDEX payout_batches_status_idx ON payout_batches (status, id);
+		CREATE TABLE payout_rows (
+			batch_id text NOT NULL,
+			"position" integer NOT NULL,
+			destination_account_id text,
+			destination_control_program bytea,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			reference text,
+			status text NOT NULL,
+			error text,
+			tx_hash bytea,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (batch_id, "position")
+		);
+	`},
+	{Name: `2017-08-10.0.core.counterparties.sql`, SQL: `
+		CREATE TABLE federation_key (
+			singleton boolean DEFAULT true NOT NULL,
+			private_key bytea NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			CONSTRAINT federation_key_singleton CHECK (singleton),
+			PRIMARY KEY (singleton)
+		);
+		CREATE TABLE counterparties (
+			id text DEFAULT next_chain_id('cpty'::text) NOT NULL,
+			alias text,
+			url text NOT NULL,
+			public_key bytea NOT NULL,
+			supported_assets bytea[] NOT NULL,
+			access_token text,
+			status text DEFAULT 'unverified'::text NOT NULL,
+			last_error text,
+			verified_at timestamp with time zone,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (alias)
+		);
+	`},
+	{Name: `2017-08-11.0.core.htlcs.sql`, SQL: `
+		CREATE SEQUENCE htlcs_key_index_seq;
+		CREATE TABLE htlcs (
+			id text DEFAULT next_chain_id('htlc'::text) NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			payer_account_id text NOT NULL,
+			payee_account_id text,
+			payee_control_program bytea,
+			payer_xpub bytea NOT NULL,
+			payee_xpub bytea NOT NULL,
+			hash bytea NOT NULL,
+			expires_at timestamp with time zone NOT NULL,
+			counterparty_id text,
+			auto_refund boolean DEFAULT false NOT NULL,
+			key_index bigint NOT NULL,
+			control_program bytea NOT NULL,
+			status text DEFAULT 'created'::text NOT NULL,
+			preimage bytea,
+			output_id bytea,
+			source_id bytea,
+			source_pos bigint,
+			ref_data_hash bytea,
+			funding_tx_hash bytea,
+			settlement_tx_hash bytea,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (control_program),
+			UNIQUE (output_id)
+		);
+		CREATE INDEX htlcs_status_id_idx ON htlcs (status, id);
+		CREATE INDEX htlcs_status_expires_at_idx ON htlcs (status, expires_at);
+	`},
+	{Name: `2017-08-12.0.core.ilp.sql`, SQL: `
+		CREATE TABLE ilp_pointers (
+			id text DEFAULT next_chain_id('ptr'::text) NOT NULL,
+			name text NOT NULL,
+			account_id text NOT NULL,
+			secret bytea NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (name)
+		);
+		CREATE TABLE ilp_peers (
+			id text DEFAULT next_chain_id('ilpp'::text) NOT NULL,
+			alias text,
+			access_token_id text NOT NULL,
+			account_id text NOT NULL,
+			asset_id bytea NOT NULL,
+			max_packet_amount bigint DEFAULT 0 NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (alias),
+			UNIQUE (access_token_id)
+		);
+		CREATE TABLE ilp_payments (
+			id text DEFAULT next_chain_id('ilpx'::text) NOT NULL,
+			peer_id text NOT NULL,
+			pointer_id text NOT NULL,
+			account_id text NOT NULL,
+			asset_id bytea NOT NULL,
+			amount bigint NOT NULL,
+			execution_condition bytea NOT NULL,
+			fulfillment bytea NOT NULL,
+			status text NOT NULL,
+			error text,
+			tx_hash bytea,
+			expires_at timestamp with time zone NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			updated_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE (peer_id, execution_condition)
+		);
+		CREATE INDEX ilp_payments_status_id_idx ON ilp_payments (status, id);
+	`},
+	{Name: `2017-08-13.0.core.asset-stats-backfill.sql`, SQL: `
+		UPDATE block_processors SET height = (SELECT COALESCE(MIN(height), 1) - 1 FROM blocks)
+		WHERE name = 'asset_stats';
+	`},
+	{Name: `2017-08-14.0.core.asset-ledger-totals.sql`, SQL: `
+		CREATE TABLE asset_ledger_totals (
+			asset_id bytea PRIMARY KEY,
+			issued numeric NOT NULL,
+			transferred numeric NOT NULL,
+			retired numeric NOT NULL
+		);
+		ALTER TABLE asset_stats_blocks ADD COLUMN reconciled boolean NOT NULL DEFAULT false;
+		CREATE INDEX asset_stats_blocks_unreconciled_idx ON asset_stats_blocks (height) WHERE NOT reconciled;
+	`},
+	{Name: `2017-08-15.0.core.ledger-verify-index.sql`, SQL: `
+		CREATE INDEX annotated_outputs_unspent_asset_idx ON annotated_outputs (asset_id)
+			WHERE account_id IS NOT NULL AND upper_inf(timespan);
+	`},
 }
@@ -72,6 +72,27 @@ func PrintStatus(db pg.DB) error {
 	return nil
 }
 
+// Pending returns the names of the built-in migrations
+// that have not been applied to db, in the order Run would
+// apply them.
+func Pending(db pg.DB) ([]string, error) {
+	return pending(db, append([]migration(nil), migrations...))
+}
+
+func pending(db pg.DB, ms []migration) ([]string, error) {
+	err := loadStatus(db, ms)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, m := range ms {
+		if m.AppliedAt.IsZero() {
+			names = append(names, m.Name)
+		}
+	}
+	return names, nil
+}
+
 const createMigrationTableSQL = `
 	  CREATE TABLE IF NOT EXISTS migrations (
 		  filename text NOT NULL,
@@ -3,6 +3,7 @@ package migrate
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"reflect"
 	"testing"
 	"time"
 
@@ -123,3 +124,42 @@ func TestApplyMigrationSQL(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPending(t *testing.T) {
+	save := migrations
+	defer func() { migrations = save }()
+
+	_, db := pgtest.NewDB(t, "testdata/empty.sql")
+
+	migrations = []migration{
+		{Name: "a", SQL: `CREATE TABLE a (x int);`},
+		{Name: "b", SQL: `CREATE TABLE b (x int);`},
+	}
+	for i, m := range migrations {
+		h := sha256.Sum256([]byte(m.SQL))
+		migrations[i].Hash = hex.EncodeToString(h[:])
+	}
+	all := migrations
+
+	got, err := Pending(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("before Run: Pending = %v, want %v", got, want)
+	}
+
+	migrations = all[:1]
+	err = Run(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations = all
+	got, err = Pending(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Run: Pending = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"encoding"
+	stdjson "encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"chain/core/config"
+	"chain/encoding/json"
+	"chain/net/http/httpjson"
+)
+
+var (
+	marshalerType     = reflect.TypeOf((*stdjson.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationType      = reflect.TypeOf(json.Duration{})
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// GET /openapi.json
+//
+// openAPI returns an OpenAPI 3 document describing the client
+// routes. Request bodies are described by reflecting on the
+// handlers' parameter types, so the document always matches
+// the running core. Handlers that return interface{} are
+// described as returning any JSON value.
+func (a *API) openAPI(ctx context.Context) (map[string]interface{}, error) {
+	paths := make(map[string]interface{})
+	for _, r := range a.clientRoutes() {
+		in, out, err := httpjson.Types(r.f)
+		if err != nil {
+			return nil, err
+		}
+		op := map[string]interface{}{
+			"operationId": strings.TrimPrefix(r.path, "/"),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Success.",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": responseSchema(out)},
+					},
+				},
+			},
+		}
+		if in != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": typeSchema(in, nil)},
+				},
+			}
+		}
+		paths[r.path] = map[string]interface{}{"post": op}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "Chain Core API",
+			"version": config.Version,
+		},
+		"paths": paths,
+	}, nil
+}
+
+// responseSchema returns the schema of a handler's response
+// body of type t. Handlers without a response body send
+// httpjson.DefaultResponse.
+func responseSchema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"message": map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+	return typeSchema(t, nil)
+}
+
+// typeSchema returns an OpenAPI schema for values of type t
+// encoded with encoding/json. The types in seen are being
+// described by an enclosing call; recursive references to
+// them are described as objects.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pt := reflect.PtrTo(t)
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		// json.Duration reads either form, but writes milliseconds.
+		return map[string]interface{}{"type": "integer", "description": "Milliseconds, or a duration string such as 5s."}
+	case t.Implements(marshalerType) || pt.Implements(marshalerType):
+		return map[string]interface{}{}
+	case t.Implements(textMarshalerType) || pt.Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		inner := map[reflect.Type]bool{t: true}
+		for s := range seen {
+			inner[s] = true
+		}
+		props := make(map[string]interface{})
+		addFields(props, t, inner)
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	// interface{} and anything else may be any JSON value.
+	return map[string]interface{}{}
+}
+
+// addFields adds the JSON properties of struct type t to
+// props, following the field naming rules of encoding/json.
+func addFields(props map[string]interface{}, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			addFields(props, ft, seen)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = typeSchema(f.Type, seen)
+	}
+}
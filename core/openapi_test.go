@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"chain/encoding/json"
+	"chain/protocol/bc"
+)
+
+func TestOpenAPI(t *testing.T) {
+	a := &API{}
+	doc, err := a.openAPI(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := doc["paths"].(map[string]interface{})
+	for _, r := range a.clientRoutes() {
+		if _, ok := paths[r.path]; !ok {
+			t.Errorf("route %s is not documented", r.path)
+		}
+	}
+
+	op := paths["/update-asset-tags"].(map[string]interface{})["post"].(map[string]interface{})
+	body := op["requestBody"].(map[string]interface{})["content"].(map[string]interface{})
+	schema := body["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	items := schema["items"].(map[string]interface{})
+	props := items["properties"].(map[string]interface{})
+	for _, name := range []string{"ID", "Alias", "tags"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("update-asset-tags request is missing property %q: %v", name, props)
+		}
+	}
+}
+
+func TestTypeSchema(t *testing.T) {
+	type node struct {
+		Name     string        `json:"name"`
+		Skip     int           `json:"-"`
+		Children []*node       `json:"children"`
+		Data     json.HexBytes `json:"data"`
+		Asset    bc.AssetID    `json:"asset_id"`
+		TTL      json.Duration `json:"ttl"`
+		hidden   bool
+	}
+
+	got := typeSchema(reflect.TypeOf(node{}), nil)
+	want := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"children": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "object"},
+			},
+			"data":     map[string]interface{}{"type": "string"},
+			"asset_id": map[string]interface{}{"type": "string"},
+			"ttl":      map[string]interface{}{"type": "integer", "description": "Milliseconds, or a duration string such as 5s."},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("typeSchema = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"chain/core/account"
+	"chain/core/payreq"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+type paymentRequestRequest struct {
+	AccountID    string                 `json:"account_id"`
+	AccountAlias string                 `json:"account_alias"`
+	AssetID      string                 `json:"asset_id"`
+	AssetAlias   string                 `json:"asset_alias"`
+	Amount       uint64                 `json:"amount"`
+	PayerHints   map[string]interface{} `json:"payer_hints"`
+	CallbackURL  string                 `json:"callback_url"`
+	ExpiresAt    time.Time              `json:"expires_at"`
+}
+
+type paymentRequestQuery struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+	Status       string `json:"status"`
+	After        string `json:"after"`
+	PageSize     int    `json:"page_size"`
+}
+
+// paymentRequestPage is the response to /list-payment-requests.
+type paymentRequestPage struct {
+	Items    []*payreq.PaymentRequest `json:"items"`
+	Next     paymentRequestQuery      `json:"next"`
+	LastPage bool                     `json:"last_page"`
+}
+
+// POST /create-payment-request
+//
+// Creates a request for an account to be paid an amount of an
+// asset. The response includes the control program the payer
+// should pay, from a new receiver that expires along with the
+// request. If a callback URL is given, events are POSTed to it
+// when the request is partially paid, paid, overpaid or
+// expires.
+func (a *API) createPaymentRequest(ctx context.Context, x paymentRequestRequest) (*payreq.PaymentRequest, error) {
+	if x.Amount == 0 {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "amount must be positive")
+	}
+	if x.CallbackURL != "" {
+		u, err := url.Parse(x.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.WithDetailf(httpjson.ErrBadRequest, "invalid callback_url %q", x.CallbackURL)
+		}
+	}
+	accountID, err := a.accountID(ctx, x.AccountID, x.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := a.expectedPayment(ctx, receiverRequest{
+		ExpectedAssetID:    x.AssetID,
+		ExpectedAssetAlias: x.AssetAlias,
+		ExpectedAmount:     x.Amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expected == nil {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "either asset_id or asset_alias is required")
+	}
+
+	receiver, err := a.accounts.CreateReceiverExpecting(ctx, accountID, "", x.ExpiresAt, expected)
+	if err != nil {
+		return nil, err
+	}
+	return a.paymentRequests.Create(ctx, accountID, receiver.ControlProgram, *expected.AssetId, x.Amount, x.PayerHints, x.CallbackURL, receiver.ExpiresAt)
+}
+
+// POST /get-payment-request
+func (a *API) getPaymentRequest(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*payreq.PaymentRequest, error) {
+	return a.paymentRequests.Find(ctx, x.ID)
+}
+
+// POST /list-payment-requests
+//
+// Lists payment requests, newest first, optionally only those
+// of one account or with one status.
+func (a *API) listPaymentRequests(ctx context.Context, in paymentRequestQuery) (*paymentRequestPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+
+	var accountID string
+	if in.AccountID != "" || in.AccountAlias != "" {
+		var err error
+		accountID, err = a.accountID(ctx, in.AccountID, in.AccountAlias)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	prs, err := a.paymentRequests.List(ctx, accountID, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if prs == nil {
+		prs = []*payreq.PaymentRequest{} // send [], not null
+	}
+
+	out := in
+	if len(prs) > 0 {
+		out.After = prs[len(prs)-1].ID
+	}
+	return &paymentRequestPage{
+		Items:    prs,
+		Next:     out,
+		LastPage: len(prs) < limit,
+	}, nil
+}
+
+// accountID returns id, or the ID of the account with the
+// given alias. Exactly one of id and alias must be given.
+func (a *API) accountID(ctx context.Context, id, alias string) (string, error) {
+	if (id == "") == (alias == "") {
+		return "", errors.Wrap(account.ErrBadIdentifier)
+	}
+	if id != "" {
+		return id, nil
+	}
+	acc, err := a.accounts.FindByAlias(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	return acc.ID, nil
+}
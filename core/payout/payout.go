@@ -0,0 +1,637 @@
+// Package payout keeps payout batches: lists of payments of
+// assets from one account to many destinations, for mass
+// disbursements.
+//
+// A batch is uploaded as a list of rows, each a destination
+// account or control program, an asset and an amount. Every
+// row is validated when the batch is created; a batch with
+// an invalid row can't be approved, only rejected and
+// uploaded again. A valid batch waits for approval. When the
+// batch was created with an access token, it must be
+// approved with a different one.
+//
+// An approved batch is executed in the background. Its rows
+// are paid in order, in transactions of up to MaxRowsPerTx
+// rows each, and each row records the transaction that paid
+// it or the error that stopped it. A row is marked as being
+// submitted before its transaction is built; one left that
+// way by an interrupted run becomes unknown, for an operator
+// to reconcile, rather than being paid again. The batch
+// completes when every row is paid, failed or unknown.
+package payout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Batch statuses. Completed and rejected are final.
+const (
+	StatusInvalid         = "invalid"
+	StatusPendingApproval = "pending_approval"
+	StatusApproved        = "approved"
+	StatusExecuting       = "executing"
+	StatusCompleted       = "completed"
+	StatusRejected        = "rejected"
+)
+
+// Row statuses.
+const (
+	RowInvalid    = "invalid"
+	RowPending    = "pending"
+	RowSubmitting = "submitting"
+	RowPaid       = "paid"
+	RowFailed     = "failed"
+	RowUnknown    = "unknown"
+)
+
+const (
+	// MaxRows is the largest number of rows in a batch.
+	MaxRows = 10000
+
+	// MaxRowsPerTx is the largest number of rows paid in
+	// one transaction.
+	MaxRowsPerTx = 100
+)
+
+var (
+	// ErrBadBatch is returned for a batch with no rows or too
+	// many, or a list filter with an unknown status.
+	ErrBadBatch = errors.New("invalid payout batch")
+
+	// ErrBadState is returned for an operation the batch's
+	// status doesn't allow, such as approving an invalid
+	// batch.
+	ErrBadState = errors.New("payout batch status does not allow this")
+
+	// ErrSelfApproval is returned when a batch is approved
+	// with the access token that created it.
+	ErrSelfApproval = errors.New("payout batch must be approved by another access token")
+)
+
+// Batch is a payout batch. CreatedBy and ApprovedBy are the
+// IDs of the access tokens that created and approved it, if
+// any.
+type Batch struct {
+	ID              string     `json:"id"`
+	SourceAccountID string     `json:"source_account_id"`
+	Status          string     `json:"status"`
+	RowCount        int        `json:"row_count"`
+	InvalidRows     int        `json:"invalid_rows"`
+	CreatedBy       string     `json:"created_by,omitempty"`
+	ApprovedBy      string     `json:"approved_by,omitempty"`
+	ReviewNote      string     `json:"review_note,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
+
+// Row is one payment in a batch, to DestinationAccountID or,
+// without one, to DestinationControlProgram. Position is its
+// row number in an uploaded file or else its place in the
+// list of rows, counting from 1, and Reference an optional
+// identifier for the payee's own records.
+type Row struct {
+	Position                  int                `json:"position"`
+	DestinationAccountID      string             `json:"destination_account_id,omitempty"`
+	DestinationControlProgram chainjson.HexBytes `json:"destination_control_program,omitempty"`
+	AssetID                   bc.AssetID         `json:"asset_id"`
+	Amount                    uint64             `json:"amount"`
+	Reference                 string             `json:"reference,omitempty"`
+	Status                    string             `json:"status"`
+	Error                     string             `json:"error,omitempty"`
+	TransactionID             *bc.Hash           `json:"transaction_id,omitempty"`
+}
+
+// Validate checks the row's fields, marking it invalid with
+// the reason if they're wrong, or else pending.
+func (r *Row) Validate() {
+	r.Status, r.Error = RowPending, ""
+	switch {
+	case r.Amount == 0 || r.Amount > math.MaxInt64:
+		r.Error = fmt.Sprintf("amount must be between 1 and %d", int64(math.MaxInt64))
+	case (r.DestinationAccountID == "") == (len(r.DestinationControlProgram) == 0):
+		r.Error = "exactly one of a destination account or control program is required"
+	case r.AssetID == (bc.AssetID{}):
+		r.Error = "an asset is required"
+	}
+	if r.Error != "" {
+		r.Status = RowInvalid
+	}
+}
+
+// Manager stores payout batches and their rows.
+type Manager struct {
+	db pg.DB
+}
+
+// NewManager returns a new Manager using the given database.
+func NewManager(db pg.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// Create saves a new batch paying rows from the given
+// account. Rows should already be validated; more may be
+// marked invalid, such as those whose destination is the
+// source account, those that duplicate an earlier row, or
+// those whose asset's total is too large. Rows paying the
+// same amount of an asset to the same destination are
+// duplicates unless their references differ. The batch is
+// invalid if any of its rows are, and otherwise waits for
+// approval. Rows without a position, such as those not
+// uploaded in a file, are numbered by their place in rows;
+// otherwise positions must increase.
+func (m *Manager) Create(ctx context.Context, sourceAccountID, createdBy string, rows []*Row) (*Batch, error) {
+	if sourceAccountID == "" {
+		return nil, errors.WithDetail(ErrBadBatch, "a source account is required")
+	}
+	if len(rows) == 0 || len(rows) > MaxRows {
+		return nil, errors.WithDetailf(ErrBadBatch, "a batch must have between 1 and %d rows", MaxRows)
+	}
+	type payment struct {
+		account, program, reference string
+		assetID                     bc.AssetID
+		amount                      uint64
+	}
+	var (
+		totals = make(map[bc.AssetID]uint64)
+		seen   = make(map[payment]int)
+		status = StatusPendingApproval
+	)
+	for i, r := range rows {
+		if r.Position == 0 {
+			r.Position = i + 1
+		}
+		if i > 0 && r.Position <= rows[i-1].Position {
+			return nil, errors.WithDetailf(ErrBadBatch, "row position %d follows %d", r.Position, rows[i-1].Position)
+		}
+		if r.Status == RowPending && r.DestinationAccountID == sourceAccountID {
+			r.Status, r.Error = RowInvalid, "the destination must not be the source account"
+		}
+		if r.Status == RowPending {
+			p := payment{r.DestinationAccountID, string(r.DestinationControlProgram), r.Reference, r.AssetID, r.Amount}
+			if first, ok := seen[p]; ok {
+				r.Status, r.Error = RowInvalid, fmt.Sprintf("duplicate of row %d", first)
+			} else {
+				seen[p] = r.Position
+			}
+		}
+		if r.Status == RowPending {
+			if totals[r.AssetID] > math.MaxInt64-r.Amount {
+				r.Status, r.Error = RowInvalid, "the batch's total of this asset is too large"
+			}
+			totals[r.AssetID] += r.Amount
+		}
+		if r.Status != RowPending {
+			status = StatusInvalid
+		}
+	}
+
+	var (
+		positions pq.Int64Array
+		accounts  pq.StringArray
+		programs  pq.ByteaArray
+		assets    pq.ByteaArray
+		amounts   pq.Int64Array
+		refs      pq.StringArray
+		statuses  pq.StringArray
+		msgs      pq.StringArray
+	)
+	for _, r := range rows {
+		positions = append(positions, int64(r.Position))
+		accounts = append(accounts, r.DestinationAccountID)
+		programs = append(programs, r.DestinationControlProgram)
+		assets = append(assets, r.AssetID.Bytes())
+		amount := int64(r.Amount)
+		if r.Amount > math.MaxInt64 {
+			amount = 0 // invalid, and too large to store
+		}
+		amounts = append(amounts, amount)
+		refs = append(refs, r.Reference)
+		statuses = append(statuses, r.Status)
+		msgs = append(msgs, r.Error)
+	}
+	const q = `
+		WITH batch AS (
+			INSERT INTO payout_batches (source_account_id, status, row_count, created_by)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			RETURNING id
+		), inserted AS (
+			INSERT INTO payout_rows (batch_id, position, destination_account_id, destination_control_program,
+				asset_id, amount, reference, status, error)
+			SELECT (SELECT id FROM batch), unnest($5::bigint[]), NULLIF(unnest($6::text[]), ''),
+				NULLIF(unnest($7::bytea[]), ''), unnest($8::bytea[]), unnest($9::bigint[]),
+				NULLIF(unnest($10::text[]), ''), unnest($11::text[]), NULLIF(unnest($12::text[]), '')
+		)
+		SELECT id FROM batch
+	`
+	var id string
+	err := m.db.QueryRowContext(ctx, q, sourceAccountID, status, len(rows), createdBy,
+		positions, accounts, programs, assets, amounts, refs, statuses, msgs).Scan(&id)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting payout batch")
+	}
+	return m.Find(ctx, id)
+}
+
+// Approve approves a batch waiting for approval, for it to
+// be executed. The approver is the ID of the access token
+// approving it, which must differ from the one that created
+// it.
+func (m *Manager) Approve(ctx context.Context, id, approvedBy, note string) (*Batch, error) {
+	b, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.CreatedBy != "" && b.CreatedBy == approvedBy {
+		return nil, errors.WithDetailf(ErrSelfApproval, "payout batch %s was created by access token %s", id, b.CreatedBy)
+	}
+	const q = `
+		UPDATE payout_batches
+		SET status = $2, approved_by = NULLIF($3, ''), review_note = NULLIF($4, ''), reviewed_at = now()
+		WHERE id = $1 AND status = $5
+	`
+	return m.review(ctx, id, "only a batch pending approval can be approved",
+		q, id, StatusApproved, approvedBy, note, StatusPendingApproval)
+}
+
+// Reject rejects a batch that is invalid or waiting for
+// approval. A reason is required.
+func (m *Manager) Reject(ctx context.Context, id, reason string) (*Batch, error) {
+	if reason == "" {
+		return nil, errors.WithDetail(ErrBadBatch, "a reason is required to reject a payout batch")
+	}
+	const q = `
+		UPDATE payout_batches SET status = $2, review_note = $3, reviewed_at = now()
+		WHERE id = $1 AND status IN ($4, $5)
+	`
+	return m.review(ctx, id, "only an invalid batch or one pending approval can be rejected",
+		q, id, StatusRejected, reason, StatusInvalid, StatusPendingApproval)
+}
+
+func (m *Manager) review(ctx context.Context, id, why, q string, args ...interface{}) (*Batch, error) {
+	res, err := m.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "reviewing payout batch")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	b, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrBadState, "payout batch %s is %s; %s", id, b.Status, why)
+	}
+	return b, nil
+}
+
+const selectQ = `
+	SELECT b.id, b.source_account_id, b.status, b.row_count,
+		(SELECT count(*) FROM payout_rows r WHERE r.batch_id = b.id AND r.status = 'invalid'),
+		COALESCE(b.created_by, ''), COALESCE(b.approved_by, ''), COALESCE(b.review_note, ''),
+		b.created_at, b.reviewed_at, b.completed_at
+	FROM payout_batches b
+`
+
+// Find returns the batch with the given ID.
+func (m *Manager) Find(ctx context.Context, id string) (*Batch, error) {
+	list, err := m.query(ctx, selectQ+`WHERE b.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "payout batch %s not found", id)
+	}
+	return list[0], nil
+}
+
+// List returns up to limit batches, oldest first, optionally
+// only those with the given status. Batches with IDs less
+// than or equal to after are skipped; pass the ID of the last
+// batch returned to get the next page, or "" to get the
+// first.
+func (m *Manager) List(ctx context.Context, status, after string, limit int) ([]*Batch, error) {
+	switch status {
+	case "", StatusInvalid, StatusPendingApproval, StatusApproved, StatusExecuting, StatusCompleted, StatusRejected:
+	default:
+		return nil, errors.WithDetailf(ErrBadBatch, "unknown status %q", status)
+	}
+	return m.query(ctx, selectQ+`
+		WHERE ($1 = '' OR b.status = $1) AND ($2 = '' OR b.id > $2)
+		ORDER BY b.id
+		LIMIT $3
+	`, status, after, limit)
+}
+
+// Executable returns the batches that are approved or being
+// executed, oldest first.
+func (m *Manager) Executable(ctx context.Context) ([]*Batch, error) {
+	return m.query(ctx, selectQ+`WHERE b.status IN ($1, $2) ORDER BY b.id`, StatusApproved, StatusExecuting)
+}
+
+func (m *Manager) query(ctx context.Context, q string, args ...interface{}) ([]*Batch, error) {
+	var list []*Batch
+	err := pg.ForQueryRows(ctx, m.db, q, append(args, func(
+		id, sourceAccountID, status string, rowCount, invalid int, createdBy, approvedBy, note string,
+		createdAt time.Time, reviewedAt, completedAt *time.Time,
+	) {
+		list = append(list, &Batch{
+			ID:              id,
+			SourceAccountID: sourceAccountID,
+			Status:          status,
+			RowCount:        rowCount,
+			InvalidRows:     invalid,
+			CreatedBy:       createdBy,
+			ApprovedBy:      approvedBy,
+			ReviewNote:      note,
+			CreatedAt:       createdAt,
+			ReviewedAt:      reviewedAt,
+			CompletedAt:     completedAt,
+		})
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying payout batches")
+	}
+	return list, nil
+}
+
+const rowSelectQ = `
+	SELECT position, COALESCE(destination_account_id, ''), destination_control_program, asset_id,
+		amount, COALESCE(reference, ''), status, COALESCE(error, ''), tx_hash
+	FROM payout_rows
+`
+
+// Rows returns up to limit of the batch's rows in order,
+// optionally only those with the given status, starting
+// after the given position. Pass 0 to start with the first
+// row.
+func (m *Manager) Rows(ctx context.Context, batchID, status string, after, limit int) ([]*Row, error) {
+	switch status {
+	case "", RowInvalid, RowPending, RowSubmitting, RowPaid, RowFailed, RowUnknown:
+	default:
+		return nil, errors.WithDetailf(ErrBadBatch, "unknown row status %q", status)
+	}
+	return m.rows(ctx, rowSelectQ+`
+		WHERE batch_id = $1 AND ($2 = '' OR status = $2) AND position > $3
+		ORDER BY position
+		LIMIT $4
+	`, batchID, status, after, limit)
+}
+
+// Errors returns the batch's rows that have an error, in
+// order: those that are invalid, failed, or whose outcome is
+// unknown.
+func (m *Manager) Errors(ctx context.Context, batchID string) ([]*Row, error) {
+	return m.rows(ctx, rowSelectQ+`
+		WHERE batch_id = $1 AND error IS NOT NULL
+		ORDER BY position
+	`, batchID)
+}
+
+func (m *Manager) rows(ctx context.Context, q string, args ...interface{}) ([]*Row, error) {
+	var list []*Row
+	err := pg.ForQueryRows(ctx, m.db, q, append(args, func(
+		position int, accountID string, prog []byte, assetID bc.AssetID, amount int64,
+		ref, status, msg string, txHash []byte,
+	) error {
+		r := &Row{
+			Position:                  position,
+			DestinationAccountID:      accountID,
+			DestinationControlProgram: prog,
+			AssetID:                   assetID,
+			Amount:                    uint64(amount),
+			Reference:                 ref,
+			Status:                    status,
+			Error:                     msg,
+		}
+		if txHash != nil {
+			r.TransactionID = new(bc.Hash)
+			err := r.TransactionID.Scan(txHash)
+			if err != nil {
+				return err
+			}
+		}
+		list = append(list, r)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying payout rows")
+	}
+	return list, nil
+}
+
+// Start marks an approved batch as executing. Rows left
+// being submitted by an interrupted run become unknown.
+func (m *Manager) Start(ctx context.Context, id string) error {
+	const q = `
+		WITH batch AS (
+			UPDATE payout_batches SET status = $2 WHERE id = $1 AND status IN ($3, $2)
+			RETURNING id
+		)
+		UPDATE payout_rows SET status = $4, error = 'interrupted while submitting', updated_at = now()
+		WHERE batch_id IN (SELECT id FROM batch) AND status = $5
+	`
+	_, err := m.db.ExecContext(ctx, q, id, StatusExecuting, StatusApproved, RowUnknown, RowSubmitting)
+	return errors.Wrap(err, "starting payout batch")
+}
+
+// Claim marks up to MaxRowsPerTx of an executing batch's
+// pending rows, in order, as being submitted, and returns
+// them. It returns none once every row has been submitted.
+func (m *Manager) Claim(ctx context.Context, batchID string) ([]*Row, error) {
+	const q = `
+		UPDATE payout_rows SET status = $2, updated_at = now()
+		WHERE batch_id = $1 AND position IN (
+			SELECT position FROM payout_rows
+			WHERE batch_id = $1 AND status = $3
+			ORDER BY position
+			LIMIT $4
+		)
+		RETURNING position, COALESCE(destination_account_id, ''), destination_control_program, asset_id,
+			amount, COALESCE(reference, ''), status, COALESCE(error, ''), tx_hash
+	`
+	rows, err := m.rows(ctx, q, batchID, RowSubmitting, RowPending, MaxRowsPerTx)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING doesn't keep the subquery's order.
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Position < rows[j].Position })
+	return rows, nil
+}
+
+// Finish records the outcome of submitting claimed rows:
+// the transaction that paid them, or the error that stopped
+// it.
+func (m *Manager) Finish(ctx context.Context, batchID string, rows []*Row, txID *bc.Hash, failure error) error {
+	status, msg := RowPaid, ""
+	if failure != nil {
+		status, msg = RowFailed, failure.Error()
+	}
+	var (
+		positions pq.Int64Array
+		txHash    []byte
+	)
+	for _, r := range rows {
+		positions = append(positions, int64(r.Position))
+		r.Status, r.Error, r.TransactionID = status, msg, txID
+	}
+	if txID != nil {
+		txHash = txID.Bytes()
+	}
+	const q = `
+		UPDATE payout_rows SET status = $3, error = NULLIF($4, ''), tx_hash = $5, updated_at = now()
+		WHERE batch_id = $1 AND position = ANY($2::bigint[])
+	`
+	_, err := m.db.ExecContext(ctx, q, batchID, positions, status, msg, txHash)
+	return errors.Wrap(err, "recording payout outcome")
+}
+
+// Complete marks an executing batch completed, once none of
+// its rows are pending or being submitted.
+func (m *Manager) Complete(ctx context.Context, id string) error {
+	const q = `
+		UPDATE payout_batches SET status = $2, completed_at = now()
+		WHERE id = $1 AND status = $3 AND NOT EXISTS (
+			SELECT 1 FROM payout_rows WHERE batch_id = $1 AND status IN ($4, $5)
+		)
+	`
+	_, err := m.db.ExecContext(ctx, q, id, StatusCompleted, StatusExecuting, RowPending, RowSubmitting)
+	return errors.Wrap(err, "completing payout batch")
+}
+
+// Totals counts rows and sums their amounts.
+type Totals struct {
+	Count  int    `json:"count"`
+	Amount uint64 `json:"amount"`
+}
+
+func (t *Totals) add(count int, amount uint64) {
+	t.Count += count
+	t.Amount += amount
+}
+
+// AssetTotals are the totals of a batch's rows of one asset,
+// by outcome. Outstanding rows are pending or being
+// submitted.
+type AssetTotals struct {
+	AssetID     bc.AssetID `json:"asset_id"`
+	Requested   Totals     `json:"requested"`
+	Paid        Totals     `json:"paid"`
+	Failed      Totals     `json:"failed"`
+	Unknown     Totals     `json:"unknown"`
+	Invalid     Totals     `json:"invalid"`
+	Outstanding Totals     `json:"outstanding"`
+}
+
+// TxTotals are the rows paid by one transaction.
+type TxTotals struct {
+	TransactionID bc.Hash `json:"transaction_id"`
+	Rows          int     `json:"rows"`
+	FirstPosition int     `json:"first_position"`
+	LastPosition  int     `json:"last_position"`
+}
+
+// Report reconciles a batch: what it asked to pay, and what
+// was paid, by asset, and the transactions that paid it.
+// Reconciled is true once the batch is complete and every
+// row was paid.
+type Report struct {
+	Batch        *Batch         `json:"batch"`
+	Assets       []*AssetTotals `json:"assets"`
+	Transactions []*TxTotals    `json:"transactions"`
+	Reconciled   bool           `json:"reconciled"`
+}
+
+// Report returns the reconciliation report of the batch with
+// the given ID.
+func (m *Manager) Report(ctx context.Context, id string) (*Report, error) {
+	b, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{Batch: b, Assets: []*AssetTotals{}, Transactions: []*TxTotals{}}
+
+	const assetsQ = `
+		SELECT asset_id, status, count(*), sum(amount)
+		FROM payout_rows WHERE batch_id = $1
+		GROUP BY asset_id, status
+		ORDER BY asset_id, status
+	`
+	byAsset := make(map[bc.AssetID]*AssetTotals)
+	err = pg.ForQueryRows(ctx, m.db, assetsQ, id, func(assetID bc.AssetID, status string, count int, amount int64) {
+		t := byAsset[assetID]
+		if t == nil {
+			t = &AssetTotals{AssetID: assetID}
+			byAsset[assetID] = t
+			rep.Assets = append(rep.Assets, t)
+		}
+		t.Requested.add(count, uint64(amount))
+		switch status {
+		case RowPaid:
+			t.Paid.add(count, uint64(amount))
+		case RowFailed:
+			t.Failed.add(count, uint64(amount))
+		case RowUnknown:
+			t.Unknown.add(count, uint64(amount))
+		case RowInvalid:
+			t.Invalid.add(count, uint64(amount))
+		default:
+			t.Outstanding.add(count, uint64(amount))
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "totaling payout rows")
+	}
+
+	const txsQ = `
+		SELECT tx_hash, count(*), min(position), max(position)
+		FROM payout_rows WHERE batch_id = $1 AND tx_hash IS NOT NULL
+		GROUP BY tx_hash
+		ORDER BY min(position)
+	`
+	err = pg.ForQueryRows(ctx, m.db, txsQ, id, func(txID bc.Hash, count, first, last int) {
+		rep.Transactions = append(rep.Transactions, &TxTotals{
+			TransactionID: txID,
+			Rows:          count,
+			FirstPosition: first,
+			LastPosition:  last,
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "totaling payout transactions")
+	}
+
+	rep.Reconciled = b.Status == StatusCompleted
+	for _, t := range rep.Assets {
+		if t.Paid.Count != t.Requested.Count {
+			rep.Reconciled = false
+		}
+	}
+	return rep, nil
+}
+
+// RefData returns the reference data recorded in the output
+// paying a row.
+func RefData(batchID string, r *Row) map[string]interface{} {
+	p := map[string]interface{}{
+		"batch_id": batchID,
+		"position": r.Position,
+	}
+	if r.Reference != "" {
+		p["reference"] = r.Reference
+	}
+	return map[string]interface{}{"payout": p}
+}
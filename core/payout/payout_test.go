@@ -0,0 +1,54 @@
+package payout
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestValidate(t *testing.T) {
+	asset := bc.NewAssetID([32]byte{1})
+	cases := []struct {
+		row  Row
+		want string
+	}{
+		{Row{DestinationAccountID: "acc2", AssetID: asset, Amount: 10}, RowPending},
+		{Row{DestinationControlProgram: []byte{0x51}, AssetID: asset, Amount: 10}, RowPending},
+		{Row{DestinationAccountID: "acc2", AssetID: asset}, RowInvalid},
+		{Row{DestinationAccountID: "acc2", AssetID: asset, Amount: math.MaxInt64 + 1}, RowInvalid},
+		{Row{AssetID: asset, Amount: 10}, RowInvalid},
+		{Row{DestinationAccountID: "acc2", DestinationControlProgram: []byte{0x51}, AssetID: asset, Amount: 10}, RowInvalid},
+		{Row{DestinationAccountID: "acc2", Amount: 10}, RowInvalid},
+	}
+	for i, c := range cases {
+		c.row.Validate()
+		if c.row.Status != c.want {
+			t.Errorf("case %d: status = %s (%q), want %s", i, c.row.Status, c.row.Error, c.want)
+		}
+		if (c.row.Error == "") != (c.want == RowPending) {
+			t.Errorf("case %d: error = %q with status %s", i, c.row.Error, c.row.Status)
+		}
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	row := &Row{DestinationAccountID: "acc2", AssetID: bc.NewAssetID([32]byte{1}), Amount: 10}
+	cases := []struct {
+		source string
+		rows   []*Row
+	}{
+		{"", []*Row{row}},
+		{"acc1", nil},
+		{"acc1", make([]*Row, MaxRows+1)},
+	}
+	m := new(Manager)
+	for i, c := range cases {
+		_, err := m.Create(context.Background(), c.source, "", c.rows)
+		if errors.Root(err) != ErrBadBatch {
+			t.Errorf("case %d: Create = %v, want %v", i, err, ErrBadBatch)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package payout
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Input is one payment as uploaded, before its account and
+// asset aliases are resolved. Error is set when a field of an
+// uploaded file couldn't be parsed, and the row is invalid.
+// Line is the payment's row number in an uploaded file,
+// counting the header, or 0 if it wasn't uploaded.
+type Input struct {
+	DestinationAccountID      string             `json:"destination_account_id"`
+	DestinationAccountAlias   string             `json:"destination_account_alias"`
+	DestinationControlProgram chainjson.HexBytes `json:"destination_control_program"`
+	AssetID                   *bc.AssetID        `json:"asset_id"`
+	AssetAlias                string             `json:"asset_alias"`
+	Amount                    uint64             `json:"amount"`
+	Reference                 string             `json:"reference"`
+	Error                     string             `json:"-"`
+	Line                      int                `json:"-"`
+}
+
+// Columns are the columns an uploaded file may have, named
+// in its first row in any order. Amount is required, as are
+// one of the asset columns and one of the destination
+// columns.
+var Columns = []string{
+	"destination_account_id",
+	"destination_account_alias",
+	"destination_control_program",
+	"asset_id",
+	"asset_alias",
+	"amount",
+	"reference",
+}
+
+const (
+	// maxXLSXPart bounds the uncompressed size of the parts of
+	// a workbook that ParseXLSX reads.
+	maxXLSXPart = 64 << 20
+
+	// maxXLSXRow and maxXLSXColumn are the last row and column
+	// (XFD) of an Excel worksheet.
+	maxXLSXRow    = 1 << 20
+	maxXLSXColumn = 1 << 14
+
+	// maxXLSXCells bounds the number of cells ParseXLSX lays
+	// out, counting the blanks before each row's last cell
+	// and the empty rows between those it reads.
+	maxXLSXCells = 1 << 20
+)
+
+// ParseCSV reads payments from a CSV file with a header row
+// naming its columns. An error is returned if the header is
+// wrong or the file can't be read; a row whose fields are
+// wrong is returned with its Error set.
+func ParseCSV(r io.Reader) ([]*Input, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // checked row by row
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadBatch, err.Error())
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		// Spreadsheets often begin the CSV files they save
+		// with a byte order mark.
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+	return parseRecords(records)
+}
+
+// ParseXLSX reads payments from the first worksheet of an
+// Excel workbook, as ParseCSV does from a CSV file.
+func ParseXLSX(r io.ReaderAt, size int64) ([]*Input, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadBatch, "the file is not an Excel workbook")
+	}
+	records, err := readXLSX(zr)
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadBatch, err.Error())
+	}
+	return parseRecords(records)
+}
+
+// parseRecords parses records, the rows of a file in order,
+// whose first that isn't blank is the header. Blank records
+// are skipped.
+func parseRecords(records [][]string) ([]*Input, error) {
+	first := 0
+	for first < len(records) && blank(records[first]) {
+		first++
+	}
+	if first == len(records) {
+		return nil, errors.WithDetail(ErrBadBatch, "the file is empty")
+	}
+	header := records[first]
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		header[i] = name
+		if name == "" {
+			continue // spreadsheets pad rows to their widest
+		}
+		if !validColumn(name) {
+			return nil, errors.WithDetailf(ErrBadBatch, "unknown column %q; columns must be among %s", name, strings.Join(Columns, ", "))
+		}
+		if seen[name] {
+			return nil, errors.WithDetailf(ErrBadBatch, "column %q appears twice", name)
+		}
+		seen[name] = true
+	}
+	switch {
+	case !seen["amount"]:
+		return nil, errors.WithDetail(ErrBadBatch, "an amount column is required")
+	case !seen["asset_id"] && !seen["asset_alias"]:
+		return nil, errors.WithDetail(ErrBadBatch, "an asset_id or asset_alias column is required")
+	case !seen["destination_account_id"] && !seen["destination_account_alias"] && !seen["destination_control_program"]:
+		return nil, errors.WithDetail(ErrBadBatch, "a destination_account_id, destination_account_alias or destination_control_program column is required")
+	}
+
+	var inputs []*Input
+	for i := first + 1; i < len(records); i++ {
+		rec := records[i]
+		if blank(rec) {
+			continue
+		}
+		if len(inputs) == MaxRows {
+			return nil, errors.WithDetailf(ErrBadBatch, "a batch must have between 1 and %d rows", MaxRows)
+		}
+		in := &Input{Line: i + 1}
+		inputs = append(inputs, in)
+		for i, v := range rec {
+			var name string
+			if i < len(header) {
+				name = header[i]
+			}
+			in.set(name, strings.TrimSpace(v))
+			if in.Error != "" {
+				break
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// set sets the named field of in from v, or in.Error if v is
+// malformed.
+func (in *Input) set(name, v string) {
+	if v == "" {
+		return
+	}
+	var err error
+	switch name {
+	case "":
+		in.Error = fmt.Sprintf("%q is in a column with no name", v)
+	case "destination_account_id":
+		in.DestinationAccountID = v
+	case "destination_account_alias":
+		in.DestinationAccountAlias = v
+	case "destination_control_program":
+		in.DestinationControlProgram, err = hex.DecodeString(v)
+	case "asset_id":
+		in.AssetID = new(bc.AssetID)
+		err = in.AssetID.UnmarshalText([]byte(v))
+	case "asset_alias":
+		in.AssetAlias = v
+	case "amount":
+		in.Amount, err = strconv.ParseUint(v, 10, 64)
+	case "reference":
+		in.Reference = v
+	}
+	if err != nil {
+		in.Error = fmt.Sprintf("bad %s %q", name, v)
+	}
+}
+
+func validColumn(name string) bool {
+	for _, c := range Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func blank(rec []string) bool {
+	for _, v := range rec {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteErrorCSV writes rows to w as CSV, with the columns of
+// an upload and the error of each, for fixing and uploading
+// again. Row is the row's position in the batch, which for
+// an uploaded batch is its row number in the file.
+func WriteErrorCSV(w io.Writer, rows []*Row) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"row", "destination_account_id", "destination_control_program", "asset_id", "amount", "reference", "status", "error"})
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		var program string
+		if len(r.DestinationControlProgram) > 0 {
+			program = hex.EncodeToString(r.DestinationControlProgram)
+		}
+		var assetID string
+		if r.AssetID != (bc.AssetID{}) {
+			assetID = r.AssetID.String()
+		}
+		err = cw.Write([]string{
+			strconv.Itoa(r.Position),
+			r.DestinationAccountID,
+			program,
+			assetID,
+			strconv.FormatUint(r.Amount, 10),
+			r.Reference,
+			r.Status,
+			r.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// The parts of a workbook readXLSX needs. See ECMA-376,
+// Part 1, section 18.
+type (
+	xlsxWorkbook struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xlsxRels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	xlsxText struct {
+		T string `xml:"t"`
+		R []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	xlsxStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	xlsxSheet struct {
+		Rows []struct {
+			Num   int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+)
+
+func (t xlsxText) String() string {
+	s := t.T
+	for _, r := range t.R {
+		s += r.T
+	}
+	return s
+}
+
+// readXLSX returns the cell values of the first worksheet of
+// a workbook, a record per row, so that the record at index i
+// is row i+1 even when the rows between are left out. Cells
+// are returned as they're stored, so a numeric cell must hold
+// an integer for it to parse as an amount.
+func readXLSX(zr *zip.Reader) ([][]string, error) {
+	var wb xlsxWorkbook
+	err := readXLSXPart(zr, "xl/workbook.xml", &wb, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, errors.New("the workbook has no worksheets")
+	}
+	var rels xlsxRels
+	err = readXLSXPart(zr, "xl/_rels/workbook.xml.rels", &rels, true)
+	if err != nil {
+		return nil, err
+	}
+	var sheetPath string
+	for _, rel := range rels.Rels {
+		if rel.ID == wb.Sheets[0].RID {
+			sheetPath = rel.Target
+			if strings.HasPrefix(sheetPath, "/") {
+				sheetPath = sheetPath[1:]
+			} else {
+				sheetPath = path.Join("xl", sheetPath)
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, errors.New("the workbook's first worksheet is missing")
+	}
+
+	var strs xlsxStrings
+	err = readXLSXPart(zr, "xl/sharedStrings.xml", &strs, false) // workbooks without text have none
+	if err != nil {
+		return nil, err
+	}
+	var sheet xlsxSheet
+	err = readXLSXPart(zr, sheetPath, &sheet, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		records [][]string
+		cells   int
+	)
+	for _, row := range sheet.Rows {
+		num := row.Num
+		if num == 0 {
+			num = len(records) + 1 // the row after the last
+		}
+		if num <= len(records) || num > maxXLSXRow {
+			return nil, fmt.Errorf("bad row number %d", num)
+		}
+		for len(records) < num-1 {
+			records = append(records, nil)
+			cells++
+		}
+		if cells > maxXLSXCells {
+			return nil, fmt.Errorf("the worksheet has more than %d cells", maxXLSXCells)
+		}
+
+		var rec []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = xlsxColumn(c.Ref)
+			}
+			if col < 0 {
+				return nil, fmt.Errorf("bad cell reference %q", c.Ref)
+			}
+			if cells+col >= maxXLSXCells {
+				return nil, fmt.Errorf("the worksheet has more than %d cells", maxXLSXCells)
+			}
+			v := c.Value
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(strs.Items) {
+					return nil, fmt.Errorf("cell %s refers to a missing string", c.Ref)
+				}
+				v = strs.Items[n].String()
+			case "inlineStr":
+				v = c.Inline.String()
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+			rec[col] = v
+		}
+		records = append(records, rec)
+		cells += len(rec) + 1
+	}
+	return records, nil
+}
+
+// readXLSXPart decodes the named part of a workbook into v.
+// It's an error for a required part to be missing.
+func readXLSXPart(zr *zip.Reader, name string, v interface{}, required bool) error {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("reading %s: %s", name, err)
+		}
+		defer rc.Close()
+		err = xml.NewDecoder(io.LimitReader(rc, maxXLSXPart)).Decode(v)
+		if err != nil {
+			return fmt.Errorf("reading %s: %s", name, err)
+		}
+		return nil
+	}
+	if required {
+		return fmt.Errorf("the workbook has no %s", name)
+	}
+	return nil
+}
+
+// xlsxColumn returns the 0-based column of a cell reference
+// such as "C7", or -1 if it has no column letters or its
+// column is past XFD.
+func xlsxColumn(ref string) int {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > maxXLSXColumn {
+			return -1
+		}
+	}
+	return col - 1
+}
@@ -0,0 +1,192 @@
+package payout
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestParseCSV(t *testing.T) {
+	assetID := bc.NewAssetID([32]byte{1})
+	const header = "\ufeffDestination_Account_Alias, asset_id ,amount,reference,\n"
+	got, err := ParseCSV(strings.NewReader(header +
+		"alice," + assetID.String() + ",100,inv-1,\n" +
+		",,,,\n" +
+		"bob," + assetID.String() + ",1.5,,\n" +
+		"carol,beef,10,,\n" +
+		"dave," + assetID.String() + ",10,,note\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Input{
+		{DestinationAccountAlias: "alice", AssetID: &assetID, Amount: 100, Reference: "inv-1", Line: 2},
+		{DestinationAccountAlias: "bob", AssetID: &assetID, Error: `bad amount "1.5"`, Line: 4},
+		{DestinationAccountAlias: "carol", AssetID: new(bc.AssetID), Error: `bad asset_id "beef"`, Line: 5},
+		{DestinationAccountAlias: "dave", AssetID: &assetID, Amount: 10, Error: `"note" is in a column with no name`, Line: 6},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		got[i].AssetID, want[i].AssetID = nil, nil // compared by the errors
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("row %d = %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestParseCSVBadHeader(t *testing.T) {
+	cases := []string{
+		"",
+		"\n\n",
+		"destination_account_id,asset_id\n",
+		"destination_account_id,amount\n",
+		"asset_id,amount\n",
+		"destination_account_id,asset_id,amount,memo\n",
+		"destination_account_id,asset_id,amount,amount\n",
+		"destination_account_id,\"asset_id,amount\n",
+	}
+	for _, c := range cases {
+		_, err := ParseCSV(strings.NewReader(c))
+		if errors.Root(err) != ErrBadBatch {
+			t.Errorf("ParseCSV(%q) = %v, want %v", c, err, ErrBadBatch)
+		}
+	}
+}
+
+func TestParseCSVTooManyRows(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("destination_account_id,asset_alias,amount\n")
+	for i := 0; i <= MaxRows; i++ {
+		buf.WriteString("acc2,gold,1\n")
+	}
+	_, err := ParseCSV(&buf)
+	if errors.Root(err) != ErrBadBatch {
+		t.Errorf("ParseCSV = %v, want %v", err, ErrBadBatch)
+	}
+}
+
+// workbook returns an Excel workbook whose first worksheet
+// holds sheetData, with the shared strings in strs.
+func workbook(t *testing.T, strs []string, sheetData string) []byte {
+	var si bytes.Buffer
+	for _, str := range strs {
+		si.WriteString(str)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Payouts" sheetId="1" r:id="rId3"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/payouts.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+` + si.String() + `
+</sst>`,
+		"xl/worksheets/payouts.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetData>
+` + sheetData + `
+</sheetData>
+</worksheet>`,
+	}
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseXLSX(t *testing.T) {
+	b := workbook(t, []string{
+		`<si><t>destination_account_alias</t></si>`,
+		`<si><t>asset_alias</t></si>`,
+		`<si><t>amount</t></si>`,
+		`<si><r><t>ali</t></r><r><t>ce</t></r></si>`,
+		`<si><t>gold</t></si>`,
+	}, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>
+<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2" t="s"><v>4</v></c><c r="C2"><v>250</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t>bob</t></is></c><c r="C4"><v>7</v></c></row>
+<row><c t="inlineStr"><is><t>carol</t></is></c><c/><c><v>x</v></c></row>`)
+
+	got, err := ParseXLSX(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Input{
+		{DestinationAccountAlias: "alice", AssetAlias: "gold", Amount: 250, Line: 2},
+		{DestinationAccountAlias: "bob", Amount: 7, Line: 4},
+		{DestinationAccountAlias: "carol", Error: `bad amount "x"`, Line: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseXLSX = %+v, want %+v", got, want)
+	}
+
+	_, err = ParseXLSX(strings.NewReader("a,b,c"), 5)
+	if errors.Root(err) != ErrBadBatch {
+		t.Errorf("ParseXLSX(not a workbook) = %v, want %v", err, ErrBadBatch)
+	}
+}
+
+func TestParseXLSXLimits(t *testing.T) {
+	const header = `<row r="1"><c r="A1" t="inlineStr"><is><t>destination_account_id</t></is></c>` +
+		`<c r="B1" t="inlineStr"><is><t>asset_alias</t></is></c><c r="C1" t="inlineStr"><is><t>amount</t></is></c></row>`
+	cases := []string{
+		// past column XFD
+		header + `<row r="2"><c r="XFE2"><v>1</v></c></row>`,
+		// past the last row
+		header + `<row r="1048577"><c r="A1048577"><v>1</v></c></row>`,
+		// out of order
+		header + `<row r="3"><c r="A3"><v>1</v></c></row><row r="2"><c r="A2"><v>1</v></c></row>`,
+		// too many cells
+		header + strings.Repeat(`<row><c r="XFD1"><v>1</v></c></row>`, maxXLSXCells/maxXLSXColumn+1),
+	}
+	for i, c := range cases {
+		b := workbook(t, nil, c)
+		_, err := ParseXLSX(bytes.NewReader(b), int64(len(b)))
+		if errors.Root(err) != ErrBadBatch {
+			t.Errorf("case %d: ParseXLSX = %v, want %v", i, err, ErrBadBatch)
+		}
+	}
+
+	if got := xlsxColumn("XFD1"); got != maxXLSXColumn-1 {
+		t.Errorf("xlsxColumn(XFD1) = %d, want %d", got, maxXLSXColumn-1)
+	}
+}
+
+func TestWriteErrorCSV(t *testing.T) {
+	assetID := bc.NewAssetID([32]byte{1})
+	rows := []*Row{
+		{Position: 2, DestinationAccountID: "acc2", Amount: 0, Status: RowInvalid, Error: "amount must be positive"},
+		{Position: 5, DestinationControlProgram: []byte{0x51}, AssetID: assetID, Amount: 3, Reference: "x,y", Status: RowFailed, Error: "insufficient funds"},
+	}
+	var buf bytes.Buffer
+	err := WriteErrorCSV(&buf, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "row,destination_account_id,destination_control_program,asset_id,amount,reference,status,error\n" +
+		"2,acc2,,,0,,invalid,amount must be positive\n" +
+		"5,,51," + assetID.String() + ",3,\"x,y\",failed,insufficient funds\n"
+	if buf.String() != want {
+		t.Errorf("WriteErrorCSV =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
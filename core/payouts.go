@@ -0,0 +1,481 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"chain/core/job"
+	"chain/core/payout"
+	"chain/core/signers"
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/authn"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+// maxPayoutUploadMemory is how much of an uploaded file is
+// held in memory; the rest is stored in a temporary file.
+const maxPayoutUploadMemory = 1 << 20
+
+type payoutBatchRequest struct {
+	SourceAccountID    string          `json:"source_account_id"`
+	SourceAccountAlias string          `json:"source_account_alias"`
+	Rows               []*payout.Input `json:"rows"`
+}
+
+// POST /create-payout-batch
+//
+// Uploads a batch of payments from one account. Every row is
+// validated, and rows with unknown accounts or assets, or
+// other errors, are marked invalid with the reason. A batch
+// with no invalid rows waits for approval with
+// /approve-payout-batch; one with invalid rows can only be
+// rejected. Payments are signed with the mock HSM. To upload
+// a spreadsheet, use /upload-payout-batch.
+func (a *API) createPayoutBatch(ctx context.Context, x payoutBatchRequest) (*payout.Batch, error) {
+	if a.signTemplate == nil {
+		return nil, errors.WithDetail(errNoMockHSM, "payouts are signed with keys held by the mock HSM")
+	}
+	sourceID, err := a.accountID(ctx, x.SourceAccountID, x.SourceAccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	_, err = signers.Find(ctx, a.db, "account", sourceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "source account %s", sourceID)
+	}
+	rows, err := a.payoutRows(ctx, x.Rows)
+	if err != nil {
+		return nil, err
+	}
+	return a.payouts.Create(ctx, sourceID, authn.Token(ctx), rows)
+}
+
+// payoutRows resolves the accounts and assets of uploaded
+// payments and validates them. A payment whose account or
+// asset isn't found is marked invalid, rather than failing
+// the whole batch.
+func (a *API) payoutRows(ctx context.Context, inputs []*payout.Input) ([]*payout.Row, error) {
+	// Batches often pay many rows to the same asset, so each
+	// account and asset is looked up once.
+	var (
+		accountIDs = make(map[string]string) // ID or alias to ID, "" if not found
+		assetIDs   = make(map[string]*bc.AssetID)
+	)
+	lookupAccount := func(id, alias string) (string, error) {
+		key := "id:" + id
+		if alias != "" {
+			key = "alias:" + alias
+		}
+		found, ok := accountIDs[key]
+		if !ok {
+			if alias != "" {
+				acc, err := a.accounts.FindByAlias(ctx, alias)
+				if err == nil {
+					found = acc.ID
+				} else if errors.Root(err) != pg.ErrUserInputNotFound {
+					return "", err
+				}
+			} else {
+				_, err := signers.Find(ctx, a.db, "account", id)
+				if err == nil {
+					found = id
+				} else if errors.Root(err) != pg.ErrUserInputNotFound && errors.Root(err) != signers.ErrBadType {
+					return "", err
+				}
+			}
+			accountIDs[key] = found
+		}
+		return found, nil
+	}
+	lookupAsset := func(alias string) (*bc.AssetID, error) {
+		found, ok := assetIDs[alias]
+		if !ok {
+			ast, err := a.assets.FindByAlias(ctx, alias)
+			if err == nil {
+				found = &ast.AssetID
+			} else if errors.Root(err) != pg.ErrUserInputNotFound {
+				return nil, err
+			}
+			assetIDs[alias] = found
+		}
+		return found, nil
+	}
+
+	rows := make([]*payout.Row, 0, len(inputs))
+	for _, in := range inputs {
+		r := &payout.Row{
+			Position:                  in.Line,
+			DestinationControlProgram: in.DestinationControlProgram,
+			Amount:                    in.Amount,
+			Reference:                 in.Reference,
+		}
+		rows = append(rows, r)
+		if in.Error != "" {
+			r.Status, r.Error = payout.RowInvalid, in.Error
+			continue
+		}
+		switch {
+		case in.AssetAlias != "" && in.AssetID != nil:
+			r.Status, r.Error = payout.RowInvalid, "asset_id and asset_alias can't both be set"
+			continue
+		case in.AssetAlias != "":
+			id, err := lookupAsset(in.AssetAlias)
+			if err != nil {
+				return nil, err
+			}
+			if id == nil {
+				r.Status, r.Error = payout.RowInvalid, fmt.Sprintf("asset alias %q not found", in.AssetAlias)
+				continue
+			}
+			r.AssetID = *id
+		case in.AssetID != nil:
+			r.AssetID = *in.AssetID
+		}
+		if in.DestinationAccountID != "" || in.DestinationAccountAlias != "" {
+			if in.DestinationAccountID != "" && in.DestinationAccountAlias != "" {
+				r.Status, r.Error = payout.RowInvalid, "destination_account_id and destination_account_alias can't both be set"
+				continue
+			}
+			id, err := lookupAccount(in.DestinationAccountID, in.DestinationAccountAlias)
+			if err != nil {
+				return nil, err
+			}
+			if id == "" {
+				r.Status, r.Error = payout.RowInvalid, "destination account not found"
+				continue
+			}
+			r.DestinationAccountID = id
+		}
+		r.Validate()
+	}
+	return rows, nil
+}
+
+// POST /upload-payout-batch
+//
+// Creates a payout batch, as /create-payout-batch does, from
+// a spreadsheet uploaded as multipart/form-data. The form's
+// file field holds a CSV file or an Excel workbook, with a
+// header row naming its columns; source_account_id or
+// source_account_alias name the account paying. Invalid rows
+// can be downloaded with /render-payout-batch-errors.
+func (a *API) uploadPayoutBatch(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if a.config == nil {
+		alwaysError(errUnconfigured).ServeHTTP(rw, req)
+		return
+	}
+	err := req.ParseMultipartForm(maxPayoutUploadMemory)
+	if err != nil {
+		errorFormatter.Write(ctx, rw, errors.WithDetail(httpjson.ErrBadRequest, "a multipart/form-data body is required"))
+		return
+	}
+	defer req.MultipartForm.RemoveAll()
+	f, fh, err := req.FormFile("file")
+	if err != nil {
+		errorFormatter.Write(ctx, rw, errors.WithDetail(httpjson.ErrBadRequest, "a file is required"))
+		return
+	}
+	defer f.Close()
+
+	var inputs []*payout.Input
+	if strings.HasSuffix(strings.ToLower(fh.Filename), ".xlsx") {
+		inputs, err = payout.ParseXLSX(f, fh.Size)
+	} else {
+		inputs, err = payout.ParseCSV(f)
+	}
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	b, err := a.createPayoutBatch(ctx, payoutBatchRequest{
+		SourceAccountID:    req.FormValue("source_account_id"),
+		SourceAccountAlias: req.FormValue("source_account_alias"),
+		Rows:               inputs,
+	})
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	httpjson.Write(ctx, rw, http.StatusOK, b)
+}
+
+// POST /render-payout-batch-errors
+//
+// Writes the rows of a batch that have an error, invalid,
+// failed or unknown, as a CSV file with the reason for each,
+// rather than as a JSON response.
+func (a *API) renderPayoutBatchErrors(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if a.config == nil {
+		alwaysError(errUnconfigured).ServeHTTP(rw, req)
+		return
+	}
+
+	var x struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&x)
+	if err != nil {
+		errorFormatter.Write(ctx, rw, httpjson.ErrBadRequest)
+		return
+	}
+	_, err = a.payouts.Find(ctx, x.ID)
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	rows, err := a.payouts.Errors(ctx, x.ID)
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	var buf bytes.Buffer
+	err = payout.WriteErrorCSV(&buf, rows)
+	if err != nil {
+		errorFormatter.Write(ctx, rw, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/csv")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-errors.csv"`, x.ID))
+	buf.WriteTo(rw)
+}
+
+// POST /approve-payout-batch
+//
+// Approves a batch waiting for approval, for it to be paid
+// in the background. When the batch was created with an
+// access token, it must be approved with a different one.
+func (a *API) approvePayoutBatch(ctx context.Context, x struct {
+	ID   string `json:"id"`
+	Note string `json:"note"`
+}) (*payout.Batch, error) {
+	return a.payouts.Approve(ctx, x.ID, authn.Token(ctx), x.Note)
+}
+
+// POST /reject-payout-batch
+//
+// Rejects an invalid batch, or one waiting for approval. A
+// reason is required.
+func (a *API) rejectPayoutBatch(ctx context.Context, x struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}) (*payout.Batch, error) {
+	return a.payouts.Reject(ctx, x.ID, x.Reason)
+}
+
+// POST /get-payout-batch
+func (a *API) getPayoutBatch(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*payout.Batch, error) {
+	return a.payouts.Find(ctx, x.ID)
+}
+
+// POST /get-payout-batch-report
+//
+// Returns a batch's reconciliation report: the totals asked
+// for, paid, failed and unknown for each asset, and the
+// transactions that paid them.
+func (a *API) getPayoutBatchReport(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*payout.Report, error) {
+	return a.payouts.Report(ctx, x.ID)
+}
+
+// payoutBatchPage is the response to /list-payout-batches.
+type payoutBatchPage struct {
+	Items    []*payout.Batch  `json:"items"`
+	Next     payoutBatchQuery `json:"next"`
+	LastPage bool             `json:"last_page"`
+}
+
+type payoutBatchQuery struct {
+	Status   string `json:"status"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-payout-batches
+//
+// Lists payout batches, oldest first, optionally only those
+// with the given status.
+func (a *API) listPayoutBatches(ctx context.Context, in payoutBatchQuery) (*payoutBatchPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.payouts.List(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*payout.Batch{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &payoutBatchPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// payoutRowPage is the response to /list-payout-rows.
+type payoutRowPage struct {
+	Items    []*payout.Row  `json:"items"`
+	Next     payoutRowQuery `json:"next"`
+	LastPage bool           `json:"last_page"`
+}
+
+type payoutRowQuery struct {
+	BatchID  string `json:"batch_id"`
+	Status   string `json:"status"`
+	After    int    `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-payout-rows
+//
+// Lists a batch's rows in order, with the status of each,
+// optionally only those with the given status.
+func (a *API) listPayoutRows(ctx context.Context, in payoutRowQuery) (*payoutRowPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	_, err := a.payouts.Find(ctx, in.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := a.payouts.Rows(ctx, in.BatchID, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*payout.Row{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].Position
+	}
+	return &payoutRowPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// runPayouts pays the rows of every approved batch. It runs
+// as a recurring job, once per runPayoutsPeriod. A failed
+// transaction fails its rows, and doesn't stop the rest of
+// the batch.
+func (a *API) runPayouts(ctx context.Context, _ *job.Job) error {
+	batches, err := a.payouts.Executable(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range batches {
+		err = a.executePayoutBatch(ctx, b)
+		if err != nil {
+			log.Error(ctx, err, fmt.Sprintf("executing payout batch %s", b.ID))
+		}
+	}
+	return nil
+}
+
+// executePayoutBatch pays the batch's pending rows, in
+// transactions of up to payout.MaxRowsPerTx rows each, and
+// completes it.
+func (a *API) executePayoutBatch(ctx context.Context, b *payout.Batch) error {
+	err := a.payouts.Start(ctx, b.ID)
+	if err != nil {
+		return err
+	}
+	for {
+		rows, err := a.payouts.Claim(ctx, b.ID)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		txID, payErr := a.submitPayouts(ctx, b, rows)
+		err = a.payouts.Finish(ctx, b.ID, rows, txID, payErr)
+		if err != nil {
+			return err
+		}
+	}
+	return a.payouts.Complete(ctx, b.ID)
+}
+
+// submitPayouts submits a transaction paying rows from the
+// batch's source account, and waits until it has been
+// processed. Each output records its row in its reference
+// data, and the transaction records the batch.
+func (a *API) submitPayouts(ctx context.Context, b *payout.Batch, rows []*payout.Row) (*bc.Hash, error) {
+	var (
+		spends   []map[string]interface{}
+		controls []map[string]interface{}
+		totals   = make(map[bc.AssetID]map[string]interface{})
+	)
+	for _, r := range rows {
+		assetID := r.AssetID.String()
+		spend := totals[r.AssetID]
+		if spend == nil {
+			spend = map[string]interface{}{
+				"type":       "spend_account",
+				"account_id": b.SourceAccountID,
+				"asset_id":   assetID,
+				"amount":     uint64(0),
+			}
+			totals[r.AssetID] = spend
+			spends = append(spends, spend)
+		}
+		spend["amount"] = spend["amount"].(uint64) + r.Amount
+
+		control := map[string]interface{}{
+			"type":           "control_account",
+			"account_id":     r.DestinationAccountID,
+			"asset_id":       assetID,
+			"amount":         r.Amount,
+			"reference_data": payout.RefData(b.ID, r),
+		}
+		if r.DestinationAccountID == "" {
+			delete(control, "account_id")
+			control["type"] = "control_program"
+			control["control_program"] = r.DestinationControlProgram
+		}
+		controls = append(controls, control)
+	}
+	actions := append(spends, controls...)
+	actions = append(actions, map[string]interface{}{
+		"type":           "set_transaction_reference_data",
+		"reference_data": map[string]interface{}{"payout_batch": map[string]interface{}{"id": b.ID}},
+	})
+
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: actions})
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing payouts")
+	}
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.Transaction.ID, nil
+}
@@ -0,0 +1,152 @@
+package payreq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// Event types. An event is recorded each time a payment
+// request with a callback URL changes in one of these ways.
+const (
+	// EventPartialPayment is recorded when a pending request
+	// receives a payment that leaves it short of its amount.
+	EventPartialPayment = "payment_request.partial_payment"
+
+	// EventPaid is recorded when a request receives exactly
+	// its amount.
+	EventPaid = "payment_request.paid"
+
+	// EventOverpayment is recorded when a request receives
+	// more than its amount.
+	EventOverpayment = "payment_request.overpayment"
+
+	// EventExpired is recorded when a request expires,
+	// whether or not it received a partial payment.
+	EventExpired = "payment_request.expired"
+)
+
+const (
+	maxDeliveryAttempts = 20
+	maxRetryDelay       = time.Hour
+	deliveryBatchSize   = 100
+)
+
+// Event is the body POSTed to a payment request's callback
+// URL. PaymentRequest is the request's state at the time of
+// delivery, which may be newer than the event.
+type Event struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	ReceivedAmount uint64          `json:"received_amount"`
+	CreatedAt      time.Time       `json:"created_at"`
+	PaymentRequest *PaymentRequest `json:"payment_request"`
+}
+
+// DeliverEvents periodically POSTs undelivered events to
+// their payment requests' callback URLs using client. A
+// delivery succeeds if the callback responds with a 2xx
+// status. Failed deliveries are retried with exponential
+// backoff, up to maxDeliveryAttempts times.
+// It blocks until the context is canceled.
+func (t *Tracker) DeliverEvents(ctx context.Context, client *http.Client, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, DeliverEvents exiting")
+			return
+		case <-ticks:
+			err := t.deliverEvents(ctx, client)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+func (t *Tracker) deliverEvents(ctx context.Context, client *http.Client) error {
+	const q = `
+		SELECT e.id, e.type, e.received_amount, e.created_at, e.payment_request_id, pr.callback_url
+		FROM payment_request_events e
+		JOIN payment_requests pr ON pr.id = e.payment_request_id
+		WHERE e.delivered_at IS NULL AND e.next_attempt_at <= now() AND e.attempts < $1
+		ORDER BY e.id
+		LIMIT $2
+	`
+	type pending struct {
+		event Event
+		prID  string
+		url   string
+	}
+	var events []*pending
+	err := pg.ForQueryRows(ctx, t.db, q, maxDeliveryAttempts, deliveryBatchSize, func(id, typ string, received int64, createdAt time.Time, prID, url string) {
+		events = append(events, &pending{
+			event: Event{ID: id, Type: typ, ReceivedAmount: uint64(received), CreatedAt: createdAt},
+			prID:  prID,
+			url:   url,
+		})
+	})
+	if err != nil {
+		return errors.Wrap(err, "loading undelivered events")
+	}
+
+	for _, p := range events {
+		p.event.PaymentRequest, err = t.Find(ctx, p.prID)
+		if err != nil {
+			return err
+		}
+		deliveryErr := post(ctx, client, p.url, &p.event)
+		if deliveryErr != nil {
+			log.Error(ctx, errors.Wrapf(deliveryErr, "delivering event %s", p.event.ID))
+		}
+		err = t.recordAttempt(ctx, p.event.ID, deliveryErr == nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func post(ctx context.Context, client *http.Client, url string, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("callback responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordAttempt records an attempt to deliver the event with
+// the given ID. If it failed, the next attempt is scheduled
+// after a delay that doubles with each attempt.
+func (t *Tracker) recordAttempt(ctx context.Context, id string, delivered bool) error {
+	const q = `
+		UPDATE payment_request_events SET
+			attempts = attempts + 1,
+			delivered_at = CASE WHEN $2 THEN now() END,
+			next_attempt_at = now() + least(interval '1 second' * power(2, attempts), $3 * interval '1 second')
+		WHERE id = $1
+	`
+	_, err := t.db.ExecContext(ctx, q, id, delivered, maxRetryDelay.Seconds())
+	return errors.Wrap(err, "recording delivery attempt")
+}
@@ -0,0 +1,39 @@
+package payreq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPost(t *testing.T) {
+	var got Event
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		err := json.NewDecoder(req.Body).Decode(&got)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	ctx := context.Background()
+	event := &Event{ID: "pre1", Type: EventOverpayment, ReceivedAmount: 12}
+	err := post(ctx, http.DefaultClient, ok.URL, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != event.ID || got.Type != event.Type || got.ReceivedAmount != event.ReceivedAmount {
+		t.Errorf("callback got %+v, want %+v", got, event)
+	}
+
+	err = post(ctx, http.DefaultClient, failing.URL, event)
+	if err == nil {
+		t.Error("post to failing callback succeeded, want error")
+	}
+}
@@ -0,0 +1,258 @@
+// Package payreq implements payment requests: requests for
+// an account to be paid an amount of an asset by a deadline.
+//
+// Each payment request is paid to its own account receiver.
+// As blocks arrive, the tracker totals the confirmed payments
+// to each request's receiver and moves the request through
+// its statuses. Changes to requests with callback URLs are
+// recorded as events and delivered to those URLs.
+package payreq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"chain/core/account"
+	"chain/core/pin"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+// PinName is used to identify the pin associated with
+// the payment request block processor.
+const PinName = "payment_requests"
+
+// Payment request statuses.
+//
+// A request is pending until the full amount has been paid
+// to it. It is then paid, or overpaid if it received more
+// than was requested. A pending request becomes expired once
+// a block later than its expiry is processed. Expired and
+// overpaid are final.
+const (
+	StatusPending  = "pending"
+	StatusPaid     = "paid"
+	StatusExpired  = "expired"
+	StatusOverpaid = "overpaid"
+)
+
+// ErrBadStatus is returned by List for an unknown status.
+var ErrBadStatus = errors.New("status must be pending, paid, expired or overpaid")
+
+// PaymentRequest is a request for an account to be paid.
+type PaymentRequest struct {
+	ID             string                 `json:"id"`
+	AccountID      string                 `json:"account_id"`
+	ControlProgram chainjson.HexBytes     `json:"control_program"`
+	AssetID        bc.AssetID             `json:"asset_id"`
+	Amount         uint64                 `json:"amount"`
+	ReceivedAmount uint64                 `json:"received_amount"`
+	PayerHints     map[string]interface{} `json:"payer_hints"`
+	CallbackURL    string                 `json:"callback_url,omitempty"`
+	Status         string                 `json:"status"`
+
+	// Discrepancy is ReceivedAmount minus Amount: negative
+	// while the request is short of its amount, and positive
+	// if it was overpaid.
+	Discrepancy int64 `json:"discrepancy"`
+
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tracker stores payment requests and keeps their
+// statuses up to date.
+type Tracker struct {
+	db       pg.DB
+	chain    *protocol.Chain
+	pinStore *pin.Store
+}
+
+// NewTracker returns a new Tracker using the given
+// database, blockchain and block processor pins.
+func NewTracker(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Tracker {
+	return &Tracker{db: db, chain: chain, pinStore: pinStore}
+}
+
+// Create records a pending request for amount of assetID to
+// be paid to the account receiver with control program prog
+// by expiresAt. If callbackURL is non-empty, events about the
+// request are POSTed to it; see DeliverEvents.
+func (t *Tracker) Create(ctx context.Context, accountID string, prog []byte, assetID bc.AssetID, amount uint64, payerHints map[string]interface{}, callbackURL string, expiresAt time.Time) (*PaymentRequest, error) {
+	if payerHints == nil {
+		payerHints = map[string]interface{}{}
+	}
+	hints, err := json.Marshal(payerHints)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling payer hints")
+	}
+
+	const q = `
+		INSERT INTO payment_requests (account_id, control_program, asset_id, amount, payer_hints, callback_url, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, created_at, updated_at
+	`
+	pr := &PaymentRequest{
+		AccountID:      accountID,
+		ControlProgram: prog,
+		AssetID:        assetID,
+		Amount:         amount,
+		PayerHints:     payerHints,
+		CallbackURL:    callbackURL,
+		ExpiresAt:      expiresAt,
+		Discrepancy:    -int64(amount),
+	}
+	callback := sql.NullString{String: callbackURL, Valid: callbackURL != ""}
+	err = t.db.QueryRowContext(ctx, q, accountID, prog, assetID, int64(amount), hints, callback, expiresAt).
+		Scan(&pr.ID, &pr.Status, &pr.CreatedAt, &pr.UpdatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting payment request")
+	}
+	return pr, nil
+}
+
+const selectQ = `
+	SELECT id, account_id, control_program, asset_id, amount, received_amount,
+		payer_hints, COALESCE(callback_url, ''), status, expires_at, created_at, updated_at
+	FROM payment_requests
+`
+
+// Find returns the payment request with the given ID.
+func (t *Tracker) Find(ctx context.Context, id string) (*PaymentRequest, error) {
+	prs, err := t.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(prs) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "payment request %s not found", id)
+	}
+	return prs[0], nil
+}
+
+// List returns up to limit payment requests, newest first.
+// If accountID or status is non-empty, only requests with
+// that account or status are returned. Requests with IDs
+// greater than or equal to after are skipped; pass the ID of
+// the last request returned to get the next page, or "" to
+// get the first.
+func (t *Tracker) List(ctx context.Context, accountID, status, after string, limit int) ([]*PaymentRequest, error) {
+	switch status {
+	case "", StatusPending, StatusPaid, StatusExpired, StatusOverpaid:
+	default:
+		return nil, errors.WithDetailf(ErrBadStatus, "unknown status %q", status)
+	}
+	const where = `
+		WHERE ($1 = '' OR account_id = $1) AND ($2 = '' OR status = $2) AND ($3 = '' OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4
+	`
+	return t.query(ctx, selectQ+where, accountID, status, after, limit)
+}
+
+func (t *Tracker) query(ctx context.Context, q string, args ...interface{}) ([]*PaymentRequest, error) {
+	var prs []*PaymentRequest
+	err := pg.ForQueryRows(ctx, t.db, q, append(args, func(
+		id, accountID string, prog []byte, assetID bc.AssetID, amount, received int64,
+		hints []byte, callbackURL, status string, expiresAt, createdAt, updatedAt time.Time,
+	) error {
+		pr := &PaymentRequest{
+			ID:             id,
+			AccountID:      accountID,
+			ControlProgram: prog,
+			AssetID:        assetID,
+			Amount:         uint64(amount),
+			ReceivedAmount: uint64(received),
+			CallbackURL:    callbackURL,
+			Status:         status,
+			Discrepancy:    received - amount,
+			ExpiresAt:      expiresAt,
+			CreatedAt:      createdAt,
+			UpdatedAt:      updatedAt,
+		}
+		err := json.Unmarshal(hints, &pr.PayerHints)
+		if err != nil {
+			return errors.Wrap(err, "unmarshaling payer hints")
+		}
+		prs = append(prs, pr)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying payment requests")
+	}
+	return prs, nil
+}
+
+// ProcessBlocks updates the payment requests affected by each
+// block once the account indexer has recorded its payments.
+// It blocks until the context is canceled.
+func (t *Tracker) ProcessBlocks(ctx context.Context) {
+	if t.pinStore == nil {
+		return
+	}
+	t.pinStore.ProcessBlocks(ctx, t.chain, PinName, func(ctx context.Context, b *legacy.Block) error {
+		<-t.pinStore.PinWaiter(account.PinName, b.Height)
+		return t.update(ctx, b)
+	})
+}
+
+// update recomputes the status of every open payment request
+// that was paid in b or has expired as of b, and records an
+// event for each change to a request with a callback URL.
+// Since it totals all payments recorded so far rather than
+// adding the ones in b, processing a block more than once is
+// harmless.
+func (t *Tracker) update(ctx context.Context, b *legacy.Block) error {
+	const q = `
+		WITH totals AS (
+			SELECT pr.id, COALESCE(sum(p.amount), 0) AS received
+			FROM payment_requests pr
+			LEFT JOIN account_receiver_payments p
+				ON p.control_program = pr.control_program AND p.asset_id = pr.asset_id
+			WHERE (pr.status = 'pending' AND pr.expires_at < $2)
+				OR (pr.status IN ('pending', 'paid') AND pr.control_program IN (
+					SELECT control_program FROM account_receiver_payments WHERE block_height = $1
+				))
+			GROUP BY pr.id
+		), statuses AS (
+			SELECT pr.id, pr.received_amount AS old_received, pr.status AS old_status,
+				totals.received, CASE
+					WHEN totals.received > pr.amount THEN 'overpaid'
+					WHEN totals.received = pr.amount THEN 'paid'
+					WHEN pr.expires_at < $2 THEN 'expired'
+					ELSE 'pending'
+				END AS status
+			FROM payment_requests pr JOIN totals ON pr.id = totals.id
+		), updated AS (
+			UPDATE payment_requests pr SET
+				received_amount = statuses.received,
+				status = statuses.status,
+				updated_at = now()
+			FROM statuses
+			WHERE pr.id = statuses.id
+				AND (statuses.old_received, statuses.old_status) IS DISTINCT FROM (statuses.received, statuses.status)
+			RETURNING pr.id, pr.callback_url, statuses.old_received, statuses.old_status,
+				statuses.received, statuses.status
+		), events AS (
+			SELECT id, received, CASE
+				WHEN status = 'overpaid' AND old_status <> 'overpaid' THEN $3
+				WHEN status = 'paid' AND old_status <> 'paid' THEN $4
+				WHEN status = 'expired' THEN $5
+				WHEN status = 'pending' AND received > old_received THEN $6
+			END AS type
+			FROM updated
+			WHERE callback_url IS NOT NULL
+		)
+		INSERT INTO payment_request_events (payment_request_id, type, received_amount)
+		SELECT id, type, received FROM events WHERE type IS NOT NULL
+	`
+	_, err := t.db.ExecContext(ctx, q, b.Height, b.Time(),
+		EventOverpayment, EventPaid, EventExpired, EventPartialPayment)
+	return errors.Wrap(err, "updating payment requests")
+}
@@ -0,0 +1,97 @@
+package payreq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/testutil"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	tr := NewTracker(db, nil, nil)
+	assetID := bc.AssetID{V0: 1}
+	now := time.Now()
+
+	create := func(prog []byte, expiresAt time.Time) *PaymentRequest {
+		pr, err := tr.Create(ctx, "acc1", prog, assetID, 10, map[string]interface{}{"name": "bob"}, "https://example.com/cb", expiresAt)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return pr
+	}
+	paid := create([]byte{1}, now.Add(time.Hour))
+	overpaid := create([]byte{2}, now.Add(time.Hour))
+	partial := create([]byte{3}, now.Add(time.Hour))
+	expired := create([]byte{4}, now.Add(-time.Hour))
+
+	pay := func(outputID uint64, prog []byte, amount int64) {
+		const q = `
+			INSERT INTO account_receiver_payments (output_id, control_program, asset_id, amount, block_height)
+			VALUES ($1, $2, $3, $4, 1)
+		`
+		_, err := db.ExecContext(ctx, q, bc.Hash{V0: outputID}, prog, assetID, amount)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	pay(1, paid.ControlProgram, 10)
+	pay(2, overpaid.ControlProgram, 6)
+	pay(3, overpaid.ControlProgram, 6)
+	pay(4, partial.ControlProgram, 4)
+
+	b := &legacy.Block{BlockHeader: legacy.BlockHeader{Height: 1, TimestampMS: bc.Millis(now)}}
+	for i := 0; i < 2; i++ { // processing a block twice must be harmless
+		err := tr.update(ctx, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	cases := []struct {
+		id          string
+		status      string
+		received    uint64
+		discrepancy int64
+		event       string
+	}{
+		{paid.ID, StatusPaid, 10, 0, EventPaid},
+		{overpaid.ID, StatusOverpaid, 12, 2, EventOverpayment},
+		{partial.ID, StatusPending, 4, -6, EventPartialPayment},
+		{expired.ID, StatusExpired, 0, -10, EventExpired},
+	}
+	for _, c := range cases {
+		got, err := tr.Find(ctx, c.id)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if got.Status != c.status || got.ReceivedAmount != c.received || got.Discrepancy != c.discrepancy {
+			t.Errorf("request %s: status %s received %d discrepancy %d, want %s received %d discrepancy %d",
+				c.id, got.Status, got.ReceivedAmount, got.Discrepancy, c.status, c.received, c.discrepancy)
+		}
+
+		var events []string
+		const q = `SELECT type FROM payment_request_events WHERE payment_request_id = $1`
+		err = pg.ForQueryRows(ctx, db, q, c.id, func(typ string) { events = append(events, typ) })
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(events) != 1 || events[0] != c.event {
+			t.Errorf("request %s: events %v, want [%s]", c.id, events, c.event)
+		}
+	}
+
+	prs, err := tr.List(ctx, "acc1", StatusPending, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(prs) != 1 || prs[0].ID != partial.ID {
+		t.Errorf("List(pending) = %+v, want only %s", prs, partial.ID)
+	}
+}
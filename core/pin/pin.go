@@ -211,7 +211,12 @@ func (p *pin) processBlock(ctx context.Context, c *protocol.Chain, height uint64
 			log.Error(ctx, err)
 			continue
 		}
-		err = cb(ctx, block)
+		// Blocks are processed concurrently, so their writes
+		// can deadlock with one another. Back off and retry
+		// those before treating the callback as failed.
+		err = pg.Retry(ctx, func(ctx context.Context) error {
+			return cb(ctx, block)
+		})
 		if err != nil {
 			log.Error(ctx, errors.Wrapf(err, "pin %q callback", p.name))
 			continue
@@ -4,6 +4,7 @@ import (
 	"context"
 	"math"
 
+	"chain/core/asset"
 	"chain/core/query"
 	"chain/core/query/filter"
 	"chain/errors"
@@ -41,7 +42,7 @@ func (a *API) listAccounts(ctx context.Context, in requestQuery) (page, error) {
 // an index or an ad-hoc filter.
 //
 // POST /list-assets
-func (a *API) listAssets(ctx context.Context, in requestQuery) (page, error) {
+func (a *API) listAssets(ctx context.Context, in requestQuery) (*assetPage, error) {
 	limit := in.PageSize
 	if limit == 0 {
 		limit = defGenericPageSize
@@ -51,13 +52,16 @@ func (a *API) listAssets(ctx context.Context, in requestQuery) (page, error) {
 	// Use the query engine for querying asset tags.
 	assets, after, err := a.indexer.Assets(ctx, in.Filter, in.FilterParams, after, limit)
 	if err != nil {
-		return page{}, errors.Wrap(err, "running asset query")
+		return nil, errors.Wrap(err, "running asset query")
+	}
+	for _, aa := range assets {
+		asset.AnnotatePrecision(aa)
 	}
 
 	out := in
 	out.After = after
-	return page{
-		Items:    httpjson.Array(assets),
+	return &assetPage{
+		Items:    assets,
 		LastPage: len(assets) < limit,
 		Next:     out,
 	}, nil
@@ -100,6 +104,68 @@ func (a *API) listBalances(ctx context.Context, in requestQuery) (result page, e
 	return result, nil
 }
 
+// indexedUntil returns the last block of a range of blocks
+// to list: until, if it's set and has been indexed in the
+// database list queries read from, or else the last block
+// indexed there.
+func (a *API) indexedUntil(ctx context.Context, until uint64) (uint64, error) {
+	indexed, err := a.indexer.IndexedHeight(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if until == 0 || until > indexed {
+		until = indexed
+	}
+	return until, nil
+}
+
+// listBalanceDeltas is an http handler for listing the net change
+// in each account's balance of each asset over a range of blocks.
+// If no until_block is provided, or it hasn't been indexed yet, the
+// range ends at the most recently indexed block; the resolved height
+// is returned in `next` so that every page covers the same range.
+//
+// POST /list-balance-deltas
+func (a *API) listBalanceDeltas(ctx context.Context, in requestQuery) (result page, err error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+
+	until, err := a.indexedUntil(ctx, in.UntilBlock)
+	if err != nil {
+		return result, err
+	}
+	if until > math.MaxInt64 {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "until_block is too large")
+	}
+	if in.SinceBlock > until {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "since_block cannot be after until_block")
+	}
+
+	var after *query.BalanceDeltasAfter
+	if in.After != "" {
+		after, err = query.DecodeBalanceDeltasAfter(in.After)
+		if err != nil {
+			return result, errors.Wrap(err, "decoding `after`")
+		}
+	}
+
+	deltas, nextAfter, err := a.indexer.BalanceDeltas(ctx, in.SinceBlock, until, after, limit)
+	if err != nil {
+		return result, errors.Wrap(err, "querying balance deltas")
+	}
+
+	out := in
+	out.UntilBlock = until
+	out.After = nextAfter.String()
+	return page{
+		Items:    httpjson.Array(deltas),
+		LastPage: len(deltas) < limit,
+		Next:     out,
+	}, nil
+}
+
 // listTransactions is an http handler for listing transactions matching
 // an index or an ad-hoc filter.
 //
@@ -124,6 +190,10 @@ func (a *API) listTransactions(ctx context.Context, in requestQuery) (result pag
 		return result, errors.WithDetail(httpjson.ErrBadRequest, "end timestamp is too large")
 	}
 
+	if in.Until != "" {
+		return a.listTransactionsBetween(ctx, in, limit)
+	}
+
 	// Either parse the provided `after` or look one up for the time range.
 	var after query.TxAfter
 	if in.After != "" {
@@ -152,6 +222,43 @@ func (a *API) listTransactions(ctx context.Context, in requestQuery) (result pag
 	}, nil
 }
 
+// listTransactionsBetween lists the transactions between the `after`
+// and `until` cursors of in. An empty `after` starts at the
+// beginning of the blockchain.
+func (a *API) listTransactionsBetween(ctx context.Context, in requestQuery, limit int) (result page, err error) {
+	if in.AscLongPoll {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "until cannot be used with ascending_with_long_poll")
+	}
+	if in.StartTimeMS != 0 || in.EndTimeMS != 0 {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "until cannot be used with a time range")
+	}
+
+	until, err := query.DecodeTxAfter(in.Until)
+	if err != nil {
+		return result, errors.Wrap(err, "decoding `until`")
+	}
+	var after query.TxAfter
+	if in.After != "" {
+		after, err = query.DecodeTxAfter(in.After)
+		if err != nil {
+			return result, errors.Wrap(err, "decoding `after`")
+		}
+	}
+
+	txns, nextAfter, err := a.indexer.TransactionsBetween(ctx, in.Filter, in.FilterParams, after, until, limit)
+	if err != nil {
+		return result, errors.Wrap(err, "running tx query")
+	}
+
+	out := in
+	out.After = nextAfter.String()
+	return page{
+		Items:    httpjson.Array(txns),
+		LastPage: len(txns) < limit,
+		Next:     out,
+	}, nil
+}
+
 // listTxFeeds is an http handler for listing txfeeds. It does not take a filter.
 //
 // POST /list-transaction-feeds
@@ -28,6 +28,14 @@ func (ind *Indexer) SaveAnnotatedAccount(ctx context.Context, account *Annotated
 	return errors.Wrap(err, "saving annotated account")
 }
 
+// SaveAccountArchived records whether an account is archived
+// in the query indexes.
+func (ind *Indexer) SaveAccountArchived(ctx context.Context, accountID string, archived bool) error {
+	const q = `UPDATE annotated_accounts SET archived = $2 WHERE id = $1`
+	_, err := ind.db.ExecContext(ctx, q, accountID, archived)
+	return errors.Wrap(err, "saving account archived")
+}
+
 // Accounts queries the blockchain for accounts matching the query `q`.
 func (ind *Indexer) Accounts(ctx context.Context, filt string, vals []interface{}, after string, limit int) ([]*AnnotatedAccount, string, error) {
 	p, err := filter.Parse(filt, accountsTable, vals)
@@ -43,9 +51,11 @@ func (ind *Indexer) Accounts(ctx context.Context, filt string, vals []interface{
 	}
 
 	queryStr, queryArgs := constructAccountsQuery(expr, vals, after, limit)
-	rows, err := ind.db.QueryContext(ctx, queryStr, queryArgs...)
+	ctx, cancel := queryContext(ctx, "list-accounts")
+	defer cancel()
+	rows, err := ind.reader(ctx).QueryContext(ctx, queryStr, queryArgs...)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "executing acc query")
+		return nil, "", queryErr(ctx, errors.Wrap(err, "executing acc query"))
 	}
 	defer rows.Close()
 
@@ -60,6 +70,7 @@ func (ind *Indexer) Accounts(ctx context.Context, filt string, vals []interface{
 			&keysJSON,
 			&aa.Quorum,
 			&aa.Tags,
+			&aa.IsArchived,
 		)
 		if err != nil {
 			return nil, "", errors.Wrap(err, "scanning account row")
@@ -72,14 +83,14 @@ func (ind *Indexer) Accounts(ctx context.Context, filt string, vals []interface{
 		after = aa.ID
 		accounts = append(accounts, aa)
 	}
-	return accounts, after, errors.Wrap(rows.Err())
+	return accounts, after, queryErr(ctx, errors.Wrap(rows.Err()))
 }
 
 func constructAccountsQuery(expr string, vals []interface{}, after string, limit int) (string, []interface{}) {
 	var buf bytes.Buffer
 
 	buf.WriteString("SELECT ")
-	buf.WriteString("id, alias, keys, quorum, tags")
+	buf.WriteString("id, alias, keys, quorum, tags, archived")
 	buf.WriteString(" FROM annotated_accounts AS acc")
 	buf.WriteString(" WHERE ")
 
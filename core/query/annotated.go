@@ -63,14 +63,23 @@ type AnnotatedOutput struct {
 	ControlProgram  chainjson.HexBytes `json:"control_program"`
 	ReferenceData   *json.RawMessage   `json:"reference_data"`
 	IsLocal         Bool               `json:"is_local"`
+
+	// UnlockTime is set for an output whose control program
+	// is time-locked, and UnlockHeight for an account output
+	// this core won't spend before the given block height.
+	// IsLocked is set in listings of unspent outputs.
+	UnlockTime   *time.Time `json:"unlock_time,omitempty"`
+	UnlockHeight uint64     `json:"unlock_height,omitempty"`
+	IsLocked     *Bool      `json:"is_locked,omitempty"`
 }
 
 type AnnotatedAccount struct {
-	ID     string           `json:"id"`
-	Alias  string           `json:"alias,omitempty"`
-	Keys   []*AccountKey    `json:"keys"`
-	Quorum int              `json:"quorum"`
-	Tags   *json.RawMessage `json:"tags"`
+	ID         string           `json:"id"`
+	Alias      string           `json:"alias,omitempty"`
+	Keys       []*AccountKey    `json:"keys"`
+	Quorum     int              `json:"quorum"`
+	Tags       *json.RawMessage `json:"tags"`
+	IsArchived bool             `json:"is_archived"`
 }
 
 type AccountKey struct {
@@ -88,6 +97,11 @@ type AnnotatedAsset struct {
 	Definition      *json.RawMessage   `json:"definition"`
 	Tags            *json.RawMessage   `json:"tags"`
 	IsLocal         Bool               `json:"is_local"`
+
+	// Decimals and Unit are read from the definition's
+	// decimals and unit fields, if it declares them.
+	Decimals *int   `json:"decimals,omitempty"`
+	Unit     string `json:"unit,omitempty"`
 }
 
 type AssetKey struct {
@@ -191,6 +205,10 @@ func buildAnnotatedOutput(tx *legacy.Tx, idx int) *AnnotatedOutput {
 	} else {
 		out.Type = "control"
 	}
+	if unlockMS, _, ok := vmutil.ParseTimeLockProgram(out.ControlProgram); ok {
+		t := time.Unix(int64(unlockMS/1000), int64(unlockMS%1000)*int64(time.Millisecond)).UTC()
+		out.UnlockTime = &t
+	}
 	return out
 }
 
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/lib/pq"
+
 	"chain/core/query/filter"
 	"chain/errors"
 )
@@ -29,6 +31,47 @@ func (ind *Indexer) SaveAnnotatedAsset(ctx context.Context, asset *AnnotatedAsse
 	return errors.Wrap(err, "saving annotated asset")
 }
 
+// SaveAnnotatedAssets saves annotated assets to the query
+// indexes in one statement. The asset at each index of assets
+// has the sort ID at the same index of sortIDs.
+func (ind *Indexer) SaveAnnotatedAssets(ctx context.Context, assets []*AnnotatedAsset, sortIDs []string) error {
+	var (
+		ids         pq.ByteaArray
+		aliases     pq.StringArray
+		programs    pq.ByteaArray
+		keys        pq.StringArray
+		quorums     pq.Int64Array
+		definitions pq.StringArray
+		tags        pq.StringArray
+		locals      pq.BoolArray
+	)
+	for _, asset := range assets {
+		keysJSON, err := json.Marshal(asset.Keys)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		ids = append(ids, asset.ID.Bytes())
+		aliases = append(aliases, asset.Alias)
+		programs = append(programs, asset.IssuanceProgram)
+		keys = append(keys, string(keysJSON))
+		quorums = append(quorums, int64(asset.Quorum))
+		definitions = append(definitions, string(*asset.Definition))
+		tags = append(tags, string(*asset.Tags))
+		locals = append(locals, bool(asset.IsLocal))
+	}
+
+	const q = `
+		INSERT INTO annotated_assets
+			(id, sort_id, alias, issuance_program, keys, quorum, definition, tags, local)
+		SELECT unnest($1::bytea[]), unnest($2::text[]), unnest($3::text[]), unnest($4::bytea[]),
+			unnest($5::jsonb[]), unnest($6::integer[]), unnest($7::jsonb[]), unnest($8::jsonb[]), unnest($9::boolean[])
+		ON CONFLICT (id) DO UPDATE SET sort_id = excluded.sort_id, tags = excluded.tags
+	`
+	_, err := ind.db.ExecContext(ctx, q, ids, pq.StringArray(sortIDs), aliases, programs,
+		keys, quorums, definitions, tags, locals)
+	return errors.Wrap(err, "saving annotated assets")
+}
+
 // Assets queries the blockchain for annotated assets matching the query.
 func (ind *Indexer) Assets(ctx context.Context, filt string, vals []interface{}, after string, limit int) ([]*AnnotatedAsset, string, error) {
 	p, err := filter.Parse(filt, assetsTable, vals)
@@ -44,9 +87,11 @@ func (ind *Indexer) Assets(ctx context.Context, filt string, vals []interface{},
 	}
 
 	queryStr, queryArgs := constructAssetsQuery(expr, vals, after, limit)
-	rows, err := ind.db.QueryContext(ctx, queryStr, queryArgs...)
+	ctx, cancel := queryContext(ctx, "list-assets")
+	defer cancel()
+	rows, err := ind.reader(ctx).QueryContext(ctx, queryStr, queryArgs...)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "executing assets query")
+		return nil, "", queryErr(ctx, errors.Wrap(err, "executing assets query"))
 	}
 	defer rows.Close()
 
@@ -81,7 +126,7 @@ func (ind *Indexer) Assets(ctx context.Context, filt string, vals []interface{},
 	}
 	err = rows.Err()
 	if err != nil {
-		return nil, "", errors.Wrap(err)
+		return nil, "", queryErr(ctx, errors.Wrap(err))
 	}
 
 	return assets, after, nil
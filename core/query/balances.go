@@ -5,11 +5,13 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/lib/pq"
 
 	"chain/core/query/filter"
 	"chain/errors"
+	"chain/protocol/bc"
 )
 
 // Balances performs a balances query against the annotated_outputs.
@@ -25,22 +27,28 @@ func (ind *Indexer) Balances(ctx context.Context, filt string, vals []interface{
 	if err != nil {
 		return nil, err
 	}
-	queryStr, queryArgs, err := constructBalancesQuery(expr, vals, sumBy, timestampMS)
+	ctx, cancel := queryContext(ctx, "list-balances")
+	defer cancel()
+	lockMS, lockHeight, err := ind.lockPoint(ctx, timestampMS)
 	if err != nil {
-		return nil, err
+		return nil, queryErr(ctx, err)
 	}
-	rows, err := ind.db.QueryContext(ctx, queryStr, queryArgs...)
+	queryStr, queryArgs, err := constructBalancesQuery(expr, vals, sumBy, timestampMS, lockMS, lockHeight)
 	if err != nil {
 		return nil, err
 	}
+	rows, err := ind.reader(ctx).QueryContext(ctx, queryStr, queryArgs...)
+	if err != nil {
+		return nil, queryErr(ctx, err)
+	}
 	defer rows.Close()
 
 	var balances []interface{}
 	for rows.Next() {
-		// balance and groupings will hold the output of the row scan
-		var balance uint64
-		scanArguments := make([]interface{}, 0, len(sumBy)+1)
-		scanArguments = append(scanArguments, &balance)
+		// balance, locked and groupings will hold the output of the row scan
+		var balance, locked uint64
+		scanArguments := make([]interface{}, 0, len(sumBy)+2)
+		scanArguments = append(scanArguments, &balance, &locked)
 		for range sumBy {
 			// TODO(jackson): Support grouping by things besides strings.
 			scanArguments = append(scanArguments, new(*string))
@@ -52,27 +60,37 @@ func (ind *Indexer) Balances(ctx context.Context, filt string, vals []interface{
 
 		sumByValues := map[string]interface{}{}
 		for i, f := range sumBy {
-			sumByValues[f.String()] = scanArguments[i+1]
+			sumByValues[f.String()] = scanArguments[i+2]
 		}
 		// This struct enforces JSON field ordering in API output.
 		item := struct {
-			SumBy  map[string]interface{} `json:"sum_by,omitempty"`
-			Amount uint64                 `json:"amount"`
+			SumBy     map[string]interface{} `json:"sum_by,omitempty"`
+			Amount    uint64                 `json:"amount"`
+			Available uint64                 `json:"available"`
+			Locked    uint64                 `json:"locked"`
 		}{
-			Amount: balance,
+			Amount:    balance,
+			Available: balance - locked,
+			Locked:    locked,
 		}
 		if len(sumByValues) > 0 {
 			item.SumBy = sumByValues
 		}
 		balances = append(balances, item)
 	}
-	return balances, errors.Wrap(rows.Err())
+	return balances, queryErr(ctx, errors.Wrap(rows.Err()))
 }
 
-func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Field, timestampMS uint64) (string, []interface{}, error) {
+// constructBalancesQuery sums the amounts of the matching
+// outputs, and separately those of the outputs still locked
+// at lockMS and lockHeight.
+func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Field, timestampMS, lockMS, lockHeight uint64) (string, []interface{}, error) {
 	var buf bytes.Buffer
 
-	buf.WriteString("SELECT COALESCE(SUM(amount), 0)")
+	timestampValIndex := len(vals) + 1
+	vals = append(vals, timestampMS, lockMS, lockHeight)
+	buf.WriteString("SELECT COALESCE(SUM(amount), 0), ")
+	buf.WriteString(fmt.Sprintf("COALESCE(SUM(amount) FILTER (WHERE unlock_time_ms > $%d OR unlock_height > $%d), 0)", timestampValIndex+1, timestampValIndex+2))
 	for _, field := range sumBy {
 		fieldSQL, err := filter.FieldAsSQL(outputsTable, field)
 		if err != nil {
@@ -91,8 +109,6 @@ func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Fiel
 		buf.WriteString(") AND ")
 	}
 
-	vals = append(vals, timestampMS)
-	timestampValIndex := len(vals)
 	buf.WriteString(fmt.Sprintf("timespan @> $%d::int8", timestampValIndex))
 
 	if len(sumBy) > 0 {
@@ -101,9 +117,108 @@ func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Fiel
 			if i != 0 {
 				buf.WriteString(", ")
 			}
-			buf.WriteString(strconv.Itoa(i + 2)) // 1-indexed, skipping first col
+			buf.WriteString(strconv.Itoa(i + 3)) // 1-indexed, skipping the two sums
 		}
 	}
 	// TODO(jackson): Support pagination.
 	return buf.String(), vals, nil
 }
+
+// BalanceDelta is the net change in the amount of an asset
+// controlled by an account over a range of blocks.
+type BalanceDelta struct {
+	AccountID string     `json:"account_id"`
+	AssetID   bc.AssetID `json:"asset_id"`
+	Amount    int64      `json:"amount"`
+}
+
+// BalanceDeltasAfter identifies the last account and asset
+// returned by a BalanceDeltas query.
+type BalanceDeltasAfter struct {
+	accountID string
+	assetID   bc.AssetID
+}
+
+func (cur BalanceDeltasAfter) String() string {
+	assetID, _ := cur.assetID.MarshalText() // error is impossible
+	return cur.accountID + ":" + string(assetID)
+}
+
+func DecodeBalanceDeltasAfter(str string) (*BalanceDeltasAfter, error) {
+	i := strings.LastIndex(str, ":")
+	if i < 0 {
+		return nil, errors.Wrap(ErrBadAfter)
+	}
+	c := &BalanceDeltasAfter{accountID: str[:i]}
+	err := c.assetID.UnmarshalText([]byte(str[i+1:]))
+	if err != nil {
+		return nil, errors.Sub(ErrBadAfter, err)
+	}
+	return c, nil
+}
+
+// BalanceDeltas returns the net change in each account's balance of
+// each asset caused by the blocks after sinceHeight, up to and including
+// untilHeight. Accounts and assets whose balances did not change are
+// omitted. The deltas are ordered by account ID and asset ID, so a
+// range can be paged through deterministically.
+func (ind *Indexer) BalanceDeltas(ctx context.Context, sinceHeight, untilHeight uint64, after *BalanceDeltasAfter, limit int) ([]*BalanceDelta, *BalanceDeltasAfter, error) {
+	queryStr, queryArgs := constructBalanceDeltasQuery(sinceHeight, untilHeight, after, limit)
+	ctx, cancel := queryContext(ctx, "list-balance-deltas")
+	defer cancel()
+	rows, err := ind.reader(ctx).QueryContext(ctx, queryStr, queryArgs...)
+	if err != nil {
+		return nil, nil, queryErr(ctx, errors.Wrap(err, "querying balance deltas"))
+	}
+	defer rows.Close()
+
+	var newAfter BalanceDeltasAfter
+	if after != nil {
+		newAfter = *after
+	}
+
+	deltas := make([]*BalanceDelta, 0, limit)
+	for rows.Next() {
+		d := new(BalanceDelta)
+		err := rows.Scan(&d.AccountID, &d.AssetID, &d.Amount)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "scanning balance delta row")
+		}
+		deltas = append(deltas, d)
+		newAfter.accountID, newAfter.assetID = d.AccountID, d.AssetID
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, queryErr(ctx, errors.Wrap(err))
+	}
+	return deltas, &newAfter, nil
+}
+
+// constructBalanceDeltasQuery sums the account outputs created in the
+// block range and subtracts the account outputs spent in the same range.
+func constructBalanceDeltasQuery(sinceHeight, untilHeight uint64, after *BalanceDeltasAfter, limit int) (string, []interface{}) {
+	var buf bytes.Buffer
+	vals := []interface{}{sinceHeight, untilHeight}
+
+	buf.WriteString("SELECT account_id, asset_id, SUM(amount) FROM (")
+	buf.WriteString("SELECT out.account_id, out.asset_id, out.amount FROM ")
+	buf.WriteString(pq.QuoteIdentifier("annotated_outputs"))
+	buf.WriteString(" AS out WHERE out.block_height > $1 AND out.block_height <= $2 AND out.account_id IS NOT NULL")
+	buf.WriteString(" UNION ALL ")
+	buf.WriteString("SELECT inp.account_id, inp.asset_id, -inp.amount FROM ")
+	buf.WriteString(pq.QuoteIdentifier("annotated_inputs"))
+	buf.WriteString(" AS inp JOIN ")
+	buf.WriteString(pq.QuoteIdentifier("annotated_txs"))
+	buf.WriteString(" AS txs ON txs.tx_hash = inp.tx_hash")
+	buf.WriteString(" WHERE txs.block_height > $1 AND txs.block_height <= $2 AND inp.account_id IS NOT NULL")
+	buf.WriteString(") AS deltas")
+
+	if after != nil {
+		vals = append(vals, after.accountID, after.assetID)
+		buf.WriteString(fmt.Sprintf(" WHERE (account_id, asset_id) > ($%d, $%d)", len(vals)-1, len(vals)))
+	}
+
+	buf.WriteString(" GROUP BY account_id, asset_id HAVING SUM(amount) <> 0")
+	buf.WriteString(" ORDER BY account_id, asset_id LIMIT " + strconv.Itoa(limit))
+	return buf.String(), vals
+}
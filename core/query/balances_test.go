@@ -4,11 +4,14 @@ import (
 	"testing"
 
 	"chain/core/query/filter"
+	"chain/errors"
+	"chain/protocol/bc"
 	"chain/testutil"
 )
 
 func TestConstructBalancesQuery(t *testing.T) {
 	now := uint64(123456)
+	lockMS, lockHeight := uint64(123000), uint64(7)
 	testCases := []struct {
 		predicate  string
 		sumBy      []string
@@ -19,28 +22,28 @@ func TestConstructBalancesQuery(t *testing.T) {
 		{
 			predicate:  "account_id = 'abc'",
 			sumBy:      []string{"asset_id"},
-			wantQuery:  `SELECT COALESCE(SUM(amount), 0), encode(out."asset_id", 'hex') FROM "annotated_outputs" AS out WHERE (out."account_id" = 'abc') AND timespan @> $1::int8 GROUP BY 2`,
-			wantValues: []interface{}{now},
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(amount) FILTER (WHERE unlock_time_ms > $2 OR unlock_height > $3), 0), encode(out."asset_id", 'hex') FROM "annotated_outputs" AS out WHERE (out."account_id" = 'abc') AND timespan @> $1::int8 GROUP BY 3`,
+			wantValues: []interface{}{now, lockMS, lockHeight},
 		},
 		{
 			predicate:  "account_id = $1",
 			sumBy:      []string{"asset_id"},
 			values:     []interface{}{"abc"},
-			wantQuery:  `SELECT COALESCE(SUM(amount), 0), encode(out."asset_id", 'hex') FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND timespan @> $2::int8 GROUP BY 2`,
-			wantValues: []interface{}{`abc`, now},
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(amount) FILTER (WHERE unlock_time_ms > $3 OR unlock_height > $4), 0), encode(out."asset_id", 'hex') FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND timespan @> $2::int8 GROUP BY 3`,
+			wantValues: []interface{}{`abc`, now, lockMS, lockHeight},
 		},
 		{
 			predicate:  "asset_id = $1 AND account_id = $2",
 			values:     []interface{}{"foo", "bar"},
-			wantQuery:  `SELECT COALESCE(SUM(amount), 0) FROM "annotated_outputs" AS out WHERE (encode(out."asset_id", 'hex') = $1 AND out."account_id" = $2) AND timespan @> $3::int8`,
-			wantValues: []interface{}{`foo`, `bar`, now},
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(amount) FILTER (WHERE unlock_time_ms > $4 OR unlock_height > $5), 0) FROM "annotated_outputs" AS out WHERE (encode(out."asset_id", 'hex') = $1 AND out."account_id" = $2) AND timespan @> $3::int8`,
+			wantValues: []interface{}{`foo`, `bar`, now, lockMS, lockHeight},
 		},
 		{
 			predicate:  "account_id = $1",
 			sumBy:      []string{"asset_tags.currency"},
 			values:     []interface{}{"foo"},
-			wantQuery:  `SELECT COALESCE(SUM(amount), 0), out."asset_tags"->>'currency' FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND timespan @> $2::int8 GROUP BY 2`,
-			wantValues: []interface{}{`foo`, now},
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(amount) FILTER (WHERE unlock_time_ms > $3 OR unlock_height > $4), 0), out."asset_tags"->>'currency' FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND timespan @> $2::int8 GROUP BY 3`,
+			wantValues: []interface{}{`foo`, now, lockMS, lockHeight},
 		},
 	}
 
@@ -62,7 +65,7 @@ func TestConstructBalancesQuery(t *testing.T) {
 			fields = append(fields, f)
 		}
 
-		query, values, err := constructBalancesQuery(expr, tc.values, fields, now)
+		query, values, err := constructBalancesQuery(expr, tc.values, fields, now, lockMS, lockHeight)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -74,3 +77,49 @@ func TestConstructBalancesQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestConstructBalanceDeltasQuery(t *testing.T) {
+	assetID := bc.AssetID{V0: 1}
+	testCases := []struct {
+		after      *BalanceDeltasAfter
+		wantQuery  string
+		wantValues []interface{}
+	}{
+		{
+			after:      nil,
+			wantQuery:  `SELECT account_id, asset_id, SUM(amount) FROM (SELECT out.account_id, out.asset_id, out.amount FROM "annotated_outputs" AS out WHERE out.block_height > $1 AND out.block_height <= $2 AND out.account_id IS NOT NULL UNION ALL SELECT inp.account_id, inp.asset_id, -inp.amount FROM "annotated_inputs" AS inp JOIN "annotated_txs" AS txs ON txs.tx_hash = inp.tx_hash WHERE txs.block_height > $1 AND txs.block_height <= $2 AND inp.account_id IS NOT NULL) AS deltas GROUP BY account_id, asset_id HAVING SUM(amount) <> 0 ORDER BY account_id, asset_id LIMIT 100`,
+			wantValues: []interface{}{uint64(10), uint64(20)},
+		},
+		{
+			after:      &BalanceDeltasAfter{accountID: "acc1", assetID: assetID},
+			wantQuery:  `SELECT account_id, asset_id, SUM(amount) FROM (SELECT out.account_id, out.asset_id, out.amount FROM "annotated_outputs" AS out WHERE out.block_height > $1 AND out.block_height <= $2 AND out.account_id IS NOT NULL UNION ALL SELECT inp.account_id, inp.asset_id, -inp.amount FROM "annotated_inputs" AS inp JOIN "annotated_txs" AS txs ON txs.tx_hash = inp.tx_hash WHERE txs.block_height > $1 AND txs.block_height <= $2 AND inp.account_id IS NOT NULL) AS deltas WHERE (account_id, asset_id) > ($3, $4) GROUP BY account_id, asset_id HAVING SUM(amount) <> 0 ORDER BY account_id, asset_id LIMIT 100`,
+			wantValues: []interface{}{uint64(10), uint64(20), "acc1", assetID},
+		},
+	}
+
+	for i, tc := range testCases {
+		query, values := constructBalanceDeltasQuery(10, 20, tc.after, 100)
+		if query != tc.wantQuery {
+			t.Errorf("case %d: got\n%s\nwant\n%s", i, query, tc.wantQuery)
+		}
+		if !testutil.DeepEqual(values, tc.wantValues) {
+			t.Errorf("case %d: got %#v, want %#v", i, values, tc.wantValues)
+		}
+	}
+}
+
+func TestDecodeBalanceDeltasAfter(t *testing.T) {
+	want := BalanceDeltasAfter{accountID: "acc1", assetID: bc.AssetID{V0: 1}}
+	got, err := DecodeBalanceDeltasAfter(want.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Errorf("got %#v, want %#v", *got, want)
+	}
+
+	_, err = DecodeBalanceDeltasAfter("hello")
+	if errors.Root(err) != ErrBadAfter {
+		t.Errorf("got error %v, want %v", err, ErrBadAfter)
+	}
+}
@@ -0,0 +1,114 @@
+package query_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/generator"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/query/filter"
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+)
+
+const (
+	benchTxs      = 1000 // transactions in the seeded dataset
+	benchBlockTxs = 100  // transactions per block
+	benchPageSize = 100
+)
+
+// setupBench seeds a database with benchTxs issuances to two
+// accounts, spread over blocks of benchBlockTxs, and indexes
+// them. Every benchmark sees the same dataset, so results are
+// comparable from one release to the next.
+func setupBench(b *testing.B) (context.Context, *query.Indexer, string, bc.AssetID) {
+	_, db := pgtest.NewDB(b, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(b)
+	pinStore := pin.NewStore(db)
+	coretest.CreatePins(ctx, b, pinStore)
+	indexer := query.NewIndexer(db, c, pinStore)
+	accounts := account.NewManager(db, c, pinStore)
+	assets := asset.NewRegistry(db, c, pinStore)
+	assets.IndexAssets(indexer)
+	indexer.RegisterAnnotator(accounts.AnnotateTxs)
+	indexer.RegisterAnnotator(assets.AnnotateTxs)
+	go assets.ProcessBlocks(ctx)
+	go accounts.ProcessBlocks(ctx)
+	go indexer.ProcessBlocks(ctx)
+
+	acct1 := coretest.CreateAccount(ctx, b, accounts, "", nil)
+	acct2 := coretest.CreateAccount(ctx, b, accounts, "", nil)
+	asset1 := coretest.CreateAsset(ctx, b, assets, nil, "", map[string]interface{}{"currency": "USD"})
+
+	g := generator.New(c, nil, db)
+	for i := 0; i < benchTxs; i++ {
+		acct := acct1
+		if i%2 == 1 {
+			acct = acct2
+		}
+		coretest.IssueAssets(ctx, b, c, g, assets, accounts, asset1, 1, acct)
+		if (i+1)%benchBlockTxs == 0 {
+			prottest.MakeBlock(b, c, g.PendingTxs())
+		}
+	}
+	<-pinStore.PinWaiter(query.TxPinName, c.Height())
+	return ctx, indexer, acct1, asset1
+}
+
+func BenchmarkQuery(b *testing.B) {
+	ctx, indexer, acct1, asset1 := setupBench(b)
+	b.ResetTimer()
+
+	b.Run("transactions-page", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			after, err := indexer.LookupTxAfter(ctx, 0, math.MaxInt64)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, _, err = indexer.Transactions(ctx, "", nil, after, benchPageSize, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("transactions-page-filtered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			after, err := indexer.LookupTxAfter(ctx, 0, math.MaxInt64)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, _, err = indexer.Transactions(ctx, "outputs(account_id=$1)", []interface{}{acct1}, after, benchPageSize, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("balances", func(b *testing.B) {
+		f, err := filter.ParseField("account_id")
+		if err != nil {
+			b.Fatal(err)
+		}
+		sumBy := []filter.Field{f}
+		for i := 0; i < b.N; i++ {
+			_, err = indexer.Balances(ctx, "asset_id=$1", []interface{}{asset1.String()}, sumBy, math.MaxInt64)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unspent-outputs-page", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _, err := indexer.Outputs(ctx, "account_id=$1", []interface{}{acct1}, math.MaxInt64, nil, benchPageSize)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
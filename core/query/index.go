@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
 
 	"github.com/lib/pq"
 
@@ -11,6 +12,7 @@ import (
 	"chain/database/pg"
 	"chain/errors"
 	"chain/protocol"
+	"chain/protocol/bc"
 	"chain/protocol/bc/legacy"
 )
 
@@ -33,11 +35,76 @@ func NewIndexer(db pg.DB, c *protocol.Chain, pinStore *pin.Store) *Indexer {
 // Indexer creates, updates and queries against indexes.
 type Indexer struct {
 	db         pg.DB
+	replica    pg.DB
 	c          *protocol.Chain
 	pinStore   *pin.Store
 	annotators []Annotator
 }
 
+// UseReplica makes the indexer run its read-only list queries
+// against replica, a read replica of its database, so heavy
+// reads don't contend with writes on the primary. Queries made
+// with a context from pg.NewPrimaryContext still use the
+// primary.
+func (ind *Indexer) UseReplica(replica pg.DB) {
+	ind.replica = replica
+}
+
+// reader returns the database to use for read-only queries.
+func (ind *Indexer) reader(ctx context.Context) pg.DB {
+	if ind.replica != nil && !pg.IsPrimaryContext(ctx) {
+		return ind.replica
+	}
+	return ind.db
+}
+
+// IndexedHeight returns the height of the last block indexed
+// in the database list queries read from with ctx. A read
+// replica may lag behind the primary, so list queries over a
+// range of blocks shouldn't extend past it.
+func (ind *Indexer) IndexedHeight(ctx context.Context) (uint64, error) {
+	var height uint64
+	const q = `SELECT height FROM block_processors WHERE name = $1`
+	err := ind.reader(ctx).QueryRowContext(ctx, q, TxPinName).Scan(&height)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return height, errors.Wrap(err, "querying indexed height")
+}
+
+// queryTimeouts bounds how long each list query may run.
+// When its context is done, pq cancels a query on the
+// server, so a runaway query gives up its connection
+// rather than holding it for minutes.
+var queryTimeouts = map[string]time.Duration{
+	"list-accounts":        10 * time.Second,
+	"list-assets":          10 * time.Second,
+	"list-balances":        30 * time.Second,
+	"list-balance-deltas":  30 * time.Second,
+	"list-journal-entries": 30 * time.Second,
+	"list-transactions":    30 * time.Second,
+	"list-unspent-outputs": 30 * time.Second,
+	"lookup-tx-after":      10 * time.Second,
+}
+
+// queryContext returns a context for running the named list
+// query, which ends at the query's deadline unless ctx ends
+// sooner. See pg.NewNamedContext.
+func queryContext(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(pg.NewNamedContext(ctx, name), queryTimeouts[name])
+}
+
+// queryErr returns err, the error from a list query made with
+// ctx. If ctx is done, the query was canceled, and the returned
+// error has ctx's error as its root, so it's reported as a
+// timeout rather than an internal error.
+func queryErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return errors.Sub(ctx.Err(), err)
+	}
+	return err
+}
+
 // Annotator describes a function capable of adding annotations
 // to transactions, inputs and outputs.
 type Annotator func(ctx context.Context, txs []*AnnotatedTx) error
@@ -225,6 +292,8 @@ func (ind *Indexer) insertAnnotatedOutputs(ctx context.Context, b *legacy.Block,
 		outputControlPrograms  pq.ByteaArray
 		outputReferenceDatas   pq.StringArray
 		outputLocals           pq.BoolArray
+		outputUnlockTimes      pq.Int64Array
+		outputUnlockHeights    pq.Int64Array
 		prevoutIDs             pq.ByteaArray
 	)
 	for pos, tx := range b.Transactions {
@@ -257,6 +326,12 @@ func (ind *Indexer) insertAnnotatedOutputs(ctx context.Context, b *legacy.Block,
 			outputControlPrograms = append(outputControlPrograms, out.ControlProgram)
 			outputReferenceDatas = append(outputReferenceDatas, string(*out.ReferenceData))
 			outputLocals = append(outputLocals, bool(out.IsLocal))
+			var unlockMS uint64
+			if out.UnlockTime != nil {
+				unlockMS = bc.Millis(*out.UnlockTime)
+			}
+			outputUnlockTimes = append(outputUnlockTimes, int64(unlockMS))
+			outputUnlockHeights = append(outputUnlockHeights, int64(out.UnlockHeight))
 		}
 	}
 
@@ -265,20 +340,22 @@ func (ind *Indexer) insertAnnotatedOutputs(ctx context.Context, b *legacy.Block,
 		WITH utxos AS (
 			SELECT * FROM unnest($2::integer[], $3::integer[], $4::bytea[], $6::bytea[], $7::text[], $8::text[],
 				$9::bytea[], $10::text[], $11::jsonb[], $12::jsonb[], $13::boolean[], $14::bigint[],
-				$15::text[], $16::text[], $17::jsonb[], $18::bytea[], $19::jsonb[], $20::boolean[])
+				$15::text[], $16::text[], $17::jsonb[], $18::bytea[], $19::jsonb[], $20::boolean[],
+				$21::bigint[], $22::bigint[])
 			AS t(tx_pos, output_index, tx_hash, output_id, type, purpose,
 				asset_id, asset_alias, asset_definition, asset_tags, asset_local, amount,
-				account_id, account_alias, account_tags, control_program, reference_data, local)
+				account_id, account_alias, account_tags, control_program, reference_data, local,
+				unlock_time_ms, unlock_height)
 		)
 		INSERT INTO annotated_outputs (block_height, tx_pos, output_index, tx_hash,
 			timespan, output_id, type, purpose, asset_id, asset_alias, asset_definition,
 			asset_tags, asset_local, amount, account_id, account_alias, account_tags,
-			control_program, reference_data, local)
+			control_program, reference_data, local, unlock_time_ms, unlock_height)
 		SELECT $1, tx_pos, output_index, tx_hash,
 		CASE WHEN type='retire' THEN int8range($5, $5) ELSE int8range($5, NULL) END,
 		output_id, type, purpose, asset_id, asset_alias, asset_definition, asset_tags,
 		asset_local, amount, account_id, account_alias, account_tags, control_program,
-		reference_data, local
+		reference_data, local, NULLIF(unlock_time_ms, 0), NULLIF(unlock_height, 0)
 		FROM utxos
 		ON CONFLICT (block_height, tx_pos, output_index) DO NOTHING;
 	`
@@ -288,7 +365,7 @@ func (ind *Indexer) insertAnnotatedOutputs(ctx context.Context, b *legacy.Block,
 		outputAssetDefinitions, outputAssetTags, outputAssetLocals,
 		outputAmounts, pq.Array(outputAccountIDs), pq.Array(outputAccountAliases),
 		pq.Array(outputAccountTags), outputControlPrograms, outputReferenceDatas,
-		outputLocals)
+		outputLocals, outputUnlockTimes, outputUnlockHeights)
 	if err != nil {
 		return errors.Wrap(err, "batch inserting annotated outputs")
 	}
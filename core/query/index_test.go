@@ -5,7 +5,9 @@ import (
 	"testing"
 	"unicode"
 
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol/bc/bctest"
 	"chain/protocol/bc/legacy"
 	"chain/protocol/prottest"
@@ -32,6 +34,31 @@ func TestAnnotatedTxs(t *testing.T) {
 	}
 }
 
+func TestIndexedHeight(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := pgtest.NewTx(t), pgtest.NewTx(t)
+	pgtest.Exec(ctx, primary, t, `INSERT INTO block_processors (name, height) VALUES ($1, 5)`, TxPinName)
+	pgtest.Exec(ctx, replica, t, `INSERT INTO block_processors (name, height) VALUES ($1, 3)`, TxPinName)
+
+	indexer := NewIndexer(primary, prottest.NewChain(t), nil)
+	indexer.UseReplica(replica)
+	for _, c := range []struct {
+		ctx  context.Context
+		want uint64
+	}{
+		{ctx, 3},
+		{pg.NewPrimaryContext(ctx), 5},
+	} {
+		got, err := indexer.IndexedHeight(c.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("IndexedHeight() = %d, want %d", got, c.want)
+		}
+	}
+}
+
 func TestAnnotatedTxsReferenceData(t *testing.T) {
 	ctx := context.Background()
 
@@ -74,3 +101,26 @@ func TestAnnotatedTxsReferenceData(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryContext(t *testing.T) {
+	ctx, cancel := queryContext(context.Background(), "list-accounts")
+	defer cancel()
+	if got := pg.QueryName(ctx); got != "list-accounts" {
+		t.Errorf("QueryName = %q, want list-accounts", got)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("list query context has no deadline")
+	}
+
+	pqErr := errors.New("pq: canceling statement due to user request")
+	if err := queryErr(ctx, pqErr); err != pqErr {
+		t.Errorf("queryErr(live ctx) = %v, want %v", err, pqErr)
+	}
+	cancel()
+	if err := queryErr(ctx, pqErr); errors.Root(err) != context.Canceled {
+		t.Errorf("queryErr(done ctx) root = %v, want %v", errors.Root(err), context.Canceled)
+	}
+	if err := queryErr(ctx, nil); err != nil {
+		t.Errorf("queryErr(done ctx, nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,296 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrBadPeriodEnd is returned by ClosePeriod for a block
+// height that doesn't come after the last closed period, or
+// hasn't been indexed.
+var ErrBadPeriodEnd = errors.New("bad period end")
+
+// Journal entry types.
+const (
+	EntryTransaction = "transaction"
+	EntryPeriodClose = "period_close"
+)
+
+// Journal ledgers. Each journal line is posted to one of
+// this core's accounts or, for value entering or leaving
+// them, to one of the other ledgers: issuance for value
+// issued, retirement for value retired, and external for
+// value controlled by programs outside this core's accounts.
+const (
+	LedgerAccount    = "account"
+	LedgerIssuance   = "issuance"
+	LedgerRetirement = "retirement"
+	LedgerExternal   = "external"
+)
+
+// closePos is the position of a period close marker among
+// the transactions of its block: after all of them.
+const closePos = math.MaxInt32
+
+// JournalEntry is a transaction presented as double-entry
+// journal lines, or a marker closing an accounting period
+// after the last transaction of its block.
+type JournalEntry struct {
+	Type          string         `json:"type"`
+	BlockHeight   uint64         `json:"block_height"`
+	Timestamp     time.Time      `json:"timestamp"`
+	TransactionID *bc.Hash       `json:"transaction_id,omitempty"`
+	Lines         []*JournalLine `json:"lines,omitempty"`
+	Period        *Period        `json:"period,omitempty"`
+
+	pos int
+}
+
+// JournalLine is the net change to one ledger's balance of
+// one asset in a transaction. An increase is a debit and a
+// decrease a credit, so each asset's debits and credits in
+// an entry are equal.
+type JournalLine struct {
+	Ledger       string     `json:"ledger"`
+	AccountID    string     `json:"account_id,omitempty"`
+	AccountAlias string     `json:"account_alias,omitempty"`
+	AssetID      bc.AssetID `json:"asset_id"`
+	AssetAlias   string     `json:"asset_alias,omitempty"`
+	Debit        uint64     `json:"debit"`
+	Credit       uint64     `json:"credit"`
+}
+
+// Period is a closed accounting period. It covers the blocks
+// after the previous period's end, up to and including
+// EndHeight, whose timestamp is EndTime.
+type Period struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	EndHeight uint64    `json:"end_block_height"`
+	EndTime   time.Time `json:"end_time"`
+	ClosedAt  time.Time `json:"closed_at"`
+}
+
+// JournalAfter identifies the last entry returned by a
+// Journal query.
+type JournalAfter struct {
+	height uint64
+	pos    int
+}
+
+func (cur JournalAfter) String() string {
+	return fmt.Sprintf("%d:%d", cur.height, cur.pos)
+}
+
+func DecodeJournalAfter(str string) (*JournalAfter, error) {
+	i := strings.Index(str, ":")
+	if i < 0 {
+		return nil, errors.Wrap(ErrBadAfter)
+	}
+	height, err := strconv.ParseUint(str[:i], 10, 64)
+	if err != nil {
+		return nil, errors.Sub(ErrBadAfter, err)
+	}
+	pos, err := strconv.Atoi(str[i+1:])
+	if err != nil {
+		return nil, errors.Sub(ErrBadAfter, err)
+	}
+	return &JournalAfter{height: height, pos: pos}, nil
+}
+
+func (cur *JournalAfter) before(height uint64, pos int) bool {
+	return cur == nil || cur.height < height || (cur.height == height && cur.pos < pos)
+}
+
+// Journal returns up to limit journal entries for the
+// transactions in the blocks after sinceHeight, up to and
+// including untilHeight, in the order they were confirmed,
+// with a period close marker after the last transaction of
+// each closed period in the range. Markers don't count toward
+// limit.
+func (ind *Indexer) Journal(ctx context.Context, sinceHeight, untilHeight uint64, after *JournalAfter, limit int) ([]*JournalEntry, *JournalAfter, error) {
+	ctx, cancel := queryContext(ctx, "list-journal-entries")
+	defer cancel()
+	db := ind.reader(ctx)
+
+	var afterHeight uint64
+	afterPos := -1
+	if after != nil {
+		afterHeight, afterPos = after.height, after.pos
+	}
+	const txQ = `
+		SELECT block_height, tx_pos, tx_hash, timestamp FROM annotated_txs
+		WHERE block_height > $1 AND block_height <= $2 AND (block_height, tx_pos) > ($3, $4)
+		ORDER BY block_height, tx_pos
+		LIMIT $5
+	`
+	var (
+		entries []*JournalEntry
+		index   = make(map[bc.Hash]*JournalEntry)
+		hashes  pq.ByteaArray
+	)
+	err := pg.ForQueryRows(ctx, db, txQ, sinceHeight, untilHeight, afterHeight, afterPos, limit,
+		func(height uint64, pos int, txHash bc.Hash, ts time.Time) {
+			h := txHash
+			e := &JournalEntry{
+				Type:          EntryTransaction,
+				BlockHeight:   height,
+				Timestamp:     ts,
+				TransactionID: &h,
+				pos:           pos,
+			}
+			entries = append(entries, e)
+			index[txHash] = e
+			hashes = append(hashes, txHash.Bytes())
+		})
+	if err != nil {
+		return nil, nil, queryErr(ctx, errors.Wrap(err, "querying journal transactions"))
+	}
+
+	if len(entries) > 0 {
+		err = ind.journalLines(ctx, db, hashes, index)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Close markers go up to the last entry, or the end of
+	// the range if this is the last page.
+	endHeight, endPos := untilHeight, closePos
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		endHeight, endPos = last.BlockHeight, last.pos
+	}
+	periods, err := ind.periods(ctx, db, sinceHeight, endHeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	var merged []*JournalEntry
+	for _, p := range periods {
+		if !after.before(p.EndHeight, closePos) || (p.EndHeight == endHeight && endPos < closePos) {
+			continue
+		}
+		for len(entries) > 0 && entries[0].BlockHeight <= p.EndHeight {
+			merged = append(merged, entries[0])
+			entries = entries[1:]
+		}
+		merged = append(merged, &JournalEntry{
+			Type:        EntryPeriodClose,
+			BlockHeight: p.EndHeight,
+			Timestamp:   p.EndTime,
+			Period:      p,
+			pos:         closePos,
+		})
+	}
+	merged = append(merged, entries...)
+
+	var newAfter JournalAfter
+	if after != nil {
+		newAfter = *after
+	}
+	if len(merged) > 0 {
+		last := merged[len(merged)-1]
+		newAfter = JournalAfter{height: last.BlockHeight, pos: last.pos}
+	}
+	return merged, &newAfter, nil
+}
+
+// journalLines adds the lines of each transaction in hashes
+// to its entry in index. Inputs decrease a ledger's balance
+// and outputs increase it.
+func (ind *Indexer) journalLines(ctx context.Context, db pg.DB, hashes pq.ByteaArray, index map[bc.Hash]*JournalEntry) error {
+	const q = `
+		SELECT tx_hash, ledger, account_id, max(account_alias), asset_id, max(asset_alias), sum(amount)
+		FROM (
+			SELECT tx_hash, account_id, account_alias, asset_id, asset_alias, -amount AS amount,
+				CASE WHEN account_id IS NOT NULL THEN 'account' WHEN type = 'issue' THEN 'issuance' ELSE 'external' END AS ledger
+			FROM annotated_inputs WHERE tx_hash = ANY($1)
+			UNION ALL
+			SELECT tx_hash, account_id, account_alias, asset_id, asset_alias, amount,
+				CASE WHEN account_id IS NOT NULL THEN 'account' WHEN type = 'retire' THEN 'retirement' ELSE 'external' END
+			FROM annotated_outputs WHERE tx_hash = ANY($1)
+		) AS postings
+		GROUP BY tx_hash, ledger, account_id, asset_id
+		HAVING sum(amount) <> 0
+		ORDER BY tx_hash, asset_id, sum(amount) < 0, account_id
+	`
+	err := pg.ForQueryRows(ctx, db, q, hashes, func(txHash bc.Hash, ledger string, accountID, accountAlias sql.NullString, assetID bc.AssetID, assetAlias string, amount int64) {
+		l := &JournalLine{
+			Ledger:       ledger,
+			AccountID:    accountID.String,
+			AccountAlias: accountAlias.String,
+			AssetID:      assetID,
+			AssetAlias:   assetAlias,
+		}
+		if amount > 0 {
+			l.Debit = uint64(amount)
+		} else {
+			l.Credit = uint64(-amount)
+		}
+		e := index[txHash]
+		e.Lines = append(e.Lines, l)
+	})
+	return queryErr(ctx, errors.Wrap(err, "querying journal lines"))
+}
+
+// periods returns the closed periods ending in the blocks
+// after sinceHeight, up to and including untilHeight.
+func (ind *Indexer) periods(ctx context.Context, db pg.DB, sinceHeight, untilHeight uint64) ([]*Period, error) {
+	const q = `
+		SELECT id, name, end_height, end_time, closed_at FROM journal_periods
+		WHERE end_height > $1 AND end_height <= $2
+		ORDER BY end_height
+	`
+	var periods []*Period
+	err := pg.ForQueryRows(ctx, db, q, sinceHeight, untilHeight, func(id, name string, height uint64, endTime, closedAt time.Time) {
+		periods = append(periods, &Period{
+			ID:        id,
+			Name:      name,
+			EndHeight: height,
+			EndTime:   endTime.UTC(),
+			ClosedAt:  closedAt.UTC(),
+		})
+	})
+	return periods, queryErr(ctx, errors.Wrap(err, "querying journal periods"))
+}
+
+// Periods returns all closed periods, oldest first.
+func (ind *Indexer) Periods(ctx context.Context) ([]*Period, error) {
+	return ind.periods(ctx, ind.db, 0, math.MaxInt64)
+}
+
+// ClosePeriod closes the accounting period ending with the
+// block at the given height, whose timestamp is endTime. It
+// must come after the last closed period, and the block must
+// have been indexed.
+func (ind *Indexer) ClosePeriod(ctx context.Context, name string, height uint64, endTime time.Time) (*Period, error) {
+	if height > ind.pinStore.Height(TxPinName) {
+		return nil, errors.WithDetailf(ErrBadPeriodEnd, "block %d has not been indexed yet", height)
+	}
+	const q = `
+		INSERT INTO journal_periods (name, end_height, end_time)
+		SELECT $1, $2, $3
+		WHERE $2 > (SELECT COALESCE(max(end_height), 0) FROM journal_periods)
+		RETURNING id, closed_at
+	`
+	p := &Period{Name: name, EndHeight: height, EndTime: endTime.UTC()}
+	err := ind.db.QueryRowContext(ctx, q, name, height, endTime).Scan(&p.ID, &p.ClosedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetail(ErrBadPeriodEnd, "period must end after the last closed period")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "closing period")
+	}
+	p.ClosedAt = p.ClosedAt.UTC()
+	return p, nil
+}
@@ -0,0 +1,49 @@
+package query
+
+import (
+	"testing"
+
+	"chain/errors"
+)
+
+func TestDecodeJournalAfter(t *testing.T) {
+	want := JournalAfter{height: 12, pos: closePos}
+	got, err := DecodeJournalAfter(want.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Errorf("got %#v, want %#v", *got, want)
+	}
+
+	for _, s := range []string{"hello", "12", "x:1", "12:y"} {
+		_, err = DecodeJournalAfter(s)
+		if errors.Root(err) != ErrBadAfter {
+			t.Errorf("DecodeJournalAfter(%q) error = %v, want %v", s, err, ErrBadAfter)
+		}
+	}
+}
+
+func TestJournalAfterBefore(t *testing.T) {
+	cur := &JournalAfter{height: 5, pos: 2}
+	cases := []struct {
+		height uint64
+		pos    int
+		want   bool
+	}{
+		{4, closePos, false},
+		{5, 2, false},
+		{5, 3, true},
+		{5, closePos, true},
+		{6, 0, true},
+	}
+	for _, c := range cases {
+		if got := cur.before(c.height, c.pos); got != c.want {
+			t.Errorf("before(%d, %d) = %v, want %v", c.height, c.pos, got, c.want)
+		}
+	}
+	var none *JournalAfter
+	if !none.before(1, 0) {
+		t.Error("nil cursor should come before every entry")
+	}
+}
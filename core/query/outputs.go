@@ -3,8 +3,10 @@ package query
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/lib/pq"
 
@@ -60,9 +62,15 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 		return nil, nil, err
 	}
 	queryStr, queryArgs := constructOutputsQuery(expr, vals, timestampMS, after, limit)
-	rows, err := ind.db.QueryContext(ctx, queryStr, queryArgs...)
+	ctx, cancel := queryContext(ctx, "list-unspent-outputs")
+	defer cancel()
+	lockMS, lockHeight, err := ind.lockPoint(ctx, timestampMS)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, queryErr(ctx, err)
+	}
+	rows, err := ind.reader(ctx).QueryContext(ctx, queryStr, queryArgs...)
+	if err != nil {
+		return nil, nil, queryErr(ctx, err)
 	}
 	defer rows.Close()
 
@@ -79,6 +87,8 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 			txID         = new(bc.Hash)
 			accountID    *string
 			accountAlias *string
+			unlockMS     sql.NullInt64
+			unlockHeight sql.NullInt64
 			out          = new(AnnotatedOutput)
 		)
 		err = rows.Scan(
@@ -101,6 +111,8 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 			&out.ControlProgram,
 			&out.ReferenceData,
 			&out.IsLocal,
+			&unlockMS,
+			&unlockHeight,
 		)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "scanning annotated output")
@@ -115,6 +127,13 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 		if accountAlias != nil {
 			out.AccountAlias = *accountAlias
 		}
+		if unlockMS.Valid {
+			t := time.Unix(unlockMS.Int64/1000, unlockMS.Int64%1000*int64(time.Millisecond)).UTC()
+			out.UnlockTime = &t
+		}
+		out.UnlockHeight = uint64(unlockHeight.Int64)
+		locked := Bool(uint64(unlockMS.Int64) > lockMS || out.UnlockHeight > lockHeight)
+		out.IsLocked = &locked
 
 		outputs = append(outputs, out)
 
@@ -124,7 +143,7 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 	}
 	err = rows.Err()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, queryErr(ctx, err)
 	}
 
 	return outputs, &newAfter, nil
@@ -137,7 +156,7 @@ func constructOutputsQuery(where string, vals []interface{}, timestampMS uint64,
 	buf.WriteString("block_height, tx_pos, output_index, tx_hash, output_id, type, purpose, ")
 	buf.WriteString("asset_id, asset_alias, asset_definition, asset_tags, asset_local, ")
 	buf.WriteString("amount, account_id, account_alias, account_tags, control_program, ")
-	buf.WriteString("reference_data, local")
+	buf.WriteString("reference_data, local, unlock_time_ms, unlock_height")
 	buf.WriteString(" FROM ")
 	buf.WriteString(pq.QuoteIdentifier("annotated_outputs"))
 	buf.WriteString(" AS out WHERE ")
@@ -169,3 +188,17 @@ func constructOutputsQuery(where string, vals []interface{}, timestampMS uint64,
 
 	return buf.String(), vals
 }
+
+// lockPoint returns the time and block height at which a query
+// as of timestampMS checks whether outputs are locked: the
+// earlier of timestampMS and now, and the height of the last
+// block indexed by then.
+func (ind *Indexer) lockPoint(ctx context.Context, timestampMS uint64) (lockMS, height uint64, err error) {
+	lockMS = timestampMS
+	if now := bc.Millis(time.Now()); now < lockMS {
+		lockMS = now
+	}
+	const q = `SELECT COALESCE(MAX(height), 0) FROM query_blocks WHERE timestamp <= $1`
+	err = ind.reader(ctx).QueryRowContext(ctx, q, lockMS).Scan(&height)
+	return lockMS, height, errors.Wrap(err, "finding lock height")
+}
@@ -216,85 +216,85 @@ func TestQueryBalances(t *testing.T) {
 			predicate: "asset_id = $1",
 			values:    []interface{}{asset1.String()},
 			when:      time1,
-			want:      `[{"amount": 0}]`,
+			want:      `[{"amount": 0, "available": 0, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_tags.currency = $1",
 			values:    []interface{}{"USD"},
 			when:      time1,
-			want:      `[{"amount": 0}]`,
+			want:      `[{"amount": 0, "available": 0, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_id = $1",
 			values:    []interface{}{asset1.String()},
 			when:      time2,
-			want:      `[{"amount": 867}]`,
+			want:      `[{"amount": 867, "available": 867, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_tags.currency = $1",
 			values:    []interface{}{"USD"},
 			when:      time2,
-			want:      `[{"amount": 867}]`,
+			want:      `[{"amount": 867, "available": 867, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_id = $1",
 			values:    []interface{}{asset2.String()},
 			when:      time1,
-			want:      `[{"amount": 0}]`,
+			want:      `[{"amount": 0, "available": 0, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_id = $1",
 			values:    []interface{}{asset2.String()},
 			when:      time2,
-			want:      `[{"amount": 100}]`,
+			want:      `[{"amount": 100, "available": 100, "locked": 0}]`,
 		},
 		{
 			predicate: "account_id = $1",
 			values:    []interface{}{acct1},
 			when:      time1,
-			want:      `[{"amount": 0}]`,
+			want:      `[{"amount": 0, "available": 0, "locked": 0}]`,
 		},
 		{
 			predicate: "account_id = $1",
 			values:    []interface{}{acct1},
 			when:      time2,
-			want:      `[{"amount": 967}]`,
+			want:      `[{"amount": 967, "available": 967, "locked": 0}]`,
 		},
 		{
 			predicate: "account_id = $1",
 			values:    []interface{}{acct2},
 			when:      time1,
-			want:      `[{"amount": 0}]`,
+			want:      `[{"amount": 0, "available": 0, "locked": 0}]`,
 		},
 		{
 			predicate: "account_id = $1",
 			values:    []interface{}{acct2},
 			when:      time2,
-			want:      `[{"amount": 0}]`,
+			want:      `[{"amount": 0, "available": 0, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_id = $1 AND account_id = $2",
 			values:    []interface{}{asset1.String(), acct1},
 			when:      time2,
-			want:      `[{"amount": 867}]`,
+			want:      `[{"amount": 867, "available": 867, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_id = $1 AND account_id = $2",
 			values:    []interface{}{asset2.String(), acct1},
 			when:      time2,
-			want:      `[{"amount": 100}]`,
+			want:      `[{"amount": 100, "available": 100, "locked": 0}]`,
 		},
 		{
 			predicate: "asset_id = $1",
 			sumBy:     []string{"account_id"},
 			values:    []interface{}{asset1.String()},
 			when:      time2,
-			want:      `[{"sum_by": {"account_id": "` + acct1 + `"}, "amount": 867}]`,
+			want:      `[{"sum_by": {"account_id": "` + acct1 + `"}, "amount": 867, "available": 867, "locked": 0}]`,
 		},
 		{
 			sumBy: []string{"asset_tags.currency"},
 			when:  time2,
-			want:  `[{"sum_by": {"asset_tags.currency": "USD"}, "amount": 867}, {"sum_by": {"asset_tags.currency": null}, "amount": 100}]`,
+			want:  `[{"sum_by": {"asset_tags.currency": "USD"}, "amount": 867, "available": 867, "locked": 0}, {"sum_by": {"asset_tags.currency": null}, "amount": 100, "available": 100, "locked": 0}]`,
 		},
 	}
 
@@ -9,6 +9,7 @@ import (
 	"strconv"
 
 	"chain/core/query/filter"
+	"chain/database/pg"
 	"chain/errors"
 )
 
@@ -63,9 +64,11 @@ func (ind *Indexer) LookupTxAfter(ctx context.Context, begin, end uint64) (TxAft
 	`
 
 	var from, stop uint64
-	err := ind.db.QueryRowContext(ctx, q, begin, end).Scan(&from, &stop)
+	ctx, cancel := queryContext(ctx, "lookup-tx-after")
+	defer cancel()
+	err := ind.reader(ctx).QueryRowContext(ctx, q, begin, end).Scan(&from, &stop)
 	if err != nil {
-		return TxAfter{}, errors.Wrap(err, "querying `query_blocks`")
+		return TxAfter{}, queryErr(ctx, errors.Wrap(err, "querying `query_blocks`"))
 	}
 	return TxAfter{
 		FromBlockHeight: from,
@@ -97,6 +100,51 @@ func (ind *Indexer) Transactions(ctx context.Context, filt string, vals []interf
 	return ind.fetchTransactions(ctx, queryStr, queryArgs, after, limit)
 }
 
+// TransactionsBetween queries the blockchain for transactions matching
+// the filter predicate `filt` that appear after the position identified
+// by `from` and at or before the position identified by `until`. The
+// transactions are returned in ascending order. It lets a client that
+// recorded two cursors fetch only the transactions between them instead
+// of paginating from the beginning.
+func (ind *Indexer) TransactionsBetween(ctx context.Context, filt string, vals []interface{}, from, until TxAfter, limit int) ([]*AnnotatedTx, *TxAfter, error) {
+	p, err := filter.Parse(filt, transactionsTable, vals)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vals) != p.Parameters {
+		return nil, nil, ErrParameterCountMismatch
+	}
+	expr, err := filter.AsSQL(p, transactionsTable, vals)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "converting to SQL")
+	}
+
+	queryStr, queryArgs := constructTransactionsBetweenQuery(expr, vals, from, until, limit)
+	from.StopBlockHeight = until.FromBlockHeight
+	return ind.fetchTransactions(ctx, queryStr, queryArgs, from, limit)
+}
+
+func constructTransactionsBetweenQuery(expr string, vals []interface{}, from, until TxAfter, limit int) (string, []interface{}) {
+	var buf bytes.Buffer
+
+	buf.WriteString("SELECT block_height, tx_pos, data FROM annotated_txs AS txs")
+	buf.WriteString(" WHERE ")
+
+	// add filter conditions
+	if len(expr) > 0 {
+		buf.WriteString(expr)
+		buf.WriteString(" AND ")
+	}
+
+	buf.WriteString(fmt.Sprintf("(txs.block_height, txs.tx_pos) > ($%d, $%d) AND ", len(vals)+1, len(vals)+2))
+	buf.WriteString(fmt.Sprintf("(txs.block_height, txs.tx_pos) <= ($%d, $%d) ", len(vals)+3, len(vals)+4))
+	vals = append(vals, from.FromBlockHeight, from.FromPosition, until.FromBlockHeight, until.FromPosition)
+
+	buf.WriteString("ORDER BY txs.block_height ASC, txs.tx_pos ASC ")
+	buf.WriteString("LIMIT " + strconv.Itoa(limit))
+	return buf.String(), vals
+}
+
 // If asc is true, the transactions will be returned from "in front" of the `after`
 // param (e.g., the oldest transaction immediately after the `after` param,
 // followed by the second oldest, etc) in ascending order.
@@ -133,9 +181,11 @@ func constructTransactionsQuery(expr string, vals []interface{}, after TxAfter,
 }
 
 func (ind *Indexer) fetchTransactions(ctx context.Context, queryStr string, queryArgs []interface{}, after TxAfter, limit int) ([]*AnnotatedTx, *TxAfter, error) {
-	rows, err := ind.db.QueryContext(ctx, queryStr, queryArgs...)
+	ctx, cancel := queryContext(ctx, "list-transactions")
+	defer cancel()
+	rows, err := ind.reader(ctx).QueryContext(ctx, queryStr, queryArgs...)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "executing txn query")
+		return nil, nil, queryErr(ctx, errors.Wrap(err, "executing txn query"))
 	}
 	defer rows.Close()
 
@@ -155,7 +205,7 @@ func (ind *Indexer) fetchTransactions(ctx context.Context, queryStr string, quer
 	}
 	err = rows.Err()
 	if err != nil {
-		return nil, nil, errors.Wrap(err)
+		return nil, nil, queryErr(ctx, errors.Wrap(err))
 	}
 	return txns, &after, nil
 }
@@ -167,6 +217,10 @@ type fetchResp struct {
 }
 
 func (ind *Indexer) waitForAndFetchTransactions(ctx context.Context, queryStr string, queryArgs []interface{}, after TxAfter, limit int) ([]*AnnotatedTx, *TxAfter, error) {
+	// The pin waited on below tracks the primary database;
+	// a replica may not have the new transactions yet.
+	ctx = pg.NewPrimaryContext(ctx)
+
 	resp := make(chan fetchResp, 1)
 	go func() {
 		var (
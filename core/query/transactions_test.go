@@ -131,3 +131,30 @@ EXISTS(SELECT 1 FROM annotated_outputs AS out WHERE out."tx_hash" = txs."tx_hash
 		}
 	}
 }
+
+func TestConstructTransactionsBetweenQuery(t *testing.T) {
+	values := []interface{}{"acc123"}
+	f, err := filter.Parse(`outputs(account_id = $1)`, transactionsTable, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := filter.AsSQL(f, transactionsTable, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := TxAfter{FromBlockHeight: 2, FromPosition: 20, StopBlockHeight: 1}
+	until := TxAfter{FromBlockHeight: 9, FromPosition: 3, StopBlockHeight: 1}
+	query, gotValues := constructTransactionsBetweenQuery(expr, values, from, until, 100)
+
+	wantQuery := `SELECT block_height, tx_pos, data FROM annotated_txs AS txs WHERE 
+EXISTS(SELECT 1 FROM annotated_outputs AS out WHERE out."tx_hash" = txs."tx_hash" AND (out."account_id" = $1))
+ AND (txs.block_height, txs.tx_pos) > ($2, $3) AND (txs.block_height, txs.tx_pos) <= ($4, $5) ORDER BY txs.block_height ASC, txs.tx_pos ASC LIMIT 100`
+	if query != wantQuery {
+		t.Errorf("got\n%s\nwant\n%s", query, wantQuery)
+	}
+	wantValues := []interface{}{`acc123`, uint64(2), uint32(20), uint64(9), uint32(3)}
+	if !testutil.DeepEqual(gotValues, wantValues) {
+		t.Errorf("got %#v, want %#v", gotValues, wantValues)
+	}
+}
@@ -0,0 +1,180 @@
+// Package receipt issues signed receipts for confirmed
+// transactions.
+//
+// A receipt summarizes a transaction and the block that
+// confirmed it. It is signed with an Ed25519 key generated by
+// the core on first use, so anyone holding the core's receipt
+// public key can verify it without contacting the core.
+package receipt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"chain/core/query"
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Receipt summarizes a confirmed transaction.
+type Receipt struct {
+	TransactionID bc.Hash   `json:"transaction_id"`
+	BlockID       bc.Hash   `json:"block_id"`
+	BlockHeight   uint64    `json:"block_height"`
+	Timestamp     time.Time `json:"timestamp"`
+	Inputs        []Input   `json:"inputs"`
+	Outputs       []Output  `json:"outputs"`
+	IssuedAt      time.Time `json:"issued_at"`
+}
+
+// Input summarizes a transaction input.
+type Input struct {
+	Type          string     `json:"type"`
+	AssetID       bc.AssetID `json:"asset_id"`
+	Amount        uint64     `json:"amount"`
+	SpentOutputID *bc.Hash   `json:"spent_output_id,omitempty"`
+	AccountID     string     `json:"account_id,omitempty"`
+}
+
+// Output summarizes a transaction output.
+type Output struct {
+	Type           string             `json:"type"`
+	OutputID       bc.Hash            `json:"id"`
+	AssetID        bc.AssetID         `json:"asset_id"`
+	Amount         uint64             `json:"amount"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+	AccountID      string             `json:"account_id,omitempty"`
+}
+
+// Signed is a receipt and its signature. Receipt holds the
+// exact JSON bytes that were signed.
+type Signed struct {
+	Receipt   json.RawMessage    `json:"receipt"`
+	PublicKey chainjson.HexBytes `json:"public_key"`
+	Signature chainjson.HexBytes `json:"signature"`
+}
+
+// ErrBadSignature is returned by Verify for a receipt whose
+// signature doesn't match.
+var ErrBadSignature = errors.New("invalid receipt signature")
+
+// New returns a receipt for the confirmed transaction tx.
+func New(tx *query.AnnotatedTx) *Receipt {
+	r := &Receipt{
+		TransactionID: tx.ID,
+		BlockID:       tx.BlockID,
+		BlockHeight:   tx.BlockHeight,
+		Timestamp:     tx.Timestamp,
+		Inputs:        []Input{},  // send [], not null
+		Outputs:       []Output{}, // send [], not null
+	}
+	for _, in := range tx.Inputs {
+		r.Inputs = append(r.Inputs, Input{
+			Type:          in.Type,
+			AssetID:       in.AssetID,
+			Amount:        in.Amount,
+			SpentOutputID: in.SpentOutputID,
+			AccountID:     in.AccountID,
+		})
+	}
+	for _, out := range tx.Outputs {
+		r.Outputs = append(r.Outputs, Output{
+			Type:           out.Type,
+			OutputID:       out.OutputID,
+			AssetID:        out.AssetID,
+			Amount:         out.Amount,
+			ControlProgram: out.ControlProgram,
+			AccountID:      out.AccountID,
+		})
+	}
+	return r
+}
+
+// Verify checks the signature of s against pub, which should
+// be a receipt public key obtained from the core in advance,
+// and returns the receipt.
+func Verify(s *Signed, pub ed25519.PublicKey) (*Receipt, error) {
+	if !ed25519.Verify(pub, s.Receipt, s.Signature) {
+		return nil, errors.Wrap(ErrBadSignature)
+	}
+	r := new(Receipt)
+	err := json.Unmarshal(s.Receipt, r)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding receipt")
+	}
+	return r, nil
+}
+
+// Signer signs receipts with the core's receipt key.
+type Signer struct {
+	db pg.DB
+
+	mu  sync.Mutex
+	key ed25519.PrivateKey // loaded on first use
+}
+
+// NewSigner returns a new Signer using the given database.
+func NewSigner(db pg.DB) *Signer {
+	return &Signer{db: db}
+}
+
+// Sign sets the receipt's issue time and signs it.
+func (s *Signer) Sign(ctx context.Context, r *Receipt) (*Signed, error) {
+	key, err := s.privateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.IssuedAt = time.Now().UTC()
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return &Signed{
+		Receipt:   b,
+		PublicKey: chainjson.HexBytes(key.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(key, b),
+	}, nil
+}
+
+// PublicKey returns the core's receipt public key.
+func (s *Signer) PublicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	key, err := s.privateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// privateKey returns the receipt key, generating and storing
+// it if the core doesn't have one yet. If two processes race
+// to generate it, the first one stored wins.
+func (s *Signer) privateKey(ctx context.Context) (ed25519.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating receipt key")
+	}
+	const insertQ = `INSERT INTO receipt_key (private_key) VALUES ($1) ON CONFLICT DO NOTHING`
+	_, err = s.db.ExecContext(ctx, insertQ, []byte(priv))
+	if err != nil {
+		return nil, errors.Wrap(err, "storing receipt key")
+	}
+	var b []byte
+	err = s.db.QueryRowContext(ctx, `SELECT private_key FROM receipt_key`).Scan(&b)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading receipt key")
+	}
+	s.key = ed25519.PrivateKey(b)
+	return s.key, nil
+}
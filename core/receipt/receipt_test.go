@@ -0,0 +1,52 @@
+package receipt
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"chain/core/query"
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Signer{key: priv}
+
+	tx := &query.AnnotatedTx{
+		ID:          bc.NewHash([32]byte{1}),
+		BlockHeight: 7,
+		Timestamp:   time.Unix(1500000000, 0).UTC(),
+		Outputs: []*query.AnnotatedOutput{{
+			Type:     "control",
+			AssetID:  bc.AssetID{V0: 1},
+			Amount:   100,
+			OutputID: bc.NewHash([32]byte{2}),
+		}},
+	}
+	signed, err := s.Sign(context.Background(), New(tx))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	got, err := Verify(signed, pub)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.TransactionID != tx.ID || got.BlockHeight != 7 || len(got.Outputs) != 1 || got.Outputs[0].Amount != 100 {
+		t.Errorf("Verify() = %+v, want receipt for tx %x", got, tx.ID.Bytes())
+	}
+
+	signed.Receipt[len(signed.Receipt)-2] ^= 1
+	_, err = Verify(signed, pub)
+	if errors.Root(err) != ErrBadSignature {
+		t.Errorf("Verify(tampered receipt) error = %v, want %v", err, ErrBadSignature)
+	}
+}
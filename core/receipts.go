@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/receipt"
+	chainjson "chain/encoding/json"
+)
+
+// POST /get-transaction-receipt
+//
+// Returns a signed receipt for a confirmed transaction, as
+// portable proof of payment. Receipts can be verified offline
+// with the key from /get-receipt-public-key.
+func (a *API) getTransactionReceipt(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*receipt.Signed, error) {
+	tx, err := a.annotatedTx(ctx, x.ID)
+	if err != nil {
+		return nil, err
+	}
+	return a.receipts.Sign(ctx, receipt.New(tx))
+}
+
+// POST /get-receipt-public-key
+func (a *API) getReceiptPublicKey(ctx context.Context) (map[string]interface{}, error) {
+	pub, err := a.receipts.PublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"public_key": chainjson.HexBytes(pub)}, nil
+}
@@ -5,15 +5,43 @@ import (
 	"sync"
 	"time"
 
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/errors"
+	"chain/net/http/httpjson"
 	"chain/net/http/reqid"
+	"chain/protocol/bc"
 )
 
+type receiverRequest struct {
+	AccountID          string    `json:"account_id"`
+	AccountAlias       string    `json:"account_alias"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	ExpectedAssetID    string    `json:"expected_asset_id"`
+	ExpectedAssetAlias string    `json:"expected_asset_alias"`
+	ExpectedAmount     uint64    `json:"expected_amount"`
+}
+
+type receiverQuery struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+	After        string `json:"after"`
+	PageSize     int    `json:"page_size"`
+}
+
+// receiverPage is the response to /list-account-receivers.
+type receiverPage struct {
+	Items    []*account.ReceiverStatus `json:"items"`
+	Next     receiverQuery             `json:"next"`
+	LastPage bool                      `json:"last_page"`
+}
+
 // POST /create-account-receiver
-func (a *API) createAccountReceiver(ctx context.Context, ins []struct {
-	AccountID    string    `json:"account_id"`
-	AccountAlias string    `json:"account_alias"`
-	ExpiresAt    time.Time `json:"expires_at"`
-}) []interface{} {
+//
+// Receivers can optionally record the payment they expect, so
+// /list-account-receivers can report how much of it has been
+// received.
+func (a *API) createAccountReceiver(ctx context.Context, ins []receiverRequest) []interface{} {
 	responses := make([]interface{}, len(ins))
 	var wg sync.WaitGroup
 	wg.Add(len(responses))
@@ -24,7 +52,12 @@ func (a *API) createAccountReceiver(ctx context.Context, ins []struct {
 			defer wg.Done()
 			defer batchRecover(subctx, &responses[i])
 
-			receiver, err := a.accounts.CreateReceiver(subctx, ins[i].AccountID, ins[i].AccountAlias, ins[i].ExpiresAt)
+			expected, err := a.expectedPayment(subctx, ins[i])
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			receiver, err := a.accounts.CreateReceiverExpecting(subctx, ins[i].AccountID, ins[i].AccountAlias, ins[i].ExpiresAt, expected)
 			if err != nil {
 				responses[i] = err
 			} else {
@@ -36,3 +69,66 @@ func (a *API) createAccountReceiver(ctx context.Context, ins []struct {
 	wg.Wait()
 	return responses
 }
+
+// expectedPayment returns the payment the receiver requested
+// in x expects, or nil if it doesn't expect one.
+func (a *API) expectedPayment(ctx context.Context, x receiverRequest) (*bc.AssetAmount, error) {
+	if x.ExpectedAssetID == "" && x.ExpectedAssetAlias == "" {
+		if x.ExpectedAmount > 0 {
+			return nil, errors.Wrap(account.ErrBadExpectation)
+		}
+		return nil, nil
+	}
+	if x.ExpectedAssetID != "" && x.ExpectedAssetAlias != "" {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "expected_asset_id and expected_asset_alias cannot both be given")
+	}
+
+	var assetID bc.AssetID
+	if x.ExpectedAssetID != "" {
+		err := assetID.UnmarshalText([]byte(x.ExpectedAssetID))
+		if err != nil {
+			return nil, errors.WithDetailf(asset.ErrBadAssetID, "invalid expected_asset_id %q", x.ExpectedAssetID)
+		}
+	} else {
+		ast, err := a.assets.FindByAlias(ctx, x.ExpectedAssetAlias)
+		if err != nil {
+			return nil, errors.WithDetailf(err, "invalid expected_asset_alias %s", x.ExpectedAssetAlias)
+		}
+		assetID = ast.AssetID
+	}
+	return &bc.AssetAmount{AssetId: &assetID, Amount: x.ExpectedAmount}, nil
+}
+
+// POST /list-account-receivers
+//
+// Lists an account's receivers, newest first, along with
+// whether each has received funds.
+func (a *API) listAccountReceivers(ctx context.Context, in receiverQuery) (*receiverPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+
+	accountID, err := a.accountID(ctx, in.AccountID, in.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	receivers, err := a.accounts.ListReceivers(ctx, accountID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if receivers == nil {
+		receivers = []*account.ReceiverStatus{} // send [], not null
+	}
+
+	out := in
+	if len(receivers) > 0 {
+		out.After = receivers[len(receivers)-1].ID
+	}
+	return &receiverPage{
+		Items:    receivers,
+		Next:     out,
+		LastPage: len(receivers) < limit,
+	}, nil
+}
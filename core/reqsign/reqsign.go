@@ -0,0 +1,224 @@
+// Package reqsign verifies HMAC signatures on API requests.
+//
+// An access token may be given a signing secret. Once it has
+// one, requests it authenticates to high-risk routes must be
+// signed with the secret, so a leaked token alone can't be
+// used to issue assets or delete data.
+//
+// A signed request carries three headers:
+//
+//	Chain-Request-Timestamp: <unix time in seconds>
+//	Chain-Request-Nonce:     <unique string, at most 64 bytes>
+//	Chain-Request-Signature: <hex HMAC-SHA256>
+//
+// The signature is computed over the timestamp, nonce,
+// method, path and body, each followed by a newline except
+// the body. Requests outside the timestamp window, or
+// reusing a nonce, are refused.
+package reqsign
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// Request headers carrying the signature.
+const (
+	TimestampHeader = "Chain-Request-Timestamp"
+	NonceHeader     = "Chain-Request-Nonce"
+	SignatureHeader = "Chain-Request-Signature"
+)
+
+const (
+	secretSize   = 32
+	maxNonceSize = 64
+
+	// Window is how far a request's timestamp may be from
+	// the core's clock. Nonces are remembered for twice as
+	// long, so a request can't be replayed within its window.
+	Window = 5 * time.Minute
+)
+
+var (
+	// ErrUnsigned is returned for a request that must be
+	// signed but lacks a signature header.
+	ErrUnsigned = errors.New("request must be signed")
+	// ErrBadSignature is returned for a request whose
+	// signature doesn't match its contents.
+	ErrBadSignature = errors.New("invalid request signature")
+	// ErrStale is returned for a signed request whose
+	// timestamp is malformed or outside Window.
+	ErrStale = errors.New("request timestamp out of range")
+	// ErrReplay is returned for a signed request reusing a
+	// nonce seen before.
+	ErrReplay = errors.New("request nonce already used")
+)
+
+// Secret is an access token's signing secret.
+type Secret struct {
+	AccessTokenID string    `json:"access_token_id"`
+	Secret        string    `json:"secret,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Verifier stores signing secrets and checks signatures.
+type Verifier struct {
+	db pg.DB
+}
+
+// NewVerifier returns a Verifier storing its secrets and
+// nonces in db.
+func NewVerifier(db pg.DB) *Verifier {
+	return &Verifier{db: db}
+}
+
+// CreateSecret generates a new signing secret for the access
+// token with the given ID, replacing any it had. The secret
+// is returned hex-encoded; it can't be retrieved again.
+func (v *Verifier) CreateSecret(ctx context.Context, tokenID string) (*Secret, error) {
+	var secret [secretSize]byte
+	_, err := rand.Read(secret[:])
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	const q = `
+		INSERT INTO request_signing_secrets (access_token_id, secret)
+		SELECT id, $2 FROM access_tokens WHERE id = $1
+		ON CONFLICT (access_token_id) DO UPDATE SET secret = excluded.secret, created_at = now()
+		RETURNING created_at
+	`
+	s := &Secret{AccessTokenID: tokenID, Secret: hex.EncodeToString(secret[:])}
+	err = v.db.QueryRowContext(ctx, q, tokenID, secret[:]).Scan(&s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "access token %s", tokenID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "storing signing secret")
+	}
+	return s, nil
+}
+
+// DeleteSecret deletes the signing secret of the access
+// token with the given ID, so its requests need no longer
+// be signed.
+func (v *Verifier) DeleteSecret(ctx context.Context, tokenID string) error {
+	const q = `DELETE FROM request_signing_secrets WHERE access_token_id = $1`
+	res, err := v.db.ExecContext(ctx, q, tokenID)
+	if err != nil {
+		return errors.Wrap(err, "deleting signing secret")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "signing secret for access token %s", tokenID)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded signature of a request with
+// the given contents.
+func Sign(secret []byte, timestamp, nonce, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, s := range []string{timestamp, nonce, method, path} {
+		mac.Write([]byte(s))
+		mac.Write([]byte{'\n'})
+	}
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature on req, whose body is body,
+// if the access token with the given ID has a signing
+// secret. Requests authenticated by tokens without one
+// need not be signed.
+func (v *Verifier) Verify(ctx context.Context, tokenID string, req *http.Request, body []byte) error {
+	// A secret created before its token belonged to an
+	// earlier token with the same ID, and no longer applies.
+	const q = `
+		SELECT s.secret FROM request_signing_secrets s
+		JOIN access_tokens t ON t.id = s.access_token_id
+		WHERE s.access_token_id = $1 AND s.created_at >= t.created
+	`
+	var secret []byte
+	err := v.db.QueryRowContext(ctx, q, tokenID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "loading signing secret")
+	}
+
+	ts, nonce, sig := req.Header.Get(TimestampHeader), req.Header.Get(NonceHeader), req.Header.Get(SignatureHeader)
+	if ts == "" || nonce == "" || sig == "" {
+		return errors.WithDetailf(ErrUnsigned, "access token %s requires the %s, %s and %s headers", tokenID, TimestampHeader, NonceHeader, SignatureHeader)
+	}
+	if len(nonce) > maxNonceSize {
+		return errors.WithDetailf(ErrBadSignature, "nonce is longer than %d bytes", maxNonceSize)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.WithDetailf(ErrStale, "timestamp %q is not a unix time", ts)
+	}
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > Window || skew < -Window {
+		return errors.WithDetailf(ErrStale, "timestamp is %s from the core's clock; at most %s is allowed", skew, Window)
+	}
+
+	want := Sign(secret, ts, nonce, req.Method, req.URL.Path, body)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return errors.WithDetail(ErrBadSignature, "signature does not match the request")
+	}
+
+	const nonceQ = `
+		INSERT INTO request_nonces (access_token_id, nonce, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+	res, err := v.db.ExecContext(ctx, nonceQ, tokenID, nonce, time.Now().Add(2*Window))
+	if err != nil {
+		return errors.Wrap(err, "recording nonce")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(ErrReplay, "nonce %q", nonce)
+	}
+	return nil
+}
+
+// Prune periodically deletes expired nonces, and the
+// secrets of deleted access tokens, until ctx is done.
+func (v *Verifier) Prune(ctx context.Context, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			const q = `
+				DELETE FROM request_nonces WHERE expires_at < now();
+				DELETE FROM request_signing_secrets s
+				WHERE NOT EXISTS (SELECT 1 FROM access_tokens WHERE id = s.access_token_id);
+			`
+			_, err := v.db.ExecContext(ctx, q)
+			if err != nil {
+				log.Error(ctx, errors.Wrap(err, "pruning request signing data"))
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package reqsign
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"chain/core/accesstoken"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	sig := Sign(secret, "1500000000", "n1", "POST", "/submit-transaction", []byte(`{}`))
+	for _, other := range []string{
+		Sign(secret, "1500000001", "n1", "POST", "/submit-transaction", []byte(`{}`)),
+		Sign(secret, "1500000000", "n2", "POST", "/submit-transaction", []byte(`{}`)),
+		Sign(secret, "1500000000", "n1", "POST", "/transfer", []byte(`{}`)),
+		Sign(secret, "1500000000", "n1", "POST", "/submit-transaction", []byte(`[]`)),
+		Sign([]byte("other"), "1500000000", "n1", "POST", "/submit-transaction", []byte(`{}`)),
+	} {
+		if other == sig {
+			t.Errorf("signatures of different requests are both %s", sig)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	tokens := &accesstoken.CredentialStore{DB: db}
+	v := NewVerifier(db)
+
+	_, err := tokens.Create(ctx, "alice", "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	body := []byte(`{"id":"feed1"}`)
+	req := httptest.NewRequest("POST", "/delete-transaction-feed", bytes.NewReader(body))
+
+	// Tokens without a secret needn't sign.
+	err = v.Verify(ctx, "alice", req, body)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	s, err := v.CreateSecret(ctx, "alice")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	secret, err := hex.DecodeString(s.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Verify(ctx, "alice", req, body)
+	if errors.Root(err) != ErrUnsigned {
+		t.Errorf("Verify(unsigned) error = %v, want %v", err, ErrUnsigned)
+	}
+
+	sign := func(ts time.Time, nonce string) {
+		unix := strconv.FormatInt(ts.Unix(), 10)
+		req.Header.Set(TimestampHeader, unix)
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set(SignatureHeader, Sign(secret, unix, nonce, req.Method, req.URL.Path, body))
+	}
+
+	sign(time.Now(), "n1")
+	err = v.Verify(ctx, "alice", req, body)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = v.Verify(ctx, "alice", req, body)
+	if errors.Root(err) != ErrReplay {
+		t.Errorf("Verify(replayed) error = %v, want %v", err, ErrReplay)
+	}
+	err = v.Verify(ctx, "alice", req, []byte(`{"id":"feed2"}`))
+	if errors.Root(err) != ErrBadSignature {
+		t.Errorf("Verify(altered body) error = %v, want %v", err, ErrBadSignature)
+	}
+
+	sign(time.Now().Add(-2*Window), "n2")
+	err = v.Verify(ctx, "alice", req, body)
+	if errors.Root(err) != ErrStale {
+		t.Errorf("Verify(stale) error = %v, want %v", err, ErrStale)
+	}
+
+	err = v.DeleteSecret(ctx, "alice")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	req.Header.Del(SignatureHeader)
+	err = v.Verify(ctx, "alice", req, body)
+	if err != nil {
+		t.Errorf("Verify(after DeleteSecret) error = %v, want nil", err)
+	}
+}
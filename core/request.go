@@ -3,8 +3,11 @@ package core
 import (
 	"context"
 
+	"chain/core/addressbook"
+	"chain/core/asset"
 	"chain/encoding/json"
 	"chain/errors"
+	"chain/protocol/bc"
 	"chain/protocol/bc/legacy"
 )
 
@@ -32,6 +35,11 @@ func (a *API) filterAliases(ctx context.Context, br *buildRequest) error {
 			m["asset_id"] = asset.AssetID
 		}
 
+		err := a.decimalAmount(ctx, m)
+		if err != nil {
+			return errors.WithDetailf(err, "%s on action %d", errors.Detail(err), i)
+		}
+
 		id, _ = m["account_id"].(string)
 		alias, _ = m["account_alias"].(string)
 		if id == "" && alias != "" {
@@ -41,6 +49,49 @@ func (a *API) filterAliases(ctx context.Context, br *buildRequest) error {
 			}
 			m["account_id"] = acc.ID
 		}
+
+		prog, _ := m["control_program"].(string)
+		alias, _ = m["address_alias"].(string)
+		if prog == "" && alias != "" {
+			cp, err := addressbook.ControlProgram(ctx, a.db, alias)
+			if err != nil {
+				return errors.WithDetailf(err, "invalid address alias %s on action %d", alias, i)
+			}
+			m["control_program"] = json.HexBytes(cp)
+		}
+	}
+	return nil
+}
+
+// decimalAmount replaces the decimal_amount field of action m,
+// such as "1.25", with the amount it represents in units of the
+// action's asset. The asset must declare its decimals, and the
+// amount can't have more decimal places than it allows.
+func (a *API) decimalAmount(ctx context.Context, m map[string]interface{}) error {
+	s, ok := m["decimal_amount"].(string)
+	if !ok {
+		return nil
+	}
+	if _, ok := m["amount"]; ok {
+		return errors.WithDetail(errBadAction, "amount and decimal_amount are mutually exclusive")
+	}
+	var assetID bc.AssetID
+	switch id := m["asset_id"].(type) {
+	case bc.AssetID:
+		assetID = id
+	case string:
+		err := assetID.UnmarshalText([]byte(id))
+		if err != nil {
+			return errors.WithDetail(asset.ErrBadAssetID, "invalid asset_id")
+		}
+	default:
+		return errors.WithDetail(errBadAction, "decimal_amount requires an asset_id or asset_alias")
+	}
+	amount, err := a.assets.DecimalAmount(ctx, assetID, s)
+	if err != nil {
+		return err
 	}
+	m["amount"] = amount
+	delete(m, "decimal_amount")
 	return nil
 }
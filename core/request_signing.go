@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"chain/core/reqsign"
+	"chain/errors"
+	"chain/net/http/authn"
+)
+
+const pruneSignaturesPeriod = time.Hour
+
+// signedRoutes are the high-risk routes whose requests must
+// be signed when they are authenticated by an access token
+// with a signing secret. They include the routes that create
+// credentials, so a leaked token can't be used to mint an
+// unsigned one.
+var signedRoutes = map[string]bool{
+	"/submit-transaction":              true,
+	"/transfer":                        true,
+	"/create-asset":                    true,
+	"/create-access-token":             true,
+	"/create-authorization-grant":      true,
+	"/create-service-account-token":    true,
+	"/update-service-account-policies": true,
+	"/create-request-signing-secret":   true,
+	"/create-service-account":          true,
+	"/create-invitation":               true,
+	"/resend-invitation":               true,
+	"/reset":                           true,
+	"/delete-transaction-feed":         true,
+	"/delete-freeze":                   true,
+	"/delete-address-book-entry":       true,
+	"/delete-rule":                     true,
+	"/delete-service-account":          true,
+	"/delete-authorization-grant":      true,
+	"/delete-access-token":             true,
+	"/delete-request-signing-secret":   true,
+	"/delete-counterparty":             true,
+	"/delete-payment-pointer":          true,
+	"/delete-ilp-peer":                 true,
+}
+
+// verifySignature refuses requests to h that are
+// authenticated by an access token with a signing secret
+// but aren't correctly signed with it.
+func (a *API) verifySignature(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		tokenID := authn.Token(ctx)
+		if tokenID == "" {
+			// Authenticated some other way, such as by a
+			// client certificate.
+			h.ServeHTTP(w, req)
+			return
+		}
+		var body bytes.Buffer
+		_, err := body.ReadFrom(req.Body)
+		if err != nil {
+			errorFormatter.Write(ctx, w, errors.Wrap(err, "reading request body"))
+			return
+		}
+		err = a.signatures.Verify(ctx, tokenID, req, body.Bytes())
+		if err != nil {
+			errorFormatter.Write(ctx, w, err)
+			return
+		}
+		req.Body = ioutil.NopCloser(&body)
+		h.ServeHTTP(w, req)
+	})
+}
+
+// POST /create-request-signing-secret
+//
+// Creates a signing secret for an access token, replacing
+// any it had. From then on, requests the token authenticates
+// to high-risk routes must be signed with it. The response
+// includes the secret, which can't be retrieved again.
+func (a *API) createRequestSigningSecret(ctx context.Context, x struct {
+	AccessTokenID string `json:"access_token_id"`
+}) (*reqsign.Secret, error) {
+	return a.signatures.CreateSecret(ctx, x.AccessTokenID)
+}
+
+// POST /delete-request-signing-secret
+//
+// Deletes an access token's signing secret, so its requests
+// need no longer be signed.
+func (a *API) deleteRequestSigningSecret(ctx context.Context, x struct {
+	AccessTokenID string `json:"access_token_id"`
+}) error {
+	return a.signatures.DeleteSecret(ctx, x.AccessTokenID)
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+// credentialRoutes issue credentials, or destroy data, without
+// matching the /create-*-token or /delete-* patterns.
+var credentialRoutes = []string{
+	"/create-access-token",
+	"/create-authorization-grant",
+	"/create-request-signing-secret",
+	"/create-service-account",
+	"/create-invitation",
+	"/resend-invitation",
+	"/update-service-account-policies",
+	"/reset",
+}
+
+func TestSignedRoutes(t *testing.T) {
+	for route := range policyByRoute {
+		high := strings.HasPrefix(route, "/delete-") ||
+			strings.HasPrefix(route, "/create-") && strings.HasSuffix(route, "-token")
+		if high && !signedRoutes[route] {
+			t.Errorf("route %s is not in signedRoutes", route)
+		}
+	}
+	for _, route := range credentialRoutes {
+		if _, ok := policyByRoute[route]; !ok {
+			t.Errorf("credential route %s has no policy", route)
+		}
+		if !signedRoutes[route] {
+			t.Errorf("credential route %s is not in signedRoutes", route)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"chain/core/retention"
+	"chain/errors"
+)
+
+const pruneRetentionPeriod = time.Hour
+
+// cleanRetentionPolicy validates and canonicalizes a
+// retention tuple of (table, days, action).
+func cleanRetentionPolicy(tup []string) error {
+	if !retention.ValidTable(tup[0]) {
+		return errors.WithDetailf(errBadConfigValue, "Retention table must be one of %s.", strings.Join(retention.Tables(), ", "))
+	}
+	days, err := strconv.Atoi(tup[1])
+	if err != nil || days <= 0 {
+		return errors.WithDetailf(errBadConfigValue, "Retention days must be a positive integer.")
+	}
+	if tup[2] != retention.Delete && tup[2] != retention.Archive {
+		return errors.WithDetailf(errBadConfigValue, "Retention action must be %s or %s.", retention.Delete, retention.Archive)
+	}
+	tup[1] = strconv.Itoa(days)
+	return nil
+}
+
+// cleanRetentionArchiveDir validates a retention_archive_dir
+// tuple.
+func cleanRetentionArchiveDir(tup []string) error {
+	if !filepath.IsAbs(tup[0]) {
+		return errors.WithDetailf(errBadConfigValue, "Retention archive directory must be an absolute path.")
+	}
+	tup[0] = filepath.Clean(tup[0])
+	return nil
+}
+
+// retentionOption converts a closure returned by
+// config.Options.ListFunc for retention into one returning
+// retention policies.
+func retentionOption(list func() [][]string) func() []retention.Policy {
+	return func() []retention.Policy {
+		var policies []retention.Policy
+		for _, tup := range list() {
+			days, _ := strconv.Atoi(tup[1]) // validated when set
+			policies = append(policies, retention.Policy{Table: tup[0], Days: days, Action: tup[2]})
+		}
+		return policies
+	}
+}
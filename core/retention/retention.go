@@ -0,0 +1,275 @@
+// Package retention prunes old activity and audit records.
+//
+// A policy names a table, how many days its records are kept,
+// and whether expired records are archived or just deleted.
+// Only records that are finished with, such as delivered
+// webhook events and decided held transactions, ever expire.
+// Archived records are written to gzipped JSON Lines files
+// before they're deleted, so an archive may hold a record
+// that a failed run didn't manage to delete, but never lacks
+// one that was deleted.
+//
+// Records are deleted in small batches, so pruning a large
+// backlog doesn't hold long locks or produce one huge
+// transaction for autovacuum to clean up after.
+//
+// The transaction index, annotated_txs and annotated_outputs,
+// is never pruned. Balances at past times, balance deltas,
+// journal entries and account statements are all computed
+// from it, so pruning it would silently change their answers
+// for old ranges rather than fail. Its growth is bounded only
+// by disabling the index with INDEX_TRANSACTIONS=false, or by
+// bootstrapping a new core from a ledger snapshot.
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// Actions.
+const (
+	Delete  = "delete"
+	Archive = "archive"
+)
+
+const batchSize = 1000
+
+// ErrNoArchiveDir is returned when archiving without an
+// archive directory configured.
+var ErrNoArchiveDir = errors.New("no retention archive directory")
+
+// Policy is how long the expired records of a table are
+// kept, and what's done with them after.
+type Policy struct {
+	Table  string `json:"table"`
+	Days   int    `json:"days"`
+	Action string `json:"action"`
+}
+
+// table describes a table policies may apply to.
+type table struct {
+	// key is an expression uniquely identifying a record.
+	key string
+	// done is a condition true of records that are finished
+	// with, and may expire.
+	done string
+}
+
+var tables = map[string]table{
+	"held_transactions": {
+		key:  "id",
+		done: "status <> 'pending'",
+	},
+	"invitations": {
+		key:  "id",
+		done: "accepted_at IS NOT NULL OR revoked_at IS NOT NULL OR expires_at < now()",
+	},
+	"payment_request_events": {
+		key:  "id",
+		done: "delivered_at IS NOT NULL",
+	},
+	"rule_matches": {
+		key:  "id",
+		done: "action <> 'webhook' OR delivered_at IS NOT NULL",
+	},
+	"usage_warnings": {
+		key:  "(day, metric, level)",
+		done: "delivered_at IS NOT NULL",
+	},
+}
+
+// Tables returns the names of the tables policies may apply
+// to, in order.
+func Tables() []string {
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidTable reports whether policies may apply to the
+// table with the given name.
+func ValidTable(name string) bool {
+	_, ok := tables[name]
+	return ok
+}
+
+// Pruner applies retention policies.
+type Pruner struct {
+	db         pg.DB
+	policies   func() []Policy
+	archiveDir func() string
+}
+
+// NewPruner returns a new Pruner using the given database.
+func NewPruner(db pg.DB) *Pruner {
+	return &Pruner{
+		db:         db,
+		policies:   func() []Policy { return nil },
+		archiveDir: func() string { return "" },
+	}
+}
+
+// SetPolicies makes the pruner call f to find the policies.
+// It must be called before the pruner is used.
+func (p *Pruner) SetPolicies(f func() []Policy) {
+	p.policies = f
+}
+
+// SetArchiveDir makes the pruner call f to find the
+// directory archives are written to.
+// It must be called before the pruner is used.
+func (p *Pruner) SetArchiveDir(f func() string) {
+	p.archiveDir = f
+}
+
+// Run applies the policies once per period until ctx is
+// done. It should run only on the leader.
+func (p *Pruner) Run(ctx context.Context, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, Pruner exiting")
+			return
+		case <-ticks:
+			for _, pol := range p.policies() {
+				n, err := p.Apply(ctx, pol)
+				if err != nil {
+					log.Error(ctx, err, "applying retention policy for "+pol.Table)
+				}
+				if n > 0 {
+					log.Printkv(ctx, "at", "retention", "table", pol.Table, "action", pol.Action, "records", n)
+				}
+			}
+		}
+	}
+}
+
+// Apply archives or deletes the records pol expires,
+// returning how many it removed.
+func (p *Pruner) Apply(ctx context.Context, pol Policy) (int, error) {
+	t, ok := tables[pol.Table]
+	if !ok {
+		return 0, errors.New("unknown table " + pol.Table)
+	}
+	cutoff := time.Now().AddDate(0, 0, -pol.Days)
+	var total int
+	for {
+		var (
+			n   int
+			err error
+		)
+		if pol.Action == Archive {
+			n, err = p.archiveBatch(ctx, pol.Table, t, cutoff)
+		} else {
+			n, err = p.deleteBatch(ctx, pol.Table, t, cutoff)
+		}
+		total += n
+		if err != nil || n < batchSize {
+			return total, err
+		}
+	}
+}
+
+func (p *Pruner) deleteBatch(ctx context.Context, name string, t table, cutoff time.Time) (int, error) {
+	q := fmt.Sprintf(`
+		DELETE FROM %[1]s WHERE ctid = ANY(ARRAY(
+			SELECT ctid FROM %[1]s
+			WHERE created_at < $1 AND (%[2]s)
+			LIMIT $2
+		))
+	`, name, t.done)
+	res, err := p.db.ExecContext(ctx, q, cutoff, batchSize)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting from "+name)
+	}
+	n, err := res.RowsAffected()
+	return int(n), errors.Wrap(err)
+}
+
+// archiveBatch writes a batch of expired records to a new
+// archive file, then deletes them.
+func (p *Pruner) archiveBatch(ctx context.Context, name string, t table, cutoff time.Time) (int, error) {
+	dir := p.archiveDir()
+	if dir == "" {
+		return 0, errors.WithDetailf(ErrNoArchiveDir, "can't archive %s", name)
+	}
+
+	q := fmt.Sprintf(`
+		SELECT %[2]s::text, row_to_json(%[1]s)::text FROM %[1]s
+		WHERE created_at < $1 AND (%[3]s)
+		ORDER BY created_at
+		LIMIT $2
+	`, name, t.key, t.done)
+	var keys, records []string
+	err := pg.ForQueryRows(ctx, p.db, q, cutoff, batchSize, func(key, record string) {
+		keys = append(keys, key)
+		records = append(records, record)
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "reading from "+name)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	err = writeArchive(filepath.Join(dir, fmt.Sprintf("%s-%s.jsonl.gz", name, time.Now().UTC().Format("20060102T150405.000000000Z"))), records)
+	if err != nil {
+		return 0, err
+	}
+
+	q = fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s::text = ANY($1) AND (%[3]s)`, name, t.key, t.done)
+	res, err := p.db.ExecContext(ctx, q, pq.StringArray(keys))
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting from "+name)
+	}
+	n, err := res.RowsAffected()
+	return int(n), errors.Wrap(err)
+}
+
+// writeArchive durably writes records, one per line, to a
+// gzipped file at path. The file appears only once it's
+// complete.
+func writeArchive(path string, records []string) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrap(err, "creating archive")
+	}
+	defer os.Remove(tmp) // no-op once renamed
+
+	zw := gzip.NewWriter(f)
+	for _, r := range records {
+		_, err = zw.Write([]byte(r + "\n"))
+		if err != nil {
+			f.Close()
+			return errors.Wrap(err, "writing archive")
+		}
+	}
+	err = zw.Close()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing archive")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "writing archive")
+}
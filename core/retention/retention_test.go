@@ -0,0 +1,110 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/testutil"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.jsonl.gz")
+	want := []string{`{"id":"a"}`, `{"id":"b"}`}
+	err = writeArchive(path, want)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got := readArchive(t, path)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archive = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	dir, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := NewPruner(db)
+	p.SetArchiveDir(func() string { return dir })
+
+	const q = `
+		INSERT INTO usage_warnings (day, metric, level, value, quota, created_at, delivered_at) VALUES
+			('2017-01-01', 'requests', 'soft', 10, 5, '2017-01-01', '2017-01-01'),
+			('2017-01-01', 'requests', 'hard', 20, 15, '2017-01-01', NULL),
+			('2017-01-02', 'requests', 'soft', 10, 5, now(), now())
+	`
+	_, err = db.ExecContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := p.Apply(ctx, Policy{Table: "usage_warnings", Days: 30, Action: Archive})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if n != 1 {
+		t.Errorf("Apply() = %d, want 1 (only the old, delivered warning)", n)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "usage_warnings-*.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("archives = %v, want 1", files)
+	}
+	if got := readArchive(t, files[0]); len(got) != 1 {
+		t.Errorf("archived records = %v, want 1", got)
+	}
+
+	var remaining int
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM usage_warnings`).Scan(&remaining)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 2 {
+		t.Errorf("remaining warnings = %d, want 2", remaining)
+	}
+}
+
+func readArchive(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	s := bufio.NewScanner(zr)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
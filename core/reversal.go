@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"chain/core/leader"
+	"chain/core/query"
+	"chain/database/pg"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/reqid"
+	"chain/protocol/bc/legacy"
+)
+
+var errNotReversible = errors.New("transaction cannot be reversed")
+
+type reversalRequest struct {
+	TransactionID string        `json:"transaction_id"`
+	TTL           json.Duration `json:"ttl"`
+}
+
+// POST /build-reversal
+//
+// Builds compensating transactions that undo earlier
+// transactions. Each reversal spends the outputs the original
+// transaction created and pays them back to where its inputs
+// came from: issued amounts are retired, and spent amounts
+// return to the original account or control program. The
+// reversal's reference data records the original transaction
+// ID as reversal_of, so it can be found with the filter
+// "reference_data.reversal_of=$1".
+//
+// A transaction can only be reversed if all of its outputs are
+// unspent and controlled by accounts in this core. The
+// returned templates must be signed and submitted like any
+// other.
+func (a *API) buildReversal(ctx context.Context, reqs []*reversalRequest) (interface{}, error) {
+	// Like /build-transaction, reserving the outputs to spend
+	// must happen on the leader.
+	if a.leader.State() != leader.Leading {
+		var resp interface{}
+		err := a.forwardToLeader(ctx, "/build-reversal", reqs, &resp)
+		return resp, err
+	}
+
+	responses := make([]interface{}, len(reqs))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			actions, err := a.reversalActions(subctx, reqs[i].TransactionID)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			tmpl, err := a.buildSingle(subctx, &buildRequest{Actions: actions, TTL: reqs[i].TTL})
+			if err != nil {
+				responses[i] = err
+			} else {
+				responses[i] = tmpl
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return responses, nil
+}
+
+// reversalActions returns the build actions for a transaction
+// that reverses the transaction with the given ID.
+func (a *API) reversalActions(ctx context.Context, txID string) ([]map[string]interface{}, error) {
+	tx, err := a.annotatedTx(ctx, txID)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []map[string]interface{}
+	for i, out := range tx.Outputs {
+		if out.Type == "retire" {
+			return nil, errors.WithDetailf(errNotReversible, "output %d was retired", i)
+		}
+		if out.AccountID == "" {
+			return nil, errors.WithDetailf(errNotReversible, "output %d is not controlled by an account in this core", i)
+		}
+		actions = append(actions, map[string]interface{}{
+			"type":      "spend_account_unspent_output",
+			"output_id": out.OutputID,
+		})
+	}
+
+	// Annotated inputs don't record the control programs they
+	// spent from, so read them from the original transaction.
+	var orig *legacy.Tx
+	for i, in := range tx.Inputs {
+		switch {
+		case in.Type == "issue":
+			actions = append(actions, map[string]interface{}{
+				"type":     "retire",
+				"asset_id": in.AssetID,
+				"amount":   in.Amount,
+			})
+		case in.AccountID != "":
+			actions = append(actions, map[string]interface{}{
+				"type":       "control_account",
+				"account_id": in.AccountID,
+				"asset_id":   in.AssetID,
+				"amount":     in.Amount,
+			})
+		default:
+			if orig == nil {
+				orig, err = a.originalTx(ctx, tx)
+				if err != nil {
+					return nil, err
+				}
+			}
+			actions = append(actions, map[string]interface{}{
+				"type":            "control_program",
+				"control_program": json.HexBytes(orig.Inputs[i].ControlProgram()),
+				"asset_id":        in.AssetID,
+				"amount":          in.Amount,
+			})
+		}
+	}
+
+	actions = append(actions, map[string]interface{}{
+		"type":           "set_transaction_reference_data",
+		"reference_data": map[string]interface{}{"reversal_of": tx.ID},
+	})
+	return actions, nil
+}
+
+// annotatedTx returns the indexed transaction with the given ID.
+func (a *API) annotatedTx(ctx context.Context, txID string) (*query.AnnotatedTx, error) {
+	after, err := a.indexer.LookupTxAfter(ctx, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	txs, _, err := a.indexer.Transactions(ctx, "id=$1", []interface{}{txID}, after, 1, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up transaction")
+	}
+	if len(txs) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "transaction %s not found", txID)
+	}
+	return txs[0], nil
+}
+
+// originalTx reads the transaction tx from the blockchain.
+func (a *API) originalTx(ctx context.Context, tx *query.AnnotatedTx) (*legacy.Tx, error) {
+	b, err := a.chain.GetBlock(ctx, tx.BlockHeight)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting block")
+	}
+	if int(tx.Position) >= len(b.Transactions) {
+		return nil, errors.Wrapf(errNotReversible, "transaction %x not in block %d", tx.ID.Bytes(), tx.BlockHeight)
+	}
+	return b.Transactions[tx.Position], nil
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/generator"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+)
+
+func TestReversalActions(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	g := generator.New(c, nil, db)
+	pinStore := pin.NewStore(db)
+	coretest.CreatePins(ctx, t, pinStore)
+	indexer := query.NewIndexer(db, c, pinStore)
+	assets := asset.NewRegistry(db, c, pinStore)
+	accounts := account.NewManager(db, c, pinStore)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	indexer.RegisterAnnotator(assets.AnnotateTxs)
+	indexer.RegisterAnnotator(accounts.AnnotateTxs)
+	go assets.ProcessBlocks(ctx)
+	go accounts.ProcessBlocks(ctx)
+	go indexer.ProcessBlocks(ctx)
+	api := &API{db: db, chain: c, indexer: indexer, assets: assets, accounts: accounts}
+
+	alice := coretest.CreateAccount(ctx, t, accounts, "", nil)
+	bob := coretest.CreateAccount(ctx, t, accounts, "", nil)
+	assetID := coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, assetID, 100, alice)
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	assetAmt := bc.AssetAmount{AssetId: &assetID, Amount: 100}
+	tx := coretest.Transfer(ctx, t, c, g, []txbuilder.Action{
+		accounts.NewSpendAction(assetAmt, alice, nil, nil),
+		accounts.NewControlAction(assetAmt, bob, nil),
+	})
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(query.TxPinName, c.Height())
+
+	actions, err := api.reversalActions(ctx, hex.EncodeToString(tx.ID.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 3 {
+		t.Fatalf("got %d actions, want 3: %v", len(actions), actions)
+	}
+	if actions[0]["type"] != "spend_account_unspent_output" {
+		t.Errorf("action 0 type = %v, want spend_account_unspent_output", actions[0]["type"])
+	}
+	if actions[1]["type"] != "control_account" || actions[1]["account_id"] != alice || actions[1]["amount"] != uint64(100) {
+		t.Errorf("action 1 = %v, want control_account of 100 to %s", actions[1], alice)
+	}
+	if actions[2]["type"] != "set_transaction_reference_data" {
+		t.Errorf("action 2 type = %v, want set_transaction_reference_data", actions[2]["type"])
+	}
+
+	_, err = api.reversalActions(ctx, hex.EncodeToString(bc.Hash{}.Bytes()))
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("reversing a missing transaction: got error %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+}
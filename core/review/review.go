@@ -0,0 +1,244 @@
+// Package review implements a queue of transactions held
+// for manual review before they are submitted.
+//
+// Transactions are held by compliance screening or by
+// activity rules. Each held transaction is pending until a
+// reviewer approves it, after which it is submitted, or
+// rejects it with a reason.
+package review
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+// Review statuses.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Sources of held transactions.
+const (
+	SourceScreening = "screening"
+	SourceRules     = "rules"
+)
+
+var (
+	// ErrBadStatus is returned by List for an unknown status.
+	ErrBadStatus = errors.New("status must be pending, approved or rejected")
+
+	// ErrReviewed is returned when approving or rejecting
+	// a transaction that has already been reviewed.
+	ErrReviewed = errors.New("held transaction has already been reviewed")
+
+	// ErrNoReason is returned when rejecting a transaction
+	// without a reason.
+	ErrNoReason = errors.New("a reason is required to reject a transaction")
+)
+
+// Item is a transaction held for review.
+type Item struct {
+	ID            string         `json:"id"`
+	TransactionID bc.Hash        `json:"transaction_id"`
+	Transaction   *legacy.TxData `json:"raw_transaction"`
+	Source        string         `json:"source"`
+	Reason        string         `json:"reason"`
+	Status        string         `json:"status"`
+	ReviewReason  string         `json:"review_reason,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	ReviewedAt    *time.Time     `json:"reviewed_at,omitempty"`
+}
+
+// Stats summarizes the review queue. Ages are measured from
+// when each pending transaction was held.
+type Stats struct {
+	Pending           int     `json:"pending"`
+	Approved          int     `json:"approved"`
+	Rejected          int     `json:"rejected"`
+	OldestPendingAge  float64 `json:"oldest_pending_age_seconds"`
+	AveragePendingAge float64 `json:"average_pending_age_seconds"`
+}
+
+// Queue stores transactions held for review.
+type Queue struct {
+	db pg.DB
+}
+
+// NewQueue returns a new Queue using the given database.
+func NewQueue(db pg.DB) *Queue {
+	return &Queue{db: db}
+}
+
+// Hold adds tx to the queue, held by source for the given
+// reason. Holding a pending transaction again updates its
+// source and reason and returns the existing item; a
+// transaction that has been reviewed keeps its review.
+func (q *Queue) Hold(ctx context.Context, tx *legacy.Tx, source, reason string) (*Item, error) {
+	raw, err := tx.TxData.MarshalText()
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling transaction")
+	}
+	const insertQ = `
+		INSERT INTO held_transactions (tx_hash, raw_transaction, source, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tx_hash) DO UPDATE SET source = excluded.source, reason = excluded.reason
+			WHERE held_transactions.status = 'pending'
+		RETURNING id
+	`
+	var id string
+	err = q.db.QueryRowContext(ctx, insertQ, tx.ID, string(raw), source, reason).Scan(&id)
+	if err == sql.ErrNoRows {
+		return q.findByHash(ctx, tx.ID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "holding transaction")
+	}
+	return q.Find(ctx, id)
+}
+
+const selectQ = `
+	SELECT id, raw_transaction, source, reason, status,
+		COALESCE(review_reason, ''), created_at, reviewed_at
+	FROM held_transactions
+`
+
+// Find returns the held transaction with the given ID.
+func (q *Queue) Find(ctx context.Context, id string) (*Item, error) {
+	items, err := q.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "held transaction %s not found", id)
+	}
+	return items[0], nil
+}
+
+func (q *Queue) findByHash(ctx context.Context, txHash bc.Hash) (*Item, error) {
+	items, err := q.query(ctx, selectQ+`WHERE tx_hash = $1`, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "held transaction %x not found", txHash.Bytes())
+	}
+	return items[0], nil
+}
+
+// List returns up to limit held transactions, oldest first.
+// If status is non-empty, only items with that status are
+// returned. Items with IDs less than or equal to after are
+// skipped; pass the ID of the last item returned to get the
+// next page, or "" to get the first.
+func (q *Queue) List(ctx context.Context, status, after string, limit int) ([]*Item, error) {
+	switch status {
+	case "", StatusPending, StatusApproved, StatusRejected:
+	default:
+		return nil, errors.WithDetailf(ErrBadStatus, "unknown status %q", status)
+	}
+	const where = `
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`
+	return q.query(ctx, selectQ+where, status, after, limit)
+}
+
+func (q *Queue) query(ctx context.Context, query string, args ...interface{}) ([]*Item, error) {
+	var items []*Item
+	err := pg.ForQueryRows(ctx, q.db, query, append(args, func(
+		id, raw, source, reason, status, reviewReason string, createdAt time.Time, reviewedAt pq.NullTime,
+	) error {
+		tx := new(legacy.Tx)
+		err := tx.UnmarshalText([]byte(raw))
+		if err != nil {
+			return errors.Wrap(err, "unmarshaling held transaction")
+		}
+		item := &Item{
+			ID:            id,
+			TransactionID: tx.ID,
+			Transaction:   &tx.TxData,
+			Source:        source,
+			Reason:        reason,
+			Status:        status,
+			ReviewReason:  reviewReason,
+			CreatedAt:     createdAt,
+		}
+		if reviewedAt.Valid {
+			item.ReviewedAt = &reviewedAt.Time
+		}
+		items = append(items, item)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying held transactions")
+	}
+	return items, nil
+}
+
+// Approve marks the pending held transaction with the given
+// ID approved. The caller is responsible for submitting it.
+func (q *Queue) Approve(ctx context.Context, id, reason string) (*Item, error) {
+	return q.review(ctx, id, StatusApproved, reason)
+}
+
+// Reject marks the pending held transaction with the given
+// ID rejected, for the given reason.
+func (q *Queue) Reject(ctx context.Context, id, reason string) (*Item, error) {
+	if reason == "" {
+		return nil, errors.Wrap(ErrNoReason)
+	}
+	return q.review(ctx, id, StatusRejected, reason)
+}
+
+func (q *Queue) review(ctx context.Context, id, status, reason string) (*Item, error) {
+	item, err := q.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	const updateQ = `
+		UPDATE held_transactions SET status = $2, review_reason = NULLIF($3, ''), reviewed_at = now()
+		WHERE id = $1 AND status = 'pending'
+	`
+	res, err := q.db.ExecContext(ctx, updateQ, id, status, reason)
+	if err != nil {
+		return nil, errors.Wrap(err, "reviewing held transaction")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrReviewed, "held transaction %s is %s", id, item.Status)
+	}
+	return q.Find(ctx, id)
+}
+
+// Stats returns a summary of the review queue.
+func (q *Queue) Stats(ctx context.Context) (*Stats, error) {
+	const statsQ = `
+		SELECT
+			count(*) FILTER (WHERE status = 'pending'),
+			count(*) FILTER (WHERE status = 'approved'),
+			count(*) FILTER (WHERE status = 'rejected'),
+			COALESCE(max(extract(epoch FROM now() - created_at)) FILTER (WHERE status = 'pending'), 0),
+			COALESCE(avg(extract(epoch FROM now() - created_at)) FILTER (WHERE status = 'pending'), 0)
+		FROM held_transactions
+	`
+	s := new(Stats)
+	err := q.db.QueryRowContext(ctx, statsQ).Scan(&s.Pending, &s.Approved, &s.Rejected, &s.OldestPendingAge, &s.AveragePendingAge)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing review queue stats")
+	}
+	return s, nil
+}
@@ -0,0 +1,74 @@
+package review
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/testutil"
+)
+
+func TestHoldAndList(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(pgtest.NewTx(t))
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(bc.AssetID{V0: 1}, 5, []byte{0x51}, nil)},
+	})
+
+	first, err := q.Hold(ctx, tx, SourceScreening, "pending review")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	second, err := q.Hold(ctx, tx, SourceScreening, "sanctions list match")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("holding a transaction twice: IDs %s and %s, want the same", first.ID, second.ID)
+	}
+
+	items, err := q.List(ctx, StatusPending, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(items) != 1 || items[0].TransactionID != tx.ID || items[0].Reason != "sanctions list match" {
+		t.Fatalf("List() = %+v, want one item for tx %x", items, tx.ID.Bytes())
+	}
+
+	_, err = q.Reject(ctx, first.ID, "")
+	if errors.Root(err) != ErrNoReason {
+		t.Errorf("Reject without a reason: error = %v, want %v", err, ErrNoReason)
+	}
+	rejected, err := q.Reject(ctx, first.ID, "confirmed match")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if rejected.Status != StatusRejected || rejected.ReviewReason != "confirmed match" || rejected.ReviewedAt == nil {
+		t.Errorf("Reject() = %+v, want rejected for confirmed match", rejected)
+	}
+	_, err = q.Approve(ctx, first.ID, "")
+	if errors.Root(err) != ErrReviewed {
+		t.Errorf("Approve after Reject: error = %v, want %v", err, ErrReviewed)
+	}
+
+	// Holding a reviewed transaction again keeps its review.
+	again, err := q.Hold(ctx, tx, SourceScreening, "sanctions list match")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if again.Status != StatusRejected {
+		t.Errorf("Hold after Reject: status %s, want %s", again.Status, StatusRejected)
+	}
+
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if stats.Pending != 0 || stats.Rejected != 1 {
+		t.Errorf("Stats() = %+v, want 0 pending and 1 rejected", stats)
+	}
+}
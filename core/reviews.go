@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/leader"
+	"chain/core/review"
+	"chain/core/screening"
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/protocol/bc/legacy"
+)
+
+// reviewPage is the response to /list-held-transactions.
+type reviewPage struct {
+	Items    []*review.Item `json:"items"`
+	Next     reviewQuery    `json:"next"`
+	LastPage bool           `json:"last_page"`
+}
+
+type reviewQuery struct {
+	Status   string `json:"status"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-held-transactions
+//
+// Lists the transactions held for review, oldest first,
+// optionally only those with one status.
+func (a *API) listHeldTransactions(ctx context.Context, in reviewQuery) (*reviewPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	items, err := a.reviews.List(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []*review.Item{} // send [], not null
+	}
+
+	out := in
+	if len(items) > 0 {
+		out.After = items[len(items)-1].ID
+	}
+	return &reviewPage{
+		Items:    items,
+		Next:     out,
+		LastPage: len(items) < limit,
+	}, nil
+}
+
+type reviewRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// POST /approve-held-transaction
+//
+// Approves a pending held transaction and submits it without
+// screening it or routing it to review by rules again.
+func (a *API) approveHeldTransaction(ctx context.Context, x reviewRequest) (*review.Item, error) {
+	// Like /submit-transaction, submitting must happen on
+	// the leader.
+	if a.leader.State() != leader.Leading {
+		var resp *review.Item
+		err := a.forwardToLeader(ctx, "/approve-held-transaction", x, &resp)
+		return resp, err
+	}
+
+	item, err := a.reviews.Find(ctx, x.ID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != review.StatusPending {
+		return nil, errors.WithDetailf(review.ErrReviewed, "held transaction %s is %s", item.ID, item.Status)
+	}
+	tpl := &txbuilder.Template{Transaction: legacy.NewTx(*item.Transaction)}
+	ev, err := a.rules.Evaluate(ctx, tpl.Transaction)
+	if err != nil {
+		return nil, errors.Wrap(err, "evaluating rules")
+	}
+	err = a.finalizeTxWait(ctx, tpl, "none")
+	if err != nil {
+		return nil, errors.Wrapf(err, "tx %s", tpl.Transaction.ID.String())
+	}
+	a.recordActivity(ctx, ev)
+	return a.reviews.Approve(ctx, x.ID, x.Reason)
+}
+
+// POST /reject-held-transaction
+//
+// Rejects a pending held transaction. A reason is required.
+func (a *API) rejectHeldTransaction(ctx context.Context, x reviewRequest) (*review.Item, error) {
+	return a.reviews.Reject(ctx, x.ID, x.Reason)
+}
+
+// POST /get-review-queue-stats
+//
+// Returns the number of held transactions with each status,
+// and the age of the pending ones.
+func (a *API) getReviewQueueStats(ctx context.Context) (*review.Stats, error) {
+	return a.reviews.Stats(ctx)
+}
+
+// screen asks the compliance screener, if there is one,
+// whether tx may be submitted. Denied transactions fail with
+// screening.ErrDenied. Held transactions are added to the
+// review queue and fail with screening.ErrHeld, with the
+// review item's ID in the error data, unless a reviewer has
+// already approved or rejected them. If the screener can't be
+// reached, the transaction isn't submitted.
+func (a *API) screen(ctx context.Context, tx *legacy.Tx) error {
+	if a.screener == nil {
+		return nil
+	}
+	res, err := a.screener.Screen(ctx, screening.NewRequest(tx))
+	if err != nil {
+		return errors.Wrap(err, "screening transaction")
+	}
+	switch res.Decision {
+	case screening.Deny:
+		return errors.WithDetail(screening.ErrDenied, res.Reason)
+	case screening.Hold:
+		return a.hold(ctx, tx, review.SourceScreening, res.Reason)
+	}
+	return nil
+}
+
+// hold adds tx to the review queue, held by source for the
+// given reason, and fails with screening.ErrHeld, with the
+// review item's ID in the error data. If a reviewer has
+// already approved tx, it returns nil; if they rejected it,
+// it fails with screening.ErrDenied.
+func (a *API) hold(ctx context.Context, tx *legacy.Tx, source, reason string) error {
+	item, err := a.reviews.Hold(ctx, tx, source, reason)
+	if err != nil {
+		return err
+	}
+	switch item.Status {
+	case review.StatusApproved:
+		return nil
+	case review.StatusRejected:
+		return errors.WithDetailf(screening.ErrDenied, "rejected in review: %s", item.ReviewReason)
+	}
+	err = errors.WithDetailf(screening.ErrHeld, "held for review as %s: %s", item.ID, reason)
+	return errors.WithData(err, "review_id", item.ID)
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/review"
+	"chain/core/rules"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+type ruleRequest struct {
+	ID              string             `json:"id"`
+	Name            string             `json:"name"`
+	AccountID       string             `json:"account_id"`
+	AccountAlias    string             `json:"account_alias"`
+	AssetID         *bc.AssetID        `json:"asset_id"`
+	AssetAlias      string             `json:"asset_alias"`
+	Window          chainjson.Duration `json:"window"`
+	MaxAmount       uint64             `json:"max_amount"`
+	NewCounterparty bool               `json:"new_counterparty"`
+	Action          string             `json:"action"`
+	WebhookURL      string             `json:"webhook_url"`
+}
+
+// rule returns the rule described by x, looking up its
+// account and asset by alias if necessary.
+func (a *API) rule(ctx context.Context, x ruleRequest) (*rules.Rule, error) {
+	r := &rules.Rule{
+		ID:              x.ID,
+		Name:            x.Name,
+		AccountID:       x.AccountID,
+		AssetID:         x.AssetID,
+		Window:          x.Window,
+		MaxAmount:       x.MaxAmount,
+		NewCounterparty: x.NewCounterparty,
+		Action:          x.Action,
+		WebhookURL:      x.WebhookURL,
+	}
+	if x.AccountAlias != "" {
+		if x.AccountID != "" {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "account_id and account_alias can't both be set")
+		}
+		acct, err := a.accounts.FindByAlias(ctx, x.AccountAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find account by alias")
+		}
+		r.AccountID = acct.ID
+	}
+	if x.AssetAlias != "" {
+		if x.AssetID != nil {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id and asset_alias can't both be set")
+		}
+		ast, err := a.assets.FindByAlias(ctx, x.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		r.AssetID = &ast.AssetID
+	}
+	return r, nil
+}
+
+// POST /create-rule
+func (a *API) createRule(ctx context.Context, x ruleRequest) (*rules.Rule, error) {
+	r, err := a.rule(ctx, x)
+	if err != nil {
+		return nil, err
+	}
+	return a.rules.Create(ctx, r)
+}
+
+// POST /update-rule
+//
+// Replaces every field of the rule with the given ID.
+func (a *API) updateRule(ctx context.Context, x ruleRequest) (*rules.Rule, error) {
+	r, err := a.rule(ctx, x)
+	if err != nil {
+		return nil, err
+	}
+	return a.rules.Update(ctx, r)
+}
+
+// POST /delete-rule
+func (a *API) deleteRule(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) error {
+	return a.rules.Delete(ctx, x.ID)
+}
+
+// ruleList is the response to /list-rules.
+type ruleList struct {
+	Items []*rules.Rule `json:"items"`
+}
+
+// POST /list-rules
+func (a *API) listRules(ctx context.Context) (*ruleList, error) {
+	list, err := a.rules.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*rules.Rule{} // send [], not null
+	}
+	return &ruleList{Items: list}, nil
+}
+
+// ruleMatchPage is the response to /list-rule-matches.
+type ruleMatchPage struct {
+	Items    []*rules.Match `json:"items"`
+	Next     ruleMatchQuery `json:"next"`
+	LastPage bool           `json:"last_page"`
+}
+
+type ruleMatchQuery struct {
+	RuleID   string `json:"rule_id"`
+	After    string `json:"after"`
+	PageSize int    `json:"page_size"`
+}
+
+// POST /list-rule-matches
+//
+// Lists the activity tagged by rules, oldest first,
+// optionally only that of one rule.
+func (a *API) listRuleMatches(ctx context.Context, in ruleMatchQuery) (*ruleMatchPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	matches, err := a.rules.ListMatches(ctx, in.RuleID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if matches == nil {
+		matches = []*rules.Match{} // send [], not null
+	}
+
+	out := in
+	if len(matches) > 0 {
+		out.After = matches[len(matches)-1].ID
+	}
+	return &ruleMatchPage{
+		Items:    matches,
+		Next:     out,
+		LastPage: len(matches) < limit,
+	}, nil
+}
+
+// checkRules evaluates tx against the activity rules. If a
+// matching rule routes it to review, it's held like a
+// transaction held by compliance screening. It returns a nil
+// evaluation if the Core has no rules engine.
+func (a *API) checkRules(ctx context.Context, tx *legacy.Tx) (*rules.Evaluation, error) {
+	if a.rules == nil {
+		return nil, nil
+	}
+	ev, err := a.rules.Evaluate(ctx, tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "evaluating rules")
+	}
+	if reason, ok := ev.Review(); ok {
+		err = a.hold(ctx, tx, review.SourceRules, reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ev, nil
+}
+
+// recordActivity records the rule matches and activity in ev
+// once its transaction has been submitted. The transaction
+// can't be recalled, so failures are only logged.
+func (a *API) recordActivity(ctx context.Context, ev *rules.Evaluation) {
+	if a.rules == nil || ev == nil {
+		return
+	}
+	err := a.rules.Record(ctx, ev)
+	if err != nil {
+		log.Error(ctx, err, "recording activity of tx "+ev.TransactionID.String())
+	}
+}
@@ -0,0 +1,561 @@
+// Package rules implements velocity and anomaly rules that
+// watch the outflows of accounts in transactions submitted
+// by this core.
+//
+// A rule applies to one account or all accounts, and one asset
+// or all assets. It matches an outflow that would take the
+// total moved within its time window over a maximum amount,
+// or one that pays a counterparty the account has never paid
+// before. Each match in a submitted transaction is recorded,
+// tagging the activity; a rule can also deliver its matches to
+// a webhook or route the transaction to the review queue.
+package rules
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+// Rule actions. Every match is recorded; these say what else
+// happens when a rule matches.
+const (
+	// ActionTag only records the match.
+	ActionTag = "tag"
+
+	// ActionWebhook also POSTs the match to the rule's
+	// webhook URL.
+	ActionWebhook = "webhook"
+
+	// ActionReview also holds the transaction in the review
+	// queue instead of submitting it.
+	ActionReview = "review"
+)
+
+// ErrBadRule is returned for a rule with invalid fields.
+var ErrBadRule = errors.New("invalid rule")
+
+// Rule describes a velocity or anomaly rule. An empty
+// AccountID or nil AssetID applies the rule to all accounts or
+// assets. A zero MaxAmount disables the velocity check.
+type Rule struct {
+	ID              string             `json:"id"`
+	Name            string             `json:"name"`
+	AccountID       string             `json:"account_id,omitempty"`
+	AssetID         *bc.AssetID        `json:"asset_id,omitempty"`
+	Window          chainjson.Duration `json:"window"`
+	MaxAmount       uint64             `json:"max_amount,omitempty"`
+	NewCounterparty bool               `json:"new_counterparty"`
+	Action          string             `json:"action"`
+	WebhookURL      string             `json:"webhook_url,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.WithDetail(ErrBadRule, "a name is required")
+	}
+	if r.MaxAmount == 0 && !r.NewCounterparty {
+		return errors.WithDetail(ErrBadRule, "a rule needs a max_amount or new_counterparty")
+	}
+	if r.MaxAmount > math.MaxInt64 {
+		return errors.WithDetailf(ErrBadRule, "max_amount must be at most %d", int64(math.MaxInt64))
+	}
+	if r.MaxAmount > 0 && r.Window.Duration <= 0 {
+		return errors.WithDetail(ErrBadRule, "a window is required with max_amount")
+	}
+	switch r.Action {
+	case ActionTag, ActionReview:
+		if r.WebhookURL != "" {
+			return errors.WithDetailf(ErrBadRule, "webhook_url is only allowed with action %s", ActionWebhook)
+		}
+	case ActionWebhook:
+		u, err := url.Parse(r.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.WithDetailf(ErrBadRule, "invalid webhook_url %q", r.WebhookURL)
+		}
+	default:
+		return errors.WithDetailf(ErrBadRule, "action must be %s, %s or %s", ActionTag, ActionWebhook, ActionReview)
+	}
+	return nil
+}
+
+// Engine stores rules and evaluates transactions against them.
+type Engine struct {
+	db pg.DB
+}
+
+// NewEngine returns a new Engine using the given database.
+func NewEngine(db pg.DB) *Engine {
+	return &Engine{db: db}
+}
+
+// Create validates and saves a new rule.
+func (e *Engine) Create(ctx context.Context, r *Rule) (*Rule, error) {
+	err := r.validate()
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		INSERT INTO rules (name, account_id, asset_id, window_ms, max_amount, new_counterparty, action, webhook_url)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, NULLIF($8, ''))
+		RETURNING id
+	`
+	var id string
+	err = e.db.QueryRowContext(ctx, q, r.Name, r.AccountID, assetIDBytes(r.AssetID), windowMS(r),
+		int64(r.MaxAmount), r.NewCounterparty, r.Action, r.WebhookURL).Scan(&id)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting rule")
+	}
+	return e.Find(ctx, id)
+}
+
+// Update validates r and replaces the fields of the saved
+// rule with the same ID.
+func (e *Engine) Update(ctx context.Context, r *Rule) (*Rule, error) {
+	err := r.validate()
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		UPDATE rules SET name = $2, account_id = NULLIF($3, ''), asset_id = $4, window_ms = $5,
+			max_amount = $6, new_counterparty = $7, action = $8, webhook_url = NULLIF($9, '')
+		WHERE id = $1
+	`
+	res, err := e.db.ExecContext(ctx, q, r.ID, r.Name, r.AccountID, assetIDBytes(r.AssetID), windowMS(r),
+		int64(r.MaxAmount), r.NewCounterparty, r.Action, r.WebhookURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating rule")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "rule %s not found", r.ID)
+	}
+	return e.Find(ctx, r.ID)
+}
+
+// Delete deletes the rule with the given ID. Its recorded
+// matches are kept.
+func (e *Engine) Delete(ctx context.Context, id string) error {
+	res, err := e.db.ExecContext(ctx, `DELETE FROM rules WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "deleting rule")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "rule %s not found", id)
+	}
+	return nil
+}
+
+const selectQ = `
+	SELECT id, name, COALESCE(account_id, ''), asset_id, window_ms, max_amount,
+		new_counterparty, action, COALESCE(webhook_url, ''), created_at
+	FROM rules
+`
+
+// Find returns the rule with the given ID.
+func (e *Engine) Find(ctx context.Context, id string) (*Rule, error) {
+	rules, err := e.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "rule %s not found", id)
+	}
+	return rules[0], nil
+}
+
+// List returns all rules, oldest first.
+func (e *Engine) List(ctx context.Context) ([]*Rule, error) {
+	return e.query(ctx, selectQ+`ORDER BY created_at, id`)
+}
+
+func (e *Engine) query(ctx context.Context, query string, args ...interface{}) ([]*Rule, error) {
+	var rules []*Rule
+	err := pg.ForQueryRows(ctx, e.db, query, append(args, func(
+		id, name, accountID string, assetID []byte, window, maxAmount int64,
+		newCounterparty bool, action, webhookURL string, createdAt time.Time,
+	) error {
+		r := &Rule{
+			ID:              id,
+			Name:            name,
+			AccountID:       accountID,
+			Window:          chainjson.Duration{Duration: time.Duration(window) * time.Millisecond},
+			MaxAmount:       uint64(maxAmount),
+			NewCounterparty: newCounterparty,
+			Action:          action,
+			WebhookURL:      webhookURL,
+			CreatedAt:       createdAt,
+		}
+		if assetID != nil {
+			r.AssetID = new(bc.AssetID)
+			err := r.AssetID.Scan(assetID)
+			if err != nil {
+				return err
+			}
+		}
+		rules = append(rules, r)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying rules")
+	}
+	return rules, nil
+}
+
+func assetIDBytes(id *bc.AssetID) []byte {
+	if id == nil {
+		return nil
+	}
+	return id.Bytes()
+}
+
+func windowMS(r *Rule) int64 {
+	return int64(r.Window.Duration / time.Millisecond)
+}
+
+// Match records a rule matching an account's outflow of an
+// asset in a transaction. Amount is the outflow, net of
+// change.
+type Match struct {
+	ID            string     `json:"id"`
+	RuleID        string     `json:"rule_id"`
+	TransactionID bc.Hash    `json:"transaction_id"`
+	AccountID     string     `json:"account_id"`
+	AssetID       bc.AssetID `json:"asset_id"`
+	Amount        uint64     `json:"amount"`
+	Action        string     `json:"action"`
+	Reason        string     `json:"reason"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ListMatches returns up to limit matches, oldest first. If
+// ruleID is non-empty, only that rule's matches are returned.
+// Matches with IDs less than or equal to after are skipped;
+// pass the ID of the last match returned to get the next page,
+// or "" to get the first.
+func (e *Engine) ListMatches(ctx context.Context, ruleID, after string, limit int) ([]*Match, error) {
+	const q = `
+		SELECT id, rule_id, tx_hash, account_id, asset_id, amount, action, reason, created_at
+		FROM rule_matches
+		WHERE ($1 = '' OR rule_id = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`
+	var matches []*Match
+	err := pg.ForQueryRows(ctx, e.db, q, ruleID, after, limit, func(
+		id, ruleID string, txHash bc.Hash, accountID string, assetID bc.AssetID,
+		amount int64, action, reason string, createdAt time.Time,
+	) {
+		matches = append(matches, &Match{
+			ID:            id,
+			RuleID:        ruleID,
+			TransactionID: txHash,
+			AccountID:     accountID,
+			AssetID:       assetID,
+			Amount:        uint64(amount),
+			Action:        action,
+			Reason:        reason,
+			CreatedAt:     createdAt,
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying rule matches")
+	}
+	return matches, nil
+}
+
+// flow is one account's net outflow of one asset in a
+// transaction, and the control programs it pays that the
+// account has never paid before.
+type flow struct {
+	accountID         string
+	assetID           bc.AssetID
+	amount            uint64
+	newCounterparties [][]byte
+}
+
+// Evaluation is the result of evaluating a transaction
+// against the rules.
+type Evaluation struct {
+	TransactionID bc.Hash
+	Matches       []*Match
+	flows         []*flow
+}
+
+// Review returns the reason for holding the transaction for
+// review, and whether any matching rule requires it.
+func (ev *Evaluation) Review() (reason string, ok bool) {
+	for _, m := range ev.Matches {
+		if m.Action == ActionReview {
+			return m.Reason, true
+		}
+	}
+	return "", false
+}
+
+// Evaluate evaluates tx against every rule, returning its
+// matches without recording them, so a transaction that's
+// held or fails to submit leaves no matches behind. Record
+// records them once the transaction has been submitted. Only
+// outflows of accounts managed by this core are evaluated.
+func (e *Engine) Evaluate(ctx context.Context, tx *legacy.Tx) (*Evaluation, error) {
+	ev := &Evaluation{TransactionID: tx.ID}
+	flows, err := e.flows(ctx, tx)
+	if err != nil || len(flows) == 0 {
+		return ev, err
+	}
+	ev.flows = flows
+
+	rules, err := e.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range flows {
+		for _, r := range rules {
+			if (r.AccountID != "" && r.AccountID != f.accountID) || (r.AssetID != nil && *r.AssetID != f.assetID) {
+				continue
+			}
+			reason, err := e.check(ctx, r, tx.ID, f)
+			if err != nil {
+				return nil, err
+			}
+			if reason == "" {
+				continue
+			}
+			ev.Matches = append(ev.Matches, &Match{
+				RuleID:        r.ID,
+				TransactionID: tx.ID,
+				AccountID:     f.accountID,
+				AssetID:       f.assetID,
+				Amount:        f.amount,
+				Action:        r.Action,
+				Reason:        reason,
+			})
+		}
+	}
+	return ev, nil
+}
+
+// check returns why rule r matches f, or "" if it doesn't.
+func (e *Engine) check(ctx context.Context, r *Rule, txHash bc.Hash, f *flow) (string, error) {
+	if r.NewCounterparty && len(f.newCounterparties) > 0 {
+		return fmt.Sprintf("account %s pays %d new counterparties", f.accountID, len(f.newCounterparties)), nil
+	}
+	if r.MaxAmount == 0 {
+		return "", nil
+	}
+	const q = `
+		SELECT COALESCE(sum(amount), 0) FROM rule_activity
+		WHERE account_id = $1 AND asset_id = $2 AND tx_hash != $3
+			AND created_at > now() - $4 * interval '1 millisecond'
+	`
+	var moved uint64
+	err := e.db.QueryRowContext(ctx, q, f.accountID, f.assetID, txHash, windowMS(r)).Scan(&moved)
+	if err != nil {
+		return "", errors.Wrap(err, "summing recent activity")
+	}
+	if moved+f.amount <= r.MaxAmount && moved+f.amount >= moved {
+		return "", nil
+	}
+	return fmt.Sprintf("account %s would move %d of asset %s within %s, over the limit of %d",
+		f.accountID, moved+f.amount, f.assetID.String(), r.Window.Duration, r.MaxAmount), nil
+}
+
+// recordMatch records m, unless the same match was already
+// recorded, filling in its ID and creation time if it's new.
+func (e *Engine) recordMatch(ctx context.Context, m *Match) error {
+	const q = `
+		INSERT INTO rule_matches (rule_id, tx_hash, account_id, asset_id, amount, action, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (rule_id, tx_hash, account_id, asset_id) DO NOTHING
+		RETURNING id, created_at
+	`
+	err := e.db.QueryRowContext(ctx, q, m.RuleID, m.TransactionID, m.AccountID, m.AssetID, int64(m.Amount), m.Action, m.Reason).Scan(&m.ID, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return errors.Wrap(err, "recording rule match")
+}
+
+// flows returns the net outflows of accounts spending in tx.
+func (e *Engine) flows(ctx context.Context, tx *legacy.Tx) ([]*flow, error) {
+	var spent pq.ByteaArray
+	for _, id := range tx.SpentOutputIDs {
+		spent = append(spent, id.Bytes())
+	}
+	if len(spent) == 0 {
+		return nil, nil
+	}
+
+	type key struct {
+		accountID string
+		assetID   bc.AssetID
+	}
+	var (
+		flows    []*flow
+		byKey    = make(map[key]*flow)
+		accounts pq.StringArray
+	)
+	const inputsQ = `
+		SELECT account_id, asset_id, amount FROM account_utxos WHERE output_id = ANY($1)
+	`
+	err := pg.ForQueryRows(ctx, e.db, inputsQ, spent, func(accountID string, assetID bc.AssetID, amount int64) {
+		k := key{accountID, assetID}
+		f := byKey[k]
+		if f == nil {
+			f = &flow{accountID: accountID, assetID: assetID}
+			byKey[k] = f
+			flows = append(flows, f)
+			accounts = append(accounts, accountID)
+		}
+		f.amount += uint64(amount)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading spent outputs")
+	}
+	if len(flows) == 0 {
+		return nil, nil
+	}
+
+	var progs pq.ByteaArray
+	for _, out := range tx.Outputs {
+		progs = append(progs, out.ControlProgram)
+	}
+	owned := make(map[string]map[string]bool) // account ID -> control program -> true
+	const ownedQ = `
+		SELECT signer_id, control_program FROM account_control_programs
+		WHERE signer_id = ANY($1) AND control_program = ANY($2)
+	`
+	err = pg.ForQueryRows(ctx, e.db, ownedQ, accounts, progs, func(accountID string, prog []byte) {
+		if owned[accountID] == nil {
+			owned[accountID] = make(map[string]bool)
+		}
+		owned[accountID][string(prog)] = true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading account control programs")
+	}
+
+	paid := make(map[*flow]map[string]bool)
+	for _, out := range tx.Outputs {
+		for _, f := range flows {
+			if f.assetID != *out.AssetId {
+				continue
+			}
+			if owned[f.accountID][string(out.ControlProgram)] {
+				// Change back to the spending account.
+				if out.Amount >= f.amount {
+					f.amount = 0
+				} else {
+					f.amount -= out.Amount
+				}
+				continue
+			}
+			if paid[f] == nil {
+				paid[f] = make(map[string]bool)
+			}
+			paid[f][string(out.ControlProgram)] = true
+		}
+	}
+
+	var result []*flow
+	for _, f := range flows {
+		if f.amount == 0 {
+			continue
+		}
+		var candidates pq.ByteaArray
+		for prog := range paid[f] {
+			candidates = append(candidates, []byte(prog))
+		}
+		known := make(map[string]bool)
+		const knownQ = `
+			SELECT control_program FROM rule_counterparties
+			WHERE account_id = $1 AND control_program = ANY($2)
+		`
+		err = pg.ForQueryRows(ctx, e.db, knownQ, f.accountID, candidates, func(prog []byte) {
+			known[string(prog)] = true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "loading counterparties")
+		}
+		for _, prog := range candidates {
+			if !known[string(prog)] {
+				f.newCounterparties = append(f.newCounterparties, prog)
+			}
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// Record records the matches in ev, which are then delivered
+// to webhooks, and its outflows as activity, counting toward
+// the rules' velocity limits, and their counterparties as
+// known. Call it once the transaction has been submitted;
+// recording the same evaluation again has no effect.
+func (e *Engine) Record(ctx context.Context, ev *Evaluation) error {
+	for _, m := range ev.Matches {
+		err := e.recordMatch(ctx, m)
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range ev.flows {
+		const activityQ = `
+			INSERT INTO rule_activity (tx_hash, account_id, asset_id, amount) VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+		`
+		_, err := e.db.ExecContext(ctx, activityQ, ev.TransactionID, f.accountID, f.assetID, int64(f.amount))
+		if err != nil {
+			return errors.Wrap(err, "recording activity")
+		}
+		if len(f.newCounterparties) == 0 {
+			continue
+		}
+		const counterpartiesQ = `
+			INSERT INTO rule_counterparties (account_id, control_program)
+			SELECT $1, unnest($2::bytea[])
+			ON CONFLICT DO NOTHING
+		`
+		_, err = e.db.ExecContext(ctx, counterpartiesQ, f.accountID, pq.ByteaArray(f.newCounterparties))
+		if err != nil {
+			return errors.Wrap(err, "recording counterparties")
+		}
+	}
+	return nil
+}
+
+// minActivityRetention is how long activity is kept even if
+// no rule's window is that long, so a new rule can count
+// recent activity.
+const minActivityRetention = 30 * 24 * time.Hour
+
+// PruneActivity deletes activity older than the longest rule
+// window, which no rule can count.
+func (e *Engine) PruneActivity(ctx context.Context) error {
+	const q = `
+		DELETE FROM rule_activity
+		WHERE created_at < now() - greatest((SELECT max(window_ms) FROM rules), $1) * interval '1 millisecond'
+	`
+	_, err := e.db.ExecContext(ctx, q, int64(minActivityRetention/time.Millisecond))
+	return errors.Wrap(err, "pruning rule activity")
+}
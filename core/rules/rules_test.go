@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/testutil"
+)
+
+func TestValidate(t *testing.T) {
+	day := chainjson.Duration{Duration: 24 * time.Hour}
+	cases := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Name: "big", MaxAmount: 100, Window: day, Action: ActionTag}, true},
+		{Rule{Name: "new", NewCounterparty: true, Action: ActionReview}, true},
+		{Rule{Name: "hook", NewCounterparty: true, Action: ActionWebhook, WebhookURL: "https://example.com/hook"}, true},
+		{Rule{MaxAmount: 100, Window: day, Action: ActionTag}, false},
+		{Rule{Name: "empty", Action: ActionTag}, false},
+		{Rule{Name: "no window", MaxAmount: 100, Action: ActionTag}, false},
+		{Rule{Name: "huge", MaxAmount: 1 << 63, Window: day, Action: ActionTag}, false},
+		{Rule{Name: "action", NewCounterparty: true, Action: "alert"}, false},
+		{Rule{Name: "no url", NewCounterparty: true, Action: ActionWebhook}, false},
+		{Rule{Name: "bad url", NewCounterparty: true, Action: ActionWebhook, WebhookURL: "ftp://example.com"}, false},
+		{Rule{Name: "stray url", NewCounterparty: true, Action: ActionTag, WebhookURL: "https://example.com/hook"}, false},
+	}
+	for _, c := range cases {
+		err := c.rule.validate()
+		if c.ok && err != nil {
+			t.Errorf("validate(%+v) = %v, want nil", c.rule, err)
+		}
+		if !c.ok && errors.Root(err) != ErrBadRule {
+			t.Errorf("validate(%+v) = %v, want %v", c.rule, err, ErrBadRule)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	e := NewEngine(db)
+	assetID := bc.AssetID{V0: 1}
+
+	_, err := e.Create(ctx, &Rule{
+		Name:      "daily limit",
+		AccountID: "acc1",
+		AssetID:   &assetID,
+		Window:    chainjson.Duration{Duration: 24 * time.Hour},
+		MaxAmount: 150,
+		Action:    ActionReview,
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = e.Create(ctx, &Rule{Name: "new payee", NewCounterparty: true, Action: ActionTag})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Each transaction spends 100 from acc1, paying 80 to a
+	// counterparty and 20 back to acc1 as change.
+	change := []byte{0x51}
+	newTx := func(n uint64) *legacy.Tx {
+		tx := legacy.NewTx(legacy.TxData{
+			Version: 1,
+			Inputs:  []*legacy.TxInput{legacy.NewSpendInput(nil, bc.NewHash([32]byte{byte(n)}), assetID, 100, 0, []byte{0x51}, bc.Hash{}, nil)},
+			Outputs: []*legacy.TxOutput{
+				legacy.NewTxOutput(assetID, 80, []byte{0x52}, nil),
+				legacy.NewTxOutput(assetID, 20, change, nil),
+			},
+		})
+		pgtest.Exec(ctx, db, t, `
+			INSERT INTO account_utxos (asset_id, amount, account_id, control_program_index, control_program,
+				confirmed_in, output_id, source_id, source_pos, ref_data_hash, change)
+			VALUES ($1, 100, 'acc1', 1, '\x51', 1, $2, '\x00', 0, '\x00', false)
+		`, assetID, tx.SpentOutputIDs[0])
+		return tx
+	}
+	pgtest.Exec(ctx, db, t, `
+		INSERT INTO account_control_programs (signer_id, key_index, control_program, change)
+		VALUES ('acc1', 1, $1, true)
+	`, change)
+
+	first := newTx(1)
+	ev, err := e.Evaluate(ctx, first)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(ev.Matches) != 1 || ev.Matches[0].Amount != 80 || ev.Matches[0].Action != ActionTag {
+		t.Fatalf("first Evaluate matches = %+v, want one tag of 80", ev.Matches)
+	}
+	if _, ok := ev.Review(); ok {
+		t.Error("first Evaluate: Review() = true, want false")
+	}
+	err = e.Record(ctx, ev)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// The counterparty is now known, and the total of 160 is
+	// over the daily limit.
+	second := newTx(2)
+	ev, err = e.Evaluate(ctx, second)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(ev.Matches) != 1 || ev.Matches[0].Action != ActionReview {
+		t.Fatalf("second Evaluate matches = %+v, want one review", ev.Matches)
+	}
+	if _, ok := ev.Review(); !ok {
+		t.Error("second Evaluate: Review() = false, want true")
+	}
+
+	// Only the submitted transaction's match is recorded.
+	matches, err := e.ListMatches(ctx, "", "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(matches) != 1 || matches[0].TransactionID != first.ID {
+		t.Errorf("ListMatches() = %+v, want the first transaction's match", matches)
+	}
+
+	// Recording again doesn't record the match twice.
+	for i := 0; i < 2; i++ {
+		err = e.Record(ctx, ev)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	matches, err = e.ListMatches(ctx, "", "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(matches) != 2 {
+		t.Errorf("ListMatches() = %+v, want 2 matches", matches)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	e := NewEngine(pgtest.NewTx(t))
+	r, err := e.Create(ctx, &Rule{Name: "new payee", NewCounterparty: true, Action: ActionTag})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = e.Delete(ctx, r.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = e.Delete(ctx, r.ID)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("deleting twice: error = %v, want %v", err, pg.ErrUserInputNotFound)
+	}
+}
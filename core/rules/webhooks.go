@@ -0,0 +1,140 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+)
+
+const (
+	maxDeliveryAttempts = 20
+	maxRetryDelay       = time.Hour
+	deliveryBatchSize   = 100
+)
+
+// Webhook is the body POSTed to a rule's webhook URL when it
+// matches. Rule is the rule's state at the time of delivery.
+type Webhook struct {
+	Match *Match `json:"match"`
+	Rule  *Rule  `json:"rule"`
+}
+
+// DeliverWebhooks periodically POSTs undelivered matches of
+// webhook rules to their webhook URLs using client. It also
+// prunes activity no rule can count. A delivery succeeds if
+// the webhook responds with a 2xx status. Failed deliveries
+// are retried with exponential backoff, up to
+// maxDeliveryAttempts times. Matches of deleted rules aren't
+// delivered.
+// It blocks until the context is canceled.
+func (e *Engine) DeliverWebhooks(ctx context.Context, client *http.Client, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, DeliverWebhooks exiting")
+			return
+		case <-ticks:
+			err := e.deliverWebhooks(ctx, client)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+			err = e.PruneActivity(ctx)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+func (e *Engine) deliverWebhooks(ctx context.Context, client *http.Client) error {
+	const q = `
+		SELECT m.id, m.rule_id, m.tx_hash, m.account_id, m.asset_id, m.amount, m.action, m.reason, m.created_at
+		FROM rule_matches m
+		JOIN rules r ON r.id = m.rule_id
+		WHERE m.action = 'webhook' AND m.delivered_at IS NULL
+			AND m.next_attempt_at <= now() AND m.attempts < $1
+		ORDER BY m.id
+		LIMIT $2
+	`
+	var matches []*Match
+	err := pg.ForQueryRows(ctx, e.db, q, maxDeliveryAttempts, deliveryBatchSize, func(
+		id, ruleID string, txHash bc.Hash, accountID string, assetID bc.AssetID,
+		amount int64, action, reason string, createdAt time.Time,
+	) {
+		matches = append(matches, &Match{
+			ID:            id,
+			RuleID:        ruleID,
+			TransactionID: txHash,
+			AccountID:     accountID,
+			AssetID:       assetID,
+			Amount:        uint64(amount),
+			Action:        action,
+			Reason:        reason,
+			CreatedAt:     createdAt,
+		})
+	})
+	if err != nil {
+		return errors.Wrap(err, "loading undelivered matches")
+	}
+
+	for _, m := range matches {
+		r, err := e.Find(ctx, m.RuleID)
+		if err != nil {
+			return err
+		}
+		deliveryErr := post(ctx, client, r.WebhookURL, &Webhook{Match: m, Rule: r})
+		if deliveryErr != nil {
+			log.Error(ctx, errors.Wrapf(deliveryErr, "delivering rule match %s", m.ID))
+		}
+		err = e.recordAttempt(ctx, m.ID, deliveryErr == nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func post(ctx context.Context, client *http.Client, url string, w *Webhook) error {
+	body, err := json.Marshal(w)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordAttempt records an attempt to deliver the match with
+// the given ID. If it failed, the next attempt is scheduled
+// after a delay that doubles with each attempt.
+func (e *Engine) recordAttempt(ctx context.Context, id string, delivered bool) error {
+	const q = `
+		UPDATE rule_matches SET
+			attempts = attempts + 1,
+			delivered_at = CASE WHEN $2 THEN now() END,
+			next_attempt_at = now() + least(interval '1 second' * power(2, attempts), $3 * interval '1 second')
+		WHERE id = $1
+	`
+	_, err := e.db.ExecContext(ctx, q, id, delivered, maxRetryDelay.Seconds())
+	return errors.Wrap(err, "recording delivery attempt")
+}
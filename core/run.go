@@ -11,17 +11,37 @@ import (
 
 	"chain/core/accesstoken"
 	"chain/core/account"
+	"chain/core/accrual"
 	"chain/core/asset"
 	"chain/core/config"
+	"chain/core/escrow"
+	"chain/core/event"
+	"chain/core/export"
+	"chain/core/federation"
 	"chain/core/fetch"
 	"chain/core/generator"
+	"chain/core/htlc"
+	"chain/core/ilp"
+	"chain/core/invite"
+	"chain/core/job"
 	"chain/core/leader"
+	"chain/core/payout"
+	"chain/core/payreq"
 	"chain/core/pin"
 	"chain/core/query"
+	"chain/core/receipt"
+	"chain/core/reqsign"
+	"chain/core/retention"
+	"chain/core/review"
 	"chain/core/rpc"
+	"chain/core/rules"
+	"chain/core/screening"
+	"chain/core/statement"
+	"chain/core/subscription"
 	"chain/core/txbuilder"
 	"chain/core/txdb"
 	"chain/core/txfeed"
+	"chain/core/usage"
 	"chain/database/pg"
 	"chain/database/sinkdb"
 	"chain/log"
@@ -31,8 +51,18 @@ import (
 )
 
 const (
+	// blockPeriod is the default time between blocks. It
+	// may be overridden with the block_period config option.
 	blockPeriod              = time.Second
 	expireReservationsPeriod = time.Second
+	deliverEventsPeriod      = 5 * time.Second
+	callbackTimeout          = 10 * time.Second
+	consolidateUTXOsPeriod   = time.Minute
+	runAccrualsPeriod        = time.Minute
+	runSubscriptionsPeriod   = time.Minute
+	runPayoutsPeriod         = 10 * time.Second
+	expireHTLCsPeriod        = 10 * time.Second
+	publishEventsPeriod      = time.Second
 )
 
 // RunOption describes a runtime configuration option.
@@ -105,6 +135,27 @@ func IndexTransactions(b bool) RunOption {
 	return func(a *API) { a.indexTxs = b }
 }
 
+// Environment sets the environment, accesstoken.EnvLive or
+// accesstoken.EnvTest, that access tokens are issued in and
+// checked against.
+func Environment(env string) RunOption {
+	return func(a *API) { a.accessTokens.Environment = env }
+}
+
+// Screener makes the Core ask s whether each transaction may
+// be submitted, before submitting it.
+func Screener(s screening.Screener) RunOption {
+	return func(a *API) { a.screener = s }
+}
+
+// ReadReplica makes the query endpoints read from db, a read
+// replica of the Core's database, instead of the primary.
+// Requests with HeaderReadPrimary set still read from the
+// primary, so clients can see their own writes.
+func ReadReplica(db pg.DB) RunOption {
+	return func(a *API) { a.replica = db }
+}
+
 // RateLimit adds a rate-limiting restriction, using keyFn to extract the
 // key to rate limit on. It will allow up to burst requests in the bucket
 // and will refill the bucket at perSecond tokens per second.
@@ -176,35 +227,72 @@ func Run(
 	assets := asset.NewRegistry(db, c, pinStore)
 	accounts := account.NewManager(db, c, pinStore)
 	indexer := query.NewIndexer(db, c, pinStore)
+	jobs := job.New(db)
 
 	a := &API{
-		chain:        c,
-		store:        store,
-		pinStore:     pinStore,
-		assets:       assets,
-		accounts:     accounts,
-		txFeeds:      &txfeed.Tracker{DB: db},
-		indexer:      indexer,
-		accessTokens: &accesstoken.CredentialStore{DB: db},
-		grants:       authz.NewStore(sdb, GrantPrefix),
-		config:       conf,
-		options:      confOpts,
-		db:           db,
-		sdb:          sdb,
-		mux:          http.NewServeMux(),
-		addr:         routableAddress,
+		chain:           c,
+		store:           store,
+		pinStore:        pinStore,
+		assets:          assets,
+		accounts:        accounts,
+		accruals:        accrual.NewEngine(db),
+		escrows:         escrow.NewManager(db, c, pinStore),
+		htlcs:           htlc.NewManager(db, c, pinStore),
+		counterparties:  federation.NewDirectory(db, *conf.BlockchainId, &http.Client{Timeout: callbackTimeout}),
+		interledger:     ilp.NewConnector(db),
+		txFeeds:         &txfeed.Tracker{DB: db},
+		paymentRequests: payreq.NewTracker(db, c, pinStore),
+		payouts:         payout.NewManager(db),
+		receipts:        receipt.NewSigner(db),
+		reviews:         review.NewQueue(db),
+		statements:      statement.NewStore(db),
+		subscriptions:   subscription.NewManager(db),
+		rules:           rules.NewEngine(db),
+		usage:           usage.NewMeter(db),
+		retention:       retention.NewPruner(db),
+		jobs:            jobs,
+		exports:         export.NewExporter(db, jobs, *conf.BlockchainId, func() uint64 { return pinStore.Height(query.TxPinName) }),
+		indexer:         indexer,
+		accessTokens:    &accesstoken.CredentialStore{DB: db},
+		grants:          authz.NewStore(sdb, GrantPrefix),
+		invitations:     invite.NewStore(db),
+		signatures:      reqsign.NewVerifier(db),
+		config:          conf,
+		options:         confOpts,
+		db:              db,
+		sdb:             sdb,
+		mux:             http.NewServeMux(),
+		addr:            routableAddress,
+		singletons:      leader.NewSingletons(db, routableAddress),
 	}
 	for _, opt := range opts {
 		opt(a)
 	}
+	if a.replica != nil {
+		a.indexer.UseReplica(a.replica)
+	}
 	if a.remoteGenerator == nil && a.generator == nil {
 		return nil, errors.New("no generator configured")
 	}
+	if a.generator != nil {
+		a.generator.SetBlockPeriod(durationOption(confOpts.GetFunc("block_period")))
+		a.generator.SetMaxBlockTxs(intOption(confOpts.GetFunc("max_block_txs")))
+	}
 
 	if a.replicator != nil {
 		go a.replicator.PollRemoteHeight(ctx)
 	}
 
+	a.usage.SetQuotas(quotasOption(confOpts.ListFunc("usage_quota")))
+	a.usage.SetWebhookURL(stringOption(confOpts.GetFunc("usage_webhook")))
+	go a.usage.Run(ctx, flushUsagePeriod)
+	a.retention.SetPolicies(retentionOption(confOpts.ListFunc("retention")))
+	a.retention.SetArchiveDir(stringOption(confOpts.GetFunc("retention_archive_dir")))
+	a.exports.SetDir(stringOption(confOpts.GetFunc("ledger_snapshot_dir")))
+	a.interledger.SetAddress(stringOption(confOpts.GetFunc("ilp_address")))
+	a.exports.SetJournal(a.indexer)
+	a.exports.SetChart(confOpts.ListFunc("gl_account_code"), confOpts.ListFunc("gl_currency_code"))
+
 	if a.indexTxs {
 		go pinStore.Listen(ctx, query.TxPinName, dbURL)
 		a.indexer.RegisterAnnotator(a.assets.AnnotateTxs)
@@ -260,16 +348,22 @@ func (a *API) lead(ctx context.Context) {
 	if pinHeight > 0 {
 		pinHeight = pinHeight - 1
 	}
-	pins := []string{account.PinName, account.ExpirePinName, account.DeleteSpentsPinName, asset.PinName, query.TxPinName}
+	pins := []string{account.PinName, account.ExpirePinName, account.DeleteSpentsPinName, asset.PinName, escrow.PinName, htlc.PinName, payreq.PinName, query.TxPinName}
 	for _, p := range pins {
 		err = a.pinStore.CreatePin(ctx, p, pinHeight)
 		if err != nil {
 			log.Fatalkv(ctx, log.KeyError, err)
 		}
 	}
+	err = a.assets.CreateStatsPin(ctx)
+	if err != nil {
+		log.Fatalkv(ctx, log.KeyError, err)
+	}
 
 	if a.config.IsGenerator {
-		go a.generator.Generate(ctx, blockPeriod, a.healthSetter("generator"))
+		a.singletons.Go(ctx, "generator", func(ctx context.Context) {
+			a.generator.Generate(ctx, blockPeriod, a.healthSetter("generator"))
+		})
 	} else {
 		// Remove the downloading snapshot if there was one. The core
 		// has recovered and will now start syncing blocks.
@@ -281,6 +375,41 @@ func (a *API) lead(ctx context.Context) {
 	}
 	go a.accounts.ProcessBlocks(ctx)
 	go a.assets.ProcessBlocks(ctx)
+	a.singletons.Go(ctx, "asset-stats", a.assets.ProcessStats)
+	a.singletons.Go(ctx, "asset-circulation", func(ctx context.Context) {
+		a.assets.ReconcileCirculation(ctx, reconcileCirculationPeriod)
+	})
+	if a.indexTxs {
+		a.singletons.Go(ctx, "ledger-verifier", func(ctx context.Context) {
+			a.assets.WatchLedger(ctx, verifyLedgerPeriod, a.healthSetter("ledger"))
+		})
+	}
+	go a.paymentRequests.ProcessBlocks(ctx)
+	go a.escrows.ProcessBlocks(ctx)
+	go a.htlcs.ProcessBlocks(ctx)
+	go a.paymentRequests.DeliverEvents(ctx, &http.Client{Timeout: callbackTimeout}, deliverEventsPeriod)
+	go a.rules.DeliverWebhooks(ctx, &http.Client{Timeout: callbackTimeout}, deliverEventsPeriod)
+	go a.usage.Monitor(ctx, &http.Client{Timeout: callbackTimeout}, monitorUsagePeriod)
+	go a.signatures.Prune(ctx, pruneSignaturesPeriod)
+	go a.retention.Run(ctx, pruneRetentionPeriod)
+	a.jobs.Every(expireHTLCsJob, expireHTLCsPeriod, a.expireHTLCs)
+	if a.signTemplate != nil {
+		a.jobs.Every(consolidateUTXOsJob, consolidateUTXOsPeriod, a.consolidateUTXOs)
+		a.jobs.Every(runSubscriptionsJob, runSubscriptionsPeriod, a.runSubscriptions)
+		a.jobs.Every(runPayoutsJob, runPayoutsPeriod, a.runPayouts)
+	}
+	if a.signTemplate != nil && a.indexTxs {
+		a.jobs.Every(runAccrualsJob, runAccrualsPeriod, a.runAccruals)
+	}
+	a.singletons.Go(ctx, "jobs", func(ctx context.Context) {
+		a.jobs.Run(ctx, jobWorkers, pollJobsPeriod)
+	})
+	a.singletons.Go(ctx, "event-publisher", func(ctx context.Context) {
+		event.Forward(ctx, a.db,
+			stringOption(a.options.GetFunc("event_publisher")),
+			topicOption(a.options.ListFunc("event_topic")),
+			publishEventsPeriod)
+	})
 	if a.indexTxs {
 		go a.indexer.ProcessBlocks(ctx)
 	}
@@ -132,7 +132,9 @@ CREATE TABLE access_tokens (
     sort_id text DEFAULT next_chain_id('at'::text),
     type access_token_type,
     hashed_secret bytea NOT NULL,
-    created timestamp with time zone DEFAULT now() NOT NULL
+    created timestamp with time zone DEFAULT now() NOT NULL,
+    environment text DEFAULT 'live'::text NOT NULL,
+    service_account_id text
 );
 
 
@@ -151,7 +153,42 @@ CREATE TABLE account_control_programs (
     key_index bigint NOT NULL,
     control_program bytea NOT NULL,
     change boolean NOT NULL,
-    expires_at timestamp with time zone
+    expires_at timestamp with time zone,
+    unlock_height bigint
+);
+
+
+
+CREATE TABLE account_receiver_payments (
+    output_id bytea NOT NULL,
+    control_program bytea NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    block_height bigint NOT NULL
+);
+
+
+
+CREATE TABLE account_receivers (
+    id text DEFAULT next_chain_id('rcv'::text) NOT NULL,
+    control_program bytea NOT NULL,
+    account_id text NOT NULL,
+    expected_asset_id bytea,
+    expected_amount bigint,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE account_statements (
+    id text DEFAULT next_chain_id('stmt'::text) NOT NULL,
+    account_id text NOT NULL,
+    start_time timestamp with time zone NOT NULL,
+    end_time timestamp with time zone NOT NULL,
+    balances jsonb NOT NULL,
+    transactions jsonb NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
@@ -167,7 +204,9 @@ CREATE TABLE account_utxos (
     source_id bytea NOT NULL,
     source_pos bigint NOT NULL,
     ref_data_hash bytea NOT NULL,
-    change boolean NOT NULL
+    change boolean NOT NULL,
+    unlock_time_ms bigint,
+    unlock_height bigint
 );
 
 
@@ -175,7 +214,51 @@ CREATE TABLE account_utxos (
 CREATE TABLE accounts (
     account_id text NOT NULL,
     tags jsonb,
-    alias text
+    alias text,
+    archived_at timestamp with time zone
+);
+
+
+
+CREATE TABLE accrual_rules (
+    id text DEFAULT next_chain_id('acr'::text) NOT NULL,
+    name text NOT NULL,
+    type text NOT NULL,
+    asset_id bytea NOT NULL,
+    rate text NOT NULL,
+    flat_amount bigint NOT NULL,
+    period text NOT NULL,
+    account_tags jsonb,
+    destination_account_id text,
+    next_accrual_at timestamp with time zone NOT NULL,
+    disabled_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE accruals (
+    id text DEFAULT next_chain_id('acl'::text) NOT NULL,
+    rule_id text NOT NULL,
+    account_id text NOT NULL,
+    asset_id bytea NOT NULL,
+    period_end timestamp with time zone NOT NULL,
+    balance bigint NOT NULL,
+    amount bigint NOT NULL,
+    status text DEFAULT 'planned'::text NOT NULL,
+    tx_hash bytea,
+    error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE address_book (
+    alias text NOT NULL,
+    control_program bytea NOT NULL,
+    verified_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
@@ -185,7 +268,8 @@ CREATE TABLE annotated_accounts (
     alias text NOT NULL,
     keys jsonb NOT NULL,
     quorum integer NOT NULL,
-    tags jsonb NOT NULL
+    tags jsonb NOT NULL,
+    archived boolean DEFAULT false NOT NULL
 );
 
 
@@ -245,7 +329,9 @@ CREATE TABLE annotated_outputs (
     account_tags jsonb,
     control_program bytea NOT NULL,
     reference_data jsonb NOT NULL,
-    local boolean NOT NULL
+    local boolean NOT NULL,
+    unlock_time_ms bigint,
+    unlock_height bigint
 );
 
 
@@ -264,6 +350,41 @@ CREATE TABLE annotated_txs (
 
 
 
+CREATE TABLE asset_circulation (
+    asset_id bytea NOT NULL,
+    issued numeric NOT NULL,
+    transferred numeric NOT NULL,
+    retired numeric NOT NULL
+);
+
+
+
+CREATE TABLE asset_stats (
+    asset_id bytea NOT NULL,
+    hour timestamp with time zone NOT NULL,
+    issued numeric NOT NULL,
+    transferred numeric NOT NULL,
+    retired numeric NOT NULL
+);
+
+
+
+CREATE TABLE asset_ledger_totals (
+    asset_id bytea NOT NULL,
+    issued numeric NOT NULL,
+    transferred numeric NOT NULL,
+    retired numeric NOT NULL
+);
+
+
+
+CREATE TABLE asset_stats_blocks (
+    height bigint NOT NULL,
+    reconciled boolean DEFAULT false NOT NULL
+);
+
+
+
 CREATE TABLE asset_tags (
     asset_id bytea NOT NULL,
     tags jsonb
@@ -348,34 +469,49 @@ CREATE TABLE core_id (
 
 
 
-CREATE TABLE generator_pending_block (
-    singleton boolean DEFAULT true NOT NULL,
-    data bytea NOT NULL,
-    height bigint,
-    CONSTRAINT generator_pending_block_singleton CHECK (singleton)
-);
-
-
-
-CREATE TABLE leader (
-    singleton boolean DEFAULT true NOT NULL,
-    leader_key text NOT NULL,
-    expiry timestamp with time zone DEFAULT '1970-01-01 00:00:00-08'::timestamp with time zone NOT NULL,
-    address text NOT NULL,
-    CONSTRAINT leader_singleton CHECK (singleton)
+CREATE TABLE counterparties (
+    id text DEFAULT next_chain_id('cpty'::text) NOT NULL,
+    alias text,
+    url text NOT NULL,
+    public_key bytea NOT NULL,
+    supported_assets bytea[] NOT NULL,
+    access_token text,
+    status text DEFAULT 'unverified'::text NOT NULL,
+    last_error text,
+    verified_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
 
-CREATE TABLE migrations (
-    filename text NOT NULL,
-    hash text NOT NULL,
-    applied_at timestamp with time zone DEFAULT now() NOT NULL
+CREATE TABLE escrows (
+    id text DEFAULT next_chain_id('esc'::text) NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    payer_account_id text NOT NULL,
+    payee_account_id text,
+    payee_control_program bytea,
+    payer_xpub bytea NOT NULL,
+    payee_xpub bytea NOT NULL,
+    arbiter_xpub bytea NOT NULL,
+    key_index bigint NOT NULL,
+    control_program bytea NOT NULL,
+    status text DEFAULT 'created'::text NOT NULL,
+    output_id bytea,
+    source_id bytea,
+    source_pos bigint,
+    ref_data_hash bytea,
+    funding_tx_hash bytea,
+    settlement_tx_hash bytea,
+    dispute_reason text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
 
-CREATE SEQUENCE mockhsm_sort_id_seq
+CREATE SEQUENCE escrows_key_index_seq
     START WITH 1
     INCREMENT BY 1
     NO MINVALUE
@@ -384,42 +520,25 @@ CREATE SEQUENCE mockhsm_sort_id_seq
 
 
 
-CREATE TABLE mockhsm (
-    pub bytea NOT NULL,
-    prv bytea NOT NULL,
-    alias text,
-    sort_id bigint DEFAULT nextval('mockhsm_sort_id_seq'::regclass) NOT NULL,
-    key_type text DEFAULT 'chain_kd'::text NOT NULL
-);
-
-
-
-CREATE TABLE query_blocks (
-    height bigint NOT NULL,
-    "timestamp" bigint NOT NULL
-);
-
-
-
-CREATE TABLE signed_blocks (
-    block_height bigint NOT NULL,
-    block_hash bytea NOT NULL
+CREATE TABLE event_cursors (
+    name text NOT NULL,
+    seq bigint NOT NULL
 );
 
 
 
-CREATE TABLE signers (
-    id text NOT NULL,
+CREATE TABLE events (
+    seq bigint NOT NULL,
     type text NOT NULL,
-    key_index bigint NOT NULL,
-    quorum integer NOT NULL,
-    client_token text,
-    xpubs bytea[] NOT NULL
+    subject text NOT NULL,
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    once boolean DEFAULT false NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
 
-CREATE SEQUENCE signers_key_index_seq
+CREATE SEQUENCE events_seq_seq
     START WITH 1
     INCREMENT BY 1
     NO MINVALUE
@@ -428,122 +547,675 @@ CREATE SEQUENCE signers_key_index_seq
 
 
 
-ALTER SEQUENCE signers_key_index_seq OWNED BY signers.key_index;
+ALTER SEQUENCE events_seq_seq OWNED BY events.seq;
 
 
 
-CREATE TABLE snapshots (
-    height bigint NOT NULL,
-    data bytea NOT NULL,
-    created_at timestamp without time zone DEFAULT now()
+CREATE TABLE federation_key (
+    singleton boolean DEFAULT true NOT NULL,
+    private_key bytea NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT federation_key_singleton CHECK (singleton)
 );
 
 
 
-CREATE TABLE submitted_txs (
-    tx_hash bytea NOT NULL,
-    height bigint NOT NULL,
-    submitted_at timestamp without time zone DEFAULT now() NOT NULL
+CREATE TABLE freezes (
+    type text NOT NULL,
+    id text NOT NULL,
+    reason text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
 
-CREATE TABLE txfeeds (
-    id text DEFAULT next_chain_id('cur'::text) NOT NULL,
-    alias text,
-    filter text,
-    after text,
-    client_token text
+CREATE TABLE generator_pending_block (
+    singleton boolean DEFAULT true NOT NULL,
+    data bytea NOT NULL,
+    height bigint,
+    CONSTRAINT generator_pending_block_singleton CHECK (singleton)
 );
 
 
 
-ALTER TABLE ONLY signers ALTER COLUMN key_index SET DEFAULT nextval('signers_key_index_seq'::regclass);
+CREATE TABLE held_transactions (
+    id text DEFAULT next_chain_id('htx'::text) NOT NULL,
+    tx_hash bytea NOT NULL,
+    raw_transaction text NOT NULL,
+    reason text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    source text DEFAULT 'screening'::text NOT NULL,
+    status text DEFAULT 'pending'::text NOT NULL,
+    review_reason text,
+    reviewed_at timestamp with time zone
+);
 
 
 
-ALTER TABLE ONLY access_tokens
-    ADD CONSTRAINT access_tokens_pkey PRIMARY KEY (id);
+CREATE TABLE htlcs (
+    id text DEFAULT next_chain_id('htlc'::text) NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    payer_account_id text NOT NULL,
+    payee_account_id text,
+    payee_control_program bytea,
+    payer_xpub bytea NOT NULL,
+    payee_xpub bytea NOT NULL,
+    hash bytea NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    counterparty_id text,
+    auto_refund boolean DEFAULT false NOT NULL,
+    key_index bigint NOT NULL,
+    control_program bytea NOT NULL,
+    status text DEFAULT 'created'::text NOT NULL,
+    preimage bytea,
+    output_id bytea,
+    source_id bytea,
+    source_pos bigint,
+    ref_data_hash bytea,
+    funding_tx_hash bytea,
+    settlement_tx_hash bytea,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY account_control_programs
-    ADD CONSTRAINT account_control_programs_pkey PRIMARY KEY (control_program);
+CREATE SEQUENCE htlcs_key_index_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
 
 
 
-ALTER TABLE ONLY accounts
-    ADD CONSTRAINT account_tags_pkey PRIMARY KEY (account_id);
+CREATE TABLE ilp_payments (
+    id text DEFAULT next_chain_id('ilpx'::text) NOT NULL,
+    peer_id text NOT NULL,
+    pointer_id text NOT NULL,
+    account_id text NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    execution_condition bytea NOT NULL,
+    fulfillment bytea NOT NULL,
+    status text NOT NULL,
+    error text,
+    tx_hash bytea,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY account_utxos
-    ADD CONSTRAINT account_utxos_pkey PRIMARY KEY (output_id);
+CREATE TABLE ilp_peers (
+    id text DEFAULT next_chain_id('ilpp'::text) NOT NULL,
+    alias text,
+    access_token_id text NOT NULL,
+    account_id text NOT NULL,
+    asset_id bytea NOT NULL,
+    max_packet_amount bigint DEFAULT 0 NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY accounts
-    ADD CONSTRAINT accounts_alias_key UNIQUE (alias);
+CREATE TABLE ilp_pointers (
+    id text DEFAULT next_chain_id('ptr'::text) NOT NULL,
+    name text NOT NULL,
+    account_id text NOT NULL,
+    secret bytea NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY annotated_accounts
-    ADD CONSTRAINT annotated_accounts_pkey PRIMARY KEY (id);
+CREATE TABLE invitations (
+    id text DEFAULT next_chain_id('inv'::text) NOT NULL,
+    email text NOT NULL,
+    policy text NOT NULL,
+    hashed_secret bytea NOT NULL,
+    access_token_id text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    accepted_at timestamp with time zone,
+    revoked_at timestamp with time zone
+);
 
 
 
-ALTER TABLE ONLY annotated_assets
-    ADD CONSTRAINT annotated_assets_pkey PRIMARY KEY (id);
+CREATE TABLE issuance_fx_snapshots (
+    tx_hash bytea NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    currency text NOT NULL,
+    rate numeric NOT NULL,
+    as_of timestamp with time zone NOT NULL
+);
 
 
 
-ALTER TABLE ONLY annotated_inputs
-    ADD CONSTRAINT annotated_inputs_pkey PRIMARY KEY (tx_hash, index);
+CREATE TABLE jobs (
+    id text DEFAULT next_chain_id('job'::text) NOT NULL,
+    kind text NOT NULL,
+    payload jsonb DEFAULT '{}'::jsonb NOT NULL,
+    status text DEFAULT 'pending'::text NOT NULL,
+    recurring boolean DEFAULT false NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    max_attempts integer NOT NULL,
+    run_at timestamp with time zone DEFAULT now() NOT NULL,
+    claimed_at timestamp with time zone,
+    last_error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY annotated_outputs
-    ADD CONSTRAINT annotated_outputs_output_id_key UNIQUE (output_id);
+CREATE TABLE journal_exports (
+    id text DEFAULT next_chain_id('jx'::text) NOT NULL,
+    format text NOT NULL,
+    since_height bigint NOT NULL,
+    until_height bigint NOT NULL,
+    until_timestamp timestamp with time zone NOT NULL,
+    status text DEFAULT 'pending'::text NOT NULL,
+    path text,
+    sha256 text,
+    lines bigint DEFAULT 0 NOT NULL,
+    error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    completed_at timestamp with time zone
+);
 
 
 
-ALTER TABLE ONLY annotated_outputs
-    ADD CONSTRAINT annotated_outputs_pkey PRIMARY KEY (block_height, tx_pos, output_index);
+CREATE TABLE journal_periods (
+    id text DEFAULT next_chain_id('jp'::text) NOT NULL,
+    name text DEFAULT ''::text NOT NULL,
+    end_height bigint NOT NULL,
+    end_time timestamp with time zone NOT NULL,
+    closed_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY annotated_txs
-    ADD CONSTRAINT annotated_txs_pkey PRIMARY KEY (block_height, tx_pos);
+CREATE TABLE leader (
+    singleton boolean DEFAULT true NOT NULL,
+    leader_key text NOT NULL,
+    expiry timestamp with time zone DEFAULT '1970-01-01 00:00:00-08'::timestamp with time zone NOT NULL,
+    address text NOT NULL,
+    CONSTRAINT leader_singleton CHECK (singleton)
+);
 
 
 
-ALTER TABLE ONLY asset_tags
-    ADD CONSTRAINT asset_tags_asset_id_key UNIQUE (asset_id);
+CREATE TABLE ledger_snapshots (
+    id text DEFAULT next_chain_id('lsnap'::text) NOT NULL,
+    block_height bigint NOT NULL,
+    block_id bytea NOT NULL,
+    block_timestamp timestamp with time zone NOT NULL,
+    status text DEFAULT 'pending'::text NOT NULL,
+    path text,
+    sha256 text,
+    assets bigint DEFAULT 0 NOT NULL,
+    unspent_outputs bigint DEFAULT 0 NOT NULL,
+    balances bigint DEFAULT 0 NOT NULL,
+    error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    completed_at timestamp with time zone
+);
 
 
 
-ALTER TABLE ONLY assets
-    ADD CONSTRAINT assets_alias_key UNIQUE (alias);
+CREATE TABLE migrations (
+    filename text NOT NULL,
+    hash text NOT NULL,
+    applied_at timestamp with time zone DEFAULT now() NOT NULL
+);
 
 
 
-ALTER TABLE ONLY assets
-    ADD CONSTRAINT assets_client_token_key UNIQUE (client_token);
+CREATE SEQUENCE mockhsm_sort_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
 
 
 
-ALTER TABLE ONLY assets
-    ADD CONSTRAINT assets_pkey PRIMARY KEY (id);
+CREATE TABLE mockhsm (
+    pub bytea NOT NULL,
+    prv bytea NOT NULL,
+    alias text,
+    sort_id bigint DEFAULT nextval('mockhsm_sort_id_seq'::regclass) NOT NULL,
+    key_type text DEFAULT 'chain_kd'::text NOT NULL
+);
 
 
 
-ALTER TABLE ONLY block_processors
-    ADD CONSTRAINT block_processors_name_key UNIQUE (name);
+CREATE TABLE payment_request_events (
+    id text DEFAULT next_chain_id('pre'::text) NOT NULL,
+    payment_request_id text NOT NULL,
+    type text NOT NULL,
+    received_amount bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+    delivered_at timestamp with time zone
+);
 
 
 
-ALTER TABLE ONLY blocks
-    ADD CONSTRAINT blocks_height_key UNIQUE (height);
+CREATE TABLE payment_requests (
+    id text DEFAULT next_chain_id('pr'::text) NOT NULL,
+    account_id text NOT NULL,
+    control_program bytea NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    received_amount bigint DEFAULT 0 NOT NULL,
+    payer_hints jsonb NOT NULL,
+    status text DEFAULT 'pending'::text NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    callback_url text
+);
+
+
+
+CREATE TABLE payout_batches (
+    id text DEFAULT next_chain_id('pob'::text) NOT NULL,
+    source_account_id text NOT NULL,
+    status text NOT NULL,
+    row_count integer NOT NULL,
+    created_by text,
+    approved_by text,
+    review_note text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    reviewed_at timestamp with time zone,
+    completed_at timestamp with time zone
+);
+
+
+
+CREATE TABLE payout_rows (
+    batch_id text NOT NULL,
+    "position" integer NOT NULL,
+    destination_account_id text,
+    destination_control_program bytea,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    reference text,
+    status text NOT NULL,
+    error text,
+    tx_hash bytea,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE query_blocks (
+    height bigint NOT NULL,
+    "timestamp" bigint NOT NULL
+);
+
+
+
+CREATE TABLE receipt_key (
+    singleton boolean DEFAULT true NOT NULL,
+    private_key bytea NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT receipt_key_singleton CHECK (singleton)
+);
+
+
+
+CREATE TABLE request_nonces (
+    access_token_id text NOT NULL,
+    nonce text NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+
+
+CREATE TABLE request_signing_secrets (
+    access_token_id text NOT NULL,
+    secret bytea NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE rule_activity (
+    tx_hash bytea NOT NULL,
+    account_id text NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE rule_counterparties (
+    account_id text NOT NULL,
+    control_program bytea NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE rule_matches (
+    id text DEFAULT next_chain_id('rm'::text) NOT NULL,
+    rule_id text NOT NULL,
+    tx_hash bytea NOT NULL,
+    account_id text NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    action text NOT NULL,
+    reason text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+    delivered_at timestamp with time zone
+);
+
+
+
+CREATE TABLE rules (
+    id text DEFAULT next_chain_id('rule'::text) NOT NULL,
+    name text NOT NULL,
+    account_id text,
+    asset_id bytea,
+    window_ms bigint DEFAULT 0 NOT NULL,
+    max_amount bigint DEFAULT 0 NOT NULL,
+    new_counterparty boolean DEFAULT false NOT NULL,
+    action text NOT NULL,
+    webhook_url text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE service_accounts (
+    id text DEFAULT next_chain_id('sa'::text) NOT NULL,
+    alias text NOT NULL,
+    description text DEFAULT ''::text NOT NULL,
+    policies text[] DEFAULT '{}'::text[] NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE signed_blocks (
+    block_height bigint NOT NULL,
+    block_hash bytea NOT NULL
+);
+
+
+
+CREATE TABLE signers (
+    id text NOT NULL,
+    type text NOT NULL,
+    key_index bigint NOT NULL,
+    quorum integer NOT NULL,
+    client_token text,
+    xpubs bytea[] NOT NULL
+);
+
+
+
+CREATE SEQUENCE signers_key_index_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+
+ALTER SEQUENCE signers_key_index_seq OWNED BY signers.key_index;
+
+
+
+CREATE TABLE singleton_workers (
+    name text NOT NULL,
+    address text NOT NULL,
+    acquired_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE snapshots (
+    height bigint NOT NULL,
+    data bytea NOT NULL,
+    created_at timestamp without time zone DEFAULT now()
+);
+
+
+
+CREATE TABLE submitted_txs (
+    tx_hash bytea NOT NULL,
+    height bigint NOT NULL,
+    submitted_at timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE subscription_executions (
+    id text DEFAULT next_chain_id('subx'::text) NOT NULL,
+    subscription_id text NOT NULL,
+    scheduled_at timestamp with time zone NOT NULL,
+    amount bigint NOT NULL,
+    status text DEFAULT 'submitting'::text NOT NULL,
+    tx_hash bytea,
+    error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE subscriptions (
+    id text DEFAULT next_chain_id('sub'::text) NOT NULL,
+    asset_id bytea NOT NULL,
+    amount bigint NOT NULL,
+    source_account_id text NOT NULL,
+    destination_account_id text,
+    destination_control_program bytea,
+    interval_unit text NOT NULL,
+    interval_count integer NOT NULL,
+    start_at timestamp with time zone NOT NULL,
+    end_at timestamp with time zone,
+    max_failures integer NOT NULL,
+    status text DEFAULT 'active'::text NOT NULL,
+    period bigint DEFAULT 0 NOT NULL,
+    next_payment_at timestamp with time zone,
+    failures integer DEFAULT 0 NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+
+CREATE TABLE txfeeds (
+    id text DEFAULT next_chain_id('cur'::text) NOT NULL,
+    alias text,
+    filter text,
+    after text,
+    client_token text
+);
+
+
+
+CREATE TABLE usage_daily (
+    day date NOT NULL,
+    metric text NOT NULL,
+    value bigint DEFAULT 0 NOT NULL
+);
+
+
+
+CREATE TABLE usage_warnings (
+    day date NOT NULL,
+    metric text NOT NULL,
+    level text NOT NULL,
+    value bigint NOT NULL,
+    quota bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+    delivered_at timestamp with time zone
+);
+
+
+
+ALTER TABLE ONLY events ALTER COLUMN seq SET DEFAULT nextval('events_seq_seq'::regclass);
+
+
+
+ALTER TABLE ONLY signers ALTER COLUMN key_index SET DEFAULT nextval('signers_key_index_seq'::regclass);
+
+
+
+ALTER TABLE ONLY access_tokens
+    ADD CONSTRAINT access_tokens_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY account_control_programs
+    ADD CONSTRAINT account_control_programs_pkey PRIMARY KEY (control_program);
+
+
+
+ALTER TABLE ONLY accounts
+    ADD CONSTRAINT account_tags_pkey PRIMARY KEY (account_id);
+
+
+
+ALTER TABLE ONLY account_receiver_payments
+    ADD CONSTRAINT account_receiver_payments_pkey PRIMARY KEY (output_id);
+
+
+
+ALTER TABLE ONLY account_receivers
+    ADD CONSTRAINT account_receivers_pkey PRIMARY KEY (control_program);
+
+
+
+ALTER TABLE ONLY account_statements
+    ADD CONSTRAINT account_statements_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY account_utxos
+    ADD CONSTRAINT account_utxos_pkey PRIMARY KEY (output_id);
+
+
+
+ALTER TABLE ONLY accounts
+    ADD CONSTRAINT accounts_alias_key UNIQUE (alias);
+
+
+
+ALTER TABLE ONLY accrual_rules
+    ADD CONSTRAINT accrual_rules_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY accruals
+    ADD CONSTRAINT accruals_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY accruals
+    ADD CONSTRAINT accruals_rule_id_account_id_period_end_key UNIQUE (rule_id, account_id, period_end);
+
+
+
+ALTER TABLE ONLY address_book
+    ADD CONSTRAINT address_book_pkey PRIMARY KEY (alias);
+
+
+
+ALTER TABLE ONLY annotated_accounts
+    ADD CONSTRAINT annotated_accounts_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY annotated_assets
+    ADD CONSTRAINT annotated_assets_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY annotated_inputs
+    ADD CONSTRAINT annotated_inputs_pkey PRIMARY KEY (tx_hash, index);
+
+
+
+ALTER TABLE ONLY annotated_outputs
+    ADD CONSTRAINT annotated_outputs_output_id_key UNIQUE (output_id);
+
+
+
+ALTER TABLE ONLY annotated_outputs
+    ADD CONSTRAINT annotated_outputs_pkey PRIMARY KEY (block_height, tx_pos, output_index);
+
+
+
+ALTER TABLE ONLY annotated_txs
+    ADD CONSTRAINT annotated_txs_pkey PRIMARY KEY (block_height, tx_pos);
+
+
+
+ALTER TABLE ONLY asset_circulation
+    ADD CONSTRAINT asset_circulation_pkey PRIMARY KEY (asset_id);
+
+
+
+ALTER TABLE ONLY asset_ledger_totals
+    ADD CONSTRAINT asset_ledger_totals_pkey PRIMARY KEY (asset_id);
+
+
+
+ALTER TABLE ONLY asset_stats_blocks
+    ADD CONSTRAINT asset_stats_blocks_pkey PRIMARY KEY (height);
+
+
+
+ALTER TABLE ONLY asset_stats
+    ADD CONSTRAINT asset_stats_pkey PRIMARY KEY (asset_id, hour);
+
+
+
+ALTER TABLE ONLY asset_tags
+    ADD CONSTRAINT asset_tags_asset_id_key UNIQUE (asset_id);
+
+
+
+ALTER TABLE ONLY assets
+    ADD CONSTRAINT assets_alias_key UNIQUE (alias);
+
+
+
+ALTER TABLE ONLY assets
+    ADD CONSTRAINT assets_client_token_key UNIQUE (client_token);
+
+
+
+ALTER TABLE ONLY assets
+    ADD CONSTRAINT assets_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY block_processors
+    ADD CONSTRAINT block_processors_name_key UNIQUE (name);
+
+
+
+ALTER TABLE ONLY blocks
+    ADD CONSTRAINT blocks_height_key UNIQUE (height);
 
 
 
@@ -562,11 +1234,146 @@ ALTER TABLE ONLY core_id
 
 
 
+ALTER TABLE ONLY counterparties
+    ADD CONSTRAINT counterparties_alias_key UNIQUE (alias);
+
+
+
+ALTER TABLE ONLY counterparties
+    ADD CONSTRAINT counterparties_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY escrows
+    ADD CONSTRAINT escrows_control_program_key UNIQUE (control_program);
+
+
+
+ALTER TABLE ONLY escrows
+    ADD CONSTRAINT escrows_output_id_key UNIQUE (output_id);
+
+
+
+ALTER TABLE ONLY escrows
+    ADD CONSTRAINT escrows_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY event_cursors
+    ADD CONSTRAINT event_cursors_pkey PRIMARY KEY (name);
+
+
+
+ALTER TABLE ONLY events
+    ADD CONSTRAINT events_pkey PRIMARY KEY (seq);
+
+
+
+ALTER TABLE ONLY federation_key
+    ADD CONSTRAINT federation_key_pkey PRIMARY KEY (singleton);
+
+
+
+ALTER TABLE ONLY freezes
+    ADD CONSTRAINT freezes_pkey PRIMARY KEY (type, id);
+
+
+
 ALTER TABLE ONLY generator_pending_block
     ADD CONSTRAINT generator_pending_block_pkey PRIMARY KEY (singleton);
 
 
 
+ALTER TABLE ONLY held_transactions
+    ADD CONSTRAINT held_transactions_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY held_transactions
+    ADD CONSTRAINT held_transactions_tx_hash_key UNIQUE (tx_hash);
+
+
+
+ALTER TABLE ONLY htlcs
+    ADD CONSTRAINT htlcs_control_program_key UNIQUE (control_program);
+
+
+
+ALTER TABLE ONLY htlcs
+    ADD CONSTRAINT htlcs_output_id_key UNIQUE (output_id);
+
+
+
+ALTER TABLE ONLY htlcs
+    ADD CONSTRAINT htlcs_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY ilp_payments
+    ADD CONSTRAINT ilp_payments_peer_id_execution_condition_key UNIQUE (peer_id, execution_condition);
+
+
+
+ALTER TABLE ONLY ilp_payments
+    ADD CONSTRAINT ilp_payments_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY ilp_peers
+    ADD CONSTRAINT ilp_peers_access_token_id_key UNIQUE (access_token_id);
+
+
+
+ALTER TABLE ONLY ilp_peers
+    ADD CONSTRAINT ilp_peers_alias_key UNIQUE (alias);
+
+
+
+ALTER TABLE ONLY ilp_peers
+    ADD CONSTRAINT ilp_peers_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY ilp_pointers
+    ADD CONSTRAINT ilp_pointers_name_key UNIQUE (name);
+
+
+
+ALTER TABLE ONLY ilp_pointers
+    ADD CONSTRAINT ilp_pointers_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY invitations
+    ADD CONSTRAINT invitations_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY issuance_fx_snapshots
+    ADD CONSTRAINT issuance_fx_snapshots_pkey PRIMARY KEY (tx_hash, asset_id);
+
+
+
+ALTER TABLE ONLY jobs
+    ADD CONSTRAINT jobs_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY journal_exports
+    ADD CONSTRAINT journal_exports_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY journal_periods
+    ADD CONSTRAINT journal_periods_end_height_key UNIQUE (end_height);
+
+
+
+ALTER TABLE ONLY journal_periods
+    ADD CONSTRAINT journal_periods_pkey PRIMARY KEY (id);
+
+
+
 ALTER TABLE ONLY leader
     ADD CONSTRAINT leader_singleton_key UNIQUE (singleton);
 
@@ -577,6 +1384,11 @@ ALTER TABLE ONLY migrations
 
 
 
+ALTER TABLE ONLY ledger_snapshots
+    ADD CONSTRAINT ledger_snapshots_pkey PRIMARY KEY (id);
+
+
+
 ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT mockhsm_alias_key UNIQUE (alias);
 
@@ -587,11 +1399,81 @@ ALTER TABLE ONLY mockhsm
 
 
 
+ALTER TABLE ONLY payment_request_events
+    ADD CONSTRAINT payment_request_events_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY payment_requests
+    ADD CONSTRAINT payment_requests_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY payout_batches
+    ADD CONSTRAINT payout_batches_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY payout_rows
+    ADD CONSTRAINT payout_rows_pkey PRIMARY KEY (batch_id, "position");
+
+
+
 ALTER TABLE ONLY query_blocks
     ADD CONSTRAINT query_blocks_pkey PRIMARY KEY (height);
 
 
 
+ALTER TABLE ONLY receipt_key
+    ADD CONSTRAINT receipt_key_pkey PRIMARY KEY (singleton);
+
+
+
+ALTER TABLE ONLY request_nonces
+    ADD CONSTRAINT request_nonces_pkey PRIMARY KEY (access_token_id, nonce);
+
+
+
+ALTER TABLE ONLY request_signing_secrets
+    ADD CONSTRAINT request_signing_secrets_pkey PRIMARY KEY (access_token_id);
+
+
+
+ALTER TABLE ONLY rule_activity
+    ADD CONSTRAINT rule_activity_pkey PRIMARY KEY (tx_hash, account_id, asset_id);
+
+
+
+ALTER TABLE ONLY rule_counterparties
+    ADD CONSTRAINT rule_counterparties_pkey PRIMARY KEY (account_id, control_program);
+
+
+
+ALTER TABLE ONLY rule_matches
+    ADD CONSTRAINT rule_matches_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY rule_matches
+    ADD CONSTRAINT rule_matches_rule_id_tx_hash_account_id_asset_id_key UNIQUE (rule_id, tx_hash, account_id, asset_id);
+
+
+
+ALTER TABLE ONLY rules
+    ADD CONSTRAINT rules_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY service_accounts
+    ADD CONSTRAINT service_accounts_alias_key UNIQUE (alias);
+
+
+
+ALTER TABLE ONLY service_accounts
+    ADD CONSTRAINT service_accounts_pkey PRIMARY KEY (id);
+
+
+
 ALTER TABLE ONLY signers
     ADD CONSTRAINT signers_client_token_key UNIQUE (client_token);
 
@@ -602,6 +1484,11 @@ ALTER TABLE ONLY signers
 
 
 
+ALTER TABLE ONLY singleton_workers
+    ADD CONSTRAINT singleton_workers_pkey PRIMARY KEY (name);
+
+
+
 ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT sort_id_index UNIQUE (sort_id);
 
@@ -617,6 +1504,21 @@ ALTER TABLE ONLY submitted_txs
 
 
 
+ALTER TABLE ONLY subscription_executions
+    ADD CONSTRAINT subscription_executions_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY subscription_executions
+    ADD CONSTRAINT subscription_executions_subscription_id_scheduled_at_key UNIQUE (subscription_id, scheduled_at);
+
+
+
+ALTER TABLE ONLY subscriptions
+    ADD CONSTRAINT subscriptions_pkey PRIMARY KEY (id);
+
+
+
 ALTER TABLE ONLY txfeeds
     ADD CONSTRAINT txfeeds_alias_key UNIQUE (alias);
 
@@ -632,10 +1534,40 @@ ALTER TABLE ONLY txfeeds
 
 
 
+ALTER TABLE ONLY usage_daily
+    ADD CONSTRAINT usage_daily_pkey PRIMARY KEY (day, metric);
+
+
+
+ALTER TABLE ONLY usage_warnings
+    ADD CONSTRAINT usage_warnings_pkey PRIMARY KEY (day, metric, level);
+
+
+
+CREATE INDEX access_tokens_service_account_id_idx ON access_tokens USING btree (service_account_id) WHERE (service_account_id IS NOT NULL);
+
+
+
+CREATE INDEX account_receiver_payments_control_program_idx ON account_receiver_payments USING btree (control_program);
+
+
+
+CREATE INDEX account_receivers_account_id_id_idx ON account_receivers USING btree (account_id, id);
+
+
+
+CREATE INDEX account_statements_account_id_created_at_idx ON account_statements USING btree (account_id, created_at);
+
+
+
 CREATE INDEX account_utxos_asset_id_account_id_confirmed_in_idx ON account_utxos USING btree (asset_id, account_id, confirmed_in);
 
 
 
+CREATE INDEX accruals_account_id_id_idx ON accruals USING btree (account_id, id);
+
+
+
 CREATE INDEX annotated_assets_sort_id ON annotated_assets USING btree (sort_id);
 
 
@@ -644,18 +1576,110 @@ CREATE INDEX annotated_outputs_timespan_idx ON annotated_outputs USING gist (tim
 
 
 
+CREATE INDEX annotated_outputs_unspent_asset_idx ON annotated_outputs USING btree (asset_id) WHERE ((account_id IS NOT NULL) AND upper_inf(timespan));
+
+
+
 CREATE INDEX annotated_txs_data_idx ON annotated_txs USING gin (data jsonb_path_ops);
 
 
 
+CREATE INDEX asset_stats_blocks_unreconciled_idx ON asset_stats_blocks USING btree (height) WHERE (NOT reconciled);
+
+
+
+CREATE INDEX escrows_status_id_idx ON escrows USING btree (status, id);
+
+
+
+CREATE INDEX events_type_seq_idx ON events USING btree (type, seq);
+
+
+
+CREATE UNIQUE INDEX events_type_subject_idx ON events USING btree (type, subject) WHERE once;
+
+
+
+CREATE INDEX held_transactions_created_at_idx ON held_transactions USING btree (created_at);
+
+
+
+CREATE INDEX held_transactions_status_idx ON held_transactions USING btree (status, id);
+
+
+
+CREATE INDEX htlcs_status_expires_at_idx ON htlcs USING btree (status, expires_at);
+
+
+
+CREATE INDEX htlcs_status_id_idx ON htlcs USING btree (status, id);
+
+
+
+CREATE INDEX ilp_payments_status_id_idx ON ilp_payments USING btree (status, id);
+
+
+
+CREATE INDEX issuance_fx_snapshots_asset_id_as_of_idx ON issuance_fx_snapshots USING btree (asset_id, as_of);
+
+
+
+CREATE UNIQUE INDEX jobs_recurring_kind_idx ON jobs USING btree (kind) WHERE recurring;
+
+
+
+CREATE INDEX jobs_status_run_at_idx ON jobs USING btree (status, run_at);
+
+
+
+CREATE INDEX payment_request_events_created_at_idx ON payment_request_events USING btree (created_at);
+
+
+
+CREATE INDEX payment_request_events_undelivered_idx ON payment_request_events USING btree (id) WHERE (delivered_at IS NULL);
+
+
+
+CREATE INDEX payment_requests_control_program_idx ON payment_requests USING btree (control_program);
+
+
+
+CREATE INDEX payment_requests_status_expires_at_idx ON payment_requests USING btree (status, expires_at);
+
+
+
+CREATE INDEX payout_batches_status_idx ON payout_batches USING btree (status, id);
+
+
+
 CREATE INDEX query_blocks_timestamp_idx ON query_blocks USING btree ("timestamp");
 
 
 
+CREATE INDEX request_nonces_expires_at_idx ON request_nonces USING btree (expires_at);
+
+
+
+CREATE INDEX rule_activity_account_id_asset_id_created_at_idx ON rule_activity USING btree (account_id, asset_id, created_at);
+
+
+
+CREATE INDEX rule_matches_created_at_idx ON rule_matches USING btree (created_at);
+
+
+
+CREATE INDEX rule_matches_undelivered_idx ON rule_matches USING btree (id) WHERE ((action = 'webhook'::text) AND (delivered_at IS NULL));
+
+
+
 CREATE UNIQUE INDEX signed_blocks_block_height_idx ON signed_blocks USING btree (block_height);
 
 
 
+CREATE INDEX subscriptions_status_next_payment_at_idx ON subscriptions USING btree (status, next_payment_at);
+
+
+
 
 insert into migrations (filename, hash) values ('2017-02-03.0.core.schema-snapshot.sql', '1d55668affe0be9f3c19ead9d67bc75cfd37ec430651434d0f2af2706d9f08cd');
 insert into migrations (filename, hash) values ('2017-02-07.0.query.non-null-alias.sql', '17028a0bdbc95911e299dc65fe641184e54c87a0d07b3c576d62d023b9a8defc');
@@ -668,3 +1692,41 @@ insert into migrations (filename, hash) values ('2017-04-17.0.core.null-token-ty
 insert into migrations (filename, hash) values ('2017-04-27.0.generator.pending-block-height.sql', 'bfe4fe5eec143e4367a91fd952cb5e3879f1c311f649ec13bfe95b202e94d4ec');
 insert into migrations (filename, hash) values ('2017-05-08.0.core.drop-redundant-indexes.sql', '5140e53b287b058c57ddf361d61cff3d3d1cbc3259a9de413b11574a71d09bec');
 insert into migrations (filename, hash) values ('2017-06-28.0.core.coreid.sql', 'a147b93ba1bf404265efedde066532c937070a87e15123b1d9277daba431ee01');
+insert into migrations (filename, hash) values ('2017-07-05.0.core.freezes.sql', 'a5cf380177d46788474f97759fed8c6f8e4b6a6bebd0fca071513a7737fc20a9');
+insert into migrations (filename, hash) values ('2017-07-06.0.core.asset-stats.sql', '63b23a9fc5178548a7aff978cf29285c3504f65328b67baac81d126ceaa41434');
+insert into migrations (filename, hash) values ('2017-07-07.0.core.address-book.sql', '126cd09aa4b047c1c69ea99fd6bad184cf373486fb4385c61cd92dfc96ac47e3');
+insert into migrations (filename, hash) values ('2017-07-10.0.account.receivers.sql', 'fbc090afcc17093f0557f768e69cd078eec0ed8762370c36d2e4f58f7c659811');
+insert into migrations (filename, hash) values ('2017-07-11.0.core.payment-requests.sql', 'c38a7ddcf695e49e7865f87d9ec15d64d4dce52a7bf634e2ca87372661c5e1af');
+insert into migrations (filename, hash) values ('2017-07-12.0.core.payment-request-events.sql', '349ce8e87b6969aea2eb54e3ff693106535d1d11ef6cd7c5319fee089497a461');
+insert into migrations (filename, hash) values ('2017-07-13.0.core.issuance-fx-snapshots.sql', 'b5f6309ac3bfca2f70b4460db1e6c2d4a66aecb40e58db0cf0daf9d26b8ea192');
+insert into migrations (filename, hash) values ('2017-07-14.0.core.access-token-environment.sql', 'ad09c4a88967f0ce4b8f2f7b066acff0e97d739cc367bd401889261c16368388');
+insert into migrations (filename, hash) values ('2017-07-17.0.account.archive.sql', '76cd835c50a50dbbc21ab29f655ed33c18054117e55957ef57263ae685160615');
+insert into migrations (filename, hash) values ('2017-07-18.0.core.held-transactions.sql', '4af29a76063c71fa0fb99c1193f411c6f34b4372d421351e130e801434a229fa');
+insert into migrations (filename, hash) values ('2017-07-19.0.core.held-transaction-reviews.sql', 'c598f4681b6ad0f2fe751ab01ff6a88463fed12a40ac14617257a2e0213ce80d');
+insert into migrations (filename, hash) values ('2017-07-20.0.core.rules.sql', 'ea7cf8196749d844abe0c56d78932a8f173ac56236c2c4e169e23ae54a1d9b1c');
+insert into migrations (filename, hash) values ('2017-07-21.0.core.receipt-key.sql', '5b451525448d80da07cbc881a80f8f05110edb6420c4fd1f2a9b58e81a80e7b1');
+insert into migrations (filename, hash) values ('2017-07-22.0.core.usage.sql', '823563b3237ddfb9238ee9c8d9be54d9faac77c204a677ab614122b4b55b31f6');
+insert into migrations (filename, hash) values ('2017-07-23.0.core.invitations.sql', 'e4f0d2d5b5a37f6d88ba16daf06497ba10634405e22eaa92d0576820655b22ed');
+insert into migrations (filename, hash) values ('2017-07-24.0.core.service-accounts.sql', 'e80e87e8b863875466ae3ed2deb528dd1e8336b352530c11e90cc6137e3b4e3b');
+insert into migrations (filename, hash) values ('2017-07-25.0.core.request-signing.sql', '740b567a61ff6a3362872fe093c9f63e9332795eb53e2ff81a13f89cb44bfcc8');
+insert into migrations (filename, hash) values ('2017-07-26.0.core.retention.sql', 'be7910dad9774f4fff60b938ca1477fa3a784403c98c4d6bd4bb7d82ade0b5ae');
+insert into migrations (filename, hash) values ('2017-07-27.0.core.ledger-snapshots.sql', '60d000d2886a33da5430e4491c2f061335a5ae735cd99330019a8335734dde7b');
+insert into migrations (filename, hash) values ('2017-07-28.0.core.asset-circulation.sql', 'fc2e9ea08269123af04520a3368e4fab2a75df5660bc3c1e941dd2fdb5601310');
+insert into migrations (filename, hash) values ('2017-07-29.0.core.jobs.sql', '97e0488ed4e6e4f2e49b97b7180fb77b241441edd6409c7f5a0554d9f121ca1b');
+insert into migrations (filename, hash) values ('2017-07-30.0.core.singleton-workers.sql', '9940fc40da84fcd7dba43bbcdac130de8cd798007dac81a9809ff06eba43b8b9');
+insert into migrations (filename, hash) values ('2017-07-31.0.core.events.sql', '1a08784857006537696f7841c72c1d7dd7acaf1172a76b4cfe485eec3175ee02');
+insert into migrations (filename, hash) values ('2017-08-01.0.core.event-publisher.sql', '2369535aa7359e94106031e70b91bcc06efa6f04b8f6f46a37a2fff46f187038');
+insert into migrations (filename, hash) values ('2017-08-02.0.core.journal-periods.sql', 'e9835b584102a897d490e2223f9dc2b7bf1bba0556047abc154a70b2ea35ada7');
+insert into migrations (filename, hash) values ('2017-08-03.0.core.journal-exports.sql', '03b0fe9df204c22ef74db9a5fb42b2273b4a833c26dd4d7114ffd0a49099fc1d');
+insert into migrations (filename, hash) values ('2017-08-04.0.core.account-statements.sql', 'dbc4c2731901ec3e4dfe93dc559f4a470763a3da3b2c12e1a2d683ad288d486a');
+insert into migrations (filename, hash) values ('2017-08-05.0.core.accruals.sql', '2ac489b1786b5a64b8a7ab9effc9b38e46db16c9e37a41d5a7702a51b148b17f');
+insert into migrations (filename, hash) values ('2017-08-06.0.core.escrows.sql', 'a34208f478b2ef88806a63c79e21fd09c86432bf59f09b8cd2d86a874670e377');
+insert into migrations (filename, hash) values ('2017-08-07.0.core.output-locks.sql', '8cf955f3ad11818f86b793dc728d4427862825afd6fec847e5602397c3699dbd');
+insert into migrations (filename, hash) values ('2017-08-08.0.core.subscriptions.sql', 'd921f937e1505750c20a351e35221a51ef31a6b29670aca60bf209c2e98957b4');
+insert into migrations (filename, hash) values ('2017-08-09.0.core.payout-batches.sql', '6ff230090c439b858ca185258aa2c98c650bc75eaee8d0037f1d136e2aed7922');
+insert into migrations (filename, hash) values ('2017-08-10.0.core.counterparties.sql', '60256cd64e0ec267395ebab2801bdaeb2bcc60800d5e6d6bd486d0c3483ecbc9');
+insert into migrations (filename, hash) values ('2017-08-11.0.core.htlcs.sql', 'd6cdf5462c14e4031c30f3eb0f8a8c29f82d91d01e24957c3495992c9f8c70fa');
+insert into migrations (filename, hash) values ('2017-08-12.0.core.ilp.sql', '97736555fc6761502f0d4f5de4b1355dacff538917713a7639196b02b064fa40');
+insert into migrations (filename, hash) values ('2017-08-13.0.core.asset-stats-backfill.sql', 'd7a0ba69a928f061f97f856f7018b7e037df127f648e1bf49280aefb22f6c9f9');
+insert into migrations (filename, hash) values ('2017-08-14.0.core.asset-ledger-totals.sql', 'f06f503720a3874284a3bbca0c0319ef48d9868bca5023a0e8f3266da6921649');
+insert into migrations (filename, hash) values ('2017-08-15.0.core.ledger-verify-index.sql', '5e7d0fb1d37fd3dea0fb09d089e72f06078a01bc0d34cfd2f9acf7a41afdbf4f');
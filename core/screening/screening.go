@@ -0,0 +1,132 @@
+// Package screening checks transactions against compliance
+// rules, such as sanctions or anti-money-laundering screens,
+// before they are submitted to the blockchain.
+//
+// A Screener decides whether each transaction may be
+// submitted. It can approve the transaction, deny it, or hold
+// it for manual review.
+package screening
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+)
+
+// Screening decisions.
+const (
+	Approve = "approve"
+	Deny    = "deny"
+	Hold    = "hold"
+)
+
+var (
+	// ErrDenied is returned when submitting a transaction
+	// that the screener denied.
+	ErrDenied = errors.New("transaction denied by compliance screening")
+
+	// ErrHeld is returned when submitting a transaction
+	// that the screener held for review.
+	ErrHeld = errors.New("transaction held for compliance review")
+
+	// ErrBadDecision is returned for a screening result
+	// with an unknown decision.
+	ErrBadDecision = errors.New("invalid screening decision")
+)
+
+// Output describes an output of a transaction being screened.
+type Output struct {
+	AssetID        bc.AssetID         `json:"asset_id"`
+	Amount         uint64             `json:"amount"`
+	ControlProgram chainjson.HexBytes `json:"control_program"`
+	ReferenceData  chainjson.HexBytes `json:"reference_data"`
+}
+
+// Request describes a transaction to screen.
+type Request struct {
+	TransactionID bc.Hash            `json:"transaction_id"`
+	Outputs       []Output           `json:"outputs"`
+	ReferenceData chainjson.HexBytes `json:"reference_data"`
+}
+
+// NewRequest returns a Request describing tx.
+func NewRequest(tx *legacy.Tx) *Request {
+	req := &Request{
+		TransactionID: tx.ID,
+		ReferenceData: tx.ReferenceData,
+		Outputs:       []Output{}, // send [], not null
+	}
+	for _, out := range tx.Outputs {
+		req.Outputs = append(req.Outputs, Output{
+			AssetID:        *out.AssetId,
+			Amount:         out.Amount,
+			ControlProgram: out.ControlProgram,
+			ReferenceData:  out.ReferenceData,
+		})
+	}
+	return req
+}
+
+// Result is a Screener's decision about a transaction.
+// Reason explains a denial or hold.
+type Result struct {
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+}
+
+// A Screener decides whether transactions may be submitted.
+// If Screen returns an error, the transaction is not
+// submitted.
+type Screener interface {
+	Screen(context.Context, *Request) (*Result, error)
+}
+
+// HTTP is a Screener that POSTs each Request as JSON to URL,
+// and reads the Result from the JSON response.
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+// Screen implements Screener.
+func (h *HTTP) Screen(ctx context.Context, req *Request) (*Result, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	hreq, err := http.NewRequest("POST", h.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(hreq.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "calling screening service")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.Wrapf(errors.New("screening service error"), "status %d", resp.StatusCode)
+	}
+
+	res := new(Result)
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding screening result")
+	}
+	switch res.Decision {
+	case Approve, Deny, Hold:
+		return res, nil
+	}
+	return nil, errors.WithDetailf(ErrBadDecision, "unknown decision %q", res.Decision)
+}
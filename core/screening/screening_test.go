@@ -0,0 +1,54 @@
+package screening
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/testutil"
+)
+
+func TestHTTPScreen(t *testing.T) {
+	var (
+		got      Request
+		decision string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		err := json.NewDecoder(req.Body).Decode(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(Result{Decision: decision, Reason: "sanctions list match"})
+	}))
+	defer srv.Close()
+
+	tx := legacy.NewTx(legacy.TxData{
+		Version: 1,
+		Outputs: []*legacy.TxOutput{legacy.NewTxOutput(bc.AssetID{V0: 1}, 5, []byte{0x51}, nil)},
+	})
+	s := &HTTP{URL: srv.URL}
+	ctx := context.Background()
+
+	decision = Hold
+	res, err := s.Screen(ctx, NewRequest(tx))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if res.Decision != Hold || res.Reason != "sanctions list match" {
+		t.Errorf("Screen() = %+v, want hold for sanctions list match", res)
+	}
+	if got.TransactionID != tx.ID || len(got.Outputs) != 1 || got.Outputs[0].Amount != 5 {
+		t.Errorf("screening service got %+v, want tx %x with one output of 5", got, tx.ID.Bytes())
+	}
+
+	decision = "maybe"
+	_, err = s.Screen(ctx, NewRequest(tx))
+	if errors.Root(err) != ErrBadDecision {
+		t.Errorf("Screen() with unknown decision: error = %v, want %v", err, ErrBadDecision)
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+
+	"chain/core/accesstoken"
+	"chain/database/sinkdb"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/authz"
+)
+
+// tokenGrant returns a grant of policy to the access token
+// with the given ID.
+func tokenGrant(tokenID, policy string) *authz.Grant {
+	guardData, _ := json.Marshal(map[string]interface{}{"id": tokenID}) // can't fail
+	return &authz.Grant{
+		GuardType: "access_token",
+		GuardData: guardData,
+		Policy:    policy,
+	}
+}
+
+// checkMemberPolicies returns an error unless every policy
+// may be granted to members.
+func checkMemberPolicies(policies []string) error {
+	for _, p := range policies {
+		if !memberPolicies[p] {
+			return errors.WithDetailf(errBadMemberPolicy, "policy %q can't be bound to a service account", p)
+		}
+	}
+	return nil
+}
+
+// POST /create-service-account
+func (a *API) createServiceAccount(ctx context.Context, x struct {
+	Alias       string   `json:"alias"`
+	Description string   `json:"description"`
+	Policies    []string `json:"policies"`
+}) (*accesstoken.ServiceAccount, error) {
+	err := checkMemberPolicies(x.Policies)
+	if err != nil {
+		return nil, err
+	}
+	return a.accessTokens.CreateServiceAccount(ctx, x.Alias, x.Description, x.Policies)
+}
+
+// serviceAccountList is the response to /list-service-accounts.
+type serviceAccountList struct {
+	Items []*accesstoken.ServiceAccount `json:"items"`
+}
+
+// POST /list-service-accounts
+func (a *API) listServiceAccounts(ctx context.Context) (*serviceAccountList, error) {
+	list, err := a.accessTokens.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*accesstoken.ServiceAccount{} // send [], not null
+	}
+	return &serviceAccountList{Items: list}, nil
+}
+
+// POST /update-service-account-policies
+//
+// Replaces the policies bound to a service account, and
+// regrants its tokens accordingly.
+func (a *API) updateServiceAccountPolicies(ctx context.Context, x struct {
+	ID       string   `json:"id"`
+	Policies []string `json:"policies"`
+}) (*accesstoken.ServiceAccount, error) {
+	err := checkMemberPolicies(x.Policies)
+	if err != nil {
+		return nil, err
+	}
+	sa, err := a.accessTokens.SetServiceAccountPolicies(ctx, x.ID, x.Policies)
+	if err != nil {
+		return nil, err
+	}
+	tokenIDs, err := a.accessTokens.ServiceTokenIDs(ctx, sa.ID)
+	if err != nil {
+		return nil, err
+	}
+	var ops []sinkdb.Op
+	for _, id := range tokenIDs {
+		ops = append(ops, a.deleteGrantsByAccessToken(id))
+		for _, p := range sa.Policies {
+			ops = append(ops, a.grants.Save(ctx, tokenGrant(id, p)))
+		}
+	}
+	err = a.sdb.Exec(ctx, ops...)
+	if err != nil {
+		return nil, errors.Wrap(err, "regranting service account tokens")
+	}
+	return sa, nil
+}
+
+// POST /create-service-account-token
+//
+// Creates an access token for a service account, granted
+// the policies bound to the service account.
+func (a *API) createServiceAccountToken(ctx context.Context, x struct {
+	ServiceAccountID string `json:"service_account_id"`
+	ID               string `json:"id"`
+}) (*accesstoken.Token, error) {
+	sa, err := a.accessTokens.FindServiceAccount(ctx, x.ServiceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := a.accessTokens.CreateServiceToken(ctx, x.ID, sa.ID)
+	if err != nil {
+		return nil, err
+	}
+	var ops []sinkdb.Op
+	for _, p := range sa.Policies {
+		ops = append(ops, a.grants.Save(ctx, tokenGrant(token.ID, p)))
+	}
+	err = a.sdb.Exec(ctx, ops...)
+	if err != nil {
+		a.discardAccessToken(ctx, token.ID)
+		return nil, errors.Wrap(err)
+	}
+	return token, nil
+}
+
+// POST /delete-service-account
+//
+// Deletes a service account and its access tokens.
+func (a *API) deleteServiceAccount(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) error {
+	tokenIDs, err := a.accessTokens.DeleteServiceAccount(ctx, x.ID)
+	if err != nil {
+		return err
+	}
+	var ops []sinkdb.Op
+	for _, id := range tokenIDs {
+		ops = append(ops, a.deleteGrantsByAccessToken(id))
+	}
+	err = a.sdb.Exec(ctx, ops...)
+	if err != nil {
+		// The tokens are already deleted, so their grants
+		// can't authorize anything.
+		log.Error(ctx, err, "revoking grants of service account "+x.ID)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package simulate
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// model tracks the balances the simulated workload should
+// have produced. Amounts being spent by transactions in
+// flight are taken out of the balances until the transaction
+// succeeds or fails, so concurrent operations never plan to
+// spend the same funds.
+type model struct {
+	mu       sync.Mutex
+	balances map[string]map[string]uint64 // account alias -> asset alias -> amount
+	issued   map[string]uint64            // asset alias -> amount
+	retired  map[string]uint64
+	inFlight int
+}
+
+func newModel(accounts []string) *model {
+	m := &model{
+		balances: make(map[string]map[string]uint64),
+		issued:   make(map[string]uint64),
+		retired:  make(map[string]uint64),
+	}
+	for _, acc := range accounts {
+		m.balances[acc] = make(map[string]uint64)
+	}
+	return m
+}
+
+// take removes up to amount of asset from account's balance
+// for a spend, returning the amount taken.
+func (m *model) take(account, asset string, amount uint64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if have := m.balances[account][asset]; have < amount {
+		amount = have
+	}
+	if amount > 0 {
+		m.balances[account][asset] -= amount
+		m.inFlight++
+	}
+	return amount
+}
+
+// refund returns an amount taken for a spend that failed.
+func (m *model) refund(account, asset string, amount uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.balances[account][asset] += amount
+	m.inFlight--
+}
+
+// issued records a successful issuance into account.
+func (m *model) issue(account, asset string, amount uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.balances[account][asset] += amount
+	m.issued[asset] += amount
+}
+
+// transfer records a successful transfer of an amount
+// taken from another account into account.
+func (m *model) transfer(account, asset string, amount uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.balances[account][asset] += amount
+	m.inFlight--
+}
+
+// retire records the successful retirement of a taken
+// amount.
+func (m *model) retire(asset string, amount uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retired[asset] += amount
+	m.inFlight--
+}
+
+// held returns the assets account holds in the model.
+func (m *model) held(account string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var assets []string
+	for asset, amount := range m.balances[account] {
+		if amount > 0 {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets)
+	return assets
+}
+
+// sheetEntry is the part of a balance sheet entry the
+// invariants cover.
+type sheetEntry struct {
+	Issued       uint64 `json:"issued"`
+	Retired      uint64 `json:"retired"`
+	Outstanding  uint64 `json:"outstanding"`
+	HeldByIssuer uint64 `json:"held_by_issuer"`
+}
+
+// check compares the model against the balances the Core
+// reports for each account and asset, and the Core's balance
+// sheet entry for each asset, returning a description of each
+// invariant violated. It must be called with no operations in
+// flight.
+//
+// The invariants are:
+//   - conservation: each asset's balances across the
+//     accounts add up to the amount issued less the amount
+//     retired;
+//   - each account holds what the model says it should;
+//   - circulation: the balance sheet's issued and retired
+//     amounts match those of the workload, its outstanding
+//     amount is their difference, and all of that is held in
+//     the Core's accounts.
+func (m *model) check(balances map[string]map[string]uint64, sheet map[string]sheetEntry) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var violations []string
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+	if m.inFlight != 0 {
+		fail("%d operations still in flight", m.inFlight)
+	}
+
+	var accounts []string
+	for acc := range m.balances {
+		accounts = append(accounts, acc)
+	}
+	sort.Strings(accounts)
+	var assets []string
+	for asset := range m.issued {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	for _, asset := range assets {
+		var held uint64
+		for _, acc := range accounts {
+			held += balances[acc][asset]
+		}
+		if want := m.issued[asset] - m.retired[asset]; held != want {
+			fail("asset %s: accounts hold %d, want %d issued less %d retired", asset, held, m.issued[asset], m.retired[asset])
+		}
+
+		e, ok := sheet[asset]
+		if !ok {
+			fail("asset %s: missing from balance sheet", asset)
+			continue
+		}
+		if e.Issued != m.issued[asset] || e.Retired != m.retired[asset] {
+			fail("asset %s: balance sheet has %d issued and %d retired, want %d and %d", asset, e.Issued, e.Retired, m.issued[asset], m.retired[asset])
+		}
+		if e.Outstanding != e.Issued-e.Retired {
+			fail("asset %s: balance sheet has %d outstanding, want %d", asset, e.Outstanding, e.Issued-e.Retired)
+		}
+		if e.HeldByIssuer != held {
+			fail("asset %s: balance sheet has %d held by issuer, accounts hold %d", asset, e.HeldByIssuer, held)
+		}
+	}
+
+	for _, acc := range accounts {
+		for _, asset := range assets {
+			if got, want := balances[acc][asset], m.balances[acc][asset]; got != want {
+				fail("account %s: holds %d of %s, want %d", acc, got, asset, want)
+			}
+		}
+	}
+	return violations
+}
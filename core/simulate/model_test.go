@@ -0,0 +1,61 @@
+package simulate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	m := newModel([]string{"alice", "bob"})
+	m.issue("alice", "gold", 100)
+	if got := m.take("alice", "gold", 150); got != 100 {
+		t.Fatalf("took %d, want the 100 alice holds", got)
+	}
+	m.transfer("bob", "gold", 100)
+	m.take("bob", "gold", 30)
+	m.retire("gold", 30)
+	m.issue("alice", "silver", 5)
+	m.take("alice", "silver", 5)
+	m.refund("alice", "silver", 5) // the spend failed
+
+	balances := map[string]map[string]uint64{
+		"alice": {"silver": 5},
+		"bob":   {"gold": 70},
+	}
+	sheet := map[string]sheetEntry{
+		"gold":   {Issued: 100, Retired: 30, Outstanding: 70, HeldByIssuer: 70},
+		"silver": {Issued: 5, Outstanding: 5, HeldByIssuer: 5},
+	}
+	if v := m.check(balances, sheet); len(v) != 0 {
+		t.Fatalf("violations = %q, want none", v)
+	}
+
+	cases := []struct {
+		balances map[string]map[string]uint64
+		sheet    map[string]sheetEntry
+		want     string
+	}{{
+		// value created from nothing
+		balances: map[string]map[string]uint64{"alice": {"silver": 5}, "bob": {"gold": 71}},
+		sheet:    sheet,
+		want:     "asset gold: accounts hold 71",
+	}, {
+		// circulation totals drifted
+		balances: balances,
+		sheet: map[string]sheetEntry{
+			"gold":   {Issued: 100, Retired: 20, Outstanding: 80, HeldByIssuer: 70},
+			"silver": sheet["silver"],
+		},
+		want: "asset gold: balance sheet has 100 issued and 20 retired",
+	}, {
+		balances: balances,
+		sheet:    map[string]sheetEntry{"gold": sheet["gold"]},
+		want:     "asset silver: missing from balance sheet",
+	}}
+	for _, c := range cases {
+		v := m.check(c.balances, c.sheet)
+		if len(v) == 0 || !strings.HasPrefix(v[0], c.want) {
+			t.Errorf("violations = %q, want one starting %q", v, c.want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+// Package simulate runs a workload of issuances, transfers
+// and retirements against a Chain Core through its API, then
+// checks that the Core's balances and asset circulation add
+// up to what the workload did.
+//
+// It's meant for test instances: it creates its own key,
+// assets and accounts, and needs the mock HSM. Its reports of
+// operation latencies and throughput help with capacity
+// planning, and its invariant checks make it usable in CI.
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chain/core/rpc"
+	"chain/errors"
+)
+
+// Operation kinds.
+const (
+	Issue    = "issue"
+	Transfer = "transfer"
+	Retire   = "retire"
+)
+
+// Config describes a workload.
+type Config struct {
+	Assets      int   // number of assets to create
+	Accounts    int   // number of accounts to create
+	Ops         int   // number of operations to run
+	Concurrency int   // operations run at once
+	Seed        int64 // seeds the choice of operations
+
+	// MaxAmount is the largest amount issued at a time.
+	MaxAmount uint64
+
+	// SettleTimeout is how long Verify waits for the Core's
+	// asset statistics to catch up with the workload.
+	SettleTimeout time.Duration
+}
+
+// Simulator runs a workload against one Core.
+type Simulator struct {
+	client *rpc.Client
+	cfg    Config
+	prefix string
+	xpub   string
+
+	assets   []string // aliases
+	accounts []string
+	model    *model
+}
+
+// New returns a simulator for the Core client talks to.
+// The aliases of the objects it creates start with a prefix
+// derived from cfg.Seed and the time, so repeated runs against
+// the same Core don't collide.
+func New(client *rpc.Client, cfg Config) *Simulator {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.MaxAmount == 0 {
+		cfg.MaxAmount = 1000
+	}
+	if cfg.SettleTimeout == 0 {
+		cfg.SettleTimeout = time.Minute
+	}
+	return &Simulator{
+		client: client,
+		cfg:    cfg,
+		prefix: fmt.Sprintf("sim-%d-%d-", cfg.Seed, time.Now().Unix()),
+	}
+}
+
+// Setup creates the key, assets and accounts the workload
+// uses.
+func (s *Simulator) Setup(ctx context.Context) error {
+	if s.cfg.Assets < 1 || s.cfg.Accounts < 1 {
+		return errors.New("a workload needs at least one asset and one account")
+	}
+	var key struct {
+		XPub string `json:"xpub"`
+	}
+	err := s.client.Call(ctx, "/mockhsm/create-key", map[string]string{"alias": s.prefix + "key"}, &key)
+	if err != nil {
+		return errors.Wrap(err, "creating key")
+	}
+	s.xpub = key.XPub
+
+	var assetReqs, accountReqs []interface{}
+	for i := 0; i < s.cfg.Assets; i++ {
+		alias := fmt.Sprintf("%sasset-%d", s.prefix, i)
+		s.assets = append(s.assets, alias)
+		assetReqs = append(assetReqs, map[string]interface{}{
+			"alias":        alias,
+			"root_xpubs":   []string{s.xpub},
+			"quorum":       1,
+			"definition":   map[string]interface{}{"name": alias},
+			"client_token": alias,
+		})
+	}
+	for i := 0; i < s.cfg.Accounts; i++ {
+		alias := fmt.Sprintf("%saccount-%d", s.prefix, i)
+		s.accounts = append(s.accounts, alias)
+		accountReqs = append(accountReqs, map[string]interface{}{
+			"alias":        alias,
+			"root_xpubs":   []string{s.xpub},
+			"quorum":       1,
+			"client_token": alias,
+		})
+	}
+	err = s.batch(ctx, "/create-asset", assetReqs, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating assets")
+	}
+	err = s.batch(ctx, "/create-account", accountReqs, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating accounts")
+	}
+	s.model = newModel(s.accounts)
+	return nil
+}
+
+// Run runs the workload, returning a report of the
+// operations run. Operations that fail are counted in the
+// report, not returned as errors; the workload's model only
+// reflects the operations that succeed.
+func (s *Simulator) Run(ctx context.Context) *Report {
+	r := &Report{Ops: make(map[string]*OpStats)}
+	for _, kind := range []string{Issue, Transfer, Retire} {
+		r.Ops[kind] = new(OpStats)
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		next = make(chan int)
+	)
+	start := time.Now()
+	for w := 0; w < s.cfg.Concurrency; w++ {
+		wg.Add(1)
+		rnd := rand.New(rand.NewSource(s.cfg.Seed + int64(w)))
+		go func() {
+			defer wg.Done()
+			for range next {
+				t0 := time.Now()
+				kind, err := s.op(ctx, rnd)
+				d := time.Since(t0)
+				mu.Lock()
+				r.Ops[kind].add(d, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < s.cfg.Ops && ctx.Err() == nil; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	r.Elapsed = time.Since(start)
+	return r
+}
+
+// op runs one randomly chosen operation, returning its kind.
+// It issues when the chosen account has nothing to spend.
+func (s *Simulator) op(ctx context.Context, rnd *rand.Rand) (string, error) {
+	from := s.accounts[rnd.Intn(len(s.accounts))]
+	x := rnd.Intn(100)
+	held := s.model.held(from)
+	if x < 20 || len(held) == 0 {
+		asset := s.assets[rnd.Intn(len(s.assets))]
+		amount := 1 + uint64(rnd.Int63n(int64(s.cfg.MaxAmount)))
+		err := s.transact(ctx, []map[string]interface{}{
+			{"type": "issue", "asset_alias": asset, "amount": amount},
+			{"type": "control_account", "account_alias": from, "asset_alias": asset, "amount": amount},
+		})
+		if err == nil {
+			s.model.issue(from, asset, amount)
+		}
+		return Issue, err
+	}
+
+	asset := held[rnd.Intn(len(held))]
+	amount := s.model.take(from, asset, 1+uint64(rnd.Int63n(int64(s.cfg.MaxAmount/2+1))))
+	if amount == 0 {
+		return Transfer, errors.New("nothing to spend") // spent concurrently
+	}
+	spend := map[string]interface{}{"type": "spend_account", "account_alias": from, "asset_alias": asset, "amount": amount}
+
+	if x < 30 {
+		err := s.transact(ctx, []map[string]interface{}{
+			spend,
+			{"type": "retire", "asset_alias": asset, "amount": amount},
+		})
+		if err != nil {
+			s.model.refund(from, asset, amount)
+		} else {
+			s.model.retire(asset, amount)
+		}
+		return Retire, err
+	}
+
+	to := s.accounts[rnd.Intn(len(s.accounts))]
+	err := s.transact(ctx, []map[string]interface{}{
+		spend,
+		{"type": "control_account", "account_alias": to, "asset_alias": asset, "amount": amount},
+	})
+	if err != nil {
+		s.model.refund(from, asset, amount)
+	} else {
+		s.model.transfer(to, asset, amount)
+	}
+	return Transfer, err
+}
+
+// transact builds, signs and submits a transaction with the
+// given actions, waiting for it to be processed.
+func (s *Simulator) transact(ctx context.Context, actions []map[string]interface{}) error {
+	var tpls []json.RawMessage
+	err := s.batch(ctx, "/build-transaction", []interface{}{map[string]interface{}{"actions": actions}}, &tpls)
+	if err != nil {
+		return errors.Wrap(err, "building")
+	}
+	var signed []json.RawMessage
+	err = s.batch(ctx, "/mockhsm/sign-transaction", map[string]interface{}{
+		"transactions": tpls,
+		"xpubs":        []string{s.xpub},
+	}, &signed)
+	if err != nil {
+		return errors.Wrap(err, "signing")
+	}
+	err = s.batch(ctx, "/submit-transaction", map[string]interface{}{
+		"transactions": signed,
+		"wait_until":   "processed",
+	}, nil)
+	return errors.Wrap(err, "submitting")
+}
+
+// batch calls a batch route, returning the first error in its
+// response and storing the response items in resp, if it's
+// not nil.
+func (s *Simulator) batch(ctx context.Context, path string, req interface{}, resp *[]json.RawMessage) error {
+	var items []json.RawMessage
+	err := s.client.Call(ctx, path, req, &items)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var e struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		}
+		json.Unmarshal(item, &e)
+		if e.Code != "" {
+			return fmt.Errorf("%s %s: %s", e.Code, e.Message, e.Detail)
+		}
+	}
+	if resp != nil {
+		*resp = items
+	}
+	return nil
+}
+
+// Verify checks the workload's invariants against the Core,
+// returning a description of each violation. It retries until
+// the Core's asset statistics, which are rolled up after
+// blocks are processed, catch up or SettleTimeout passes.
+func (s *Simulator) Verify(ctx context.Context) ([]string, error) {
+	deadline := time.Now().Add(s.cfg.SettleTimeout)
+	for {
+		balances, err := s.balances(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sheet, err := s.balanceSheet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		violations := s.model.check(balances, sheet)
+		if len(violations) == 0 || time.Now().After(deadline) {
+			return violations, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Simulator) balances(ctx context.Context) (map[string]map[string]uint64, error) {
+	balances := make(map[string]map[string]uint64)
+	for _, acc := range s.accounts {
+		var page struct {
+			Items []struct {
+				SumBy  map[string]string `json:"sum_by"`
+				Amount uint64            `json:"amount"`
+			} `json:"items"`
+		}
+		err := s.client.Call(ctx, "/list-balances", map[string]interface{}{
+			"filter":        "account_alias=$1",
+			"filter_params": []string{acc},
+			"sum_by":        []string{"asset_alias"},
+		}, &page)
+		if err != nil {
+			return nil, errors.Wrap(err, "listing balances")
+		}
+		balances[acc] = make(map[string]uint64)
+		for _, item := range page.Items {
+			balances[acc][item.SumBy["asset_alias"]] = item.Amount
+		}
+	}
+	return balances, nil
+}
+
+func (s *Simulator) balanceSheet(ctx context.Context) (map[string]sheetEntry, error) {
+	var resp struct {
+		Items []struct {
+			AssetAlias string `json:"asset_alias"`
+			sheetEntry
+		} `json:"items"`
+	}
+	err := s.client.Call(ctx, "/get-balance-sheet", nil, &resp)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting balance sheet")
+	}
+	sheet := make(map[string]sheetEntry)
+	for _, item := range resp.Items {
+		if strings.HasPrefix(item.AssetAlias, s.prefix) {
+			sheet[item.AssetAlias] = item.sheetEntry
+		}
+	}
+	return sheet, nil
+}
+
+// Report summarizes a run of a workload.
+type Report struct {
+	Ops     map[string]*OpStats // by kind
+	Elapsed time.Duration
+}
+
+// OpStats summarizes the operations of one kind.
+type OpStats struct {
+	Count     int
+	Errors    int
+	FirstErr  error
+	latencies []time.Duration
+}
+
+func (o *OpStats) add(d time.Duration, err error) {
+	o.Count++
+	o.latencies = append(o.latencies, d)
+	if err != nil {
+		o.Errors++
+		if o.FirstErr == nil {
+			o.FirstErr = err
+		}
+	}
+}
+
+// Percentile returns the latency that p percent of the
+// operations took at most.
+func (o *OpStats) Percentile(p int) time.Duration {
+	if len(o.latencies) == 0 {
+		return 0
+	}
+	sort.Slice(o.latencies, func(i, j int) bool { return o.latencies[i] < o.latencies[j] })
+	i := (len(o.latencies)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return o.latencies[i]
+}
+
+// WriteTo writes the report as a table to w.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(format string, args ...interface{}) {
+		k, _ := fmt.Fprintf(w, format, args...)
+		n += int64(k)
+	}
+	var total int
+	write("%-9s %7s %7s %10s %10s %10s\n", "op", "count", "errors", "p50", "p95", "p99")
+	for _, kind := range []string{Issue, Transfer, Retire} {
+		o := r.Ops[kind]
+		total += o.Count
+		write("%-9s %7d %7d %10s %10s %10s\n", kind, o.Count, o.Errors, o.Percentile(50), o.Percentile(95), o.Percentile(99))
+	}
+	if r.Elapsed > 0 {
+		write("%d operations in %s (%.1f/s)\n", total, r.Elapsed, float64(total)/r.Elapsed.Seconds())
+	}
+	for _, kind := range []string{Issue, Transfer, Retire} {
+		if err := r.Ops[kind].FirstErr; err != nil {
+			write("first %s error: %v\n", kind, err)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,164 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"chain/errors"
+)
+
+// Page layout, in points, for US Letter paper. Text is set in
+// Courier so that columns line up.
+const (
+	pageWidth  = 612
+	pageHeight = 792
+	margin     = 50
+	fontSize   = 8
+	leading    = 11
+
+	linesPerPage = (pageHeight - 2*margin) / leading
+)
+
+// PDFRenderer writes statements as PDF documents.
+type PDFRenderer struct{}
+
+func (PDFRenderer) ContentType() string { return "application/pdf" }
+
+func (PDFRenderer) Render(w io.Writer, s *Statement) error {
+	lines := textLines(s)
+	var pages [][]string
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	pages = append(pages, lines)
+	_, err := w.Write(pdf(pages))
+	return errors.Wrap(err, "writing pdf")
+}
+
+// textLines lays out a statement as lines of text.
+func textLines(s *Statement) []string {
+	const (
+		timeFormat = "2006-01-02 15:04:05"
+		row        = "%-19s  %-16s  %-20s  %20s  %20s"
+	)
+	account := s.AccountID
+	if s.AccountAlias != "" {
+		account = s.AccountAlias + " (" + s.AccountID + ")"
+	}
+	lines := []string{
+		"ACCOUNT STATEMENT",
+		"",
+		"Account:    " + account,
+		"Period:     " + s.StartTime.Format(timeFormat) + " to " + s.EndTime.Format(timeFormat) + " UTC",
+		"Statement:  " + s.ID,
+		"Generated:  " + s.CreatedAt.Format(timeFormat) + " UTC",
+		"",
+		"BALANCES",
+		"",
+		fmt.Sprintf("%-40s  %20s  %20s", "Asset", "Opening", "Closing"),
+	}
+	for _, b := range s.Balances {
+		lines = append(lines, fmt.Sprintf("%-40s  %20d  %20d", assetLabel(b.AssetAlias, hex.EncodeToString(b.AssetID.Bytes()), 40), b.Opening, b.Closing))
+	}
+	lines = append(lines, "", "TRANSACTIONS", "")
+	if len(s.Transactions) == 0 {
+		return append(lines, "No transactions in this period.")
+	}
+	lines = append(lines, fmt.Sprintf(row, "Date", "Transaction", "Asset", "Change", "Balance"))
+	for _, tx := range s.Transactions {
+		change := strconv.FormatInt(tx.Change, 10)
+		if tx.Change > 0 {
+			change = "+" + change
+		}
+		lines = append(lines, fmt.Sprintf(row,
+			tx.Timestamp.Format(timeFormat),
+			hex.EncodeToString(tx.TransactionID.Bytes())[:16],
+			assetLabel(tx.AssetAlias, hex.EncodeToString(tx.AssetID.Bytes()), 20),
+			change,
+			strconv.FormatUint(tx.Balance, 10),
+		))
+	}
+	return lines
+}
+
+// assetLabel returns an asset's alias, or else its ID,
+// truncated to width.
+func assetLabel(alias, id string, width int) string {
+	label := alias
+	if label == "" {
+		label = id
+	}
+	if len(label) > width {
+		label = label[:width-3] + "..."
+	}
+	return label
+}
+
+// pdf returns a PDF document with a page of text for each
+// element of pages.
+func pdf(pages [][]string) []byte {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 3 are the catalog, the page tree and the
+	// font; each page is followed by its content stream.
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, lines := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, leading, margin, pageHeight-margin)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(line))
+		}
+		fmt.Fprintf(&content, "ET\nBT\n/F1 %d Tf\n%d %d Td\n(Page %d of %d) Tj\nET", fontSize, margin, margin/2, i+1, len(pages))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfEscape escapes s for use in a PDF literal string.
+// Characters outside printable ASCII become '?', since the
+// built-in fonts can't be relied on to show them.
+func pdfEscape(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			buf.WriteByte('?')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
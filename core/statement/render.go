@@ -0,0 +1,74 @@
+package statement
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"chain/errors"
+)
+
+// ErrBadFormat is returned by Lookup for a format with no
+// registered renderer.
+var ErrBadFormat = errors.New("unknown statement format")
+
+// A Renderer writes statements in one document format.
+type Renderer interface {
+	// ContentType returns the MIME type of the documents the
+	// renderer writes.
+	ContentType() string
+
+	Render(w io.Writer, s *Statement) error
+}
+
+var (
+	renderersMu sync.Mutex
+	renderers   = make(map[string]Renderer)
+)
+
+func init() {
+	Register("json", jsonRenderer{})
+	Register("pdf", PDFRenderer{})
+}
+
+// Register makes a renderer available under the given format
+// name, replacing any renderer already registered under it.
+// Format names are case-insensitive.
+func Register(format string, r Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[strings.ToLower(format)] = r
+}
+
+// Lookup returns the renderer registered under the given
+// format name.
+func Lookup(format string) (Renderer, error) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	r, ok := renderers[strings.ToLower(format)]
+	if !ok {
+		return nil, errors.WithDetailf(ErrBadFormat, "format must be one of %s", strings.Join(formats(), ", "))
+	}
+	return r, nil
+}
+
+// formats returns the registered format names in order.
+// The caller must hold renderersMu.
+func formats() []string {
+	var names []string
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type jsonRenderer struct{}
+
+func (jsonRenderer) ContentType() string { return "application/json" }
+
+func (jsonRenderer) Render(w io.Writer, s *Statement) error {
+	return errors.Wrap(json.NewEncoder(w).Encode(s))
+}
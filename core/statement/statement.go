@@ -0,0 +1,284 @@
+// Package statement generates account statements.
+//
+// A statement covers the transactions confirmed in blocks
+// timestamped in a period, from the start time up to but not
+// including the end time. For each asset the account held or
+// moved in the period it gives the opening balance, the
+// change made by each transaction, and the closing balance.
+// Statements are built from the transaction index and stored,
+// so the history of statements sent to a customer can be
+// retrieved and rendered again later.
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// MaxTransactions is the most transactions a statement can
+// hold.
+const MaxTransactions = 10000
+
+var (
+	// ErrBadPeriod is returned by Create for a period that
+	// doesn't end after it starts.
+	ErrBadPeriod = errors.New("bad statement period")
+
+	// ErrTooLarge is returned by Create when the account has
+	// more than MaxTransactions transactions in the period.
+	ErrTooLarge = errors.New("statement too large")
+)
+
+// Statement is the activity of one account over a period.
+type Statement struct {
+	ID           string         `json:"id"`
+	AccountID    string         `json:"account_id"`
+	AccountAlias string         `json:"account_alias,omitempty"`
+	StartTime    time.Time      `json:"start_time"`
+	EndTime      time.Time      `json:"end_time"`
+	Balances     []*Balance     `json:"balances"`
+	Transactions []*Transaction `json:"transactions,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// Balance is an account's balance of one asset at the start
+// and end of a statement's period.
+type Balance struct {
+	AssetID    bc.AssetID `json:"asset_id"`
+	AssetAlias string     `json:"asset_alias,omitempty"`
+	Opening    uint64     `json:"opening"`
+	Closing    uint64     `json:"closing"`
+}
+
+// Transaction is the net change a transaction made to an
+// account's balance of one asset. A transaction that moved
+// several assets appears once for each.
+type Transaction struct {
+	TransactionID bc.Hash    `json:"transaction_id"`
+	BlockHeight   uint64     `json:"block_height"`
+	Timestamp     time.Time  `json:"timestamp"`
+	AssetID       bc.AssetID `json:"asset_id"`
+	AssetAlias    string     `json:"asset_alias,omitempty"`
+	Change        int64      `json:"change"`
+	Balance       uint64     `json:"balance"`
+}
+
+// Store generates and stores statements.
+type Store struct {
+	db pg.DB
+}
+
+// NewStore returns a new Store using the given database.
+func NewStore(db pg.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create generates and stores a statement for an account
+// over the period from start up to but not including end. The
+// transaction index must cover the period.
+func (s *Store) Create(ctx context.Context, accountID string, start, end time.Time) (*Statement, error) {
+	if !start.Before(end) {
+		return nil, errors.WithDetail(ErrBadPeriod, "start_time must be before end_time")
+	}
+
+	const accountQ = `SELECT COALESCE(alias, '') FROM accounts WHERE account_id = $1`
+	st := &Statement{
+		AccountID: accountID,
+		StartTime: start.UTC(),
+		EndTime:   end.UTC(),
+	}
+	err := s.db.QueryRowContext(ctx, accountQ, accountID).Scan(&st.AccountAlias)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account %s", accountID)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "looking up account")
+	}
+
+	balances, err := s.balances(ctx, st.AccountID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := s.transactions(ctx, st.AccountID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	st.Balances, st.Transactions = runningBalances(balances, txs)
+
+	b, err := json.Marshal(st.Balances)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	t, err := json.Marshal(st.Transactions)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	const insertQ = `
+		INSERT INTO account_statements (account_id, start_time, end_time, balances, transactions)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	err = s.db.QueryRowContext(ctx, insertQ, st.AccountID, st.StartTime, st.EndTime, b, t).Scan(&st.ID, &st.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "storing statement")
+	}
+	st.CreatedAt = st.CreatedAt.UTC()
+	return st, nil
+}
+
+// balances returns the account's balance of each asset held
+// just before start and just before end. The outputs of a
+// block timestamped at start belong to the period.
+func (s *Store) balances(ctx context.Context, accountID string, start, end time.Time) ([]*Balance, error) {
+	const q = `
+		SELECT asset_id, max(asset_alias),
+			COALESCE(sum(amount) FILTER (WHERE timespan @> $2::int8), 0),
+			COALESCE(sum(amount) FILTER (WHERE timespan @> $3::int8), 0)
+		FROM annotated_outputs
+		WHERE account_id = $1 AND (timespan @> $2::int8 OR timespan @> $3::int8)
+		GROUP BY asset_id
+		ORDER BY asset_id
+	`
+	var balances []*Balance
+	err := pg.ForQueryRows(ctx, s.db, q, accountID, bc.Millis(start)-1, bc.Millis(end)-1,
+		func(assetID bc.AssetID, assetAlias sql.NullString, opening, closing int64) {
+			balances = append(balances, &Balance{
+				AssetID:    assetID,
+				AssetAlias: assetAlias.String,
+				Opening:    uint64(opening),
+				Closing:    uint64(closing),
+			})
+		})
+	return balances, errors.Wrap(err, "querying statement balances")
+}
+
+// transactions returns the net change to each of the
+// account's asset balances made by each transaction in the
+// period, in the order they were confirmed.
+func (s *Store) transactions(ctx context.Context, accountID string, start, end time.Time) ([]*Transaction, error) {
+	const q = `
+		SELECT t.tx_hash, t.block_height, t.timestamp, p.asset_id, max(p.asset_alias), sum(p.amount)
+		FROM annotated_txs t
+		JOIN (
+			SELECT tx_hash, asset_id, asset_alias, -amount AS amount
+			FROM annotated_inputs WHERE account_id = $1
+			UNION ALL
+			SELECT tx_hash, asset_id, asset_alias, amount
+			FROM annotated_outputs WHERE account_id = $1
+		) AS p ON p.tx_hash = t.tx_hash
+		WHERE t.timestamp >= $2 AND t.timestamp < $3
+		GROUP BY t.block_height, t.tx_pos, t.tx_hash, t.timestamp, p.asset_id
+		HAVING sum(p.amount) <> 0
+		ORDER BY t.block_height, t.tx_pos, p.asset_id
+		LIMIT $4
+	`
+	var txs []*Transaction
+	err := pg.ForQueryRows(ctx, s.db, q, accountID, start, end, MaxTransactions+1,
+		func(txHash bc.Hash, height uint64, ts time.Time, assetID bc.AssetID, assetAlias sql.NullString, change int64) {
+			txs = append(txs, &Transaction{
+				TransactionID: txHash,
+				BlockHeight:   height,
+				Timestamp:     ts.UTC(),
+				AssetID:       assetID,
+				AssetAlias:    assetAlias.String,
+				Change:        change,
+			})
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying statement transactions")
+	}
+	if len(txs) > MaxTransactions {
+		return nil, errors.WithDetailf(ErrTooLarge, "the account has more than %d transactions in the period; use a shorter one", MaxTransactions)
+	}
+	return txs, nil
+}
+
+// runningBalances sets the balance after each transaction,
+// starting from the opening balances. It adds a balance for
+// any asset that was received and spent entirely within the
+// period, and so has no opening or closing balance.
+func runningBalances(balances []*Balance, txs []*Transaction) ([]*Balance, []*Transaction) {
+	running := make(map[bc.AssetID]uint64)
+	seen := make(map[bc.AssetID]bool)
+	for _, b := range balances {
+		running[b.AssetID] = b.Opening
+		seen[b.AssetID] = true
+	}
+	for _, tx := range txs {
+		running[tx.AssetID] = uint64(int64(running[tx.AssetID]) + tx.Change)
+		tx.Balance = running[tx.AssetID]
+		if !seen[tx.AssetID] {
+			balances = append(balances, &Balance{AssetID: tx.AssetID, AssetAlias: tx.AssetAlias})
+			seen[tx.AssetID] = true
+		}
+	}
+	if balances == nil {
+		balances = []*Balance{} // send [], not null
+	}
+	return balances, txs
+}
+
+// Find returns the stored statement with the given ID.
+func (s *Store) Find(ctx context.Context, id string) (*Statement, error) {
+	const q = `
+		SELECT s.account_id, COALESCE(a.alias, ''), s.start_time, s.end_time, s.balances, s.transactions, s.created_at
+		FROM account_statements s LEFT JOIN accounts a ON a.account_id = s.account_id
+		WHERE s.id = $1
+	`
+	st := &Statement{ID: id}
+	var balances, txs []byte
+	err := s.db.QueryRowContext(ctx, q, id).Scan(&st.AccountID, &st.AccountAlias, &st.StartTime, &st.EndTime, &balances, &txs, &st.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "statement %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "loading statement")
+	}
+	err = json.Unmarshal(balances, &st.Balances)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding statement balances")
+	}
+	err = json.Unmarshal(txs, &st.Transactions)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding statement transactions")
+	}
+	st.StartTime, st.EndTime, st.CreatedAt = st.StartTime.UTC(), st.EndTime.UTC(), st.CreatedAt.UTC()
+	return st, nil
+}
+
+// List returns the statements stored for an account, newest
+// first, without their transactions.
+func (s *Store) List(ctx context.Context, accountID string) ([]*Statement, error) {
+	const q = `
+		SELECT s.id, COALESCE(a.alias, ''), s.start_time, s.end_time, s.balances, s.created_at
+		FROM account_statements s LEFT JOIN accounts a ON a.account_id = s.account_id
+		WHERE s.account_id = $1
+		ORDER BY s.created_at DESC, s.id DESC
+	`
+	var (
+		list   []*Statement
+		decErr error
+	)
+	err := pg.ForQueryRows(ctx, s.db, q, accountID, func(id, alias string, start, end time.Time, balances []byte, createdAt time.Time) {
+		st := &Statement{
+			ID:           id,
+			AccountID:    accountID,
+			AccountAlias: alias,
+			StartTime:    start.UTC(),
+			EndTime:      end.UTC(),
+			CreatedAt:    createdAt.UTC(),
+		}
+		if err := json.Unmarshal(balances, &st.Balances); err != nil && decErr == nil {
+			decErr = errors.Wrap(err, "decoding statement balances")
+		}
+		list = append(list, st)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing statements")
+	}
+	return list, decErr
+}
@@ -0,0 +1,111 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestRunningBalances(t *testing.T) {
+	usd := bc.NewAssetID([32]byte{1})
+	eur := bc.NewAssetID([32]byte{2})
+	balances := []*Balance{{AssetID: usd, Opening: 100, Closing: 70}}
+	txs := []*Transaction{
+		{AssetID: usd, Change: -50},
+		{AssetID: eur, AssetAlias: "eur", Change: 5},
+		{AssetID: usd, Change: 20},
+		{AssetID: eur, AssetAlias: "eur", Change: -5},
+	}
+	balances, txs = runningBalances(balances, txs)
+
+	var got []uint64
+	for _, tx := range txs {
+		got = append(got, tx.Balance)
+	}
+	if want := []uint64{50, 5, 70, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("running balances = %v, want %v", got, want)
+	}
+	if len(balances) != 2 || balances[1].AssetID != eur || balances[1].AssetAlias != "eur" {
+		t.Errorf("balances = %+v, want usd and a zero eur balance", balances)
+	}
+
+	if balances, _ := runningBalances(nil, nil); balances == nil {
+		t.Error("balances = nil, want []")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r, err := Lookup("PDF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ContentType() != "application/pdf" {
+		t.Errorf("content type = %q, want application/pdf", r.ContentType())
+	}
+	_, err = Lookup("xml")
+	if errors.Root(err) != ErrBadFormat {
+		t.Errorf("Lookup(xml) error = %v, want %v", err, ErrBadFormat)
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	s := &Statement{
+		ID:           "stmt1",
+		AccountID:    "acc1",
+		AccountAlias: "alice (savings)",
+		StartTime:    time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:      time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC),
+		Balances:     []*Balance{{AssetID: bc.NewAssetID([32]byte{1}), AssetAlias: "usd", Opening: 100, Closing: 100}},
+	}
+	for i := 0; i < 2*linesPerPage; i++ {
+		s.Transactions = append(s.Transactions, &Transaction{AssetAlias: "usd", Change: 1})
+	}
+
+	var buf bytes.Buffer
+	err := PDFRenderer{}.Render(&buf, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.Bytes()
+
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+	if !bytes.Contains(doc, []byte("/Count 3 ")) {
+		t.Error("want 3 pages")
+	}
+	if !bytes.Contains(doc, []byte(`(Account:    alice \(savings\) \(acc1\)) Tj`)) {
+		t.Error("account line missing or not escaped")
+	}
+
+	// Every cross-reference entry must point at its object.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(doc[xref:], -1)
+	if len(entries) != 3+2*3 {
+		t.Fatalf("got %d xref entries, want %d", len(entries), 3+2*3)
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(doc[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", i+1, doc[off:off+len(want)], want)
+		}
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	got := pdfEscape(`a\b(c)d€`)
+	if want := `a\\b\(c\)d?`; got != want {
+		t.Errorf("pdfEscape = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"chain/core/query"
+	"chain/core/statement"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+// POST /create-account-statement
+//
+// Generates and stores a statement of an account's activity
+// from start_time up to but not including end_time: the
+// opening balance of each asset, the transactions, and the
+// closing balance. The transaction index must have reached
+// end_time. Use /render-account-statement to get it as a
+// document.
+func (a *API) createAccountStatement(ctx context.Context, x struct {
+	AccountID    string    `json:"account_id"`
+	AccountAlias string    `json:"account_alias"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+}) (*statement.Statement, error) {
+	if !a.indexTxs {
+		return nil, errors.WithDetail(errNoTxIndex, "statements are built from the transaction index")
+	}
+	accountID, err := a.accountID(ctx, x.AccountID, x.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	if x.StartTime.IsZero() || x.EndTime.IsZero() {
+		return nil, errors.WithDetail(statement.ErrBadPeriod, "start_time and end_time are required")
+	}
+	height := a.pinStore.Height(query.TxPinName)
+	if height == 0 {
+		return nil, errors.WithDetail(statement.ErrBadPeriod, "no blocks have been indexed yet")
+	}
+	indexed, err := a.chain.GetBlock(ctx, height)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if x.EndTime.After(indexed.Time()) {
+		return nil, errors.WithDetailf(statement.ErrBadPeriod, "end_time cannot be after the most recently indexed block, at %s", indexed.Time().UTC().Format(time.RFC3339))
+	}
+	return a.statements.Create(ctx, accountID, x.StartTime, x.EndTime)
+}
+
+// POST /get-account-statement
+func (a *API) getAccountStatement(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*statement.Statement, error) {
+	return a.statements.Find(ctx, x.ID)
+}
+
+// accountStatementList is the response to
+// /list-account-statements.
+type accountStatementList struct {
+	Items []*statement.Statement `json:"items"`
+}
+
+// POST /list-account-statements
+//
+// Lists the statements generated for an account, newest
+// first, without their transactions.
+func (a *API) listAccountStatements(ctx context.Context, x struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+}) (*accountStatementList, error) {
+	accountID, err := a.accountID(ctx, x.AccountID, x.AccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	list, err := a.statements.List(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*statement.Statement{} // send [], not null
+	}
+	return &accountStatementList{Items: list}, nil
+}
+
+// POST /render-account-statement
+//
+// Writes a stored statement as a document in the given
+// format, pdf or json, with the format's content type rather
+// than as a JSON response.
+func (a *API) renderAccountStatement(rw http.ResponseWriter, req *http.Request) {
+	if a.config == nil {
+		alwaysError(errUnconfigured).ServeHTTP(rw, req)
+		return
+	}
+
+	var x struct {
+		ID     string `json:"id"`
+		Format string `json:"format"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&x)
+	if err != nil {
+		errorFormatter.Write(req.Context(), rw, httpjson.ErrBadRequest)
+		return
+	}
+	r, err := statement.Lookup(x.Format)
+	if err != nil {
+		errorFormatter.Write(req.Context(), rw, err)
+		return
+	}
+	s, err := a.statements.Find(req.Context(), x.ID)
+	if err != nil {
+		errorFormatter.Write(req.Context(), rw, err)
+		return
+	}
+	var buf bytes.Buffer
+	err = r.Render(&buf, s)
+	if err != nil {
+		errorFormatter.Write(req.Context(), rw, err)
+		return
+	}
+	rw.Header().Set("Content-Type", r.ContentType())
+	buf.WriteTo(rw)
+}
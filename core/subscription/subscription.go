@@ -0,0 +1,540 @@
+// Package subscription keeps recurring payment schedules,
+// or standing orders: a fixed amount of an asset paid from
+// one account to another account or a control program every
+// day, week or month.
+//
+// Payments are due at the schedule's start time and every
+// interval after it. A month after the 31st is the last day
+// of a shorter month; the schedule doesn't drift. A recurring
+// job makes each payment that is due, one per subscription
+// per run, so a subscription that missed several payments,
+// such as while the core was down, catches up one at a time.
+//
+// Each payment is recorded as an execution before its
+// transaction is built, and then with the transaction that
+// made it or the error that stopped it. The record is the
+// subscription's history, and also what stops a payment from
+// being made twice: one that was being submitted when the
+// core stopped is left for an operator to check rather than
+// retried. A failed payment isn't retried either; the
+// subscription moves on to its next payment, and after
+// MaxFailures failures in a row it stops, with status failed,
+// until it's resumed.
+//
+// A paused subscription makes no payments. Resuming it skips
+// the payments that fell due while it was paused. A canceled
+// subscription never pays again. Each change to a
+// subscription is recorded as an event.
+package subscription
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"chain/core/event"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// Payment intervals.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Subscription statuses. Canceled and completed are final.
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+	StatusCompleted = "completed"
+)
+
+// Execution statuses.
+const (
+	ExecSubmitting = "submitting"
+	ExecSucceeded  = "succeeded"
+	ExecFailed     = "failed"
+)
+
+// defMaxFailures is the number of failed payments in a row
+// that stops a subscription, unless it sets its own.
+const defMaxFailures = 3
+
+var (
+	// ErrBadSubscription is returned for a subscription with
+	// invalid fields, or a list filter with an unknown status.
+	ErrBadSubscription = errors.New("invalid subscription")
+
+	// ErrBadState is returned for an operation the
+	// subscription's status doesn't allow, such as resuming
+	// a canceled subscription.
+	ErrBadState = errors.New("subscription status does not allow this")
+)
+
+// Subscription describes a recurring payment. It pays to
+// DestinationAccountID or, without one, to
+// DestinationControlProgram. Period is the number of
+// payments that have fallen due, and NextPaymentAt the time
+// the next one does; it is unset once the subscription is
+// canceled or completed.
+type Subscription struct {
+	ID                        string             `json:"id"`
+	AssetID                   bc.AssetID         `json:"asset_id"`
+	Amount                    uint64             `json:"amount"`
+	SourceAccountID           string             `json:"source_account_id"`
+	DestinationAccountID      string             `json:"destination_account_id,omitempty"`
+	DestinationControlProgram chainjson.HexBytes `json:"destination_control_program,omitempty"`
+	Interval                  string             `json:"interval"`
+	IntervalCount             int                `json:"interval_count"`
+	StartAt                   time.Time          `json:"start_at"`
+	EndAt                     *time.Time         `json:"end_at,omitempty"`
+	MaxFailures               int                `json:"max_failures"`
+	Status                    string             `json:"status"`
+	Period                    int64              `json:"period"`
+	NextPaymentAt             *time.Time         `json:"next_payment_at,omitempty"`
+	Failures                  int                `json:"consecutive_failures"`
+	CreatedAt                 time.Time          `json:"created_at"`
+	UpdatedAt                 time.Time          `json:"updated_at"`
+}
+
+func (s *Subscription) validate() error {
+	if s.Amount == 0 || s.Amount > math.MaxInt64 {
+		return errors.WithDetailf(ErrBadSubscription, "amount must be between 1 and %d", int64(math.MaxInt64))
+	}
+	if s.SourceAccountID == "" {
+		return errors.WithDetail(ErrBadSubscription, "a source account is required")
+	}
+	if (s.DestinationAccountID == "") == (len(s.DestinationControlProgram) == 0) {
+		return errors.WithDetail(ErrBadSubscription, "exactly one of a destination account or control program is required")
+	}
+	if s.DestinationAccountID == s.SourceAccountID {
+		return errors.WithDetail(ErrBadSubscription, "the source and destination accounts must differ")
+	}
+	switch s.Interval {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return errors.WithDetailf(ErrBadSubscription, "interval must be %s, %s or %s", IntervalDay, IntervalWeek, IntervalMonth)
+	}
+	if s.IntervalCount == 0 {
+		s.IntervalCount = 1
+	}
+	if s.IntervalCount < 0 {
+		return errors.WithDetail(ErrBadSubscription, "interval_count must be positive")
+	}
+	if s.MaxFailures == 0 {
+		s.MaxFailures = defMaxFailures
+	}
+	if s.MaxFailures < 0 {
+		return errors.WithDetail(ErrBadSubscription, "max_failures must be positive")
+	}
+	if s.StartAt.IsZero() {
+		s.StartAt = time.Now()
+	}
+	s.StartAt = s.StartAt.UTC()
+	if s.EndAt != nil && s.EndAt.Before(s.StartAt) {
+		return errors.WithDetail(ErrBadSubscription, "end_at must not be before start_at")
+	}
+	return nil
+}
+
+// PaymentAt returns the time payment n (counting from zero)
+// of the subscription falls due.
+func (s *Subscription) PaymentAt(n int64) time.Time {
+	k := int(n) * s.IntervalCount
+	switch s.Interval {
+	case IntervalWeek:
+		return s.StartAt.AddDate(0, 0, 7*k)
+	case IntervalMonth:
+		return addMonths(s.StartAt, k)
+	}
+	return s.StartAt.AddDate(0, 0, k)
+}
+
+// addMonths returns t plus the given number of months,
+// falling back to the last day of a month too short for t's
+// day.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// schedule returns the time payment n falls due, and false
+// if the subscription ends before then.
+func (s *Subscription) schedule(n int64) (time.Time, bool) {
+	t := s.PaymentAt(n)
+	return t, s.EndAt == nil || !t.After(*s.EndAt)
+}
+
+// Manager stores subscriptions and their executions.
+type Manager struct {
+	db pg.DB
+}
+
+// NewManager returns a new Manager using the given database.
+func NewManager(db pg.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// Create validates and saves a new subscription. Its first
+// payment is due at its start time, by default now.
+func (m *Manager) Create(ctx context.Context, s *Subscription) (*Subscription, error) {
+	err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		INSERT INTO subscriptions (asset_id, amount, source_account_id, destination_account_id,
+			destination_control_program, interval_unit, interval_count, start_at, end_at,
+			max_failures, next_payment_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $8)
+		RETURNING id
+	`
+	var (
+		id   string
+		prog []byte
+	)
+	if len(s.DestinationControlProgram) > 0 {
+		prog = s.DestinationControlProgram
+	}
+	err = m.db.QueryRowContext(ctx, q, s.AssetID, int64(s.Amount), s.SourceAccountID, s.DestinationAccountID,
+		prog, s.Interval, s.IntervalCount, s.StartAt, s.EndAt, s.MaxFailures).Scan(&id)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting subscription")
+	}
+	return m.findAndRecord(ctx, id)
+}
+
+// Pause stops an active or failed subscription from making
+// payments until it's resumed.
+func (m *Manager) Pause(ctx context.Context, id string) (*Subscription, error) {
+	const q = `
+		UPDATE subscriptions SET status = $2, updated_at = now()
+		WHERE id = $1 AND status IN ($3, $4)
+	`
+	return m.transition(ctx, id, "only an active or failed subscription can be paused",
+		q, id, StatusPaused, StatusActive, StatusFailed)
+}
+
+// Resume restarts a paused or failed subscription. Its
+// failures are forgiven, and the payments that fell due
+// while it was stopped are skipped: its next payment is the
+// first due now or later.
+func (m *Manager) Resume(ctx context.Context, id string) (*Subscription, error) {
+	s, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Status != StatusPaused && s.Status != StatusFailed {
+		return nil, errors.WithDetailf(ErrBadState, "subscription %s is %s; only a paused or failed subscription can be resumed", id, s.Status)
+	}
+	now := time.Now()
+	n := s.Period
+	for s.PaymentAt(n).Before(now) {
+		n++
+	}
+	status, next := StatusActive, new(time.Time)
+	t, ok := s.schedule(n)
+	if ok {
+		*next = t
+	} else {
+		status, next = StatusCompleted, nil
+	}
+	const q = `
+		UPDATE subscriptions
+		SET status = $3, period = $4, next_payment_at = $5, failures = 0, updated_at = now()
+		WHERE id = $1 AND status = $2 AND period = $6
+	`
+	return m.transition(ctx, id, "only a paused or failed subscription can be resumed",
+		q, id, s.Status, status, n, next, s.Period)
+}
+
+// Cancel stops a subscription for good.
+func (m *Manager) Cancel(ctx context.Context, id string) (*Subscription, error) {
+	const q = `
+		UPDATE subscriptions SET status = $2, next_payment_at = NULL, updated_at = now()
+		WHERE id = $1 AND status IN ($3, $4, $5)
+	`
+	return m.transition(ctx, id, "it can't be canceled",
+		q, id, StatusCanceled, StatusActive, StatusPaused, StatusFailed)
+}
+
+// transition runs an update of the subscription's status,
+// returning ErrBadState if it updated nothing.
+func (m *Manager) transition(ctx context.Context, id, why, q string, args ...interface{}) (*Subscription, error) {
+	res, err := m.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating subscription")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		s, err := m.Find(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.WithDetailf(ErrBadState, "subscription %s is %s; %s", id, s.Status, why)
+	}
+	return m.findAndRecord(ctx, id)
+}
+
+func (m *Manager) findAndRecord(ctx context.Context, id string) (*Subscription, error) {
+	s, err := m.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s, event.Record(ctx, m.db, event.SubscriptionUpdated, s.ID, s)
+}
+
+const selectQ = `
+	SELECT id, asset_id, amount, source_account_id, COALESCE(destination_account_id, ''),
+		destination_control_program, interval_unit, interval_count, start_at, end_at, max_failures,
+		status, period, next_payment_at, failures, created_at, updated_at
+	FROM subscriptions
+`
+
+// Find returns the subscription with the given ID.
+func (m *Manager) Find(ctx context.Context, id string) (*Subscription, error) {
+	list, err := m.query(ctx, selectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "subscription %s not found", id)
+	}
+	return list[0], nil
+}
+
+// List returns up to limit subscriptions, oldest first,
+// optionally only those with the given status or source
+// account. Subscriptions with IDs less than or equal to after
+// are skipped; pass the ID of the last subscription returned
+// to get the next page, or "" to get the first.
+func (m *Manager) List(ctx context.Context, status, accountID, after string, limit int) ([]*Subscription, error) {
+	switch status {
+	case "", StatusActive, StatusPaused, StatusFailed, StatusCanceled, StatusCompleted:
+	default:
+		return nil, errors.WithDetailf(ErrBadSubscription, "unknown status %q", status)
+	}
+	return m.query(ctx, selectQ+`
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR source_account_id = $2) AND ($3 = '' OR id > $3)
+		ORDER BY id
+		LIMIT $4
+	`, status, accountID, after, limit)
+}
+
+// Due returns the active subscriptions with a payment due at
+// or before t, soonest first.
+func (m *Manager) Due(ctx context.Context, t time.Time) ([]*Subscription, error) {
+	return m.query(ctx, selectQ+`WHERE status = $1 AND next_payment_at <= $2 ORDER BY next_payment_at, id`, StatusActive, t)
+}
+
+func (m *Manager) query(ctx context.Context, q string, args ...interface{}) ([]*Subscription, error) {
+	var list []*Subscription
+	err := pg.ForQueryRows(ctx, m.db, q, append(args, func(
+		id string, assetID bc.AssetID, amount int64, sourceID, destID string, destProg []byte,
+		interval string, intervalCount int, startAt time.Time, endAt *time.Time, maxFailures int,
+		status string, period int64, next *time.Time, failures int, createdAt, updatedAt time.Time,
+	) {
+		s := &Subscription{
+			ID:                        id,
+			AssetID:                   assetID,
+			Amount:                    uint64(amount),
+			SourceAccountID:           sourceID,
+			DestinationAccountID:      destID,
+			DestinationControlProgram: destProg,
+			Interval:                  interval,
+			IntervalCount:             intervalCount,
+			StartAt:                   startAt.UTC(),
+			EndAt:                     endAt,
+			MaxFailures:               maxFailures,
+			Status:                    status,
+			Period:                    period,
+			NextPaymentAt:             next,
+			Failures:                  failures,
+			CreatedAt:                 createdAt,
+			UpdatedAt:                 updatedAt,
+		}
+		if next != nil {
+			*s.NextPaymentAt = next.UTC()
+		}
+		list = append(list, s)
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying subscriptions")
+	}
+	return list, nil
+}
+
+// Execution is one payment of a subscription: the one that
+// fell due at ScheduledAt.
+type Execution struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	ScheduledAt    time.Time `json:"scheduled_at"`
+	Amount         uint64    `json:"amount"`
+	Status         string    `json:"status"`
+	TransactionID  *bc.Hash  `json:"transaction_id,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Begin records that the subscription's next payment is
+// being submitted. It returns nil if the payment was already
+// begun, by a run that was interrupted; the caller should
+// then Advance past it without paying.
+func (m *Manager) Begin(ctx context.Context, s *Subscription) (*Execution, error) {
+	if s.NextPaymentAt == nil {
+		return nil, errors.WithDetailf(ErrBadState, "subscription %s has no payment due", s.ID)
+	}
+	const q = `
+		INSERT INTO subscription_executions (subscription_id, scheduled_at, amount)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (subscription_id, scheduled_at) DO NOTHING
+		RETURNING id
+	`
+	var id string
+	err := m.db.QueryRowContext(ctx, q, s.ID, *s.NextPaymentAt, int64(s.Amount)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "recording subscription execution")
+	}
+	list, err := m.listExecutions(ctx, execSelectQ+`WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+// Finish records the outcome of an execution: the
+// transaction that made the payment, or the error that
+// stopped it.
+func (m *Manager) Finish(ctx context.Context, x *Execution, txID *bc.Hash, failure error) error {
+	x.Status, x.Error = ExecSucceeded, ""
+	if failure != nil {
+		x.Status, x.Error = ExecFailed, failure.Error()
+	}
+	x.TransactionID = txID
+	var txHash []byte
+	if txID != nil {
+		txHash = txID.Bytes()
+	}
+	const q = `
+		UPDATE subscription_executions SET status = $2, tx_hash = $3, error = NULLIF($4, ''), updated_at = now()
+		WHERE id = $1
+	`
+	_, err := m.db.ExecContext(ctx, q, x.ID, x.Status, txHash, x.Error)
+	return errors.Wrap(err, "recording subscription execution outcome")
+}
+
+// Advance moves the subscription on to its next payment,
+// counting the current one as failed or not. A subscription
+// whose failures reach its MaxFailures stops with status
+// failed; one whose next payment is after its end completes.
+// A subscription paused or canceled in the meantime keeps its
+// status.
+func (m *Manager) Advance(ctx context.Context, s *Subscription, failed bool) (*Subscription, error) {
+	failures := 0
+	if failed {
+		failures = s.Failures + 1
+	}
+	status, next := StatusActive, new(time.Time)
+	t, ok := s.schedule(s.Period + 1)
+	switch {
+	case !ok:
+		status, next = StatusCompleted, nil
+	case failures >= s.MaxFailures:
+		status, *next = StatusFailed, t
+	default:
+		*next = t
+	}
+	const q = `
+		UPDATE subscriptions
+		SET period = $3, failures = $4, updated_at = now(),
+			status = CASE WHEN status = $5 THEN $6 ELSE status END,
+			next_payment_at = CASE WHEN status = $7 THEN NULL ELSE $8::timestamp with time zone END
+		WHERE id = $1 AND period = $2
+	`
+	_, err := m.db.ExecContext(ctx, q, s.ID, s.Period, s.Period+1, failures,
+		StatusActive, status, StatusCanceled, next)
+	if err != nil {
+		return nil, errors.Wrap(err, "advancing subscription")
+	}
+	return m.findAndRecord(ctx, s.ID)
+}
+
+const execSelectQ = `
+	SELECT id, subscription_id, scheduled_at, amount, status, tx_hash, COALESCE(error, ''), created_at, updated_at
+	FROM subscription_executions
+`
+
+// ListExecutions returns up to limit executions, oldest
+// first, optionally only those of one subscription.
+// Executions with IDs less than or equal to after are
+// skipped; pass the ID of the last execution returned to get
+// the next page, or "" to get the first.
+func (m *Manager) ListExecutions(ctx context.Context, subscriptionID, after string, limit int) ([]*Execution, error) {
+	return m.listExecutions(ctx, execSelectQ+`
+		WHERE ($1 = '' OR subscription_id = $1) AND ($2 = '' OR id > $2)
+		ORDER BY id
+		LIMIT $3
+	`, subscriptionID, after, limit)
+}
+
+func (m *Manager) listExecutions(ctx context.Context, q string, args ...interface{}) ([]*Execution, error) {
+	var list []*Execution
+	err := pg.ForQueryRows(ctx, m.db, q, append(args, func(
+		id, subscriptionID string, scheduledAt time.Time, amount int64, status string,
+		txHash []byte, msg string, createdAt, updatedAt time.Time,
+	) error {
+		x := &Execution{
+			ID:             id,
+			SubscriptionID: subscriptionID,
+			ScheduledAt:    scheduledAt.UTC(),
+			Amount:         uint64(amount),
+			Status:         status,
+			Error:          msg,
+			CreatedAt:      createdAt,
+			UpdatedAt:      updatedAt,
+		}
+		if txHash != nil {
+			x.TransactionID = new(bc.Hash)
+			err := x.TransactionID.Scan(txHash)
+			if err != nil {
+				return err
+			}
+		}
+		list = append(list, x)
+		return nil
+	})...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying subscription executions")
+	}
+	return list, nil
+}
+
+// RefData returns the reference data recorded in the
+// transaction making an execution's payment.
+func RefData(s *Subscription, x *Execution) map[string]interface{} {
+	return map[string]interface{}{"subscription": map[string]interface{}{
+		"id":           s.ID,
+		"execution_id": x.ID,
+		"scheduled_at": x.ScheduledAt,
+	}}
+}
@@ -0,0 +1,70 @@
+package subscription
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"chain/errors"
+)
+
+func TestCreateInvalid(t *testing.T) {
+	past := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []*Subscription{
+		{SourceAccountID: "acc1", DestinationAccountID: "acc2", Interval: IntervalDay},
+		{Amount: math.MaxInt64 + 1, SourceAccountID: "acc1", DestinationAccountID: "acc2", Interval: IntervalDay},
+		{Amount: 10, DestinationAccountID: "acc2", Interval: IntervalDay},
+		{Amount: 10, SourceAccountID: "acc1", Interval: IntervalDay},
+		{Amount: 10, SourceAccountID: "acc1", DestinationAccountID: "acc2", DestinationControlProgram: []byte{0x51}, Interval: IntervalDay},
+		{Amount: 10, SourceAccountID: "acc1", DestinationAccountID: "acc1", Interval: IntervalDay},
+		{Amount: 10, SourceAccountID: "acc1", DestinationAccountID: "acc2", Interval: "year"},
+		{Amount: 10, SourceAccountID: "acc1", DestinationAccountID: "acc2", Interval: IntervalDay, IntervalCount: -1},
+		{Amount: 10, SourceAccountID: "acc1", DestinationAccountID: "acc2", Interval: IntervalDay, MaxFailures: -1},
+		{Amount: 10, SourceAccountID: "acc1", DestinationAccountID: "acc2", Interval: IntervalDay, EndAt: &past},
+	}
+	m := new(Manager)
+	for i, s := range cases {
+		_, err := m.Create(context.Background(), s)
+		if errors.Root(err) != ErrBadSubscription {
+			t.Errorf("case %d: Create = %v, want %v", i, err, ErrBadSubscription)
+		}
+	}
+}
+
+func TestPaymentAt(t *testing.T) {
+	start := time.Date(2017, 1, 31, 9, 30, 0, 0, time.UTC)
+	cases := []struct {
+		interval string
+		count    int
+		n        int64
+		want     time.Time
+	}{
+		{IntervalDay, 1, 0, start},
+		{IntervalDay, 1, 1, time.Date(2017, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{IntervalDay, 3, 2, time.Date(2017, 2, 6, 9, 30, 0, 0, time.UTC)},
+		{IntervalWeek, 1, 1, time.Date(2017, 2, 7, 9, 30, 0, 0, time.UTC)},
+		{IntervalWeek, 2, 2, time.Date(2017, 2, 28, 9, 30, 0, 0, time.UTC)},
+		{IntervalMonth, 1, 1, time.Date(2017, 2, 28, 9, 30, 0, 0, time.UTC)}, // short month
+		{IntervalMonth, 1, 2, time.Date(2017, 3, 31, 9, 30, 0, 0, time.UTC)}, // no drift
+		{IntervalMonth, 1, 13, time.Date(2018, 2, 28, 9, 30, 0, 0, time.UTC)},
+		{IntervalMonth, 3, 1, time.Date(2017, 4, 30, 9, 30, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s := &Subscription{Interval: c.interval, IntervalCount: c.count, StartAt: start}
+		if got := s.PaymentAt(c.n); !got.Equal(c.want) {
+			t.Errorf("every %d %s: PaymentAt(%d) = %s, want %s", c.count, c.interval, c.n, got, c.want)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC)
+	s := &Subscription{Interval: IntervalDay, IntervalCount: 1, StartAt: start, EndAt: &end}
+	for n, want := range []bool{true, true, true, false} {
+		if _, ok := s.schedule(int64(n)); ok != want {
+			t.Errorf("schedule(%d) ok = %v, want %v", n, ok, want)
+		}
+	}
+}
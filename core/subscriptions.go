@@ -0,0 +1,281 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chain/core/job"
+	"chain/core/subscription"
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+type subscriptionRequest struct {
+	SourceAccountID           string             `json:"source_account_id"`
+	SourceAccountAlias        string             `json:"source_account_alias"`
+	DestinationAccountID      string             `json:"destination_account_id"`
+	DestinationAccountAlias   string             `json:"destination_account_alias"`
+	DestinationControlProgram chainjson.HexBytes `json:"destination_control_program"`
+	AssetID                   *bc.AssetID        `json:"asset_id"`
+	AssetAlias                string             `json:"asset_alias"`
+	Amount                    uint64             `json:"amount"`
+	Interval                  string             `json:"interval"`
+	IntervalCount             int                `json:"interval_count"`
+	StartAt                   *time.Time         `json:"start_at"`
+	EndAt                     *time.Time         `json:"end_at"`
+	MaxFailures               int                `json:"max_failures"`
+}
+
+// POST /create-subscription
+//
+// Creates a recurring payment of an amount of an asset from
+// one account to another account or a control program, every
+// interval_count days, weeks or months from start_at until
+// end_at. Payments are made by a recurring job, in
+// transactions signed with the mock HSM.
+func (a *API) createSubscription(ctx context.Context, x subscriptionRequest) (*subscription.Subscription, error) {
+	if a.signTemplate == nil {
+		return nil, errors.WithDetail(errNoMockHSM, "subscription payments are signed with keys held by the mock HSM")
+	}
+	sourceID, err := a.accountID(ctx, x.SourceAccountID, x.SourceAccountAlias)
+	if err != nil {
+		return nil, err
+	}
+	s := &subscription.Subscription{
+		Amount:                    x.Amount,
+		SourceAccountID:           sourceID,
+		DestinationAccountID:      x.DestinationAccountID,
+		DestinationControlProgram: x.DestinationControlProgram,
+		Interval:                  x.Interval,
+		IntervalCount:             x.IntervalCount,
+		EndAt:                     x.EndAt,
+		MaxFailures:               x.MaxFailures,
+	}
+	if x.StartAt != nil {
+		s.StartAt = *x.StartAt
+	}
+	switch {
+	case x.AssetAlias != "" && x.AssetID != nil:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id and asset_alias can't both be set")
+	case x.AssetAlias != "":
+		ast, err := a.assets.FindByAlias(ctx, x.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find asset by alias")
+		}
+		s.AssetID = ast.AssetID
+	case x.AssetID != nil:
+		s.AssetID = *x.AssetID
+	default:
+		return nil, errors.WithDetail(subscription.ErrBadSubscription, "an asset_id or asset_alias is required")
+	}
+	if x.DestinationAccountAlias != "" {
+		if x.DestinationAccountID != "" {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "destination_account_id and destination_account_alias can't both be set")
+		}
+		acct, err := a.accounts.FindByAlias(ctx, x.DestinationAccountAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "find account by alias")
+		}
+		s.DestinationAccountID = acct.ID
+	}
+	return a.subscriptions.Create(ctx, s)
+}
+
+// POST /pause-subscription
+func (a *API) pauseSubscription(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*subscription.Subscription, error) {
+	return a.subscriptions.Pause(ctx, x.ID)
+}
+
+// POST /resume-subscription
+//
+// Restarts a paused or failed subscription, skipping the
+// payments that fell due while it was stopped.
+func (a *API) resumeSubscription(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*subscription.Subscription, error) {
+	return a.subscriptions.Resume(ctx, x.ID)
+}
+
+// POST /cancel-subscription
+func (a *API) cancelSubscription(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*subscription.Subscription, error) {
+	return a.subscriptions.Cancel(ctx, x.ID)
+}
+
+// POST /get-subscription
+func (a *API) getSubscription(ctx context.Context, x struct {
+	ID string `json:"id"`
+}) (*subscription.Subscription, error) {
+	return a.subscriptions.Find(ctx, x.ID)
+}
+
+// subscriptionPage is the response to /list-subscriptions.
+type subscriptionPage struct {
+	Items    []*subscription.Subscription `json:"items"`
+	Next     subscriptionQuery            `json:"next"`
+	LastPage bool                         `json:"last_page"`
+}
+
+type subscriptionQuery struct {
+	Status    string `json:"status"`
+	AccountID string `json:"account_id"`
+	After     string `json:"after"`
+	PageSize  int    `json:"page_size"`
+}
+
+// POST /list-subscriptions
+//
+// Lists subscriptions, oldest first, optionally only those
+// with the given status or paying from the given account.
+func (a *API) listSubscriptions(ctx context.Context, in subscriptionQuery) (*subscriptionPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.subscriptions.List(ctx, in.Status, in.AccountID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*subscription.Subscription{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &subscriptionPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// executionPage is the response to /list-subscription-executions.
+type executionPage struct {
+	Items    []*subscription.Execution `json:"items"`
+	Next     executionQuery            `json:"next"`
+	LastPage bool                      `json:"last_page"`
+}
+
+type executionQuery struct {
+	SubscriptionID string `json:"subscription_id"`
+	After          string `json:"after"`
+	PageSize       int    `json:"page_size"`
+}
+
+// POST /list-subscription-executions
+//
+// Lists the payments made or attempted by subscriptions,
+// oldest first, optionally only those of one subscription.
+func (a *API) listSubscriptionExecutions(ctx context.Context, in executionQuery) (*executionPage, error) {
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+	list, err := a.subscriptions.ListExecutions(ctx, in.SubscriptionID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*subscription.Execution{} // send [], not null
+	}
+
+	out := in
+	if len(list) > 0 {
+		out.After = list[len(list)-1].ID
+	}
+	return &executionPage{
+		Items:    list,
+		Next:     out,
+		LastPage: len(list) < limit,
+	}, nil
+}
+
+// runSubscriptions makes the payment due for every active
+// subscription. It runs as a recurring job, once per
+// runSubscriptionsPeriod, and makes at most one payment per
+// subscription per run. A failed payment is recorded, and
+// doesn't hold up other subscriptions.
+func (a *API) runSubscriptions(ctx context.Context, _ *job.Job) error {
+	subs, err := a.subscriptions.Due(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, s := range subs {
+		err = a.paySubscription(ctx, s)
+		if err != nil {
+			log.Error(ctx, err, fmt.Sprintf("paying subscription %s due %s", s.ID, s.NextPaymentAt))
+		}
+	}
+	return nil
+}
+
+// paySubscription makes the subscription's next payment and
+// moves it on to the one after. A payment that an
+// interrupted run had begun is skipped.
+func (a *API) paySubscription(ctx context.Context, s *subscription.Subscription) error {
+	x, err := a.subscriptions.Begin(ctx, s)
+	if err != nil {
+		return err
+	}
+	var payErr error
+	if x != nil {
+		var txID *bc.Hash
+		txID, payErr = a.submitSubscriptionPayment(ctx, s, x)
+		err = a.subscriptions.Finish(ctx, x, txID, payErr)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = a.subscriptions.Advance(ctx, s, payErr != nil)
+	return err
+}
+
+// submitSubscriptionPayment submits a transaction paying an
+// execution's amount from the subscription's source account,
+// and waits until it has been processed. The transaction
+// records the execution in its reference data.
+func (a *API) submitSubscriptionPayment(ctx context.Context, s *subscription.Subscription, x *subscription.Execution) (*bc.Hash, error) {
+	assetID := s.AssetID.String()
+	dest := map[string]interface{}{
+		"type":       "control_account",
+		"account_id": s.DestinationAccountID,
+		"asset_id":   assetID,
+		"amount":     x.Amount,
+	}
+	if s.DestinationAccountID == "" {
+		delete(dest, "account_id")
+		dest["type"] = "control_program"
+		dest["control_program"] = s.DestinationControlProgram
+	}
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: []map[string]interface{}{{
+		"type":       "spend_account",
+		"account_id": s.SourceAccountID,
+		"asset_id":   assetID,
+		"amount":     x.Amount,
+	}, dest, {
+		"type":           "set_transaction_reference_data",
+		"reference_data": subscription.RefData(s, x),
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing subscription payment")
+	}
+	_, err = a.submitSingle(ctx, tpl, "processed")
+	if err != nil {
+		return nil, err
+	}
+	return &tpl.Transaction.ID, nil
+}
@@ -79,8 +79,35 @@ func TLSConfig(certFile, keyFile, rootCAs string) (*tls.Config, error) {
 		return nil, errors.Wrap(err)
 	}
 	config.RootCAs.AddCert(x509Cert)
-	config.ClientCAs = config.RootCAs
-	return config, err
+
+	// Client CAs start out the same as the root CAs, but are
+	// kept in a separate pool so AddClientCAs can trust
+	// partner CAs for client authentication without also
+	// trusting them to identify servers we dial.
+	config.ClientCAs, err = loadRootCAs(rootCAs)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	config.ClientCAs.AddCert(x509Cert)
+	return config, nil
+}
+
+// AddClientCAs reads a list of PEM-encoded X.509 certificates
+// from name and adds them to the CAs config trusts to issue
+// client certificates. Clients presenting a certificate
+// issued by one of them are authorized only by x509 grants
+// that name its issuer, and never by grants of the internal
+// or crosscore policies.
+func AddClientCAs(config *tls.Config, name string) error {
+	pem, err := ioutil.ReadFile(name)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	ok := config.ClientCAs.AppendCertsFromPEM(pem)
+	if !ok {
+		return errors.Wrap(errors.New("cannot parse client CA certs"))
+	}
+	return nil
 }
 
 // loadRootCAs reads a list of PEM-encoded X.509 certificates from name.
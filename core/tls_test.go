@@ -0,0 +1,84 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddClientCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	partnerFile := filepath.Join(dir, "partner.crt")
+	writeTestCert(t, "core", certFile, keyFile)
+	writeTestCert(t, "partner", partnerFile, filepath.Join(dir, "partner.key"))
+
+	config, err := TLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AddClientCAs(config, partnerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(config.ClientCAs.Subjects()); got != 2 {
+		t.Errorf("client CAs = %d, want 2", got)
+	}
+	if got := len(config.RootCAs.Subjects()); got != 1 {
+		t.Errorf("root CAs = %d, want 1 (partner CAs must not be trusted for servers)", got)
+	}
+
+	err = AddClientCAs(config, keyFile)
+	if err == nil {
+		t.Error("AddClientCAs(key file) error = nil, want parse error")
+	}
+}
+
+// writeTestCert writes a self-signed certificate with the
+// given common name, and its key, as PEM.
+func writeTestCert(t *testing.T, cn, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
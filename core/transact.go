@@ -3,16 +3,19 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"reflect"
 	"sync"
 	"time"
 
 	"chain/core/leader"
 	"chain/core/txbuilder"
+	"chain/core/usage"
 	"chain/database/pg"
 	chainjson "chain/encoding/json"
 	"chain/errors"
 	"chain/log"
 	"chain/net/http/httperror"
+	"chain/net/http/httpjson"
 	"chain/net/http/reqid"
 	"chain/protocol/bc"
 	"chain/protocol/bc/legacy"
@@ -37,6 +40,10 @@ func (a *API) actionDecoder(action string) (func([]byte) (txbuilder.Action, erro
 		decoder = a.accounts.DecodeSpendAction
 	case "spend_account_unspent_output":
 		decoder = a.accounts.DecodeSpendUTXOAction
+	case "spend_escrow":
+		decoder = a.escrows.DecodeSpendAction
+	case "spend_htlc":
+		decoder = a.htlcs.DecodeSpendAction
 	case "set_transaction_reference_data":
 		decoder = txbuilder.DecodeSetTxRefDataAction
 	default:
@@ -67,6 +74,13 @@ func (a *API) buildSingle(ctx context.Context, req *buildRequest) (*txbuilder.Te
 		if err != nil {
 			return nil, err
 		}
+		// Accept amounts sent as strings, as they're received
+		// by clients that set httpjson.NumbersHeader.
+		blank, _ := decoder([]byte("{}"))
+		b, err = httpjson.UnquoteInts(b, reflect.TypeOf(blank))
+		if err != nil {
+			return nil, err
+		}
 		a, err := decoder(b)
 		if err != nil {
 			return nil, errors.WithDetailf(errBadAction, "%s on action %d", err.Error(), i)
@@ -79,7 +93,7 @@ func (a *API) buildSingle(ctx context.Context, req *buildRequest) (*txbuilder.Te
 		ttl = defaultTxTTL
 	}
 	maxTime := time.Now().Add(ttl)
-	tpl, err := txbuilder.Build(ctx, req.Tx, actions, maxTime)
+	tpl, err := buildRetrying(ctx, req.Tx, actions, maxTime)
 	if errors.Root(err) == txbuilder.ErrAction {
 		// Format each of the inner errors contained in the data.
 		var formattedErrs []httperror.Response
@@ -100,6 +114,29 @@ func (a *API) buildSingle(ctx context.Context, req *buildRequest) (*txbuilder.Te
 	return tpl, nil
 }
 
+// buildRetrying builds a template, starting over if an action
+// fails with a transient conflict, such as a deadlock while
+// reserving UTXOs or saving change control programs
+// alongside concurrent builds. Build cancels the
+// reservations of a failed attempt, so each attempt starts
+// afresh.
+func buildRetrying(ctx context.Context, tx *legacy.TxData, actions []txbuilder.Action, maxTime time.Time) (tpl *txbuilder.Template, err error) {
+	err = pg.Retry(ctx, func(ctx context.Context) error {
+		var err error
+		tpl, err = txbuilder.Build(ctx, tx, actions, maxTime)
+		if errors.Root(err) != txbuilder.ErrAction {
+			return err
+		}
+		for _, actionErr := range errors.Data(err)["actions"].([]error) {
+			if pg.IsRetryable(actionErr) {
+				return actionErr
+			}
+		}
+		return err
+	})
+	return tpl, err
+}
+
 // POST /build-transaction
 func (a *API) build(ctx context.Context, buildReqs []*buildRequest) (interface{}, error) {
 	// If we're not the leader, we don't have access to the current
@@ -121,6 +158,11 @@ func (a *API) build(ctx context.Context, buildReqs []*buildRequest) (interface{}
 			defer wg.Done()
 			defer batchRecover(subctx, &responses[i])
 
+			err := a.addFees(subctx, buildReqs[i])
+			if err != nil {
+				responses[i] = err
+				return
+			}
 			tmpl, err := a.buildSingle(subctx, buildReqs[i])
 			if err != nil {
 				responses[i] = err
@@ -139,10 +181,27 @@ func (a *API) submitSingle(ctx context.Context, tpl *txbuilder.Template, waitUnt
 		return nil, errors.Wrap(txbuilder.ErrMissingRawTx)
 	}
 
-	err := a.finalizeTxWait(ctx, tpl, waitUntil)
+	err := a.checkTxQuotas(tpl.Transaction)
+	if err != nil {
+		return nil, errors.Wrapf(err, "tx %s", tpl.Transaction.ID.String())
+	}
+	err = a.screen(ctx, tpl.Transaction)
+	if err != nil {
+		return nil, errors.Wrapf(err, "tx %s", tpl.Transaction.ID.String())
+	}
+	ev, err := a.checkRules(ctx, tpl.Transaction)
+	if err != nil {
+		return nil, errors.Wrapf(err, "tx %s", tpl.Transaction.ID.String())
+	}
+
+	err = a.finalizeTxWait(ctx, tpl, waitUntil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "tx %s", tpl.Transaction.ID.String())
 	}
+	a.recordActivity(ctx, ev)
+	if a.usage != nil {
+		a.usage.Add(usage.Issuances, countIssuances(tpl.Transaction))
+	}
 
 	return map[string]string{"id": tpl.Transaction.ID.String()}, nil
 }
@@ -232,6 +291,10 @@ func (a *API) finalizeTxWait(ctx context.Context, txTemplate *txbuilder.Template
 	if err != nil {
 		return err
 	}
+	err = a.recordSubmitted(ctx, txTemplate.Transaction)
+	if err != nil {
+		return err
+	}
 	if waitUntil == "none" {
 		return nil
 	}
@@ -13,12 +13,16 @@ import (
 	"chain/core/pin"
 	"chain/core/query"
 	"chain/core/txbuilder"
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/bc/bctest"
 	"chain/protocol/bc/legacy"
 	"chain/protocol/prottest"
 	"chain/testutil"
+
+	"github.com/lib/pq"
 )
 
 func TestAccountTransferSpendChange(t *testing.T) {
@@ -194,3 +198,63 @@ func TestWaitForTxInBlockResubmits(t *testing.T) {
 		return
 	}
 }
+
+// conflictAction fails to build with a serialization failure
+// the first fails times it's built.
+type conflictAction struct {
+	fails, builds int
+}
+
+func (c *conflictAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	c.builds++
+	if c.builds <= c.fails {
+		return errors.Wrap(&pq.Error{Code: "40001"}, "reserving utxos")
+	}
+	return b.AddOutput(legacy.NewTxOutput(bc.AssetID{}, 1, []byte{1}, nil))
+}
+
+func TestBuildRetrying(t *testing.T) {
+	ctx := context.Background()
+	maxTime := time.Now().Add(time.Minute)
+
+	act := &conflictAction{fails: 2}
+	_, err := buildRetrying(ctx, nil, []txbuilder.Action{act}, maxTime)
+	if err != nil {
+		t.Fatalf("build after transient conflicts = %v, want it retried", err)
+	}
+	if act.builds != 3 {
+		t.Errorf("built %d times, want 3", act.builds)
+	}
+
+	act = &conflictAction{fails: 100}
+	_, err = buildRetrying(ctx, nil, []txbuilder.Action{act}, maxTime)
+	if errors.Root(err) != pg.ErrConflict {
+		t.Fatalf("build with persistent conflict = %v, want %v", err, pg.ErrConflict)
+	}
+	if act.builds < 2 {
+		t.Errorf("built %d times, want retries", act.builds)
+	}
+	if got := errorFormatter.Format(err).ChainCode; got != "CH012" {
+		t.Errorf("persistent conflict formatted as %s, want CH012", got)
+	}
+}
+
+func TestSubmitChecksWithoutEngines(t *testing.T) {
+	ctx := context.Background()
+	tx := legacy.NewTx(legacy.TxData{Version: 1})
+	api := &API{} // no screener, rules engine or usage meter
+
+	err := api.checkTxQuotas(tx)
+	if err != nil {
+		t.Errorf("checkTxQuotas = %v, want nil", err)
+	}
+	err = api.screen(ctx, tx)
+	if err != nil {
+		t.Errorf("screen = %v, want nil", err)
+	}
+	ev, err := api.checkRules(ctx, tx)
+	if ev != nil || err != nil {
+		t.Errorf("checkRules = (%v, %v), want (nil, nil)", ev, err)
+	}
+	api.recordActivity(ctx, ev)
+}
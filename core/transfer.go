@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/leader"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+type transferRequest struct {
+	SourceAccountID         string                 `json:"source_account_id"`
+	SourceAccountAlias      string                 `json:"source_account_alias"`
+	DestinationAccountID    string                 `json:"destination_account_id"`
+	DestinationAccountAlias string                 `json:"destination_account_alias"`
+	DestinationAddressAlias string                 `json:"destination_address_alias"`
+	AssetID                 string                 `json:"asset_id"`
+	AssetAlias              string                 `json:"asset_alias"`
+	Amount                  uint64                 `json:"amount"`
+	ReferenceData           map[string]interface{} `json:"reference_data"`
+	TTL                     json.Duration          `json:"ttl"`
+}
+
+// POST /transfer
+//
+// Moves an amount of an asset from one account in this core
+// to another, or to a verified address book entry, in a
+// single call. It builds the transaction,
+// signs it with the core's own keys, and submits it, waiting
+// until it is confirmed. It is a shortcut for
+// /build-transaction, /mockhsm/sign-transaction and
+// /submit-transaction, so the source account's keys must be
+// held by the core's mock HSM.
+func (a *API) transfer(ctx context.Context, req transferRequest) (interface{}, error) {
+	if a.signTemplate == nil {
+		return nil, errors.WithDetail(errNoMockHSM, "transfers are signed with keys held by the mock HSM")
+	}
+	// Like /build-transaction, reserving the outputs to spend
+	// must happen on the leader.
+	if a.leader.State() != leader.Leading {
+		var resp interface{}
+		err := a.forwardToLeader(ctx, "/transfer", req, &resp)
+		return resp, err
+	}
+
+	actions, err := transferActions(req)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := a.buildSingle(ctx, &buildRequest{Actions: actions, TTL: req.TTL})
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), a.signTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing transfer")
+	}
+	return a.submitSingle(ctx, tpl, "confirmed")
+}
+
+// transferActions returns the build actions for req.
+func transferActions(req transferRequest) ([]map[string]interface{}, error) {
+	if (req.SourceAccountID == "") == (req.SourceAccountAlias == "") {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "either source_account_id or source_account_alias is required")
+	}
+	var dests int
+	for _, d := range []string{req.DestinationAccountID, req.DestinationAccountAlias, req.DestinationAddressAlias} {
+		if d != "" {
+			dests++
+		}
+	}
+	if dests != 1 {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "one of destination_account_id, destination_account_alias or destination_address_alias is required")
+	}
+	if (req.AssetID == "") == (req.AssetAlias == "") {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "either asset_id or asset_alias is required")
+	}
+	if req.Amount == 0 {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "amount must be positive")
+	}
+
+	spend := map[string]interface{}{"type": "spend_account", "amount": req.Amount}
+	control := map[string]interface{}{"type": "control_account", "amount": req.Amount}
+	if req.DestinationAddressAlias != "" {
+		// filterAliases resolves the alias to its control program.
+		control = map[string]interface{}{"type": "control_program", "amount": req.Amount}
+	}
+	setNonEmpty(spend, "account_id", req.SourceAccountID)
+	setNonEmpty(spend, "account_alias", req.SourceAccountAlias)
+	setNonEmpty(control, "account_id", req.DestinationAccountID)
+	setNonEmpty(control, "account_alias", req.DestinationAccountAlias)
+	setNonEmpty(control, "address_alias", req.DestinationAddressAlias)
+	for _, act := range []map[string]interface{}{spend, control} {
+		setNonEmpty(act, "asset_id", req.AssetID)
+		setNonEmpty(act, "asset_alias", req.AssetAlias)
+	}
+
+	actions := []map[string]interface{}{spend, control}
+	if len(req.ReferenceData) > 0 {
+		actions = append(actions, map[string]interface{}{
+			"type":           "set_transaction_reference_data",
+			"reference_data": req.ReferenceData,
+		})
+	}
+	return actions, nil
+}
+
+func setNonEmpty(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// templateXPubs returns every xpub tpl's signing instructions
+// ask for a signature from.
+func templateXPubs(tpl *txbuilder.Template) []chainkd.XPub {
+	var xpubs []chainkd.XPub
+	for _, sigInst := range tpl.SigningInstructions {
+		for _, sw := range sigInst.SignatureWitnesses {
+			for _, k := range sw.Keys {
+				xpubs = append(xpubs, k.XPub)
+			}
+		}
+	}
+	return xpubs
+}
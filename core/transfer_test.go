@@ -0,0 +1,62 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+func TestTransferActions(t *testing.T) {
+	got, err := transferActions(transferRequest{
+		SourceAccountAlias:   "alice",
+		DestinationAccountID: "acc1",
+		AssetAlias:           "gold",
+		Amount:               10,
+		ReferenceData:        map[string]interface{}{"memo": "rent"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"type": "spend_account", "account_alias": "alice", "asset_alias": "gold", "amount": uint64(10)},
+		{"type": "control_account", "account_id": "acc1", "asset_alias": "gold", "amount": uint64(10)},
+		{"type": "set_transaction_reference_data", "reference_data": map[string]interface{}{"memo": "rent"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transferActions = %v, want %v", got, want)
+	}
+
+	got, err = transferActions(transferRequest{
+		SourceAccountID:         "acc0",
+		DestinationAddressAlias: "bob",
+		AssetID:                 "a",
+		Amount:                  5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]interface{}{
+		{"type": "spend_account", "account_id": "acc0", "asset_id": "a", "amount": uint64(5)},
+		{"type": "control_program", "address_alias": "bob", "asset_id": "a", "amount": uint64(5)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transferActions = %v, want %v", got, want)
+	}
+
+	bad := []transferRequest{
+		{DestinationAccountID: "acc1", AssetID: "a", Amount: 1},
+		{SourceAccountID: "acc0", SourceAccountAlias: "alice", DestinationAccountID: "acc1", AssetID: "a", Amount: 1},
+		{SourceAccountID: "acc0", AssetID: "a", Amount: 1},
+		{SourceAccountID: "acc0", DestinationAccountID: "acc1", DestinationAddressAlias: "bob", AssetID: "a", Amount: 1},
+		{SourceAccountID: "acc0", DestinationAccountID: "acc1", Amount: 1},
+		{SourceAccountID: "acc0", DestinationAccountID: "acc1", AssetID: "a"},
+	}
+	for i, req := range bad {
+		_, err := transferActions(req)
+		if errors.Root(err) != httpjson.ErrBadRequest {
+			t.Errorf("request %d: got error %v, want %v", i, err, httpjson.ErrBadRequest)
+		}
+	}
+}
@@ -36,13 +36,19 @@ func (t *Template) Hash(idx uint32) bc.Hash {
 
 // SigningInstruction gives directions for signing inputs in a TxTemplate.
 type SigningInstruction struct {
-	Position           uint32              `json:"position"`
-	SignatureWitnesses []*signatureWitness `json:"witness_components,omitempty"`
+	Position uint32 `json:"position"`
+
+	// Arguments, if any, come before those of the signature
+	// witnesses in the input's witness, for control programs
+	// that take arguments of their own.
+	Arguments          []chainjson.HexBytes `json:"arguments,omitempty"`
+	SignatureWitnesses []*signatureWitness  `json:"witness_components,omitempty"`
 }
 
 func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	var pre struct {
-		Position           uint32 `json:"position"`
+		Position           uint32               `json:"position"`
+		Arguments          []chainjson.HexBytes `json:"arguments"`
 		SignatureWitnesses []struct {
 			Type string
 			signatureWitness
@@ -54,6 +60,7 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	}
 
 	si.Position = pre.Position
+	si.Arguments = pre.Arguments
 	si.SignatureWitnesses = make([]*signatureWitness, 0, len(pre.SignatureWitnesses))
 	for i, w := range pre.SignatureWitnesses {
 		if w.Type != "signature" {
@@ -38,6 +38,9 @@ func materializeWitnesses(txTemplate *Template) error {
 		}
 
 		var witness [][]byte
+		for _, arg := range sigInst.Arguments {
+			witness = append(witness, arg)
+		}
 		for j, sw := range sigInst.SignatureWitnesses {
 			err := sw.materialize(txTemplate, sigInst.Position, &witness)
 			if err != nil {
@@ -48,7 +48,8 @@ func TestInferConstraints(t *testing.T) {
 
 func TestWitnessJSON(t *testing.T) {
 	si := &SigningInstruction{
-		Position: 17,
+		Position:  17,
+		Arguments: []chainjson.HexBytes{{1}, {2, 3}},
 		SignatureWitnesses: []*signatureWitness{
 			&signatureWitness{
 				Quorum: 4,
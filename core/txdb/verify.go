@@ -0,0 +1,131 @@
+package txdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/bc/legacy"
+	"chain/protocol/state"
+)
+
+// A Divergence is a block at which a standby database
+// disagrees with the primary.
+type Divergence struct {
+	Height uint64
+	Reason string
+}
+
+// A StandbyReport is the result of comparing a standby
+// database with the primary.
+type StandbyReport struct {
+	// Height is the height of the primary's blockchain.
+	Height uint64
+	// StandbyHeight is the height of the standby's blockchain.
+	// A standby that's behind the primary isn't divergent, just
+	// lagging; only the blocks it has are compared.
+	StandbyHeight uint64
+	Divergences   []Divergence
+}
+
+// VerifyStandby replays the primary's blockchain from the
+// initial block, checking that every block the standby
+// holds, and every state snapshot it would recover from,
+// matches the primary's. Blocks the standby holds beyond the
+// primary's height are divergent too.
+//
+// It returns an error, rather than a divergence, if the
+// primary's own blocks are missing or don't replay.
+func VerifyStandby(ctx context.Context, primary, standby pg.DB) (*StandbyReport, error) {
+	r := new(StandbyReport)
+	err := primary.QueryRowContext(ctx, `SELECT COALESCE(MAX(height), 0) FROM blocks`).Scan(&r.Height)
+	if err != nil {
+		return nil, errors.Wrap(err, "primary height")
+	}
+	err = standby.QueryRowContext(ctx, `SELECT COALESCE(MAX(height), 0) FROM blocks`).Scan(&r.StandbyHeight)
+	if err != nil {
+		return nil, errors.Wrap(err, "standby height")
+	}
+
+	snapshotHeights := make(map[uint64]bool)
+	err = pg.ForQueryRows(ctx, standby, `SELECT height FROM snapshots`, func(height uint64) {
+		snapshotHeights[height] = true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "standby snapshots")
+	}
+
+	diverge := func(height uint64, format string, args ...interface{}) {
+		r.Divergences = append(r.Divergences, Divergence{Height: height, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	snapshot := state.Empty()
+	for h := uint64(1); h <= r.Height; h++ {
+		hash, raw, err := getHashedBlock(ctx, primary, h)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("primary is missing block %d", h)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "primary block")
+		}
+		var b legacy.Block
+		err = b.Scan(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding primary block %d", h)
+		}
+		err = snapshot.ApplyBlock(legacy.MapBlock(&b))
+		if err != nil {
+			return nil, errors.Wrapf(err, "applying primary block %d", h)
+		}
+		if b.AssetsMerkleRoot != snapshot.Tree.RootHash() {
+			return nil, fmt.Errorf("primary block %d has state root %x; replay has root %x",
+				h, b.AssetsMerkleRoot.Bytes(), snapshot.Tree.RootHash().Bytes())
+		}
+
+		if h > r.StandbyHeight {
+			continue
+		}
+		shash, sraw, err := getHashedBlock(ctx, standby, h)
+		if err == sql.ErrNoRows {
+			diverge(h, "missing from standby")
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "standby block")
+		}
+		if shash != hash {
+			diverge(h, "standby has block %x, primary has %x", shash.Bytes(), hash.Bytes())
+		} else if !bytes.Equal(sraw, raw) {
+			diverge(h, "standby block data differs from primary")
+		}
+
+		if snapshotHeights[h] {
+			data, err := getRawSnapshot(ctx, standby, h)
+			if err != nil {
+				return nil, errors.Wrap(err, "standby snapshot")
+			}
+			s, err := DecodeSnapshot(data)
+			if err != nil {
+				diverge(h, "standby snapshot doesn't decode: %s", err)
+			} else if s.Tree.RootHash() != snapshot.Tree.RootHash() {
+				diverge(h, "standby snapshot has state root %x, replay has %x",
+					s.Tree.RootHash().Bytes(), snapshot.Tree.RootHash().Bytes())
+			}
+		}
+	}
+	for h := r.Height + 1; h <= r.StandbyHeight; h++ {
+		diverge(h, "standby has a block beyond the primary's height")
+	}
+	return r, nil
+}
+
+// getHashedBlock returns the hash and raw data of the block
+// at height. It returns sql.ErrNoRows, unwrapped, if there
+// is no such block.
+func getHashedBlock(ctx context.Context, db pg.DB, height uint64) (hash bc.Hash, data []byte, err error) {
+	const q = `SELECT block_hash, data FROM blocks WHERE height = $1`
+	err = db.QueryRowContext(ctx, q, height).Scan(&hash, &data)
+	return hash, data, err
+}
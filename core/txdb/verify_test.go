@@ -0,0 +1,65 @@
+package txdb
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc/legacy"
+	"chain/protocol/prottest"
+	"chain/protocol/state"
+	"chain/testutil"
+)
+
+func TestVerifyStandby(t *testing.T) {
+	ctx := context.Background()
+	primaryDB, standbyDB := pgtest.NewTx(t), pgtest.NewTx(t)
+	primary, standby := NewStore(primaryDB), NewStore(standbyDB)
+
+	c := prottest.NewChain(t)
+	b1 := prottest.Initial(t, c)
+	b2 := prottest.MakeBlock(t, c, nil)
+	b3 := prottest.MakeBlock(t, c, nil)
+
+	// The standby lacks block 2, has a different block 3,
+	// and a snapshot at block 1 that doesn't match the replay.
+	forked := *b3
+	forked.TimestampMS++
+	for _, b := range []*legacy.Block{b1, b2, b3} {
+		err := primary.SaveBlock(ctx, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	for _, b := range []*legacy.Block{b1, &forked} {
+		err := standby.SaveBlock(ctx, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	bad := state.Empty()
+	err := bad.Tree.Insert([]byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = standby.SaveSnapshot(ctx, 1, bad)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	r, err := VerifyStandby(ctx, primaryDB, standbyDB)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if r.Height != 3 || r.StandbyHeight != 3 {
+		t.Errorf("heights = %d, %d, want 3, 3", r.Height, r.StandbyHeight)
+	}
+	var got []uint64
+	for _, d := range r.Divergences {
+		got = append(got, d.Height)
+	}
+	want := []uint64{1, 2, 3}
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("divergent heights = %v, want %v (%+v)", got, want, r.Divergences)
+	}
+}
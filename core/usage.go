@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chain/core/usage"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc/legacy"
+)
+
+const (
+	flushUsagePeriod   = 10 * time.Second
+	monitorUsagePeriod = time.Minute
+
+	// defUsageDays is the number of days /get-usage reports
+	// by default.
+	defUsageDays = 30
+)
+
+// cleanUsageQuota validates and canonicalizes a usage_quota
+// tuple of (metric, soft limit, hard limit).
+func cleanUsageQuota(tup []string) error {
+	switch tup[0] {
+	case usage.Requests, usage.Issuances, usage.Storage:
+	default:
+		return errors.WithDetailf(errBadConfigValue, "Usage quota metric must be %s, %s or %s.", usage.Requests, usage.Issuances, usage.Storage)
+	}
+	soft, err := strconv.ParseInt(tup[1], 10, 64)
+	if err != nil || soft < 0 {
+		return errors.WithDetailf(errBadConfigValue, "Usage quota soft limit must be a non-negative integer.")
+	}
+	hard, err := strconv.ParseInt(tup[2], 10, 64)
+	if err != nil || hard < 0 {
+		return errors.WithDetailf(errBadConfigValue, "Usage quota hard limit must be a non-negative integer.")
+	}
+	if soft > 0 && hard > 0 && soft > hard {
+		return errors.WithDetailf(errBadConfigValue, "Usage quota soft limit must not exceed its hard limit.")
+	}
+	tup[1] = strconv.FormatInt(soft, 10)
+	tup[2] = strconv.FormatInt(hard, 10)
+	return nil
+}
+
+// quotasOption converts a closure returned by
+// config.Options.ListFunc for usage_quota into one returning
+// usage quotas.
+func quotasOption(list func() [][]string) func() []usage.Quota {
+	return func() []usage.Quota {
+		var quotas []usage.Quota
+		for _, tup := range list() {
+			// validated when set
+			soft, _ := strconv.ParseInt(tup[1], 10, 64)
+			hard, _ := strconv.ParseInt(tup[2], 10, 64)
+			quotas = append(quotas, usage.Quota{Metric: tup[0], Soft: soft, Hard: hard})
+		}
+		return quotas
+	}
+}
+
+// meterRequests counts requests to h toward the core's
+// usage, rejecting them once the requests quota is reached.
+func (a *API) meterRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		err := a.usage.Check(usage.Requests)
+		if err != nil {
+			errorFormatter.Write(req.Context(), w, err)
+			return
+		}
+		a.usage.Add(usage.Requests, 1)
+		h.ServeHTTP(w, req)
+	})
+}
+
+// checkTxQuotas returns an error if submitting tx would
+// exceed a hard quota. Once the storage quota is reached,
+// no transactions may be submitted.
+func (a *API) checkTxQuotas(tx *legacy.Tx) error {
+	if a.usage == nil {
+		return nil
+	}
+	err := a.usage.Check(usage.Storage)
+	if err != nil {
+		return err
+	}
+	if countIssuances(tx) > 0 {
+		return a.usage.Check(usage.Issuances)
+	}
+	return nil
+}
+
+// countIssuances returns the number of issuance inputs in tx.
+func countIssuances(tx *legacy.Tx) int64 {
+	var n int64
+	for _, in := range tx.Inputs {
+		if in.IsIssuance() {
+			n++
+		}
+	}
+	return n
+}
+
+// usageResponse is the response to /get-usage.
+type usageResponse struct {
+	Items  []*usage.Day  `json:"items"`
+	Quotas []usage.Quota `json:"quotas"`
+}
+
+// POST /get-usage
+//
+// Returns the core's daily usage from start_date to
+// end_date (YYYY-MM-DD, UTC), inclusive, along with the
+// configured quotas. By default it returns the last 30 days.
+func (a *API) getUsage(ctx context.Context, x struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}) (*usageResponse, error) {
+	end := time.Now().UTC()
+	if x.EndDate != "" {
+		t, err := time.Parse("2006-01-02", x.EndDate)
+		if err != nil {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "end_date must be a date of the form YYYY-MM-DD")
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, 1-defUsageDays)
+	if x.StartDate != "" {
+		t, err := time.Parse("2006-01-02", x.StartDate)
+		if err != nil {
+			return nil, errors.WithDetail(httpjson.ErrBadRequest, "start_date must be a date of the form YYYY-MM-DD")
+		}
+		start = t
+	}
+	if start.After(end) {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "start_date must not be after end_date")
+	}
+
+	days, err := a.usage.Daily(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	resp := &usageResponse{
+		Items:  days,
+		Quotas: a.usage.Quotas(),
+	}
+	if resp.Items == nil {
+		resp.Items = []*usage.Day{} // send [], not null
+	}
+	if resp.Quotas == nil {
+		resp.Quotas = []usage.Quota{} // send [], not null
+	}
+	return resp, nil
+}
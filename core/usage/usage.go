@@ -0,0 +1,253 @@
+// Package usage meters the core's use for billing, and
+// enforces quotas on it.
+//
+// Each cored process counts API requests and issuances in
+// memory and periodically adds its counts to daily totals in
+// the database. The leader samples the database size once
+// per period, keeping each day's peak. A quota limits one
+// metric's daily total: reaching the soft limit sends a
+// warning to the usage webhook, and reaching the hard limit
+// also rejects further use until the next day (UTC).
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+// Metrics.
+const (
+	Requests  = "requests"
+	Issuances = "issuances"
+	Storage   = "storage_bytes"
+)
+
+// dateFormat is the format of dates in the usage API.
+const dateFormat = "2006-01-02"
+
+// ErrQuotaExceeded is returned when the hard quota on a
+// metric has been reached.
+var ErrQuotaExceeded = errors.New("usage quota exceeded")
+
+// Quota limits the daily total of a metric. A zero limit
+// is no limit.
+type Quota struct {
+	Metric string `json:"metric"`
+	Soft   int64  `json:"soft"`
+	Hard   int64  `json:"hard"`
+}
+
+// Day is the usage for one day.
+type Day struct {
+	Date         string `json:"date"`
+	Requests     int64  `json:"requests"`
+	Issuances    int64  `json:"issuances"`
+	StorageBytes int64  `json:"storage_bytes"`
+}
+
+// Meter counts usage and checks it against quotas.
+type Meter struct {
+	db         pg.DB
+	quotas     func() []Quota
+	webhookURL func() string
+
+	mu      sync.Mutex
+	day     string
+	pending map[string]int64 // counted since the last flush
+	totals  map[string]int64 // today's totals, including pending
+}
+
+// NewMeter returns a new Meter using the given database.
+func NewMeter(db pg.DB) *Meter {
+	return &Meter{
+		db:         db,
+		quotas:     func() []Quota { return nil },
+		webhookURL: func() string { return "" },
+		pending:    make(map[string]int64),
+		totals:     make(map[string]int64),
+	}
+}
+
+// SetQuotas makes the meter call f to find the quotas.
+// It must be called before the meter is used.
+func (m *Meter) SetQuotas(f func() []Quota) {
+	m.quotas = f
+}
+
+// SetWebhookURL makes the meter call f to find the URL
+// quota warnings are POSTed to. If f returns "", warnings
+// are recorded but not delivered.
+// It must be called before the meter is used.
+func (m *Meter) SetWebhookURL(f func() string) {
+	m.webhookURL = f
+}
+
+// Quotas returns the configured quotas.
+func (m *Meter) Quotas() []Quota {
+	return m.quotas()
+}
+
+// Add counts n uses of metric.
+func (m *Meter) Add(metric string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(today())
+	m.pending[metric] += n
+	m.totals[metric] += n
+}
+
+// Check returns ErrQuotaExceeded if today's total of metric
+// has reached its hard quota. Totals counted by other
+// processes are only seen once they've been flushed, so
+// the quota may be overrun by up to one flush period's use.
+func (m *Meter) Check(metric string) error {
+	for _, q := range m.quotas() {
+		if q.Metric != metric || q.Hard <= 0 {
+			continue
+		}
+		if n := m.today(metric); n >= q.Hard {
+			return errors.WithDetailf(ErrQuotaExceeded, "Today's %s quota of %d has been reached.", metric, q.Hard)
+		}
+	}
+	return nil
+}
+
+func (m *Meter) today(metric string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(today())
+	return m.totals[metric]
+}
+
+// rollover starts counting a new day if day isn't the day
+// being counted. Pending counts are kept; they're added to
+// the day they're flushed on.
+// m.mu must be held.
+func (m *Meter) rollover(day string) {
+	if day == m.day {
+		return
+	}
+	m.day = day
+	m.totals = make(map[string]int64)
+	for metric, n := range m.pending {
+		m.totals[metric] = n
+	}
+}
+
+// Run periodically flushes the meter's counts to the
+// database. It blocks until the context is canceled.
+func (m *Meter) Run(ctx context.Context, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			err := m.Flush(ctx)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+// Flush adds the counts since the last flush to today's
+// totals in the database, and reloads today's totals,
+// which include those flushed by other processes.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	day := today()
+	m.rollover(day)
+	pending := m.pending
+	m.pending = make(map[string]int64)
+	m.mu.Unlock()
+
+	const addQ = `
+		INSERT INTO usage_daily (day, metric, value) VALUES ($1, $2, $3)
+		ON CONFLICT (day, metric) DO UPDATE SET value = usage_daily.value + excluded.value
+	`
+	for metric, n := range pending {
+		_, err := m.db.ExecContext(ctx, addQ, day, metric, n)
+		if err != nil {
+			m.restore(pending)
+			return errors.Wrap(err, "flushing usage")
+		}
+		delete(pending, metric)
+	}
+
+	totals := make(map[string]int64)
+	const q = `SELECT metric, value FROM usage_daily WHERE day = $1`
+	err := pg.ForQueryRows(ctx, m.db, q, day, func(metric string, value int64) {
+		totals[metric] = value
+	})
+	if err != nil {
+		return errors.Wrap(err, "loading usage")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.day == day {
+		for metric, n := range m.pending {
+			totals[metric] += n
+		}
+		m.totals = totals
+	}
+	return nil
+}
+
+// restore returns unflushed counts to the meter, to be
+// flushed next time.
+func (m *Meter) restore(pending map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for metric, n := range pending {
+		m.pending[metric] += n
+	}
+}
+
+// SampleStorage records the database's size, keeping the
+// largest size sampled each day.
+func (m *Meter) SampleStorage(ctx context.Context) error {
+	const q = `
+		INSERT INTO usage_daily (day, metric, value)
+		VALUES ($1, $2, pg_database_size(current_database()))
+		ON CONFLICT (day, metric) DO UPDATE SET value = greatest(usage_daily.value, excluded.value)
+	`
+	_, err := m.db.ExecContext(ctx, q, today(), Storage)
+	return errors.Wrap(err, "sampling storage")
+}
+
+// Daily returns the usage for each day from since to until,
+// inclusive, oldest first. Days with no usage are omitted.
+func (m *Meter) Daily(ctx context.Context, since, until time.Time) ([]*Day, error) {
+	const q = `
+		SELECT day,
+			coalesce(sum(value) FILTER (WHERE metric = $3), 0),
+			coalesce(sum(value) FILTER (WHERE metric = $4), 0),
+			coalesce(sum(value) FILTER (WHERE metric = $5), 0)
+		FROM usage_daily
+		WHERE day BETWEEN $1 AND $2
+		GROUP BY day
+		ORDER BY day
+	`
+	var days []*Day
+	err := pg.ForQueryRows(ctx, m.db, q, since.Format(dateFormat), until.Format(dateFormat), Requests, Issuances, Storage,
+		func(day time.Time, requests, issuances, storage int64) {
+			days = append(days, &Day{
+				Date:         day.Format(dateFormat),
+				Requests:     requests,
+				Issuances:    issuances,
+				StorageBytes: storage,
+			})
+		})
+	return days, errors.Wrap(err, "loading daily usage")
+}
+
+func today() string {
+	return time.Now().UTC().Format(dateFormat)
+}
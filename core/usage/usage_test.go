@@ -0,0 +1,80 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/testutil"
+)
+
+func TestCheck(t *testing.T) {
+	m := NewMeter(nil)
+	m.SetQuotas(func() []Quota {
+		return []Quota{{Metric: Requests, Soft: 1, Hard: 3}, {Metric: Issuances, Soft: 1}}
+	})
+
+	for i := 0; i < 3; i++ {
+		err := m.Check(Requests)
+		if err != nil {
+			t.Fatalf("Check(requests) after %d requests = %v, want nil", i, err)
+		}
+		m.Add(Requests, 1)
+	}
+	err := m.Check(Requests)
+	if errors.Root(err) != ErrQuotaExceeded {
+		t.Errorf("Check(requests) after 3 requests = %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	// A soft quota alone never rejects.
+	m.Add(Issuances, 10)
+	err = m.Check(Issuances)
+	if err != nil {
+		t.Errorf("Check(issuances) = %v, want nil", err)
+	}
+
+	// A new day starts from zero.
+	m.mu.Lock()
+	m.pending = make(map[string]int64)
+	m.rollover("2000-01-01")
+	m.mu.Unlock()
+	err = m.Check(Requests)
+	if err != nil {
+		t.Errorf("Check(requests) on a new day = %v, want nil", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	a, b := NewMeter(db), NewMeter(db)
+	a.SetQuotas(func() []Quota { return []Quota{{Metric: Requests, Hard: 5}} })
+
+	a.Add(Requests, 3)
+	b.Add(Requests, 2)
+	b.Add(Issuances, 1)
+	for _, m := range []*Meter{b, a} {
+		err := m.Flush(ctx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	// a sees the requests flushed by b.
+	err := a.Check(Requests)
+	if errors.Root(err) != ErrQuotaExceeded {
+		t.Errorf("Check(requests) = %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	now := time.Now().UTC()
+	days, err := a.Daily(ctx, now.AddDate(0, 0, -1), now)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := Day{Date: now.Format(dateFormat), Requests: 5, Issuances: 1}
+	if len(days) != 1 || *days[0] != want {
+		t.Errorf("Daily() = %+v, want [%+v]", days, want)
+	}
+}
@@ -0,0 +1,167 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+)
+
+const (
+	maxDeliveryAttempts = 20
+	maxRetryDelay       = time.Hour
+)
+
+// Warning levels.
+const (
+	LevelSoft = "soft"
+	LevelHard = "hard"
+)
+
+// Warning is the body POSTed to the usage webhook when a
+// day's total of a metric reaches one of its quotas. It's
+// sent at most once per day, metric and level.
+type Warning struct {
+	Date   string `json:"date"`
+	Metric string `json:"metric"`
+	Level  string `json:"level"`
+	Value  int64  `json:"value"`
+	Quota  int64  `json:"quota"`
+}
+
+// Monitor periodically samples the database's size, records
+// warnings for quotas reached, and POSTs undelivered warnings
+// to the usage webhook using client. A delivery succeeds if
+// the webhook responds with a 2xx status. Failed deliveries
+// are retried with exponential backoff, up to
+// maxDeliveryAttempts times.
+// It blocks until the context is canceled.
+func (m *Meter) Monitor(ctx context.Context, client *http.Client, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, Monitor exiting")
+			return
+		case <-ticks:
+			err := m.SampleStorage(ctx)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+			err = m.recordWarnings(ctx)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+			err = m.deliverWarnings(ctx, client)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+// recordWarnings records a warning for each quota that
+// today's flushed totals have reached.
+func (m *Meter) recordWarnings(ctx context.Context) error {
+	const q = `
+		INSERT INTO usage_warnings (day, metric, level, value, quota)
+		SELECT day, metric, $3, value, $4 FROM usage_daily
+		WHERE day = $1 AND metric = $2 AND value >= $4
+		ON CONFLICT (day, metric, level) DO NOTHING
+	`
+	day := today()
+	for _, quota := range m.quotas() {
+		for _, l := range []struct {
+			level string
+			limit int64
+		}{{LevelSoft, quota.Soft}, {LevelHard, quota.Hard}} {
+			if l.limit <= 0 {
+				continue
+			}
+			_, err := m.db.ExecContext(ctx, q, day, quota.Metric, l.level, l.limit)
+			if err != nil {
+				return errors.Wrap(err, "recording usage warning")
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Meter) deliverWarnings(ctx context.Context, client *http.Client) error {
+	url := m.webhookURL()
+	if url == "" {
+		return nil
+	}
+	const q = `
+		SELECT day, metric, level, value, quota FROM usage_warnings
+		WHERE delivered_at IS NULL AND next_attempt_at <= now() AND attempts < $1
+		ORDER BY day, metric, level
+	`
+	var warnings []*Warning
+	err := pg.ForQueryRows(ctx, m.db, q, maxDeliveryAttempts, func(day time.Time, metric, level string, value, quota int64) {
+		warnings = append(warnings, &Warning{
+			Date:   day.Format(dateFormat),
+			Metric: metric,
+			Level:  level,
+			Value:  value,
+			Quota:  quota,
+		})
+	})
+	if err != nil {
+		return errors.Wrap(err, "loading undelivered usage warnings")
+	}
+
+	for _, w := range warnings {
+		deliveryErr := post(ctx, client, url, w)
+		if deliveryErr != nil {
+			log.Error(ctx, errors.Wrapf(deliveryErr, "delivering %s %s usage warning for %s", w.Level, w.Metric, w.Date))
+		}
+		err = m.recordAttempt(ctx, w, deliveryErr == nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func post(ctx context.Context, client *http.Client, url string, w *Warning) error {
+	body, err := json.Marshal(w)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordAttempt records an attempt to deliver w. If it
+// failed, the next attempt is scheduled after a delay that
+// doubles with each attempt.
+func (m *Meter) recordAttempt(ctx context.Context, w *Warning, delivered bool) error {
+	const q = `
+		UPDATE usage_warnings SET
+			attempts = attempts + 1,
+			delivered_at = CASE WHEN $4 THEN now() END,
+			next_attempt_at = now() + least(interval '1 second' * power(2, attempts), $5 * interval '1 second')
+		WHERE day = $1 AND metric = $2 AND level = $3
+	`
+	_, err := m.db.ExecContext(ctx, q, w.Date, w.Metric, w.Level, delivered, maxRetryDelay.Seconds())
+	return errors.Wrap(err, "recording usage warning delivery attempt")
+}
@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+)
+
+type boundedKey struct{}
+
+// NewBoundedContext returns a context indicating that queries
+// made with it, such as those of an API request, may be
+// cancelled by a statement timeout. A BoundedDB runs them on
+// its bounded pool.
+func NewBoundedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, boundedKey{}, true)
+}
+
+// IsBoundedContext returns true if ctx was returned by
+// NewBoundedContext.
+func IsBoundedContext(ctx context.Context) bool {
+	b, _ := ctx.Value(boundedKey{}).(bool)
+	return b
+}
+
+// TxDB is a DB that can begin transactions, such as an
+// *sql.DB or a *PreparedDB.
+type TxDB interface {
+	DB
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}
+
+// BoundedDB is a DB that runs queries made with a context
+// from NewBoundedContext on Bounded, and all others on
+// Unbounded. Bounded is typically a pool whose connections
+// have a statement timeout (see WithStatementTimeout), so a
+// slow API request can't hold a connection indefinitely,
+// while work that must finish, such as migrations and block
+// processing, runs on Unbounded without one.
+type BoundedDB struct {
+	Unbounded TxDB
+	Bounded   TxDB
+}
+
+var _ TxDB = (*BoundedDB)(nil)
+
+func (b *BoundedDB) db(ctx context.Context) TxDB {
+	if IsBoundedContext(ctx) {
+		return b.Bounded
+	}
+	return b.Unbounded
+}
+
+// QueryContext satisfies the DB interface.
+func (b *BoundedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return b.db(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext satisfies the DB interface.
+func (b *BoundedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return b.db(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext satisfies the DB interface.
+func (b *BoundedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return b.db(ctx).ExecContext(ctx, query, args...)
+}
+
+// BeginTx begins a transaction on the pool chosen by ctx.
+// Queries made in the transaction run on that pool whatever
+// their context.
+func (b *BoundedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return b.db(ctx).BeginTx(ctx, opts)
+}
@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+type recordingDB struct {
+	TxDB
+	execs int
+}
+
+func (r *recordingDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	r.execs++
+	return nil, nil
+}
+
+func TestBoundedDB(t *testing.T) {
+	unbounded, bounded := new(recordingDB), new(recordingDB)
+	db := &BoundedDB{Unbounded: unbounded, Bounded: bounded}
+
+	ctx := context.Background()
+	db.ExecContext(ctx, "SELECT 1")
+	if unbounded.execs != 1 || bounded.execs != 0 {
+		t.Errorf("query without a bounded context ran on (unbounded, bounded) = (%d, %d), want (1, 0)", unbounded.execs, bounded.execs)
+	}
+	db.ExecContext(NewBoundedContext(ctx), "SELECT 1")
+	if unbounded.execs != 1 || bounded.execs != 1 {
+		t.Errorf("query with a bounded context ran on (unbounded, bounded) = (%d, %d), want (1, 1)", unbounded.execs, bounded.execs)
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/lib/pq"
@@ -49,6 +51,26 @@ func init() {
 	sql.Register("hapg", hapgDriver{})
 }
 
+// WithStatementTimeout returns the Postgres connection string
+// dsn with the statement_timeout run-time parameter set to d,
+// rounded down to the millisecond. The server cancels any
+// statement on such a connection that runs longer than d.
+// The dsn may be a URL or a list of key=value pairs.
+func WithStatementTimeout(dsn string, d time.Duration) (string, error) {
+	ms := strconv.FormatInt(int64(d/time.Millisecond), 10)
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return strings.TrimSpace(dsn + " statement_timeout=" + ms), nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("statement_timeout", ms)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
 // IsUniqueViolation returns true if the given error is a Postgres unique
 // constraint violation error.
 func IsUniqueViolation(err error) bool {
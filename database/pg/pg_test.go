@@ -3,6 +3,7 @@ package pg
 import (
 	"net"
 	"testing"
+	"time"
 )
 
 func TestResolveURI(t *testing.T) {
@@ -53,3 +54,24 @@ func TestIsValidJSONB(t *testing.T) {
 		})
 	}
 }
+
+func TestWithStatementTimeout(t *testing.T) {
+	cases := []struct {
+		dsn  string
+		want string
+	}{
+		{"postgres:///core?sslmode=disable", "postgres:///core?sslmode=disable&statement_timeout=1500"},
+		{"postgres://user@host:5432/core", "postgres://user@host:5432/core?statement_timeout=1500"},
+		{"dbname=core sslmode=disable", "dbname=core sslmode=disable statement_timeout=1500"},
+	}
+
+	for _, c := range cases {
+		got, err := WithStatementTimeout(c.dsn, 1500*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("WithStatementTimeout(%q) = %q, want %q", c.dsn, got, c.want)
+		}
+	}
+}
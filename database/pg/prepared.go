@@ -0,0 +1,182 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+
+	"chain/metrics"
+)
+
+type nameKey struct{}
+
+// NewNamedContext returns a context naming the queries made
+// with it. A PreparedDB runs named queries as prepared
+// statements and records their latency under the name.
+// Use it for hot queries whose text repeats, such as the
+// list queries, so Postgres doesn't parse and plan them on
+// every call.
+func NewNamedContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey{}, name)
+}
+
+// QueryName returns the name given to queries made with ctx
+// by NewNamedContext, or "" if there is none.
+func QueryName(ctx context.Context) string {
+	name, _ := ctx.Value(nameKey{}).(string)
+	return name
+}
+
+// Preparer is a DB that can prepare statements and begin
+// transactions, such as an *sql.DB.
+type Preparer interface {
+	DB
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}
+
+// PreparedDB is a DB that runs named queries (see
+// NewNamedContext) as prepared statements, and passes others
+// through unchanged. It keeps the statements of the most
+// recently used maxStmts distinct queries.
+type PreparedDB struct {
+	db Preparer
+
+	mu    sync.Mutex
+	stmts *lru.Cache // query -> *stmtEntry
+}
+
+// stmtEntry is a cached statement. A statement evicted from
+// the cache is closed once the last query using it returns.
+type stmtEntry struct {
+	stmt    *sql.Stmt
+	users   int
+	evicted bool
+}
+
+const maxStmts = 500
+
+var _ DB = (*PreparedDB)(nil)
+
+// NewPreparedDB returns a PreparedDB running queries on db.
+func NewPreparedDB(db Preparer) *PreparedDB {
+	p := &PreparedDB{db: db, stmts: lru.New(maxStmts)}
+	p.stmts.OnEvicted = func(_ lru.Key, v interface{}) {
+		e := v.(*stmtEntry)
+		e.evicted = true
+		if e.users == 0 {
+			e.stmt.Close()
+		}
+	}
+	return p
+}
+
+// QueryContext satisfies the DB interface.
+func (p *PreparedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	e := p.acquire(ctx, query)
+	if e == nil {
+		return p.db.QueryContext(ctx, query, args...)
+	}
+	defer p.release(e)
+	defer recordQueryLatency(QueryName(ctx), time.Now())
+	return e.stmt.QueryContext(ctx, args...)
+}
+
+// QueryRowContext satisfies the DB interface.
+func (p *PreparedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	e := p.acquire(ctx, query)
+	if e == nil {
+		return p.db.QueryRowContext(ctx, query, args...)
+	}
+	defer p.release(e)
+	defer recordQueryLatency(QueryName(ctx), time.Now())
+	return e.stmt.QueryRowContext(ctx, args...)
+}
+
+// ExecContext satisfies the DB interface.
+func (p *PreparedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e := p.acquire(ctx, query)
+	if e == nil {
+		return p.db.ExecContext(ctx, query, args...)
+	}
+	defer p.release(e)
+	defer recordQueryLatency(QueryName(ctx), time.Now())
+	return e.stmt.ExecContext(ctx, args...)
+}
+
+// BeginTx begins a transaction on the underlying DB. Queries
+// in the transaction aren't prepared.
+func (p *PreparedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.db.BeginTx(ctx, opts)
+}
+
+// acquire returns the prepared statement for query, preparing
+// it if necessary. It returns nil if the query isn't named or
+// can't be prepared; the caller then runs it unprepared, which
+// reports any error in the query itself.
+func (p *PreparedDB) acquire(ctx context.Context, query string) *stmtEntry {
+	if QueryName(ctx) == "" {
+		return nil
+	}
+	p.mu.Lock()
+	if v, ok := p.stmts.Get(query); ok {
+		e := v.(*stmtEntry)
+		e.users++
+		p.mu.Unlock()
+		return e
+	}
+	p.mu.Unlock()
+
+	stmt, err := p.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v, ok := p.stmts.Get(query); ok {
+		// Prepared concurrently by another caller.
+		stmt.Close()
+		e := v.(*stmtEntry)
+		e.users++
+		return e
+	}
+	e := &stmtEntry{stmt: stmt, users: 1}
+	p.stmts.Add(query, e)
+	return e
+}
+
+func (p *PreparedDB) release(e *stmtEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.users--
+	if e.evicted && e.users == 0 {
+		// Any rows still open hold their own reference to the
+		// statement, so it stays usable until they're closed.
+		e.stmt.Close()
+	}
+}
+
+var (
+	latencyMu sync.Mutex
+	latencies = map[string]*metrics.RotatingLatency{}
+)
+
+// recordQueryLatency records the time since t0 in the latency
+// histogram of the named query, published as "db.<name>".
+// For queries returning rows, this is the time until the first
+// results are available.
+func recordQueryLatency(name string, t0 time.Time) {
+	latencyMu.Lock()
+	l := latencies[name]
+	if l == nil {
+		l = metrics.NewRotatingLatency(5, 100*time.Millisecond)
+		latencies[name] = l
+		metrics.PublishLatency("db."+name, l)
+	}
+	latencyMu.Unlock()
+	l.RecordSince(t0)
+}
@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPreparedDB(t *testing.T) {
+	ctx := context.Background()
+	named := NewNamedContext(ctx, "test")
+	if got := QueryName(named); got != "test" {
+		t.Errorf("QueryName(named) = %q, want test", got)
+	}
+
+	drv := new(countingDriver)
+	sql.Register("pg-prepared-test", drv)
+	db, err := sql.Open("pg-prepared-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	p := NewPreparedDB(db)
+
+	cases := []struct {
+		ctx   context.Context
+		query string
+		want  int32 // prepares after running the query 3 times
+	}{
+		{named, "SELECT 1", 1},
+		{ctx, "SELECT 2", 3},
+	}
+	for _, c := range cases {
+		atomic.StoreInt32(&drv.prepares, 0)
+		for i := 0; i < 3; i++ {
+			rows, err := p.QueryContext(c.ctx, c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows.Close()
+		}
+		if got := atomic.LoadInt32(&drv.prepares); got != c.want {
+			t.Errorf("%q: prepared %d times, want %d", c.query, got, c.want)
+		}
+	}
+
+	// Evicting a statement closes it once it's unused.
+	e := p.acquire(named, "SELECT 1")
+	p.mu.Lock()
+	p.stmts.Remove("SELECT 1")
+	p.mu.Unlock()
+	if _, err := e.stmt.QueryContext(ctx); err != nil {
+		t.Errorf("query on evicted statement in use: %v", err)
+	}
+	p.release(e)
+	if _, err := e.stmt.QueryContext(ctx); err == nil {
+		t.Error("query on evicted, released statement succeeded, want error")
+	}
+}
+
+// countingDriver is a database driver that counts the
+// statements prepared on it and returns no rows.
+type countingDriver struct {
+	prepares int32
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return &countingConn{d}, nil }
+
+type countingConn struct{ d *countingDriver }
+
+func (c *countingConn) Prepare(string) (driver.Stmt, error) {
+	atomic.AddInt32(&c.d.prepares, 1)
+	return countingStmt{}, nil
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type countingStmt struct{}
+
+func (countingStmt) Close() error                               { return nil }
+func (countingStmt) NumInput() int                              { return -1 }
+func (countingStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (countingStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
@@ -0,0 +1,21 @@
+package pg
+
+import "context"
+
+type primaryKey struct{}
+
+// NewPrimaryContext returns a context indicating that reads
+// made with it must go to the primary database, even where a
+// read replica is configured. Use it when a client needs to
+// see its own recent writes, which a lagging replica might
+// not have yet.
+func NewPrimaryContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimaryContext returns true if ctx was returned by
+// NewPrimaryContext.
+func IsPrimaryContext(ctx context.Context) bool {
+	b, _ := ctx.Value(primaryKey{}).(bool)
+	return b
+}
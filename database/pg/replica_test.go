@@ -0,0 +1,16 @@
+package pg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrimaryContext(t *testing.T) {
+	ctx := context.Background()
+	if IsPrimaryContext(ctx) {
+		t.Error("IsPrimaryContext(background) = true, want false")
+	}
+	if !IsPrimaryContext(NewPrimaryContext(ctx)) {
+		t.Error("IsPrimaryContext(NewPrimaryContext(background)) = false, want true")
+	}
+}
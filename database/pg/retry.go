@@ -0,0 +1,68 @@
+package pg
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/errors"
+)
+
+// ErrConflict is returned by Retry when a transient conflict,
+// such as a serialization failure or a deadlock, persisted
+// through every attempt.
+var ErrConflict = errors.New("pg: conflict persisted after retries")
+
+const (
+	maxAttempts    = 5
+	minRetryJitter = 10 * time.Millisecond
+)
+
+// IsRetryable returns true if err is a Postgres error that
+// indicates a transient conflict with a concurrent transaction.
+// Repeating the work that failed may succeed.
+func IsRetryable(err error) bool {
+	pqErr, ok := errors.Root(err).(*pq.Error)
+	if !ok {
+		return false
+	}
+	switch pqErr.Code.Name() {
+	case "serialization_failure", "deadlock_detected":
+		return true
+	}
+	return false
+}
+
+// Retry calls f until it returns an error that is not retryable
+// (see IsRetryable), including nil. Between attempts it sleeps for
+// a random, exponentially growing interval so that conflicting
+// callers spread out.
+//
+// Retry gives up early rather than sleep past the deadline of ctx.
+// If f still fails with a retryable error after all attempts,
+// Retry returns ErrConflict wrapping that error.
+func Retry(ctx context.Context, f func(context.Context) error) error {
+	var err error
+	for n := uint(0); ; n++ {
+		err = f(ctx)
+		if !IsRetryable(err) {
+			return err
+		}
+		if n+1 >= maxAttempts {
+			break
+		}
+
+		d := minRetryJitter + time.Duration(rand.Int63n(int64(minRetryJitter<<n)))
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	return errors.Sub(ErrConflict, err)
+}
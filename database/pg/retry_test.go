@@ -0,0 +1,44 @@
+package pg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"chain/errors"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	serialization := &pq.Error{Code: "40001"}
+	deadlock := &pq.Error{Code: "40P01"}
+	other := &pq.Error{Code: "23505"} // unique_violation
+
+	cases := []struct {
+		errs     []error // returned by successive attempts
+		want     error
+		attempts int
+	}{
+		{[]error{nil}, nil, 1},
+		{[]error{other}, other, 1},
+		{[]error{serialization, nil}, nil, 2},
+		{[]error{deadlock, errors.Wrap(serialization), nil}, nil, 3},
+		{[]error{serialization, serialization, serialization, serialization, serialization, nil}, ErrConflict, maxAttempts},
+	}
+
+	for i, c := range cases {
+		var attempts int
+		err := Retry(ctx, func(context.Context) error {
+			err := c.errs[attempts]
+			attempts++
+			return err
+		})
+		if errors.Root(err) != c.want {
+			t.Errorf("case %d: got error %v want %v", i, err, c.want)
+		}
+		if attempts != c.attempts {
+			t.Errorf("case %d: got %d attempts want %d", i, attempts, c.attempts)
+		}
+	}
+}
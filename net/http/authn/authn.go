@@ -27,22 +27,33 @@ type API struct {
 	tokens             *accesstoken.CredentialStore
 	crosscoreRPCPrefix string
 	rootCAs            *x509.CertPool
+	clientCAs          *x509.CertPool
 
 	tokenMu  sync.Mutex // protects the following
 	tokenMap map[string]tokenResult
 }
 
 type tokenResult struct {
-	valid      bool
-	lastLookup time.Time
+	valid          bool
+	serviceAccount string
+	lastLookup     time.Time
 }
 
-func NewAPI(tokens *accesstoken.CredentialStore, crosscorePrefix string, rootCAs *x509.CertPool) *API {
+// NewAPI returns an authenticator that accepts client
+// certificates issued by rootCAs, the CAs of the core's own
+// cluster, or by clientCAs, which also holds CAs trusted only
+// to issue client certificates to partners. If clientCAs is
+// nil, only rootCAs are trusted.
+func NewAPI(tokens *accesstoken.CredentialStore, crosscorePrefix string, rootCAs, clientCAs *x509.CertPool) *API {
+	if clientCAs == nil {
+		clientCAs = rootCAs
+	}
 	return &API{
 		tokens:             tokens,
 		crosscoreRPCPrefix: crosscorePrefix,
 		tokenMap:           make(map[string]tokenResult),
 		rootCAs:            rootCAs,
+		clientCAs:          clientCAs,
 	}
 }
 
@@ -51,17 +62,25 @@ func NewAPI(tokens *accesstoken.CredentialStore, crosscorePrefix string, rootCAs
 func (a *API) Authenticate(req *http.Request) (*http.Request, error) {
 	var authnErrors []string
 
-	ctx, err := certAuthn(req, a.rootCAs)
+	ctx, err := certAuthn(req, a.rootCAs, a.clientCAs)
 	if err != nil {
 		authnErrors = append(authnErrors, err.Error())
 	}
 
-	token, err := a.tokenAuthn(req)
+	token, serviceAccount, err := a.tokenAuthn(req)
+	if err == nil && serviceAccount != "" && req.Header.Get("Origin") != "" {
+		// Service accounts have no interactive login, so their
+		// tokens can't be used from web pages like the dashboard.
+		err = fmt.Errorf("token %q belongs to a service account and can't be used from a browser", token)
+	}
 	if err != nil {
 		authnErrors = append(authnErrors, err.Error())
 	} else if token != "" {
 		// if this request was successfully authenticated with a token, pass the token along
 		ctx = newContextWithToken(ctx, token)
+		if serviceAccount != "" {
+			ctx = newContextWithServiceAccount(ctx, serviceAccount)
+		}
 	}
 
 	local := a.localhostAuthn(req)
@@ -100,14 +119,16 @@ func (a *API) Authenticate(req *http.Request) (*http.Request, error) {
 // returned context, but the returned error is non-nil.
 // The caller should allow the connection to proceed
 // even if the error is non-nil.
-func certAuthn(req *http.Request, rootCAs *x509.CertPool) (context.Context, error) {
+// A cert that chains to clientCAs but not to rootCAs
+// is also marked as a partner's in the context.
+func certAuthn(req *http.Request, rootCAs, clientCAs *x509.CertPool) (context.Context, error) {
 	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
 		certs := req.TLS.PeerCertificates
 
 		// Same logic as serverHandshakeState.processCertsFromClient
 		// in $GOROOT/src/crypto/tls/handshake_server.go.
 		opts := x509.VerifyOptions{
-			Roots:         rootCAs,
+			Roots:         clientCAs,
 			CurrentTime:   time.Now(),
 			Intermediates: x509.NewCertPool(),
 			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
@@ -115,7 +136,7 @@ func certAuthn(req *http.Request, rootCAs *x509.CertPool) (context.Context, erro
 		for _, cert := range certs[1:] {
 			opts.Intermediates.AddCert(cert)
 		}
-		_, err := certs[0].Verify(opts)
+		chains, err := certs[0].Verify(opts)
 		if err != nil {
 			// crypto/tls treats this as an error:
 			// errors.New("tls: failed to verify client's certificate: " + err.Error())
@@ -124,7 +145,14 @@ func certAuthn(req *http.Request, rootCAs *x509.CertPool) (context.Context, erro
 			return req.Context(), err
 		}
 
-		return context.WithValue(req.Context(), x509CertsKey, certs), nil
+		ctx := context.WithValue(req.Context(), x509CertsKey, certs)
+		ctx = context.WithValue(ctx, x509ChainsKey, chains)
+		opts.Roots = rootCAs
+		_, err = certs[0].Verify(opts)
+		if err != nil {
+			ctx = context.WithValue(ctx, partnerCertKey, true)
+		}
+		return ctx, nil
 	}
 	return req.Context(), nil
 }
@@ -141,38 +169,42 @@ func (a *API) localhostAuthn(req *http.Request) bool {
 	return true
 }
 
-func (a *API) tokenAuthn(req *http.Request) (string, error) {
+// tokenAuthn returns the access token ID the request
+// authenticates with, if any, and the service account the
+// token belongs to, if any.
+func (a *API) tokenAuthn(req *http.Request) (string, string, error) {
 	user, pw, ok := req.BasicAuth()
 	if !ok {
-		return "", nil
+		return "", "", nil
 	}
-	return user, a.cachedTokenAuthnCheck(req.Context(), user, pw)
+	serviceAccount, err := a.cachedTokenAuthnCheck(req.Context(), user, pw)
+	return user, serviceAccount, err
 }
 
-func (a *API) tokenAuthnCheck(ctx context.Context, user, pw string) (bool, error) {
+func (a *API) tokenAuthnCheck(ctx context.Context, user, pw string) (bool, string, error) {
 	pwBytes, err := hex.DecodeString(pw)
 	if err != nil {
-		return false, nil
+		return false, "", nil
 	}
-	return a.tokens.Check(ctx, user, pwBytes)
+	return a.tokens.Identify(ctx, user, pwBytes)
 }
 
-func (a *API) cachedTokenAuthnCheck(ctx context.Context, user, pw string) error {
+func (a *API) cachedTokenAuthnCheck(ctx context.Context, user, pw string) (string, error) {
 	a.tokenMu.Lock()
 	res, ok := a.tokenMap[user+pw]
 	a.tokenMu.Unlock()
 	if !ok || time.Now().After(res.lastLookup.Add(tokenExpiry)) {
-		valid, err := a.tokenAuthnCheck(ctx, user, pw)
+		valid, serviceAccount, err := a.tokenAuthnCheck(ctx, user, pw)
 		if err != nil {
-			return errors.Wrap(err)
+			return "", errors.Wrap(err)
 		}
-		res = tokenResult{valid: valid, lastLookup: time.Now()}
+		res = tokenResult{valid: valid, serviceAccount: serviceAccount, lastLookup: time.Now()}
 		a.tokenMu.Lock()
 		a.tokenMap[user+pw] = res
 		a.tokenMu.Unlock()
 	}
 	if !res.valid {
-		return fmt.Errorf("invalid token: %q", user)
+		return "", fmt.Errorf("invalid token: %q", user)
 	}
-	return nil
+	return res.serviceAccount, nil
 }
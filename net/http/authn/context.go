@@ -11,6 +11,9 @@ const (
 	tokenKey key = iota
 	localhostKey
 	x509CertsKey
+	serviceAccountKey
+	partnerCertKey
+	x509ChainsKey
 )
 
 // X509Certs returns the cert stored in the context, if it exists.
@@ -19,6 +22,21 @@ func X509Certs(ctx context.Context) []*x509.Certificate {
 	return c
 }
 
+// PartnerCert returns true if the cert stored in the context
+// was issued by a CA trusted only for partners' client
+// certificates, and not by one of the cluster's own CAs.
+func PartnerCert(ctx context.Context) bool {
+	p, _ := ctx.Value(partnerCertKey).(bool)
+	return p
+}
+
+// X509Chains returns the chains the cert stored in the
+// context was verified with, each ending in a trusted CA.
+func X509Chains(ctx context.Context) [][]*x509.Certificate {
+	c, _ := ctx.Value(x509ChainsKey).([][]*x509.Certificate)
+	return c
+}
+
 // newContextWithToken sets the token in a new context and returns the context.
 func newContextWithToken(ctx context.Context, token string) context.Context {
 	return context.WithValue(ctx, tokenKey, token)
@@ -47,3 +65,19 @@ func Localhost(ctx context.Context) bool {
 	}
 	return false
 }
+
+// newContextWithServiceAccount sets the service account
+// the request's token belongs to in a new context and
+// returns the context.
+func newContextWithServiceAccount(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, serviceAccountKey, id)
+}
+
+// ServiceAccount returns the ID of the service account
+// whose token authenticated the request, or "" if the
+// request wasn't authenticated with a service account's
+// token.
+func ServiceAccount(ctx context.Context) string {
+	id, _ := ctx.Value(serviceAccountKey).(string)
+	return id
+}
@@ -2,6 +2,7 @@ package authz
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"net/http"
 	"path"
@@ -20,6 +21,10 @@ type Loader interface {
 type Authorizer struct {
 	loader   Loader
 	policies map[string][]string // by route
+
+	// memberPolicies are the policies partner certificates
+	// never satisfy.
+	memberPolicies map[string]bool
 }
 
 func NewAuthorizer(l Loader, policyMap map[string][]string) *Authorizer {
@@ -29,6 +34,17 @@ func NewAuthorizer(l Loader, policyMap map[string][]string) *Authorizer {
 	}
 }
 
+// SetMemberPolicies names the policies held only by the
+// cluster's own members and by other cores. Certificates
+// issued by a partner's CA never satisfy an x509 grant of one
+// of these policies, whatever its subject.
+func (a *Authorizer) SetMemberPolicies(policies ...string) {
+	a.memberPolicies = make(map[string]bool)
+	for _, p := range policies {
+		a.memberPolicies[p] = true
+	}
+}
+
 func (a *Authorizer) Authorize(req *http.Request) error {
 	policies, err := a.policiesByRoute(req.RequestURI)
 	if err != nil {
@@ -40,14 +56,14 @@ func (a *Authorizer) Authorize(req *http.Request) error {
 		return errors.Wrap(err)
 	}
 
-	if !authorized(req.Context(), grants) {
+	if !a.authorized(req.Context(), grants) {
 		return ErrNotAuthorized
 	}
 
 	return nil
 }
 
-func authorized(ctx context.Context, grants []*Grant) bool {
+func (a *Authorizer) authorized(ctx context.Context, grants []*Grant) bool {
 	for _, g := range grants {
 		switch g.GuardType {
 		case "access_token":
@@ -55,9 +71,8 @@ func authorized(ctx context.Context, grants []*Grant) bool {
 				return true
 			}
 		case "x509":
-			pattern := x509GuardData(g.GuardData)
 			certs := authn.X509Certs(ctx)
-			if len(certs) > 0 && matchesX509(pattern, certs[0].Subject) {
+			if len(certs) > 0 && a.matchesCert(g, certs[0], authn.X509Chains(ctx), authn.PartnerCert(ctx)) {
 				return true
 			}
 		case "localhost":
@@ -71,6 +86,38 @@ func authorized(ctx context.Context, grants []*Grant) bool {
 	return false
 }
 
+// matchesCert reports whether cert, verified with chains,
+// satisfies the x509 grant g. A grant bound to a CA matches
+// only certificates with that CA in one of their verified
+// chains; the CA is identified by its key, not its name,
+// which any other CA could also issue an intermediate with.
+// Partner certificates, which chain only to a CA trusted for
+// client certificates, match only grants bound to a CA, and
+// never grants of member policies.
+func (a *Authorizer) matchesCert(g *Grant, cert *x509.Certificate, chains [][]*x509.Certificate, partner bool) bool {
+	subject, ca := x509GuardData(g.GuardData)
+	if partner && (ca == "" || a.memberPolicies[g.Policy]) {
+		return false
+	}
+	if ca != "" && !chainsInclude(chains, ca) {
+		return false
+	}
+	return matchesX509(subject, cert.Subject)
+}
+
+// chainsInclude reports whether a CA certificate in chains
+// has the fingerprint ca.
+func chainsInclude(chains [][]*x509.Certificate, ca string) bool {
+	for _, chain := range chains {
+		for _, c := range chain[1:] {
+			if CAFingerprint(c) == ca {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func accessTokenGuardData(grant *Grant) string {
 	var v struct{ ID string }
 	json.Unmarshal(grant.GuardData, &v) // ignore error, returns "" on failure
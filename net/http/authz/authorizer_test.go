@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestMatchesCert(t *testing.T) {
+	a := NewAuthorizer(nil, nil)
+	a.SetMemberPolicies("internal")
+
+	ca := func(name, key string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:                 pkix.Name{CommonName: name},
+			RawSubjectPublicKeyInfo: []byte(key),
+		}
+	}
+	var (
+		memberCA  = ca("member-ca", "member-key")
+		partnerCA = ca("partner-ca", "partner-key")
+		otherCA   = ca("other-ca", "other-key")
+
+		// An intermediate issued by another partner's CA
+		// with the same name as partnerCA.
+		impostorCA = ca("partner-ca", "impostor-key")
+	)
+	grant := func(policy, subject string, ca *x509.Certificate) *Grant {
+		data := `{"subject":{"CN":"` + subject + `"}`
+		if ca != nil {
+			data += `,"ca_fingerprint":"` + CAFingerprint(ca) + `"`
+		}
+		return &Grant{Policy: policy, GuardType: "x509", GuardData: []byte(data + `}`)}
+	}
+	var (
+		internal      = grant("internal", "core", nil)
+		readonly      = grant("client-readonly", "alice", nil)
+		partner       = grant("client-readwrite", "bob", partnerCA)
+		partnerMember = grant("internal", "carol", partnerCA)
+		named         = &Grant{Policy: "client-readwrite", GuardType: "x509", GuardData: []byte(`{"subject":{"CN":"bob"},"issuer":{"CN":"partner-ca"}}`)}
+	)
+	cases := []struct {
+		g       *Grant
+		subject string
+		chain   []*x509.Certificate // CAs, from the issuer up
+		partner bool
+		want    bool
+	}{
+		{internal, "core", []*x509.Certificate{memberCA}, false, true},
+		{internal, "core", []*x509.Certificate{partnerCA}, true, false},
+		{readonly, "alice", []*x509.Certificate{memberCA}, false, true},
+		{readonly, "alice", []*x509.Certificate{partnerCA}, true, false},
+		{partner, "bob", []*x509.Certificate{partnerCA}, true, true},
+		{partner, "bob", []*x509.Certificate{ca("partner-issuing-ca", "issuing-key"), partnerCA}, true, true},
+		{partner, "bob", []*x509.Certificate{otherCA}, true, false},
+		{partner, "bob", []*x509.Certificate{impostorCA, otherCA}, true, false},
+		{partner, "bob", []*x509.Certificate{memberCA}, false, false},
+		{partner, "mallory", []*x509.Certificate{partnerCA}, true, false},
+		{partnerMember, "carol", []*x509.Certificate{partnerCA}, true, false},
+		{named, "bob", []*x509.Certificate{partnerCA}, true, false},
+		{named, "bob", []*x509.Certificate{memberCA}, false, false},
+	}
+	for i, c := range cases {
+		cert := &x509.Certificate{
+			Subject: pkix.Name{CommonName: c.subject},
+			Issuer:  c.chain[0].Subject,
+		}
+		chains := [][]*x509.Certificate{append([]*x509.Certificate{cert}, c.chain...)}
+		got := a.matchesCert(c.g, cert, chains, c.partner)
+		if got != c.want {
+			t.Errorf("case %d: matchesCert(%s issued by %s, partner %v) = %v, want %v",
+				i, c.subject, c.chain[0].Subject.CommonName, c.partner, got, c.want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package authz
 
 import (
+	"crypto/sha256"
+	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
 	"strings"
 )
@@ -41,8 +44,29 @@ func ValidX509SubjectField(s string) bool {
 	return x509FieldNames[strings.ToUpper(s)]
 }
 
-func x509GuardData(data []byte) pkix.Name {
-	var v struct{ Subject PKIXName }
+// CAFingerprint returns the fingerprint x509 grants identify
+// a CA by: the hex-encoded SHA-256 hash of cert's
+// SubjectPublicKeyInfo.
+func CAFingerprint(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(h[:])
+}
+
+// ValidCAFingerprint reports whether s has the form of a
+// fingerprint returned by CAFingerprint.
+func ValidCAFingerprint(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size && s == strings.ToLower(s)
+}
+
+// x509GuardData returns the subject pattern in data and, if
+// the grant is bound to a CA, the CA's fingerprint.
+func x509GuardData(data []byte) (subject pkix.Name, ca string) {
+	var v struct {
+		Subject PKIXName
+		CA      string          `json:"ca_fingerprint"`
+		Issuer  json.RawMessage `json:"issuer"`
+	}
 	err := json.Unmarshal(data, &v)
 	if err != nil {
 		// We should create only well-formed guard data,
@@ -50,7 +74,13 @@ func x509GuardData(data []byte) pkix.Name {
 		// (And if it does, it's our bug.)
 		panic(err)
 	}
-	return pkix.Name(v.Subject)
+	if v.Issuer != nil && v.CA == "" {
+		// Grants were once bound to an issuer by name, which
+		// doesn't identify a CA. They're bound to a CA no
+		// certificate chains to, so they match nothing.
+		v.CA = "issuer"
+	}
+	return pkix.Name(v.Subject), v.CA
 }
 
 func matchesX509(pat, x pkix.Name) bool {
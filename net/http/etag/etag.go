@@ -0,0 +1,80 @@
+// Package etag implements conditional requests for handlers
+// whose responses depend only on the request and the data
+// they read.
+//
+// Handler computes a weak ETag from each successful response
+// body. If the request's If-None-Match header lists that ETag,
+// it responds 304 Not Modified with no body, so clients that
+// fetch the same data repeatedly don't download it again.
+package etag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Handler wraps Handler, adding ETags to its successful
+// responses and answering matching conditional requests.
+type Handler struct {
+	Handler http.Handler
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &recorder{header: w.Header(), status: http.StatusOK}
+	h.Handler.ServeHTTP(rec, r)
+	if rec.status != http.StatusOK {
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+		return
+	}
+
+	tag := Weak(rec.body.Bytes())
+	w.Header().Set("ETag", tag)
+	if matches(r.Header.Get("If-None-Match"), tag) {
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(rec.body.Bytes())
+}
+
+// Weak returns a weak ETag for body.
+func Weak(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matches reports whether the If-None-Match header value
+// lists tag. Weak comparison is used, as RFC 7232 requires for
+// If-None-Match.
+func matches(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// recorder buffers a response so its ETag can be computed
+// before anything is sent.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header         { return r.header }
+func (r *recorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+func (r *recorder) WriteHeader(status int)      { r.status = status }
@@ -0,0 +1,49 @@
+package etag
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	body := `{"items":[]}`
+	h := Handler{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "nope", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, body)
+	})}
+	tag := Weak([]byte(body))
+
+	cases := []struct {
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+		wantTag     string
+	}{
+		{"/list", "", 200, body, tag},
+		{"/list", tag, 304, "", tag},
+		{"/list", `"other", ` + tag, 304, "", tag},
+		{"/list", tag[2:], 304, "", tag}, // weak comparison
+		{"/list", "*", 304, "", tag},
+		{"/list", `W/"other"`, 200, body, tag},
+		{"/fail", tag, 400, "nope\n", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", c.path, nil)
+		if c.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", c.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.wantStatus || rec.Body.String() != c.wantBody || rec.Header().Get("ETag") != c.wantTag {
+			t.Errorf("%s If-None-Match %q: got %d %q ETag %q, want %d %q ETag %q",
+				c.path, c.ifNoneMatch, rec.Code, rec.Body.String(), rec.Header().Get("ETag"),
+				c.wantStatus, c.wantBody, c.wantTag)
+		}
+	}
+}
@@ -39,5 +39,17 @@ as JSON text to the response body.
 If the return type is omitted, the handler will send
 a default response value.
 
+Clients that can't represent 64-bit integers, such as
+browsers, may set the request header NumbersHeader to
+"string" to receive uint64 values, such as amounts and
+heights, and other large integers as JSON strings. They may
+send such strings back for integer fields of the request.
+Clients that need only some fields of the response may set
+the URL query parameter FieldsParam to a list of field names.
+
+Options passed to Handler can limit the size of request
+bodies and reject request fields the input type doesn't
+have, which would otherwise be silently ignored.
+
 */
 package httpjson
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"reflect"
 )
@@ -24,19 +25,27 @@ type handler struct {
 	inType  reflect.Type
 	hasCtx  bool
 	errFunc ErrorWriter
+
+	maxBodySize int64 // or 0 for no limit
+	strict      bool
 }
 
 // Handler returns an HTTP handler for function f.
 // See the package doc for details on allowed signatures for f.
 // If f returns a non-nil error, the handler will call errFunc.
-func Handler(f interface{}, errFunc ErrorWriter) (http.Handler, error) {
+// Options such as MaxBodySize restrict the request bodies
+// the handler accepts.
+func Handler(f interface{}, errFunc ErrorWriter, opts ...Option) (http.Handler, error) {
 	fv := reflect.ValueOf(f)
 	hasCtx, inType, err := funcInputType(fv)
 	if err != nil {
 		return nil, err
 	}
 
-	h := &handler{fv, inType, hasCtx, errFunc}
+	h := &handler{fv: fv, inType: inType, hasCtx: hasCtx, errFunc: errFunc}
+	for _, opt := range opts {
+		opt(h)
+	}
 	return h, nil
 }
 
@@ -50,7 +59,16 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	if h.inType != nil {
 		inPtr := reflect.New(h.inType)
-		err := Read(req.Context(), req.Body, inPtr.Interface())
+		var body io.Reader = req.Body
+		if h.maxBodySize > 0 {
+			body = &limitedReader{r: body, n: h.maxBodySize, limit: h.maxBodySize}
+		}
+		var err error
+		if h.strict {
+			err = readStrict(req.Context(), body, inPtr.Interface())
+		} else {
+			err = Read(req.Context(), body, inPtr.Interface())
+		}
 		if err != nil {
 			h.errFunc(req.Context(), w, err)
 			return
@@ -81,7 +99,23 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	Write(req.Context(), w, 200, res)
+	fields := parseFields(req.URL.Query().Get(FieldsParam))
+	write(req.Context(), w, 200, res, req.Header.Get(NumbersHeader) == "string", fields)
+}
+
+// Types returns the request and response body types of
+// a handler for function f. Either is nil if f's signature
+// has no such element.
+func Types(f interface{}) (in, out reflect.Type, err error) {
+	fv := reflect.ValueOf(f)
+	_, in, err = funcInputType(fv)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ft := fv.Type(); ft.NumOut() > 0 && !ft.Out(0).Implements(errorType) {
+		out = ft.Out(0)
+	}
+	return in, out, nil
 }
 
 var (
@@ -85,6 +85,45 @@ func TestReadErr(t *testing.T) {
 	}
 }
 
+func TestHandlerOptions(t *testing.T) {
+	type input struct {
+		Alias string
+		Tags  map[string]interface{}
+		Keys  []struct {
+			XPub string `json:"root_xpub"`
+		}
+	}
+	cases := []struct {
+		body    string
+		opts    []Option
+		wantErr error
+	}{
+		{`[{"alias":"a","tags":{"any":1}}]`, []Option{DisallowUnknownFields()}, nil},
+		{`[{"Alias":"a","keys":[{"root_xpub":"x"}]}]`, []Option{DisallowUnknownFields()}, nil},
+		{`[{"alais":"a"}]`, nil, nil},
+		{`[{"alais":"a"}]`, []Option{DisallowUnknownFields()}, ErrBadRequest},
+		{`[{"keys":[{"root_xpubs":"x"}]}]`, []Option{DisallowUnknownFields()}, ErrBadRequest},
+		{`[{"alias":"a"}]`, []Option{MaxBodySize(15)}, nil},
+		{`[{"alias":"ab"}]`, []Option{MaxBodySize(15)}, ErrRequestTooLarge},
+		{`[{"alias":"ab"}]`, []Option{MaxBodySize(15), DisallowUnknownFields()}, ErrRequestTooLarge},
+	}
+	for _, c := range cases {
+		var gotErr error
+		errFunc := func(ctx context.Context, w http.ResponseWriter, err error) {
+			gotErr = errors.Root(err)
+		}
+		h, err := Handler(func(in []input) {}, errFunc, c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(c.body))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if gotErr != c.wantErr {
+			t.Errorf("%s with %d options: err = %v want %v", c.body, len(c.opts), gotErr, c.wantErr)
+		}
+	}
+}
+
 func TestFuncInputTypeError(t *testing.T) {
 	cases := []interface{}{
 		0,
@@ -142,3 +181,26 @@ func TestFuncInputTypeOk(t *testing.T) {
 		}
 	}
 }
+
+func TestTypes(t *testing.T) {
+	intType := reflect.TypeOf(0)
+	cases := []struct {
+		f       interface{}
+		in, out reflect.Type
+	}{
+		{func() {}, nil, nil},
+		{func() error { return nil }, nil, nil},
+		{func(context.Context, int) error { return nil }, intType, nil},
+		{func(int) (int, error) { return 0, nil }, intType, intType},
+		{func(context.Context) int { return 0 }, nil, intType},
+	}
+	for _, c := range cases {
+		in, out, err := Types(c.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in != c.in || out != c.out {
+			t.Errorf("Types(%T) = %v, %v want %v, %v", c.f, in, out, c.in, c.out)
+		}
+	}
+}
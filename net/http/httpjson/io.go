@@ -1,11 +1,14 @@
 package httpjson
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"chain/errors"
 	"chain/log"
@@ -16,12 +19,24 @@ import (
 var ErrBadRequest = errors.New("httpjson: bad request")
 
 // Read decodes a single JSON text from r into v.
-// The only error it returns is ErrBadRequest
-// (wrapped with the original error message as context).
+// Integer fields of v may be given as strings holding an
+// integer, as sent to clients that set NumbersHeader.
+// It returns ErrRequestTooLarge if r does, and otherwise
+// only ErrBadRequest (wrapped with the original error
+// message as context).
 func Read(ctx context.Context, r io.Reader, v interface{}) error {
-	dec := json.NewDecoder(r)
-	dec.UseNumber()
-	err := dec.Decode(v)
+	b, err := ioutil.ReadAll(r)
+	if errors.Root(err) == ErrRequestTooLarge {
+		return err
+	}
+	if err == nil {
+		b, err = UnquoteInts(b, reflect.TypeOf(v))
+	}
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(v)
+	}
 	if err != nil {
 		detail := errors.Detail(err)
 		if detail == "" {
@@ -32,20 +47,126 @@ func Read(ctx context.Context, r io.Reader, v interface{}) error {
 	return err
 }
 
+// NumbersHeader is a request header. A client can set it
+// to "string" to receive uint64 values, such as amounts and
+// heights, as JSON strings instead of numbers, whatever
+// their size, so each field always has the same JSON type.
+// Browsers parse every JSON number as a double, so without
+// this they silently round large amounts and heights.
+// Other integers, including those in JSON the response
+// holds verbatim, are strings only if a float64 can't
+// represent them exactly. Read accepts such strings back
+// for integer fields, so cursors and amounts can be echoed.
+const NumbersHeader = "Chain-Json-Numbers"
+
 // Write sets the Content-Type header field to indicate
 // JSON data, writes the header using status,
 // then writes v to w.
 // It logs any error encountered during the write.
 func Write(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	write(ctx, w, status, v, false, nil)
+}
+
+func write(ctx context.Context, w http.ResponseWriter, status int, v interface{}, stringNumbers bool, fields []string) {
+	v = Array(v)
+	var err error
+	if stringNumbers {
+		// Encode first, while the types of v's fields are
+		// still known.
+		v, err = marshalStringNumbers(v)
+		if err != nil {
+			log.Error(ctx, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(fields) > 0 {
+		v, err = selectFields(v, fields)
+		if err != nil {
+			log.Error(ctx, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
 
-	err := json.NewEncoder(w).Encode(Array(v))
+	err = json.NewEncoder(w).Encode(v)
 	if err != nil {
 		log.Error(ctx, err)
 	}
 }
 
+// FieldsParam is a URL query parameter. A client can set it
+// to a comma-separated list of field names, such as "id,alias",
+// to receive only those fields of each object in the response.
+// In a page of results, it selects fields of each item and
+// leaves the rest of the page intact. Pollers that need only a
+// few fields of large objects save bandwidth this way.
+const FieldsParam = "fields"
+
+// parseFields returns the field names in a FieldsParam value.
+func parseFields(s string) []string {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// selectFields returns the JSON encoding of v with only the
+// given fields of its objects. If v is an object with an
+// "items" array, the fields of each item are selected instead.
+func selectFields(v interface{}, fields []string) (json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	err = dec.Decode(&generic)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	keep := make(map[string]bool)
+	for _, f := range fields {
+		keep[f] = true
+	}
+	if page, ok := generic.(map[string]interface{}); ok {
+		if items, ok := page["items"].([]interface{}); ok {
+			page["items"] = pick(items, keep)
+			b, err = json.Marshal(page)
+			return b, errors.Wrap(err)
+		}
+	}
+	b, err = json.Marshal(pick(generic, keep))
+	return b, errors.Wrap(err)
+}
+
+// pick removes the fields not in keep from v if it is an
+// object, or from each object in v if it is an array.
+func pick(v interface{}, keep map[string]bool) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			if obj, ok := v[i].(map[string]interface{}); ok {
+				v[i] = pick(obj, keep)
+			}
+		}
+	case map[string]interface{}:
+		for k := range v {
+			if !keep[k] {
+				delete(v, k)
+			}
+		}
+	}
+	return v
+}
+
 // Array returns an empty JSON array if v is a nil slice,
 // so that it renders as "[]" rather than "null".
 // Otherwise, it returns v.
@@ -3,11 +3,13 @@ package httpjson
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"chain/log"
 )
@@ -32,6 +34,115 @@ func TestWriteArray(t *testing.T) {
 	}
 }
 
+func TestMarshalStringNumbers(t *testing.T) {
+	type base struct {
+		ID     string `json:"id"`
+		Height uint64 `json:"height"`
+	}
+	type out struct {
+		base
+		Amount uint64          `json:"amount"`
+		Delta  int64           `json:"delta"`
+		Rate   float64         `json:"rate"`
+		Items  []int64         `json:"items"`
+		Ref    json.RawMessage `json:"ref,omitempty"`
+		Hidden uint64          `json:"-"`
+		When   time.Time       `json:"when"`
+		Count  int             `json:"count,string"`
+	}
+	cases := []struct {
+		in   interface{}
+		want string
+	}{
+		{uint64(7), `"7"`},
+		{uint64(1<<53 + 1), `"9007199254740993"`},
+		{int64(1 << 53), `9007199254740992`},
+		{int64(-1<<53 - 1), `"-9007199254740993"`},
+		{
+			out{base: base{"a", 7}, Amount: 1<<63 + 1, Delta: -1 << 62, Rate: 0.5, Items: []int64{1, 1 << 60}, When: time.Unix(0, 0).UTC()},
+			`{"id":"a","height":"7","amount":"9223372036854775809","delta":"-4611686018427387904","rate":0.5,"items":[1,"1152921504606846976"],"when":"1970-01-01T00:00:00Z","count":"0"}`,
+		},
+		{
+			&out{Ref: json.RawMessage(`{"z":1,"a":9007199254740993,"s":"9007199254740993"}`)},
+			`{"id":"","height":"0","amount":"0","delta":0,"rate":0,"items":null,"ref":{"z":1,"a":"9007199254740993","s":"9007199254740993"},"when":"0001-01-01T00:00:00Z","count":"0"}`,
+		},
+		{map[string]interface{}{"b": json.Number("12"), "a": uint64(3)}, `{"a":"3","b":12}`},
+		{[]string{"99999999999999999999"}, `["99999999999999999999"]`},
+		{[]byte("hi"), `"aGk="`},
+	}
+
+	for _, c := range cases {
+		got, err := marshalStringNumbers(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("marshalStringNumbers(%v) = %s want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestReadQuotedInts(t *testing.T) {
+	type cursor struct {
+		StartTime  uint64 `json:"start_time"`
+		SinceBlock uint64 `json:"since_block"`
+	}
+	var x struct {
+		Next    cursor                   `json:"next"`
+		Heights []uint64                 `json:"heights"`
+		Delta   int64                    `json:"delta"`
+		Alias   string                   `json:"alias"`
+		Actions []map[string]interface{} `json:"actions"`
+	}
+	body := `{"next":{"start_time":"1500000000000","since_block":7},"heights":["18446744073709551615"],"delta":"-3","alias":"12","actions":[{"amount":"5"}]}`
+	err := Read(context.Background(), strings.NewReader(body), &x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Next.StartTime != 1500000000000 || x.Next.SinceBlock != 7 || x.Heights[0] != 1<<64-1 || x.Delta != -3 || x.Alias != "12" {
+		t.Errorf("Read(%s) = %+v", body, x)
+	}
+	if x.Actions[0]["amount"] != "5" {
+		t.Errorf("untyped amount = %#v, want unchanged string", x.Actions[0]["amount"])
+	}
+
+	err = Read(context.Background(), strings.NewReader(`{"delta":"x"}`), &x)
+	if err == nil {
+		t.Error("Read with a non-integer string for an integer field succeeded, want error")
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	type item struct {
+		ID     string `json:"id"`
+		Alias  string `json:"alias"`
+		Amount uint64 `json:"amount"`
+	}
+	cases := []struct {
+		in     interface{}
+		fields []string
+		want   string
+	}{
+		{item{"a", "x", 1 << 63}, []string{"id", "amount"}, `{"amount":9223372036854775808,"id":"a"}`},
+		{[]item{{"a", "x", 1}, {"b", "y", 2}}, []string{"alias"}, `[{"alias":"x"},{"alias":"y"}]`},
+		{
+			map[string]interface{}{"items": []item{{"a", "x", 1}}, "last_page": true},
+			[]string{"id", "missing"},
+			`{"items":[{"id":"a"}],"last_page":true}`,
+		},
+		{[]string{"a"}, []string{"id"}, `["a"]`},
+	}
+	for _, c := range cases {
+		got, err := selectFields(c.in, c.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("selectFields(%v, %v) = %s want %s", c.in, c.fields, got, c.want)
+		}
+	}
+}
+
 func TestWriteErr(t *testing.T) {
 	var buf bytes.Buffer
 	log.SetOutput(&buf)
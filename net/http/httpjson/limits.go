@@ -0,0 +1,198 @@
+package httpjson
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"chain/errors"
+)
+
+// ErrRequestTooLarge indicates the request body was longer
+// than the handler's MaxBodySize.
+var ErrRequestTooLarge = errors.New("httpjson: request body too large")
+
+// Option configures a handler returned by Handler.
+type Option func(*handler)
+
+// MaxBodySize limits request bodies to n bytes. Reading a
+// longer body stops after n bytes and fails with
+// ErrRequestTooLarge, so oversized requests are rejected
+// without being held in memory.
+func MaxBodySize(n int64) Option {
+	return func(h *handler) { h.maxBodySize = n }
+}
+
+// DisallowUnknownFields rejects request bodies containing
+// object keys that don't match a field of the struct they
+// decode into, at any depth, with ErrBadRequest. Without it,
+// a misspelled parameter is silently ignored. Values decoded
+// by their own UnmarshalJSON or UnmarshalText methods, and
+// maps, may have any keys.
+func DisallowUnknownFields() Option {
+	return func(h *handler) { h.strict = true }
+}
+
+// limitedReader reads from r until more than n bytes have
+// been read, then fails with ErrRequestTooLarge.
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, errors.WithDetailf(ErrRequestTooLarge, "request body exceeds %d bytes", l.limit)
+	}
+	return n, err
+}
+
+// readStrict is like Read, but also fails if the JSON text
+// has object keys that v has no field for.
+func readStrict(ctx context.Context, r io.Reader, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if errors.Root(err) == ErrRequestTooLarge {
+		return err
+	} else if err != nil {
+		return errors.WithDetail(ErrBadRequest, err.Error())
+	}
+	err = Read(ctx, bytes.NewReader(b), v)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	err = dec.Decode(&generic)
+	if err != nil {
+		return errors.WithDetail(ErrBadRequest, err.Error())
+	}
+	if field := unknownField(generic, reflect.TypeOf(v), ""); field != "" {
+		return errors.WithDetailf(ErrBadRequest, "unknown field %q", field)
+	}
+	return nil
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// unknownField returns the path of the first object key in v
+// that has no matching field in type t, or "" if there is
+// none. Keys match fields the way encoding/json matches them.
+func unknownField(v interface{}, t reflect.Type, path string) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pt := reflect.PtrTo(t)
+	if pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		return ""
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		fields := jsonFields(t)
+		for k, fv := range obj {
+			ft, ok := fields[k]
+			if !ok {
+				for name, typ := range fields {
+					if strings.EqualFold(name, k) {
+						ft, ok = typ, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return join(path, k)
+			}
+			if f := unknownField(fv, ft, join(path, k)); f != "" {
+				return f
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return ""
+		}
+		for i, ev := range arr {
+			if f := unknownField(ev, t.Elem(), join(path, strconv.Itoa(i))); f != "" {
+				return f
+			}
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		for k, ev := range obj {
+			if f := unknownField(ev, t.Elem(), join(path, k)); f != "" {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// jsonFields returns the types of the fields of struct type
+// t, by their JSON names, including those promoted from
+// embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if j := strings.Index(tag, ","); j >= 0 {
+			name = tag[:j]
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for n, typ := range jsonFields(ft) {
+				if _, ok := fields[n]; !ok {
+					fields[n] = typ
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func join(path, k string) string {
+	if path == "" {
+		return k
+	}
+	return fmt.Sprintf("%s.%s", path, k)
+}
@@ -0,0 +1,476 @@
+package httpjson
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"chain/errors"
+)
+
+// maxSafeInt is the largest integer n such that n and
+// every integer smaller in magnitude is exactly
+// representable as a float64.
+var maxSafeInt = big.NewInt(1 << 53)
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	numberType        = reflect.TypeOf(json.Number(""))
+)
+
+// marshalStringNumbers returns the JSON encoding of v, as
+// encoding/json would produce it, except that uint64 values
+// are strings, and other integers larger in magnitude than
+// maxSafeInt are strings holding the same digits. Objects
+// keep the order of their fields. The JSON produced by a
+// json.Marshaler is kept, except that its integers larger in
+// magnitude than maxSafeInt are quoted; smaller uint64 values
+// in it stay numbers.
+func marshalStringNumbers(v interface{}) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	err := encodeStringNumbers(&buf, reflect.ValueOf(v))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeStringNumbers(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+	if v.CanInterface() {
+		if v.Type() == numberType {
+			return writeMarshaled(buf, v.Interface())
+		}
+		if marshals(v.Type()) {
+			if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+				buf.WriteString("null")
+				return nil
+			}
+			return writeMarshaled(buf, v.Interface())
+		}
+		if v.CanAddr() && marshals(reflect.PtrTo(v.Type())) {
+			return writeMarshaled(buf, v.Addr().Interface())
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint64:
+		buf.WriteString(strconv.Quote(strconv.FormatUint(v.Uint(), 10)))
+	case reflect.Int, reflect.Int64:
+		n := v.Int()
+		if n > 1<<53 || n < -1<<53 {
+			buf.WriteString(strconv.Quote(strconv.FormatInt(n, 10)))
+		} else {
+			buf.WriteString(strconv.FormatInt(n, 10))
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeStringNumbers(buf, v.Elem())
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return writeMarshaled(buf, v.Interface())
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeKey(buf, k)
+			err := encodeStringNumbers(buf, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())))
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return writeMarshaled(buf, v.Interface()) // base64
+		}
+		fallthrough
+	case reflect.Array:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := encodeStringNumbers(buf, v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case reflect.String:
+		b, err := json.Marshal(v.String())
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	default:
+		if !v.CanInterface() {
+			return errors.New("can't encode unexported value of type " + v.Type().String())
+		}
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// marshals reports whether encoding/json leaves the
+// encoding of values of type t to t itself.
+func marshals(t reflect.Type) bool {
+	return t.Implements(marshalerType) || t.Implements(textMarshalerType)
+}
+
+// encodeStruct encodes the fields of v that encoding/json
+// would, in the same order and under the same names.
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+	first := true
+	for _, f := range encodedFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeKey(buf, f.name)
+		if f.quoted && quotable(fv.Kind()) {
+			// As encoding/json does for a ",string" field.
+			b, err := json.Marshal(fv.Interface())
+			if err != nil {
+				return err
+			}
+			buf.WriteString(strconv.Quote(string(b)))
+			continue
+		}
+		err := encodeStringNumbers(buf, fv)
+		if err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// quotable reports whether the ",string" option applies to a
+// field of kind k.
+func quotable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+type encodedField struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	quoted    bool // has the ",string" option
+}
+
+var fieldCache struct {
+	sync.Mutex
+	m map[reflect.Type][]encodedField
+}
+
+// encodedFields returns the fields of struct type t that
+// encoding/json encodes, including those promoted from
+// embedded structs, in the order it encodes them.
+func encodedFields(t reflect.Type) []encodedField {
+	fieldCache.Lock()
+	defer fieldCache.Unlock()
+	if f, ok := fieldCache.m[t]; ok {
+		return f
+	}
+	if fieldCache.m == nil {
+		fieldCache.m = make(map[reflect.Type][]encodedField)
+	}
+	f := findEncodedFields(t)
+	fieldCache.m[t] = f
+	return f
+}
+
+func findEncodedFields(t reflect.Type) []encodedField {
+	var all []encodedField
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			ft := sf.Type
+			if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if sf.PkgPath != "" && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+				continue // unexported
+			}
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if i := strings.Index(tag, ","); i >= 0 {
+				name, opts = tag[:i], tag[i:]
+			}
+			idx := append(append([]int(nil), index...), i)
+			if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+				walk(ft, idx)
+				continue
+			}
+			f := encodedField{name: name, index: idx, tagged: name != ""}
+			if name == "" {
+				f.name = sf.Name
+			}
+			f.omitEmpty = strings.Contains(opts, ",omitempty")
+			f.quoted = strings.Contains(opts, ",string")
+			all = append(all, f)
+		}
+	}
+	walk(t, nil)
+
+	// As in encoding/json, of fields with the same name the
+	// shallowest wins, then a tagged one; otherwise none do.
+	var fields []encodedField
+	for i, f := range all {
+		dominant, tie := true, false
+		for j, g := range all {
+			if i == j || g.name != f.name {
+				continue
+			}
+			switch {
+			case len(g.index) < len(f.index):
+				dominant = false
+			case len(g.index) == len(f.index) && g.tagged && !f.tagged:
+				dominant = false
+			case len(g.index) == len(f.index) && g.tagged == f.tagged:
+				tie = true
+			}
+		}
+		if dominant && !tie {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// fieldByIndex is like v.FieldByIndex, but reports false
+// instead of panicking when it meets a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func writeKey(buf *bytes.Buffer, k string) {
+	b, _ := json.Marshal(k) // strings always marshal
+	buf.Write(b)
+	buf.WriteByte(':')
+}
+
+// writeMarshaled writes the encoding/json encoding of v,
+// such as JSON a response holds verbatim, in which only
+// integers larger in magnitude than maxSafeInt can be
+// recognized and quoted.
+func writeMarshaled(buf *bytes.Buffer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	quoteLargeInts(buf, b)
+	return nil
+}
+
+// quoteLargeInts copies the JSON text b to buf, quoting each
+// integer larger in magnitude than maxSafeInt.
+func quoteLargeInts(buf *bytes.Buffer, b []byte) {
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(b) && b[j] != '"' {
+				if b[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j++
+			if j > len(b) {
+				j = len(b)
+			}
+			buf.Write(b[i:j])
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(b) && strings.IndexByte("0123456789.eE+-", b[j]) >= 0 {
+				j++
+			}
+			num := b[i:j]
+			n, ok := new(big.Int).SetString(string(num), 10)
+			if ok && new(big.Int).Abs(n).Cmp(maxSafeInt) > 0 {
+				buf.WriteByte('"')
+				buf.Write(num)
+				buf.WriteByte('"')
+			} else {
+				buf.Write(num)
+			}
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+}
+
+// UnquoteInts returns the JSON text data with each string
+// holding an integer replaced by that integer, where type t
+// decodes the string's value into an integer field. It lets
+// a client that set NumbersHeader send amounts and cursors
+// back as it received them. Values of types with their own
+// UnmarshalJSON or UnmarshalText methods are left as they
+// are. If nothing is replaced, data is returned unchanged.
+func UnquoteInts(data []byte, t reflect.Type) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	err := dec.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	generic, changed := unquoteInts(generic, t)
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(generic)
+}
+
+func unquoteInts(v interface{}, t reflect.Type) (interface{}, bool) {
+	if t == nil {
+		return v, false
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pt := reflect.PtrTo(t)
+	if pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		return v, false
+	}
+
+	changed := false
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, ok := v.(string)
+		if !ok {
+			return v, false
+		}
+		if _, ok := new(big.Int).SetString(s, 10); !ok {
+			return v, false // left for the decoder to reject
+		}
+		return json.Number(s), true
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, false
+		}
+		fields := jsonFields(t)
+		for k, fv := range obj {
+			ft, ok := fields[k]
+			if !ok {
+				for name, typ := range fields {
+					if strings.EqualFold(name, k) {
+						ft, ok = typ, true
+						break
+					}
+				}
+			}
+			if ok {
+				var c bool
+				obj[k], c = unquoteInts(fv, ft)
+				changed = changed || c
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return v, false
+		}
+		for i := range arr {
+			var c bool
+			arr[i], c = unquoteInts(arr[i], t.Elem())
+			changed = changed || c
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, false
+		}
+		for k := range obj {
+			var c bool
+			obj[k], c = unquoteInts(obj[k], t.Elem())
+			changed = changed || c
+		}
+	}
+	return v, changed
+}
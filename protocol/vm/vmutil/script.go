@@ -1,6 +1,8 @@
 package vmutil
 
 import (
+	"math"
+
 	"chain/crypto/ed25519"
 	"chain/errors"
 	"chain/protocol/vm"
@@ -135,6 +137,53 @@ func ParseP2SPMultiSigProgram(program []byte) ([]ed25519.PublicKey, int, error)
 	return pubkeys, int(nrequired), nil
 }
 
+// TimeLockProgram returns a program that runs prog, but only
+// for a transaction whose minimum time is at least unlockMS.
+// Since a transaction can't be included in a block timestamped
+// before its minimum time, an output controlled by the result
+// can't be spent before unlockMS. The result is: MINTIME
+// <unlockMS> GREATERTHANOREQUAL VERIFY <prog>
+func TimeLockProgram(unlockMS uint64, prog []byte) ([]byte, error) {
+	if unlockMS == 0 || unlockMS > math.MaxInt64 {
+		return nil, errors.Wrap(ErrBadValue)
+	}
+	builder := NewBuilder()
+	builder.AddOp(vm.OP_MINTIME).AddInt64(int64(unlockMS))
+	builder.AddOp(vm.OP_GREATERTHANOREQUAL).AddOp(vm.OP_VERIFY)
+	builder.AddRawBytes(prog)
+	return builder.Build()
+}
+
+// ParseTimeLockProgram returns the unlock time and the wrapped
+// program of a program made by TimeLockProgram. It returns
+// false for any other program.
+func ParseTimeLockProgram(program []byte) (unlockMS uint64, prog []byte, ok bool) {
+	if len(program) == 0 || program[0] != byte(vm.OP_MINTIME) {
+		return 0, nil, false // cheap check for the common case
+	}
+	var pops []vm.Instruction
+	for pc := uint32(0); len(pops) < 4 && pc < uint32(len(program)); {
+		inst, err := vm.ParseOp(program, pc)
+		if err != nil {
+			return 0, nil, false
+		}
+		pops = append(pops, inst)
+		pc += inst.Len
+	}
+	if len(pops) < 4 || pops[2].Op != vm.OP_GREATERTHANOREQUAL || pops[3].Op != vm.OP_VERIFY {
+		return 0, nil, false
+	}
+	if !(pops[1].Op >= vm.OP_1 && pops[1].Op <= vm.OP_16) && pops[1].Op > vm.OP_PUSHDATA4 {
+		return 0, nil, false
+	}
+	n, err := vm.AsInt64(pops[1].Data)
+	if err != nil || n <= 0 {
+		return 0, nil, false
+	}
+	prefix := pops[0].Len + pops[1].Len + pops[2].Len + pops[3].Len
+	return uint64(n), program[prefix:], true
+}
+
 func checkMultiSigParams(nrequired, npubkeys int64) error {
 	if nrequired < 0 {
 		return errors.WithDetail(ErrBadValue, "negative quorum")
@@ -150,3 +199,50 @@ func checkMultiSigParams(nrequired, npubkeys int64) error {
 	}
 	return nil
 }
+
+// HTLCProgram returns a hash time-locked program. Before
+// expiresMS, the payee can spend an output it controls by
+// revealing a preimage whose SHA-256 hash is hash; from
+// expiresMS on, the payer can. Either way, the spender also
+// signs a predicate, as with P2SPMultiSigProgram.
+//
+// The arguments to the result are [1 PREIMAGE 2 SIG PREDICATE]
+// to claim and [0 1 SIG PREDICATE] to refund: a selector,
+// the preimage if claiming, and then the arguments to a
+// 1-of-1 P2SP program whose predicate gets the rest.
+func HTLCProgram(hash []byte, expiresMS uint64, payee, payer ed25519.PublicKey) ([]byte, error) {
+	if len(hash) != 32 || expiresMS == 0 || expiresMS > math.MaxInt64 {
+		return nil, errors.Wrap(ErrBadValue)
+	}
+	if len(payee) != ed25519.PublicKeySize || len(payer) != ed25519.PublicKeySize {
+		return nil, errors.Wrap(ErrBadValue)
+	}
+	builder := NewBuilder()
+	claim := builder.NewJumpTarget()
+	check := builder.NewJumpTarget()
+	builder.AddOp(vm.OP_DEPTH).AddOp(vm.OP_1SUB).AddOp(vm.OP_PICK) // copy the selector from the bottom of the stack
+	builder.AddJumpIf(claim)
+
+	// Refund: the transaction can't be in a block before expiresMS.
+	builder.AddOp(vm.OP_MINTIME).AddInt64(int64(expiresMS))
+	builder.AddOp(vm.OP_GREATERTHANOREQUAL).AddOp(vm.OP_VERIFY)
+	builder.AddData(payer)
+	builder.AddJump(check)
+
+	// Claim: the preimage is right, and the transaction must be in
+	// a block before expiresMS.
+	builder.SetJumpTarget(claim)
+	builder.AddInt64(3).AddOp(vm.OP_PICK) // stack is now [... PREIMAGE 2 SIG PREDICATE PREIMAGE]
+	builder.AddOp(vm.OP_SHA256).AddData(hash).AddOp(vm.OP_EQUALVERIFY)
+	builder.AddOp(vm.OP_MAXTIME).AddInt64(int64(expiresMS))
+	builder.AddOp(vm.OP_LESSTHAN).AddOp(vm.OP_VERIFY)
+	builder.AddData(payee)
+
+	builder.SetJumpTarget(check) // stack is now [... NARGS SIG PREDICATE PUB]
+	builder.AddOp(vm.OP_SWAP).AddOp(vm.OP_DUP).AddOp(vm.OP_TOALTSTACK)
+	builder.AddOp(vm.OP_SHA3).AddOp(vm.OP_SWAP) // stack is now [... NARGS SIG PREDICATEHASH PUB]
+	builder.AddInt64(1).AddInt64(1).AddOp(vm.OP_CHECKMULTISIG).AddOp(vm.OP_VERIFY)
+	builder.AddOp(vm.OP_FROMALTSTACK)
+	builder.AddInt64(0).AddOp(vm.OP_CHECKPREDICATE)
+	return builder.Build()
+}
@@ -2,9 +2,15 @@ package vmutil
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"math"
 	"testing"
 
+	"golang.org/x/crypto/sha3"
+
 	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/vm"
 )
 
 // TestIsUnspendable ensures the IsUnspendable function returns the expected
@@ -108,3 +114,105 @@ func TestBlockMultisig(t *testing.T) {
 		t.Errorf("expected second pubkey to be %x, got %x", pub2, pubs[1])
 	}
 }
+
+func TestTimeLock(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	inner, _ := P2SPMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	for _, unlockMS := range []uint64{1, 16, 17, 1500000000000, math.MaxInt64} {
+		prog, err := TimeLockProgram(unlockMS, inner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotMS, gotInner, ok := ParseTimeLockProgram(prog)
+		if !ok || gotMS != unlockMS || !bytes.Equal(gotInner, inner) {
+			t.Errorf("ParseTimeLockProgram(TimeLockProgram(%d, %x)) = %d, %x, %v", unlockMS, inner, gotMS, gotInner, ok)
+		}
+	}
+	if _, _, ok := ParseTimeLockProgram(inner); ok {
+		t.Errorf("ParseTimeLockProgram(%x) = ok, want not ok", inner)
+	}
+	for _, unlockMS := range []uint64{0, math.MaxInt64 + 1} {
+		if _, err := TimeLockProgram(unlockMS, inner); errors.Root(err) != ErrBadValue {
+			t.Errorf("TimeLockProgram(%d) error = %v, want %v", unlockMS, err, ErrBadValue)
+		}
+	}
+}
+
+func TestTimeLockVerify(t *testing.T) {
+	prog, err := TimeLockProgram(1500000000000, []byte{byte(vm.OP_TRUE)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		minTimeMS uint64
+		ok        bool
+	}{
+		{0, false},
+		{1499999999999, false},
+		{1500000000000, true},
+		{1600000000000, true},
+	}
+	for _, c := range cases {
+		minTimeMS := c.minTimeMS
+		err := vm.Verify(&vm.Context{VMVersion: 1, Code: prog, MinTimeMS: &minTimeMS})
+		if (err == nil) != c.ok {
+			t.Errorf("Verify with min time %d = %v, want ok %v", c.minTimeMS, err, c.ok)
+		}
+	}
+}
+
+func TestHTLCVerify(t *testing.T) {
+	payee, payeePrv, _ := ed25519.GenerateKey(nil)
+	payer, payerPrv, _ := ed25519.GenerateKey(nil)
+	preimage := []byte("open sesame")
+	hash := sha256.Sum256(preimage)
+	const expiresMS = 1500000000000
+	prog, err := HTLCProgram(hash[:], expiresMS, payee, payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pred := []byte{byte(vm.OP_TRUE)}
+	predHash := sha3.Sum256(pred)
+	payeeSig := ed25519.Sign(payeePrv, predHash[:])
+	payerSig := ed25519.Sign(payerPrv, predHash[:])
+	claim := func(preimage, sig []byte) [][]byte {
+		return [][]byte{vm.Int64Bytes(1), preimage, vm.Int64Bytes(2), sig, pred}
+	}
+	refund := func(sig []byte) [][]byte {
+		return [][]byte{vm.Int64Bytes(0), vm.Int64Bytes(1), sig, pred}
+	}
+	cases := []struct {
+		name      string
+		args      [][]byte
+		minTimeMS uint64
+		maxTimeMS uint64
+		ok        bool
+	}{
+		{"claim", claim(preimage, payeeSig), 0, expiresMS - 1, true},
+		{"claim with the wrong preimage", claim([]byte("open barley"), payeeSig), 0, expiresMS - 1, false},
+		{"claim signed by the payer", claim(preimage, payerSig), 0, expiresMS - 1, false},
+		{"claim at expiry", claim(preimage, payeeSig), 0, expiresMS, false},
+		{"claim without a max time", claim(preimage, payeeSig), 0, 0, false},
+		{"refund", refund(payerSig), expiresMS, 0, true},
+		{"refund signed by the payee", refund(payeeSig), expiresMS, 0, false},
+		{"refund before expiry", refund(payerSig), expiresMS - 1, 0, false},
+	}
+	for _, c := range cases {
+		minTimeMS, maxTimeMS := c.minTimeMS, c.maxTimeMS
+		err := vm.Verify(&vm.Context{
+			VMVersion: 1,
+			Code:      prog,
+			Arguments: c.args,
+			MinTimeMS: &minTimeMS,
+			MaxTimeMS: &maxTimeMS,
+		})
+		if (err == nil) != c.ok {
+			t.Errorf("%s: Verify = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+
+	if _, err := HTLCProgram(hash[:31], expiresMS, payee, payer); errors.Root(err) != ErrBadValue {
+		t.Errorf("HTLCProgram with a short hash error = %v, want %v", err, ErrBadValue)
+	}
+}